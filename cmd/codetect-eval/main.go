@@ -56,6 +56,8 @@ func runEval(args []string) {
 	parallel := fs.Int("parallel", 10, "Number of parallel test case executions")
 	fs.IntVar(parallel, "j", 10, "Short for --parallel (like make -j)")
 	timeout := fs.Duration("timeout", 5*time.Minute, "Timeout per test case")
+	mcpTimeout := fs.Duration("mcp-timeout", 0, "Timeout per codetect tool call in MCP-enabled runs (default: none)")
+	mcpConcurrency := fs.Int("mcp-concurrency", 0, "Max concurrent MCP-enabled invocations (0 = no cap)")
 	model := fs.String("model", "sonnet", "Model to use (sonnet, haiku, opus)")
 	verbose := fs.Bool("verbose", false, "Verbose output")
 	fs.BoolVar(verbose, "v", false, "Short for --verbose")
@@ -66,6 +68,8 @@ func runEval(args []string) {
 	config.OutputDir = *outputDir
 	config.Parallel = *parallel
 	config.Timeout = *timeout
+	config.MCPTimeout = *mcpTimeout
+	config.MCPConcurrency = *mcpConcurrency
 	config.Model = *model
 	config.Verbose = *verbose
 
@@ -372,6 +376,10 @@ Run Options:
   --category <cat>   Filter by category (search,navigate,understand)
   --parallel <n>     Number of parallel executions (default: 10)
   --timeout <dur>    Timeout per test (default: 5m)
+  --mcp-timeout <dur>
+                     Timeout per codetect tool call (default: none)
+  --mcp-concurrency <n>
+                     Max concurrent MCP-enabled invocations (default: no cap)
   --model <model>    Model to use: sonnet (default), haiku, opus
   --verbose          Verbose output
 
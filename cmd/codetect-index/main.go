@@ -3,20 +3,29 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
 	ignore "github.com/sabhiram/go-gitignore"
 
+	"codetect/internal/chunker"
 	"codetect/internal/config"
 	"codetect/internal/db"
 	"codetect/internal/embedding"
 	"codetect/internal/indexer"
 	"codetect/internal/logging"
+	"codetect/internal/merkle"
+	"codetect/internal/profiling"
 	"codetect/internal/search/symbols"
 )
 
@@ -42,6 +51,36 @@ func main() {
 	case "stats":
 		runStats(os.Args[2:])
 
+	case "chunks":
+		runChunks(os.Args[2:])
+
+	case "import-embeddings":
+		runImportEmbeddings(os.Args[2:])
+
+	case "export":
+		runExport(os.Args[2:])
+
+	case "import":
+		runImportBundle(os.Args[2:])
+
+	case "diff":
+		runDiff(os.Args[2:])
+
+	case "duplicates":
+		runDuplicates(os.Args[2:])
+
+	case "verify":
+		runVerify(os.Args[2:])
+
+	case "history":
+		runHistory(os.Args[2:])
+
+	case "queries":
+		runQueries(os.Args[2:])
+
+	case "merkle":
+		runMerkle(os.Args[2:])
+
 	case "version":
 		fmt.Printf("codetect-index v%s\n", version)
 
@@ -63,22 +102,39 @@ func runIndex(args []string) {
 	verbose := fs.Bool("verbose", false, "Enable verbose output")
 	fs.BoolVar(verbose, "v", false, "Short for --verbose")
 	jsonOutput := fs.Bool("json", false, "Output results as JSON")
+	reportSkipped := fs.Bool("report-skipped", false, "Report skipped files by reason (v2)")
+	reportCoverage := fs.Bool("report-coverage", false, "Report indexed and embedded files by language (v2)")
+	forceInclude := forceIncludeFlag(fs)
+	includeHidden := includeHiddenFlag(fs)
+	maxEmbeddings := maxEmbeddingsFlag(fs)
+	var alwaysEmbed []string
+	fs.Func("always-embed", "Re-embed files matching this glob on every run, bypassing the cache (v2, repeatable)", func(v string) error {
+		alwaysEmbed = append(alwaysEmbed, v)
+		return nil
+	})
+	profileDir := profileFlag(fs)
 	fs.Parse(args)
+	defer startProfile(*profileDir)()
 
-	path := "."
-	if fs.NArg() > 0 {
-		path = fs.Arg(0)
+	if fs.NArg() > 1 && !*useV2 {
+		logger.Error("indexing multiple paths requires --v2")
+		os.Exit(1)
 	}
-
-	// Convert to absolute path
-	absPath, err := filepath.Abs(path)
-	if err != nil {
-		logger.Error("invalid path", "error", err)
+	if *maxEmbeddings > 0 && !*useV2 {
+		logger.Error("--max-embeddings requires --v2")
+		os.Exit(1)
+	}
+	if len(alwaysEmbed) > 0 && !*useV2 {
+		logger.Error("--always-embed requires --v2")
 		os.Exit(1)
 	}
 
+	// Convert to absolute paths
+	absPaths := repoPathArgs(fs)
+	absPath := absPaths[0]
+
 	if *useV2 {
-		runIndexV2(absPath, *force, *verbose, *jsonOutput)
+		runIndexV2(absPaths, *force, *verbose, *jsonOutput, *reportSkipped, *reportCoverage, *forceInclude, *includeHidden, *maxEmbeddings, alwaysEmbed)
 		return
 	}
 
@@ -110,8 +166,6 @@ func runIndex(args []string) {
 
 	logger.Info("indexing", "path", absPath, "database", dbConfig.String())
 
-	start := time.Now()
-
 	// Open or create index using config-aware constructor with repoRoot for multi-repo isolation
 	idx, err := symbols.NewIndexWithConfig(cfg, absPath)
 	if err != nil {
@@ -121,121 +175,252 @@ func runIndex(args []string) {
 	defer idx.Close()
 
 	// Run indexing
+	var result *symbols.IndexResult
 	if *force {
 		logger.Info("running full reindex")
-		if err := idx.FullReindex(absPath); err != nil {
-			logger.Error("indexing failed", "error", err)
-			os.Exit(1)
-		}
+		result, err = idx.FullReindex(absPath)
 	} else {
 		logger.Info("running incremental index")
-		if err := idx.Update(absPath); err != nil {
-			logger.Error("indexing failed", "error", err)
-			os.Exit(1)
-		}
+		result, err = idx.Update(absPath)
 	}
-
-	// Print stats
-	symbolCount, fileCount, err := idx.Stats()
 	if err != nil {
-		logger.Warn("could not get stats", "error", err)
-	} else {
-		elapsed := time.Since(start)
-		logger.Info("indexing complete",
-			"symbols", symbolCount,
-			"files", fileCount,
-			"duration", elapsed.Round(time.Millisecond))
+		logger.Error("indexing failed", "error", err)
+		os.Exit(1)
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			logger.Error("encoding JSON failed", "error", err)
+			os.Exit(1)
+		}
+		return
 	}
+	logger.Info("indexing complete",
+		"symbols", result.TotalSymbols,
+		"files", result.TotalFiles,
+		"files_indexed", result.Files,
+		"change_type", result.ChangeType,
+		"duration", result.Duration.Round(time.Millisecond))
 }
 
 // runIndexV2 uses the new v2 indexer with Merkle tree change detection,
-// AST-based chunking, and content-addressed embedding cache.
-func runIndexV2(absPath string, force, verbose, jsonOutput bool) {
+// AST-based chunking, and content-addressed embedding cache. Several repos
+// are indexed in turn, sharing the database connection and embedder; a repo
+// that fails does not stop the rest.
+func runIndexV2(absPaths []string, force, verbose, jsonOutput, reportSkipped, reportCoverage bool, forceInclude, includeHidden []string, maxEmbeddings int, alwaysEmbed []string) {
 	// Load configuration from environment
 	dbConfig := config.LoadDatabaseConfigFromEnv()
 	embConfig := embedding.LoadConfigFromEnv()
 
 	// Build indexer config
 	cfg := &indexer.Config{
-		DBType:            string(dbConfig.Type),
-		Dimensions:        dbConfig.VectorDimensions,
-		EmbeddingProvider: string(embConfig.Provider),
-		EmbeddingModel:    embConfig.Model,
-		OllamaURL:         embConfig.OllamaURL,
-		LiteLLMURL:        embConfig.LiteLLMURL,
-		LiteLLMKey:        embConfig.LiteLLMKey,
-		BatchSize:         32,
-		MaxWorkers:        4,
-	}
-
-	// Set database path/DSN
+		DBType:                 string(dbConfig.Type),
+		Dimensions:             dbConfig.VectorDimensions,
+		EmbeddingProvider:      string(embConfig.Provider),
+		EmbeddingModel:         embConfig.Model,
+		OllamaURL:              embConfig.OllamaURL,
+		LiteLLMURL:             embConfig.LiteLLMURL,
+		LiteLLMKey:             embConfig.LiteLLMKey,
+		EmbeddingCompress:      embConfig.Compress,
+		EmbeddingFallback:      embConfig.Fallback,
+		ExtraModels:            embConfig.ExtraModels,
+		BatchSize:              32,
+		MaxWorkers:             4,
+		CacheWriteBatchSize:    dbConfig.WriteBatchSize,
+		CacheWriteWorkers:      dbConfig.WriteWorkers,
+		LocationWriteBatchSize: dbConfig.LocationBatchSize,
+		CacheEncoding:          dbConfig.CacheEncoding,
+		DBBusyTimeout:          dbConfig.BusyTimeout,
+		DBReadRetries:          dbConfig.ReadRetries,
+		DBRetryBackoff:         dbConfig.RetryBackoff,
+	}
+
+	// Set database DSN; SQLite indexes live in each repo's .codetect/index.db
 	if dbConfig.Type == db.DatabasePostgres {
 		cfg.DSN = dbConfig.DSN
-	} else {
-		cfg.DBPath = filepath.Join(absPath, ".codetect", "index.db")
-	}
-
-	// Load gitignore patterns
-	cfg.IgnorePatterns = indexer.LoadGitignore(absPath)
-
-	if verbose {
-		logger.Info("v2 indexer starting",
-			"path", absPath,
-			"db_type", cfg.DBType,
-			"embedding_provider", cfg.EmbeddingProvider,
-			"embedding_model", cfg.EmbeddingModel)
 	}
 
-	// Create indexer
-	idx, err := indexer.New(absPath, cfg)
+	// Each repo's gitignore patterns are added by MultiRepo.Open
+	cfg.ForceIncludeDirs = forceInclude
+	cfg.IncludeHiddenDirs = includeHidden
+	cfg.MaxEmbeddings = maxEmbeddings
+	indexCfg := config.LoadIndexConfigFromEnv()
+	cfg.TrackRenames = indexCfg.TrackRenames
+	cfg.StoreContent = indexCfg.StoreContent
+	cfg.ChunkDeltas = indexCfg.ChunkDeltas
+	cfg.Concurrency = indexCfg.Concurrency
+	cfg.HashAlgo = indexCfg.HashAlgo
+	cfg.MerkleStore = indexCfg.MerkleStore
+	cfg.MerkleBackups = indexCfg.MerkleBackups
+	cfg.SkipNonSource = indexCfg.SkipNonSource
+	cfg.MaxFileSize = indexCfg.MaxFileSize
+
+	// Chunking options; the rest depend on each repo's chunk profile and
+	// are set by indexRepoV2
+	cfg.FileEmbeddings = config.LoadChunkingConfigFromEnv().FileEmbeddings
+	cfg.HNSW = config.LoadHNSWConfigFromEnv()
+	cfg.DistanceMetric = cfg.HNSW.DistanceMetric
+	cfg.VectorIndex = config.LoadVectorIndexTypeFromEnv()
+	cfg.PQ = config.LoadPQConfigFromEnv()
+	cfg.ShardByRepo = config.LoadVectorShardByRepoFromEnv()
+
+	repos, err := indexer.NewMultiRepo(cfg)
 	if err != nil {
 		logger.Error("creating v2 indexer failed", "error", err)
 		os.Exit(1)
 	}
-	defer idx.Close()
+	defer repos.Close()
 
-	// Run indexing
 	ctx := context.Background()
-	result, err := idx.Index(ctx, indexer.IndexOptions{
-		Force:   force,
-		Verbose: verbose,
-	})
-	if err != nil {
-		logger.Error("v2 indexing failed", "error", err)
-		os.Exit(1)
+	opts := indexer.IndexOptions{
+		Force:          force,
+		Verbose:        verbose,
+		ReportSkipped:  reportSkipped,
+		ReportCoverage: reportCoverage,
+		AlwaysEmbed:    alwaysEmbed,
+	}
+
+	var results []repoIndexResult
+	failed := 0
+	for _, absPath := range absPaths {
+		if verbose {
+			logger.Info("v2 indexer starting",
+				"path", absPath,
+				"db_type", cfg.DBType,
+				"embedding_provider", cfg.EmbeddingProvider,
+				"embedding_model", cfg.EmbeddingModel)
+		}
+
+		result, err := indexRepoV2(ctx, repos, absPath, opts)
+		if err != nil {
+			if !logBudgetError(absPath, err) {
+				logger.Error("v2 indexing failed", "path", absPath, "error", err)
+			}
+			results = append(results, repoIndexResult{RepoRoot: absPath, Error: err.Error()})
+			failed++
+			continue
+		}
+		results = append(results, repoIndexResult{RepoRoot: absPath, Result: result})
+
+		if !jsonOutput {
+			printIndexResultV2(absPath, result)
+		}
 	}
 
-	// Output results
-	if jsonOutput {
+	// Output results; a single repo keeps the plain IndexResult format
+	if jsonOutput && (len(results) > 1 || failed == 0) {
+		var out any = results
+		if len(results) == 1 {
+			out = results[0].Result
+		}
 		enc := json.NewEncoder(os.Stdout)
 		enc.SetIndent("", "  ")
-		if err := enc.Encode(result); err != nil {
+		if err := enc.Encode(out); err != nil {
 			logger.Error("encoding JSON failed", "error", err)
 			os.Exit(1)
 		}
-		return
 	}
 
-	// Human-readable output
+	if len(absPaths) > 1 && !jsonOutput {
+		logger.Info("indexed repositories", "repos", len(absPaths)-failed, "failed", failed)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// repoIndexResult is one repo's entry in multi-repo --json output.
+type repoIndexResult struct {
+	RepoRoot string               `json:"repo_root"`
+	Result   *indexer.IndexResult `json:"result,omitempty"`
+	Error    string               `json:"error,omitempty"`
+}
+
+// indexRepoV2 indexes one repo with an indexer from repos.
+func indexRepoV2(ctx context.Context, repos *indexer.MultiRepo, absPath string, opts indexer.IndexOptions) (*indexer.IndexResult, error) {
+	idx, err := repos.OpenWith(absPath, repoOptions(absPath))
+	if err != nil {
+		return nil, err
+	}
+	defer idx.Close()
+
+	result, err := idx.Index(ctx, opts)
+	closePipeline(absPath, idx.Pipeline())
+	return result, err
+}
+
+// repoOptions returns a MultiRepo.OpenWith hook setting the per-repo
+// options of the repo at absPath: its chunk profile (see
+// config.LoadChunkingConfig) with the chunking variables, and its chunk
+// metadata (see config.LoadMetadataConfig).
+func repoOptions(absPath string) func(*indexer.Config) error {
+	return func(cfg *indexer.Config) error {
+		if err := cfg.LoadChunking(absPath); err != nil {
+			return err
+		}
+		return cfg.LoadMetadata(absPath)
+	}
+}
+
+// printIndexResultV2 logs a human-readable summary of one repo's index run.
+func printIndexResultV2(absPath string, result *indexer.IndexResult) {
 	switch result.ChangeType {
 	case "none":
-		logger.Info("no changes detected, index is up to date")
+		logger.Info("no changes detected, index is up to date", "path", absPath)
 	case "incremental":
 		logger.Info("incremental index complete",
+			"path", absPath,
 			"files_processed", result.FilesProcessed,
 			"files_deleted", result.FilesDeleted,
+			"files_renamed", result.FilesRenamed,
+			"files_refreshed", result.FilesRefreshed,
+			"files_skipped", result.FilesSkipped,
 			"chunks_created", result.ChunksCreated,
 			"cache_hits", result.CacheHits,
 			"chunks_embedded", result.ChunksEmbedded,
 			"duration", result.Duration.Round(time.Millisecond))
 	case "full":
 		logger.Info("full index complete",
+			"path", absPath,
 			"files_processed", result.FilesProcessed,
+			"files_refreshed", result.FilesRefreshed,
+			"files_skipped", result.FilesSkipped,
 			"chunks_created", result.ChunksCreated,
 			"cache_hits", result.CacheHits,
 			"chunks_embedded", result.ChunksEmbedded,
 			"duration", result.Duration.Round(time.Millisecond))
 	}
+
+	logEmbedRequests(absPath, result.EmbedRequests)
+
+	if len(result.Rescheduled) > 0 {
+		logger.Warn("files changed during indexing will be retried on the next run",
+			"path", absPath, "count", len(result.Rescheduled), "files", result.Rescheduled)
+	}
+
+	if result.Skipped != nil {
+		result.Skipped.WriteText(os.Stderr)
+	}
+	if result.Coverage != nil {
+		result.Coverage.WriteText(os.Stderr)
+	}
+}
+
+// logEmbedRequests logs the latency percentiles and throughput of a run's
+// embedding backend requests, if any were made.
+func logEmbedRequests(absPath string, stats *embedding.RequestStats) {
+	if stats == nil {
+		return
+	}
+	logger.Info("embedding requests",
+		"path", absPath,
+		"requests", stats.Requests,
+		"requests_per_sec", fmt.Sprintf("%.1f", stats.RequestsPerSec),
+		"p50", stats.P50.Round(time.Millisecond),
+		"p95", stats.P95.Round(time.Millisecond),
+		"p99", stats.P99.Round(time.Millisecond))
 }
 
 func runEmbed(args []string) {
@@ -246,19 +431,27 @@ func runEmbed(args []string) {
 	model := fs.String("model", "", "Embedding model (provider-specific default if empty)")
 	parallel := fs.Int("parallel", 10, "Number of parallel embedding workers")
 	fs.IntVar(parallel, "j", 10, "Short for --parallel (like make -j)")
+	missingOnly := fs.Bool("missing-only", false, "Embed only v2 chunks missing from the embedding cache")
+	reportSkipped := fs.Bool("report-skipped", false, "Report skipped files by reason")
+	noEmoji := fs.Bool("no-emoji", false, "Keep the embedding preview ASCII (or CODETECT_NO_EMOJI)")
+	forceInclude := forceIncludeFlag(fs)
+	maxEmbeddings := maxEmbeddingsFlag(fs)
+	profileDir := profileFlag(fs)
 	fs.Parse(args)
+	defer startProfile(*profileDir)()
 
-	path := "."
-	if fs.NArg() > 0 {
-		path = fs.Arg(0)
+	if fs.NArg() > 1 && !*missingOnly {
+		logger.Error("embedding multiple paths requires --missing-only")
+		os.Exit(1)
 	}
-
-	absPath, err := filepath.Abs(path)
-	if err != nil {
-		logger.Error("invalid path", "error", err)
+	if *maxEmbeddings > 0 && !*missingOnly {
+		logger.Error("--max-embeddings requires --missing-only (or 'index --v2')")
 		os.Exit(1)
 	}
 
+	absPaths := repoPathArgs(fs)
+	absPath := absPaths[0]
+
 	// Load configuration from environment, with flag overrides
 	cfg := embedding.LoadConfigFromEnv()
 	if *provider != "" {
@@ -304,6 +497,11 @@ func runEmbed(args []string) {
 
 	logger.Info("using embedding provider", "provider", embedder.ProviderID())
 
+	if *missingOnly {
+		runEmbedMissing(absPaths, cfg, embedder, *parallel, *maxEmbeddings)
+		return
+	}
+
 	// Load database configuration from environment
 	dbConfig := config.LoadDatabaseConfigFromEnv()
 
@@ -379,6 +577,17 @@ func runEmbed(args []string) {
 	logger.Info("scanning files to embed")
 	var filesToEmbed []string
 	var totalSize int64
+	indexCfg := config.LoadIndexConfigFromEnv()
+	skipFilter := indexer.SkipFilter{
+		Supported:     isCodeFile,
+		SkipNonSource: indexCfg.SkipNonSource,
+		MaxFileSize:   indexCfg.MaxFileSize,
+	}
+	skipped := indexer.NewSkipReport()
+
+	// Ignored directories entered only to reach a --force-include-dir;
+	// nothing else inside them is embedded
+	routes := make(map[string]bool)
 
 	err = filepath.Walk(absPath, func(filePath string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -386,30 +595,55 @@ func runEmbed(args []string) {
 		}
 
 		relPath, _ := filepath.Rel(absPath, filePath)
+		within, onPath := merkle.MatchForceInclude(*forceInclude, relPath)
+		parentIsRoute := routes[filepath.Dir(relPath)]
 
 		if info.IsDir() {
 			name := info.Name()
-			// Always skip these directories
-			if name == ".git" || name == "node_modules" || name == "vendor" || name == ".codetect" {
+			// Never embed VCS metadata or the index itself
+			if name == ".git" || name == ".codetect" {
 				return filepath.SkipDir
 			}
-			// Check gitignore for directories
-			if gi != nil && gi.MatchesPath(relPath+"/") {
+			if within || relPath == "." {
+				return nil
+			}
+			ignored := name == "node_modules" || name == "vendor" ||
+				(gi != nil && gi.MatchesPath(relPath+"/"))
+			if onPath {
+				if ignored || parentIsRoute {
+					routes[relPath] = true
+				}
+				return nil
+			}
+			if parentIsRoute {
+				return filepath.SkipDir
+			}
+			if ignored {
+				if name != "node_modules" && name != "vendor" {
+					skipped.Add(indexer.SkipGitignored, relPath+"/")
+				}
 				return filepath.SkipDir
 			}
 			return nil
 		}
 
+		if !within && parentIsRoute {
+			return nil
+		}
+
 		// Check gitignore for files
-		if gi != nil && gi.MatchesPath(relPath) {
+		if !within && gi != nil && gi.MatchesPath(relPath) {
+			skipped.Add(indexer.SkipGitignored, relPath)
 			return nil
 		}
 
-		// Only count code files
-		if isCodeFile(filePath) {
-			filesToEmbed = append(filesToEmbed, filePath)
-			totalSize += info.Size()
+		// Only count code files that are not binary, generated, or too large
+		if reason := skipFilter.CheckFile(filePath, relPath); reason != "" {
+			skipped.Add(reason, relPath)
+			return nil
 		}
+		filesToEmbed = append(filesToEmbed, filePath)
+		totalSize += info.Size()
 
 		return nil
 	})
@@ -419,20 +653,27 @@ func runEmbed(args []string) {
 		os.Exit(1)
 	}
 
+	if *reportSkipped {
+		skipped.WriteText(os.Stderr)
+	}
+
 	// Display preview
 	if len(filesToEmbed) == 0 {
 		logger.Info("no code files to embed")
 		return
 	}
 
-	fmt.Fprintf(os.Stderr, "\n📊 Embedding Preview:\n")
-	fmt.Fprintf(os.Stderr, "   Files to embed: %d\n", len(filesToEmbed))
-	fmt.Fprintf(os.Stderr, "   Total size: %s\n", formatBytes(totalSize))
-	fmt.Fprintf(os.Stderr, "   Provider: %s\n", cfg.Provider)
+	logCfg := logging.LoadConfigFromEnv("codetect-index")
+	logCfg.NoEmoji = logCfg.NoEmoji || *noEmoji
+	previewFields := []logging.Field{
+		{Key: "files", Label: "Files to embed", Value: len(filesToEmbed)},
+		{Key: "total_bytes", Label: "Total size", Value: logging.Bytes(totalSize)},
+		{Key: "provider", Label: "Provider", Value: cfg.Provider},
+	}
 	if cfg.Model != "" {
-		fmt.Fprintf(os.Stderr, "   Model: %s\n", cfg.Model)
+		previewFields = append(previewFields, logging.Field{Key: "model", Label: "Model", Value: cfg.Model})
 	}
-	fmt.Fprintf(os.Stderr, "\n")
+	logging.Block(logCfg, "\U0001F4CA", "Embedding Preview", previewFields...)
 
 	// Second pass: chunk files
 	logger.Info("collecting code chunks")
@@ -468,7 +709,8 @@ func runEmbed(args []string) {
 
 	// Embed chunks with progress
 	start := time.Now()
-	ctx := context.Background()
+	ctx, stop := interruptContext()
+	defer stop()
 
 	// Progress output uses fmt.Fprintf for \r carriage return support
 	progressFn := func(current, total int) {
@@ -477,6 +719,23 @@ func runEmbed(args []string) {
 
 	if err := searcher.IndexChunksParallel(ctx, allChunks, *parallel, progressFn); err != nil {
 		fmt.Fprintln(os.Stderr) // newline after progress
+
+		var interrupted *embedding.InterruptedError
+		if errors.As(err, &interrupted) {
+			logger.Warn("embedding interrupted, completed embeddings were saved",
+				"saved", interrupted.Saved,
+				"remaining", interrupted.Total-interrupted.Saved-interrupted.Skipped,
+				"duration", time.Since(start).Round(time.Millisecond))
+			logger.Info("run 'codetect-index embed' again to resume")
+
+			// Saved embeddings are valid for the current model
+			if err := store.SetRepoConfig(absPath, cfg.Model, dbConfig.VectorDimensions); err != nil {
+				logger.Warn("could not update repo config", "error", err)
+			}
+			idx.Close()
+			os.Exit(130)
+		}
+
 		logger.Error("embedding failed", "error", err)
 		os.Exit(1)
 	}
@@ -500,18 +759,259 @@ func runEmbed(args []string) {
 	}
 }
 
-// formatBytes converts bytes to human-readable format
-func formatBytes(b int64) string {
-	const unit = 1024
-	if b < unit {
-		return fmt.Sprintf("%d B", b)
+// forceIncludeFlag registers --force-include-dir on fs. The returned list
+// starts with CODETECT_FORCE_INCLUDE_DIRS and each flag occurrence adds to it.
+func forceIncludeFlag(fs *flag.FlagSet) *[]string {
+	dirs := config.LoadIndexConfigFromEnv().ForceIncludeDirs
+	fs.Func("force-include-dir", "Index this directory even if ignored (repeatable, comma-separated)", func(v string) error {
+		dirs = append(dirs, config.ParseDirList(v)...)
+		return nil
+	})
+	return &dirs
+}
+
+// includeHiddenFlag registers --include-hidden-dir on fs. The returned list
+// starts with CODETECT_INCLUDE_HIDDEN_DIRS and each flag occurrence adds to
+// it.
+func includeHiddenFlag(fs *flag.FlagSet) *[]string {
+	dirs := config.LoadIndexConfigFromEnv().IncludeHiddenDirs
+	fs.Func("include-hidden-dir", "Index this hidden directory (v2, repeatable, comma-separated)", func(v string) error {
+		dirs = append(dirs, config.ParseDirList(v)...)
+		return nil
+	})
+	return &dirs
+}
+
+// maxEmbeddingsFlag registers --max-embeddings on fs, defaulting to
+// CODETECT_MAX_EMBEDDINGS.
+func maxEmbeddingsFlag(fs *flag.FlagSet) *int {
+	limit := config.LoadIndexConfigFromEnv().MaxEmbeddings
+	return fs.Int("max-embeddings", limit, "Refuse to run if more new embeddings than this are needed (0 = no limit)")
+}
+
+// profileFlag registers --profile on fs.
+func profileFlag(fs *flag.FlagSet) *string {
+	return fs.String("profile", "", "Write CPU and heap profiles of the run to this directory")
+}
+
+// startProfile starts CPU profiling into dir, unless dir is empty, and
+// returns a function that stops it and writes the heap profile. Profiles
+// are only written if the command returns rather than exiting.
+func startProfile(dir string) func() {
+	if dir == "" {
+		return func() {}
+	}
+	stop, err := profiling.Start(dir)
+	if err != nil {
+		logger.Error("starting profiler failed", "error", err)
+		os.Exit(1)
+	}
+	return func() {
+		if err := stop(); err != nil {
+			logger.Error("writing profiles failed", "error", err)
+			return
+		}
+		logger.Info("wrote profiles", "cpu", filepath.Join(dir, profiling.CPUProfile),
+			"heap", filepath.Join(dir, profiling.HeapProfile))
+	}
+}
+
+// logBudgetError reports err if it is an embedding budget refusal and
+// returns whether it was.
+func logBudgetError(absPath string, err error) bool {
+	var budgetErr *embedding.BudgetError
+	if !errors.As(err, &budgetErr) {
+		return false
+	}
+	logger.Error("refusing to embed: run exceeds the embedding budget, nothing was embedded",
+		"path", absPath, "needed", budgetErr.Needed, "max", budgetErr.Max)
+	logger.Info("check .gitignore and --force-include-dir for unintended files, or raise --max-embeddings / CODETECT_MAX_EMBEDDINGS")
+	return true
+}
+
+// runEmbedMissing embeds v2 chunks whose locations exist but whose content
+// hashes are missing from the embedding cache, without a full reindex. Each
+// repo is handled in turn with the already checked embedder.
+func runEmbedMissing(absPaths []string, embConfig embedding.ProviderConfig, embedder embedding.Embedder, parallel, maxEmbeddings int) {
+	dbConfig := config.LoadDatabaseConfigFromEnv()
+	cfg := embedMissingConfig(dbConfig, embConfig, embedder, parallel, maxEmbeddings)
+
+	repos, err := indexer.NewMultiRepo(cfg)
+	if err != nil {
+		logger.Error("opening v2 indexer failed", "error", err)
+		os.Exit(1)
+	}
+	defer repos.Close()
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	failed := 0
+	for _, absPath := range absPaths {
+		if dbConfig.Type != db.DatabasePostgres {
+			if _, err := os.Stat(filepath.Join(absPath, ".codetect", "index.db")); os.IsNotExist(err) {
+				logger.Error("no v2 index found, run 'codetect-index index --v2' first", "path", absPath)
+				failed++
+				continue
+			}
+		}
+
+		result, err := embedMissingRepo(ctx, repos, absPath)
+		if err != nil {
+			if ctx.Err() != nil {
+				logger.Warn("embedding interrupted, batches completed so far were saved", "path", absPath)
+				repos.Close()
+				os.Exit(130)
+			}
+			if !logBudgetError(absPath, err) {
+				logger.Error("embedding missing chunks failed", "path", absPath, "error", err)
+			}
+			failed++
+			continue
+		}
+
+		logger.Info("missing embeddings complete",
+			"path", absPath,
+			"locations", result.Locations,
+			"unique_hashes", result.UniqueHashes,
+			"missing", result.Missing,
+			"files_rechunked", result.Files,
+			"embedded", result.Embedded,
+			"unresolved", result.Unresolved,
+			"duration", result.Duration.Round(time.Millisecond))
+		logEmbedRequests(absPath, result.Requests)
+
+		if result.Unresolved > 0 {
+			logger.Warn("some missing chunks changed on disk, run 'codetect-index index --v2' to refresh",
+				"path", absPath, "unresolved", result.Unresolved)
+		}
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// embedMissingConfig returns the v2 indexer configuration for embedding
+// missing chunks with embedder, in up to parallel concurrent batches.
+// Chunking settings are set per repo by
+// embedMissingRepo, as for indexing, so re-chunked files yield the same
+// cache keys.
+func embedMissingConfig(dbConfig config.DatabaseConfig, embConfig embedding.ProviderConfig, embedder embedding.Embedder, parallel, maxEmbeddings int) *indexer.Config {
+	hnswCfg := config.LoadHNSWConfigFromEnv()
+	cfg := &indexer.Config{
+		DBType:                 string(dbConfig.Type),
+		Dimensions:             dbConfig.VectorDimensions,
+		EmbeddingProvider:      string(embConfig.Provider),
+		EmbeddingModel:         embConfig.Model,
+		Embedder:               embedder,
+		BatchSize:              32,
+		MaxWorkers:             max(parallel, 1),
+		CacheWriteBatchSize:    dbConfig.WriteBatchSize,
+		CacheWriteWorkers:      dbConfig.WriteWorkers,
+		LocationWriteBatchSize: dbConfig.LocationBatchSize,
+		CacheEncoding:          dbConfig.CacheEncoding,
+		DBBusyTimeout:          dbConfig.BusyTimeout,
+		DBReadRetries:          dbConfig.ReadRetries,
+		DBRetryBackoff:         dbConfig.RetryBackoff,
+		DistanceMetric:         hnswCfg.DistanceMetric,
+		HNSW:                   hnswCfg,
+		VectorIndex:            config.LoadVectorIndexTypeFromEnv(),
+		PQ:                     config.LoadPQConfigFromEnv(),
+		ShardByRepo:            config.LoadVectorShardByRepoFromEnv(),
+		MaxEmbeddings:          maxEmbeddings,
+	}
+
+	// Skip the files indexing skips, so re-chunked files yield the same chunks
+	indexCfg := config.LoadIndexConfigFromEnv()
+	cfg.SkipNonSource = indexCfg.SkipNonSource
+	cfg.MaxFileSize = indexCfg.MaxFileSize
+
+	// Set database DSN; SQLite indexes live in each repo's .codetect/index.db
+	if dbConfig.Type == db.DatabasePostgres {
+		cfg.DSN = dbConfig.DSN
+	}
+	return cfg
+}
+
+// embedMissingRepo embeds one repo's missing chunks with an indexer from
+// repos.
+func embedMissingRepo(ctx context.Context, repos *indexer.MultiRepo, absPath string) (*embedding.MissingResult, error) {
+	idx, err := repos.OpenWith(absPath, repoOptions(absPath))
+	if err != nil {
+		return nil, err
+	}
+	defer idx.Close()
+
+	result, err := idx.EmbedMissing(ctx)
+	closePipeline(absPath, idx.Pipeline())
+	return result, err
+}
+
+// pipelineCloseTimeout bounds how long the CLI waits for an embedding
+// pipeline's background writes before exiting.
+const pipelineCloseTimeout = 10 * time.Second
+
+// closePipeline waits for pipeline's background writes to be committed. It
+// uses its own deadline, so writes still drain after an interrupt.
+func closePipeline(absPath string, pipeline *embedding.Pipeline) {
+	ctx, cancel := context.WithTimeout(context.Background(), pipelineCloseTimeout)
+	defer cancel()
+
+	if err := pipeline.Close(ctx); err != nil {
+		logger.Warn("pending cache writes did not finish", "path", absPath, "error", err)
+	}
+}
+
+// repoPathArgs returns the absolute repo roots named by the remaining
+// arguments of fs, defaulting to the current directory. Repeated paths are
+// dropped.
+func repoPathArgs(fs *flag.FlagSet) []string {
+	args := fs.Args()
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+
+	seen := make(map[string]bool)
+	var absPaths []string
+	for _, path := range args {
+		absPath, err := config.NormalizeRepoRoot(path)
+		if err != nil {
+			logger.Error("invalid path", "path", path, "error", err)
+			os.Exit(1)
+		}
+		if !seen[absPath] {
+			seen[absPath] = true
+			absPaths = append(absPaths, absPath)
+		}
 	}
-	div, exp := int64(unit), 0
-	for n := b / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
+	return absPaths
+}
+
+// interruptContext returns a context that is cancelled by the first SIGINT
+// or SIGTERM, so long-running work can stop cleanly and save what it has
+// finished. Default signal handling is then restored, so a second Ctrl-C
+// terminates immediately.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-sigCh:
+			signal.Stop(sigCh)
+			fmt.Fprintln(os.Stderr) // end the progress line
+			logger.Warn("interrupt received, finishing in-flight requests (press Ctrl-C again to abort)")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(sigCh)
+		cancel()
 	}
-	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
 }
 
 // isCodeFile returns true for files that should be embedded
@@ -597,61 +1097,508 @@ func isComment(line string) bool {
 	return false
 }
 
-func runStats(args []string) {
-	fs := flag.NewFlagSet("stats", flag.ExitOnError)
-	useV2 := fs.Bool("v2", false, "Show v2 index stats")
-	jsonOutput := fs.Bool("json", false, "Output stats as JSON")
+// runChunks prints how the v2 AST chunker splits a file, using the same
+// chunking settings as the indexer. No index is needed.
+func runChunks(args []string) {
+	fs := flag.NewFlagSet("chunks", flag.ExitOnError)
+	showContent := fs.Bool("content", false, "Print each chunk's content")
+	jsonOutput := fs.Bool("json", false, "Output chunks as JSON")
 	fs.Parse(args)
 
-	path := "."
-	if fs.NArg() > 0 {
-		path = fs.Arg(0)
+	if fs.NArg() != 1 {
+		logger.Error("usage: codetect-index chunks [--content] [--json] <file>")
+		os.Exit(1)
 	}
+	path := fs.Arg(0)
 
-	absPath, err := filepath.Abs(path)
+	content, err := os.ReadFile(path)
 	if err != nil {
-		logger.Error("invalid path", "error", err)
+		logger.Error("reading file failed", "error", err)
 		os.Exit(1)
 	}
 
-	if *useV2 {
-		runStatsV2(absPath, *jsonOutput)
-		return
-	}
-
-	// V1 stats path
-
-	// Load database configuration from environment
-	dbConfig := config.LoadDatabaseConfigFromEnv()
-
-	// For SQLite, verify index exists and set path relative to target
-	if dbConfig.Type == db.DatabaseSQLite {
-		dbPath := filepath.Join(absPath, ".codetect", "symbols.db")
-		if _, err := os.Stat(dbPath); os.IsNotExist(err) {
-			logger.Error("no index found, run 'index' first")
-			os.Exit(1)
-		}
-		dbConfig.Path = dbPath
-	}
-
-	// Convert to db.Config
-	dbCfg := dbConfig.ToDBConfig()
-
-	// Open index using config-aware constructor with repoRoot for multi-repo isolation
-	idx, err := symbols.NewIndexWithConfig(dbCfg, absPath)
+	chunkCfg, err := config.LoadChunkingConfig("")
 	if err != nil {
-		logger.Error("opening index failed", "error", err)
+		logger.Error("loading chunking config failed", "error", err)
 		os.Exit(1)
 	}
-	defer idx.Close()
+	astChunker := chunker.NewASTChunker()
+	astChunker.StripComments = chunkCfg.StripComments
+	astChunker.SubChunkLines = chunkCfg.SubChunkLines
+	astChunker.NeighborContext = chunkCfg.NeighborContext
+	astChunker.MaxChunkSize = chunkCfg.MaxChunkSize
+	astChunker.SkipGaps = chunkCfg.SkipGaps
+	astChunker.SplitNodes = chunkCfg.SplitNodes
+	astChunker.IncludeLeadingComments = chunkCfg.LeadingComments
+	astChunker.LeadingCommentGap = chunkCfg.LeadingCommentGap
+	astChunker.SplitOversized = chunkCfg.SplitOversized
+	astChunker.MaxTokens = chunkCfg.MaxChunkTokens
+	astChunker.SplitNestedFunctions = chunkCfg.SplitNestedFunctions
+	for _, m := range chunkCfg.LanguageMap {
+		if chunker.GetLanguageConfigByName(m.Language) == nil {
+			logger.Warn("ignoring language mapping for unsupported language",
+				"pattern", m.Pattern, "language", m.Language)
+			continue
+		}
+		astChunker.LanguageOverrides = append(astChunker.LanguageOverrides,
+			chunker.LanguageOverride{Pattern: m.Pattern, Language: m.Language})
+	}
 
-	symbolCount, fileCount, err := idx.Stats()
+	chunks, err := astChunker.ChunkFile(context.Background(), filepath.ToSlash(path), content)
 	if err != nil {
-		logger.Error("getting stats failed", "error", err)
+		logger.Error("chunking failed", "error", err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("Database: %s\n", dbConfig.String())
+	if *jsonOutput {
+		if !*showContent {
+			for i := range chunks {
+				chunks[i].Content = ""
+				chunks[i].EmbedContent = ""
+			}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(chunks); err != nil {
+			logger.Error("encoding JSON failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	language := "none (line-based fallback)"
+	if lang := chunker.ResolveLanguageConfig(path, astChunker.LanguageOverrides); lang != nil {
+		language = lang.Name
+	}
+	fmt.Printf("%s: %d chunks, language %s\n", path, len(chunks), language)
+	if err := chunker.WriteChunks(os.Stdout, chunks, *showContent); err != nil {
+		logger.Error("writing chunks failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// runImportEmbeddings stores embeddings computed by an external pipeline in
+// a repo's v2 cache, so they are searchable without an embedding provider.
+func runImportEmbeddings(args []string) {
+	fs := flag.NewFlagSet("import-embeddings", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "Output results as JSON")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		logger.Error("usage: codetect-index import-embeddings [--json] <file.jsonl|-> [path]")
+		os.Exit(1)
+	}
+	path := "."
+	if fs.NArg() == 2 {
+		path = fs.Arg(1)
+	}
+	absPath, err := config.NormalizeRepoRoot(path)
+	if err != nil {
+		logger.Error("invalid path", "error", err)
+		os.Exit(1)
+	}
+
+	var input io.Reader = os.Stdin
+	if name := fs.Arg(0); name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			logger.Error("opening embeddings file failed", "error", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		input = f
+	}
+
+	dbConfig := config.LoadDatabaseConfigFromEnv()
+	embConfig := embedding.LoadConfigFromEnv()
+
+	cfg := &indexer.Config{
+		DBType:                 string(dbConfig.Type),
+		Dimensions:             dbConfig.VectorDimensions,
+		EmbeddingProvider:      "off", // Vectors come from the file
+		EmbeddingModel:         embConfig.Model,
+		CacheWriteBatchSize:    dbConfig.WriteBatchSize,
+		CacheWriteWorkers:      dbConfig.WriteWorkers,
+		LocationWriteBatchSize: dbConfig.LocationBatchSize,
+		CacheEncoding:          dbConfig.CacheEncoding,
+		DBBusyTimeout:          dbConfig.BusyTimeout,
+		DBReadRetries:          dbConfig.ReadRetries,
+		DBRetryBackoff:         dbConfig.RetryBackoff,
+	}
+	if dbConfig.Type == db.DatabasePostgres {
+		cfg.DSN = dbConfig.DSN
+	} else {
+		cfg.DBPath = filepath.Join(absPath, ".codetect", "index.db")
+		if _, err := os.Stat(cfg.DBPath); os.IsNotExist(err) {
+			logger.Error("no v2 index found, run 'codetect-index index --v2' first", "path", absPath)
+			os.Exit(1)
+		}
+	}
+
+	idx, err := indexer.New(absPath, cfg)
+	if err != nil {
+		logger.Error("opening v2 indexer failed", "error", err)
+		os.Exit(1)
+	}
+	defer idx.Close()
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	result, err := idx.ImportEmbeddings(ctx, input)
+	if err != nil {
+		imported := 0
+		if result != nil {
+			imported = result.Imported
+		}
+		logger.Error("importing embeddings failed", "imported", imported, "error", err)
+		idx.Close()
+		os.Exit(1)
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			logger.Error("encoding JSON failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	logger.Info("import complete",
+		"path", absPath,
+		"records", result.Records,
+		"imported", result.Imported,
+		"unreferenced", result.Unreferenced,
+		"duration", result.Duration.Round(time.Millisecond))
+	if result.Unreferenced > 0 {
+		logger.Warn("some imported hashes match no indexed chunk; check they are cache keys from this index",
+			"path", absPath, "unreferenced", result.Unreferenced)
+	}
+}
+
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "Output the bundle manifest as JSON")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		logger.Error("usage: codetect-index export [--json] <bundle> [path]")
+		os.Exit(1)
+	}
+	path := "."
+	if fs.NArg() == 2 {
+		path = fs.Arg(1)
+	}
+	absPath, err := config.NormalizeRepoRoot(path)
+	if err != nil {
+		logger.Error("invalid path", "error", err)
+		os.Exit(1)
+	}
+
+	dbConfig := config.LoadDatabaseConfigFromEnv()
+	if dbConfig.Type != db.DatabaseSQLite {
+		logger.Error("export supports SQLite indexes only", "db_type", dbConfig.Type)
+		os.Exit(1)
+	}
+	embConfig := embedding.LoadConfigFromEnv()
+
+	cfg := &indexer.Config{
+		DBType:            string(dbConfig.Type),
+		DBPath:            filepath.Join(absPath, ".codetect", "index.db"),
+		Dimensions:        dbConfig.VectorDimensions,
+		EmbeddingProvider: "off", // Nothing is embedded
+		EmbeddingModel:    embConfig.Model,
+		DBBusyTimeout:     dbConfig.BusyTimeout,
+		DBReadRetries:     dbConfig.ReadRetries,
+		DBRetryBackoff:    dbConfig.RetryBackoff,
+	}
+	if _, err := os.Stat(cfg.DBPath); os.IsNotExist(err) {
+		logger.Error("no v2 index found, run 'codetect-index index --v2' first", "path", absPath)
+		os.Exit(1)
+	}
+
+	idx, err := indexer.New(absPath, cfg)
+	if err != nil {
+		logger.Error("opening v2 indexer failed", "error", err)
+		os.Exit(1)
+	}
+	defer idx.Close()
+
+	// Write next to the bundle and rename, so a failed export leaves no
+	// truncated bundle behind
+	bundlePath := fs.Arg(0)
+	tmp, err := os.CreateTemp(filepath.Dir(bundlePath), ".codetect-export-*")
+	if err != nil {
+		logger.Error("creating bundle failed", "error", err)
+		os.Exit(1)
+	}
+	defer os.Remove(tmp.Name())
+
+	manifest, err := idx.Export(tmp, "codetect-index "+version)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), bundlePath)
+	}
+	if err != nil {
+		logger.Error("exporting index failed", "error", err)
+		os.Remove(tmp.Name())
+		idx.Close()
+		os.Exit(1)
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(manifest); err != nil {
+			logger.Error("encoding JSON failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	logger.Info("export complete",
+		"path", absPath,
+		"bundle", bundlePath,
+		"locations", manifest.Locations,
+		"model", manifest.EmbeddingModel)
+}
+
+func runImportBundle(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	force := fs.Bool("force", false, "Replace an existing index")
+	fs.BoolVar(force, "f", false, "Short for --force")
+	jsonOutput := fs.Bool("json", false, "Output the bundle manifest as JSON")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		logger.Error("usage: codetect-index import [--force] [--json] <bundle> [path]")
+		os.Exit(1)
+	}
+	path := "."
+	if fs.NArg() == 2 {
+		path = fs.Arg(1)
+	}
+	absPath, err := config.NormalizeRepoRoot(path)
+	if err != nil {
+		logger.Error("invalid path", "error", err)
+		os.Exit(1)
+	}
+
+	dbConfig := config.LoadDatabaseConfigFromEnv()
+	if dbConfig.Type != db.DatabaseSQLite {
+		logger.Error("import supports SQLite indexes only", "db_type", dbConfig.Type)
+		os.Exit(1)
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		logger.Error("opening bundle failed", "error", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	manifest, err := indexer.ImportBundle(f, absPath, indexer.ImportBundleOptions{
+		Force:      *force,
+		Dimensions: dbConfig.VectorDimensions,
+	})
+	if err != nil {
+		logger.Error("importing bundle failed", "error", err)
+		f.Close()
+		os.Exit(1)
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(manifest); err != nil {
+			logger.Error("encoding JSON failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	logger.Info("import complete",
+		"path", absPath,
+		"exported_from", manifest.RepoRoot,
+		"created_by", manifest.CreatedBy,
+		"locations", manifest.Locations,
+		"model", manifest.EmbeddingModel)
+	if model := embedding.LoadConfigFromEnv().Model; model != "" && manifest.EmbeddingModel != "" && model != manifest.EmbeddingModel {
+		logger.Warn("bundle was embedded with another model; search queries need the same model",
+			"bundle_model", manifest.EmbeddingModel, "configured_model", model)
+	}
+}
+
+func runDiff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "Output the diff as JSON")
+	repoA := fs.String("repo-a", "", "Repository root to read from the first database")
+	repoB := fs.String("repo-b", "", "Repository root to read from the second database")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		logger.Error("usage: codetect-index diff [--json] [--repo-a ROOT] [--repo-b ROOT] <a> <b>")
+		os.Exit(1)
+	}
+
+	storeA, rootA, closeA, err := openDiffSide(fs.Arg(0), *repoA)
+	if err != nil {
+		logger.Error("opening first index failed", "index", fs.Arg(0), "error", err)
+		os.Exit(1)
+	}
+	defer closeA()
+	storeB, rootB, closeB, err := openDiffSide(fs.Arg(1), *repoB)
+	if err != nil {
+		logger.Error("opening second index failed", "index", fs.Arg(1), "error", err)
+		closeA()
+		os.Exit(1)
+	}
+	defer closeB()
+
+	diff, err := embedding.DiffIndexes(storeA, rootA, storeB, rootB)
+	if err != nil {
+		logger.Error("comparing indexes failed", "error", err)
+		closeA()
+		closeB()
+		os.Exit(1)
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(diff)
+	} else {
+		err = diff.WriteText(os.Stdout)
+	}
+	if err != nil {
+		logger.Error("writing diff failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// openDiffSide opens the location store of one side of a diff. arg is a
+// repository directory, whose index is found as for 'stats --v2', or a
+// SQLite index file. A file holding several repositories needs repoRoot to
+// pick one.
+func openDiffSide(arg, repoRoot string) (*embedding.LocationStore, string, func(), error) {
+	info, err := os.Stat(arg)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	dbConfig := config.LoadDatabaseConfigFromEnv()
+	if info.IsDir() {
+		if repoRoot != "" {
+			return nil, "", nil, errors.New("--repo-a and --repo-b apply to index files, not directories")
+		}
+		if repoRoot, err = config.NormalizeRepoRoot(arg); err != nil {
+			return nil, "", nil, err
+		}
+		if dbConfig.Type == db.DatabaseSQLite {
+			dbConfig.Path = filepath.Join(repoRoot, ".codetect", "index.db")
+			if _, err := os.Stat(dbConfig.Path); err != nil {
+				return nil, "", nil, fmt.Errorf("no v2 index found in %s, run 'codetect-index index --v2' first", repoRoot)
+			}
+		}
+	} else {
+		dbConfig.Type = db.DatabaseSQLite
+		dbConfig.Path = arg
+	}
+
+	dbCfg := dbConfig.ToDBConfig()
+	database, err := db.Open(dbCfg)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	closeDB := func() { database.Close() }
+
+	store, err := embedding.NewLocationStore(database, dbCfg.Dialect())
+	if err != nil {
+		closeDB()
+		return nil, "", nil, err
+	}
+	if repoRoot == "" {
+		repos, err := store.Repos()
+		if err != nil {
+			closeDB()
+			return nil, "", nil, err
+		}
+		switch len(repos) {
+		case 0:
+			closeDB()
+			return nil, "", nil, errors.New("index is empty")
+		case 1:
+			repoRoot = repos[0]
+		default:
+			closeDB()
+			return nil, "", nil, fmt.Errorf("index holds %d repositories (%s); pick one with --repo-a or --repo-b",
+				len(repos), strings.Join(repos, ", "))
+		}
+	}
+	return store, repoRoot, closeDB, nil
+}
+
+func runStats(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	useV2 := fs.Bool("v2", false, "Show v2 index stats")
+	jsonOutput := fs.Bool("json", false, "Output stats as JSON")
+	fs.Parse(args)
+
+	path := "."
+	if fs.NArg() > 0 {
+		path = fs.Arg(0)
+	}
+
+	absPath, err := config.NormalizeRepoRoot(path)
+	if err != nil {
+		logger.Error("invalid path", "error", err)
+		os.Exit(1)
+	}
+
+	if *useV2 {
+		runStatsV2(absPath, *jsonOutput)
+		return
+	}
+
+	// V1 stats path
+
+	// Load database configuration from environment
+	dbConfig := config.LoadDatabaseConfigFromEnv()
+
+	// For SQLite, verify index exists and set path relative to target
+	if dbConfig.Type == db.DatabaseSQLite {
+		dbPath := filepath.Join(absPath, ".codetect", "symbols.db")
+		if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+			logger.Error("no index found, run 'index' first")
+			os.Exit(1)
+		}
+		dbConfig.Path = dbPath
+	}
+
+	// Convert to db.Config
+	dbCfg := dbConfig.ToDBConfig()
+
+	// Open index using config-aware constructor with repoRoot for multi-repo isolation
+	idx, err := symbols.NewIndexWithConfig(dbCfg, absPath)
+	if err != nil {
+		logger.Error("opening index failed", "error", err)
+		os.Exit(1)
+	}
+	defer idx.Close()
+
+	symbolCount, fileCount, err := idx.Stats()
+	if err != nil {
+		logger.Error("getting stats failed", "error", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Database: %s\n", dbConfig.String())
 	fmt.Printf("Symbols: %d\n", symbolCount)
 	fmt.Printf("Files: %d\n", fileCount)
 
@@ -670,29 +1617,9 @@ func runStats(args []string) {
 	}
 }
 
-// runStatsV2 shows statistics from the v2 indexer.
-func runStatsV2(absPath string, jsonOutput bool) {
-	// Load configuration from environment
-	dbConfig := config.LoadDatabaseConfigFromEnv()
-	embConfig := embedding.LoadConfigFromEnv()
-
-	// Build indexer config
-	cfg := &indexer.Config{
-		DBType:            string(dbConfig.Type),
-		Dimensions:        dbConfig.VectorDimensions,
-		EmbeddingProvider: "off", // Don't need embedder for stats
-		EmbeddingModel:    embConfig.Model,
-	}
-
-	// Set database path/DSN
-	if dbConfig.Type == db.DatabasePostgres {
-		cfg.DSN = dbConfig.DSN
-	} else {
-		cfg.DBPath = filepath.Join(absPath, ".codetect", "index.db")
-	}
-
-	// Create indexer
-	idx, err := indexer.New(absPath, cfg)
+// runStatsV2 shows statistics from the v2 indexer.
+func runStatsV2(absPath string, jsonOutput bool) {
+	idx, err := openReadOnlyV2(absPath)
 	if err != nil {
 		logger.Error("opening v2 indexer failed", "error", err)
 		os.Exit(1)
@@ -724,11 +1651,15 @@ func runStatsV2(absPath string, jsonOutput bool) {
 	fmt.Printf("Unique Hashes:     %d\n", stats.UniqueHashes)
 	fmt.Printf("Files:             %d\n", stats.FileCount)
 	fmt.Printf("Cached Embeddings: %d\n", stats.CachedEmbeddings)
+	fmt.Printf("Embedded:          %d/%d (%.1f%%)\n", stats.EmbeddedHashes, stats.UniqueHashes, stats.EmbeddedPercent)
+	fmt.Printf("Vector Search:     %s\n", stats.VectorSearchMode)
 
 	if stats.IndexedVectors > 0 {
 		indexType := "brute-force"
 		if stats.VectorIndexNative {
 			indexType = "native HNSW"
+		} else if stats.VectorSearchMode == embedding.VectorModePQ {
+			indexType = "PQ-compressed"
 		}
 		fmt.Printf("Indexed Vectors:   %d (%s)\n", stats.IndexedVectors, indexType)
 	}
@@ -748,31 +1679,629 @@ func runStatsV2(absPath string, jsonOutput bool) {
 	}
 }
 
+// openReadOnlyV2 opens the v2 index of absPath, configured from the
+// environment, for commands that only read it.
+func openReadOnlyV2(absPath string) (*indexer.Indexer, error) {
+	// Load configuration from environment
+	dbConfig := config.LoadDatabaseConfigFromEnv()
+	embConfig := embedding.LoadConfigFromEnv()
+	indexCfg := config.LoadIndexConfigFromEnv()
+
+	// Build indexer config
+	cfg := &indexer.Config{
+		DBType:            string(dbConfig.Type),
+		Dimensions:        dbConfig.VectorDimensions,
+		EmbeddingProvider: "off", // No embedder needed to read the index
+		EmbeddingModel:    embConfig.Model,
+		MerkleStore:       indexCfg.MerkleStore,
+		MerkleBackups:     indexCfg.MerkleBackups,
+		HNSW:              config.LoadHNSWConfigFromEnv(),
+		VectorIndex:       config.LoadVectorIndexTypeFromEnv(),
+		PQ:                config.LoadPQConfigFromEnv(),
+		ShardByRepo:       config.LoadVectorShardByRepoFromEnv(),
+	}
+
+	// Set database path/DSN
+	if dbConfig.Type == db.DatabasePostgres {
+		cfg.DSN = dbConfig.DSN
+	} else {
+		cfg.DBPath = filepath.Join(absPath, ".codetect", "index.db")
+	}
+
+	return indexer.New(absPath, cfg)
+}
+
+// runDuplicates prints the chunks of a v2 index duplicated at the most
+// locations.
+func runDuplicates(args []string) {
+	fs := flag.NewFlagSet("duplicates", flag.ExitOnError)
+	top := fs.Int("top", 10, "Number of duplicated chunks to show")
+	jsonOutput := fs.Bool("json", false, "Output duplicated chunks as JSON")
+	fs.Parse(args)
+
+	path := "."
+	if fs.NArg() > 0 {
+		path = fs.Arg(0)
+	}
+
+	absPath, err := config.NormalizeRepoRoot(path)
+	if err != nil {
+		logger.Error("invalid path", "error", err)
+		os.Exit(1)
+	}
+
+	idx, err := openReadOnlyV2(absPath)
+	if err != nil {
+		logger.Error("opening v2 indexer failed", "error", err)
+		os.Exit(1)
+	}
+	defer idx.Close()
+
+	dups, err := idx.Locations().TopDuplicated(absPath, *top)
+	if err != nil {
+		logger.Error("finding duplicated chunks failed", "error", err)
+		idx.Close()
+		os.Exit(1)
+	}
+
+	if *jsonOutput {
+		if dups == nil {
+			dups = []embedding.DuplicatedChunk{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(dups); err != nil {
+			logger.Error("encoding JSON failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(dups) == 0 {
+		fmt.Println("No duplicated chunks")
+		return
+	}
+	for i, dup := range dups {
+		fmt.Printf("%d. %s  %d locations\n", i+1, dup.ContentHash[:12], dup.Count)
+		for _, loc := range dup.Examples {
+			name := ""
+			if loc.NodeName != "" {
+				name = "  " + loc.NodeName
+			}
+			fmt.Printf("   %s:%d-%d%s\n", loc.Path, loc.StartLine, loc.EndLine, name)
+		}
+		if more := dup.Count - len(dup.Examples); more > 0 {
+			fmt.Printf("   ... and %d more\n", more)
+		}
+	}
+}
+
+// verifyExamples is how many dangling locations verify lists.
+const verifyExamples = 10
+
+// runVerify cross-checks a v2 index's locations against its embedding
+// cache and, with --repair, fixes what it finds. It exits 1 if the index
+// is left inconsistent.
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	repair := fs.Bool("repair", false, "Re-embed dangling locations and delete orphaned embeddings")
+	jsonOutput := fs.Bool("json", false, "Output the report as JSON")
+	fs.Parse(args)
+
+	path := "."
+	if fs.NArg() > 0 {
+		path = fs.Arg(0)
+	}
+
+	absPath, err := config.NormalizeRepoRoot(path)
+	if err != nil {
+		logger.Error("invalid path", "error", err)
+		os.Exit(1)
+	}
+
+	dbConfig := config.LoadDatabaseConfigFromEnv()
+	dbPath := filepath.Join(absPath, ".codetect", "index.db")
+	if dbConfig.Type != db.DatabasePostgres {
+		if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+			logger.Error("no v2 index found, run 'codetect-index index --v2' first", "path", absPath)
+			os.Exit(1)
+		}
+	}
+
+	var idx *indexer.Indexer
+	if *repair {
+		embConfig := embedding.LoadConfigFromEnv()
+		embedder, err := embedding.NewEmbedder(embConfig)
+		if err != nil {
+			logger.Error("creating embedder failed", "error", err)
+			os.Exit(1)
+		}
+		cfg := embedMissingConfig(dbConfig, embConfig, embedder, 4, 0)
+		if dbConfig.Type != db.DatabasePostgres {
+			cfg.DBPath = dbPath
+		}
+		if err = repoOptions(absPath)(cfg); err == nil {
+			idx, err = indexer.New(absPath, cfg)
+		}
+	} else {
+		idx, err = openReadOnlyV2(absPath)
+	}
+	if err != nil {
+		logger.Error("opening v2 indexer failed", "error", err)
+		os.Exit(1)
+	}
+	defer idx.Close()
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	result, err := idx.Verify(ctx, *repair)
+	if *repair {
+		closePipeline(absPath, idx.Pipeline())
+	}
+	if err != nil {
+		logger.Error("verifying index failed", "path", absPath, "error", err)
+		idx.Close()
+		os.Exit(1)
+	}
+	consistent := result.Consistent() || (*repair && result.Unresolved == 0)
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			logger.Error("encoding JSON failed", "error", err)
+			os.Exit(1)
+		}
+	} else {
+		fmt.Printf("Locations: %d\n", result.Locations)
+		fmt.Printf("Embeddings checked: %d\n", result.Embeddings)
+		fmt.Printf("Dangling locations: %d (%d hashes without an embedding)\n",
+			len(result.DanglingLocations), result.DanglingHashes)
+		for i, loc := range result.DanglingLocations {
+			if i == verifyExamples {
+				fmt.Printf("   ... and %d more\n", len(result.DanglingLocations)-i)
+				break
+			}
+			fmt.Printf("   %s:%d-%d\n", loc.Path, loc.StartLine, loc.EndLine)
+		}
+		fmt.Printf("Orphaned embeddings: %d\n", len(result.Orphaned))
+		if *repair {
+			fmt.Printf("Re-embedded: %d\n", result.Reembedded)
+			fmt.Printf("Orphans deleted: %d\n", result.OrphansDeleted)
+			if result.Unresolved > 0 {
+				fmt.Printf("Unresolved: %d (files changed since indexing, run 'codetect-index index --v2')\n", result.Unresolved)
+			}
+		} else if !consistent {
+			fmt.Println("Run with --repair to fix")
+		}
+	}
+
+	if !consistent {
+		idx.Close()
+		os.Exit(1)
+	}
+}
+
+// runHistory prints the cache hit rate of recent v2 indexing runs.
+func runHistory(args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	limit := fs.Int("limit", 20, "Number of most recent runs to show (0 = all kept)")
+	jsonOutput := fs.Bool("json", false, "Output the runs as JSON")
+	fs.Parse(args)
+
+	path := "."
+	if fs.NArg() > 0 {
+		path = fs.Arg(0)
+	}
+
+	absPath, err := config.NormalizeRepoRoot(path)
+	if err != nil {
+		logger.Error("invalid path", "error", err)
+		os.Exit(1)
+	}
+
+	idx, err := openReadOnlyV2(absPath)
+	if err != nil {
+		logger.Error("opening v2 indexer failed", "error", err)
+		os.Exit(1)
+	}
+	defer idx.Close()
+
+	runs, err := idx.History(*limit)
+	if err != nil {
+		logger.Error("reading index history failed", "error", err)
+		idx.Close()
+		os.Exit(1)
+	}
+
+	if *jsonOutput {
+		type historyRun struct {
+			embedding.IndexRun
+			HitRate float64 `json:"hit_rate"`
+		}
+		out := make([]historyRun, 0, len(runs))
+		for _, run := range runs {
+			out = append(out, historyRun{IndexRun: run, HitRate: run.HitRate()})
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			logger.Error("encoding JSON failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	writeHistory(os.Stdout, runs)
+}
+
+// writeHistory prints runs as a table, oldest first, followed by the hit
+// rate over all of them.
+func writeHistory(w io.Writer, runs []embedding.IndexRun) {
+	if len(runs) == 0 {
+		fmt.Fprintln(w, "No indexing runs recorded")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STARTED\tTYPE\tFILES\tCHUNKS\tCACHE HITS\tEMBEDDED\tHIT RATE")
+	var hits, embedded int
+	for _, run := range runs {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\t%.1f%%\n",
+			run.StartedAt.Format("2006-01-02 15:04:05"), run.ChangeType, run.Files,
+			run.Total, run.CacheHits, run.Embedded, run.HitRate())
+		hits += run.CacheHits
+		embedded += run.Embedded
+	}
+	tw.Flush()
+
+	overall := embedding.IndexRun{CacheHits: hits, Embedded: embedded}
+	fmt.Fprintf(w, "\n%d runs: %d cache hits, %d embedded, %.1f%% hit rate\n",
+		len(runs), hits, embedded, overall.HitRate())
+}
+
+// runMerkle lists the backups of a v2 index's merkle tree, or restores the
+// newest to recover from a corrupt tree or a bad index run.
+func runMerkle(args []string) {
+	if len(args) == 0 || (args[0] != "backups" && args[0] != "restore") {
+		logger.Error("usage: codetect-index merkle backups|restore [--json] [path]")
+		os.Exit(1)
+	}
+	subcommand := args[0]
+	fs := flag.NewFlagSet("merkle "+subcommand, flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "Output tree metadata as JSON")
+	fs.Parse(args[1:])
+
+	path := "."
+	if fs.NArg() > 0 {
+		path = fs.Arg(0)
+	}
+
+	absPath, err := config.NormalizeRepoRoot(path)
+	if err != nil {
+		logger.Error("invalid path", "error", err)
+		os.Exit(1)
+	}
+
+	idx, err := openReadOnlyV2(absPath)
+	if err != nil {
+		logger.Error("opening v2 indexer failed", "error", err)
+		os.Exit(1)
+	}
+	defer idx.Close()
+
+	var out any
+	if subcommand == "backups" {
+		backups, err := idx.MerkleBackups()
+		if err != nil {
+			logger.Error("reading merkle tree backups failed", "error", err)
+			idx.Close()
+			os.Exit(1)
+		}
+		if !*jsonOutput {
+			writeMerkleBackups(os.Stdout, backups)
+			return
+		}
+		out = backups
+	} else {
+		restored, err := idx.RestoreMerkleBackup()
+		if errors.Is(err, merkle.ErrNoBackup) {
+			logger.Error("no merkle tree backup to restore; backups are kept by 'index --v2' runs", "path", absPath)
+			idx.Close()
+			os.Exit(1)
+		}
+		if err != nil {
+			logger.Error("restoring merkle tree failed", "error", err)
+			idx.Close()
+			os.Exit(1)
+		}
+		if !*jsonOutput {
+			logger.Info("merkle tree restored; the next 'index --v2' run reindexes files changed since it was built",
+				"path", absPath,
+				"built", treeTime(*restored).Format("2006-01-02 15:04:05"),
+				"files", restored.FileCount)
+			return
+		}
+		out = restored
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		logger.Error("encoding JSON failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// writeMerkleBackups prints backups as a table, newest first.
+func writeMerkleBackups(w io.Writer, backups []merkle.Metadata) {
+	if len(backups) == 0 {
+		fmt.Fprintln(w, "No merkle tree backups")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "BACKUP\tBUILT\tFILES\tROOT HASH\tHASH")
+	for _, md := range backups {
+		rootHash := md.RootHash
+		if len(rootHash) > 12 {
+			rootHash = rootHash[:12]
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\n",
+			md.Backup, treeTime(md).Format("2006-01-02 15:04:05"), md.FileCount, rootHash, md.HashAlgo)
+	}
+	tw.Flush()
+}
+
+// treeTime is when a stored tree was built, or for trees that did not
+// record it, when its file was written.
+func treeTime(md merkle.Metadata) time.Time {
+	if md.BuildTime.IsZero() {
+		return md.ModTime
+	}
+	return md.BuildTime
+}
+
+// runQueries prints the most frequent queries in the v2 query log with
+// how well they were answered.
+func runQueries(args []string) {
+	fs := flag.NewFlagSet("queries", flag.ExitOnError)
+	limit := fs.Int("limit", 20, "Number of most frequent queries to show (0 = all kept)")
+	jsonOutput := fs.Bool("json", false, "Output the query summaries as JSON")
+	fs.Parse(args)
+
+	path := "."
+	if fs.NArg() > 0 {
+		path = fs.Arg(0)
+	}
+
+	absPath, err := config.NormalizeRepoRoot(path)
+	if err != nil {
+		logger.Error("invalid path", "error", err)
+		os.Exit(1)
+	}
+
+	idx, err := openReadOnlyV2(absPath)
+	if err != nil {
+		logger.Error("opening v2 indexer failed", "error", err)
+		os.Exit(1)
+	}
+	defer idx.Close()
+
+	summaries, err := idx.Queries(*limit)
+	if err != nil {
+		logger.Error("reading query log failed", "error", err)
+		idx.Close()
+		os.Exit(1)
+	}
+
+	if *jsonOutput {
+		if summaries == nil {
+			summaries = []embedding.QuerySummary{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(summaries); err != nil {
+			logger.Error("encoding JSON failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	writeQueries(os.Stdout, summaries)
+}
+
+// writeQueries prints query summaries as a table, most frequent first.
+// Hashed queries are shortened to the start of their hash.
+func writeQueries(w io.Writer, summaries []embedding.QuerySummary) {
+	if len(summaries) == 0 {
+		fmt.Fprintln(w, "No queries logged (set CODETECT_QUERY_LOG=hashed or raw to log them)")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "COUNT	EMPTY	AVG RESULTS	AVG TOP SCORE	LAST	TOOL	QUERY")
+	for _, s := range summaries {
+		query := s.Query
+		if s.Hashed && len(query) > len("sha256:")+12 {
+			query = query[:len("sha256:")+12]
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%.1f\t%.4f\t%s\t%s\t%s\n",
+			s.Count, s.Empty, s.AvgResults, s.AvgTopScore,
+			s.LastAt.Format("2006-01-02 15:04:05"), s.Tool, query)
+	}
+	tw.Flush()
+}
+
 func printUsage() {
 	fmt.Println(`codetect-index - Codebase indexer for codetect MCP
 
 Usage:
   codetect-index index [options] [path]   Index symbols using ctags
+                                          (--v2 accepts several paths)
   codetect-index embed [options] [path]   Generate embeddings
+                                          (--missing-only accepts several paths)
   codetect-index stats [options] [path]   Show index statistics
+  codetect-index chunks [options] <file>  Show how the v2 chunker splits a file
+  codetect-index import-embeddings [options] <file> [path]
+                                          Store precomputed v2 embeddings
+  codetect-index export [options] <bundle> [path]
+                                          Write the v2 index to a bundle
+  codetect-index import [options] <bundle> [path]
+                                          Restore a v2 index from a bundle
+  codetect-index diff [options] <a> <b>   Compare two v2 indexes
+  codetect-index duplicates [options] [path]
+                                          List the most duplicated v2 chunks
+  codetect-index verify [options] [path]  Check v2 locations against the
+                                          embedding cache
+  codetect-index history [options] [path] Show the cache hit rate of recent
+                                          v2 indexing runs
+  codetect-index queries [options] [path] Summarize the most frequent logged
+                                          v2 search queries
+  codetect-index merkle backups [options] [path]
+                                          List the backups of the v2 Merkle tree
+  codetect-index merkle restore [options] [path]
+                                          Replace the v2 Merkle tree with its
+                                          newest backup
   codetect-index version                  Print version
   codetect-index help                     Show this help
 
 Index Options:
-  --force, -f    Force full reindex (default: incremental)
+  --force, -f    Force full reindex (default: incremental). Incremental
+                 runs reuse the hashes of files whose size and mtime are
+                 unchanged; --force rereads every file
   --v2           Use v2 indexer (AST chunking, Merkle tree change detection)
   --verbose, -v  Enable verbose output
-  --json         Output results as JSON
+  --json         Output results as JSON (an array of per-repo results when
+                 several paths are given)
+  --report-skipped
+                 Summarize skipped files by reason (v2; gitignored, tests, and
+                 with CODETECT_SKIP_NON_SOURCE binary, generated, too large),
+                 included in --json output
+  --report-coverage
+                 Count files found, embedded and skipped per language after
+                 indexing (v2), included in --json output
+  --force-include-dir DIR
+                 Index DIR even if gitignored or excluded by default
+                 (repeatable or comma-separated; see Force-Included
+                 Directories below)
+  --include-hidden-dir DIR
+                 Index the hidden directory DIR, e.g. .github/workflows
+                 (v2; repeatable or comma-separated). Unlike
+                 --force-include-dir, .gitignore still applies inside it
+  --max-embeddings N
+                 Refuse to index, before changing anything, if more than N
+                 new embeddings would be needed after cache hits (v2;
+                 default CODETECT_MAX_EMBEDDINGS, 0 = no limit)
+  --always-embed GLOB
+                 Reindex files matching GLOB on every run, changed or not,
+                 and re-embed them even if cached, replacing the cached
+                 vectors (v2; repeatable). GLOB matches the file name
+                 ("*.proto") or, with a "/", the repo-relative path
+                 ("api/*.go"); "dir/**" matches everything under dir
+  --profile DIR  Write a CPU profile (cpu.pprof) of the run and a heap
+                 profile (heap.pprof) at its end to DIR, for
+                 'go tool pprof'
 
 Stats Options:
   --v2           Show v2 index statistics
   --json         Output stats as JSON
 
+Duplicates Options:
+  --top N        Number of duplicated chunks to show, most locations first
+                 (default: 10)
+  --json         Output duplicated chunks as JSON
+
+Verify Options:
+  Reports dangling locations, whose chunk has no embedding, and orphaned
+  embeddings, which no location in the database references, as left by an
+  indexing run stopped between the two writes. Exits 1 if any remain.
+  --repair       Re-embed dangling locations (needs the embedding provider)
+                 and delete orphaned embeddings
+  --json         Output the report as JSON
+
+History Options:
+  Each v2 indexing run that finds changes is recorded in the index, up to
+  the last 1000 per repository.
+  --limit N      Number of most recent runs to show, oldest first
+                 (default: 20, 0 = all kept)
+  --json         Output the runs as JSON
+
+Queries Options:
+  Queries are logged only when CODETECT_QUERY_LOG is hashed (a hash of
+  each query, for privacy) or raw, up to the last 10000 per repository.
+  --limit N      Number of most frequent queries to show
+                 (default: 20, 0 = all kept)
+  --json         Output the query summaries as JSON
+
+Merkle Options:
+  Each v2 indexing run keeps the Merkle trees of the runs before as backups
+  in .codetect, CODETECT_MERKLE_BACKUPS of them (not with
+  CODETECT_MERKLE_STORE=db). 'restore' recovers from
+  a corrupt tree, or one recorded by a bad run, by replacing it with the
+  newest backup that loads; the next 'index --v2' run then reindexes the
+  files changed since that tree was built.
+  --json         Output the backups or the restored tree as JSON
+
+Chunks Options:
+  --content      Print each chunk's content
+  --json         Output chunks as JSON (content only with --content)
+
+Import Embeddings:
+  Reads JSONL records from <file> ("-" for stdin), one per chunk:
+    {"content_hash": "<sha256 hex>", "embedding": [0.1, ...], "model": "..."}
+  content_hash is the v2 cache key: the SHA-256 of the text embedded for the
+  chunk. That is its content_hash in 'codetect-index chunks --json' unless
+  CODETECT_STRIP_COMMENTS, CODETECT_NEIGHBOR_CONTEXT,
+  CODETECT_QUALIFIED_NAMES, CODETECT_EMBED_PATHS or
+  CODETECT_DESCRIBE_DATA_FILES is on. Vectors must have
+  CODETECT_VECTOR_DIMENSIONS entries; "model" is optional but, when
+  CODETECT_EMBEDDING_MODEL is set, must match it, because search queries are
+  still embedded with that model. Run 'index --v2' first; with no provider
+  available, index with CODETECT_EMBEDDING_PROVIDER=off.
+  --json         Output results as JSON
+
+Export and Import:
+  'export' writes a self-contained bundle (a .tar.gz) of a SQLite v2 index:
+  a manifest, a snapshot of .codetect/index.db holding only this repo's
+  locations, and the Merkle tree. 'import' restores it into another
+  checkout of the same repository, which can then be searched and indexed
+  incrementally without re-embedding. Import refuses bundles from a newer
+  format version or with other CODETECT_VECTOR_DIMENSIONS.
+  --json         Output the bundle manifest as JSON
+  --force, -f    Import over an existing index
+
+Diff Options:
+  Each of <a> and <b> is a repository directory, whose index is located as
+  for 'stats --v2' (so two checkouts sharing a PostgreSQL database can be
+  compared), or a SQLite index file such as .codetect/index.db. Lists files
+  added in <b> (+), removed (-) and changed (~) by chunk content, with the
+  symbols each gained or lost.
+  --json         Output the diff as JSON
+  --repo-a ROOT, --repo-b ROOT
+                 Repository to compare from an index file holding several
+                 (e.g. both sides of a shared SQLite database)
+
 Embed Options:
   --force, -f    Re-embed all chunks (ignore cache)
   --provider     Embedding provider (ollama, litellm, off)
   --model        Embedding model (provider-specific default if empty)
   --parallel, -j Number of parallel workers (default: 10)
+  --missing-only Embed only v2 chunks missing from the cache (no re-chunking
+                 of unchanged files)
+  --report-skipped
+                 Summarize skipped files by reason (unsupported extension,
+                 gitignored, and with CODETECT_SKIP_NON_SOURCE binary,
+                 generated, too large)
+  --no-emoji     Print the embedding preview without emoji (also
+                 CODETECT_NO_EMOJI)
+  --force-include-dir DIR
+                 Embed DIR even if gitignored or excluded by default
+  --max-embeddings N
+                 With --missing-only, refuse to run if more than N chunks
+                 are missing from the cache (0 = no limit)
+  --profile DIR  Write CPU and heap profiles of the run to DIR
 
 v2 Indexer Features:
   The v2 indexer (--v2) provides significant improvements:
@@ -782,11 +2311,57 @@ v2 Indexer Features:
   - Support for 10 languages: Go, Python, JavaScript, TypeScript, Rust,
     Java, C, C++, Ruby, PHP
 
+Force-Included Directories:
+  Directories given with --force-include-dir or CODETECT_FORCE_INCLUDE_DIRS
+  are indexed even when ignored. Precedence, highest first:
+    1. .git and .codetect are never indexed
+    2. Everything at or below a force-included directory is indexed,
+       overriding .gitignore, built-in exclusions (node_modules, vendor,
+       build, hidden directories, ...) and nested ignore rules
+    3. Everything else follows .gitignore and the built-in exclusions
+  Ignored parents of a force-included directory are traversed, but only
+  the path leading to it is indexed. Paths are relative to the repository
+  root. Per-file filters (binary, generated, too large) still apply.
+
 Database Environment Variables:
   CODETECT_DB_TYPE              Database type: sqlite (default), postgres
   CODETECT_DB_DSN               PostgreSQL connection string
   CODETECT_DB_PATH              SQLite database path override
   CODETECT_VECTOR_DIMENSIONS    Vector dimensions [default: 768]
+  CODETECT_HNSW_MIN_VECTORS     Vectors needed before a native HNSW/vec0 index is
+                                built; smaller indexes are searched by brute force
+                                (0 = always native) [default: 1000]
+  CODETECT_VECTOR_INDEX         Vector index the v2 indexer builds: hnsw, or pq to
+                                keep product-quantized codes for large indexes
+                                [default: hnsw]
+  CODETECT_PQ_SUBSPACES         Sub-vectors per vector with pq; must divide the
+                                dimensions [default: 16]
+  CODETECT_PQ_CENTROIDS         Codebook size per subspace with pq (max 256)
+                                [default: 256]
+  CODETECT_PQ_RERANK_FACTOR     Candidates re-ranked per result with pq [default: 4]
+  CODETECT_VECTOR_SHARD_BY_REPO Keep one brute-force vector index shard per
+                                repository, so a search of one repo in a shared
+                                database scans only its vectors; not with
+                                CODETECT_VECTOR_INDEX=pq [default: false]
+  CODETECT_DISTANCE_METRIC      Similarity metric for every vector backend: cosine,
+                                euclidean, dot_product [default: cosine]. Changing it
+                                requires 'index --v2 --force'
+  CODETECT_DB_WRITE_BATCH_SIZE  Embedding cache entries per write transaction (v2)
+                                [default: 500]
+  CODETECT_DB_WRITE_WORKERS     Parallel cache write transactions, PostgreSQL only
+                                (v2) [default: 4]
+  CODETECT_DB_BUSY_TIMEOUT_MS   Milliseconds SQLite waits for a lock held by another
+                                process before "database is locked"; 0 disables
+                                waiting [default: 5000]
+  CODETECT_DB_READ_RETRIES      Times a PostgreSQL read is retried after the
+                                connection drops (restart, failover); 0 disables
+                                retries [default: 3]
+  CODETECT_DB_RETRY_BACKOFF_MS  Milliseconds before the first retry, doubling for
+                                each further one [default: 100]
+  CODETECT_CACHE_ENCODING       How new embedding cache entries store vectors on
+                                SQLite: json, or int8 to quantize them to about a
+                                tenth of the size; search scores move slightly, so
+                                near ties can swap [default: json]
 
 Embedding Environment Variables:
   CODETECT_EMBEDDING_PROVIDER   Provider (ollama, litellm, off) [default: ollama]
@@ -794,15 +2369,101 @@ Embedding Environment Variables:
   CODETECT_LITELLM_URL          LiteLLM URL [default: http://localhost:4000]
   CODETECT_LITELLM_API_KEY      LiteLLM API key
   CODETECT_EMBEDDING_MODEL      Model override
+  CODETECT_EMBEDDING_FALLBACK_PROVIDER
+                                Provider used when the primary is unavailable or
+                                fails (ollama, litellm); must produce vectors of the
+                                same dimensions. Embeddings are tagged with the
+                                model that produced them
+  CODETECT_EMBEDDING_FALLBACK_MODEL
+                                Fallback model (provider default if empty)
+  CODETECT_EMBEDDING_EXTRA_MODELS
+                                Comma-separated models of the same provider that
+                                'index --v2' also embeds every chunk with, each
+                                searchable on its own, for comparing models
+
+Chunking Environment Variables:
+  CODETECT_STRIP_COMMENTS       Strip comments from embedding input (v2) [default: false]
+  CODETECT_FILE_EMBEDDINGS      Also store pooled file-level embeddings (v2) [default: false]
+  CODETECT_LANGUAGE_MAP         Language overrides, e.g. ".inc=php,*.tmpl=go" (v2)
+  CODETECT_EMBED_MAX_BYTES      Truncate embedder input per chunk (v2, 0 = off) [default: 32768]
+  CODETECT_SUBCHUNK_LINES       Split large nodes into ~N-line sub-chunks (v2, experimental) [default: 0]
+  CODETECT_NEIGHBOR_CONTEXT     Embed neighbor signatures with each chunk (v2) [default: false]
+  CODETECT_QUALIFIED_NAMES      Embed each chunk's qualified symbol name, e.g.
+                                auth.Middleware.Handle (v2) [default: false]
+  CODETECT_DESCRIBE_DATA_FILES  Embed config/data file chunks by a summary of their keys
+                                instead of raw values (v2) [default: false]
+  CODETECT_SKIP_TRIVIAL_CHUNKS  Skip trivial getters, setters and constructors (v2) [default: false]
+  CODETECT_TRIVIAL_CHUNK_LOCATIONS
+                                Still record skipped trivial chunks as locations, without
+                                embedding them (v2) [default: false]
+  CODETECT_EXPORTED_ONLY        Languages to index by public symbols only, e.g. "go,python";
+                                supports go, python, javascript, typescript, java, rust (v2)
+  CODETECT_MAX_CHUNK_SIZE       Max chunk size in characters, 0 for each language's
+                                default (v2) [default: 0]
+  CODETECT_MAX_CHUNK_SIZES      Max chunk size per language, e.g. "java=4000,python=1200",
+                                over CODETECT_MAX_CHUNK_SIZE (v2)
+  CODETECT_SKIP_GAPS            Leave out code between definitions, such as imports (v2)
+                                [default: false]
+  CODETECT_EXCLUDE_TESTS        Skip test files and test directories (v2) [default: false]
+  CODETECT_LEADING_COMMENTS     Include doc comments and decorators above a symbol in its
+                                chunk instead of a gap chunk (v2) [default: false]
+  CODETECT_LEADING_COMMENT_GAP  Blank lines allowed between them and the symbol (v2) [default: 0]
+  CODETECT_SPLIT_OVERSIZED      Index nodes over the max chunk size only as numbered parts,
+                                not also whole (v2) [default: false]
+  CODETECT_MAX_CHUNK_TOKENS     Split chunks estimated at more tokens into parts, so models
+                                that truncate input see all of them; 0 for no limit
+                                (v2) [default: 0]
+  CODETECT_SPLIT_NESTED_FUNCTIONS
+                                Languages whose named functions nested in other functions
+                                are always chunks of their own, e.g. "javascript,python";
+                                supports javascript, typescript, python, rust (v2)
+  CODETECT_CHUNK_PROFILE        Named bundle of the options above: default, docs, api,
+                                fine, or one defined in a profiles file; overrides the
+                                "chunk_profile" in a repo's .codetect.json (v2)
+  CODETECT_CHUNK_PROFILES_FILE  JSON file of shared profiles, e.g.
+                                {"team": {"skip_gaps": true, "max_chunk_size": 3000}} (v2)
+
+Index Environment Variables:
+  CODETECT_FORCE_INCLUDE_DIRS   Comma-separated directories to index even if ignored
+  CODETECT_INCLUDE_HIDDEN_DIRS  Comma-separated hidden directories to index (v2)
+  CODETECT_MAX_EMBEDDINGS       Max new embeddings per repo and run, counted after
+                                cache hits (v2, 0 = no limit) [default: 0]
+  CODETECT_TRACK_RENAMES        Move the locations of files moved with unchanged
+                                content instead of reindexing them (v2) [default: false]
+  CODETECT_STORE_CONTENT        Store compressed chunk content in the index, so
+                                snippets survive moved or changed files (v2) [default: false]
+  CODETECT_CHUNK_DELTAS         Write only the changed locations of a changed file and
+                                delete those of its removed chunks (v2) [default: false]
+  CODETECT_INDEX_CONCURRENCY    Chunk files and embed their chunks at the same time on
+                                N shared workers (v2, 0 = chunk each batch first) [default: 0]
+  CODETECT_MERKLE_HASH          Hash used to detect changed files, sha256 or blake3;
+                                changing it reindexes every file once (v2) [default: sha256]
+  CODETECT_MERKLE_STORE         Keep the Merkle tree in a JSON file (file) or in the
+                                index database (db) (v2) [default: file]
+  CODETECT_MERKLE_BACKUPS       Previous Merkle trees kept as backups for 'merkle
+                                restore' (v2, file store only) [default: 1]
+  CODETECT_SKIP_NON_SOURCE      Leave files over CODETECT_MAX_FILE_SIZE, binary files and
+                                generated files out of the index and embed [default: false]
+  CODETECT_MAX_FILE_SIZE        Size limit in bytes of CODETECT_SKIP_NON_SOURCE, negative
+                                for none [default: 1048576]
 
 Logging Environment Variables:
   CODETECT_LOG_LEVEL            Log level (debug, info, warn, error) [default: info]
   CODETECT_LOG_FORMAT           Output format (text, json) [default: text]
+  CODETECT_NO_EMOJI             Keep human-readable output such as the embedding
+                                preview ASCII [default: false]
 
 Database:
   Default: SQLite stored in .codetect/ relative to indexed path.
   PostgreSQL: Set CODETECT_DB_TYPE=postgres and CODETECT_DB_DSN.
 
+Multiple Repositories:
+  'index --v2' and 'embed --missing-only' take several paths and process
+  them in one run, reusing the database connection and embedder. Each repo
+  is stored under its own repo root: with PostgreSQL all repos share one
+  store, with SQLite each keeps its own .codetect/index.db. A failing repo
+  is reported and the rest continue; the exit status is 1 if any failed.
+
 Requirements:
   - universal-ctags (for v1 symbol extraction)
   - Ollama OR LiteLLM (optional, for semantic search)
@@ -820,5 +2481,25 @@ Examples:
 
   # v2 indexing (AST-based, recommended)
   codetect-index index --v2 .
-  codetect-index stats --v2 .`)
+  codetect-index stats --v2 .
+
+  # Index sibling repos in one run
+  codetect-index index --v2 ../api ../web ../worker
+
+  # Fill in embeddings evicted from the v2 cache
+  codetect-index embed --missing-only .
+
+  # Search vectors computed by an external GPU pipeline
+  CODETECT_EMBEDDING_PROVIDER=off codetect-index index --v2 .
+  codetect-index import-embeddings vectors.jsonl .
+
+  # Build the index once (e.g. in CI) and reuse it in another checkout
+  codetect-index export index.tar.gz .
+  codetect-index import index.tar.gz ~/src/myrepo
+
+  # Check what a rebuild or a branch changed in the index
+  codetect-index diff ~/src/myrepo ~/src/myrepo-branch
+
+  # Inspect chunk boundaries for a file
+  codetect-index chunks --content internal/server/handler.go`)
 }
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"os"
+	"time"
 
+	"codetect/internal/config"
 	"codetect/internal/logging"
 	"codetect/internal/mcp"
 	"codetect/internal/tools"
@@ -16,11 +19,19 @@ const (
 func main() {
 	logger := logging.Default("codetect")
 
-	server := mcp.NewServer(serverName, serverVersion)
+	searchCfg := config.LoadSearchConfigFromEnv()
+	server := mcp.NewServer(serverName, serverVersion,
+		mcp.WithToolTimeout(time.Duration(searchCfg.CallTimeoutMs)*time.Millisecond))
 
 	// Register all tools
 	tools.RegisterAll(server)
 
+	// Load the semantic index in the background so the first query is fast
+	if searchCfg.Warmup {
+		tools.StartWarmup(context.Background())
+		logger.Info("warming up semantic index")
+	}
+
 	logger.Info("starting MCP server", "name", serverName, "version", serverVersion)
 
 	if err := server.Run(); err != nil {
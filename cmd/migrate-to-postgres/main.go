@@ -154,10 +154,11 @@ func main() {
 
 	// Prepare migration options
 	opts := embedding.MigrationOptions{
-		BatchSize:    *batchSize,
-		SkipExisting: *skipExisting,
-		DropTarget:   *dropTarget,
-		DryRun:       *dryRun,
+		BatchSize:      *batchSize,
+		SkipExisting:   *skipExisting,
+		DropTarget:     *dropTarget,
+		DryRun:         *dryRun,
+		DistanceMetric: config.LoadDistanceMetricFromEnv(),
 	}
 
 	// Progress tracking
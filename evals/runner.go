@@ -10,20 +10,43 @@ import (
 	"os/exec"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// commandFunc runs the agent CLI with the given arguments in dir and returns
+// its stdout and stderr. It is swapped out in tests.
+type commandFunc func(ctx context.Context, dir string, args []string) (stdout, stderr []byte, err error)
+
 // Runner executes evaluation test cases.
 type Runner struct {
 	config EvalConfig
+	run    commandFunc
+
+	// mcpSlots caps concurrent MCP-enabled invocations when
+	// config.MCPConcurrency > 0. Created per RunAll.
+	mcpSlots chan struct{}
 }
 
 // NewRunner creates a new evaluation runner.
 func NewRunner(config EvalConfig) *Runner {
-	return &Runner{config: config}
+	return &Runner{config: config, run: runClaude}
+}
+
+// runClaude invokes the claude CLI.
+func runClaude(ctx context.Context, dir string, args []string) ([]byte, []byte, error) {
+	cmd := exec.CommandContext(ctx, "claude", args...)
+	cmd.Dir = dir
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	return stdout.Bytes(), stderr.Bytes(), err
 }
 
 // LoadTestCases loads test cases from JSONL files in the cases directory.
@@ -83,6 +106,8 @@ func (r *Runner) loadJSONLFile(path string) ([]TestCase, error) {
 	defer file.Close()
 
 	var cases []TestCase
+	var suite SuiteConfig
+	strategies := NewValidator()
 	scanner := bufio.NewScanner(file)
 	lineNum := 0
 
@@ -93,10 +118,27 @@ func (r *Runner) loadJSONLFile(path string) ([]TestCase, error) {
 			continue
 		}
 
+		// Suite directive lines set defaults for the cases that follow
+		var directive struct {
+			Suite *SuiteConfig `json:"suite"`
+		}
+		if err := json.Unmarshal([]byte(line), &directive); err == nil && directive.Suite != nil {
+			if name := directive.Suite.Validator; name != "" && !strategies.Has(name) {
+				return nil, fmt.Errorf("line %d: unknown suite validator %q", lineNum, name)
+			}
+			suite = *directive.Suite
+			continue
+		}
+
 		var tc TestCase
 		if err := json.Unmarshal([]byte(line), &tc); err != nil {
 			return nil, fmt.Errorf("line %d: %w", lineNum, err)
 		}
+		if tc.Validator == "" {
+			tc.Validator = suite.Validator
+		} else if !strategies.Has(tc.Validator) {
+			return nil, fmt.Errorf("line %d: unknown validator %q for case %s", lineNum, tc.Validator, tc.ID)
+		}
 		cases = append(cases, tc)
 	}
 
@@ -123,6 +165,13 @@ func (r *Runner) RunAll(ctx context.Context, cases []TestCase) (*EvalReport, err
 		Config:    r.config,
 	}
 
+	// Cap MCP-enabled invocations independently of case parallelism, so a
+	// slow tool server can't be overwhelmed by every worker at once
+	r.mcpSlots = nil
+	if r.config.MCPConcurrency > 0 {
+		r.mcpSlots = make(chan struct{}, r.config.MCPConcurrency)
+	}
+
 	// Determine parallelism level (0 means use number of test cases)
 	parallelism := r.config.Parallel
 	if parallelism <= 0 {
@@ -257,24 +306,32 @@ func (r *Runner) RunAll(ctx context.Context, cases []TestCase) (*EvalReport, err
 
 // runTestCase executes a single test case in the specified mode.
 func (r *Runner) runTestCase(ctx context.Context, tc TestCase, mode ExecutionMode) (*RunResult, error) {
-	ctx, cancel := context.WithTimeout(ctx, r.config.Timeout)
-	defer cancel()
+	// Wait for an MCP slot before starting the clock, so queueing behind
+	// other slow invocations doesn't eat into this one's budget
+	if mode == ModeWithMCP && r.mcpSlots != nil {
+		select {
+		case r.mcpSlots <- struct{}{}:
+			defer func() { <-r.mcpSlots }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	timeout := r.config.Timeout
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 
 	args := r.buildClaudeArgs(tc, mode)
 
 	start := time.Now()
-	cmd := exec.CommandContext(ctx, "claude", args...)
-	cmd.Dir = r.config.RepoPath
-
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	err := cmd.Run()
+	stdout, stderr, err := r.run(ctx, r.config.RepoPath, args)
 	duration := time.Since(start)
 
 	// Save raw stdout to log file for later inspection
-	if err := r.saveLog(tc.ID, mode, start, stdout.Bytes()); err != nil && r.config.Verbose {
+	if err := r.saveLog(tc.ID, mode, start, stdout); err != nil && r.config.Verbose {
 		fmt.Fprintf(os.Stderr, "warning: could not save log for %s: %v\n", tc.ID, err)
 	}
 
@@ -284,15 +341,21 @@ func (r *Runner) runTestCase(ctx context.Context, tc TestCase, mode ExecutionMod
 		Duration:   duration,
 	}
 
+	if ctx.Err() == context.DeadlineExceeded {
+		result.Success = false
+		result.Error = fmt.Sprintf("%s invocation timed out after %s", mode, timeout)
+		return result, nil
+	}
+
 	if err != nil {
 		result.Success = false
-		result.Error = fmt.Sprintf("%v: %s", err, stderr.String())
+		result.Error = fmt.Sprintf("%v: %s", err, string(stderr))
 		return result, nil
 	}
 
 	// Parse streaming JSON output - each line is a separate JSON event
 	// We look for the final "result" event which contains usage stats
-	lines := bytes.Split(stdout.Bytes(), []byte("\n"))
+	lines := bytes.Split(stdout, []byte("\n"))
 	for _, line := range lines {
 		if len(line) == 0 {
 			continue
@@ -325,7 +388,7 @@ func (r *Runner) runTestCase(ctx context.Context, tc TestCase, mode ExecutionMod
 	// If we didn't find a result event, try parsing as simple JSON
 	if result.Output == "" {
 		var resp ClaudeResponse
-		if err := json.Unmarshal(stdout.Bytes(), &resp); err == nil {
+		if err := json.Unmarshal(stdout, &resp); err == nil {
 			result.Success = true
 			result.Output = resp.Result
 			result.SessionID = resp.SessionID
@@ -346,9 +409,17 @@ func (r *Runner) buildClaudeArgs(tc TestCase, mode ExecutionMode) []string {
 
 	if mode == ModeWithMCP {
 		// Enable codetect MCP tools
-		mcpConfig := `{"mcpServers":{"codetect":{"command":"codetect","args":["mcp"]}}}`
+		server := map[string]any{"command": "codetect", "args": []string{"mcp"}}
+		if r.config.MCPTimeout > 0 {
+			// Bound each tool call in the server, separately from the case
+			timeoutMs := max(r.config.MCPTimeout.Milliseconds(), 1)
+			server["env"] = map[string]string{
+				"CODETECT_MCP_CALL_TIMEOUT_MS": strconv.FormatInt(timeoutMs, 10),
+			}
+		}
+		mcpConfig, _ := json.Marshal(map[string]any{"mcpServers": map[string]any{"codetect": server}})
 		args = append(args,
-			"--mcp-config", mcpConfig,
+			"--mcp-config", string(mcpConfig),
 			"--allowedTools", "mcp__codetect__search_keyword,mcp__codetect__find_symbol,mcp__codetect__list_defs_in_file,mcp__codetect__search_semantic,mcp__codetect__hybrid_search,mcp__codetect__get_file,Read",
 		)
 	} else {
@@ -0,0 +1,204 @@
+package evals
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stubTool returns a commandFunc that sleeps for delay when invoked with
+// MCP tools enabled, and tracks the peak number of concurrent MCP calls.
+type stubTool struct {
+	delay   time.Duration
+	active  atomic.Int32
+	peak    atomic.Int32
+	mu      sync.Mutex
+	mcpRuns int
+}
+
+func (s *stubTool) run(ctx context.Context, dir string, args []string) ([]byte, []byte, error) {
+	isMCP := strings.Contains(strings.Join(args, " "), "--mcp-config")
+	if !isMCP {
+		return []byte(`{"type":"result","subtype":"success","result":"ok"}`), nil, nil
+	}
+
+	s.mu.Lock()
+	s.mcpRuns++
+	s.mu.Unlock()
+
+	n := s.active.Add(1)
+	defer s.active.Add(-1)
+	for {
+		peak := s.peak.Load()
+		if n <= peak || s.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+
+	select {
+	case <-time.After(s.delay):
+		return []byte(`{"type":"result","subtype":"success","result":"ok"}`), nil, nil
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+}
+
+func newStubRunner(t *testing.T, cfg EvalConfig, tool *stubTool) *Runner {
+	t.Helper()
+	cfg.RepoPath = t.TempDir()
+	r := NewRunner(cfg)
+	r.run = tool.run
+	return r
+}
+
+func makeCases(n int) []TestCase {
+	cases := make([]TestCase, n)
+	for i := range cases {
+		cases[i] = TestCase{ID: string(rune('a' + i)), Prompt: "find it"}
+	}
+	return cases
+}
+
+func resultsByMode(report *EvalReport, mode ExecutionMode) []RunResult {
+	var out []RunResult
+	for _, r := range report.RawResults {
+		if r.Mode == mode {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func TestRunAllTimeout(t *testing.T) {
+	tool := &stubTool{delay: 2 * time.Second}
+	cfg := DefaultConfig()
+	cfg.Parallel = 2
+	cfg.Timeout = 50 * time.Millisecond
+
+	r := newStubRunner(t, cfg, tool)
+
+	start := time.Now()
+	report, err := r.RunAll(context.Background(), makeCases(2))
+	if err != nil {
+		t.Fatalf("RunAll failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("RunAll took %v, slow tool should have been cut off by Timeout", elapsed)
+	}
+
+	for _, res := range resultsByMode(report, ModeWithMCP) {
+		if res.Success {
+			t.Errorf("%s: expected MCP run to fail on timeout", res.TestCaseID)
+		}
+		if !strings.Contains(res.Error, "timed out") {
+			t.Errorf("%s: Error = %q, want timeout", res.TestCaseID, res.Error)
+		}
+	}
+
+	// Runs without MCP finish in time
+	for _, res := range resultsByMode(report, ModeWithoutMCP) {
+		if !res.Success {
+			t.Errorf("%s: without-MCP run failed: %s", res.TestCaseID, res.Error)
+		}
+	}
+}
+
+func TestBuildClaudeArgsMCPTimeout(t *testing.T) {
+	mcpServer := func(cfg EvalConfig) map[string]any {
+		t.Helper()
+		args := NewRunner(cfg).buildClaudeArgs(TestCase{Prompt: "find it"}, ModeWithMCP)
+		i := slices.Index(args, "--mcp-config")
+		if i < 0 || i+1 >= len(args) {
+			t.Fatalf("args %q have no --mcp-config", args)
+		}
+		var mcpConfig struct {
+			MCPServers map[string]map[string]any `json:"mcpServers"`
+		}
+		if err := json.Unmarshal([]byte(args[i+1]), &mcpConfig); err != nil {
+			t.Fatalf("parsing --mcp-config: %v", err)
+		}
+		return mcpConfig.MCPServers["codetect"]
+	}
+
+	cfg := DefaultConfig()
+	if server := mcpServer(cfg); server["command"] != "codetect" || server["env"] != nil {
+		t.Errorf("server without MCPTimeout = %v, want codetect with no env", server)
+	}
+
+	// The timeout bounds each tool call in the server
+	cfg.MCPTimeout = 1500 * time.Millisecond
+	env, _ := mcpServer(cfg)["env"].(map[string]any)
+	if got := env["CODETECT_MCP_CALL_TIMEOUT_MS"]; got != "1500" {
+		t.Errorf("CODETECT_MCP_CALL_TIMEOUT_MS = %v, want 1500", got)
+	}
+}
+
+func TestRunAllMCPConcurrencyCap(t *testing.T) {
+	tool := &stubTool{delay: 30 * time.Millisecond}
+	cfg := DefaultConfig()
+	cfg.Parallel = 6
+	cfg.MCPConcurrency = 2
+
+	r := newStubRunner(t, cfg, tool)
+
+	report, err := r.RunAll(context.Background(), makeCases(6))
+	if err != nil {
+		t.Fatalf("RunAll failed: %v", err)
+	}
+
+	if peak := tool.peak.Load(); peak > 2 {
+		t.Errorf("peak concurrent MCP invocations = %d, want <= 2", peak)
+	}
+	if tool.mcpRuns != 6 {
+		t.Errorf("MCP invocations = %d, want 6", tool.mcpRuns)
+	}
+	for _, res := range resultsByMode(report, ModeWithMCP) {
+		if !res.Success {
+			t.Errorf("%s: MCP run failed: %s", res.TestCaseID, res.Error)
+		}
+	}
+}
+
+func TestRunAllMCPNoCap(t *testing.T) {
+	tool := &stubTool{delay: 50 * time.Millisecond}
+	cfg := DefaultConfig()
+	cfg.Parallel = 4
+
+	r := newStubRunner(t, cfg, tool)
+
+	if _, err := r.RunAll(context.Background(), makeCases(4)); err != nil {
+		t.Fatalf("RunAll failed: %v", err)
+	}
+
+	// Without a cap, all workers may call the tool at once
+	if peak := tool.peak.Load(); peak < 2 {
+		t.Errorf("peak concurrent MCP invocations = %d, want parallel execution", peak)
+	}
+}
+
+func TestMCPWaitDoesNotCountTowardTimeout(t *testing.T) {
+	// Each call takes 60ms and only one may run at a time; a 100ms timeout
+	// would expire for queued calls if it covered the wait for a slot.
+	tool := &stubTool{delay: 60 * time.Millisecond}
+	cfg := DefaultConfig()
+	cfg.Parallel = 3
+	cfg.MCPConcurrency = 1
+	cfg.Timeout = 100 * time.Millisecond
+
+	r := newStubRunner(t, cfg, tool)
+
+	report, err := r.RunAll(context.Background(), makeCases(3))
+	if err != nil {
+		t.Fatalf("RunAll failed: %v", err)
+	}
+	for _, res := range resultsByMode(report, ModeWithMCP) {
+		if !res.Success {
+			t.Errorf("%s: MCP run failed: %s", res.TestCaseID, res.Error)
+		}
+	}
+}
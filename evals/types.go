@@ -13,6 +13,14 @@ type TestCase struct {
 	Prompt      string      `json:"prompt"`
 	GroundTruth GroundTruth `json:"ground_truth"`
 	Difficulty  string      `json:"difficulty"` // "easy", "medium", "hard"
+	Validator   string      `json:"validator,omitempty"` // Validation strategy (default: suite or "default")
+}
+
+// SuiteConfig holds per-suite defaults, declared in a case file by a line of
+// the form {"suite": {"validator": "line_overlap"}}. Defaults apply to the
+// cases that follow it in the same file.
+type SuiteConfig struct {
+	Validator string `json:"validator,omitempty"`
 }
 
 // GroundTruth contains the expected results for a test case.
@@ -61,6 +69,9 @@ type ValidationResult struct {
 	FilesMissed []string     `json:"files_missed"`
 	SymbolsFound []string    `json:"symbols_found"`
 	SymbolsMissed []string   `json:"symbols_missed"`
+	ContentFound  []string   `json:"content_found,omitempty"`
+	ContentMissed []string   `json:"content_missed,omitempty"`
+	Strategy      string     `json:"strategy,omitempty"` // Validation strategy used
 }
 
 // EvalConfig holds configuration for an evaluation run.
@@ -70,6 +81,8 @@ type EvalConfig struct {
 	TestCaseIDs   []string `json:"test_case_ids,omitempty"` // Empty = all test cases
 	Parallel      int      `json:"parallel"`       // Number of parallel runs (default: 1)
 	Timeout       time.Duration `json:"timeout"`   // Timeout per test case
+	MCPTimeout     time.Duration `json:"mcp_timeout,omitempty"`     // Timeout per codetect tool call (0 = none)
+	MCPConcurrency int           `json:"mcp_concurrency,omitempty"` // Max concurrent MCP-enabled invocations (0 = no cap beyond Parallel)
 	OutputDir     string   `json:"output_dir"`
 	Model         string   `json:"model"`          // Model to use (sonnet, haiku, opus)
 	Verbose       bool     `json:"verbose"`
@@ -1,80 +1,304 @@
 package evals
 
 import (
+	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 )
 
-// Validator validates run results against ground truth.
-type Validator struct{}
+// Built-in validation strategy names, selectable per case via TestCase.Validator
+// or per suite via a {"suite": {"validator": ...}} line in the case file.
+const (
+	StrategyDefault     = "default"      // Files and symbols mentioned anywhere in the output
+	StrategyExactFile   = "exact_file"   // Extracted file paths must match expected files exactly
+	StrategyLineOverlap = "line_overlap" // file:line references must overlap expected lines
+	StrategySymbol      = "symbol"       // Expected symbols appear as whole words
+	StrategySubstring   = "substring"    // Expected content snippets appear in the answer
+)
+
+// ValidationStrategy scores a run result against a test case's ground truth.
+type ValidationStrategy interface {
+	// Name returns the identifier used to select the strategy in case JSON.
+	Name() string
+
+	// Validate scores a successful run. Failed runs are scored zero by the
+	// Validator before strategies are consulted.
+	Validate(tc TestCase, result RunResult) ValidationResult
+}
 
-// NewValidator creates a new validator.
+// Validator validates run results against ground truth, dispatching to a
+// registered strategy per test case.
+type Validator struct {
+	strategies map[string]ValidationStrategy
+}
+
+// NewValidator creates a new validator with the built-in strategies registered.
 func NewValidator() *Validator {
-	return &Validator{}
+	v := &Validator{strategies: make(map[string]ValidationStrategy)}
+	v.Register(defaultStrategy{})
+	v.Register(exactFileStrategy{})
+	v.Register(lineOverlapStrategy{})
+	v.Register(symbolStrategy{})
+	v.Register(substringStrategy{})
+	return v
+}
+
+// Register adds or replaces a validation strategy.
+func (v *Validator) Register(s ValidationStrategy) {
+	v.strategies[s.Name()] = s
+}
+
+// Has reports whether a strategy is registered under name.
+func (v *Validator) Has(name string) bool {
+	_, ok := v.strategies[name]
+	return ok
+}
+
+// Strategy returns the strategy for name, falling back to the default
+// strategy for empty or unknown names. Case files are checked for unknown
+// names when loaded.
+func (v *Validator) Strategy(name string) ValidationStrategy {
+	if s, ok := v.strategies[name]; ok {
+		return s
+	}
+	return v.strategies[StrategyDefault]
 }
 
 // Validate checks a run result against the test case ground truth.
 func (v *Validator) Validate(tc TestCase, result RunResult) ValidationResult {
-	vr := ValidationResult{
-		TestCaseID: tc.ID,
-		Mode:       result.Mode,
-	}
+	strategy := v.Strategy(tc.Validator)
 
 	if !result.Success {
 		// Failed run gets zero scores
-		return vr
+		return ValidationResult{
+			TestCaseID: tc.ID,
+			Mode:       result.Mode,
+			Strategy:   strategy.Name(),
+		}
 	}
 
+	vr := strategy.Validate(tc, result)
+	vr.TestCaseID = tc.ID
+	vr.Mode = result.Mode
+	vr.Strategy = strategy.Name()
+	return vr
+}
+
+// setScores fills in precision, recall and F1. Recall is found/expected.
+// Precision is matched/returned, where matched counts returned items that hit
+// the ground truth; when the strategy cannot count returned items (returned
+// is zero) precision mirrors recall.
+func setScores(vr *ValidationResult, found, expected, matched, returned int) {
+	if expected > 0 {
+		vr.Recall = float64(found) / float64(expected)
+	}
+
+	if returned > 0 {
+		vr.Precision = float64(matched) / float64(returned)
+	} else if found > 0 {
+		vr.Precision = vr.Recall // Simplified: same as recall when we can't count false positives
+	}
+
+	if vr.Precision+vr.Recall > 0 {
+		vr.F1Score = 2 * (vr.Precision * vr.Recall) / (vr.Precision + vr.Recall)
+	}
+}
+
+// defaultStrategy matches expected files and symbols anywhere in the output,
+// case-insensitively.
+type defaultStrategy struct{}
+
+func (defaultStrategy) Name() string { return StrategyDefault }
+
+func (defaultStrategy) Validate(tc TestCase, result RunResult) ValidationResult {
+	var vr ValidationResult
+
 	output := strings.ToLower(result.Output)
 
 	// Extract files mentioned in output
-	foundFiles := v.extractFiles(result.Output)
+	foundFiles := extractFiles(result.Output)
 	expectedFiles := tc.GroundTruth.Files
 
 	// Calculate file metrics
-	if len(expectedFiles) > 0 {
-		for _, f := range expectedFiles {
-			fLower := strings.ToLower(f)
-			if containsPath(foundFiles, fLower) || strings.Contains(output, fLower) {
-				vr.FilesFound = append(vr.FilesFound, f)
-			} else {
-				vr.FilesMissed = append(vr.FilesMissed, f)
-			}
+	for _, f := range expectedFiles {
+		fLower := strings.ToLower(f)
+		if containsPath(foundFiles, fLower) || strings.Contains(output, fLower) {
+			vr.FilesFound = append(vr.FilesFound, f)
+		} else {
+			vr.FilesMissed = append(vr.FilesMissed, f)
 		}
 	}
 
 	// Extract symbols mentioned in output
 	expectedSymbols := tc.GroundTruth.Symbols
-	if len(expectedSymbols) > 0 {
-		for _, sym := range expectedSymbols {
-			symLower := strings.ToLower(sym)
-			if strings.Contains(output, symLower) {
-				vr.SymbolsFound = append(vr.SymbolsFound, sym)
-			} else {
-				vr.SymbolsMissed = append(vr.SymbolsMissed, sym)
-			}
+	for _, sym := range expectedSymbols {
+		symLower := strings.ToLower(sym)
+		if strings.Contains(output, symLower) {
+			vr.SymbolsFound = append(vr.SymbolsFound, sym)
+		} else {
+			vr.SymbolsMissed = append(vr.SymbolsMissed, sym)
 		}
 	}
 
 	// Calculate precision, recall, F1
 	totalExpected := len(expectedFiles) + len(expectedSymbols)
 	totalFound := len(vr.FilesFound) + len(vr.SymbolsFound)
+	setScores(&vr, totalFound, totalExpected, 0, 0)
+
+	return vr
+}
+
+// exactFileStrategy requires file paths in the output to match expected files
+// exactly (modulo a leading "./" or a parent directory prefix). Precision
+// counts every extracted file path, so extra files lower the score.
+type exactFileStrategy struct{}
 
-	if totalExpected > 0 {
-		vr.Recall = float64(totalFound) / float64(totalExpected)
+func (exactFileStrategy) Name() string { return StrategyExactFile }
+
+func (exactFileStrategy) Validate(tc TestCase, result RunResult) ValidationResult {
+	var vr ValidationResult
+
+	returned := extractFilePaths(result.Output)
+	matched := 0
+	for _, path := range returned {
+		for _, want := range tc.GroundTruth.Files {
+			if sameFile(path, want) {
+				matched++
+				break
+			}
+		}
 	}
 
-	// For precision, we'd need to know total items returned
-	// Approximation: assume output quality correlates with finding expected items
-	if totalFound > 0 {
-		vr.Precision = vr.Recall // Simplified: same as recall when we can't count false positives
+	for _, want := range tc.GroundTruth.Files {
+		found := false
+		for _, path := range returned {
+			if sameFile(path, want) {
+				found = true
+				break
+			}
+		}
+		if found {
+			vr.FilesFound = append(vr.FilesFound, want)
+		} else {
+			vr.FilesMissed = append(vr.FilesMissed, want)
+		}
 	}
 
-	// F1 score
-	if vr.Precision+vr.Recall > 0 {
-		vr.F1Score = 2 * (vr.Precision * vr.Recall) / (vr.Precision + vr.Recall)
+	setScores(&vr, len(vr.FilesFound), len(tc.GroundTruth.Files), matched, len(returned))
+
+	return vr
+}
+
+// lineRefPattern matches file:line and file:start-end references.
+var lineRefPattern = regexp.MustCompile(`([\w\-./]+\.\w+):(\d+)(?:-(\d+))?`)
+
+// lineOverlapStrategy requires file:line or file:start-end references in the
+// output that overlap the expected lines for each file in GroundTruth.Lines.
+type lineOverlapStrategy struct{}
+
+func (lineOverlapStrategy) Name() string { return StrategyLineOverlap }
+
+func (lineOverlapStrategy) Validate(tc TestCase, result RunResult) ValidationResult {
+	var vr ValidationResult
+
+	type lineRef struct {
+		path       string
+		start, end int
+	}
+	var refs []lineRef
+	for _, m := range lineRefPattern.FindAllStringSubmatch(result.Output, -1) {
+		start, err := strconv.Atoi(m[2])
+		if err != nil {
+			continue
+		}
+		end := start
+		if m[3] != "" {
+			if e, err := strconv.Atoi(m[3]); err == nil && e >= start {
+				end = e
+			}
+		}
+		refs = append(refs, lineRef{path: m[1], start: start, end: end})
+	}
+
+	files := make([]string, 0, len(tc.GroundTruth.Lines))
+	for f := range tc.GroundTruth.Lines {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+
+	matchedRefs := 0
+	for _, ref := range refs {
+		for _, f := range files {
+			if sameFile(ref.path, f) && overlapsAny(ref.start, ref.end, tc.GroundTruth.Lines[f]) {
+				matchedRefs++
+				break
+			}
+		}
+	}
+
+	for _, f := range files {
+		found := false
+		for _, ref := range refs {
+			if sameFile(ref.path, f) && overlapsAny(ref.start, ref.end, tc.GroundTruth.Lines[f]) {
+				found = true
+				break
+			}
+		}
+		if found {
+			vr.FilesFound = append(vr.FilesFound, f)
+		} else {
+			vr.FilesMissed = append(vr.FilesMissed, f)
+		}
+	}
+
+	setScores(&vr, len(vr.FilesFound), len(files), matchedRefs, len(refs))
+
+	return vr
+}
+
+// symbolStrategy requires expected symbols to appear as whole words,
+// case-sensitively, so "Run" does not match "RunAll".
+type symbolStrategy struct{}
+
+func (symbolStrategy) Name() string { return StrategySymbol }
+
+func (symbolStrategy) Validate(tc TestCase, result RunResult) ValidationResult {
+	var vr ValidationResult
+
+	for _, sym := range tc.GroundTruth.Symbols {
+		re, err := regexp.Compile(`\b` + regexp.QuoteMeta(sym) + `\b`)
+		if err == nil && re.MatchString(result.Output) {
+			vr.SymbolsFound = append(vr.SymbolsFound, sym)
+		} else {
+			vr.SymbolsMissed = append(vr.SymbolsMissed, sym)
+		}
 	}
 
+	setScores(&vr, len(vr.SymbolsFound), len(tc.GroundTruth.Symbols), 0, 0)
+	return vr
+}
+
+// substringStrategy requires each expected content snippet to appear in the
+// agent's answer, case-insensitively and ignoring whitespace differences.
+type substringStrategy struct{}
+
+func (substringStrategy) Name() string { return StrategySubstring }
+
+func (substringStrategy) Validate(tc TestCase, result RunResult) ValidationResult {
+	var vr ValidationResult
+
+	output := normalizeSpace(strings.ToLower(result.Output))
+	for _, want := range tc.GroundTruth.Content {
+		if strings.Contains(output, normalizeSpace(strings.ToLower(want))) {
+			vr.ContentFound = append(vr.ContentFound, want)
+		} else {
+			vr.ContentMissed = append(vr.ContentMissed, want)
+		}
+	}
+
+	setScores(&vr, len(vr.ContentFound), len(tc.GroundTruth.Content), 0, 0)
 	return vr
 }
 
@@ -137,7 +361,7 @@ func (v *Validator) ValidateAll(cases []TestCase, report *EvalReport) {
 }
 
 // extractFiles extracts file paths from output text.
-func (v *Validator) extractFiles(output string) []string {
+func extractFiles(output string) []string {
 	var files []string
 
 	// Match common file path patterns
@@ -175,3 +399,54 @@ func containsPath(paths []string, target string) bool {
 	}
 	return false
 }
+
+// sourceExtensions are the file extensions recognised by extractFilePaths.
+var sourceExtensions = map[string]bool{
+	".go": true, ".py": true, ".js": true, ".ts": true, ".tsx": true, ".jsx": true,
+	".java": true, ".rb": true, ".rs": true, ".c": true, ".cpp": true, ".h": true,
+	".hpp": true, ".sql": true, ".sh": true,
+}
+
+// extractFilePaths extracts whole path tokens with a recognised source
+// extension from output text, deduplicated and with any leading "./" removed.
+func extractFilePaths(output string) []string {
+	re := regexp.MustCompile(`[\w\-./]+`)
+
+	seen := make(map[string]bool)
+	var paths []string
+	for _, m := range re.FindAllString(output, -1) {
+		m = strings.TrimRight(m, ".")
+		if !sourceExtensions[filepath.Ext(m)] {
+			continue
+		}
+		m = strings.TrimPrefix(m, "./")
+		if !seen[m] {
+			seen[m] = true
+			paths = append(paths, m)
+		}
+	}
+	return paths
+}
+
+// sameFile reports whether path refers to want, allowing a leading "./" and
+// an absolute or parent-directory prefix on path.
+func sameFile(path, want string) bool {
+	path = strings.TrimPrefix(path, "./")
+	want = strings.TrimPrefix(want, "./")
+	return path == want || strings.HasSuffix(path, "/"+want)
+}
+
+// overlapsAny reports whether [start, end] contains any of lines.
+func overlapsAny(start, end int, lines []int) bool {
+	for _, l := range lines {
+		if l >= start && l <= end {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeSpace collapses runs of whitespace to a single space.
+func normalizeSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,215 @@
+package evals
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func validateOutput(t *testing.T, tc TestCase, output string) ValidationResult {
+	t.Helper()
+	return NewValidator().Validate(tc, RunResult{
+		TestCaseID: tc.ID,
+		Mode:       ModeWithMCP,
+		Success:    true,
+		Output:     output,
+	})
+}
+
+func TestValidateDefaultStrategy(t *testing.T) {
+	tc := TestCase{
+		ID: "default",
+		GroundTruth: GroundTruth{
+			Files:   []string{"internal/mcp/server.go"},
+			Symbols: []string{"RegisterTool", "Shutdown"},
+		},
+	}
+
+	vr := validateOutput(t, tc, "Tools are added via registertool in internal/mcp/server.go")
+	if vr.Strategy != StrategyDefault {
+		t.Errorf("Strategy = %q, want %q", vr.Strategy, StrategyDefault)
+	}
+	if len(vr.FilesFound) != 1 || len(vr.SymbolsFound) != 1 || len(vr.SymbolsMissed) != 1 {
+		t.Errorf("found files=%v symbols=%v missed=%v", vr.FilesFound, vr.SymbolsFound, vr.SymbolsMissed)
+	}
+	if !approx(vr.Recall, 2.0/3.0) {
+		t.Errorf("Recall = %v, want 2/3", vr.Recall)
+	}
+
+	// Unknown strategies fall back to the default
+	tc.Validator = "no_such_strategy"
+	if vr := validateOutput(t, tc, ""); vr.Strategy != StrategyDefault {
+		t.Errorf("unknown strategy resolved to %q", vr.Strategy)
+	}
+}
+
+func TestValidateExactFileStrategy(t *testing.T) {
+	tc := TestCase{
+		ID:        "exact",
+		Validator: StrategyExactFile,
+		GroundTruth: GroundTruth{
+			Files: []string{"evals/runner.go", "evals/types.go"},
+		},
+	}
+
+	vr := validateOutput(t, tc, "See ./evals/runner.go and /repo/evals/types.go, also cmd/main.go.")
+	if len(vr.FilesFound) != 2 {
+		t.Errorf("FilesFound = %v, want both", vr.FilesFound)
+	}
+	if !approx(vr.Recall, 1) {
+		t.Errorf("Recall = %v, want 1", vr.Recall)
+	}
+	if !approx(vr.Precision, 2.0/3.0) {
+		t.Errorf("Precision = %v, want 2/3 (one extra file)", vr.Precision)
+	}
+
+	// A file whose name merely contains the expected path does not match
+	vr = validateOutput(t, tc, "Look at evals/runner.go.bak and myevals/types.go")
+	if len(vr.FilesFound) != 0 {
+		t.Errorf("FilesFound = %v, want none", vr.FilesFound)
+	}
+}
+
+func TestValidateLineOverlapStrategy(t *testing.T) {
+	tc := TestCase{
+		ID:        "lines",
+		Validator: StrategyLineOverlap,
+		GroundTruth: GroundTruth{
+			Lines: map[string][]int{
+				"evals/runner.go":   {120, 121},
+				"evals/validate.go": {40},
+			},
+		},
+	}
+
+	vr := validateOutput(t, tc, "Defined at evals/runner.go:110-125; also evals/validate.go:90 and evals/report.go:5")
+	if len(vr.FilesFound) != 1 || vr.FilesFound[0] != "evals/runner.go" {
+		t.Errorf("FilesFound = %v, want [evals/runner.go]", vr.FilesFound)
+	}
+	if len(vr.FilesMissed) != 1 || vr.FilesMissed[0] != "evals/validate.go" {
+		t.Errorf("FilesMissed = %v, want [evals/validate.go]", vr.FilesMissed)
+	}
+	if !approx(vr.Recall, 0.5) {
+		t.Errorf("Recall = %v, want 0.5", vr.Recall)
+	}
+	if !approx(vr.Precision, 1.0/3.0) {
+		t.Errorf("Precision = %v, want 1/3", vr.Precision)
+	}
+
+	// A bare file mention without a line reference does not count
+	vr = validateOutput(t, tc, "It's in evals/runner.go")
+	if vr.Recall != 0 {
+		t.Errorf("Recall = %v, want 0", vr.Recall)
+	}
+}
+
+func TestValidateSymbolStrategy(t *testing.T) {
+	tc := TestCase{
+		ID:        "symbol",
+		Validator: StrategySymbol,
+		GroundTruth: GroundTruth{
+			Symbols: []string{"Run", "NewRunner"},
+		},
+	}
+
+	// "RunAll" and "newrunner" are not whole-word, case-sensitive matches
+	vr := validateOutput(t, tc, "Call RunAll after newrunner")
+	if len(vr.SymbolsFound) != 0 {
+		t.Errorf("SymbolsFound = %v, want none", vr.SymbolsFound)
+	}
+
+	vr = validateOutput(t, tc, "NewRunner() builds it; then Run(ctx) executes.")
+	if len(vr.SymbolsFound) != 2 || !approx(vr.F1Score, 1) {
+		t.Errorf("SymbolsFound = %v F1 = %v, want both and 1", vr.SymbolsFound, vr.F1Score)
+	}
+}
+
+func TestValidateSubstringStrategy(t *testing.T) {
+	tc := TestCase{
+		ID:        "substring",
+		Validator: StrategySubstring,
+		GroundTruth: GroundTruth{
+			Content: []string{"uses RRF fusion", "cross-encoder"},
+		},
+	}
+
+	vr := validateOutput(t, tc, "The retriever USES   RRF\nfusion to merge results.")
+	if len(vr.ContentFound) != 1 || len(vr.ContentMissed) != 1 {
+		t.Errorf("found=%v missed=%v", vr.ContentFound, vr.ContentMissed)
+	}
+	if !approx(vr.Recall, 0.5) {
+		t.Errorf("Recall = %v, want 0.5", vr.Recall)
+	}
+}
+
+func TestValidateFailedRun(t *testing.T) {
+	tc := TestCase{ID: "fail", Validator: StrategySymbol, GroundTruth: GroundTruth{Symbols: []string{"Run"}}}
+	vr := NewValidator().Validate(tc, RunResult{Mode: ModeWithMCP, Output: "Run"})
+	if vr.F1Score != 0 || len(vr.SymbolsFound) != 0 {
+		t.Errorf("failed run scored: %+v", vr)
+	}
+	if vr.Strategy != StrategySymbol {
+		t.Errorf("Strategy = %q, want %q", vr.Strategy, StrategySymbol)
+	}
+}
+
+func TestLoadSuiteValidator(t *testing.T) {
+	dir := t.TempDir()
+	data := `{"suite": {"validator": "line_overlap"}}
+{"id": "a", "prompt": "p"}
+{"id": "b", "prompt": "p", "validator": "symbol"}
+`
+	path := filepath.Join(dir, "cases.jsonl")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRunner(DefaultConfig())
+	cases, err := r.loadJSONLFile(path)
+	if err != nil {
+		t.Fatalf("loadJSONLFile failed: %v", err)
+	}
+	if len(cases) != 2 {
+		t.Fatalf("got %d cases, want 2", len(cases))
+	}
+	if cases[0].Validator != StrategyLineOverlap {
+		t.Errorf("case a Validator = %q, want suite default", cases[0].Validator)
+	}
+	if cases[1].Validator != StrategySymbol {
+		t.Errorf("case b Validator = %q, want per-case override", cases[1].Validator)
+	}
+}
+
+func TestLoadUnknownValidator(t *testing.T) {
+	for name, data := range map[string]string{
+		"case": `{"id": "a", "prompt": "p"}
+{"id": "b", "prompt": "p", "validator": "line_overlaps"}
+`,
+		"suite": `{"id": "a", "prompt": "p"}
+{"suite": {"validator": "symbols"}}
+`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "cases.jsonl")
+			if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			r := NewRunner(DefaultConfig())
+			_, err := r.LoadTestCases(dir)
+			if err == nil {
+				t.Fatal("LoadTestCases accepted an unknown validator")
+			}
+			if !strings.Contains(err.Error(), path) || !strings.Contains(err.Error(), "line 2") {
+				t.Errorf("error %q does not name the file and line", err)
+			}
+		})
+	}
+}
@@ -2,6 +2,9 @@ package chunker
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"slices"
 	"sort"
 	"strings"
 
@@ -20,11 +23,90 @@ const DefaultFallbackOverlap = 10
 // MinGapLines is the minimum number of uncovered lines to create a gap chunk.
 const MinGapLines = 3
 
+// MaxTreeDepth bounds how deep the recursive walks descend into a syntax
+// tree. Real code stays far below it; malformed or machine-generated input
+// can nest deep enough to exhaust the stack, which Go cannot recover from.
+const MaxTreeDepth = 5000
+
+// ErrUnparseable is returned, wrapped, for files whose syntax tree cannot
+// be walked: it nests deeper than MaxTreeDepth or tree-sitter panicked.
+// Callers should skip the file rather than fail.
+var ErrUnparseable = errors.New("unparseable file")
+
+// recoverPanic turns a panic while chunking into an ErrUnparseable error in
+// *err. It must be deferred directly.
+func recoverPanic(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("%w: tree-sitter panicked: %v", ErrUnparseable, r)
+	}
+}
+
 // ASTChunker creates semantic chunks from source code using tree-sitter parsing.
 // It splits code at natural AST boundaries (functions, classes, methods) to
 // produce more semantically coherent chunks for embedding.
 type ASTChunker struct {
-	OverlapLines int // Lines of context to include from adjacent chunks (for future use)
+	OverlapLines  int  // Lines of context to include from adjacent chunks (for future use)
+	StripComments bool // Set EmbedContent to the chunk text with comment nodes removed
+
+	// LanguageOverrides are consulted before the file extension when
+	// choosing a grammar, for nonstandard extensions like ".inc" for PHP.
+	LanguageOverrides []LanguageOverride
+
+	// SubChunkLines, when positive, splits chunks longer than twice this
+	// many lines into content-defined sub-chunks of about this size, so a
+	// small edit to a large node only changes one sub-chunk's hash.
+	SubChunkLines int
+
+	// NeighborContext sets NeighborContext on each chunk to the signatures
+	// of the chunks before and after it.
+	NeighborContext bool
+
+	// MaxChunkSize, when positive, replaces the languages' MaxChunkSize:
+	// split nodes larger than this many characters are also split into
+	// their children.
+	MaxChunkSize int
+
+	// MaxChunkSizes replaces, per language name, the maximum chunk size,
+	// taking precedence over MaxChunkSize, so that a language with large
+	// classes can be split more coarsely than one with dense functions.
+	MaxChunkSizes map[string]int
+
+	// SkipGaps leaves out the gap chunks of code outside split nodes, such
+	// as imports and top-level statements.
+	SkipGaps bool
+
+	// SplitNodes replaces, per language name, the AST node types that
+	// chunks are made from (see LanguageConfig.SplitNodes).
+	SplitNodes map[string][]string
+
+	// IncludeLeadingComments extends each chunk back over the comments
+	// and decorators directly before its node, such as a Go doc comment
+	// or JSDoc, so they are embedded with the code they describe instead
+	// of in a gap chunk. LeadingCommentGap is the number of blank lines
+	// allowed between them and the node.
+	IncludeLeadingComments bool
+	LeadingCommentGap      int
+
+	// SplitOversized replaces a split node larger than MaxChunkSize with
+	// its parts instead of also emitting it whole: the chunks of split
+	// nodes inside it, or if it has none, parts of about MaxChunkSize
+	// ending at statement boundaries, numbered by Chunk.PartIndex.
+	SplitOversized bool
+
+	// MaxTokens, when positive, splits chunks that TokenEstimator (or a
+	// HeuristicEstimator if nil) estimates at more tokens into parts of
+	// whole lines within it. Embedding models such as nomic-embed-text
+	// silently truncate longer input, leaving the tail of a chunk
+	// unsearchable.
+	MaxTokens      int
+	TokenEstimator TokenEstimator
+
+	// SplitNestedFunctions lists languages ("javascript", "python") whose
+	// named functions inside other functions are always chunks of their
+	// own, as well as part of the enclosing function's chunk. Otherwise
+	// they are only split out when the enclosing chunk exceeds
+	// MaxChunkSize. Anonymous functions stay with their parent.
+	SplitNestedFunctions []string
 }
 
 // NewASTChunker creates a new ASTChunker with default settings.
@@ -36,14 +118,19 @@ func NewASTChunker() *ASTChunker {
 
 // ChunkFile parses a file and returns semantic chunks based on AST analysis.
 // For supported languages, it creates chunks at natural code boundaries.
-// For unsupported languages, it falls back to line-based chunking.
-func (c *ASTChunker) ChunkFile(ctx context.Context, path string, content []byte) ([]Chunk, error) {
-	config := GetLanguageConfig(path)
+// For unsupported languages, it falls back to line-based chunking. Files
+// that cannot be parsed safely return an error wrapping ErrUnparseable.
+func (c *ASTChunker) ChunkFile(ctx context.Context, path string, content []byte) (_ []Chunk, err error) {
+	defer recoverPanic(&err)
+
+	config := ResolveLanguageConfig(path, c.LanguageOverrides)
 	if config == nil {
 		// Unsupported language - fall back to line-based chunking
-		return c.fallbackChunk(path, content), nil
+		return splitHashedByTokens(c.fallbackChunk(path, content), c.TokenEstimator, c.MaxTokens, true), nil
 	}
 
+	config = c.effectiveConfig(config)
+
 	// Parse with tree-sitter
 	parser := sitter.NewParser()
 	parser.SetLanguage(config.Language)
@@ -67,14 +154,29 @@ func (c *ASTChunker) ChunkFile(ctx context.Context, path string, content []byte)
 	covered := make(map[int]bool)
 
 	// Walk tree and create chunks from split nodes
-	c.walkTree(root, content, path, config, splitNodeSet, &chunks, covered)
+	if err := c.walkTree(root, content, path, config, splitNodeSet, packageScope(root, content, config), 0, &chunks, covered); err != nil {
+		return nil, err
+	}
 
 	// Create chunks for uncovered regions (imports, top-level code, etc.)
-	c.fillGaps(content, path, config, covered, &chunks)
+	if !c.SkipGaps {
+		c.fillGaps(content, path, config, covered, &chunks)
+	}
 
 	// Sort by start position
 	sortChunks(chunks)
 
+	chunks = splitLargeChunks(chunks, c.SubChunkLines)
+	chunks = splitByTokens(chunks, c.TokenEstimator, c.MaxTokens)
+
+	if c.StripComments {
+		stripComments(root, content, config, chunks)
+	}
+
+	if c.NeighborContext {
+		addNeighborContext(chunks)
+	}
+
 	// Compute hashes for all chunks
 	for i := range chunks {
 		chunks[i].ComputeHash()
@@ -83,37 +185,150 @@ func (c *ASTChunker) ChunkFile(ctx context.Context, path string, content []byte)
 	return chunks, nil
 }
 
+// effectiveConfig returns config with the chunker's maximum chunk size
+// and SplitNodes for its language applied. A language without a maximum
+// chunk size of its own gets DefaultMaxChunkSize.
+func (c *ASTChunker) effectiveConfig(config *LanguageConfig) *LanguageConfig {
+	nodes, replaced := c.SplitNodes[config.Name]
+	maxSize := c.MaxChunkSizes[config.Name]
+	if maxSize <= 0 {
+		maxSize = c.MaxChunkSize
+	}
+	if maxSize <= 0 && config.MaxChunkSize <= 0 {
+		maxSize = DefaultMaxChunkSize
+	}
+	if maxSize <= 0 && !replaced {
+		return config
+	}
+	effective := *config
+	if maxSize > 0 {
+		effective.MaxChunkSize = maxSize
+	}
+	if replaced {
+		effective.SplitNodes = nodes
+	}
+	return &effective
+}
+
 // walkTree recursively traverses the AST and creates chunks for split nodes.
-func (c *ASTChunker) walkTree(node *sitter.Node, content []byte, path string, config *LanguageConfig, splitNodes map[string]bool, chunks *[]Chunk, covered map[int]bool) {
+// scope holds the names qualifying symbols at node, see Chunk.QualifiedName,
+// and depth is node's depth in the tree.
+func (c *ASTChunker) walkTree(node *sitter.Node, content []byte, path string, config *LanguageConfig, splitNodes map[string]bool, scope []string, depth int, chunks *[]Chunk, covered map[int]bool) error {
+	if depth > MaxTreeDepth {
+		return fmt.Errorf("%w: syntax tree nested deeper than %d levels", ErrUnparseable, MaxTreeDepth)
+	}
 	nodeType := node.Type()
+	childScope := innerScope(node, content, config, scope)
 
 	if splitNodes[nodeType] {
-		chunk := c.nodeToChunk(node, content, path, config)
-		if chunk.LineCount() > 0 {
-			*chunks = append(*chunks, chunk)
+		return c.chunkNode(node, content, path, config, splitNodes, scope, childScope, depth, chunks, covered)
+	}
 
-			// Mark bytes as covered
-			for i := int(node.StartByte()); i < int(node.EndByte()); i++ {
-				covered[i] = true
-			}
+	// Recurse into children for non-split nodes
+	for i := 0; i < int(node.ChildCount()); i++ {
+		child := node.Child(i)
+		if err := c.walkTree(child, content, path, config, splitNodes, childScope, depth+1, chunks, covered); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chunkNode creates the chunks of node, which walkTree or walkNested chose
+// to chunk. scope qualifies node's name and childScope its children's.
+func (c *ASTChunker) chunkNode(node *sitter.Node, content []byte, path string, config *LanguageConfig, splitNodes map[string]bool, scope, childScope []string, depth int, chunks *[]Chunk, covered map[int]bool) error {
+	chunk := c.nodeToChunk(node, content, path, config)
+	chunk.QualifiedName = qualifiedName(node, content, config, scope, chunk.NodeName)
+	if c.IncludeLeadingComments {
+		if lead := leadingNode(node, config, c.LeadingCommentGap); lead != nil {
+			chunk = withLeading(chunk, lead, content)
 		}
+	}
+	if c.SplitOversized && len(chunk.Content) > config.MaxChunkSize {
+		return c.splitOversized(node, chunk, content, path, config, splitNodes, childScope, depth, chunks, covered)
+	}
+	if chunk.LineCount() > 0 {
+		*chunks = append(*chunks, chunk)
 
-		// If chunk is too large, recursively chunk children
-		// This handles nested structures like methods inside classes
-		if len(chunk.Content) > config.MaxChunkSize {
-			for i := 0; i < int(node.ChildCount()); i++ {
-				child := node.Child(i)
-				c.walkTree(child, content, path, config, splitNodes, chunks, covered)
+		// Mark bytes as covered, leading comments included
+		for i := chunk.StartByte; i < chunk.EndByte; i++ {
+			covered[i] = true
+		}
+	}
+
+	// If chunk is too large, recursively chunk children
+	// This handles nested structures like methods inside classes
+	if len(chunk.Content) > config.MaxChunkSize {
+		for i := 0; i < int(node.ChildCount()); i++ {
+			child := node.Child(i)
+			if err := c.walkTree(child, content, path, config, splitNodes, childScope, depth+1, chunks, covered); err != nil {
+				return err
+			}
+		}
+	} else if slices.Contains(c.SplitNestedFunctions, config.Name) {
+		inFunction := slices.Contains(config.FunctionNodes, node.Type())
+		for i := 0; i < int(node.ChildCount()); i++ {
+			if err := c.walkNested(node.Child(i), content, path, config, splitNodes, childScope, inFunction, depth+1, chunks, covered); err != nil {
+				return err
 			}
 		}
-		return
 	}
+	return nil
+}
 
-	// Recurse into children for non-split nodes
+// walkNested looks inside a chunk kept whole for named functions nested in
+// other functions, and chunks them (see SplitNestedFunctions). inFunction
+// is set below a function node.
+func (c *ASTChunker) walkNested(node *sitter.Node, content []byte, path string, config *LanguageConfig, splitNodes map[string]bool, scope []string, inFunction bool, depth int, chunks *[]Chunk, covered map[int]bool) error {
+	if depth > MaxTreeDepth {
+		return fmt.Errorf("%w: syntax tree nested deeper than %d levels", ErrUnparseable, MaxTreeDepth)
+	}
+	childScope := innerScope(node, content, config, scope)
+	if slices.Contains(config.FunctionNodes, node.Type()) {
+		if inFunction && hasNameField(node, config) {
+			return c.chunkNode(node, content, path, config, splitNodes, scope, childScope, depth, chunks, covered)
+		}
+		inFunction = true
+	}
 	for i := 0; i < int(node.ChildCount()); i++ {
-		child := node.Child(i)
-		c.walkTree(child, content, path, config, splitNodes, chunks, covered)
+		if err := c.walkNested(node.Child(i), content, path, config, splitNodes, childScope, inFunction, depth+1, chunks, covered); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasNameField reports whether node has one of config's name fields, which
+// unlike extractNodeName does not mistake an arrow function's parameter
+// for its name.
+func hasNameField(node *sitter.Node, config *LanguageConfig) bool {
+	for _, field := range config.NameFields {
+		if node.ChildByFieldName(field) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// splitOversized chunks node, too large for chunk to be emitted whole, by
+// the split nodes inside it, leaving the rest of it to gap chunks, or if
+// it has none by oversizedParts.
+func (c *ASTChunker) splitOversized(node *sitter.Node, chunk Chunk, content []byte, path string, config *LanguageConfig, splitNodes map[string]bool, scope []string, depth int, chunks *[]Chunk, covered map[int]bool) error {
+	before := len(*chunks)
+	for i := 0; i < int(node.ChildCount()); i++ {
+		if err := c.walkTree(node.Child(i), content, path, config, splitNodes, scope, depth+1, chunks, covered); err != nil {
+			return err
+		}
+	}
+	if len(*chunks) > before {
+		return nil
+	}
+
+	*chunks = append(*chunks, oversizedParts(node, chunk, config.MaxChunkSize)...)
+	for i := chunk.StartByte; i < chunk.EndByte; i++ {
+		covered[i] = true
 	}
+	return nil
 }
 
 // nodeToChunk converts an AST node to a Chunk.
@@ -155,11 +370,22 @@ func (c *ASTChunker) extractNodeName(node *sitter.Node, content []byte, config *
 	// Try to find an identifier child for common patterns
 	for i := 0; i < int(node.ChildCount()); i++ {
 		child := node.Child(i)
-		if child.Type() == "identifier" || child.Type() == "property_identifier" {
+		if child.Type() == "identifier" || child.Type() == "property_identifier" || slices.Contains(config.NameNodes, child.Type()) {
 			return string(content[child.StartByte():child.EndByte()])
 		}
 	}
 
+	// Declarations that wrap a spec (Go's type_declaration -> type_spec)
+	// carry the name one level down
+	for i := 0; i < int(node.NamedChildCount()); i++ {
+		child := node.NamedChild(i)
+		for _, field := range config.NameFields {
+			if nameNode := child.ChildByFieldName(field); nameNode != nil {
+				return string(content[nameNode.StartByte():nameNode.EndByte()])
+			}
+		}
+	}
+
 	return ""
 }
 
@@ -313,6 +539,18 @@ type ChunkOptions struct {
 	ComputeHashes    bool // Compute content hashes
 	FallbackChunkSize int // Lines per chunk in fallback mode
 	FallbackOverlap   int // Overlap lines in fallback mode
+	StripComments     bool // Set EmbedContent with comment nodes removed
+	SubChunkLines     int  // Split larger nodes into sub-chunks of about this many lines (0 = off)
+	NeighborContext   bool // Set NeighborContext to the adjacent chunks' signatures
+
+	IncludeLeadingComments bool // Extend chunks over the comments and decorators before them
+	LeadingCommentGap      int  // Blank lines allowed between those comments and the node
+	SplitOversized         bool // Emit nodes over MaxChunkSize only as parts (see ASTChunker)
+
+	MaxTokens      int            // Split chunks estimated at more tokens into parts (0 = off)
+	TokenEstimator TokenEstimator // Estimates tokens for MaxTokens (nil = HeuristicEstimator)
+
+	SplitNestedFunctions []string // Languages whose named nested functions are always chunks (see ASTChunker)
 }
 
 // DefaultChunkOptions returns the default chunking options.
@@ -327,14 +565,18 @@ func DefaultChunkOptions() ChunkOptions {
 	}
 }
 
-// ChunkFileWithOptions parses a file with custom options.
-func (c *ASTChunker) ChunkFileWithOptions(ctx context.Context, path string, content []byte, opts ChunkOptions) ([]Chunk, error) {
-	config := GetLanguageConfig(path)
+// ChunkFileWithOptions parses a file with custom options. Like ChunkFile,
+// it returns an error wrapping ErrUnparseable for files it cannot walk.
+func (c *ASTChunker) ChunkFileWithOptions(ctx context.Context, path string, content []byte, opts ChunkOptions) (_ []Chunk, err error) {
+	defer recoverPanic(&err)
+
+	config := ResolveLanguageConfig(path, c.LanguageOverrides)
 	if config == nil {
 		if !opts.FallbackEnabled {
 			return nil, nil
 		}
-		return c.fallbackChunkWithOptions(path, content, opts), nil
+		chunks := c.fallbackChunkWithOptions(path, content, opts)
+		return splitHashedByTokens(chunks, opts.TokenEstimator, opts.MaxTokens, opts.ComputeHashes), nil
 	}
 
 	// Override max chunk size if specified
@@ -364,7 +606,14 @@ func (c *ASTChunker) ChunkFileWithOptions(ctx context.Context, path string, cont
 	var chunks []Chunk
 	covered := make(map[int]bool)
 
-	c.walkTree(root, content, path, &effectiveConfig, splitNodeSet, &chunks, covered)
+	walker := *c
+	walker.IncludeLeadingComments = opts.IncludeLeadingComments
+	walker.LeadingCommentGap = opts.LeadingCommentGap
+	walker.SplitOversized = opts.SplitOversized
+	walker.SplitNestedFunctions = opts.SplitNestedFunctions
+	if err := walker.walkTree(root, content, path, &effectiveConfig, splitNodeSet, packageScope(root, content, &effectiveConfig), 0, &chunks, covered); err != nil {
+		return nil, err
+	}
 
 	if opts.IncludeGaps {
 		c.fillGaps(content, path, &effectiveConfig, covered, &chunks)
@@ -372,6 +621,17 @@ func (c *ASTChunker) ChunkFileWithOptions(ctx context.Context, path string, cont
 
 	sortChunks(chunks)
 
+	chunks = splitLargeChunks(chunks, opts.SubChunkLines)
+	chunks = splitByTokens(chunks, opts.TokenEstimator, opts.MaxTokens)
+
+	if opts.StripComments {
+		stripComments(root, content, &effectiveConfig, chunks)
+	}
+
+	if opts.NeighborContext {
+		addNeighborContext(chunks)
+	}
+
 	if opts.ComputeHashes {
 		for i := range chunks {
 			chunks[i].ComputeHash()
@@ -1,10 +1,22 @@
 package chunker
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 )
 
+// Chunker splits a file into chunks. ASTChunker is the default; other
+// implementations can try alternate strategies, such as fixed-size or
+// model-assisted chunking, without changing the indexer. Implementations
+// should return an error wrapping ErrUnparseable for a file they cannot
+// chunk, so the caller skips it rather than failing.
+type Chunker interface {
+	ChunkFile(ctx context.Context, path string, content []byte) ([]Chunk, error)
+}
+
+var _ Chunker = (*ASTChunker)(nil)
+
 // Chunk represents a semantic unit of code extracted from a source file.
 // It contains positional information, content, and metadata about the
 // AST node it was extracted from.
@@ -19,6 +31,24 @@ type Chunk struct {
 	NodeType    string `json:"node_type"`    // AST node type (e.g., "function_declaration")
 	NodeName    string `json:"node_name"`    // Symbol name if applicable (e.g., function name)
 	Language    string `json:"language"`     // Language identifier
+
+	// EmbedContent is the text sent to the embedder when it differs from
+	// Content (e.g. with comments stripped). Empty means use Content.
+	EmbedContent string `json:"embed_content,omitempty"`
+
+	// NeighborContext summarizes the neighboring chunks (their signatures)
+	// for the embedder. It is not part of Content or ContentHash.
+	NeighborContext string `json:"neighbor_context,omitempty"`
+
+	// QualifiedName is NodeName prefixed with the file's package and the
+	// names of the enclosing classes, modules or receiver type, joined by
+	// dots (e.g. "auth.Middleware.Handle"). Empty for unnamed chunks.
+	QualifiedName string `json:"qualified_name,omitempty"`
+
+	// PartIndex numbers, from 1, the parts a node too large for one chunk
+	// was split into; each part keeps the node's NodeType and NodeName.
+	// 0 for chunks holding a whole node.
+	PartIndex int `json:"part_index,omitempty"`
 }
 
 // ComputeHash calculates and sets the content hash using SHA-256.
@@ -42,3 +72,12 @@ func (c *Chunk) ByteCount() int {
 func (c *Chunk) IsEmpty() bool {
 	return len(c.Content) == 0
 }
+
+// EmbeddingInput returns the text that should be sent to the embedder:
+// EmbedContent if set, otherwise Content.
+func (c *Chunk) EmbeddingInput() string {
+	if c.EmbedContent != "" {
+		return c.EmbedContent
+	}
+	return c.Content
+}
@@ -2,6 +2,11 @@ package chunker
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -656,6 +661,167 @@ end
 	}
 }
 
+// chunkNames returns the NodeName of each chunk of the given node type.
+func chunkNames(chunks []Chunk, nodeType string) []string {
+	var names []string
+	for _, c := range chunks {
+		if c.NodeType == nodeType {
+			names = append(names, c.NodeName)
+		}
+	}
+	return names
+}
+
+func TestChunkKotlinFile(t *testing.T) {
+	content := `package com.example
+
+import kotlin.math.max
+
+class Greeter(val name: String) {
+    fun greet(): String = "Hello, $name"
+}
+
+object Registry {
+    fun lookup(id: Int): Greeter? = null
+}
+
+fun String.shout(): String = uppercase()
+
+fun main() {
+    println(Greeter("world").greet())
+}
+`
+	chunks, err := NewASTChunker().ChunkFile(context.Background(), "Foo.kt", []byte(content))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+
+	if got := chunkNames(chunks, "class_declaration"); !reflect.DeepEqual(got, []string{"Greeter"}) {
+		t.Errorf("class chunks = %q, want [Greeter]", got)
+	}
+	if got := chunkNames(chunks, "object_declaration"); !reflect.DeepEqual(got, []string{"Registry"}) {
+		t.Errorf("object chunks = %q, want [Registry]", got)
+	}
+	if got := chunkNames(chunks, "function_declaration"); !reflect.DeepEqual(got, []string{"shout", "main"}) {
+		t.Errorf("function chunks = %q, want [shout main]", got)
+	}
+	for _, c := range chunks {
+		if c.NodeType != "gap" && c.Language != "kotlin" {
+			t.Errorf("expected language 'kotlin', got '%s'", c.Language)
+		}
+	}
+}
+
+func TestChunkSwiftFile(t *testing.T) {
+	content := `import Foundation
+
+protocol Greeting {
+    func greet() -> String
+}
+
+struct Greeter: Greeting {
+    let name: String
+
+    func greet() -> String {
+        return "Hello, \(name)"
+    }
+}
+
+func main() {
+    print(Greeter(name: "world").greet())
+}
+`
+	chunks, err := NewASTChunker().ChunkFile(context.Background(), "main.swift", []byte(content))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+
+	if got := chunkNames(chunks, "protocol_declaration"); !reflect.DeepEqual(got, []string{"Greeting"}) {
+		t.Errorf("protocol chunks = %q, want [Greeting]", got)
+	}
+	if got := chunkNames(chunks, "class_declaration"); !reflect.DeepEqual(got, []string{"Greeter"}) {
+		t.Errorf("struct chunks = %q, want [Greeter]", got)
+	}
+	if got := chunkNames(chunks, "function_declaration"); !reflect.DeepEqual(got, []string{"main"}) {
+		t.Errorf("function chunks = %q, want [main]", got)
+	}
+}
+
+func TestChunkScalaFile(t *testing.T) {
+	content := `package com.example
+
+trait Greeting {
+  def greet(): String
+}
+
+class Greeter(name: String) extends Greeting {
+  def greet(): String = s"Hello, $name"
+}
+
+object Main {
+  def main(args: Array[String]): Unit = println(new Greeter("world").greet())
+}
+`
+	chunks, err := NewASTChunker().ChunkFile(context.Background(), "Main.scala", []byte(content))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+
+	for nodeType, want := range map[string][]string{
+		"trait_definition":  {"Greeting"},
+		"class_definition":  {"Greeter"},
+		"object_definition": {"Main"},
+	} {
+		if got := chunkNames(chunks, nodeType); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s chunks = %q, want %q", nodeType, got, want)
+		}
+	}
+}
+
+func TestChunkCSharpFile(t *testing.T) {
+	content := `using System;
+
+namespace Example
+{
+    public interface IGreeter
+    {
+        string Greet();
+    }
+
+    public class Greeter : IGreeter
+    {
+        private readonly string name;
+
+        public Greeter(string name)
+        {
+            this.name = name;
+        }
+
+        public string Greet()
+        {
+            return $"Hello, {name}";
+        }
+    }
+
+    public enum Mood { Happy, Sad }
+}
+`
+	chunks, err := NewASTChunker().ChunkFile(context.Background(), "Greeter.cs", []byte(content))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+
+	for nodeType, want := range map[string][]string{
+		"interface_declaration": {"IGreeter"},
+		"class_declaration":     {"Greeter"},
+		"enum_declaration":      {"Mood"},
+	} {
+		if got := chunkNames(chunks, nodeType); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s chunks = %q, want %q", nodeType, got, want)
+		}
+	}
+}
+
 // =============================================================================
 // Symbol Name Extraction Tests
 // =============================================================================
@@ -706,6 +872,187 @@ func TestChunkExtractsClassNames(t *testing.T) {
 	}
 }
 
+func TestChunkerOptionFields(t *testing.T) {
+	content := `package shapes
+
+import (
+	"fmt"
+	"math"
+)
+
+var unit = 1.0
+
+type Circle struct {
+	R float64
+}
+
+func (c Circle) Area() float64 {
+	return math.Pi * c.R * c.R
+}
+
+func Describe(c Circle) string {
+	return fmt.Sprintf("circle of radius %v", c.R)
+}
+`
+	ctx := context.Background()
+
+	plain, err := NewASTChunker().ChunkFile(ctx, "shapes.go", []byte(content))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+	if len(filterChunks(plain, func(c Chunk) bool { return c.NodeType == "gap" })) == 0 {
+		t.Fatal("expected a gap chunk for the imports by default")
+	}
+
+	c := NewASTChunker()
+	c.SkipGaps = true
+	c.SplitNodes = map[string][]string{"go": {"function_declaration"}}
+	chunks, err := c.ChunkFile(ctx, "shapes.go", []byte(content))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+	var types []string
+	for _, chunk := range chunks {
+		types = append(types, chunk.NodeType+" "+chunk.NodeName)
+	}
+	if want := []string{"function_declaration Describe"}; !reflect.DeepEqual(types, want) {
+		t.Errorf("chunks = %q, want %q", types, want)
+	}
+
+	// A small MaxChunkSize splits a type's declaration into its children
+	c = NewASTChunker()
+	c.MaxChunkSize = 10
+	c.SplitNodes = map[string][]string{"go": {"type_declaration", "field_declaration"}}
+	chunks, err = c.ChunkFile(ctx, "shapes.go", []byte(content))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+	if len(filterChunks(chunks, func(c Chunk) bool { return c.NodeType == "field_declaration" })) != 1 {
+		t.Errorf("expected the struct's field in its own chunk with MaxChunkSize 10")
+	}
+}
+
+func TestLeadingComments(t *testing.T) {
+	content := `package shapes
+
+// Area returns the area of a circle
+// of radius r, using math.Pi for
+// the constant.
+func Area(r float64) float64 {
+	return 3.14159 * r * r
+}
+
+// Perimeter is separated from this comment by a blank line.
+
+func Perimeter(r float64) float64 {
+	return 2 * 3.14159 * r // approximate
+}
+// Diameter directly follows Perimeter.
+func Diameter(r float64) float64 {
+	return 2 * r
+}
+`
+	ctx := context.Background()
+
+	plain, err := NewASTChunker().ChunkFile(ctx, "shapes.go", []byte(content))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+	if len(filterChunks(plain, func(c Chunk) bool { return c.NodeType == "gap" })) == 0 {
+		t.Fatal("expected the doc comment in a gap chunk by default")
+	}
+
+	c := NewASTChunker()
+	c.IncludeLeadingComments = true
+	chunks, err := c.ChunkFile(ctx, "shapes.go", []byte(content))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+	byName := make(map[string]Chunk)
+	for _, chunk := range chunks {
+		if chunk.NodeType == "gap" && strings.Contains(chunk.Content, "Area returns") {
+			t.Errorf("doc comment attached to Area also in a gap chunk: %q", chunk.Content)
+		}
+		byName[chunk.NodeName] = chunk
+	}
+
+	area := byName["Area"]
+	if area.StartLine != 3 || !strings.HasPrefix(area.Content, "// Area returns") {
+		t.Errorf("Area starts at line %d with %q, want its doc comment from line 3", area.StartLine, area.Content)
+	}
+	if got := content[area.StartByte:area.EndByte]; got != area.Content {
+		t.Errorf("Area bytes %d-%d = %q, want its content", area.StartByte, area.EndByte, got)
+	}
+	if p := byName["Perimeter"]; strings.HasPrefix(p.Content, "//") {
+		t.Errorf("Perimeter took a comment separated by a blank line: %q", p.Content)
+	}
+	if d := byName["Diameter"]; d.StartLine != 15 {
+		t.Errorf("Diameter starts at line %d, want 15 with its comment", d.StartLine)
+	}
+
+	// A gap of one blank line is allowed through ChunkOptions
+	opts := DefaultChunkOptions()
+	opts.IncludeLeadingComments = true
+	opts.LeadingCommentGap = 1
+	chunks, err = NewASTChunker().ChunkFileWithOptions(ctx, "shapes.go", []byte(content), opts)
+	if err != nil {
+		t.Fatalf("ChunkFileWithOptions failed: %v", err)
+	}
+	for _, chunk := range chunks {
+		if chunk.NodeName == "Perimeter" && chunk.StartLine != 10 {
+			t.Errorf("Perimeter starts at line %d, want 10 with LeadingCommentGap 1", chunk.StartLine)
+		}
+	}
+}
+
+func TestLeadingCommentsTrailingComment(t *testing.T) {
+	content := `package shapes
+
+var scale = 2 // doubled
+
+func Scale(r float64) float64 {
+	return r * float64(scale)
+}
+`
+	c := NewASTChunker()
+	c.IncludeLeadingComments = true
+	c.LeadingCommentGap = 1
+	chunks, err := c.ChunkFile(context.Background(), "shapes.go", []byte(content))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+	for _, chunk := range chunks {
+		if chunk.NodeName == "Scale" && chunk.StartLine != 5 {
+			t.Errorf("Scale starts at line %d, want 5 without the trailing comment", chunk.StartLine)
+		}
+	}
+}
+
+func TestLeadingDecorators(t *testing.T) {
+	content := `class Service {
+  /** Loads a user by id. */
+  @Cached()
+  load(id: string) {
+    return this.db.get(id);
+  }
+}
+`
+	c := NewASTChunker()
+	c.IncludeLeadingComments = true
+	c.MaxChunkSize = 20 // Split the class into its methods
+	chunks, err := c.ChunkFile(context.Background(), "service.ts", []byte(content))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+	methods := filterChunks(chunks, func(c Chunk) bool { return c.NodeType == "method_definition" })
+	if len(methods) != 1 {
+		t.Fatalf("expected 1 method chunk, got %d", len(methods))
+	}
+	if m := methods[0]; m.StartLine != 2 || !strings.Contains(m.Content, "@Cached()") {
+		t.Errorf("load starts at line %d with %q, want its JSDoc and decorator", m.StartLine, m.Content)
+	}
+}
+
 // =============================================================================
 // Fallback Tests
 // =============================================================================
@@ -859,6 +1206,7 @@ func TestGapChunksCreated(t *testing.T) {
 	content := `package main
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 )
@@ -962,6 +1310,12 @@ func TestGetLanguageConfig(t *testing.T) {
 		{"test.hpp", "cpp"},
 		{"test.hxx", "cpp"},
 		{"test.rb", "ruby"},
+		{"Test.kt", "kotlin"},
+		{"build.gradle.kts", "kotlin"},
+		{"Test.swift", "swift"},
+		{"Test.scala", "scala"},
+		{"script.sc", "scala"},
+		{"Test.cs", "csharp"},
 	}
 
 	for _, tt := range tests {
@@ -1022,6 +1376,96 @@ func TestIsSupported(t *testing.T) {
 	}
 }
 
+// =============================================================================
+// Language Override Tests
+// =============================================================================
+
+const phpSource = `<?php
+// Greets people.
+function greet($name) {
+    return "Hello, " . $name;
+}
+
+class Greeter {
+    public function hello() {
+        return greet("world");
+    }
+}
+`
+
+func TestLanguageOverrideInc(t *testing.T) {
+	chunker := NewASTChunker()
+	chunker.LanguageOverrides = []LanguageOverride{{Pattern: ".inc", Language: "php"}}
+
+	chunks, err := chunker.ChunkFile(context.Background(), "lib/helpers.inc", []byte(phpSource))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+
+	funcChunks := filterChunks(chunks, func(c Chunk) bool {
+		return c.NodeType == "function_definition" && c.NodeName == "greet"
+	})
+	if len(funcChunks) != 1 {
+		t.Errorf("expected 1 function chunk named greet, got %d", len(funcChunks))
+	}
+
+	classChunks := filterChunks(chunks, func(c Chunk) bool {
+		return c.NodeType == "class_declaration" && c.NodeName == "Greeter"
+	})
+	if len(classChunks) != 1 {
+		t.Errorf("expected 1 class chunk named Greeter, got %d", len(classChunks))
+	}
+
+	for _, c := range chunks {
+		if c.Language != "php" {
+			t.Errorf("expected language 'php', got '%s'", c.Language)
+		}
+	}
+
+	// Without the override the file is not recognized
+	chunks, err = NewASTChunker().ChunkFile(context.Background(), "lib/helpers.inc", []byte(phpSource))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+	for _, c := range chunks {
+		if c.Language == "php" {
+			t.Error("expected .inc to fall back without an override")
+		}
+	}
+}
+
+func TestResolveLanguageConfig(t *testing.T) {
+	overrides := []LanguageOverride{
+		{Pattern: ".INC", Language: "php"},
+		{Pattern: "*.tmpl", Language: "go"},
+		{Pattern: "views/*.html", Language: "javascript"},
+		{Pattern: ".py", Language: "cobol"}, // Unsupported, ignored
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"a/b/config.inc", "php"},
+		{"templates/page.tmpl", "go"},
+		{"views/index.html", "javascript"},
+		{"other/index.html", ""},
+		{"main.py", "python"},
+		{"main.go", "go"},
+	}
+
+	for _, tt := range tests {
+		config := ResolveLanguageConfig(tt.path, overrides)
+		got := ""
+		if config != nil {
+			got = config.Name
+		}
+		if got != tt.want {
+			t.Errorf("ResolveLanguageConfig(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
 // =============================================================================
 // Options Tests
 // =============================================================================
@@ -1265,3 +1709,911 @@ func BenchmarkFallbackChunk(b *testing.B) {
 		_, _ = chunker.ChunkFile(context.Background(), "test.xyz", content)
 	}
 }
+
+// =============================================================================
+// Comment Stripping Tests
+// =============================================================================
+
+const commentHeavyGo = `// Copyright 2024 Example Corp.
+// Licensed under the Apache License, Version 2.0.
+// You may not use this file except in compliance with the License.
+package main
+
+import "fmt"
+
+func process(items []string) int {
+	// Count every item
+	count := 0
+	for _, item := range items { // iterate
+		/* print it */
+		fmt.Println(item)
+		count++
+	}
+	return count
+}
+`
+
+func TestStripCommentsEmbeddingInput(t *testing.T) {
+	plain := NewASTChunker()
+	plainChunks, err := plain.ChunkFile(context.Background(), "main.go", []byte(commentHeavyGo))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+
+	stripping := NewASTChunker()
+	stripping.StripComments = true
+	chunks, err := stripping.ChunkFile(context.Background(), "main.go", []byte(commentHeavyGo))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+
+	if len(chunks) != len(plainChunks) {
+		t.Fatalf("got %d chunks with stripping, %d without", len(chunks), len(plainChunks))
+	}
+
+	for i, c := range chunks {
+		// Stored content and hash are unchanged
+		if c.Content != plainChunks[i].Content {
+			t.Errorf("chunk %d: Content changed by comment stripping", i)
+		}
+		if c.ContentHash != plainChunks[i].ContentHash {
+			t.Errorf("chunk %d: ContentHash changed by comment stripping", i)
+		}
+		if plainChunks[i].EmbedContent != "" {
+			t.Errorf("chunk %d: EmbedContent set without StripComments", i)
+		}
+	}
+
+	funcs := filterChunks(chunks, func(c Chunk) bool { return c.NodeName == "process" })
+	if len(funcs) != 1 {
+		t.Fatalf("expected 1 process chunk, got %d", len(funcs))
+	}
+	input := funcs[0].EmbeddingInput()
+	for _, comment := range []string{"Count every item", "iterate", "print it", "//", "/*"} {
+		if strings.Contains(input, comment) {
+			t.Errorf("embedding input still contains %q:\n%s", comment, input)
+		}
+	}
+	for _, code := range []string{"func process", "count := 0", "fmt.Println(item)", "return count"} {
+		if !strings.Contains(input, code) {
+			t.Errorf("embedding input missing code %q:\n%s", code, input)
+		}
+	}
+
+	gaps := filterChunks(chunks, func(c Chunk) bool { return c.NodeType == "gap" })
+	if len(gaps) == 0 {
+		t.Fatal("expected a gap chunk for the header")
+	}
+	if strings.Contains(gaps[0].EmbeddingInput(), "Apache License") {
+		t.Errorf("license header not stripped from embedding input:\n%s", gaps[0].EmbeddingInput())
+	}
+	if !strings.Contains(gaps[0].Content, "Apache License") {
+		t.Error("license header missing from stored content")
+	}
+}
+
+func TestStripCommentsNoComments(t *testing.T) {
+	content := `package main
+
+func add(a, b int) int {
+	return a + b
+}
+`
+	chunker := NewASTChunker()
+	chunker.StripComments = true
+	chunks, err := chunker.ChunkFile(context.Background(), "main.go", []byte(content))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+
+	for _, c := range chunks {
+		if c.EmbedContent != "" {
+			t.Errorf("EmbedContent = %q, want empty for comment-free chunk", c.EmbedContent)
+		}
+		if c.EmbeddingInput() != c.Content {
+			t.Error("EmbeddingInput() should equal Content when nothing was stripped")
+		}
+	}
+}
+
+func TestStripCommentsKeepsBlankLines(t *testing.T) {
+	content := `package main
+
+func setup() int {
+	a := 1
+
+	// Only comments on this line
+	b := 2 // trailing
+
+	return a + b
+}
+`
+	chunker := NewASTChunker()
+	chunker.StripComments = true
+	chunks, err := chunker.ChunkFile(context.Background(), "main.go", []byte(content))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+
+	funcs := filterChunks(chunks, func(c Chunk) bool { return c.NodeName == "setup" })
+	if len(funcs) != 1 {
+		t.Fatalf("expected 1 setup chunk, got %d", len(funcs))
+	}
+	want := "func setup() int {\n\ta := 1\n\n\tb := 2\n\n\treturn a + b\n}"
+	if got := funcs[0].EmbeddingInput(); got != want {
+		t.Errorf("embedding input = %q, want %q", got, want)
+	}
+}
+
+func TestStripCommentsWithOptionsPython(t *testing.T) {
+	content := `# Module header comment
+# spanning several lines
+# for licensing
+
+def greet(name):
+    # say hello
+    return "hello " + name
+`
+	opts := DefaultChunkOptions()
+	opts.StripComments = true
+
+	chunker := NewASTChunker()
+	chunks, err := chunker.ChunkFileWithOptions(context.Background(), "greet.py", []byte(content), opts)
+	if err != nil {
+		t.Fatalf("ChunkFileWithOptions failed: %v", err)
+	}
+
+	funcs := filterChunks(chunks, func(c Chunk) bool { return c.NodeName == "greet" })
+	if len(funcs) != 1 {
+		t.Fatalf("expected 1 greet chunk, got %d", len(funcs))
+	}
+	if strings.Contains(funcs[0].EmbeddingInput(), "say hello") {
+		t.Errorf("comment not stripped:\n%s", funcs[0].EmbeddingInput())
+	}
+	if !strings.Contains(funcs[0].Content, "say hello") {
+		t.Error("comment missing from stored content")
+	}
+}
+
+// =============================================================================
+// Sub-chunk Tests
+// =============================================================================
+
+// largeGoFunction returns a Go file with one function of n statements,
+// each on its own line. edit, if set, may rewrite statement i.
+func largeGoFunction(n int, edit func(i int, line string) string) string {
+	var b strings.Builder
+	b.WriteString("package big\n\nfunc process(xs []int) int {\n\ttotal := 0\n")
+	for i := 0; i < n; i++ {
+		line := "\ttotal += xs[" + strconv.Itoa(i) + "] * " + strconv.Itoa(i*7+3) + "\n"
+		if edit != nil {
+			line = edit(i, line)
+		}
+		b.WriteString(line)
+	}
+	b.WriteString("\treturn total\n}\n")
+	return b.String()
+}
+
+func chunkHashes(t *testing.T, chunker *ASTChunker, content string) map[string]Chunk {
+	t.Helper()
+	chunks, err := chunker.ChunkFile(context.Background(), "big.go", []byte(content))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+	hashes := make(map[string]Chunk, len(chunks))
+	for _, c := range chunks {
+		hashes[c.ContentHash] = c
+	}
+	return hashes
+}
+
+func TestSubChunkLargeFunction(t *testing.T) {
+	chunker := NewASTChunker()
+	chunker.SubChunkLines = 20
+
+	content := largeGoFunction(200, nil)
+	chunks, err := chunker.ChunkFile(context.Background(), "big.go", []byte(content))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+
+	parts := filterChunks(chunks, func(c Chunk) bool { return c.NodeName == "process" })
+	if len(parts) < 4 {
+		t.Fatalf("expected large function split into several sub-chunks, got %d", len(parts))
+	}
+
+	// Sub-chunks tile the function without gaps and keep exact byte ranges
+	for i, p := range parts {
+		if p.LineCount() > 40 {
+			t.Errorf("sub-chunk %d has %d lines, want <= 40", i, p.LineCount())
+		}
+		if content[p.StartByte:p.EndByte] != p.Content && content[p.StartByte:p.EndByte] != p.Content+"\n" {
+			t.Errorf("sub-chunk %d byte range does not match its content", i)
+		}
+		if i > 0 && p.StartLine != parts[i-1].EndLine+1 {
+			t.Errorf("sub-chunk %d starts at line %d, want %d", i, p.StartLine, parts[i-1].EndLine+1)
+		}
+	}
+
+	// Disabled by default
+	whole, err := NewASTChunker().ChunkFile(context.Background(), "big.go", []byte(content))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+	if n := len(filterChunks(whole, func(c Chunk) bool { return c.NodeName == "process" })); n != 1 {
+		t.Errorf("expected 1 chunk without sub-chunking, got %d", n)
+	}
+}
+
+func TestSubChunkEditMissesOnlyAffectedPart(t *testing.T) {
+	chunker := NewASTChunker()
+	chunker.SubChunkLines = 20
+
+	before := chunkHashes(t, chunker, largeGoFunction(200, nil))
+
+	// Change a few adjacent lines in the middle of the function
+	edited := largeGoFunction(200, func(i int, line string) string {
+		if i >= 100 && i < 103 {
+			return "\ttotal -= xs[" + strconv.Itoa(i) + "]\n"
+		}
+		return line
+	})
+	after := chunkHashes(t, chunker, edited)
+
+	var misses []Chunk
+	for hash, c := range after {
+		if _, ok := before[hash]; !ok {
+			misses = append(misses, c)
+		}
+	}
+	if len(misses) != 1 {
+		t.Fatalf("expected 1 cache miss, got %d", len(misses))
+	}
+	if misses[0].StartLine > 104 || misses[0].EndLine < 106 {
+		t.Errorf("missed sub-chunk spans lines %d-%d, want it to cover the edit at 104-106",
+			misses[0].StartLine, misses[0].EndLine)
+	}
+
+	// Inserting a line only disturbs the neighboring boundary
+	inserted := largeGoFunction(200, func(i int, line string) string {
+		if i == 50 {
+			return "\ttotal++\n" + line
+		}
+		return line
+	})
+	after = chunkHashes(t, chunker, inserted)
+	missCount := 0
+	for hash := range after {
+		if _, ok := before[hash]; !ok {
+			missCount++
+		}
+	}
+	if missCount > 2 {
+		t.Errorf("insertion caused %d cache misses, want <= 2", missCount)
+	}
+}
+
+func TestSplitOversizedFunction(t *testing.T) {
+	// A 402-line function of three-line statements
+	var b strings.Builder
+	b.WriteString("package big\n\nfunc clamp(v int) int {\n")
+	for i := 0; i < 133; i++ {
+		fmt.Fprintf(&b, "\tif v > %d {\n\t\tv -= %d\n\t}\n", 1000-i, i+1)
+	}
+	b.WriteString("\treturn v\n}\n")
+	content := b.String()
+
+	c := NewASTChunker()
+	c.SplitOversized = true
+	c.SkipGaps = true
+	chunks, err := c.ChunkFile(context.Background(), "big.go", []byte(content))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks, want the function split into parts", len(chunks))
+	}
+
+	next := 3 // The function's first line
+	for i, chunk := range chunks {
+		if chunk.NodeName != "clamp" || chunk.NodeType != "function_declaration" || chunk.PartIndex != i+1 {
+			t.Errorf("part %d = %s %q part %d, want function_declaration clamp part %d",
+				i, chunk.NodeType, chunk.NodeName, chunk.PartIndex, i+1)
+		}
+		if len(chunk.Content) > DefaultMaxChunkSize {
+			t.Errorf("part %d has %d bytes, over the %d limit", i+1, len(chunk.Content), DefaultMaxChunkSize)
+		}
+		if chunk.StartLine != next {
+			t.Errorf("part %d starts at line %d, want %d", i+1, chunk.StartLine, next)
+		}
+		next = chunk.EndLine + 1
+		if got := content[chunk.StartByte:chunk.EndByte]; strings.TrimSuffix(got, "\n") != chunk.Content {
+			t.Errorf("part %d bytes %d-%d do not hold its content", i+1, chunk.StartByte, chunk.EndByte)
+		}
+
+		// Parts end after whole statements
+		if last := chunk.Content[strings.LastIndex(chunk.Content, "\n")+1:]; i < len(chunks)-1 && last != "\t}" {
+			t.Errorf("part %d ends inside a statement, with %q", i+1, last)
+		}
+	}
+	if next != 405 {
+		t.Errorf("parts end at line %d, want 404", next-1)
+	}
+
+	// Parts are the same on every run
+	again, err := c.ChunkFile(context.Background(), "big.go", []byte(content))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+	if len(again) != len(chunks) {
+		t.Fatalf("second run made %d parts, first %d", len(again), len(chunks))
+	}
+	for i := range chunks {
+		if again[i].ContentHash != chunks[i].ContentHash {
+			t.Errorf("part %d hash changed between runs", i+1)
+		}
+	}
+
+	// Without SplitOversized the function is also emitted whole
+	whole, err := NewASTChunker().ChunkFile(context.Background(), "big.go", []byte(content))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+	if fn := filterChunks(whole, func(c Chunk) bool { return c.NodeName == "clamp" }); len(fn) != 1 || fn[0].PartIndex != 0 {
+		t.Errorf("got %d clamp chunks by default, want it whole", len(fn))
+	}
+}
+
+func TestSplitOversizedClass(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("class Store:\n    limit = 10\n\n")
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(&b, "    def get_%d(self, key):\n        return self.items.get(key, %d)\n\n", i, i)
+	}
+	c := NewASTChunker()
+	c.SplitOversized = true
+	chunks, err := c.ChunkFile(context.Background(), "store.py", []byte(b.String()))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+	if classes := chunkNames(chunks, "class_definition"); len(classes) != 0 {
+		t.Errorf("oversized class emitted whole: %v", classes)
+	}
+	if methods := chunkNames(chunks, "function_definition"); len(methods) != 30 {
+		t.Errorf("got %d method chunks, want 30", len(methods))
+	}
+	for _, chunk := range chunks {
+		if chunk.PartIndex != 0 {
+			t.Errorf("%s %q has PartIndex %d, want whole methods", chunk.NodeType, chunk.NodeName, chunk.PartIndex)
+		}
+	}
+}
+
+func TestSplitNestedFunctions(t *testing.T) {
+	content := []byte(`function outer(items) {
+  function inner(x) {
+    function innermost() {
+      return x;
+    }
+    return innermost();
+  }
+  const named = function helper(y) { return y * 2; };
+  const arrow = (z) => z + 1;
+  return items.map(inner).map(named).map(arrow);
+}
+
+class Cart {
+  total() {
+    function sum(a, b) { return a + b; }
+    return this.items.reduce(sum, 0);
+  }
+}
+`)
+	functionNames := func(chunks []Chunk) []string {
+		var names []string
+		for _, chunk := range chunks {
+			switch chunk.NodeType {
+			case "function_declaration", "function_expression", "arrow_function", "method_definition":
+				names = append(names, chunk.NodeName)
+			}
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	c := NewASTChunker()
+	chunks, err := c.ChunkFile(context.Background(), "outer.js", content)
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+	if got := functionNames(chunks); fmt.Sprint(got) != "[outer]" {
+		t.Errorf("without SplitNestedFunctions got functions %v, want [outer]", got)
+	}
+
+	// Named functions nested in functions become chunks of their own,
+	// however small; the arrow function and the method itself do not
+	c.SplitNestedFunctions = []string{"javascript"}
+	chunks, err = c.ChunkFile(context.Background(), "outer.js", content)
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+	if got, want := functionNames(chunks), "[helper inner innermost outer sum]"; fmt.Sprint(got) != want {
+		t.Errorf("with SplitNestedFunctions got functions %v, want %s", got, want)
+	}
+	for _, chunk := range chunks {
+		if chunk.NodeName == "inner" && (chunk.StartLine != 2 || chunk.EndLine != 7) {
+			t.Errorf("inner spans lines %d-%d, want 2-7", chunk.StartLine, chunk.EndLine)
+		}
+	}
+
+	// The setting is per language
+	c.SplitNestedFunctions = []string{"python"}
+	chunks, err = c.ChunkFile(context.Background(), "outer.js", content)
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+	if got := functionNames(chunks); fmt.Sprint(got) != "[outer]" {
+		t.Errorf("with only python configured got functions %v, want [outer]", got)
+	}
+
+	opts := DefaultChunkOptions()
+	opts.SplitNestedFunctions = []string{"javascript"}
+	chunks, err = NewASTChunker().ChunkFileWithOptions(context.Background(), "outer.js", content, opts)
+	if err != nil {
+		t.Fatalf("ChunkFileWithOptions failed: %v", err)
+	}
+	if got, want := functionNames(chunks), "[helper inner innermost outer sum]"; fmt.Sprint(got) != want {
+		t.Errorf("ChunkFileWithOptions got functions %v, want %s", got, want)
+	}
+}
+
+func TestSplitNestedFunctionsPython(t *testing.T) {
+	content := []byte(`class Store:
+    def get(self, key):
+        def fallback():
+            return None
+        return self.items.get(key) or fallback()
+
+def outer():
+    key = lambda item: item.name
+    def inner():
+        return key
+    return inner
+`)
+	c := NewASTChunker()
+	c.SplitNestedFunctions = []string{"python"}
+	chunks, err := c.ChunkFile(context.Background(), "store.py", content)
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+	names := chunkNames(chunks, "function_definition")
+	sort.Strings(names)
+	// Methods of a small class stay in its chunk; functions inside them
+	// and inside other functions are split out
+	if got, want := fmt.Sprint(names), "[fallback inner outer]"; got != want {
+		t.Errorf("function chunks = %s, want %s", got, want)
+	}
+}
+
+func TestHeuristicEstimator(t *testing.T) {
+	var e HeuristicEstimator
+	if got := e.Estimate(""); got != 0 {
+		t.Errorf("Estimate(\"\") = %d, want 0", got)
+	}
+	if got := e.Estimate("abcdefgh"); got != 2 {
+		t.Errorf("Estimate of 8 letters = %d, want 2", got)
+	}
+
+	// Punctuation weighs more than its length in characters
+	prose := "total plus the item"
+	code := "t+=x[i];(f)(g)->{}"
+	if len(code) > len(prose) || e.Estimate(code) <= e.Estimate(prose) {
+		t.Errorf("Estimate(%q) = %d, not above Estimate(%q) = %d", code, e.Estimate(code), prose, e.Estimate(prose))
+	}
+}
+
+// wordEstimator counts whitespace-separated words, standing in for a
+// real tokenizer.
+type wordEstimator struct{}
+
+func (wordEstimator) Estimate(text string) int { return len(strings.Fields(text)) }
+
+func TestChunkFileMaxTokens(t *testing.T) {
+	content := largeGoFunction(200, nil)
+
+	for _, tc := range []struct {
+		name      string
+		estimator TokenEstimator
+		maxTokens int
+	}{
+		{"heuristic", nil, 500},
+		{"custom", wordEstimator{}, 100},
+	} {
+		opts := DefaultChunkOptions()
+		opts.MaxTokens = tc.maxTokens
+		opts.TokenEstimator = tc.estimator
+		chunks, err := NewASTChunker().ChunkFileWithOptions(context.Background(), "big.go", []byte(content), opts)
+		if err != nil {
+			t.Fatalf("%s: ChunkFileWithOptions failed: %v", tc.name, err)
+		}
+
+		estimator := tc.estimator
+		if estimator == nil {
+			estimator = HeuristicEstimator{}
+		}
+		parts := filterChunks(chunks, func(c Chunk) bool { return c.NodeName == "process" })
+		if len(parts) < 2 {
+			t.Fatalf("%s: got %d chunks of process, want it split", tc.name, len(parts))
+		}
+		next := 3 // The function's first line
+		for i, part := range parts {
+			if got := estimator.Estimate(part.Content); got > tc.maxTokens {
+				t.Errorf("%s: part %d estimated at %d tokens, over %d", tc.name, i+1, got, tc.maxTokens)
+			}
+			if part.PartIndex != i+1 || part.StartLine != next || part.ContentHash == "" {
+				t.Errorf("%s: part %d = part %d from line %d, hash %q; want part %d from line %d, hashed",
+					tc.name, i, part.PartIndex, part.StartLine, part.ContentHash, i+1, next)
+			}
+			next = part.EndLine + 1
+		}
+		if next != 207 {
+			t.Errorf("%s: parts end at line %d, want 206", tc.name, next-1)
+		}
+	}
+
+	// Without MaxTokens the function is one chunk
+	chunks, err := NewASTChunker().ChunkFileWithOptions(context.Background(), "big.go", []byte(content), DefaultChunkOptions())
+	if err != nil {
+		t.Fatalf("ChunkFileWithOptions failed: %v", err)
+	}
+	if parts := filterChunks(chunks, func(c Chunk) bool { return c.NodeName == "process" }); len(parts) != 1 || parts[0].PartIndex != 0 {
+		t.Errorf("got %d chunks of process by default, want 1 whole", len(parts))
+	}
+}
+
+func TestMaxTokensContinuesPartNumbers(t *testing.T) {
+	c := NewASTChunker()
+	c.SubChunkLines = 40
+	c.MaxTokens = 100
+	chunks, err := c.ChunkFile(context.Background(), "big.go", []byte(largeGoFunction(200, nil)))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+
+	parts := filterChunks(chunks, func(c Chunk) bool { return c.NodeName == "process" })
+	for i, part := range parts {
+		if part.PartIndex != i+1 {
+			t.Errorf("chunk %d of process has PartIndex %d, want %d", i, part.PartIndex, i+1)
+		}
+		if got := (HeuristicEstimator{}).Estimate(part.Content); got > 100 {
+			t.Errorf("chunk %d of process estimated at %d tokens, over 100", i, got)
+		}
+	}
+}
+
+func TestMaxTokensFallback(t *testing.T) {
+	// One long line per row, in a language without a grammar
+	content := strings.Repeat(strings.Repeat("word ", 100)+"\n", 10)
+
+	opts := DefaultChunkOptions()
+	opts.MaxTokens = 300
+	chunks, err := NewASTChunker().ChunkFileWithOptions(context.Background(), "notes.txt", []byte(content), opts)
+	if err != nil {
+		t.Fatalf("ChunkFileWithOptions failed: %v", err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks, want the fallback chunk split", len(chunks))
+	}
+	for _, chunk := range chunks {
+		if got := (HeuristicEstimator{}).Estimate(chunk.Content); got > 300 {
+			t.Errorf("chunk at line %d estimated at %d tokens, over 300", chunk.StartLine, got)
+		}
+		if chunk.ContentHash == "" {
+			t.Errorf("chunk at line %d is not hashed", chunk.StartLine)
+		}
+	}
+}
+
+func TestNeighborContext(t *testing.T) {
+	content := `package main
+
+type Server struct {
+	addr string
+}
+
+func (s *Server) Start() error {
+	return nil
+}
+
+func (s *Server) Stop() {
+}
+`
+	c := NewASTChunker()
+	c.NeighborContext = true
+	chunks, err := c.ChunkFile(context.Background(), "server.go", []byte(content))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+
+	var start *Chunk
+	for i := range chunks {
+		if chunks[i].NodeName == "Start" {
+			start = &chunks[i]
+		}
+	}
+	if start == nil {
+		t.Fatalf("no chunk for Start in %+v", chunks)
+	}
+	want := "previous: type Server struct {\nnext: func (s *Server) Stop() {"
+	if start.NeighborContext != want {
+		t.Errorf("NeighborContext = %q, want %q", start.NeighborContext, want)
+	}
+	if strings.Contains(start.Content, "previous:") {
+		t.Error("neighbor context leaked into Content")
+	}
+
+	// Disabled by default
+	plain, err := NewASTChunker().ChunkFile(context.Background(), "server.go", []byte(content))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+	for _, chunk := range plain {
+		if chunk.NeighborContext != "" {
+			t.Errorf("NeighborContext = %q without the option", chunk.NeighborContext)
+		}
+	}
+}
+
+func TestMaxChunkSizesPerLanguage(t *testing.T) {
+	files := map[string]string{
+		"shapes.py": `class Circle:
+    def area(self):
+        return 3.14 * self.r * self.r
+
+    def scale(self, k):
+        self.r *= k
+`,
+		"Circle.java": `class Circle {
+    double area() {
+        return 3.14 * r * r;
+    }
+
+    void scale(double k) {
+        r *= k;
+    }
+}
+`,
+	}
+	methodTypes := map[string]string{"shapes.py": "function_definition", "Circle.java": "method_declaration"}
+	methods := func(c *ASTChunker, path string) int {
+		t.Helper()
+		chunks, err := c.ChunkFile(context.Background(), path, []byte(files[path]))
+		if err != nil {
+			t.Fatalf("ChunkFile(%s) failed: %v", path, err)
+		}
+		n := 0
+		for _, chunk := range chunks {
+			if chunk.NodeType == methodTypes[path] {
+				n++
+			}
+		}
+		return n
+	}
+
+	tests := []struct {
+		name       string
+		maxSize    int
+		sizes      map[string]int
+		wantPython int
+		wantJava   int
+	}{
+		{"defaults", 0, nil, 0, 0},
+		{"python only", 0, map[string]int{"python": 40}, 2, 0},
+		{"java only", 0, map[string]int{"java": 40}, 0, 2},
+		{"both", 0, map[string]int{"java": 40, "python": 40}, 2, 2},
+		{"language over global", 40, map[string]int{"java": 4000}, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewASTChunker()
+			c.MaxChunkSize = tt.maxSize
+			c.MaxChunkSizes = tt.sizes
+			if got := methods(c, "shapes.py"); got != tt.wantPython {
+				t.Errorf("python method chunks = %d, want %d", got, tt.wantPython)
+			}
+			if got := methods(c, "Circle.java"); got != tt.wantJava {
+				t.Errorf("java method chunks = %d, want %d", got, tt.wantJava)
+			}
+		})
+	}
+}
+
+func TestLanguageDefaultMaxChunkSizes(t *testing.T) {
+	java := GetLanguageConfigByName("java").MaxChunkSize
+	python := GetLanguageConfigByName("python").MaxChunkSize
+	if java <= DefaultMaxChunkSize || python >= DefaultMaxChunkSize {
+		t.Errorf("MaxChunkSize java = %d, python = %d; want java above and python below %d", java, python, DefaultMaxChunkSize)
+	}
+
+	// A Java method between the two limits stays whole in a class, while
+	// the same size of Python class is split into its methods.
+	body := strings.Repeat("        total += 1;\n", (DefaultMaxChunkSize+200)/21)
+	javaSrc := "class Big {\n    void a() {\n" + body + "    }\n\n    void b() {\n    }\n}\n"
+	chunks, err := NewASTChunker().ChunkFile(context.Background(), "Big.java", []byte(javaSrc))
+	if err != nil {
+		t.Fatalf("ChunkFile(Big.java) failed: %v", err)
+	}
+	for _, chunk := range chunks {
+		if chunk.NodeType == "method_declaration" {
+			t.Errorf("Big.java split into method %q under the Java default", chunk.NodeName)
+		}
+	}
+
+	pyBody := strings.Repeat("        total += 1\n", (python+200)/19)
+	pySrc := "class Big:\n    def a(self):\n" + pyBody + "\n    def b(self):\n        pass\n"
+	chunks, err = NewASTChunker().ChunkFile(context.Background(), "big.py", []byte(pySrc))
+	if err != nil {
+		t.Fatalf("ChunkFile(big.py) failed: %v", err)
+	}
+	methods := 0
+	for _, chunk := range chunks {
+		if chunk.NodeType == "function_definition" {
+			methods++
+		}
+	}
+	if methods != 2 {
+		t.Errorf("big.py method chunks = %d, want 2 under the Python default", methods)
+	}
+}
+
+func TestQualifiedName(t *testing.T) {
+	// Small nodes are not split, so force methods into their own chunks
+	opts := DefaultChunkOptions()
+	opts.MaxChunkSize = 40
+
+	tests := []struct {
+		path    string
+		content string
+		name    string
+		want    string
+	}{
+		{
+			path: "auth.py",
+			content: `class AuthMiddleware:
+    def handle(self, request):
+        return self.check(request)
+
+    def check(self, request):
+        return True
+`,
+			name: "handle",
+			want: "AuthMiddleware.handle",
+		},
+		{
+			path: "Auth.java",
+			content: `package com.example.auth;
+
+public class AuthMiddleware {
+    public boolean handle(Request request) {
+        return true;
+    }
+}
+`,
+			name: "handle",
+			want: "com.example.auth.AuthMiddleware.handle",
+		},
+		{
+			path: "auth.go",
+			content: `package auth
+
+func (m *Middleware) Handle(w http.ResponseWriter, r *http.Request) {
+	m.next.ServeHTTP(w, r)
+}
+`,
+			name: "Handle",
+			want: "auth.Middleware.Handle",
+		},
+		{
+			path: "auth.go",
+			content: `package auth
+
+func New() *Middleware {
+	return &Middleware{}
+}
+`,
+			name: "New",
+			want: "auth.New",
+		},
+		{
+			path: "Auth.kt",
+			content: `package com.example.auth
+
+class AuthMiddleware {
+    fun handle(request: Request): Boolean {
+        return true
+    }
+}
+`,
+			name: "handle",
+			want: "com.example.auth.AuthMiddleware.handle",
+		},
+		{
+			path: "Auth.cs",
+			content: `namespace Example.Auth;
+
+public class AuthMiddleware
+{
+    public bool Handle(Request request)
+    {
+        return true;
+    }
+}
+`,
+			name: "Handle",
+			want: "Example.Auth.AuthMiddleware.Handle",
+		},
+	}
+
+	c := NewASTChunker()
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			chunks, err := c.ChunkFileWithOptions(context.Background(), tt.path, []byte(tt.content), opts)
+			if err != nil {
+				t.Fatalf("ChunkFileWithOptions failed: %v", err)
+			}
+			var got []string
+			for _, chunk := range chunks {
+				if chunk.NodeName == tt.name {
+					got = append(got, chunk.QualifiedName)
+				}
+			}
+			if len(got) == 0 || got[0] != tt.want {
+				t.Errorf("qualified names of %s = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQualifiedNameUnnamed(t *testing.T) {
+	chunks, err := NewASTChunker().ChunkFile(context.Background(), "notes.txt", []byte("some notes\n"))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+	for _, chunk := range chunks {
+		if chunk.QualifiedName != "" {
+			t.Errorf("unnamed chunk has QualifiedName %q", chunk.QualifiedName)
+		}
+	}
+}
+
+func TestChunkFileTooDeep(t *testing.T) {
+	depth := MaxTreeDepth + 100
+	content := "package main\n\nvar x = " + strings.Repeat("(", depth) + "1" + strings.Repeat(")", depth) + "\n"
+
+	c := NewASTChunker()
+	if _, err := c.ChunkFile(context.Background(), "deep.go", []byte(content)); !errors.Is(err, ErrUnparseable) {
+		t.Errorf("ChunkFile error = %v, want ErrUnparseable", err)
+	}
+	opts := DefaultChunkOptions()
+	if _, err := c.ChunkFileWithOptions(context.Background(), "deep.go", []byte(content), opts); !errors.Is(err, ErrUnparseable) {
+		t.Errorf("ChunkFileWithOptions error = %v, want ErrUnparseable", err)
+	}
+
+	// Moderate nesting is fine, with comment stripping walking the whole tree
+	c.StripComments = true
+	shallow := "package main\n\n// x\nvar x = " + strings.Repeat("(", 600) + "1" + strings.Repeat(")", 600) + "\n"
+	if _, err := c.ChunkFile(context.Background(), "ok.go", []byte(shallow)); err != nil {
+		t.Errorf("ChunkFile on a small nested chunk error = %v", err)
+	}
+}
+
+func TestRecoverPanic(t *testing.T) {
+	err := func() (err error) {
+		defer recoverPanic(&err)
+		panic("index out of range")
+	}()
+	if !errors.Is(err, ErrUnparseable) || !strings.Contains(err.Error(), "index out of range") {
+		t.Errorf("recovered error = %v, want ErrUnparseable with the panic value", err)
+	}
+}
@@ -0,0 +1,105 @@
+package chunker
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// byteRange is a half-open [start, end) range of byte offsets.
+type byteRange struct {
+	start, end int
+}
+
+// stripComments sets EmbedContent on each chunk to its content with the
+// language's comment nodes removed. Content itself is left untouched so
+// stored locations and snippets still reflect the source. Chunks without
+// comments keep an empty EmbedContent.
+func stripComments(root *sitter.Node, content []byte, config *LanguageConfig, chunks []Chunk) {
+	if len(config.CommentNodes) == 0 {
+		return
+	}
+
+	commentTypes := make(map[string]bool, len(config.CommentNodes))
+	for _, t := range config.CommentNodes {
+		commentTypes[t] = true
+	}
+
+	var comments []byteRange
+	collectComments(root, commentTypes, 0, &comments)
+	if len(comments) == 0 {
+		return
+	}
+	sort.Slice(comments, func(i, j int) bool {
+		return comments[i].start < comments[j].start
+	})
+
+	for i := range chunks {
+		stripped := stripRanges(content, chunks[i].StartByte, chunks[i].EndByte, comments)
+		if stripped != chunks[i].Content {
+			chunks[i].EmbedContent = stripped
+		}
+	}
+}
+
+// collectComments appends the byte ranges of all comment nodes under node,
+// which is at depth in the tree. Comments deeper than MaxTreeDepth are
+// left in place.
+func collectComments(node *sitter.Node, commentTypes map[string]bool, depth int, out *[]byteRange) {
+	if commentTypes[node.Type()] {
+		*out = append(*out, byteRange{int(node.StartByte()), int(node.EndByte())})
+		return
+	}
+	if depth >= MaxTreeDepth {
+		return
+	}
+	for i := 0; i < int(node.ChildCount()); i++ {
+		collectComments(node.Child(i), commentTypes, depth+1, out)
+	}
+}
+
+// stripRanges returns content[start:end] with the given sorted ranges
+// removed. Lines a removal left blank are dropped and trailing whitespace
+// is trimmed, so a chunk whose comments are removed reads as plain code;
+// blank lines already in the source are kept. If nothing was removed the
+// original text is returned as-is.
+func stripRanges(content []byte, start, end int, ranges []byteRange) string {
+	var b strings.Builder
+	pos := start
+	outLine := 0                  // Line of the output being written
+	touched := make(map[int]bool) // Output lines a removal touched
+
+	for _, r := range ranges {
+		if r.end <= pos {
+			continue
+		}
+		if r.start >= end {
+			break
+		}
+		if r.start > pos {
+			b.Write(content[pos:r.start])
+			outLine += bytes.Count(content[pos:r.start], []byte{'\n'})
+		}
+		pos = max(pos, min(r.end, end))
+		touched[outLine] = true
+	}
+	if len(touched) == 0 {
+		return string(content[start:end])
+	}
+	if pos < end {
+		b.Write(content[pos:end])
+	}
+
+	lines := strings.Split(b.String(), "\n")
+	kept := lines[:0]
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if touched[i] && strings.TrimSpace(line) == "" {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, "\n")
+}
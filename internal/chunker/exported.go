@@ -0,0 +1,163 @@
+package chunker
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// exportedLanguages are the languages FilterExported knows the visibility
+// rules of.
+var exportedLanguages = map[string]bool{
+	"go":         true,
+	"python":     true,
+	"javascript": true,
+	"typescript": true,
+	"tsx":        true,
+	"java":       true,
+	"rust":       true,
+}
+
+// pythonAll matches a module's __all__ = [...] or (...) assignment.
+var pythonAll = regexp.MustCompile(`(?m)^__all__\s*(?::[^=]*)?=\s*[\[(]([^\])]*)[\])]`)
+
+// SupportsExported reports whether FilterExported can tell public from
+// private symbols in language.
+func SupportsExported(language string) bool {
+	return exportedLanguages[language]
+}
+
+// FilterExported returns the chunks of a file's content that are part of
+// its public API, judged by each language's visibility convention:
+//   - go: the name starts with an upper-case letter
+//   - python: the name is listed in the module's __all__, if it has one,
+//     and otherwise does not start with an underscore; methods are
+//     private only by the underscore convention
+//   - javascript, typescript, tsx: the declaration is exported, or is a
+//     method that is not private, protected or #-prefixed
+//   - java: the declaration has the public modifier
+//   - rust: the item is pub; impl blocks are kept
+//
+// Chunks in other languages are all kept. The later parts of a split node
+// (see Chunk.PartIndex) are kept with its first part.
+func FilterExported(chunks []Chunk, content []byte) []Chunk {
+	var all map[string]bool
+	kept := make([]Chunk, 0, len(chunks))
+	exported := false // Whether the last chunk that is not a later part was kept
+	for _, c := range chunks {
+		if c.Language == "python" && all == nil {
+			all = pythonExports(content)
+		}
+		if c.PartIndex <= 1 {
+			exported = isExported(c, content, all)
+		}
+		if exported {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// isExported reports whether c is public. all holds the names in a Python
+// module's __all__, and is empty if the module has none.
+func isExported(c Chunk, content []byte, all map[string]bool) bool {
+	switch c.Language {
+	case "go":
+		name := c.NodeName
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			name = name[i+1:]
+		}
+		for _, r := range name {
+			return unicode.IsUpper(r)
+		}
+		return false
+	case "python":
+		if c.NodeName == "" {
+			return false
+		}
+		if !topLevel(content, c.StartByte) || len(all) == 0 {
+			return !strings.HasPrefix(c.NodeName, "_") ||
+				(strings.HasPrefix(c.NodeName, "__") && strings.HasSuffix(c.NodeName, "__"))
+		}
+		return all[c.NodeName]
+	case "javascript", "typescript", "tsx":
+		decl := declaration(c.Content, "@")
+		if strings.HasPrefix(decl, "export ") {
+			return true
+		}
+		// A declaration split out of its export_statement starts after
+		// the export keyword on the same line.
+		if prefix := strings.TrimSpace(linePrefix(content, c.StartByte)); prefix == "export" || prefix == "export default" {
+			return true
+		}
+		if c.NodeType != "method_definition" {
+			return false
+		}
+		return !strings.HasPrefix(decl, "#") && !strings.HasPrefix(decl, "private ") &&
+			!strings.HasPrefix(decl, "protected ")
+	case "java":
+		signature := declaration(c.Content, "@")
+		if end := strings.IndexAny(signature, "({"); end >= 0 {
+			signature = signature[:end]
+		}
+		for _, word := range strings.Fields(signature) {
+			if word == "public" {
+				return true
+			}
+		}
+		return false
+	case "rust":
+		if c.NodeType == "impl_item" {
+			return true
+		}
+		return strings.HasPrefix(declaration(c.Content, "#"), "pub ")
+	}
+	return true
+}
+
+// declaration returns content from its first line that is not blank, a
+// comment, or an attribute or decorator starting with attrPrefix.
+func declaration(content, attrPrefix string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || isCommentLine(line, "") || strings.HasPrefix(line, attrPrefix) {
+			continue
+		}
+		return strings.Join(append([]string{line}, lines[i+1:]...), "\n")
+	}
+	return ""
+}
+
+// linePrefix returns the text of content's line before offset.
+func linePrefix(content []byte, offset int) string {
+	if offset <= 0 || offset > len(content) {
+		return ""
+	}
+	start := bytes.LastIndexByte(content[:offset], '\n') + 1
+	return string(content[start:offset])
+}
+
+// topLevel reports whether the chunk starting at offset begins a line,
+// rather than being indented inside a class or function.
+func topLevel(content []byte, offset int) bool {
+	return offset <= 0 || offset > len(content) || content[offset-1] == '\n'
+}
+
+// pythonExports returns the names listed in a module's __all__, or an
+// empty map if it has none.
+func pythonExports(content []byte) map[string]bool {
+	all := map[string]bool{}
+	m := pythonAll.FindSubmatch(content)
+	if m == nil {
+		return all
+	}
+	for _, name := range strings.Split(string(m[1]), ",") {
+		name = strings.Trim(strings.TrimSpace(name), `"'`)
+		if name != "" {
+			all[name] = true
+		}
+	}
+	return all
+}
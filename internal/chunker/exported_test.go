@@ -0,0 +1,153 @@
+package chunker
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestFilterExported(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		content string
+		want    []string
+	}{
+		{"go", "user.go", `package user
+
+type User struct{}
+
+type session struct{}
+
+func (u *User) Name() string { return "" }
+
+func (u *User) validate() bool { return true }
+
+func NewUser() *User { return &User{} }
+
+func helper() {}
+`, []string{"Name", "NewUser", "User"}},
+		{"python underscore", "util.py", `def load(path):
+    return open(path).read()
+
+def _parse(text):
+    return text.split()
+
+@cache
+def _cached():
+    return 1
+
+class Reader:
+    def read(self):
+        return 1
+`, []string{"Reader", "load"}},
+		{"python __all__", "api.py", `__all__ = ["connect", 'Client']
+
+def connect():
+    return Client()
+
+def helper():
+    return 1
+
+class Client:
+    pass
+`, []string{"Client", "connect"}},
+		{"typescript", "api.ts", `export function fetchUser(id: string) {
+  return id;
+}
+
+function internal() {
+  return 1;
+}
+
+export class Api {
+  get() { return 1; }
+}
+
+export interface Options {
+  timeout: number;
+}
+`, []string{"Api", "Options", "fetchUser"}},
+		{"java", "Api.java", `package api;
+
+public class Api {
+    public int get() { return 1; }
+}
+
+class Helper {
+    int help() { return 2; }
+}
+`, []string{"Api"}},
+		{"rust", "lib.rs", `pub fn open() -> i32 {
+    1
+}
+
+fn close() {}
+
+pub(crate) fn internal() {}
+
+/// A handle.
+pub struct Handle;
+`, []string{"Handle", "open"}},
+		{"other languages are kept", "util.rb", `def _hidden
+  1
+end
+`, []string{"_hidden"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks, err := NewASTChunker().ChunkFile(context.Background(), tt.path, []byte(tt.content))
+			if err != nil {
+				t.Fatalf("ChunkFile failed: %v", err)
+			}
+			var names []string
+			for _, c := range FilterExported(chunks, []byte(tt.content)) {
+				names = append(names, c.NodeName)
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("exported = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterExportedParts(t *testing.T) {
+	body := strings.Repeat("  total += 1;\n", 8)
+	content := "export function sum() {\n  let total = 0;\n" + body + "  return total;\n}\n\n" +
+		"function hidden() {\n  let total = 0;\n" + body + "  return total;\n}\n"
+
+	c := NewASTChunker()
+	c.SplitOversized = true
+	c.MaxChunkSize = 60
+	chunks, err := c.ChunkFile(context.Background(), "sum.ts", []byte(content))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+	if len(chunkNames(chunks, "function_declaration")) < 4 {
+		t.Fatalf("expected both functions split into parts, got %d chunks", len(chunks))
+	}
+
+	// Later parts do not start with "export" but follow the first
+	for _, c := range FilterExported(chunks, []byte(content)) {
+		if c.NodeName != "sum" {
+			t.Errorf("kept part %d of %q", c.PartIndex, c.NodeName)
+		}
+	}
+	if got, want := len(FilterExported(chunks, []byte(content))), len(filterChunks(chunks, func(c Chunk) bool { return c.NodeName == "sum" })); got != want {
+		t.Errorf("kept %d chunks, want all %d parts of sum", got, want)
+	}
+}
+
+func TestSupportsExported(t *testing.T) {
+	for _, lang := range []string{"go", "python", "typescript", "java", "rust"} {
+		if !SupportsExported(lang) {
+			t.Errorf("SupportsExported(%q) = false", lang)
+		}
+	}
+	if SupportsExported("ruby") {
+		t.Error("SupportsExported(ruby) = true")
+	}
+}
@@ -0,0 +1,60 @@
+package chunker
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// shortHashLen is how much of a content hash WriteChunks prints.
+const shortHashLen = 12
+
+// WriteChunks writes a table of chunks to w: each chunk's node type, name,
+// line range, byte range and shortened content hash. With content set, each
+// chunk is instead written as a header line followed by its indented text.
+func WriteChunks(w io.Writer, chunks []Chunk, content bool) error {
+	if len(chunks) == 0 {
+		_, err := fmt.Fprintln(w, "No chunks")
+		return err
+	}
+
+	if content {
+		for i, c := range chunks {
+			if _, err := fmt.Fprintf(w, "#%d %s %s  lines %d-%d  bytes %d-%d  %s\n",
+				i+1, c.NodeType, chunkName(c), c.StartLine, c.EndLine, c.StartByte, c.EndByte, shortHash(c)); err != nil {
+				return err
+			}
+			for _, line := range strings.Split(strings.TrimRight(c.Content, "\n"), "\n") {
+				if _, err := fmt.Fprintf(w, "    | %s\n", line); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tTYPE\tNAME\tLINES\tBYTES\tHASH")
+	for i, c := range chunks {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d-%d\t%d-%d\t%s\n",
+			i+1, c.NodeType, chunkName(c), c.StartLine, c.EndLine, c.StartByte, c.EndByte, shortHash(c))
+	}
+	return tw.Flush()
+}
+
+// chunkName returns c's symbol name, or "-" for unnamed chunks.
+func chunkName(c Chunk) string {
+	if c.NodeName == "" {
+		return "-"
+	}
+	return c.NodeName
+}
+
+// shortHash returns the first shortHashLen characters of c's content hash.
+func shortHash(c Chunk) string {
+	if len(c.ContentHash) > shortHashLen {
+		return c.ContentHash[:shortHashLen]
+	}
+	return c.ContentHash
+}
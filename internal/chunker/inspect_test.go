@@ -0,0 +1,79 @@
+package chunker
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestWriteChunks(t *testing.T) {
+	content := `package shapes
+
+type Circle struct {
+	R float64
+}
+
+func (c Circle) Area() float64 {
+	return 3.14 * c.R * c.R
+}
+
+func NewCircle(r float64) Circle {
+	return Circle{R: r}
+}
+`
+	chunks, err := NewASTChunker().ChunkFile(context.Background(), "shapes.go", []byte(content))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteChunks(&buf, chunks, false); err != nil {
+		t.Fatalf("WriteChunks failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if len(lines) != len(chunks)+1 {
+		t.Fatalf("got %d lines for %d chunks:\n%s", len(lines), len(chunks), buf.String())
+	}
+	if fields := strings.Fields(lines[0]); strings.Join(fields, " ") != "# TYPE NAME LINES BYTES HASH" {
+		t.Errorf("header = %q", lines[0])
+	}
+
+	// Each expected chunk appears as a row with its type, name and lines
+	want := [][]string{
+		{"type_declaration", "Circle", "3-5"},
+		{"method_declaration", "Area", "7-9"},
+		{"function_declaration", "NewCircle", "11-13"},
+	}
+	for _, w := range want {
+		found := false
+		for _, line := range lines[1:] {
+			fields := strings.Fields(line)
+			if len(fields) == 6 && fields[1] == w[0] && fields[2] == w[1] && fields[3] == w[2] {
+				found = true
+				// Bytes and a shortened hash follow
+				if !strings.Contains(fields[4], "-") || len(fields[5]) != shortHashLen {
+					t.Errorf("row %q has malformed bytes or hash", line)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("no row for %s %s lines %s in:\n%s", w[0], w[1], w[2], buf.String())
+		}
+	}
+
+	// With content, each chunk's text follows its header
+	buf.Reset()
+	if err := WriteChunks(&buf, chunks, true); err != nil {
+		t.Fatalf("WriteChunks with content failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "function_declaration NewCircle  lines 11-13") ||
+		!strings.Contains(buf.String(), "    | \treturn Circle{R: r}\n") {
+		t.Errorf("content output missing NewCircle:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteChunks(&buf, nil, false); err != nil || buf.String() != "No chunks\n" {
+		t.Errorf("empty output = %q, %v", buf.String(), err)
+	}
+}
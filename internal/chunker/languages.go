@@ -7,12 +7,17 @@ import (
 	sitter "github.com/smacker/go-tree-sitter"
 	"github.com/smacker/go-tree-sitter/c"
 	"github.com/smacker/go-tree-sitter/cpp"
+	"github.com/smacker/go-tree-sitter/csharp"
 	"github.com/smacker/go-tree-sitter/golang"
 	"github.com/smacker/go-tree-sitter/java"
 	"github.com/smacker/go-tree-sitter/javascript"
+	"github.com/smacker/go-tree-sitter/kotlin"
+	"github.com/smacker/go-tree-sitter/php"
 	"github.com/smacker/go-tree-sitter/python"
 	"github.com/smacker/go-tree-sitter/ruby"
 	"github.com/smacker/go-tree-sitter/rust"
+	"github.com/smacker/go-tree-sitter/scala"
+	"github.com/smacker/go-tree-sitter/swift"
 	"github.com/smacker/go-tree-sitter/typescript/tsx"
 	"github.com/smacker/go-tree-sitter/typescript/typescript"
 )
@@ -25,65 +30,109 @@ type LanguageConfig struct {
 	Name         string           // Language identifier (e.g., "go", "python")
 	SplitNodes   []string         // AST node types to create chunks from
 	NameFields   []string         // Field names that contain symbol names
+	NameNodes    []string         // Child node types holding the name in grammars without name fields
+	CommentNodes []string         // AST node types that hold comments
 	MaxChunkSize int              // Max characters per chunk before recursive splitting
+
+	// ScopeNodes are AST node types whose names qualify the symbols
+	// inside them (classes, modules, namespaces), PackageNode is the
+	// top-level node naming the file's package, and ReceiverField is the
+	// field holding a method's receiver, whose type qualifies the method.
+	// See Chunk.QualifiedName.
+	ScopeNodes    []string
+	PackageNode   string
+	ReceiverField string
+
+	// FunctionNodes are the AST node types of functions, named or not,
+	// including closures and methods. A named one inside another can be
+	// made a chunk of its own (see ASTChunker.SplitNestedFunctions).
+	FunctionNodes []string
 }
 
+// jsFunctionNodes are the function node types of the JavaScript and
+// TypeScript grammars.
+var jsFunctionNodes = []string{"function_declaration", "generator_function_declaration", "function_expression", "generator_function", "arrow_function", "method_definition"}
+
 // languageConfigs maps language names to their configurations.
+// MaxChunkSize follows each language's density: Java and C++ classes are
+// long and split coarsely, terse Python and Ruby finely.
 var languageConfigs = map[string]*LanguageConfig{
 	"go": {
-		Language:     golang.GetLanguage(),
-		Name:         "go",
-		SplitNodes:   []string{"function_declaration", "method_declaration", "type_declaration", "const_declaration", "var_declaration"},
-		NameFields:   []string{"name"},
-		MaxChunkSize: 2000,
+		Language:      golang.GetLanguage(),
+		Name:          "go",
+		SplitNodes:    []string{"function_declaration", "method_declaration", "type_declaration", "const_declaration", "var_declaration"},
+		NameFields:    []string{"name"},
+		CommentNodes:  []string{"comment"},
+		MaxChunkSize:  2000,
+		PackageNode:   "package_clause",
+		ReceiverField: "receiver",
 	},
 	"python": {
-		Language:     python.GetLanguage(),
-		Name:         "python",
-		SplitNodes:   []string{"function_definition", "class_definition", "decorated_definition"},
-		NameFields:   []string{"name"},
-		MaxChunkSize: 2000,
+		Language:      python.GetLanguage(),
+		Name:          "python",
+		SplitNodes:    []string{"function_definition", "class_definition", "decorated_definition"},
+		NameFields:    []string{"name"},
+		CommentNodes:  []string{"comment"},
+		MaxChunkSize:  1500,
+		ScopeNodes:    []string{"class_definition"},
+		FunctionNodes: []string{"function_definition", "lambda"},
 	},
 	"javascript": {
-		Language:     javascript.GetLanguage(),
-		Name:         "javascript",
-		SplitNodes:   []string{"function_declaration", "class_declaration", "method_definition", "arrow_function", "export_statement"},
-		NameFields:   []string{"name"},
-		MaxChunkSize: 2000,
+		Language:      javascript.GetLanguage(),
+		Name:          "javascript",
+		SplitNodes:    []string{"function_declaration", "class_declaration", "method_definition", "arrow_function", "export_statement"},
+		NameFields:    []string{"name"},
+		CommentNodes:  []string{"comment"},
+		MaxChunkSize:  2000,
+		ScopeNodes:    []string{"class_declaration"},
+		FunctionNodes: jsFunctionNodes,
 	},
 	"typescript": {
-		Language:     typescript.GetLanguage(),
-		Name:         "typescript",
-		SplitNodes:   []string{"function_declaration", "class_declaration", "method_definition", "arrow_function", "interface_declaration", "type_alias_declaration", "export_statement"},
-		NameFields:   []string{"name"},
-		MaxChunkSize: 2000,
+		Language:      typescript.GetLanguage(),
+		Name:          "typescript",
+		SplitNodes:    []string{"function_declaration", "class_declaration", "method_definition", "arrow_function", "interface_declaration", "type_alias_declaration", "export_statement"},
+		NameFields:    []string{"name"},
+		CommentNodes:  []string{"comment"},
+		MaxChunkSize:  2000,
+		ScopeNodes:    []string{"class_declaration", "abstract_class_declaration", "interface_declaration", "internal_module"},
+		FunctionNodes: jsFunctionNodes,
 	},
 	"tsx": {
-		Language:     tsx.GetLanguage(),
-		Name:         "tsx",
-		SplitNodes:   []string{"function_declaration", "class_declaration", "method_definition", "arrow_function", "interface_declaration", "type_alias_declaration", "export_statement"},
-		NameFields:   []string{"name"},
-		MaxChunkSize: 2000,
+		Language:      tsx.GetLanguage(),
+		Name:          "tsx",
+		SplitNodes:    []string{"function_declaration", "class_declaration", "method_definition", "arrow_function", "interface_declaration", "type_alias_declaration", "export_statement"},
+		NameFields:    []string{"name"},
+		CommentNodes:  []string{"comment"},
+		MaxChunkSize:  2000,
+		ScopeNodes:    []string{"class_declaration", "abstract_class_declaration", "interface_declaration", "internal_module"},
+		FunctionNodes: jsFunctionNodes,
 	},
 	"rust": {
-		Language:     rust.GetLanguage(),
-		Name:         "rust",
-		SplitNodes:   []string{"function_item", "impl_item", "struct_item", "enum_item", "trait_item", "mod_item"},
-		NameFields:   []string{"name"},
-		MaxChunkSize: 2000,
+		Language:      rust.GetLanguage(),
+		Name:          "rust",
+		SplitNodes:    []string{"function_item", "impl_item", "struct_item", "enum_item", "trait_item", "mod_item"},
+		NameFields:    []string{"name"},
+		CommentNodes:  []string{"line_comment", "block_comment"},
+		MaxChunkSize:  2500,
+		ScopeNodes:    []string{"impl_item", "trait_item", "mod_item"},
+		FunctionNodes: []string{"function_item", "closure_expression"},
 	},
 	"java": {
 		Language:     java.GetLanguage(),
 		Name:         "java",
 		SplitNodes:   []string{"method_declaration", "class_declaration", "interface_declaration", "constructor_declaration"},
 		NameFields:   []string{"name"},
-		MaxChunkSize: 2000,
+		CommentNodes: []string{"line_comment", "block_comment", "comment"},
+		MaxChunkSize: 4000,
+		ScopeNodes:   []string{"class_declaration", "interface_declaration", "enum_declaration"},
+		PackageNode:  "package_declaration",
 	},
 	"c": {
 		Language:     c.GetLanguage(),
 		Name:         "c",
 		SplitNodes:   []string{"function_definition", "struct_specifier", "enum_specifier", "declaration"},
 		NameFields:   []string{"declarator"},
+		CommentNodes: []string{"comment"},
 		MaxChunkSize: 2000,
 	},
 	"cpp": {
@@ -91,36 +140,96 @@ var languageConfigs = map[string]*LanguageConfig{
 		Name:         "cpp",
 		SplitNodes:   []string{"function_definition", "class_specifier", "struct_specifier", "namespace_definition"},
 		NameFields:   []string{"declarator", "name"},
-		MaxChunkSize: 2000,
+		CommentNodes: []string{"comment"},
+		MaxChunkSize: 3000,
+		ScopeNodes:   []string{"class_specifier", "struct_specifier", "namespace_definition"},
 	},
 	"ruby": {
 		Language:     ruby.GetLanguage(),
 		Name:         "ruby",
 		SplitNodes:   []string{"method", "class", "module", "singleton_method"},
 		NameFields:   []string{"name"},
+		CommentNodes: []string{"comment"},
+		MaxChunkSize: 1500,
+		ScopeNodes:   []string{"class", "module"},
+	},
+	"php": {
+		Language:     php.GetLanguage(),
+		Name:         "php",
+		SplitNodes:   []string{"function_definition", "class_declaration", "interface_declaration", "trait_declaration", "method_declaration"},
+		NameFields:   []string{"name"},
+		CommentNodes: []string{"comment"},
+		MaxChunkSize: 3000,
+		ScopeNodes:   []string{"class_declaration", "interface_declaration", "trait_declaration"},
+		PackageNode:  "namespace_definition",
+	},
+	"kotlin": {
+		Language:     kotlin.GetLanguage(),
+		Name:         "kotlin",
+		SplitNodes:   []string{"function_declaration", "class_declaration", "object_declaration", "secondary_constructor"},
+		NameNodes:    []string{"type_identifier", "simple_identifier"},
+		CommentNodes: []string{"line_comment", "multiline_comment"},
+		MaxChunkSize: 3000,
+		ScopeNodes:   []string{"class_declaration", "object_declaration"},
+		PackageNode:  "package_header",
+	},
+	"swift": {
+		Language:     swift.GetLanguage(),
+		Name:         "swift",
+		SplitNodes:   []string{"function_declaration", "class_declaration", "protocol_declaration", "init_declaration"},
+		NameFields:   []string{"name"},
+		CommentNodes: []string{"comment", "multiline_comment"},
+		MaxChunkSize: 2500,
+		ScopeNodes:   []string{"class_declaration", "protocol_declaration"},
+	},
+	"scala": {
+		Language:     scala.GetLanguage(),
+		Name:         "scala",
+		SplitNodes:   []string{"function_definition", "function_declaration", "class_definition", "object_definition", "trait_definition"},
+		NameFields:   []string{"name"},
+		CommentNodes: []string{"comment", "block_comment"},
 		MaxChunkSize: 2000,
+		ScopeNodes:   []string{"class_definition", "object_definition", "trait_definition"},
+		PackageNode:  "package_clause",
+	},
+	"csharp": {
+		Language:     csharp.GetLanguage(),
+		Name:         "csharp",
+		SplitNodes:   []string{"method_declaration", "constructor_declaration", "class_declaration", "interface_declaration", "struct_declaration", "enum_declaration", "record_declaration"},
+		NameFields:   []string{"name"},
+		CommentNodes: []string{"comment"},
+		MaxChunkSize: 4000,
+		ScopeNodes:   []string{"class_declaration", "interface_declaration", "struct_declaration", "record_declaration", "namespace_declaration"},
+		PackageNode:  "file_scoped_namespace_declaration",
 	},
 }
 
 // extToLanguage maps file extensions to language identifiers.
 var extToLanguage = map[string]string{
-	".go":   "go",
-	".py":   "python",
-	".js":   "javascript",
-	".mjs":  "javascript",
-	".jsx":  "javascript",
-	".ts":   "typescript",
-	".tsx":  "tsx",
-	".rs":   "rust",
-	".java": "java",
-	".c":    "c",
-	".h":    "c",
-	".cpp":  "cpp",
-	".cc":   "cpp",
-	".cxx":  "cpp",
-	".hpp":  "cpp",
-	".hxx":  "cpp",
-	".rb":   "ruby",
+	".go":    "go",
+	".py":    "python",
+	".js":    "javascript",
+	".mjs":   "javascript",
+	".jsx":   "javascript",
+	".ts":    "typescript",
+	".tsx":   "tsx",
+	".rs":    "rust",
+	".java":  "java",
+	".c":     "c",
+	".h":     "c",
+	".cpp":   "cpp",
+	".cc":    "cpp",
+	".cxx":   "cpp",
+	".hpp":   "cpp",
+	".hxx":   "cpp",
+	".rb":    "ruby",
+	".php":   "php",
+	".kt":    "kotlin",
+	".kts":   "kotlin",
+	".swift": "swift",
+	".scala": "scala",
+	".sc":    "scala",
+	".cs":    "csharp",
 }
 
 // GetLanguageConfig returns the language configuration for a file path
@@ -134,6 +243,44 @@ func GetLanguageConfig(path string) *LanguageConfig {
 	return languageConfigs[langName]
 }
 
+// LanguageOverride maps files to a language regardless of their extension.
+// Pattern is either an extension (".inc") or a glob ("*.tmpl",
+// "templates/*.html"). Globs without a "/" match the file's base name;
+// globs with one match the whole (slash-separated) path.
+type LanguageOverride struct {
+	Pattern  string
+	Language string
+}
+
+// Matches reports whether the override applies to path.
+func (o LanguageOverride) Matches(path string) bool {
+	path = filepath.ToSlash(path)
+	if strings.HasPrefix(o.Pattern, ".") && !strings.ContainsAny(o.Pattern, "*?[/") {
+		return strings.EqualFold(filepath.Ext(path), o.Pattern)
+	}
+	if strings.Contains(o.Pattern, "/") {
+		ok, _ := filepath.Match(o.Pattern, path)
+		return ok
+	}
+	ok, _ := filepath.Match(o.Pattern, filepath.Base(path))
+	return ok
+}
+
+// ResolveLanguageConfig returns the language configuration for a file path,
+// consulting overrides in order before falling back to the extension.
+// Overrides naming an unsupported language are ignored.
+func ResolveLanguageConfig(path string, overrides []LanguageOverride) *LanguageConfig {
+	for _, o := range overrides {
+		if !o.Matches(path) {
+			continue
+		}
+		if config := languageConfigs[o.Language]; config != nil {
+			return config
+		}
+	}
+	return GetLanguageConfig(path)
+}
+
 // GetLanguageConfigByName returns the language configuration for a
 // language name. Returns nil if the language is not supported.
 func GetLanguageConfigByName(name string) *LanguageConfig {
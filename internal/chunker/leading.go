@@ -0,0 +1,52 @@
+package chunker
+
+import (
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// decoratorNodes are the node types of decorators and attributes that
+// grammars parse as siblings before the definition they apply to, such as
+// TypeScript method decorators and Rust attributes. Grammars that nest
+// them in the definition, like Python's decorated_definition and Java's
+// modifiers, need no help.
+var decoratorNodes = map[string]bool{
+	"decorator":      true,
+	"attribute_item": true,
+}
+
+// leadingNode returns the first node of the run of comments and decorators
+// directly before node, or nil if there is none. Siblings in the run may be
+// separated by at most maxGap blank lines, as may the run and node. A
+// comment ending a line of code, like a trailing "// ok", is not part of
+// the run.
+func leadingNode(node *sitter.Node, config *LanguageConfig, maxGap int) *sitter.Node {
+	commentTypes := make(map[string]bool, len(config.CommentNodes))
+	for _, t := range config.CommentNodes {
+		commentTypes[t] = true
+	}
+
+	var first *sitter.Node
+	next := node
+	for prev := node.PrevNamedSibling(); prev != nil; prev = prev.PrevNamedSibling() {
+		if !commentTypes[prev.Type()] && !decoratorNodes[prev.Type()] {
+			break
+		}
+		if int(next.StartPoint().Row)-int(prev.EndPoint().Row)-1 > maxGap {
+			break
+		}
+		if before := prev.PrevNamedSibling(); before != nil && before.EndPoint().Row == prev.StartPoint().Row {
+			break
+		}
+		first, next = prev, prev
+	}
+	return first
+}
+
+// withLeading returns chunk extended back to start at lead, whose comments
+// and decorators then belong to the chunk rather than to a gap chunk.
+func withLeading(chunk Chunk, lead *sitter.Node, content []byte) Chunk {
+	chunk.StartLine = int(lead.StartPoint().Row) + 1
+	chunk.StartByte = int(lead.StartByte())
+	chunk.Content = string(content[chunk.StartByte:chunk.EndByte])
+	return chunk
+}
@@ -0,0 +1,52 @@
+package chunker
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSignatureBytes caps each neighbor signature in a chunk's context.
+const maxSignatureBytes = 120
+
+// addNeighborContext sets NeighborContext on each chunk to the signatures
+// of the chunks before and after it in the file. chunks must be sorted by
+// position. The summary gives the embedder a hint of where the chunk sits
+// (the struct a method follows, the helper it precedes) for a few dozen
+// bytes instead of a second embedding.
+func addNeighborContext(chunks []Chunk) {
+	sigs := make([]string, len(chunks))
+	for i := range chunks {
+		sigs[i] = signature(chunks[i].EmbeddingInput())
+	}
+
+	for i := range chunks {
+		var lines []string
+		if i > 0 && sigs[i-1] != "" {
+			lines = append(lines, "previous: "+sigs[i-1])
+		}
+		if i+1 < len(chunks) && sigs[i+1] != "" {
+			lines = append(lines, "next: "+sigs[i+1])
+		}
+		chunks[i].NeighborContext = strings.Join(lines, "\n")
+	}
+}
+
+// signature returns the first non-blank line of text, trimmed and capped at
+// maxSignatureBytes. For functions and types that is the declaration line.
+func signature(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if len(line) > maxSignatureBytes {
+			cut := maxSignatureBytes
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			line = line[:cut]
+		}
+		return line
+	}
+	return ""
+}
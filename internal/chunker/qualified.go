@@ -0,0 +1,110 @@
+package chunker
+
+import (
+	"slices"
+	"strings"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// packageScope returns the initial scope of a file: its package or
+// namespace if the language declares one (Go, Java, PHP), else nothing.
+func packageScope(root *sitter.Node, content []byte, config *LanguageConfig) []string {
+	if config.PackageNode == "" {
+		return nil
+	}
+	for i := 0; i < int(root.NamedChildCount()); i++ {
+		child := root.NamedChild(i)
+		if child.Type() != config.PackageNode {
+			continue
+		}
+		nameNode := child.ChildByFieldName("name")
+		if nameNode == nil && child.NamedChildCount() > 0 {
+			nameNode = child.NamedChild(0)
+		}
+		if nameNode == nil {
+			return nil
+		}
+		return []string{nodeText(nameNode, content)}
+	}
+	return nil
+}
+
+// innerScope returns the scope of node's children: scope plus node's name
+// if node is one of the language's scope nodes.
+func innerScope(node *sitter.Node, content []byte, config *LanguageConfig, scope []string) []string {
+	if !slices.Contains(config.ScopeNodes, node.Type()) {
+		return scope
+	}
+	name := scopeName(node, content, config)
+	if name == "" {
+		return scope
+	}
+	return append(scope[:len(scope):len(scope)], name)
+}
+
+// scopeName returns the name a scope node gives its members. Rust impl
+// blocks have no name of their own and use the implemented type's.
+func scopeName(node *sitter.Node, content []byte, config *LanguageConfig) string {
+	for _, field := range config.NameFields {
+		if nameNode := node.ChildByFieldName(field); nameNode != nil {
+			return nodeText(nameNode, content)
+		}
+	}
+	if typeNode := node.ChildByFieldName("type"); typeNode != nil {
+		return baseTypeName(nodeText(typeNode, content))
+	}
+	for i := 0; i < int(node.NamedChildCount()); i++ {
+		if child := node.NamedChild(i); slices.Contains(config.NameNodes, child.Type()) {
+			return nodeText(child, content)
+		}
+	}
+	return ""
+}
+
+// qualifiedName joins scope, the receiver type of a method and name into
+// a dotted symbol path. It returns "" for unnamed nodes.
+func qualifiedName(node *sitter.Node, content []byte, config *LanguageConfig, scope []string, name string) string {
+	if name == "" {
+		return ""
+	}
+	parts := slices.Clone(scope)
+	if config.ReceiverField != "" {
+		if receiver := node.ChildByFieldName(config.ReceiverField); receiver != nil {
+			if typeNode := findDescendant(receiver, "type_identifier"); typeNode != nil {
+				parts = append(parts, nodeText(typeNode, content))
+			}
+		}
+	}
+	return strings.Join(append(parts, name), ".")
+}
+
+// findDescendant returns the first node of the given type under node in
+// document order, or nil.
+func findDescendant(node *sitter.Node, nodeType string) *sitter.Node {
+	for i := 0; i < int(node.NamedChildCount()); i++ {
+		child := node.NamedChild(i)
+		if child.Type() == nodeType {
+			return child
+		}
+		if found := findDescendant(child, nodeType); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// baseTypeName strips type arguments and references from a type, so
+// "&mut Cache<K, V>" becomes "Cache".
+func baseTypeName(typ string) string {
+	typ = strings.TrimLeft(typ, "&*")
+	typ = strings.TrimPrefix(typ, "mut ")
+	if i := strings.IndexAny(typ, "<["); i >= 0 {
+		typ = typ[:i]
+	}
+	return strings.TrimSpace(typ)
+}
+
+func nodeText(node *sitter.Node, content []byte) string {
+	return string(content[node.StartByte():node.EndByte()])
+}
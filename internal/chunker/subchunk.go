@@ -0,0 +1,176 @@
+package chunker
+
+import (
+	"hash/fnv"
+	"strings"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// splitLargeChunks replaces chunks longer than twice target lines with
+// content-defined sub-chunks averaging about target lines each.
+//
+// Boundaries are chosen from the text of each line rather than fixed
+// offsets, so inserting or deleting lines only moves the boundaries next
+// to the edit. A small change to a large function then re-embeds one
+// sub-chunk instead of the whole function, at the cost of splitting the
+// function's meaning across several vectors.
+func splitLargeChunks(chunks []Chunk, target int) []Chunk {
+	if target <= 0 {
+		return chunks
+	}
+
+	out := make([]Chunk, 0, len(chunks))
+	for _, chunk := range chunks {
+		if chunk.LineCount() <= 2*target {
+			out = append(out, chunk)
+			continue
+		}
+		out = append(out, subChunks(chunk, target)...)
+	}
+	return out
+}
+
+// subChunks splits one chunk at content-defined line boundaries. A line
+// ends a sub-chunk when at least target/2 lines have accumulated and
+// either the line's hash hits the boundary condition (1 in target/2
+// lines, for an average size of target) or 2*target lines have
+// accumulated. A short tail is merged into the previous sub-chunk.
+func subChunks(chunk Chunk, target int) []Chunk {
+	lines := strings.Split(chunk.Content, "\n")
+	minLines := max(2, target/2)
+	maxLines := 2 * target
+	period := max(1, target-minLines)
+
+	var ends []int // Exclusive line index ending each sub-chunk
+	start := 0
+	for i, line := range lines {
+		size := i - start + 1
+		if size >= minLines && (isBoundary(line, period) || size >= maxLines) {
+			ends = append(ends, i+1)
+			start = i + 1
+		}
+	}
+	if start < len(lines) {
+		if len(ends) > 0 && len(lines)-start < minLines {
+			ends[len(ends)-1] = len(lines)
+		} else {
+			ends = append(ends, len(lines))
+		}
+	}
+	return partsAt(chunk, lines, ends)
+}
+
+// partsAt splits chunk, whose content is lines, into parts ending before
+// each line index in ends, the last of which is len(lines). A single part
+// returns chunk unchanged.
+func partsAt(chunk Chunk, lines []string, ends []int) []Chunk {
+	if len(ends) <= 1 {
+		return []Chunk{chunk}
+	}
+
+	parts := make([]Chunk, 0, len(ends))
+	from, offset := 0, chunk.StartByte
+	for _, to := range ends {
+		text := strings.Join(lines[from:to], "\n")
+		end := offset + len(text)
+		if to < len(lines) {
+			end++ // Trailing newline belongs to this part's byte range
+		}
+		parts = append(parts, Chunk{
+			Path:      chunk.Path,
+			StartLine: chunk.StartLine + from,
+			EndLine:   chunk.StartLine + to - 1,
+			StartByte: offset,
+			EndByte:   end,
+			Content:   text,
+			NodeType:  chunk.NodeType,
+			NodeName:  chunk.NodeName,
+			Language:  chunk.Language,
+			PartIndex: len(parts) + 1,
+
+			QualifiedName: chunk.QualifiedName,
+		})
+		from, offset = to, end
+	}
+	return parts
+}
+
+// isBoundary reports whether a line ends a sub-chunk, which holds for
+// about one line in period. Leading and trailing whitespace is ignored so
+// re-indenting does not move boundaries.
+func isBoundary(line string, period int) bool {
+	h := fnv.New32a()
+	h.Write([]byte(strings.TrimSpace(line)))
+
+	// FNV's low bits vary little between similar lines; finish with the
+	// murmur3 mixer before taking the modulus.
+	x := h.Sum32()
+	x ^= x >> 16
+	x *= 0x85ebca6b
+	x ^= x >> 13
+	x *= 0xc2b2ae35
+	x ^= x >> 16
+	return x%uint32(period) == 0
+}
+
+// oversizedParts splits chunk, made from node, into parts of at most
+// maxSize bytes where its lines allow. Parts end after a statement where
+// possible: after one of the named children of node or of the nodes
+// holding most of it, such as a function's body and the loop filling it.
+// A line longer than maxSize is a part of its own.
+func oversizedParts(node *sitter.Node, chunk Chunk, maxSize int) []Chunk {
+	lines := strings.Split(chunk.Content, "\n")
+	firstRow := chunk.StartLine - 1
+
+	breaks := make(map[int]bool) // Line indexes a part may end on
+	for _, n := range statementNodes(node) {
+		breaks[int(n.EndPoint().Row)-firstRow] = true
+	}
+
+	var ends []int
+	start, size, lastBreak := 0, 0, -1
+	for i, line := range lines {
+		size += len(line) + 1
+		if size > maxSize && i > start {
+			end := i
+			if lastBreak >= start {
+				end = lastBreak + 1
+			}
+			ends = append(ends, end)
+			start, size, lastBreak = end, 0, -1
+			for _, l := range lines[start : i+1] {
+				size += len(l) + 1
+			}
+		}
+		if breaks[i] {
+			lastBreak = i
+		}
+	}
+	ends = append(ends, len(lines))
+	return partsAt(chunk, lines, ends)
+}
+
+// statementNodes returns the named children of node and of each node
+// below it holding at least half of node, following the largest child.
+func statementNodes(node *sitter.Node) []*sitter.Node {
+	span := func(n *sitter.Node) uint32 { return n.EndByte() - n.StartByte() }
+
+	var nodes []*sitter.Node
+	cur := node
+	for depth := 0; depth < MaxTreeDepth; depth++ {
+		var largest *sitter.Node
+		for i := 0; i < int(cur.NamedChildCount()); i++ {
+			child := cur.NamedChild(i)
+			nodes = append(nodes, child)
+			if largest == nil || span(child) > span(largest) {
+				largest = child
+			}
+		}
+		if largest == nil || 2*span(largest) < span(node) {
+			break
+		}
+		cur = largest
+	}
+	return nodes
+}
@@ -0,0 +1,100 @@
+package chunker
+
+import (
+	"strings"
+	"unicode"
+)
+
+// TokenEstimator estimates how many tokens an embedding model's tokenizer
+// makes of text. Callers with the model's real tokenizer can wrap it to
+// size chunks exactly.
+type TokenEstimator interface {
+	Estimate(text string) int
+}
+
+// HeuristicEstimator estimates tokens without a tokenizer: a quarter of
+// the letters, digits and whitespace, plus one per punctuation or symbol
+// character, which tokenizers such as nomic-embed-text's WordPiece split
+// into tokens of their own. Code is dense in those, so this estimates it
+// higher than the usual characters/4 and errs on the side of smaller
+// chunks.
+type HeuristicEstimator struct{}
+
+// Estimate implements TokenEstimator.
+func (HeuristicEstimator) Estimate(text string) int {
+	var chars, symbols int
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) || r == '_' {
+			chars++
+		} else {
+			symbols++
+		}
+	}
+	return (chars+3)/4 + symbols
+}
+
+// splitByTokens splits chunks estimated at more than maxTokens tokens into
+// parts of whole lines within it, so a model that truncates long input
+// still sees all of each chunk. A line over maxTokens is a part of its
+// own. Parts are numbered by PartIndex, continuing the numbering of a
+// node already split. A nil estimator is a HeuristicEstimator.
+func splitByTokens(chunks []Chunk, estimator TokenEstimator, maxTokens int) []Chunk {
+	if maxTokens <= 0 {
+		return chunks
+	}
+	if estimator == nil {
+		estimator = HeuristicEstimator{}
+	}
+
+	out := make([]Chunk, 0, len(chunks))
+	part := 0 // Last PartIndex given to the parts of the current node
+	for _, chunk := range chunks {
+		if chunk.PartIndex <= 1 {
+			part = 0
+		}
+		pieces := []Chunk{chunk}
+		if estimator.Estimate(chunk.Content) > maxTokens {
+			pieces = tokenParts(chunk, estimator, maxTokens)
+		}
+		if chunk.PartIndex > 0 || len(pieces) > 1 {
+			for i := range pieces {
+				part++
+				pieces[i].PartIndex = part
+			}
+		}
+		out = append(out, pieces...)
+	}
+	return out
+}
+
+// tokenParts splits chunk at the last line boundary before each part
+// would exceed maxTokens.
+func tokenParts(chunk Chunk, estimator TokenEstimator, maxTokens int) []Chunk {
+	lines := strings.Split(chunk.Content, "\n")
+
+	var ends []int
+	tokens := 0
+	for i, line := range lines {
+		n := estimator.Estimate(line + "\n")
+		if tokens+n > maxTokens && tokens > 0 {
+			ends = append(ends, i)
+			tokens = 0
+		}
+		tokens += n
+	}
+	ends = append(ends, len(lines))
+	return partsAt(chunk, lines, ends)
+}
+
+// splitHashedByTokens is splitByTokens for chunks whose hashes are
+// already computed, as fallback chunks are: parts are hashed too if hash
+// is set.
+func splitHashedByTokens(chunks []Chunk, estimator TokenEstimator, maxTokens int, hash bool) []Chunk {
+	split := splitByTokens(chunks, estimator, maxTokens)
+	if hash && len(split) != len(chunks) {
+		for i := range split {
+			split[i].ComputeHash()
+		}
+	}
+	return split
+}
@@ -0,0 +1,182 @@
+package chunker
+
+import (
+	"regexp"
+	"strings"
+)
+
+// functionNodes are the node types of functions, methods and constructors
+// in the supported languages; only chunks of these can be trivial.
+var functionNodes = map[string]bool{
+	"function_declaration":    true,
+	"method_declaration":      true,
+	"constructor_declaration": true,
+	"function_definition":     true,
+	"decorated_definition":    true,
+	"method_definition":       true,
+	"arrow_function":          true,
+	"function_item":           true,
+	"method":                  true,
+	"singleton_method":        true,
+}
+
+// maxTrivialLines is the longest chunk, in non-blank lines, that IsTrivial
+// can classify as trivial.
+const maxTrivialLines = 15
+
+var (
+	// return name, return u.name, return "x", return 0
+	trivialReturn = regexp.MustCompile(`^return\s+(&?(\$this->)?[\w.]+|"[^"]*"|'[^']*'|-?\d+)$`)
+	// An implicit return of a field: self.name, &self.name, @name
+	trivialField = regexp.MustCompile(`^(&?self\.\w+(\.clone\(\))?|@\w+)$`)
+	// A field set from a parameter or literal: this.name = name, @name = name
+	trivialAssign = regexp.MustCompile(`^(self\.|this\.|\$this->|@|\w+\.)\w+\s*=\s*(\$?[\w.]+|"[^"]*"|'[^']*'|-?\d+)$`)
+	// A composite literal built from fields: return &Config{Name: name}
+	trivialLiteral = regexp.MustCompile(`^return\s+&?[\w.]+\{[^{}();]*\}$`)
+)
+
+// IsTrivial reports whether c is a function or method with little search
+// value: an empty body, a getter returning a field or literal, a setter
+// making one assignment, or a constructor that only copies its parameters
+// into fields or a struct literal. Bodies with calls, conditions or more
+// than one other statement are never trivial, and neither are parts of a
+// split function. Comments and docstrings are ignored.
+func IsTrivial(c Chunk) bool {
+	if !functionNodes[c.NodeType] || c.PartIndex > 0 {
+		return false
+	}
+	lines := codeLines(c.Content, c.Language)
+	if len(lines) == 0 || len(lines) > maxTrivialLines {
+		return false
+	}
+
+	body, ok := functionBody(lines, c.Language)
+	if !ok {
+		return false
+	}
+	var stmts []string
+	for _, line := range body {
+		for _, stmt := range strings.Split(line, ";") {
+			stmt = strings.TrimSpace(stmt)
+			if stmt != "" && stmt != "pass" && stmt != "end" {
+				stmts = append(stmts, stmt)
+			}
+		}
+	}
+
+	switch {
+	case len(stmts) == 0:
+		return true
+	case len(stmts) == 1 && (trivialReturn.MatchString(stmts[0]) || trivialField.MatchString(stmts[0])):
+		return true
+	case trivialLiteral.MatchString(strings.Join(stmts, " ")):
+		return true
+	}
+	for _, stmt := range stmts {
+		if !trivialAssign.MatchString(stmt) {
+			return false
+		}
+	}
+	return true
+}
+
+// codeLines returns the trimmed, non-blank lines of content that are not
+// comments, docstrings or decorators.
+func codeLines(content, language string) []string {
+	var lines []string
+	inDocstring := false
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if language == "python" && (strings.HasPrefix(line, `"""`) || strings.HasPrefix(line, "'''")) {
+			if len(line) < 6 || !(strings.HasSuffix(line, `"""`) || strings.HasSuffix(line, "'''")) {
+				inDocstring = !inDocstring
+			}
+			continue
+		}
+		if inDocstring || line == "" || isCommentLine(line, language) {
+			continue
+		}
+		if language == "python" && strings.HasPrefix(line, "@") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// isCommentLine reports whether a trimmed line is a whole-line comment.
+func isCommentLine(line, language string) bool {
+	for _, prefix := range []string{"//", "/*", "*"} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return strings.HasPrefix(line, "#") && (language == "python" || language == "ruby")
+}
+
+// functionBody returns the body of a function's code lines, without its
+// signature and closing brace or end. It returns false if the body cannot
+// be found.
+func functionBody(lines []string, language string) ([]string, bool) {
+	switch language {
+	case "python":
+		// def name(self) -> int: return self._n
+		for i, line := range lines {
+			if strings.HasPrefix(line, "def ") || strings.HasPrefix(line, "async def ") {
+				if colon := strings.LastIndex(line, ":"); colon >= 0 && colon < len(line)-1 {
+					return append([]string{line[colon+1:]}, lines[i+1:]...), true
+				}
+				return lines[i+1:], strings.HasSuffix(line, ":")
+			}
+		}
+		return nil, false
+	case "ruby":
+		// def name; @name; end, or def name = @name
+		first, rest := lines[0], lines[1:]
+		if eq := strings.Index(first, ") ="); eq >= 0 {
+			return []string{first[eq+3:]}, true
+		}
+		if _, after, ok := strings.Cut(first, ";"); ok {
+			return append([]string{after}, rest...), true
+		}
+		return rest, true
+	}
+
+	for i, line := range lines {
+		open := openingBrace(line)
+		if open < 0 {
+			continue
+		}
+		body := append([]string{line[open+1:]}, lines[i+1:]...)
+		last := strings.TrimSpace(body[len(body)-1])
+		if !strings.HasSuffix(last, "}") {
+			return nil, false
+		}
+		body[len(body)-1] = strings.TrimSuffix(last, "}")
+		return body, true
+	}
+	// (x) => x.name
+	if _, after, ok := strings.Cut(strings.Join(lines, " "), "=>"); ok {
+		return []string{"return " + strings.TrimSpace(after)}, true
+	}
+	return nil, false
+}
+
+// openingBrace returns the index of the first "{" in line outside
+// parentheses, where a function body opens, or -1.
+func openingBrace(line string) int {
+	depth := 0
+	for i, r := range line {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case '{':
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
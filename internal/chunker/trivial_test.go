@@ -0,0 +1,94 @@
+package chunker
+
+import (
+	"context"
+	"testing"
+)
+
+func TestIsTrivial(t *testing.T) {
+	tests := []struct {
+		name     string
+		language string
+		nodeType string
+		content  string
+		want     bool
+	}{
+		{"go getter", "go", "method_declaration",
+			"func (u *User) Name() string {\n\treturn u.name\n}", true},
+		{"go one-line getter", "go", "method_declaration",
+			"func (u *User) Name() string { return u.name }", true},
+		{"go setter", "go", "method_declaration",
+			"// SetName sets the name.\nfunc (u *User) SetName(name string) {\n\tu.name = name\n}", true},
+		{"go constructor", "go", "function_declaration",
+			"func NewUser(name string, age int) *User {\n\treturn &User{\n\t\tname: name,\n\t\tage:  age,\n\t}\n}", true},
+		{"go empty", "go", "method_declaration", "func (n noop) Close() {}", true},
+		{"go substantive", "go", "function_declaration",
+			"func Sum(xs []int) int {\n\ttotal := 0\n\tfor _, x := range xs {\n\t\ttotal += x\n\t}\n\treturn total\n}", false},
+		{"go call", "go", "method_declaration",
+			"func (u *User) Name() string {\n\treturn strings.ToUpper(u.name)\n}", false},
+		{"go type", "go", "type_declaration", "type User struct {\n\tname string\n}", false},
+		{"java getter", "java", "method_declaration",
+			"public String getName() {\n    return this.name;\n}", true},
+		{"java constructor", "java", "constructor_declaration",
+			"public User(String name, int age) {\n    this.name = name;\n    this.age = age;\n}", true},
+		{"java validating setter", "java", "method_declaration",
+			"public void setAge(int age) {\n    if (age < 0) {\n        throw new IllegalArgumentException();\n    }\n    this.age = age;\n}", false},
+		{"python property", "python", "decorated_definition",
+			"@property\ndef name(self):\n    \"\"\"The user's name.\"\"\"\n    return self._name", true},
+		{"python init", "python", "function_definition",
+			"def __init__(self, name, age):\n    self.name = name\n    self.age = age", true},
+		{"python pass", "python", "function_definition", "def hook(self):\n    pass", true},
+		{"python substantive", "python", "function_definition",
+			"def load(path):\n    with open(path) as f:\n        return json.load(f)", false},
+		{"ruby reader", "ruby", "method", "def name\n  @name\nend", true},
+		{"ruby substantive", "ruby", "method", "def name\n  @name ||= fetch_name\nend", false},
+		{"rust getter", "rust", "function_item", "pub fn name(&self) -> &str {\n    &self.name\n}", true},
+		{"javascript getter", "javascript", "method_definition", "getName() {\n  return this.name;\n}", true},
+		{"typescript arrow", "typescript", "arrow_function", "(user) => user.id", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Chunk{Content: tt.content, Language: tt.language, NodeType: tt.nodeType}
+			if got := IsTrivial(c); got != tt.want {
+				t.Errorf("IsTrivial(%q) = %v, want %v", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsTrivialChunkedFile(t *testing.T) {
+	content := `package user
+
+type User struct {
+	name string
+}
+
+func (u *User) Name() string {
+	return u.name
+}
+
+func (u *User) Greeting(formal bool) string {
+	if formal {
+		return "Dear " + u.name
+	}
+	return "Hi " + u.name
+}
+`
+	chunks, err := NewASTChunker().ChunkFile(context.Background(), "user.go", []byte(content))
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+	trivial := make(map[string]bool)
+	for _, c := range chunks {
+		trivial[c.NodeName] = IsTrivial(c)
+	}
+	if !trivial["Name"] {
+		t.Error("getter Name is not trivial")
+	}
+	if trivial["Greeting"] {
+		t.Error("Greeting is trivial")
+	}
+	if trivial["User"] {
+		t.Error("type User is trivial")
+	}
+}
@@ -0,0 +1,306 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ChunkingConfig controls how source is split into chunks and what text
+// is sent to the embedder for each chunk.
+type ChunkingConfig struct {
+	// StripComments removes comment nodes from the text sent to the
+	// embedder. Stored content and snippets are unaffected.
+	// Default: false
+	StripComments bool
+
+	// FileEmbeddings stores a file-level embedding per file (mean of its
+	// chunk vectors) alongside chunk embeddings, for file-granularity search.
+	// Default: false
+	FileEmbeddings bool
+
+	// LanguageMap assigns a language to files matching an extension or
+	// glob, consulted before extension-based detection. Earlier entries
+	// win. Default: empty
+	LanguageMap []LanguageMapping
+
+	// MaxEmbedBytes caps the text sent to the embedder per chunk. Longer
+	// input is truncated (stored content is not), so a single oversized
+	// chunk cannot exceed the provider's limit and fail its batch. 0
+	// disables the cap. Default: 32768 (about 8K tokens)
+	MaxEmbedBytes int
+
+	// SubChunkLines splits large AST nodes into content-defined sub-chunks
+	// of about this many lines, so small edits re-embed only the affected
+	// part. Improves cache reuse on big files at some cost to semantic
+	// coherence. 0 disables sub-chunking. Default: 0
+	SubChunkLines int
+
+	// NeighborContext prepends the signatures of the previous and next
+	// chunks to each chunk's embedder input. The cache key covers only the
+	// chunk's own text plus a version marker, so neighbors' edits do not
+	// trigger re-embedding. Default: false
+	NeighborContext bool
+
+	// QualifiedNames prepends each chunk's symbol path (package, enclosing
+	// classes or receiver, then the symbol, e.g. "auth.Middleware.Handle")
+	// to its embedder input and records it with the chunk's location.
+	// Default: false
+	QualifiedNames bool
+
+	// EmbedPaths prepends each chunk's repo-relative path, which often
+	// names its domain or module, to its embedder input. Chunks are then
+	// cached per path, so identical code in two files is embedded twice
+	// and moved files are re-embedded. Default: false
+	EmbedPaths bool
+
+	// DescribeDataFiles embeds chunks of config and data files (JSON,
+	// YAML, TOML, INI, .env, CSV) by a one-line summary of their path and
+	// keys instead of the raw values, which embed poorly. Stored content is
+	// unaffected. Default: false
+	DescribeDataFiles bool
+
+	// SkipTrivialChunks leaves out of the index functions with little
+	// search value: empty bodies, getters and setters of one field, and
+	// constructors that only copy their parameters (see
+	// chunker.IsTrivial). Default: false
+	SkipTrivialChunks bool
+
+	// TrivialChunkLocations still records the location of chunks skipped
+	// by SkipTrivialChunks, without embedding them, so symbol lookups find
+	// them. Default: false
+	TrivialChunkLocations bool
+
+	// ExportedOnly lists languages ("go", "python") whose files are
+	// indexed by their public symbols only, judged by the language's
+	// visibility convention (see chunker.FilterExported). Languages
+	// without one are indexed in full. Default: empty
+	ExportedOnly []string
+
+	// MaxChunkSize, when positive, is the size in characters above which
+	// a node is split into its children, for every language. 0 keeps each
+	// language's own limit. Default: 0
+	MaxChunkSize int
+
+	// MaxChunkSizes sets the maximum chunk size per language ("java",
+	// "python"), taking precedence over MaxChunkSize. Default: empty
+	MaxChunkSizes map[string]int
+
+	// SkipGaps leaves out chunks of code outside functions, types and
+	// other split nodes, such as imports. Default: false
+	SkipGaps bool
+
+	// ExcludeTests leaves test files out of the index (see
+	// indexer.IsTestFile). Default: false
+	ExcludeTests bool
+
+	// LeadingComments extends each chunk over the comments and decorators
+	// directly above it, such as a doc comment, so they are embedded with
+	// the code they describe. LeadingCommentGap is the number of blank
+	// lines allowed between them. Default: false, 0
+	LeadingComments   bool
+	LeadingCommentGap int
+
+	// SplitOversized replaces a node larger than the maximum chunk size
+	// with its parts, the nodes inside it or else pieces cut at statement
+	// boundaries, instead of also indexing it whole. Default: false
+	SplitOversized bool
+
+	// MaxChunkTokens, when positive, splits chunks estimated at more
+	// tokens than this into parts, since embedding models such as
+	// nomic-embed-text silently truncate longer input (see
+	// chunker.HeuristicEstimator). 0 disables the limit. Default: 0
+	MaxChunkTokens int
+
+	// SplitNestedFunctions lists languages ("javascript", "python") whose
+	// named functions inside other functions are always chunks of their
+	// own, as well as part of the enclosing function, instead of only when
+	// it exceeds the maximum chunk size. Default: empty
+	SplitNestedFunctions []string
+
+	// SplitNodes replaces, per language, the AST node types chunks are
+	// made from. Only set by profiles. Default: empty
+	SplitNodes map[string][]string
+
+	// Profile is the name of the ChunkProfile applied, if any.
+	Profile string
+}
+
+// LanguageMapping maps files matching Pattern (".inc", "*.tmpl",
+// "views/*.html") to a chunker language name ("php", "go").
+type LanguageMapping struct {
+	Pattern  string
+	Language string
+}
+
+// DefaultChunkingConfig returns the default chunking configuration.
+func DefaultChunkingConfig() ChunkingConfig {
+	return ChunkingConfig{
+		StripComments:  false,
+		FileEmbeddings: false,
+		MaxEmbedBytes:  32768,
+	}
+}
+
+// LoadChunkingConfigFromEnv loads chunking configuration from environment variables:
+//   - CODETECT_STRIP_COMMENTS: Strip comments from embedding input (default: false)
+//   - CODETECT_FILE_EMBEDDINGS: Store file-level embeddings (default: false)
+//   - CODETECT_LANGUAGE_MAP: Comma-separated pattern=language pairs,
+//     e.g. ".inc=php,*.tmpl=go" (default: empty)
+//   - CODETECT_EMBED_MAX_BYTES: Max embedder input bytes per chunk, 0 for no limit (default: 32768)
+//   - CODETECT_SUBCHUNK_LINES: Sub-chunk size for large nodes, 0 to disable (default: 0)
+//   - CODETECT_NEIGHBOR_CONTEXT: Embed neighbor signatures with each chunk (default: false)
+//   - CODETECT_QUALIFIED_NAMES: Embed qualified symbol names with each chunk (default: false)
+//   - CODETECT_EMBED_PATHS: Embed the file path with each chunk (default: false)
+//   - CODETECT_DESCRIBE_DATA_FILES: Embed data file chunks by key summary (default: false)
+//   - CODETECT_SKIP_TRIVIAL_CHUNKS: Skip trivial getters, setters and constructors (default: false)
+//   - CODETECT_TRIVIAL_CHUNK_LOCATIONS: Record skipped trivial chunks as locations (default: false)
+//   - CODETECT_EXPORTED_ONLY: Comma-separated languages to index by public symbols only,
+//     e.g. "go,python" (default: empty)
+//   - CODETECT_MAX_CHUNK_SIZE: Split nodes larger than this many characters, 0 for the
+//     language default (default: 0)
+//   - CODETECT_MAX_CHUNK_SIZES: Comma-separated language=size pairs overriding it per
+//     language, e.g. "java=4000,python=1200" (default: empty)
+//   - CODETECT_SKIP_GAPS: Leave out chunks of code between split nodes (default: false)
+//   - CODETECT_EXCLUDE_TESTS: Leave test files out of the index (default: false)
+//   - CODETECT_LEADING_COMMENTS: Include comments and decorators above a symbol in its
+//     chunk (default: false)
+//   - CODETECT_LEADING_COMMENT_GAP: Blank lines allowed between them and the symbol (default: 0)
+//   - CODETECT_SPLIT_OVERSIZED: Index oversized nodes only as parts (default: false)
+//   - CODETECT_MAX_CHUNK_TOKENS: Split chunks estimated at more tokens, 0 for no limit
+//     (default: 0)
+//   - CODETECT_SPLIT_NESTED_FUNCTIONS: Comma-separated languages whose named nested
+//     functions are always chunks of their own, e.g. "javascript,python" (default: empty)
+//   - CODETECT_CHUNK_PROFILE: Named profile applied before the variables above (see
+//     LoadChunkingConfig)
+//
+// An unknown profile or unreadable profiles file is ignored; use
+// LoadChunkingConfig to report it.
+func LoadChunkingConfigFromEnv() ChunkingConfig {
+	cfg, _ := LoadChunkingConfig("")
+	return cfg
+}
+
+// applyChunkingEnv overrides cfg with the variables read by
+// LoadChunkingConfigFromEnv that are set.
+func applyChunkingEnv(cfg *ChunkingConfig) {
+	if v := os.Getenv("CODETECT_STRIP_COMMENTS"); v != "" {
+		cfg.StripComments = parseBool(v, cfg.StripComments)
+	}
+	if v := os.Getenv("CODETECT_FILE_EMBEDDINGS"); v != "" {
+		cfg.FileEmbeddings = parseBool(v, cfg.FileEmbeddings)
+	}
+	if v := os.Getenv("CODETECT_LANGUAGE_MAP"); v != "" {
+		cfg.LanguageMap = ParseLanguageMap(v)
+	}
+	if v := os.Getenv("CODETECT_EMBED_MAX_BYTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.MaxEmbedBytes = n
+		}
+	}
+	if v := os.Getenv("CODETECT_NEIGHBOR_CONTEXT"); v != "" {
+		cfg.NeighborContext = parseBool(v, cfg.NeighborContext)
+	}
+	if v := os.Getenv("CODETECT_QUALIFIED_NAMES"); v != "" {
+		cfg.QualifiedNames = parseBool(v, cfg.QualifiedNames)
+	}
+	if v := os.Getenv("CODETECT_EMBED_PATHS"); v != "" {
+		cfg.EmbedPaths = parseBool(v, cfg.EmbedPaths)
+	}
+	if v := os.Getenv("CODETECT_DESCRIBE_DATA_FILES"); v != "" {
+		cfg.DescribeDataFiles = parseBool(v, cfg.DescribeDataFiles)
+	}
+	if v := os.Getenv("CODETECT_SKIP_TRIVIAL_CHUNKS"); v != "" {
+		cfg.SkipTrivialChunks = parseBool(v, cfg.SkipTrivialChunks)
+	}
+	if v := os.Getenv("CODETECT_TRIVIAL_CHUNK_LOCATIONS"); v != "" {
+		cfg.TrivialChunkLocations = parseBool(v, cfg.TrivialChunkLocations)
+	}
+	if v := os.Getenv("CODETECT_EXPORTED_ONLY"); v != "" {
+		cfg.ExportedOnly = ParseLanguageList(v)
+	}
+	if v := os.Getenv("CODETECT_SUBCHUNK_LINES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.SubChunkLines = n
+		}
+	}
+	if v := os.Getenv("CODETECT_MAX_CHUNK_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.MaxChunkSize = n
+		}
+	}
+	if v := os.Getenv("CODETECT_MAX_CHUNK_SIZES"); v != "" {
+		cfg.MaxChunkSizes = ParseLanguageSizes(v)
+	}
+	if v := os.Getenv("CODETECT_SKIP_GAPS"); v != "" {
+		cfg.SkipGaps = parseBool(v, cfg.SkipGaps)
+	}
+	if v := os.Getenv("CODETECT_EXCLUDE_TESTS"); v != "" {
+		cfg.ExcludeTests = parseBool(v, cfg.ExcludeTests)
+	}
+	if v := os.Getenv("CODETECT_LEADING_COMMENTS"); v != "" {
+		cfg.LeadingComments = parseBool(v, cfg.LeadingComments)
+	}
+	if v := os.Getenv("CODETECT_LEADING_COMMENT_GAP"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.LeadingCommentGap = n
+		}
+	}
+	if v := os.Getenv("CODETECT_SPLIT_OVERSIZED"); v != "" {
+		cfg.SplitOversized = parseBool(v, cfg.SplitOversized)
+	}
+	if v := os.Getenv("CODETECT_MAX_CHUNK_TOKENS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.MaxChunkTokens = n
+		}
+	}
+	if v := os.Getenv("CODETECT_SPLIT_NESTED_FUNCTIONS"); v != "" {
+		cfg.SplitNestedFunctions = ParseLanguageList(v)
+	}
+}
+
+// ParseLanguageMap parses comma-separated pattern=language pairs.
+// Malformed entries are skipped.
+func ParseLanguageMap(s string) []LanguageMapping {
+	var mappings []LanguageMapping
+	for _, entry := range strings.Split(s, ",") {
+		pattern, language, ok := strings.Cut(entry, "=")
+		pattern = strings.TrimSpace(pattern)
+		language = strings.ToLower(strings.TrimSpace(language))
+		if !ok || pattern == "" || language == "" {
+			continue
+		}
+		mappings = append(mappings, LanguageMapping{Pattern: pattern, Language: language})
+	}
+	return mappings
+}
+
+// ParseLanguageList parses a comma-separated list of language names
+// ("go, Python"), lower-cased, skipping empty entries.
+func ParseLanguageList(s string) []string {
+	var languages []string
+	for _, entry := range strings.Split(s, ",") {
+		if language := strings.ToLower(strings.TrimSpace(entry)); language != "" {
+			languages = append(languages, language)
+		}
+	}
+	return languages
+}
+
+// ParseLanguageSizes parses comma-separated language=size pairs
+// ("java=4000, Python=1200"), with lower-cased language names. Entries
+// without a language or a positive size are skipped.
+func ParseLanguageSizes(s string) map[string]int {
+	sizes := make(map[string]int)
+	for _, entry := range strings.Split(s, ",") {
+		language, size, ok := strings.Cut(entry, "=")
+		language = strings.ToLower(strings.TrimSpace(language))
+		if !ok || language == "" {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(size)); err == nil && n > 0 {
+			sizes[language] = n
+		}
+	}
+	return sizes
+}
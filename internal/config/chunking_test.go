@@ -0,0 +1,158 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadChunkingConfigLanguageMap(t *testing.T) {
+	t.Setenv("CODETECT_LANGUAGE_MAP", ".inc=php, *.tmpl = Go ,broken,=ruby")
+
+	cfg := LoadChunkingConfigFromEnv()
+	want := []LanguageMapping{
+		{Pattern: ".inc", Language: "php"},
+		{Pattern: "*.tmpl", Language: "go"},
+	}
+	if !reflect.DeepEqual(cfg.LanguageMap, want) {
+		t.Errorf("LanguageMap = %+v, want %+v", cfg.LanguageMap, want)
+	}
+}
+
+func TestLoadChunkingConfigMaxEmbedBytes(t *testing.T) {
+	if got := DefaultChunkingConfig().MaxEmbedBytes; got != 32768 {
+		t.Errorf("default MaxEmbedBytes = %d, want 32768", got)
+	}
+
+	t.Setenv("CODETECT_EMBED_MAX_BYTES", "0")
+	if got := LoadChunkingConfigFromEnv().MaxEmbedBytes; got != 0 {
+		t.Errorf("MaxEmbedBytes = %d, want 0 (disabled)", got)
+	}
+
+	t.Setenv("CODETECT_EMBED_MAX_BYTES", "-5")
+	if got := LoadChunkingConfigFromEnv().MaxEmbedBytes; got != 32768 {
+		t.Errorf("MaxEmbedBytes = %d, want default for invalid input", got)
+	}
+}
+
+func TestLoadChunkingConfigMaxChunkSizes(t *testing.T) {
+	if cfg := DefaultChunkingConfig(); len(cfg.MaxChunkSizes) != 0 {
+		t.Errorf("MaxChunkSizes = %v by default, want empty", cfg.MaxChunkSizes)
+	}
+
+	t.Setenv("CODETECT_MAX_CHUNK_SIZES", "Java=4000, python = 1200,ruby=0,go=big,=10")
+	cfg := LoadChunkingConfigFromEnv()
+	if want := map[string]int{"java": 4000, "python": 1200}; !reflect.DeepEqual(cfg.MaxChunkSizes, want) {
+		t.Errorf("MaxChunkSizes = %v, want %v", cfg.MaxChunkSizes, want)
+	}
+}
+
+func TestLoadChunkingConfigEmbedPaths(t *testing.T) {
+	if DefaultChunkingConfig().EmbedPaths {
+		t.Error("EmbedPaths is on by default")
+	}
+
+	t.Setenv("CODETECT_EMBED_PATHS", "true")
+	if !LoadChunkingConfigFromEnv().EmbedPaths {
+		t.Error("EmbedPaths = false, want true")
+	}
+}
+
+func TestLoadChunkingConfigSkipTrivialChunks(t *testing.T) {
+	if cfg := DefaultChunkingConfig(); cfg.SkipTrivialChunks || cfg.TrivialChunkLocations {
+		t.Error("trivial chunks are skipped by default")
+	}
+
+	t.Setenv("CODETECT_SKIP_TRIVIAL_CHUNKS", "true")
+	t.Setenv("CODETECT_TRIVIAL_CHUNK_LOCATIONS", "1")
+	cfg := LoadChunkingConfigFromEnv()
+	if !cfg.SkipTrivialChunks || !cfg.TrivialChunkLocations {
+		t.Errorf("SkipTrivialChunks = %v, TrivialChunkLocations = %v, want true", cfg.SkipTrivialChunks, cfg.TrivialChunkLocations)
+	}
+}
+
+func TestLoadChunkingConfigExportedOnly(t *testing.T) {
+	if cfg := DefaultChunkingConfig(); len(cfg.ExportedOnly) != 0 {
+		t.Errorf("ExportedOnly = %v by default, want empty", cfg.ExportedOnly)
+	}
+
+	t.Setenv("CODETECT_EXPORTED_ONLY", "go, Python,,")
+	cfg := LoadChunkingConfigFromEnv()
+	if !reflect.DeepEqual(cfg.ExportedOnly, []string{"go", "python"}) {
+		t.Errorf("ExportedOnly = %v, want [go python]", cfg.ExportedOnly)
+	}
+}
+
+func TestLoadChunkingConfigLeadingComments(t *testing.T) {
+	if cfg := LoadChunkingConfigFromEnv(); cfg.LeadingComments || cfg.LeadingCommentGap != 0 {
+		t.Errorf("LeadingComments = %v, LeadingCommentGap = %d by default; want false, 0",
+			cfg.LeadingComments, cfg.LeadingCommentGap)
+	}
+
+	t.Setenv("CODETECT_LEADING_COMMENTS", "true")
+	t.Setenv("CODETECT_LEADING_COMMENT_GAP", "1")
+	cfg := LoadChunkingConfigFromEnv()
+	if !cfg.LeadingComments || cfg.LeadingCommentGap != 1 {
+		t.Errorf("LeadingComments = %v, LeadingCommentGap = %d; want true, 1",
+			cfg.LeadingComments, cfg.LeadingCommentGap)
+	}
+
+	t.Setenv("CODETECT_LEADING_COMMENT_GAP", "-1")
+	if cfg := LoadChunkingConfigFromEnv(); cfg.LeadingCommentGap != 0 {
+		t.Errorf("LeadingCommentGap = %d for a negative value, want 0", cfg.LeadingCommentGap)
+	}
+}
+
+func TestLoadChunkingConfigSplitOversized(t *testing.T) {
+	if LoadChunkingConfigFromEnv().SplitOversized {
+		t.Error("SplitOversized is on by default")
+	}
+
+	t.Setenv("CODETECT_SPLIT_OVERSIZED", "true")
+	if !LoadChunkingConfigFromEnv().SplitOversized {
+		t.Error("SplitOversized = false, want true")
+	}
+}
+
+func TestLoadChunkingConfigMaxChunkTokens(t *testing.T) {
+	if got := LoadChunkingConfigFromEnv().MaxChunkTokens; got != 0 {
+		t.Errorf("MaxChunkTokens = %d by default, want 0", got)
+	}
+
+	t.Setenv("CODETECT_MAX_CHUNK_TOKENS", "512")
+	if got := LoadChunkingConfigFromEnv().MaxChunkTokens; got != 512 {
+		t.Errorf("MaxChunkTokens = %d, want 512", got)
+	}
+
+	t.Setenv("CODETECT_MAX_CHUNK_TOKENS", "lots")
+	if got := LoadChunkingConfigFromEnv().MaxChunkTokens; got != 0 {
+		t.Errorf("MaxChunkTokens = %d for invalid input, want 0", got)
+	}
+}
+
+func TestLoadChunkingConfigSplitNestedFunctions(t *testing.T) {
+	if cfg := DefaultChunkingConfig(); len(cfg.SplitNestedFunctions) != 0 {
+		t.Errorf("SplitNestedFunctions = %v by default, want empty", cfg.SplitNestedFunctions)
+	}
+
+	t.Setenv("CODETECT_SPLIT_NESTED_FUNCTIONS", "JavaScript, python")
+	cfg := LoadChunkingConfigFromEnv()
+	if !reflect.DeepEqual(cfg.SplitNestedFunctions, []string{"javascript", "python"}) {
+		t.Errorf("SplitNestedFunctions = %v, want [javascript python]", cfg.SplitNestedFunctions)
+	}
+
+	// Profiles set it too, and the environment wins
+	t.Setenv("CODETECT_SPLIT_NESTED_FUNCTIONS", "")
+	repo := t.TempDir()
+	writeFile(t, filepath.Join(repo, RepoConfigFile), `{
+  "chunk_profile": "closures",
+  "chunk_profiles": {"closures": {"split_nested_functions": ["rust"]}}
+}`)
+	if cfg, err := LoadChunkingConfig(repo); err != nil || !reflect.DeepEqual(cfg.SplitNestedFunctions, []string{"rust"}) {
+		t.Errorf("LoadChunkingConfig() = %v, %v; want [rust]", cfg.SplitNestedFunctions, err)
+	}
+	t.Setenv("CODETECT_SPLIT_NESTED_FUNCTIONS", "python")
+	if cfg, _ := LoadChunkingConfig(repo); !reflect.DeepEqual(cfg.SplitNestedFunctions, []string{"python"}) {
+		t.Errorf("SplitNestedFunctions = %v with the variable set, want [python]", cfg.SplitNestedFunctions)
+	}
+}
@@ -21,6 +21,38 @@ type DatabaseConfig struct {
 
 	// VectorDimensions is the embedding vector size
 	VectorDimensions int
+
+	// WriteBatchSize is how many embedding cache entries are committed per
+	// transaction (0 = default)
+	WriteBatchSize int
+
+	// LocationBatchSize is how many chunk locations are committed per
+	// transaction (0 = default)
+	LocationBatchSize int
+
+	// WriteWorkers is how many cache or location write transactions may run
+	// in parallel on PostgreSQL (0 = default). SQLite always writes
+	// sequentially.
+	WriteWorkers int
+
+	// BusyTimeout is how long, in milliseconds, SQLite waits for a lock
+	// held by another process, such as the indexer writing while the MCP
+	// server reads (0 = db.DefaultBusyTimeout, negative = fail immediately)
+	BusyTimeout int
+
+	// ReadRetries is how many times PostgreSQL read queries are retried
+	// after the connection is lost (0 = db.DefaultReadRetries, negative =
+	// no retries)
+	ReadRetries int
+
+	// RetryBackoff is the delay, in milliseconds, before the first retry,
+	// doubled for each further one (0 = db.DefaultRetryBackoff)
+	RetryBackoff int
+
+	// CacheEncoding is how the embedding cache stores vectors on SQLite:
+	// "json" (default) or "int8", quantized to about a tenth of the size
+	// at a small loss of precision. PostgreSQL stores native vectors.
+	CacheEncoding string
 }
 
 // LoadDatabaseConfigFromEnv loads database configuration from environment variables.
@@ -29,6 +61,13 @@ type DatabaseConfig struct {
 //   - CODETECT_DB_DSN: Connection string for PostgreSQL
 //   - CODETECT_DB_PATH: Database file path for SQLite
 //   - CODETECT_VECTOR_DIMENSIONS: Vector dimensions (default: 768)
+//   - CODETECT_DB_WRITE_BATCH_SIZE: Cache entries per write transaction
+//   - CODETECT_DB_LOCATION_BATCH_SIZE: Chunk locations per write transaction
+//   - CODETECT_DB_WRITE_WORKERS: Parallel write transactions (PostgreSQL only)
+//   - CODETECT_DB_BUSY_TIMEOUT_MS: SQLite lock wait in milliseconds (default: 5000, 0 = no wait)
+//   - CODETECT_DB_READ_RETRIES: PostgreSQL read retries after connection loss (default: 3, 0 = none)
+//   - CODETECT_DB_RETRY_BACKOFF_MS: Delay before the first retry in milliseconds (default: 100)
+//   - CODETECT_CACHE_ENCODING: Embedding cache vector encoding on SQLite, "json" or "int8" (default: json)
 //
 // If no environment variables are set, defaults to SQLite with standard path.
 func LoadDatabaseConfigFromEnv() DatabaseConfig {
@@ -73,6 +112,66 @@ func LoadDatabaseConfigFromEnv() DatabaseConfig {
 		}
 	}
 
+	// Load cache and location write batching
+	if size := os.Getenv("CODETECT_DB_WRITE_BATCH_SIZE"); size != "" {
+		var n int
+		if _, err := fmt.Sscanf(size, "%d", &n); err == nil && n > 0 {
+			cfg.WriteBatchSize = n
+		}
+	}
+	if size := os.Getenv("CODETECT_DB_LOCATION_BATCH_SIZE"); size != "" {
+		var n int
+		if _, err := fmt.Sscanf(size, "%d", &n); err == nil && n > 0 {
+			cfg.LocationBatchSize = n
+		}
+	}
+	if workers := os.Getenv("CODETECT_DB_WRITE_WORKERS"); workers != "" {
+		var n int
+		if _, err := fmt.Sscanf(workers, "%d", &n); err == nil && n > 0 {
+			cfg.WriteWorkers = n
+		}
+	}
+
+	// Load SQLite lock wait
+	if timeout := os.Getenv("CODETECT_DB_BUSY_TIMEOUT_MS"); timeout != "" {
+		var n int
+		if _, err := fmt.Sscanf(timeout, "%d", &n); err == nil && n >= 0 {
+			cfg.BusyTimeout = n
+			if n == 0 {
+				cfg.BusyTimeout = -1 // Explicit 0 disables waiting
+			}
+		}
+	}
+
+	// Load PostgreSQL read retries
+	if retries := os.Getenv("CODETECT_DB_READ_RETRIES"); retries != "" {
+		var n int
+		if _, err := fmt.Sscanf(retries, "%d", &n); err == nil && n >= 0 {
+			cfg.ReadRetries = n
+			if n == 0 {
+				cfg.ReadRetries = -1 // Explicit 0 disables retries
+			}
+		}
+	}
+	if backoff := os.Getenv("CODETECT_DB_RETRY_BACKOFF_MS"); backoff != "" {
+		var n int
+		if _, err := fmt.Sscanf(backoff, "%d", &n); err == nil && n > 0 {
+			cfg.RetryBackoff = n
+		}
+	}
+
+	// Load embedding cache encoding
+	if enc := os.Getenv("CODETECT_CACHE_ENCODING"); enc != "" {
+		switch strings.ToLower(strings.TrimSpace(enc)) {
+		case "json":
+			cfg.CacheEncoding = "json"
+		case "int8":
+			cfg.CacheEncoding = "int8"
+		default:
+			fmt.Fprintf(os.Stderr, "Warning: Unknown cache encoding %q, using json\n", enc)
+		}
+	}
+
 	return cfg
 }
 
@@ -89,6 +188,8 @@ func (c DatabaseConfig) ToDBConfig() db.Config {
 		}
 		cfg := db.PostgresConfig(c.DSN)
 		cfg.VectorDimensions = c.VectorDimensions
+		cfg.ReadRetries = c.ReadRetries
+		cfg.RetryBackoff = c.RetryBackoff
 		return cfg
 
 	default: // SQLite
@@ -97,7 +198,9 @@ func (c DatabaseConfig) ToDBConfig() db.Config {
 			// Default path if not specified
 			path = ".codetect/symbols.db"
 		}
-		return db.DefaultConfig(path)
+		cfg := db.DefaultConfig(path)
+		cfg.BusyTimeout = c.BusyTimeout
+		return cfg
 	}
 }
 
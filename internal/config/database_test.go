@@ -15,6 +15,9 @@ func TestLoadDatabaseConfigFromEnv(t *testing.T) {
 		"CODETECT_DB_DSN",
 		"CODETECT_DB_PATH",
 		"CODETECT_VECTOR_DIMENSIONS",
+		"CODETECT_DB_WRITE_BATCH_SIZE",
+		"CODETECT_DB_WRITE_WORKERS",
+		"CODETECT_CACHE_ENCODING",
 	}
 	for _, key := range envVars {
 		originalEnv[key] = os.Getenv(key)
@@ -102,6 +105,68 @@ func TestLoadDatabaseConfigFromEnv(t *testing.T) {
 		os.Unsetenv("CODETECT_VECTOR_DIMENSIONS")
 	})
 
+	t.Run("Cache Write Batching", func(t *testing.T) {
+		os.Setenv("CODETECT_DB_WRITE_BATCH_SIZE", "250")
+		os.Setenv("CODETECT_DB_LOCATION_BATCH_SIZE", "2000")
+		os.Setenv("CODETECT_DB_WRITE_WORKERS", "-2")
+
+		cfg := LoadDatabaseConfigFromEnv()
+
+		if cfg.WriteBatchSize != 250 {
+			t.Errorf("Expected write batch size 250, got %d", cfg.WriteBatchSize)
+		}
+		if cfg.LocationBatchSize != 2000 {
+			t.Errorf("Expected location batch size 2000, got %d", cfg.LocationBatchSize)
+		}
+		if cfg.WriteWorkers != 0 {
+			t.Errorf("Expected invalid worker count to be ignored, got %d", cfg.WriteWorkers)
+		}
+
+		os.Unsetenv("CODETECT_DB_WRITE_BATCH_SIZE")
+		os.Unsetenv("CODETECT_DB_LOCATION_BATCH_SIZE")
+		os.Unsetenv("CODETECT_DB_WRITE_WORKERS")
+	})
+
+	t.Run("SQLite Busy Timeout", func(t *testing.T) {
+		os.Setenv("CODETECT_DB_BUSY_TIMEOUT_MS", "12000")
+		cfg := LoadDatabaseConfigFromEnv()
+		if cfg.BusyTimeout != 12000 {
+			t.Errorf("Expected busy timeout 12000, got %d", cfg.BusyTimeout)
+		}
+		if got := cfg.ToDBConfig().BusyTimeout; got != 12000 {
+			t.Errorf("Expected db.Config busy timeout 12000, got %d", got)
+		}
+
+		// 0 turns waiting off rather than selecting the default
+		os.Setenv("CODETECT_DB_BUSY_TIMEOUT_MS", "0")
+		if cfg := LoadDatabaseConfigFromEnv(); cfg.BusyTimeout >= 0 {
+			t.Errorf("Expected negative busy timeout for 0, got %d", cfg.BusyTimeout)
+		}
+
+		os.Unsetenv("CODETECT_DB_BUSY_TIMEOUT_MS")
+		if cfg := LoadDatabaseConfigFromEnv(); cfg.BusyTimeout != 0 {
+			t.Errorf("Expected default busy timeout, got %d", cfg.BusyTimeout)
+		}
+	})
+
+	t.Run("Cache Encoding", func(t *testing.T) {
+		if cfg := LoadDatabaseConfigFromEnv(); cfg.CacheEncoding != "" {
+			t.Errorf("Expected default cache encoding, got %q", cfg.CacheEncoding)
+		}
+
+		os.Setenv("CODETECT_CACHE_ENCODING", "INT8")
+		if cfg := LoadDatabaseConfigFromEnv(); cfg.CacheEncoding != "int8" {
+			t.Errorf("Expected cache encoding int8, got %q", cfg.CacheEncoding)
+		}
+
+		os.Setenv("CODETECT_CACHE_ENCODING", "float16")
+		if cfg := LoadDatabaseConfigFromEnv(); cfg.CacheEncoding != "" {
+			t.Errorf("Expected unknown cache encoding to be ignored, got %q", cfg.CacheEncoding)
+		}
+
+		os.Unsetenv("CODETECT_CACHE_ENCODING")
+	})
+
 	t.Run("Invalid Database Type Falls Back to SQLite", func(t *testing.T) {
 		os.Setenv("CODETECT_DB_TYPE", "invalid")
 
@@ -27,9 +27,20 @@ type HNSWConfig struct {
 
 	// DistanceMetric specifies the distance function for similarity
 	// Options: "cosine" (default), "euclidean", "dot_product"
+	// Set from CODETECT_DISTANCE_METRIC; see LoadDistanceMetricFromEnv
 	DistanceMetric string `yaml:"distance_metric" json:"distance_metric"`
+
+	// MinVectors is the vector count below which search stays brute force
+	// and no native index (HNSW or vec0) is built (default: 1000)
+	// Scanning a few thousand vectors is about as fast as an index lookup,
+	// without the cost of building and maintaining the index
+	// 0 builds the native index from the start
+	MinVectors int `yaml:"min_vectors" json:"min_vectors"`
 }
 
+// DefaultMinVectors is the default HNSWConfig.MinVectors.
+const DefaultMinVectors = 1000
+
 // DefaultHNSWConfig returns sensible defaults for HNSW indexing.
 // These parameters balance recall (>95%) with query performance (<50ms for 100K vectors).
 func DefaultHNSWConfig() HNSWConfig {
@@ -37,7 +48,8 @@ func DefaultHNSWConfig() HNSWConfig {
 		M:              16,
 		EfConstruction: 64,
 		EfSearch:       40,
-		DistanceMetric: "cosine",
+		DistanceMetric: MetricCosine,
+		MinVectors:     DefaultMinVectors,
 	}
 }
 
@@ -48,7 +60,8 @@ func HighRecallHNSWConfig() HNSWConfig {
 		M:              32,
 		EfConstruction: 200,
 		EfSearch:       100,
-		DistanceMetric: "cosine",
+		DistanceMetric: MetricCosine,
+		MinVectors:     DefaultMinVectors,
 	}
 }
 
@@ -59,7 +72,8 @@ func FastQueryHNSWConfig() HNSWConfig {
 		M:              12,
 		EfConstruction: 64,
 		EfSearch:       20,
-		DistanceMetric: "cosine",
+		DistanceMetric: MetricCosine,
+		MinVectors:     DefaultMinVectors,
 	}
 }
 
@@ -68,7 +82,9 @@ func FastQueryHNSWConfig() HNSWConfig {
 //   - CODETECT_HNSW_M: Max connections per layer
 //   - CODETECT_HNSW_EF_CONSTRUCTION: Search width during build
 //   - CODETECT_HNSW_EF_SEARCH: Search width during query
-//   - CODETECT_HNSW_DISTANCE_METRIC: Distance metric (cosine, euclidean, dot_product)
+//   - CODETECT_HNSW_MIN_VECTORS: Vector count to build the native index at
+//   - CODETECT_DISTANCE_METRIC: Distance metric (cosine, euclidean, dot_product);
+//     CODETECT_HNSW_DISTANCE_METRIC is still read as a fallback
 func LoadHNSWConfigFromEnv() HNSWConfig {
 	cfg := DefaultHNSWConfig()
 
@@ -93,15 +109,15 @@ func LoadHNSWConfigFromEnv() HNSWConfig {
 		}
 	}
 
-	if metric := os.Getenv("CODETECT_HNSW_DISTANCE_METRIC"); metric != "" {
-		switch metric {
-		case "cosine", "euclidean", "dot_product":
-			cfg.DistanceMetric = metric
-		default:
-			fmt.Fprintf(os.Stderr, "Warning: Unknown distance metric %q, using cosine\n", metric)
+	if n := os.Getenv("CODETECT_HNSW_MIN_VECTORS"); n != "" {
+		var val int
+		if _, err := fmt.Sscanf(n, "%d", &val); err == nil && val >= 0 {
+			cfg.MinVectors = val
 		}
 	}
 
+	cfg.DistanceMetric = LoadDistanceMetricFromEnv()
+
 	return cfg
 }
 
@@ -126,11 +142,11 @@ func (c HNSWConfig) Validate() error {
 	if c.EfSearch > 2000 {
 		return fmt.Errorf("ef_search should be <= 2000, got %d", c.EfSearch)
 	}
+	if c.MinVectors < 0 {
+		return fmt.Errorf("min_vectors must be >= 0, got %d", c.MinVectors)
+	}
 
-	switch c.DistanceMetric {
-	case "", "cosine", "euclidean", "dot_product":
-		// Valid
-	default:
+	if _, err := ParseDistanceMetric(c.DistanceMetric); err != nil {
 		return fmt.Errorf("invalid distance metric: %s", c.DistanceMetric)
 	}
 
@@ -208,6 +208,29 @@ func TestLoadHNSWConfigFromEnv(t *testing.T) {
 	}
 }
 
+func TestLoadHNSWConfigMinVectors(t *testing.T) {
+	t.Setenv("CODETECT_HNSW_MIN_VECTORS", "")
+	if got := LoadHNSWConfigFromEnv().MinVectors; got != DefaultMinVectors {
+		t.Errorf("MinVectors = %d, want default %d", got, DefaultMinVectors)
+	}
+
+	t.Setenv("CODETECT_HNSW_MIN_VECTORS", "0")
+	if got := LoadHNSWConfigFromEnv().MinVectors; got != 0 {
+		t.Errorf("MinVectors = %d, want 0 to always build the native index", got)
+	}
+
+	t.Setenv("CODETECT_HNSW_MIN_VECTORS", "-5")
+	if got := LoadHNSWConfigFromEnv().MinVectors; got != DefaultMinVectors {
+		t.Errorf("MinVectors = %d for a negative value, want default %d", got, DefaultMinVectors)
+	}
+
+	cfg := DefaultHNSWConfig()
+	cfg.MinVectors = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() accepted negative MinVectors")
+	}
+}
+
 func TestEstimateMemoryUsage(t *testing.T) {
 	cfg := DefaultHNSWConfig()
 
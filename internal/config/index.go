@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -23,11 +25,79 @@ const (
 type IndexConfig struct {
 	// Backend specifies which indexing tool to use
 	Backend IndexBackend
+
+	// ForceIncludeDirs are repo-relative directories indexed even when
+	// .gitignore or the built-in exclusions (node_modules, vendor, hidden
+	// directories) would skip them
+	ForceIncludeDirs []string
+
+	// IncludeHiddenDirs are repo-relative hidden directories (for example
+	// .github/workflows) indexed like ordinary ones; .gitignore and the
+	// other exclusions still apply inside them
+	IncludeHiddenDirs []string
+
+	// MaxEmbeddings refuses a v2 run that would create more new embeddings
+	// than this, counted after cache hits. 0 means no limit
+	MaxEmbeddings int
+
+	// TrackRenames makes v2 runs move the locations of files moved with
+	// unchanged content instead of reindexing them
+	TrackRenames bool
+
+	// StoreContent makes v2 runs store compressed chunk content in the
+	// index, so snippets are served from it when the working tree differs
+	StoreContent bool
+
+	// ChunkDeltas makes v2 runs write only the locations of a changed
+	// file that differ from those recorded, and delete those of its
+	// removed chunks, instead of upserting all of them
+	ChunkDeltas bool
+
+	// Concurrency, if positive, makes v2 runs chunk files and embed their
+	// chunks at the same time on this many shared workers. 0 chunks each
+	// batch of files before embedding it
+	Concurrency int
+
+	// HashAlgo is the hash v2 change detection uses: "sha256" or "blake3".
+	// Empty means sha256. Changing it reindexes every file once
+	HashAlgo string
+
+	// MerkleStore is where v2 runs keep the tree of the last run: "file"
+	// for a JSON file in the data directory, or "db" for the index
+	// database. Empty means file
+	MerkleStore string
+
+	// MerkleBackups is how many previous trees v2 runs keep as backups in
+	// the data directory, for 'codetect-index merkle restore'. 0 means the
+	// default of 1
+	MerkleBackups int
+
+	// SkipNonSource leaves files larger than MaxFileSize, binary files and
+	// generated files out of the index. Off by default, indexing them like
+	// any other file
+	SkipNonSource bool
+
+	// MaxFileSize is the size limit of SkipNonSource in bytes. 0 means
+	// the indexer's default of 1MB; negative means no limit
+	MaxFileSize int64
 }
 
 // LoadIndexConfigFromEnv loads indexing configuration from environment variables.
-// Supports the following variable:
+// Supports the following variables:
 //   - CODETECT_INDEX_BACKEND: Backend to use ("auto", "ast-grep", or "ctags")
+//   - CODETECT_FORCE_INCLUDE_DIRS: Comma-separated directories to index even if ignored
+//   - CODETECT_INCLUDE_HIDDEN_DIRS: Comma-separated hidden directories to index
+//   - CODETECT_MAX_EMBEDDINGS: Max new embeddings per run, 0 for no limit (default: 0)
+//   - CODETECT_TRACK_RENAMES: Move locations of renamed files instead of reindexing (default: false)
+//   - CODETECT_STORE_CONTENT: Store chunk content in the index for snippets (default: false)
+//   - CODETECT_CHUNK_DELTAS: Write only changed locations of changed files (default: false)
+//   - CODETECT_INDEX_CONCURRENCY: Workers shared by chunking and embedding, 0 for staged (default: 0)
+//   - CODETECT_MERKLE_HASH: Change detection hash, "sha256" or "blake3" (default: sha256)
+//   - CODETECT_MERKLE_STORE: Where the merkle tree is kept, "file" or "db" (default: file)
+//   - CODETECT_MERKLE_BACKUPS: Previous merkle trees kept as backups (default: 1)
+//   - CODETECT_SKIP_NON_SOURCE: Skip large, binary and generated files (default: false)
+//   - CODETECT_MAX_FILE_SIZE: Size limit in bytes of CODETECT_SKIP_NON_SOURCE, 0 for 1MB,
+//     negative for none (default: 0)
 //
 // If no environment variable is set, defaults to "auto" (hybrid approach).
 func LoadIndexConfigFromEnv() IndexConfig {
@@ -49,9 +119,67 @@ func LoadIndexConfigFromEnv() IndexConfig {
 		}
 	}
 
+	cfg.ForceIncludeDirs = ParseDirList(os.Getenv("CODETECT_FORCE_INCLUDE_DIRS"))
+	cfg.IncludeHiddenDirs = ParseDirList(os.Getenv("CODETECT_INCLUDE_HIDDEN_DIRS"))
+	if v := os.Getenv("CODETECT_MAX_EMBEDDINGS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.MaxEmbeddings = n
+		}
+	}
+	if v := os.Getenv("CODETECT_TRACK_RENAMES"); v != "" {
+		cfg.TrackRenames = parseBool(v, cfg.TrackRenames)
+	}
+	if v := os.Getenv("CODETECT_STORE_CONTENT"); v != "" {
+		cfg.StoreContent = parseBool(v, cfg.StoreContent)
+	}
+	if v := os.Getenv("CODETECT_CHUNK_DELTAS"); v != "" {
+		cfg.ChunkDeltas = parseBool(v, cfg.ChunkDeltas)
+	}
+	if v := os.Getenv("CODETECT_INDEX_CONCURRENCY"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.Concurrency = n
+		}
+	}
+	switch v := strings.ToLower(strings.TrimSpace(os.Getenv("CODETECT_MERKLE_HASH"))); v {
+	case "sha256", "blake3":
+		cfg.HashAlgo = v
+	}
+	switch v := strings.ToLower(strings.TrimSpace(os.Getenv("CODETECT_MERKLE_STORE"))); v {
+	case "file", "db":
+		cfg.MerkleStore = v
+	}
+	if v := os.Getenv("CODETECT_MERKLE_BACKUPS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			cfg.MerkleBackups = n
+		}
+	}
+	if v := os.Getenv("CODETECT_SKIP_NON_SOURCE"); v != "" {
+		cfg.SkipNonSource = parseBool(v, cfg.SkipNonSource)
+	}
+	if v := os.Getenv("CODETECT_MAX_FILE_SIZE"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			cfg.MaxFileSize = n
+		}
+	}
+
 	return cfg
 }
 
+// ParseDirList parses a comma-separated list of repo-relative directories,
+// normalizing separators and dropping empty entries, "." and trailing
+// slashes.
+func ParseDirList(s string) []string {
+	var dirs []string
+	for _, part := range strings.Split(s, ",") {
+		dir := strings.Trim(filepath.ToSlash(filepath.Clean(strings.TrimSpace(part))), "/")
+		if dir == "" || dir == "." {
+			continue
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
 // UseAstGrep returns true if ast-grep should be used for indexing
 func (c IndexConfig) UseAstGrep() bool {
 	return c.Backend == IndexBackendAuto || c.Backend == IndexBackendAstGrep
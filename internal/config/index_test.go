@@ -0,0 +1,149 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLoadIndexConfigForceIncludeDirs(t *testing.T) {
+	t.Setenv("CODETECT_FORCE_INCLUDE_DIRS", "generated/, ./build/gen ,,.")
+
+	cfg := LoadIndexConfigFromEnv()
+	want := []string{"generated", "build/gen"}
+	if !reflect.DeepEqual(cfg.ForceIncludeDirs, want) {
+		t.Errorf("ForceIncludeDirs = %q, want %q", cfg.ForceIncludeDirs, want)
+	}
+}
+
+func TestLoadIndexConfigIncludeHiddenDirs(t *testing.T) {
+	t.Setenv("CODETECT_INCLUDE_HIDDEN_DIRS", ".github/workflows/, .config")
+
+	cfg := LoadIndexConfigFromEnv()
+	want := []string{".github/workflows", ".config"}
+	if !reflect.DeepEqual(cfg.IncludeHiddenDirs, want) {
+		t.Errorf("IncludeHiddenDirs = %q, want %q", cfg.IncludeHiddenDirs, want)
+	}
+}
+
+func TestLoadIndexConfigMaxEmbeddings(t *testing.T) {
+	t.Setenv("CODETECT_MAX_EMBEDDINGS", "5000")
+	if got := LoadIndexConfigFromEnv().MaxEmbeddings; got != 5000 {
+		t.Errorf("MaxEmbeddings = %d, want 5000", got)
+	}
+
+	t.Setenv("CODETECT_MAX_EMBEDDINGS", "-1")
+	if got := LoadIndexConfigFromEnv().MaxEmbeddings; got != 0 {
+		t.Errorf("MaxEmbeddings for invalid value = %d, want 0", got)
+	}
+}
+
+func TestLoadIndexConfigTrackRenames(t *testing.T) {
+	if LoadIndexConfigFromEnv().TrackRenames {
+		t.Error("TrackRenames should default to false")
+	}
+	t.Setenv("CODETECT_TRACK_RENAMES", "true")
+	if !LoadIndexConfigFromEnv().TrackRenames {
+		t.Error("TrackRenames = false with CODETECT_TRACK_RENAMES=true")
+	}
+}
+
+func TestLoadIndexConfigStoreContent(t *testing.T) {
+	if LoadIndexConfigFromEnv().StoreContent {
+		t.Error("StoreContent should default to false")
+	}
+	t.Setenv("CODETECT_STORE_CONTENT", "true")
+	if !LoadIndexConfigFromEnv().StoreContent {
+		t.Error("StoreContent = false with CODETECT_STORE_CONTENT=true")
+	}
+}
+
+func TestLoadIndexConfigChunkDeltas(t *testing.T) {
+	if LoadIndexConfigFromEnv().ChunkDeltas {
+		t.Error("ChunkDeltas should default to false")
+	}
+	t.Setenv("CODETECT_CHUNK_DELTAS", "true")
+	if !LoadIndexConfigFromEnv().ChunkDeltas {
+		t.Error("ChunkDeltas = false with CODETECT_CHUNK_DELTAS=true")
+	}
+}
+
+func TestLoadIndexConfigConcurrency(t *testing.T) {
+	if got := LoadIndexConfigFromEnv().Concurrency; got != 0 {
+		t.Errorf("Concurrency = %d by default, want 0", got)
+	}
+
+	t.Setenv("CODETECT_INDEX_CONCURRENCY", "8")
+	if got := LoadIndexConfigFromEnv().Concurrency; got != 8 {
+		t.Errorf("Concurrency = %d, want 8", got)
+	}
+
+	t.Setenv("CODETECT_INDEX_CONCURRENCY", "-2")
+	if got := LoadIndexConfigFromEnv().Concurrency; got != 0 {
+		t.Errorf("Concurrency for invalid value = %d, want 0", got)
+	}
+}
+
+func TestLoadIndexConfigHashAlgo(t *testing.T) {
+	if got := LoadIndexConfigFromEnv().HashAlgo; got != "" {
+		t.Errorf("HashAlgo = %q by default, want empty", got)
+	}
+
+	t.Setenv("CODETECT_MERKLE_HASH", "BLAKE3")
+	if got := LoadIndexConfigFromEnv().HashAlgo; got != "blake3" {
+		t.Errorf("HashAlgo = %q, want blake3", got)
+	}
+
+	t.Setenv("CODETECT_MERKLE_HASH", "md5")
+	if got := LoadIndexConfigFromEnv().HashAlgo; got != "" {
+		t.Errorf("HashAlgo for unknown value = %q, want empty", got)
+	}
+}
+
+func TestLoadIndexConfigMerkleStore(t *testing.T) {
+	if got := LoadIndexConfigFromEnv().MerkleStore; got != "" {
+		t.Errorf("MerkleStore = %q by default, want empty", got)
+	}
+
+	t.Setenv("CODETECT_MERKLE_STORE", "DB")
+	if got := LoadIndexConfigFromEnv().MerkleStore; got != "db" {
+		t.Errorf("MerkleStore = %q, want db", got)
+	}
+
+	t.Setenv("CODETECT_MERKLE_STORE", "redis")
+	if got := LoadIndexConfigFromEnv().MerkleStore; got != "" {
+		t.Errorf("MerkleStore for unknown value = %q, want empty", got)
+	}
+}
+
+func TestLoadIndexConfigSkipNonSource(t *testing.T) {
+	if cfg := LoadIndexConfigFromEnv(); cfg.SkipNonSource || cfg.MaxFileSize != 0 {
+		t.Errorf("SkipNonSource = %v, MaxFileSize = %d by default; want false, 0", cfg.SkipNonSource, cfg.MaxFileSize)
+	}
+
+	t.Setenv("CODETECT_SKIP_NON_SOURCE", "true")
+	t.Setenv("CODETECT_MAX_FILE_SIZE", "4194304")
+	if cfg := LoadIndexConfigFromEnv(); !cfg.SkipNonSource || cfg.MaxFileSize != 4194304 {
+		t.Errorf("SkipNonSource = %v, MaxFileSize = %d; want true, 4194304", cfg.SkipNonSource, cfg.MaxFileSize)
+	}
+
+	t.Setenv("CODETECT_MAX_FILE_SIZE", "big")
+	if cfg := LoadIndexConfigFromEnv(); cfg.MaxFileSize != 0 {
+		t.Errorf("MaxFileSize = %d for invalid input, want 0", cfg.MaxFileSize)
+	}
+}
+
+func TestLoadIndexConfigMerkleBackups(t *testing.T) {
+	if got := LoadIndexConfigFromEnv().MerkleBackups; got != 0 {
+		t.Errorf("MerkleBackups = %d by default, want 0", got)
+	}
+
+	t.Setenv("CODETECT_MERKLE_BACKUPS", "5")
+	if got := LoadIndexConfigFromEnv().MerkleBackups; got != 5 {
+		t.Errorf("MerkleBackups = %d, want 5", got)
+	}
+
+	t.Setenv("CODETECT_MERKLE_BACKUPS", "0")
+	if got := LoadIndexConfigFromEnv().MerkleBackups; got != 0 {
+		t.Errorf("MerkleBackups for 0 = %d, want 0", got)
+	}
+}
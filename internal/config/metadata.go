@@ -0,0 +1,49 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// MetadataRule tags the chunks of files matching one of Paths with Tags.
+// Paths are repo-relative globs: "dir/**" matches everything under dir, a
+// pattern without a slash matches file names, and any other is matched
+// against the whole path.
+type MetadataRule struct {
+	Paths []string          `json:"paths"`
+	Tags  map[string]string `json:"tags"`
+}
+
+// MetadataConfig is the metadata a repository records on its chunks, so
+// searches can filter on it, for example the team owning each directory
+// of a monorepo:
+//
+//	{
+//	  "metadata": [
+//	    {"paths": ["services/payments/**"], "tags": {"team": "payments"}}
+//	  ],
+//	  "indexed_metadata_keys": ["team"]
+//	}
+type MetadataConfig struct {
+	// Rules tag chunks in order; a later rule's tag replaces an earlier
+	// one's of the same key
+	Rules []MetadataRule
+
+	// IndexedKeys are the metadata keys indexed for fast filtering. Nil
+	// keeps the selection already stored in the index
+	IndexedKeys []string
+}
+
+// LoadMetadataConfig returns the chunk metadata settings in the
+// RepoConfigFile of the repository at repoRoot. A repo without the file
+// has none.
+func LoadMetadataConfig(repoRoot string) (MetadataConfig, error) {
+	var repo repoConfig
+	err := readJSON(filepath.Join(repoRoot, RepoConfigFile), &repo)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return MetadataConfig{}, fmt.Errorf("reading repo config: %w", err)
+	}
+	return MetadataConfig{Rules: repo.Metadata, IndexedKeys: repo.IndexedMetadataKeys}, nil
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Distance metrics for vector similarity search. One setting selects the
+// metric for every backend: the pgvector HNSW operator class, the
+// sqlite-vec distance function, brute-force scoring, and whether pooled
+// vectors are unit-normalized.
+const (
+	// MetricCosine compares direction only. It is the default and suits
+	// most text embedding models.
+	MetricCosine = "cosine"
+
+	// MetricEuclidean uses L2 distance, so vector length matters.
+	MetricEuclidean = "euclidean"
+
+	// MetricDotProduct uses the inner product. It matches cosine for
+	// unit-length embeddings and is cheaper on pgvector.
+	MetricDotProduct = "dot_product"
+)
+
+// ParseDistanceMetric validates a metric name and returns its canonical
+// form. Case is ignored, and "l2", "dot" and "inner_product" are accepted
+// as aliases.
+func ParseDistanceMetric(s string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "cosine":
+		return MetricCosine, nil
+	case "euclidean", "l2":
+		return MetricEuclidean, nil
+	case "dot_product", "dot", "inner_product":
+		return MetricDotProduct, nil
+	default:
+		return "", fmt.Errorf("unknown distance metric %q (supported: cosine, euclidean, dot_product)", s)
+	}
+}
+
+// LoadDistanceMetricFromEnv returns the distance metric from
+// CODETECT_DISTANCE_METRIC, falling back to the older
+// CODETECT_HNSW_DISTANCE_METRIC. Unknown values log a warning and use
+// cosine.
+func LoadDistanceMetricFromEnv() string {
+	v := os.Getenv("CODETECT_DISTANCE_METRIC")
+	if v == "" {
+		v = os.Getenv("CODETECT_HNSW_DISTANCE_METRIC")
+	}
+	metric, err := ParseDistanceMetric(v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v, using cosine\n", err)
+		return MetricCosine
+	}
+	return metric
+}
@@ -0,0 +1,48 @@
+package config
+
+import "testing"
+
+func TestParseDistanceMetric(t *testing.T) {
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{"", MetricCosine, false},
+		{"Cosine", MetricCosine, false},
+		{"l2", MetricEuclidean, false},
+		{" dot ", MetricDotProduct, false},
+		{"inner_product", MetricDotProduct, false},
+		{"manhattan", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDistanceMetric(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseDistanceMetric(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestLoadDistanceMetricFromEnv(t *testing.T) {
+	t.Setenv("CODETECT_DISTANCE_METRIC", "")
+	t.Setenv("CODETECT_HNSW_DISTANCE_METRIC", "")
+	if got := LoadDistanceMetricFromEnv(); got != MetricCosine {
+		t.Errorf("default metric = %q, want cosine", got)
+	}
+
+	// The older HNSW-specific variable is still honored
+	t.Setenv("CODETECT_HNSW_DISTANCE_METRIC", "euclidean")
+	if got := LoadDistanceMetricFromEnv(); got != MetricEuclidean {
+		t.Errorf("legacy metric = %q, want euclidean", got)
+	}
+
+	// The new variable wins and reaches the HNSW config
+	t.Setenv("CODETECT_DISTANCE_METRIC", "dot_product")
+	if got := LoadHNSWConfigFromEnv().DistanceMetric; got != MetricDotProduct {
+		t.Errorf("HNSW DistanceMetric = %q, want dot_product", got)
+	}
+
+	t.Setenv("CODETECT_DISTANCE_METRIC", "hamming")
+	if got := LoadDistanceMetricFromEnv(); got != MetricCosine {
+		t.Errorf("invalid metric = %q, want cosine fallback", got)
+	}
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"fmt"
+	"os"
+)
+
+// PQConfig holds product quantization parameters for compressed vector storage.
+// PQ splits each vector into Subspaces sub-vectors and replaces each with the
+// index of its nearest centroid, so a vector is stored in Subspaces bytes.
+type PQConfig struct {
+	// Subspaces is the number of sub-vectors per vector (default: 16)
+	// Must divide the vector dimensions. More subspaces = better recall, larger codes
+	Subspaces int `yaml:"subspaces" json:"subspaces"`
+
+	// Centroids is the codebook size per subspace (default: 256, max: 256)
+	// Each code is one byte, so values above 256 are not representable
+	Centroids int `yaml:"centroids" json:"centroids"`
+
+	// Iterations is the number of k-means iterations when training (default: 20)
+	Iterations int `yaml:"iterations" json:"iterations"`
+
+	// TrainSampleSize caps the number of vectors used for training (default: 20000)
+	TrainSampleSize int `yaml:"train_sample_size" json:"train_sample_size"`
+
+	// RerankFactor controls how many ANN candidates are decoded and re-ranked
+	// per requested result (default: 4, i.e. 40 candidates for k=10)
+	RerankFactor int `yaml:"rerank_factor" json:"rerank_factor"`
+}
+
+// DefaultPQConfig returns sensible defaults for PQ compression.
+// With 768-dim float32 vectors this stores 16 bytes per vector instead of 3072.
+func DefaultPQConfig() PQConfig {
+	return PQConfig{
+		Subspaces:       16,
+		Centroids:       256,
+		Iterations:      20,
+		TrainSampleSize: 20000,
+		RerankFactor:    4,
+	}
+}
+
+// LoadPQConfigFromEnv loads PQ configuration from environment variables.
+// It applies when CODETECT_VECTOR_INDEX is "pq". Supports:
+//   - CODETECT_PQ_SUBSPACES: Sub-vectors per vector
+//   - CODETECT_PQ_CENTROIDS: Codebook size per subspace
+//   - CODETECT_PQ_RERANK_FACTOR: Candidates re-ranked per requested result
+func LoadPQConfigFromEnv() PQConfig {
+	cfg := DefaultPQConfig()
+
+	if v := os.Getenv("CODETECT_PQ_SUBSPACES"); v != "" {
+		var val int
+		if _, err := fmt.Sscanf(v, "%d", &val); err == nil && val > 0 {
+			cfg.Subspaces = val
+		}
+	}
+
+	if v := os.Getenv("CODETECT_PQ_CENTROIDS"); v != "" {
+		var val int
+		if _, err := fmt.Sscanf(v, "%d", &val); err == nil && val > 0 {
+			cfg.Centroids = val
+		}
+	}
+
+	if v := os.Getenv("CODETECT_PQ_RERANK_FACTOR"); v != "" {
+		var val int
+		if _, err := fmt.Sscanf(v, "%d", &val); err == nil && val > 0 {
+			cfg.RerankFactor = val
+		}
+	}
+
+	return cfg
+}
+
+// Validate checks that the PQ configuration is usable for vectors of the
+// given dimensions.
+func (c PQConfig) Validate(dimensions int) error {
+	if c.Subspaces < 1 {
+		return fmt.Errorf("subspaces must be >= 1, got %d", c.Subspaces)
+	}
+	if dimensions%c.Subspaces != 0 {
+		return fmt.Errorf("subspaces (%d) must divide dimensions (%d)", c.Subspaces, dimensions)
+	}
+	if c.Centroids < 2 || c.Centroids > 256 {
+		return fmt.Errorf("centroids must be between 2 and 256, got %d", c.Centroids)
+	}
+	if c.Iterations < 1 {
+		return fmt.Errorf("iterations must be >= 1, got %d", c.Iterations)
+	}
+	if c.RerankFactor < 1 {
+		return fmt.Errorf("rerank_factor must be >= 1, got %d", c.RerankFactor)
+	}
+	return nil
+}
+
+// String returns a human-readable description of the PQ configuration.
+func (c PQConfig) String() string {
+	return fmt.Sprintf("PQ(subspaces=%d, centroids=%d, iterations=%d, rerank_factor=%d)",
+		c.Subspaces, c.Centroids, c.Iterations, c.RerankFactor)
+}
+
+// EstimateMemoryUsage estimates memory usage in bytes for PQ-compressed vectors:
+//   - Codes: numVectors * Subspaces bytes
+//   - Codebooks: Centroids * dimensions * 4 bytes
+func (c PQConfig) EstimateMemoryUsage(numVectors, dimensions int) int64 {
+	codeBytes := int64(numVectors) * int64(c.Subspaces)
+	codebookBytes := int64(c.Centroids) * int64(dimensions) * 4
+	return codeBytes + codebookBytes
+}
@@ -0,0 +1,62 @@
+package config
+
+import "testing"
+
+func TestPQConfigValidate(t *testing.T) {
+	cfg := DefaultPQConfig()
+	if err := cfg.Validate(768); err != nil {
+		t.Errorf("default config invalid for 768 dims: %v", err)
+	}
+	if err := cfg.Validate(100); err == nil {
+		t.Error("expected error when subspaces does not divide dimensions")
+	}
+
+	cfg.Centroids = 512
+	if err := cfg.Validate(768); err == nil {
+		t.Error("expected error for more than 256 centroids")
+	}
+}
+
+func TestLoadPQConfigFromEnv(t *testing.T) {
+	t.Setenv("CODETECT_PQ_SUBSPACES", "32")
+	t.Setenv("CODETECT_PQ_CENTROIDS", "128")
+	t.Setenv("CODETECT_PQ_RERANK_FACTOR", "invalid")
+
+	cfg := LoadPQConfigFromEnv()
+	if cfg.Subspaces != 32 {
+		t.Errorf("Expected Subspaces=32 from env, got %d", cfg.Subspaces)
+	}
+	if cfg.Centroids != 128 {
+		t.Errorf("Expected Centroids=128 from env, got %d", cfg.Centroids)
+	}
+	if cfg.RerankFactor != 4 {
+		t.Errorf("Expected RerankFactor=4 (default) for invalid input, got %d", cfg.RerankFactor)
+	}
+}
+
+func TestParseVectorIndexType(t *testing.T) {
+	for in, want := range map[string]string{"": VectorIndexHNSW, "HNSW": VectorIndexHNSW, " pq ": VectorIndexPQ} {
+		got, err := ParseVectorIndexType(in)
+		if err != nil || got != want {
+			t.Errorf("ParseVectorIndexType(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseVectorIndexType("ivf"); err == nil {
+		t.Error("expected error for an unknown vector index")
+	}
+
+	t.Setenv("CODETECT_VECTOR_INDEX", "ivf")
+	if got := LoadVectorIndexTypeFromEnv(); got != VectorIndexHNSW {
+		t.Errorf("LoadVectorIndexTypeFromEnv() = %q for an unknown value, want %q", got, VectorIndexHNSW)
+	}
+}
+
+func TestPQEstimateMemoryUsage(t *testing.T) {
+	cfg := DefaultPQConfig()
+
+	// 1M vectors, 768 dims: 16MB of codes + 768KB of codebooks
+	mem := cfg.EstimateMemoryUsage(1_000_000, 768)
+	if want := int64(16_000_000 + 256*768*4); mem != want {
+		t.Errorf("EstimateMemoryUsage = %d, want %d", mem, want)
+	}
+}
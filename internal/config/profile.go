@@ -0,0 +1,187 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// RepoConfigFile is the file at a repository's root that selects its chunk
+// profile and may define profiles of its own:
+//
+//	{
+//	  "chunk_profile": "handbook",
+//	  "chunk_profiles": {
+//	    "handbook": {"max_chunk_size": 6000, "embed_paths": true}
+//	  }
+//	}
+const RepoConfigFile = ".codetect.json"
+
+// ChunkProfile is a named bundle of chunking options, so repos with the
+// same needs share one setting instead of a list of variables. Options left
+// at their zero value keep the default.
+type ChunkProfile struct {
+	MaxChunkSize      int                 `json:"max_chunk_size,omitempty"`
+	MaxChunkSizes     map[string]int      `json:"max_chunk_sizes,omitempty"`
+	MaxChunkTokens    int                 `json:"max_chunk_tokens,omitempty"`
+	SubChunkLines     int                 `json:"subchunk_lines,omitempty"`
+	SkipGaps          bool                `json:"skip_gaps,omitempty"`
+	ExcludeTests      bool                `json:"exclude_tests,omitempty"`
+	SplitNodes        map[string][]string `json:"split_nodes,omitempty"`
+	StripComments     bool                `json:"strip_comments,omitempty"`
+	NeighborContext   bool                `json:"neighbor_context,omitempty"`
+	QualifiedNames    bool                `json:"qualified_names,omitempty"`
+	EmbedPaths        bool                `json:"embed_paths,omitempty"`
+	SkipTrivialChunks bool                `json:"skip_trivial_chunks,omitempty"`
+	LeadingComments   bool                `json:"leading_comments,omitempty"`
+	SplitOversized    bool                `json:"split_oversized,omitempty"`
+
+	SplitNestedFunctions []string `json:"split_nested_functions,omitempty"`
+}
+
+// builtinChunkProfiles are the profiles available without a profiles file.
+var builtinChunkProfiles = map[string]ChunkProfile{
+	"default": {},
+
+	// Documentation and example repos: larger chunks keep prose and
+	// samples together, and the path says which guide a chunk is from
+	"docs": {MaxChunkSize: 4000, EmbedPaths: true, ExcludeTests: true},
+
+	// Libraries searched for their API: named definitions only, without
+	// tests, imports and top-level glue, or trivial accessors
+	"api": {SkipGaps: true, ExcludeTests: true, SkipTrivialChunks: true, QualifiedNames: true},
+
+	// Repos of large files: smaller chunks, each embedded with the
+	// signatures around it
+	"fine": {MaxChunkSize: 1000, SubChunkLines: 40, NeighborContext: true},
+}
+
+// apply sets the options p enables on cfg.
+func (p ChunkProfile) apply(cfg *ChunkingConfig) {
+	if p.MaxChunkSize > 0 {
+		cfg.MaxChunkSize = p.MaxChunkSize
+	}
+	if p.MaxChunkTokens > 0 {
+		cfg.MaxChunkTokens = p.MaxChunkTokens
+	}
+	if p.SubChunkLines > 0 {
+		cfg.SubChunkLines = p.SubChunkLines
+	}
+	if len(p.MaxChunkSizes) > 0 {
+		cfg.MaxChunkSizes = p.MaxChunkSizes
+	}
+	if len(p.SplitNodes) > 0 {
+		cfg.SplitNodes = p.SplitNodes
+	}
+	if len(p.SplitNestedFunctions) > 0 {
+		cfg.SplitNestedFunctions = p.SplitNestedFunctions
+	}
+	cfg.SkipGaps = cfg.SkipGaps || p.SkipGaps
+	cfg.ExcludeTests = cfg.ExcludeTests || p.ExcludeTests
+	cfg.StripComments = cfg.StripComments || p.StripComments
+	cfg.NeighborContext = cfg.NeighborContext || p.NeighborContext
+	cfg.QualifiedNames = cfg.QualifiedNames || p.QualifiedNames
+	cfg.EmbedPaths = cfg.EmbedPaths || p.EmbedPaths
+	cfg.SkipTrivialChunks = cfg.SkipTrivialChunks || p.SkipTrivialChunks
+	cfg.LeadingComments = cfg.LeadingComments || p.LeadingComments
+	cfg.SplitOversized = cfg.SplitOversized || p.SplitOversized
+}
+
+// repoConfig is the content of RepoConfigFile. Its chunk metadata is
+// described by MetadataConfig.
+type repoConfig struct {
+	ChunkProfile  string                  `json:"chunk_profile"`
+	ChunkProfiles map[string]ChunkProfile `json:"chunk_profiles"`
+
+	Metadata            []MetadataRule `json:"metadata"`
+	IndexedMetadataKeys []string       `json:"indexed_metadata_keys"`
+}
+
+// LoadChunkingConfig returns the chunking configuration for the repository
+// at repoRoot: the defaults, then the options of the selected profile, then
+// the variables read by LoadChunkingConfigFromEnv that are set.
+//
+// The profile is named by CODETECT_CHUNK_PROFILE, or else by the repo's
+// RepoConfigFile. Profiles are looked up among the built-in ones ("docs",
+// "api", "fine"), those in the JSON file named by
+// CODETECT_CHUNK_PROFILES_FILE, shared by a team, and those in the repo's
+// RepoConfigFile, each replacing same-named profiles before it. An empty
+// repoRoot reads no repo file.
+//
+// An unknown profile or unreadable file is reported as an error, with the
+// configuration loaded without a profile.
+func LoadChunkingConfig(repoRoot string) (ChunkingConfig, error) {
+	cfg := DefaultChunkingConfig()
+	name, profiles, err := chunkProfiles(repoRoot)
+	if err == nil && name != "" {
+		if profile, ok := profiles[name]; ok {
+			profile.apply(&cfg)
+			cfg.Profile = name
+		} else {
+			err = fmt.Errorf("unknown chunk profile %q (available: %v)", name, profileNames(profiles))
+		}
+	}
+	applyChunkingEnv(&cfg)
+	return cfg, err
+}
+
+// chunkProfiles returns the name of the selected profile and the profiles
+// to choose from, as described for LoadChunkingConfig.
+func chunkProfiles(repoRoot string) (string, map[string]ChunkProfile, error) {
+	profiles := make(map[string]ChunkProfile, len(builtinChunkProfiles))
+	for name, profile := range builtinChunkProfiles {
+		profiles[name] = profile
+	}
+
+	if path := os.Getenv("CODETECT_CHUNK_PROFILES_FILE"); path != "" {
+		var shared map[string]ChunkProfile
+		if err := readJSON(path, &shared); err != nil {
+			return "", nil, fmt.Errorf("reading chunk profiles: %w", err)
+		}
+		for name, profile := range shared {
+			profiles[name] = profile
+		}
+	}
+
+	var repo repoConfig
+	if repoRoot != "" {
+		err := readJSON(filepath.Join(repoRoot, RepoConfigFile), &repo)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", nil, fmt.Errorf("reading repo config: %w", err)
+		}
+		for name, profile := range repo.ChunkProfiles {
+			profiles[name] = profile
+		}
+	}
+
+	name := repo.ChunkProfile
+	if v := os.Getenv("CODETECT_CHUNK_PROFILE"); v != "" {
+		name = v
+	}
+	return name, profiles, nil
+}
+
+// readJSON decodes the JSON file at path into v.
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return nil
+}
+
+// profileNames returns the sorted names of profiles.
+func profileNames(profiles map[string]ChunkProfile) []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
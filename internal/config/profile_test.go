@@ -0,0 +1,131 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadChunkingConfigProfile(t *testing.T) {
+	t.Setenv("CODETECT_CHUNK_PROFILE", "api")
+	cfg, err := LoadChunkingConfig("")
+	if err != nil {
+		t.Fatalf("LoadChunkingConfig() error = %v", err)
+	}
+	if cfg.Profile != "api" || !cfg.SkipGaps || !cfg.ExcludeTests || !cfg.SkipTrivialChunks || !cfg.QualifiedNames {
+		t.Errorf("api profile = %+v", cfg)
+	}
+
+	// Variables set explicitly override the profile
+	t.Setenv("CODETECT_SKIP_GAPS", "false")
+	if cfg := LoadChunkingConfigFromEnv(); cfg.SkipGaps || !cfg.ExcludeTests {
+		t.Errorf("SkipGaps = %v, ExcludeTests = %v; want false, true", cfg.SkipGaps, cfg.ExcludeTests)
+	}
+}
+
+func TestLoadChunkingConfigUnknownProfile(t *testing.T) {
+	t.Setenv("CODETECT_CHUNK_PROFILE", "nope")
+	t.Setenv("CODETECT_EMBED_PATHS", "true")
+	cfg, err := LoadChunkingConfig("")
+	if err == nil || !strings.Contains(err.Error(), `"nope"`) {
+		t.Errorf("LoadChunkingConfig() error = %v, want unknown profile", err)
+	}
+	if cfg.Profile != "" || !cfg.EmbedPaths {
+		t.Errorf("config without profile = %+v, want variables applied", cfg)
+	}
+}
+
+func TestLoadChunkingConfigRepoFile(t *testing.T) {
+	repo := t.TempDir()
+	writeFile(t, filepath.Join(repo, RepoConfigFile), `{
+  "chunk_profile": "handbook",
+  "chunk_profiles": {
+    "handbook": {"max_chunk_size": 6000, "max_chunk_sizes": {"java": 8000}, "split_nodes": {"go": ["function_declaration"]}}
+  }
+}`)
+
+	cfg, err := LoadChunkingConfig(repo)
+	if err != nil {
+		t.Fatalf("LoadChunkingConfig() error = %v", err)
+	}
+	if cfg.Profile != "handbook" || cfg.MaxChunkSize != 6000 {
+		t.Errorf("Profile = %q, MaxChunkSize = %d; want handbook, 6000", cfg.Profile, cfg.MaxChunkSize)
+	}
+	if want := map[string]int{"java": 8000}; !reflect.DeepEqual(cfg.MaxChunkSizes, want) {
+		t.Errorf("MaxChunkSizes = %v, want %v", cfg.MaxChunkSizes, want)
+	}
+	if want := map[string][]string{"go": {"function_declaration"}}; !reflect.DeepEqual(cfg.SplitNodes, want) {
+		t.Errorf("SplitNodes = %v, want %v", cfg.SplitNodes, want)
+	}
+
+	// The environment picks another profile over the repo's choice
+	t.Setenv("CODETECT_CHUNK_PROFILE", "fine")
+	if cfg, _ := LoadChunkingConfig(repo); cfg.Profile != "fine" || cfg.MaxChunkSize != 1000 {
+		t.Errorf("Profile = %q, MaxChunkSize = %d; want fine, 1000", cfg.Profile, cfg.MaxChunkSize)
+	}
+
+	// Without a repo file no profile applies
+	t.Setenv("CODETECT_CHUNK_PROFILE", "")
+	if cfg, err := LoadChunkingConfig(t.TempDir()); err != nil || cfg.Profile != "" {
+		t.Errorf("LoadChunkingConfig() = %q, %v; want no profile", cfg.Profile, err)
+	}
+}
+
+func TestLoadChunkingConfigProfilesFile(t *testing.T) {
+	shared := filepath.Join(t.TempDir(), "profiles.json")
+	writeFile(t, shared, `{"docs": {"max_chunk_size": 8000}, "team": {"exclude_tests": true}}`)
+	t.Setenv("CODETECT_CHUNK_PROFILES_FILE", shared)
+
+	// A shared profile replaces the built-in one of the same name
+	t.Setenv("CODETECT_CHUNK_PROFILE", "docs")
+	if cfg, err := LoadChunkingConfig(""); err != nil || cfg.MaxChunkSize != 8000 || cfg.EmbedPaths {
+		t.Errorf("docs profile = %+v, %v; want the shared definition", cfg, err)
+	}
+	t.Setenv("CODETECT_CHUNK_PROFILE", "team")
+	if cfg, err := LoadChunkingConfig(""); err != nil || !cfg.ExcludeTests {
+		t.Errorf("team profile = %+v, %v", cfg, err)
+	}
+
+	writeFile(t, shared, `{not json`)
+	if _, err := LoadChunkingConfig(""); err == nil {
+		t.Error("LoadChunkingConfig() with a malformed profiles file succeeded")
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("writing %s: %v", path, err)
+	}
+}
+
+func TestLoadMetadataConfig(t *testing.T) {
+	repo := t.TempDir()
+	cfg, err := LoadMetadataConfig(repo)
+	if err != nil {
+		t.Fatalf("LoadMetadataConfig() without repo file error = %v", err)
+	}
+	if cfg.Rules != nil || cfg.IndexedKeys != nil {
+		t.Errorf("config without repo file = %+v, want empty", cfg)
+	}
+
+	writeFile(t, filepath.Join(repo, RepoConfigFile), `{
+  "metadata": [
+    {"paths": ["services/payments/**"], "tags": {"team": "payments"}}
+  ],
+  "indexed_metadata_keys": ["team"]
+}`)
+	cfg, err = LoadMetadataConfig(repo)
+	if err != nil {
+		t.Fatalf("LoadMetadataConfig() error = %v", err)
+	}
+	want := MetadataConfig{
+		Rules:       []MetadataRule{{Paths: []string{"services/payments/**"}, Tags: map[string]string{"team": "payments"}}},
+		IndexedKeys: []string{"team"},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("LoadMetadataConfig() = %+v, want %+v", cfg, want)
+	}
+}
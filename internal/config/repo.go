@@ -0,0 +1,128 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// RepoRootConfig controls how repository root paths are normalized before
+// they are used as index keys. The repo root is stored verbatim in every
+// index table, so two spellings of the same directory (a symlink, a trailing
+// slash, a different case on a case-insensitive filesystem) would otherwise
+// produce two separate indexes.
+type RepoRootConfig struct {
+	// ResolveSymlinks resolves symbolic links in the path.
+	// Default: true
+	ResolveSymlinks bool
+
+	// CanonicalCase rewrites each path component to the case stored on disk.
+	// Only applied on case-insensitive filesystems (macOS, Windows).
+	// Default: true
+	CanonicalCase bool
+}
+
+// DefaultRepoRootConfig returns the default normalization settings.
+func DefaultRepoRootConfig() RepoRootConfig {
+	return RepoRootConfig{
+		ResolveSymlinks: true,
+		CanonicalCase:   true,
+	}
+}
+
+// LoadRepoRootConfigFromEnv loads repo root normalization settings from
+// environment variables:
+//   - CODETECT_RESOLVE_SYMLINKS: Resolve symlinks in repo roots (default: true)
+//   - CODETECT_CANONICAL_CASE: Canonicalize path case on case-insensitive filesystems (default: true)
+func LoadRepoRootConfigFromEnv() RepoRootConfig {
+	cfg := DefaultRepoRootConfig()
+
+	if v := os.Getenv("CODETECT_RESOLVE_SYMLINKS"); v != "" {
+		cfg.ResolveSymlinks = parseBool(v, cfg.ResolveSymlinks)
+	}
+	if v := os.Getenv("CODETECT_CANONICAL_CASE"); v != "" {
+		cfg.CanonicalCase = parseBool(v, cfg.CanonicalCase)
+	}
+
+	return cfg
+}
+
+// caseInsensitiveFS reports whether the host filesystem is assumed to be
+// case-insensitive. Overridden in tests.
+var caseInsensitiveFS = runtime.GOOS == "darwin" || runtime.GOOS == "windows"
+
+// Normalize returns the canonical form of a repository root path.
+// The path is made absolute and cleaned, symlinks are resolved and, on
+// case-insensitive filesystems, each component is rewritten to its on-disk
+// case. Paths that do not exist are returned absolute and cleaned.
+func (c RepoRootConfig) Normalize(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("getting absolute path: %w", err)
+	}
+	absPath = filepath.Clean(absPath)
+
+	if c.ResolveSymlinks {
+		resolved, err := filepath.EvalSymlinks(absPath)
+		if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("resolving symlinks: %w", err)
+		}
+		if err == nil {
+			absPath = resolved
+		}
+	}
+
+	if c.CanonicalCase && caseInsensitiveFS {
+		absPath = canonicalCase(absPath)
+	}
+
+	return absPath, nil
+}
+
+// NormalizeRepoRoot normalizes a repository root using settings loaded from
+// the environment. See RepoRootConfig.Normalize.
+func NormalizeRepoRoot(path string) (string, error) {
+	return LoadRepoRootConfigFromEnv().Normalize(path)
+}
+
+// canonicalCase rewrites each component of an absolute path to the case of
+// the matching directory entry on disk. Components that cannot be matched
+// are kept as given.
+func canonicalCase(path string) string {
+	volume := filepath.VolumeName(path)
+	rest := strings.TrimPrefix(path[len(volume):], string(filepath.Separator))
+	if rest == "" {
+		return path
+	}
+
+	current := volume + string(filepath.Separator)
+	for _, part := range strings.Split(rest, string(filepath.Separator)) {
+		current = filepath.Join(current, matchEntryCase(current, part))
+	}
+	return current
+}
+
+// matchEntryCase returns the name of the entry in dir that matches name,
+// preferring an exact match over a case-insensitive one.
+func matchEntryCase(dir, name string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return name
+	}
+
+	match := ""
+	for _, entry := range entries {
+		if entry.Name() == name {
+			return name
+		}
+		if match == "" && strings.EqualFold(entry.Name(), name) {
+			match = entry.Name()
+		}
+	}
+	if match == "" {
+		return name
+	}
+	return match
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRepoRootNormalize_Variants(t *testing.T) {
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("resolving temp dir: %v", err)
+	}
+
+	repo := filepath.Join(base, "repo")
+	if err := os.MkdirAll(filepath.Join(repo, "sub"), 0755); err != nil {
+		t.Fatalf("creating repo: %v", err)
+	}
+
+	link := filepath.Join(base, "link")
+	if err := os.Symlink(repo, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	cfg := DefaultRepoRootConfig()
+
+	variants := []string{
+		repo,
+		repo + string(filepath.Separator),
+		filepath.Join(repo, "sub", ".."),
+		repo + string(filepath.Separator) + "." + string(filepath.Separator),
+		link,
+		link + string(filepath.Separator),
+	}
+
+	for _, v := range variants {
+		got, err := cfg.Normalize(v)
+		if err != nil {
+			t.Errorf("Normalize(%q) error = %v", v, err)
+			continue
+		}
+		if got != repo {
+			t.Errorf("Normalize(%q) = %q, want %q", v, got, repo)
+		}
+	}
+}
+
+func TestRepoRootNormalize_Relative(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getting cwd: %v", err)
+	}
+	want, err := filepath.EvalSymlinks(cwd)
+	if err != nil {
+		t.Fatalf("resolving cwd: %v", err)
+	}
+
+	got, err := DefaultRepoRootConfig().Normalize(".")
+	if err != nil {
+		t.Fatalf("Normalize error = %v", err)
+	}
+	if got != want {
+		t.Errorf("Normalize(\".\") = %q, want %q", got, want)
+	}
+}
+
+func TestRepoRootNormalize_NoResolveSymlinks(t *testing.T) {
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("resolving temp dir: %v", err)
+	}
+	repo := filepath.Join(base, "repo")
+	if err := os.Mkdir(repo, 0755); err != nil {
+		t.Fatalf("creating repo: %v", err)
+	}
+	link := filepath.Join(base, "link")
+	if err := os.Symlink(repo, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	cfg := RepoRootConfig{ResolveSymlinks: false}
+	got, err := cfg.Normalize(link + "/")
+	if err != nil {
+		t.Fatalf("Normalize error = %v", err)
+	}
+	if got != link {
+		t.Errorf("Normalize = %q, want %q", got, link)
+	}
+}
+
+func TestRepoRootNormalize_MissingPath(t *testing.T) {
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("resolving temp dir: %v", err)
+	}
+	missing := filepath.Join(base, "does-not-exist")
+
+	got, err := DefaultRepoRootConfig().Normalize(missing + "/")
+	if err != nil {
+		t.Fatalf("Normalize error = %v", err)
+	}
+	if got != missing {
+		t.Errorf("Normalize = %q, want %q", got, missing)
+	}
+}
+
+func TestRepoRootNormalize_CanonicalCase(t *testing.T) {
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("resolving temp dir: %v", err)
+	}
+	repo := filepath.Join(base, "MyRepo")
+	if err := os.Mkdir(repo, 0755); err != nil {
+		t.Fatalf("creating repo: %v", err)
+	}
+
+	// canonicalCase matches directory entries case-insensitively, so a
+	// lowercased spelling maps back to the on-disk name even on
+	// case-sensitive hosts.
+	got := canonicalCase(filepath.Join(base, strings.ToLower("MyRepo")))
+	if got != repo {
+		t.Errorf("canonicalCase = %q, want %q", got, repo)
+	}
+
+	// Exact matches are preserved
+	if got := canonicalCase(repo); got != repo {
+		t.Errorf("canonicalCase(exact) = %q, want %q", got, repo)
+	}
+}
+
+func TestLoadRepoRootConfigFromEnv(t *testing.T) {
+	t.Setenv("CODETECT_RESOLVE_SYMLINKS", "false")
+	t.Setenv("CODETECT_CANONICAL_CASE", "0")
+
+	cfg := LoadRepoRootConfigFromEnv()
+	if cfg.ResolveSymlinks {
+		t.Error("expected ResolveSymlinks=false")
+	}
+	if cfg.CanonicalCase {
+		t.Error("expected CanonicalCase=false")
+	}
+}
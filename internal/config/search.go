@@ -9,8 +9,52 @@ import (
 // SearchConfig holds the complete search configuration including
 // retrieval and reranking settings.
 type SearchConfig struct {
-	Retrieval RetrieverConfig `yaml:"retrieval"`
-	Reranking RerankerConfig  `yaml:"reranking"`
+	Retrieval RetrieverConfig   `yaml:"retrieval"`
+	Reranking RerankerConfig    `yaml:"reranking"`
+	Cache     ResultCacheConfig `yaml:"cache"`
+
+	// Warmup loads the semantic index into memory in the background when
+	// the MCP server starts, so the first query does not pay for it.
+	// Default: false
+	Warmup bool `yaml:"warmup"`
+
+	// SimilarMinScore is the minimum similarity, up to 1, for the
+	// search_by_example and find_similar_functions tools to report two
+	// pieces of code as related. Code with no real relatives then gets no
+	// results instead of its weakest matches. It does not affect other
+	// searches. Default: 0 (no minimum)
+	SimilarMinScore float64 `yaml:"similar_min_score"`
+
+	// SemanticMinScore is the minimum similarity, up to 1, for a
+	// search_semantic result to count as relevant. Weaker results are
+	// dropped. Default: 0 (every result is relevant)
+	SemanticMinScore float64 `yaml:"semantic_min_score"`
+
+	// KeywordFallback makes search_semantic run a keyword search for the
+	// query when no semantic result is relevant, as happens with exact
+	// strings such as error messages that embed poorly, instead of
+	// returning nothing. Default: true
+	KeywordFallback bool `yaml:"keyword_fallback"`
+
+	// ToolTimeoutMs bounds a whole hybrid_search_v2 call, reranking
+	// included, or search_semantic call, in milliseconds. When it expires
+	// the call is cancelled and returns the results found so far, marked
+	// as truncated, instead of blocking the agent. 0 disables the limit.
+	// Default: 15000 (15 seconds)
+	ToolTimeoutMs int `yaml:"tool_timeout_ms"`
+
+	// CallTimeoutMs bounds every MCP tool call, in milliseconds. When it
+	// expires the call's context is cancelled and a call failing as a
+	// result is reported as timed out. 0 disables the limit.
+	// Default: 0
+	CallTimeoutMs int `yaml:"call_timeout_ms"`
+
+	// QueryLog records each hybrid_search_v2 query with its top result and
+	// score in the index, for analyzing what is searched for: "hashed"
+	// stores a hash of the query instead of its text, for privacy, and
+	// "raw" the text itself. Summarized by `codetect-index queries`.
+	// Default: "" (off)
+	QueryLog string `yaml:"query_log"`
 }
 
 // RetrieverConfig configures multi-signal retrieval behavior.
@@ -29,6 +73,21 @@ type RetrieverConfig struct {
 	// Keys: "keyword", "semantic", "symbol"
 	Weights map[string]float64 `yaml:"weights"`
 
+	// NodeTypeWeights scales semantic match scores by the AST node type
+	// of the chunk matched, before fusion, so that imports and other
+	// boilerplate rank below equally similar functions.
+	// Keys: node types (e.g. "gap", "import_declaration"); missing types
+	// keep a weight of 1.0.
+	// Default: none
+	NodeTypeWeights map[string]float64 `yaml:"node_type_weights"`
+
+	// FreshnessWeight boosts semantic match scores by up to this fraction
+	// by how recently their file was modified, as of indexing, compared
+	// to the other matches, so that near ties favor recently changed
+	// code. Small values, such as 0.05, only reorder near ties.
+	// Default: 0 (disabled)
+	FreshnessWeight float64 `yaml:"freshness_weight"`
+
 	// Parallel enables parallel retrieval from all signals.
 	// When true, all search signals run concurrently.
 	// When false, signals run sequentially (useful for debugging).
@@ -64,6 +123,38 @@ type RerankerConfig struct {
 	// BaseURL is the base URL for the reranking service.
 	// Default: "http://localhost:11434" for Ollama
 	BaseURL string `yaml:"base_url"`
+
+	// AdaptiveMargin, when positive, skips reranking queries with a clear
+	// winner: those whose top result's score exceeds the runner-up's by at
+	// least this fraction of the top score. Only queries whose top results
+	// are tightly clustered then pay for the cross-encoder.
+	// Default: 0 (always rerank)
+	AdaptiveMargin float64 `yaml:"adaptive_margin"`
+
+	// PathWeights maps path globs to multipliers of the reranker scores of
+	// results under them, so boilerplate such as examples or generated code
+	// does not crowd out real implementations. "dir/**" matches everything
+	// under dir, a glob without a slash matches the file name, and any
+	// other glob matches the repo-relative path. A weight of 0 removes
+	// matching results; when several globs match, the lowest weight wins.
+	// Default: none
+	PathWeights map[string]float64 `yaml:"path_weights"`
+}
+
+// ResultCacheConfig configures caching of ranked semantic search results.
+type ResultCacheConfig struct {
+	// Enabled turns on the result cache.
+	// Default: false
+	Enabled bool `yaml:"enabled"`
+
+	// Size is the maximum number of cached queries (LRU eviction).
+	// Default: 128
+	Size int `yaml:"size"`
+
+	// TTLSeconds is how long a cached result stays valid.
+	// Results are also invalidated as soon as the index changes.
+	// Default: 60
+	TTLSeconds int `yaml:"ttl_seconds"`
 }
 
 // DefaultSearchConfig returns sensible default values for search configuration.
@@ -71,6 +162,10 @@ func DefaultSearchConfig() SearchConfig {
 	return SearchConfig{
 		Retrieval: DefaultRetrieverConfig(),
 		Reranking: DefaultRerankerConfig(),
+		Cache:     DefaultResultCacheConfig(),
+
+		KeywordFallback: true,
+		ToolTimeoutMs:   15000,
 	}
 }
 
@@ -105,6 +200,16 @@ func DefaultRerankerConfig() RerankerConfig {
 	}
 }
 
+// DefaultResultCacheConfig returns the default result cache configuration.
+// Caching is disabled by default.
+func DefaultResultCacheConfig() ResultCacheConfig {
+	return ResultCacheConfig{
+		Enabled:    false,
+		Size:       128,
+		TTLSeconds: 60,
+	}
+}
+
 // LoadSearchConfigFromEnv loads search configuration from environment variables.
 // Supports the following variables:
 //
@@ -117,6 +222,10 @@ func DefaultRerankerConfig() RerankerConfig {
 //   - CODETECT_SEARCH_WEIGHT_KEYWORD: Keyword signal weight (default: 0.3)
 //   - CODETECT_SEARCH_WEIGHT_SEMANTIC: Semantic signal weight (default: 0.5)
 //   - CODETECT_SEARCH_WEIGHT_SYMBOL: Symbol signal weight (default: 0.2)
+//   - CODETECT_SEARCH_NODE_TYPE_WEIGHTS: Node type weights as "type=weight,..."
+//     (e.g. "gap=0.5,import_declaration=0.5"; default: none)
+//   - CODETECT_SEARCH_FRESHNESS_WEIGHT: Max boost of recently modified files'
+//     semantic matches, as a fraction of their score (default: 0, disabled)
 //
 // Reranking:
 //   - CODETECT_RERANK_ENABLED: Enable reranking (default: false)
@@ -125,6 +234,36 @@ func DefaultRerankerConfig() RerankerConfig {
 //   - CODETECT_RERANK_TOP_K: Candidates to rerank (default: 20)
 //   - CODETECT_RERANK_THRESHOLD: Min score threshold (default: 0.0)
 //   - CODETECT_RERANK_BASE_URL: Service base URL (default: http://localhost:11434)
+//   - CODETECT_RERANK_ADAPTIVE_MARGIN: Skip reranking when the top score leads the
+//     runner-up by this fraction of it, 0 to always rerank (default: 0)
+//   - CODETECT_RERANK_PATH_WEIGHTS: Path glob score multipliers as "glob=weight,...",
+//     0 to exclude (e.g. "examples/**=0.5,*.pb.go=0"; default: none)
+//
+// Result cache:
+//   - CODETECT_SEARCH_CACHE_ENABLED: Cache ranked results (default: false)
+//   - CODETECT_SEARCH_CACHE_SIZE: Max cached queries (default: 128)
+//   - CODETECT_SEARCH_CACHE_TTL_SECONDS: Cached result lifetime (default: 60)
+//
+// Startup:
+//   - CODETECT_SEARCH_WARMUP: Preload the semantic index at server start (default: false)
+//
+// Tool calls:
+//   - CODETECT_SEARCH_TOOL_TIMEOUT_MS: Max duration of a hybrid_search_v2 or
+//     search_semantic call in ms, 0 for no limit (default: 15000)
+//   - CODETECT_MCP_CALL_TIMEOUT_MS: Max duration of any tool call in ms, 0 for
+//     no limit (default: 0)
+//   - CODETECT_QUERY_LOG: Log queries and their top results: off, hashed or raw
+//     (default: off)
+//
+// Semantic search:
+//   - CODETECT_SEMANTIC_MIN_SCORE: Min similarity of a relevant search_semantic
+//     result (default: 0)
+//   - CODETECT_KEYWORD_FALLBACK: Search keywords when no semantic result is
+//     relevant (default: true)
+//
+// Similar code:
+//   - CODETECT_SIMILAR_MIN_SCORE: Min similarity of search_by_example and
+//     find_similar_functions results (default: 0)
 func LoadSearchConfigFromEnv() SearchConfig {
 	cfg := DefaultSearchConfig()
 
@@ -169,6 +308,14 @@ func LoadSearchConfigFromEnv() SearchConfig {
 			cfg.Retrieval.Weights["symbol"] = f
 		}
 	}
+	if v := os.Getenv("CODETECT_SEARCH_NODE_TYPE_WEIGHTS"); v != "" {
+		cfg.Retrieval.NodeTypeWeights = parseWeights(v)
+	}
+	if v := os.Getenv("CODETECT_SEARCH_FRESHNESS_WEIGHT"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 {
+			cfg.Retrieval.FreshnessWeight = f
+		}
+	}
 
 	// Reranking config
 	if v := os.Getenv("CODETECT_RERANK_ENABLED"); v != "" {
@@ -193,6 +340,65 @@ func LoadSearchConfigFromEnv() SearchConfig {
 	if v := os.Getenv("CODETECT_RERANK_BASE_URL"); v != "" {
 		cfg.Reranking.BaseURL = v
 	}
+	if v := os.Getenv("CODETECT_RERANK_ADAPTIVE_MARGIN"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 && f <= 1 {
+			cfg.Reranking.AdaptiveMargin = f
+		}
+	}
+	if v := os.Getenv("CODETECT_RERANK_PATH_WEIGHTS"); v != "" {
+		cfg.Reranking.PathWeights = parseWeights(v)
+	}
+
+	// Result cache config
+	if v := os.Getenv("CODETECT_SEARCH_CACHE_ENABLED"); v != "" {
+		cfg.Cache.Enabled = parseBool(v, false)
+	}
+	if v := os.Getenv("CODETECT_SEARCH_CACHE_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			cfg.Cache.Size = n
+		}
+	}
+	if v := os.Getenv("CODETECT_SEARCH_CACHE_TTL_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.Cache.TTLSeconds = n
+		}
+	}
+
+	// Startup
+	if v := os.Getenv("CODETECT_SEARCH_WARMUP"); v != "" {
+		cfg.Warmup = parseBool(v, false)
+	}
+	if v := os.Getenv("CODETECT_SIMILAR_MIN_SCORE"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 && f <= 1 {
+			cfg.SimilarMinScore = f
+		}
+	}
+	if v := os.Getenv("CODETECT_SEMANTIC_MIN_SCORE"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 && f <= 1 {
+			cfg.SemanticMinScore = f
+		}
+	}
+	if v := os.Getenv("CODETECT_KEYWORD_FALLBACK"); v != "" {
+		cfg.KeywordFallback = parseBool(v, true)
+	}
+	if v := os.Getenv("CODETECT_SEARCH_TOOL_TIMEOUT_MS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.ToolTimeoutMs = n
+		}
+	}
+	if v := os.Getenv("CODETECT_MCP_CALL_TIMEOUT_MS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.CallTimeoutMs = n
+		}
+	}
+	if v := os.Getenv("CODETECT_QUERY_LOG"); v != "" {
+		switch mode := strings.ToLower(strings.TrimSpace(v)); mode {
+		case "hashed", "raw":
+			cfg.QueryLog = mode
+		default:
+			cfg.QueryLog = ""
+		}
+	}
 
 	return cfg
 }
@@ -210,6 +416,23 @@ func parseBool(s string, defaultVal bool) bool {
 	}
 }
 
+// parseWeights parses "key=weight" pairs separated by commas. Pairs with a
+// missing key or a negative or invalid weight are skipped.
+func parseWeights(s string) map[string]float64 {
+	weights := make(map[string]float64)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			continue
+		}
+		if f, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && f >= 0 {
+			weights[key] = f
+		}
+	}
+	return weights
+}
+
 // WithKeywordLimit returns a copy of the config with the keyword limit set.
 func (c RetrieverConfig) WithKeywordLimit(n int) RetrieverConfig {
 	c.KeywordLimit = n
@@ -234,6 +457,18 @@ func (c RetrieverConfig) WithParallel(parallel bool) RetrieverConfig {
 	return c
 }
 
+// WithNodeTypeWeights returns a copy of the config with node type weights set.
+func (c RetrieverConfig) WithNodeTypeWeights(weights map[string]float64) RetrieverConfig {
+	c.NodeTypeWeights = weights
+	return c
+}
+
+// WithFreshnessWeight returns a copy of the config with the freshness weight set.
+func (c RetrieverConfig) WithFreshnessWeight(weight float64) RetrieverConfig {
+	c.FreshnessWeight = weight
+	return c
+}
+
 // WithEnabled returns a copy of the config with enabled setting.
 func (c RerankerConfig) WithEnabled(enabled bool) RerankerConfig {
 	c.Enabled = enabled
@@ -246,6 +481,12 @@ func (c RerankerConfig) WithTopK(k int) RerankerConfig {
 	return c
 }
 
+// WithPathWeights returns a copy of the config with path weights set.
+func (c RerankerConfig) WithPathWeights(weights map[string]float64) RerankerConfig {
+	c.PathWeights = weights
+	return c
+}
+
 // TotalRetrievalLimit returns the sum of all signal limits.
 func (c RetrieverConfig) TotalRetrievalLimit() int {
 	return c.KeywordLimit + c.SemanticLimit + c.SymbolLimit
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"reflect"
 	"testing"
 )
 
@@ -59,10 +60,13 @@ func TestLoadSearchConfigFromEnv(t *testing.T) {
 		"CODETECT_SEARCH_WEIGHT_KEYWORD",
 		"CODETECT_SEARCH_WEIGHT_SEMANTIC",
 		"CODETECT_SEARCH_WEIGHT_SYMBOL",
+		"CODETECT_SEARCH_NODE_TYPE_WEIGHTS",
 		"CODETECT_RERANK_ENABLED",
 		"CODETECT_RERANK_MODEL",
 		"CODETECT_RERANK_TOP_K",
 		"CODETECT_RERANK_THRESHOLD",
+		"CODETECT_SEARCH_WARMUP",
+		"CODETECT_SIMILAR_MIN_SCORE",
 	}
 	saved := make(map[string]string)
 	for _, v := range envVars {
@@ -87,10 +91,13 @@ func TestLoadSearchConfigFromEnv(t *testing.T) {
 	os.Setenv("CODETECT_SEARCH_WEIGHT_KEYWORD", "0.4")
 	os.Setenv("CODETECT_SEARCH_WEIGHT_SEMANTIC", "0.4")
 	os.Setenv("CODETECT_SEARCH_WEIGHT_SYMBOL", "0.2")
+	os.Setenv("CODETECT_SEARCH_NODE_TYPE_WEIGHTS", "gap=0.5, import_declaration=0.25,bad,=1,neg=-1,nan=x")
 	os.Setenv("CODETECT_RERANK_ENABLED", "true")
 	os.Setenv("CODETECT_RERANK_MODEL", "custom-model")
 	os.Setenv("CODETECT_RERANK_TOP_K", "50")
 	os.Setenv("CODETECT_RERANK_THRESHOLD", "0.5")
+	os.Setenv("CODETECT_SEARCH_WARMUP", "true")
+	os.Setenv("CODETECT_SIMILAR_MIN_SCORE", "0.8")
 
 	cfg := LoadSearchConfigFromEnv()
 
@@ -118,6 +125,10 @@ func TestLoadSearchConfigFromEnv(t *testing.T) {
 	if cfg.Retrieval.Weights["semantic"] != 0.4 {
 		t.Errorf("expected semantic weight=0.4, got %f", cfg.Retrieval.Weights["semantic"])
 	}
+	wantNodeTypeWeights := map[string]float64{"gap": 0.5, "import_declaration": 0.25}
+	if !reflect.DeepEqual(cfg.Retrieval.NodeTypeWeights, wantNodeTypeWeights) {
+		t.Errorf("expected node type weights %v, got %v", wantNodeTypeWeights, cfg.Retrieval.NodeTypeWeights)
+	}
 
 	// Verify reranking settings
 	if !cfg.Reranking.Enabled {
@@ -132,6 +143,16 @@ func TestLoadSearchConfigFromEnv(t *testing.T) {
 	if cfg.Reranking.Threshold != 0.5 {
 		t.Errorf("expected Threshold=0.5, got %f", cfg.Reranking.Threshold)
 	}
+
+	// Verify startup settings
+	if !cfg.Warmup {
+		t.Error("expected Warmup=true")
+	}
+
+	// Separate from the reranker threshold
+	if cfg.SimilarMinScore != 0.8 {
+		t.Errorf("expected SimilarMinScore=0.8, got %f", cfg.SimilarMinScore)
+	}
 }
 
 func TestParseBool(t *testing.T) {
@@ -195,6 +216,15 @@ func TestRetrieverConfigMethods(t *testing.T) {
 	if updated.Parallel {
 		t.Error("WithParallel: expected false")
 	}
+
+	// Test WithNodeTypeWeights
+	updated = cfg.WithNodeTypeWeights(map[string]float64{"gap": 0.5})
+	if updated.NodeTypeWeights["gap"] != 0.5 {
+		t.Errorf("WithNodeTypeWeights: expected gap=0.5, got %v", updated.NodeTypeWeights)
+	}
+	if cfg.NodeTypeWeights != nil {
+		t.Error("original config should not be modified")
+	}
 }
 
 func TestRerankerConfigMethods(t *testing.T) {
@@ -263,3 +293,125 @@ func TestEnvInvalidValues(t *testing.T) {
 		t.Errorf("expected default KeywordLimit=30 for zero input, got %d", cfg.Retrieval.KeywordLimit)
 	}
 }
+
+func TestLoadSearchConfigToolTimeout(t *testing.T) {
+	if cfg := DefaultSearchConfig(); cfg.ToolTimeoutMs != 15000 {
+		t.Errorf("expected default ToolTimeoutMs=15000, got %d", cfg.ToolTimeoutMs)
+	}
+
+	t.Setenv("CODETECT_SEARCH_TOOL_TIMEOUT_MS", "0")
+	if cfg := LoadSearchConfigFromEnv(); cfg.ToolTimeoutMs != 0 {
+		t.Errorf("expected ToolTimeoutMs=0 (no limit), got %d", cfg.ToolTimeoutMs)
+	}
+
+	t.Setenv("CODETECT_SEARCH_TOOL_TIMEOUT_MS", "-1")
+	if cfg := LoadSearchConfigFromEnv(); cfg.ToolTimeoutMs != 15000 {
+		t.Errorf("expected default ToolTimeoutMs for negative input, got %d", cfg.ToolTimeoutMs)
+	}
+}
+
+func TestLoadSearchConfigCallTimeout(t *testing.T) {
+	if cfg := DefaultSearchConfig(); cfg.CallTimeoutMs != 0 {
+		t.Errorf("expected default CallTimeoutMs=0, got %d", cfg.CallTimeoutMs)
+	}
+
+	t.Setenv("CODETECT_MCP_CALL_TIMEOUT_MS", "30000")
+	if cfg := LoadSearchConfigFromEnv(); cfg.CallTimeoutMs != 30000 {
+		t.Errorf("expected CallTimeoutMs=30000, got %d", cfg.CallTimeoutMs)
+	}
+
+	t.Setenv("CODETECT_MCP_CALL_TIMEOUT_MS", "-1")
+	if cfg := LoadSearchConfigFromEnv(); cfg.CallTimeoutMs != 0 {
+		t.Errorf("expected default CallTimeoutMs for negative input, got %d", cfg.CallTimeoutMs)
+	}
+}
+
+func TestLoadSearchConfigAdaptiveMargin(t *testing.T) {
+	if cfg := DefaultSearchConfig(); cfg.Reranking.AdaptiveMargin != 0 {
+		t.Errorf("expected default AdaptiveMargin=0, got %f", cfg.Reranking.AdaptiveMargin)
+	}
+
+	t.Setenv("CODETECT_RERANK_ADAPTIVE_MARGIN", "0.25")
+	if cfg := LoadSearchConfigFromEnv(); cfg.Reranking.AdaptiveMargin != 0.25 {
+		t.Errorf("expected AdaptiveMargin=0.25, got %f", cfg.Reranking.AdaptiveMargin)
+	}
+
+	t.Setenv("CODETECT_RERANK_ADAPTIVE_MARGIN", "1.5")
+	if cfg := LoadSearchConfigFromEnv(); cfg.Reranking.AdaptiveMargin != 0 {
+		t.Errorf("expected AdaptiveMargin=0 for a margin over 1, got %f", cfg.Reranking.AdaptiveMargin)
+	}
+}
+
+func TestLoadSearchConfigFreshnessWeight(t *testing.T) {
+	if cfg := DefaultSearchConfig(); cfg.Retrieval.FreshnessWeight != 0 {
+		t.Errorf("expected freshness boost off by default, got %f", cfg.Retrieval.FreshnessWeight)
+	}
+
+	t.Setenv("CODETECT_SEARCH_FRESHNESS_WEIGHT", "0.05")
+	if cfg := LoadSearchConfigFromEnv(); cfg.Retrieval.FreshnessWeight != 0.05 {
+		t.Errorf("expected FreshnessWeight=0.05, got %f", cfg.Retrieval.FreshnessWeight)
+	}
+
+	t.Setenv("CODETECT_SEARCH_FRESHNESS_WEIGHT", "-1")
+	if cfg := LoadSearchConfigFromEnv(); cfg.Retrieval.FreshnessWeight != 0 {
+		t.Errorf("expected FreshnessWeight=0 for a negative weight, got %f", cfg.Retrieval.FreshnessWeight)
+	}
+
+	if updated := DefaultRetrieverConfig().WithFreshnessWeight(0.1); updated.FreshnessWeight != 0.1 {
+		t.Errorf("WithFreshnessWeight: expected 0.1, got %f", updated.FreshnessWeight)
+	}
+}
+
+func TestLoadSearchConfigRerankPathWeights(t *testing.T) {
+	if cfg := DefaultSearchConfig(); cfg.Reranking.PathWeights != nil {
+		t.Errorf("expected no path weights by default, got %v", cfg.Reranking.PathWeights)
+	}
+
+	t.Setenv("CODETECT_RERANK_PATH_WEIGHTS", "examples/**=0.5, *.pb.go=0,bad=-1")
+	cfg := LoadSearchConfigFromEnv()
+	want := map[string]float64{"examples/**": 0.5, "*.pb.go": 0}
+	if !reflect.DeepEqual(cfg.Reranking.PathWeights, want) {
+		t.Errorf("expected path weights %v, got %v", want, cfg.Reranking.PathWeights)
+	}
+
+	updated := DefaultRerankerConfig().WithPathWeights(map[string]float64{"vendor/**": 0})
+	if w, ok := updated.PathWeights["vendor/**"]; !ok || w != 0 {
+		t.Errorf("WithPathWeights: expected vendor/**=0, got %v", updated.PathWeights)
+	}
+}
+
+func TestLoadSearchConfigQueryLog(t *testing.T) {
+	if cfg := DefaultSearchConfig(); cfg.QueryLog != "" {
+		t.Errorf("expected query log off by default, got %q", cfg.QueryLog)
+	}
+
+	for value, want := range map[string]string{"hashed": "hashed", " RAW ": "raw", "off": "", "verbose": ""} {
+		t.Setenv("CODETECT_QUERY_LOG", value)
+		if cfg := LoadSearchConfigFromEnv(); cfg.QueryLog != want {
+			t.Errorf("CODETECT_QUERY_LOG=%q: QueryLog = %q, want %q", value, cfg.QueryLog, want)
+		}
+	}
+}
+
+func TestLoadSearchConfigKeywordFallback(t *testing.T) {
+	cfg := DefaultSearchConfig()
+	if !cfg.KeywordFallback || cfg.SemanticMinScore != 0 {
+		t.Errorf("expected KeywordFallback=true and SemanticMinScore=0 by default, got %v and %f",
+			cfg.KeywordFallback, cfg.SemanticMinScore)
+	}
+
+	t.Setenv("CODETECT_SEMANTIC_MIN_SCORE", "0.4")
+	t.Setenv("CODETECT_KEYWORD_FALLBACK", "false")
+	cfg = LoadSearchConfigFromEnv()
+	if cfg.SemanticMinScore != 0.4 {
+		t.Errorf("expected SemanticMinScore=0.4, got %f", cfg.SemanticMinScore)
+	}
+	if cfg.KeywordFallback {
+		t.Error("expected KeywordFallback=false")
+	}
+
+	t.Setenv("CODETECT_SEMANTIC_MIN_SCORE", "2")
+	if cfg := LoadSearchConfigFromEnv(); cfg.SemanticMinScore != 0 {
+		t.Errorf("expected SemanticMinScore=0 for a score over 1, got %f", cfg.SemanticMinScore)
+	}
+}
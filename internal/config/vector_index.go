@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Vector index types the indexer can build, selected with
+// CODETECT_VECTOR_INDEX.
+const (
+	// VectorIndexHNSW searches by brute force until HNSWConfig.MinVectors
+	// vectors, then with the database's native index: HNSW on PostgreSQL,
+	// vec0 on SQLite. It is the default.
+	VectorIndexHNSW = "hnsw"
+
+	// VectorIndexPQ keeps product-quantized codes in memory and re-ranks
+	// candidates against full-precision vectors (see PQConfig). It trades
+	// some recall for memory on million-scale indexes.
+	VectorIndexPQ = "pq"
+)
+
+// ParseVectorIndexType validates a vector index type and returns its
+// canonical form. Case is ignored, and an empty string is VectorIndexHNSW.
+func ParseVectorIndexType(s string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", VectorIndexHNSW:
+		return VectorIndexHNSW, nil
+	case VectorIndexPQ:
+		return VectorIndexPQ, nil
+	default:
+		return "", fmt.Errorf("unknown vector index %q (supported: hnsw, pq)", s)
+	}
+}
+
+// LoadVectorIndexTypeFromEnv returns the vector index type from
+// CODETECT_VECTOR_INDEX. Unknown values log a warning and use
+// VectorIndexHNSW.
+func LoadVectorIndexTypeFromEnv() string {
+	t, err := ParseVectorIndexType(os.Getenv("CODETECT_VECTOR_INDEX"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v, using hnsw\n", err)
+		return VectorIndexHNSW
+	}
+	return t
+}
+
+// LoadVectorShardByRepoFromEnv reports whether CODETECT_VECTOR_SHARD_BY_REPO
+// asks for one vector index shard per repository.
+func LoadVectorShardByRepoFromEnv() bool {
+	return parseBool(os.Getenv("CODETECT_VECTOR_SHARD_BY_REPO"), false)
+}
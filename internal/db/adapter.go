@@ -186,6 +186,12 @@ type Config struct {
 	// Ignored for other database types.
 	EnableWAL bool
 
+	// BusyTimeout is how long, in milliseconds, a SQLite connection waits
+	// for a lock held by another connection or process before failing with
+	// "database is locked". 0 uses DefaultBusyTimeout; negative fails
+	// immediately. Ignored for other database types.
+	BusyTimeout int
+
 	// VectorDimensions specifies the embedding vector size.
 	// If > 0 and driver supports it, vector tables will be created.
 	VectorDimensions int
@@ -201,8 +207,23 @@ type Config struct {
 	// ConnMaxLifetime is the maximum amount of time a connection may be reused.
 	// 0 means connections are not closed due to age.
 	ConnMaxLifetime int // in seconds
+
+	// ReadRetries is how many times a read query that fails because the
+	// connection was lost is retried (see RetryDB). 0 uses
+	// DefaultReadRetries; negative disables retries. PostgreSQL only.
+	ReadRetries int
+
+	// RetryBackoff is the delay, in milliseconds, before the first retry
+	// of a read query, doubled for each further retry. 0 uses
+	// DefaultRetryBackoff. PostgreSQL only.
+	RetryBackoff int
 }
 
+// DefaultBusyTimeout is the SQLite busy timeout, in milliseconds, used when
+// Config.BusyTimeout is 0. It covers an indexer write transaction committing
+// while the MCP server reads, and the reverse.
+const DefaultBusyTimeout = 5000
+
 // DefaultConfig returns a Config with sensible defaults for SQLite.
 func DefaultConfig(path string) Config {
 	return Config{
@@ -4,8 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 
 	_ "modernc.org/sqlite" // Register modernc SQLite driver
 )
@@ -31,22 +33,54 @@ func OpenModernc(cfg Config) (*ModerncDB, error) {
 		}
 	}
 
-	db, err := sql.Open("sqlite", cfg.Path)
+	db, err := sql.Open("sqlite", SQLiteDSN(cfg.Path, cfg.EnableWAL, cfg.BusyTimeout))
 	if err != nil {
 		return nil, fmt.Errorf("opening database: %w", err)
 	}
 
-	// Enable WAL mode for better concurrent performance
-	if cfg.EnableWAL && cfg.Path != ":memory:" {
-		if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
-			db.Close()
-			return nil, fmt.Errorf("setting WAL mode: %w", err)
-		}
+	// Connection pragmas are applied on connect; surface their errors here
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("opening database: %w", err)
 	}
 
 	return &ModerncDB{db: db, path: cfg.Path}, nil
 }
 
+// SQLiteDSN builds a modernc.org/sqlite data source name for path. Pragmas
+// are passed in the DSN rather than executed once, because the driver
+// applies DSN pragmas to every pooled connection, while a PRAGMA statement
+// only affects the connection that ran it.
+//
+//   - busy_timeout makes a connection wait for locks held by other
+//     connections or processes instead of failing with "database is
+//     locked" (see Config.BusyTimeout).
+//   - WAL journaling (for file databases when wal is set) lets readers run
+//     alongside a writer.
+//   - Transactions begin IMMEDIATE, taking the write lock up front. A
+//     deferred transaction that reads and then writes cannot wait for the
+//     lock to upgrade; it fails at once whatever the busy timeout.
+func SQLiteDSN(path string, wal bool, busyTimeout int) string {
+	if busyTimeout == 0 {
+		busyTimeout = DefaultBusyTimeout
+	}
+
+	params := url.Values{}
+	if busyTimeout > 0 {
+		params.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", busyTimeout))
+	}
+	if wal && path != ":memory:" {
+		params.Add("_pragma", "journal_mode(WAL)")
+	}
+	params.Set("_txlock", "immediate")
+
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + params.Encode()
+}
+
 // Query executes a query that returns rows.
 func (m *ModerncDB) Query(query string, args ...any) (Rows, error) {
 	rows, err := m.db.Query(query, args...)
@@ -81,7 +81,19 @@ func openPostgres(cfg Config) (DB, error) {
 		return nil, fmt.Errorf("failed to ping postgres: %w", err)
 	}
 
-	return WrapSQL(sqlDB), nil
+	// Retry reads across connection loss, e.g. a server restart
+	retries := cfg.ReadRetries
+	if retries == 0 {
+		retries = DefaultReadRetries
+	}
+	if retries < 0 {
+		return WrapSQL(sqlDB), nil
+	}
+	backoff := cfg.RetryBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	return WithReadRetry(WrapSQL(sqlDB), retries, time.Duration(backoff)*time.Millisecond), nil
 }
 
 // openClickHouse opens a ClickHouse database connection.
@@ -0,0 +1,174 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+// DefaultReadRetries is how many times a PostgreSQL read query is retried
+// after losing its connection when Config.ReadRetries is 0.
+const DefaultReadRetries = 3
+
+// DefaultRetryBackoff is the delay, in milliseconds, before the first retry
+// of a read query when Config.RetryBackoff is 0.
+const DefaultRetryBackoff = 100
+
+// maxRetryBackoff caps the delay between retries.
+const maxRetryBackoff = 5 * time.Second
+
+// RetryDB retries read queries that fail because the connection to the
+// database was lost, as happens when the server restarts or fails over.
+// The connection pool discards the broken connection, so a retry runs on a
+// new one. Exec, transactions and queries that may write are never
+// retried, since they may have taken effect before the connection dropped.
+// Errors while iterating rows already returned are not retried either.
+type RetryDB struct {
+	DB
+	retries int
+	backoff time.Duration
+
+	// sleep waits between attempts; replaced in tests
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// WithReadRetry wraps database so read queries are retried up to retries
+// times after a connection error (see IsConnectionError), waiting backoff
+// before the first retry and twice as long before each further one.
+func WithReadRetry(database DB, retries int, backoff time.Duration) *RetryDB {
+	return &RetryDB{
+		DB:      database,
+		retries: retries,
+		backoff: backoff,
+		sleep:   sleepContext,
+	}
+}
+
+// Query executes a query that returns rows, retrying reads.
+func (r *RetryDB) Query(query string, args ...any) (Rows, error) {
+	return r.QueryContext(context.Background(), query, args...)
+}
+
+// QueryContext executes a query with context, retrying reads.
+func (r *RetryDB) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	var rows Rows
+	err := r.retry(ctx, query, func() error {
+		var err error
+		rows, err = r.DB.QueryContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// QueryRow executes a query expected to return at most one row, retrying
+// reads.
+func (r *RetryDB) QueryRow(query string, args ...any) Row {
+	return r.QueryRowContext(context.Background(), query, args...)
+}
+
+// QueryRowContext executes a single-row query with context, retrying
+// reads.
+func (r *RetryDB) QueryRowContext(ctx context.Context, query string, args ...any) Row {
+	var row Row
+	r.retry(ctx, query, func() error { //nolint:errcheck // Reported by row.Err
+		row = r.DB.QueryRowContext(ctx, query, args...)
+		return row.Err()
+	})
+	return row
+}
+
+// retry runs attempt, and again after each connection error while retries
+// remain, if query is a read.
+func (r *RetryDB) retry(ctx context.Context, query string, attempt func() error) error {
+	err := attempt()
+	if err == nil || !isReadQuery(query) {
+		return err
+	}
+
+	delay := r.backoff
+	for i := 0; i < r.retries && IsConnectionError(err) && ctx.Err() == nil; i++ {
+		if sleepErr := r.sleep(ctx, delay); sleepErr != nil {
+			return err
+		}
+		delay = min(delay*2, maxRetryBackoff)
+		err = attempt()
+	}
+	return err
+}
+
+// sleepContext waits for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// isReadQuery reports whether query only reads, so running it again cannot
+// change anything.
+func isReadQuery(query string) bool {
+	q := strings.ToLower(strings.TrimLeft(query, " \t\r\n("))
+	switch {
+	case strings.HasPrefix(q, "select"), strings.HasPrefix(q, "show"), strings.HasPrefix(q, "values"):
+		return true
+	case strings.HasPrefix(q, "with"):
+		// Data-modifying CTEs
+		isWord := func(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+		for _, word := range strings.FieldsFunc(q, func(r rune) bool { return !isWord(r) }) {
+			switch word {
+			case "insert", "update", "delete", "merge":
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// IsConnectionError reports whether err means the connection to the
+// database was lost or could not be made, rather than that the query
+// failed.
+func IsConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "57P01", "57P02", "57P03": // admin_shutdown, crash_shutdown, cannot_connect_now
+			return true
+		}
+		return pqErr.Code.Class() == "08" // connection_exception
+	}
+	return false
+}
+
+// Verify interface compliance at compile time.
+var _ DB = (*RetryDB)(nil)
@@ -0,0 +1,242 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// droppingDB fails the next drops queries and execs with a lost
+// connection, as a server restart would, then passes them through.
+type droppingDB struct {
+	DB
+	drops int
+	calls int
+}
+
+func (d *droppingDB) drop() error {
+	d.calls++
+	if d.drops > 0 {
+		d.drops--
+		return fmt.Errorf("reading response: %w", driver.ErrBadConn)
+	}
+	return nil
+}
+
+func (d *droppingDB) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	if err := d.drop(); err != nil {
+		return nil, err
+	}
+	return d.DB.QueryContext(ctx, query, args...)
+}
+
+func (d *droppingDB) QueryRowContext(ctx context.Context, query string, args ...any) Row {
+	if err := d.drop(); err != nil {
+		return errRow{err}
+	}
+	return d.DB.QueryRowContext(ctx, query, args...)
+}
+
+func (d *droppingDB) Exec(query string, args ...any) (Result, error) {
+	if err := d.drop(); err != nil {
+		return nil, err
+	}
+	return d.DB.Exec(query, args...)
+}
+
+type errRow struct{ err error }
+
+func (r errRow) Scan(dest ...any) error { return r.err }
+func (r errRow) Err() error             { return r.err }
+
+func setupRetryDB(t *testing.T, retries int) (*RetryDB, *droppingDB, *[]time.Duration) {
+	t.Helper()
+	database, err := Open(DefaultConfig(":memory:"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if _, err := database.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatalf("creating table: %v", err)
+	}
+	if _, err := database.Exec("INSERT INTO items (name) VALUES ('one'), ('two')"); err != nil {
+		t.Fatalf("inserting rows: %v", err)
+	}
+
+	dropping := &droppingDB{DB: database}
+	retry := WithReadRetry(dropping, retries, 10*time.Millisecond)
+	var delays []time.Duration
+	retry.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return ctx.Err()
+	}
+	return retry, dropping, &delays
+}
+
+func TestRetryDB_Query(t *testing.T) {
+	t.Run("retries a read after the connection drops", func(t *testing.T) {
+		database, dropping, delays := setupRetryDB(t, 3)
+		dropping.drops = 2
+
+		rows, err := database.Query("SELECT name FROM items ORDER BY id")
+		if err != nil {
+			t.Fatalf("Query() error = %v", err)
+		}
+		var names []string
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				t.Fatalf("Scan() error = %v", err)
+			}
+			names = append(names, name)
+		}
+		rows.Close()
+
+		if !reflect.DeepEqual(names, []string{"one", "two"}) {
+			t.Errorf("names = %v, want [one two]", names)
+		}
+		if dropping.calls != 3 {
+			t.Errorf("calls = %d, want 3", dropping.calls)
+		}
+		if want := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}; !reflect.DeepEqual(*delays, want) {
+			t.Errorf("delays = %v, want %v", *delays, want)
+		}
+	})
+
+	t.Run("gives up after the configured retries", func(t *testing.T) {
+		database, dropping, _ := setupRetryDB(t, 2)
+		dropping.drops = 5
+
+		_, err := database.Query("SELECT name FROM items")
+		if !errors.Is(err, driver.ErrBadConn) {
+			t.Errorf("Query() error = %v, want ErrBadConn", err)
+		}
+		if dropping.calls != 3 {
+			t.Errorf("calls = %d, want 3", dropping.calls)
+		}
+	})
+
+	t.Run("does not retry writes", func(t *testing.T) {
+		database, dropping, _ := setupRetryDB(t, 3)
+		dropping.drops = 1
+
+		if _, err := database.Query("INSERT INTO items (name) VALUES ('three') RETURNING id"); err == nil {
+			t.Error("Query() of an insert succeeded after a dropped connection")
+		}
+		dropping.drops = 1
+		if _, err := database.Exec("DELETE FROM items"); err == nil {
+			t.Error("Exec() succeeded after a dropped connection")
+		}
+		if dropping.calls != 2 {
+			t.Errorf("calls = %d, want 2", dropping.calls)
+		}
+	})
+
+	t.Run("does not retry query errors", func(t *testing.T) {
+		database, dropping, _ := setupRetryDB(t, 3)
+
+		if _, err := database.Query("SELECT missing FROM items"); err == nil {
+			t.Error("Query() of a missing column succeeded")
+		}
+		if dropping.calls != 1 {
+			t.Errorf("calls = %d, want 1", dropping.calls)
+		}
+	})
+
+	t.Run("stops when the context is done", func(t *testing.T) {
+		database, dropping, _ := setupRetryDB(t, 3)
+		dropping.drops = 5
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if _, err := database.QueryContext(ctx, "SELECT name FROM items"); err == nil {
+			t.Error("QueryContext() succeeded")
+		}
+		if dropping.calls != 1 {
+			t.Errorf("calls = %d, want 1", dropping.calls)
+		}
+	})
+}
+
+func TestRetryDB_QueryRow(t *testing.T) {
+	database, dropping, _ := setupRetryDB(t, 3)
+	dropping.drops = 1
+
+	var name string
+	if err := database.QueryRow("SELECT name FROM items WHERE id = ?", 2).Scan(&name); err != nil {
+		t.Fatalf("QueryRow() error = %v", err)
+	}
+	if name != "two" || dropping.calls != 2 {
+		t.Errorf("name = %q after %d calls, want two after 2", name, dropping.calls)
+	}
+}
+
+func TestRetryDB_BackoffCap(t *testing.T) {
+	database, dropping, delays := setupRetryDB(t, 4)
+	database.backoff = 2 * time.Second
+	dropping.drops = 4
+
+	if _, err := database.Query("SELECT name FROM items"); err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	want := []time.Duration{2 * time.Second, 4 * time.Second, maxRetryBackoff, maxRetryBackoff}
+	if !reflect.DeepEqual(*delays, want) {
+		t.Errorf("delays = %v, want %v", *delays, want)
+	}
+}
+
+func TestIsReadQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"SELECT 1", true},
+		{"  select * from t", true},
+		{"(SELECT 1) UNION (SELECT 2)", true},
+		{"WITH x AS (SELECT 1) SELECT * FROM x", true},
+		{"WITH x AS (DELETE FROM t RETURNING id) SELECT * FROM x", false},
+		{"SHOW server_version", true},
+		{"INSERT INTO t VALUES (1)", false},
+		{"UPDATE t SET a = 1", false},
+		{"CREATE TABLE t (a INT)", false},
+	}
+	for _, tt := range tests {
+		if got := isReadQuery(tt.query); got != tt.want {
+			t.Errorf("isReadQuery(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestIsConnectionError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"bad conn", driver.ErrBadConn, true},
+		{"eof", fmt.Errorf("reading: %w", io.EOF), true},
+		{"reset", &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, true},
+		{"refused", syscall.ECONNREFUSED, true},
+		{"admin shutdown", &pq.Error{Code: "57P01"}, true},
+		{"connection failure", &pq.Error{Code: "08006"}, true},
+		{"syntax error", &pq.Error{Code: "42601"}, false},
+		{"other", errors.New("no such table"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsConnectionError(tt.err); got != tt.want {
+				t.Errorf("IsConnectionError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
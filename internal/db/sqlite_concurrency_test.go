@@ -0,0 +1,203 @@
+package db
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSQLiteDSN(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		wal         bool
+		busyTimeout int
+		want        []string
+		notWant     []string
+	}{
+		{
+			name:        "defaults",
+			path:        "/repo/.codetect/index.db",
+			wal:         true,
+			busyTimeout: 0,
+			want:        []string{"/repo/.codetect/index.db?", "busy_timeout%285000%29", "journal_mode%28WAL%29", "_txlock=immediate"},
+		},
+		{
+			name:        "custom timeout without WAL",
+			path:        "index.db",
+			busyTimeout: 250,
+			want:        []string{"busy_timeout%28250%29"},
+			notWant:     []string{"journal_mode"},
+		},
+		{
+			name:        "no waiting",
+			path:        "index.db",
+			busyTimeout: -1,
+			notWant:     []string{"busy_timeout"},
+		},
+		{
+			name:    "in-memory skips WAL",
+			path:    ":memory:",
+			wal:     true,
+			notWant: []string{"journal_mode"},
+		},
+		{
+			name: "existing query",
+			path: "file:index.db?mode=rwc",
+			want: []string{"file:index.db?mode=rwc&"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dsn := SQLiteDSN(tt.path, tt.wal, tt.busyTimeout)
+			for _, s := range tt.want {
+				if !strings.Contains(dsn, s) {
+					t.Errorf("SQLiteDSN() = %q, missing %q", dsn, s)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(dsn, s) {
+					t.Errorf("SQLiteDSN() = %q, should not contain %q", dsn, s)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenModerncPragmasOnEveryConnection(t *testing.T) {
+	cfg := DefaultConfig(filepath.Join(t.TempDir(), "index.db"))
+	cfg.BusyTimeout = 1234
+	db, err := OpenModernc(cfg)
+	if err != nil {
+		t.Fatalf("OpenModernc() error = %v", err)
+	}
+	defer db.Close()
+
+	// Hold one connection in a transaction so the next query opens another
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Begin() error = %v", err)
+	}
+	defer tx.Rollback()
+
+	for name, conn := range map[string]interface {
+		QueryRow(string, ...any) Row
+	}{"transaction": tx, "pool": db} {
+		var timeout int
+		if err := conn.QueryRow("PRAGMA busy_timeout").Scan(&timeout); err != nil {
+			t.Fatalf("%s: reading busy_timeout: %v", name, err)
+		}
+		if timeout != 1234 {
+			t.Errorf("%s: busy_timeout = %d, want 1234", name, timeout)
+		}
+		var mode string
+		if err := conn.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+			t.Fatalf("%s: reading journal_mode: %v", name, err)
+		}
+		if mode != "wal" {
+			t.Errorf("%s: journal_mode = %q, want wal", name, mode)
+		}
+	}
+}
+
+// TestSQLiteConcurrentReadWrite simulates the indexer and the MCP server
+// using one database file from separate handles: two writers (indexing and
+// access-stat updates) run read-then-write transactions while readers query.
+// None of them should see "database is locked".
+func TestSQLiteConcurrentReadWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.db")
+
+	open := func() DB {
+		t.Helper()
+		db, err := Open(DefaultConfig(path))
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+
+	setup := open()
+	if _, err := setup.Exec("CREATE TABLE chunks (id INTEGER PRIMARY KEY, writer INTEGER, n INTEGER)"); err != nil {
+		t.Fatalf("creating table: %v", err)
+	}
+
+	const writers, readers, txPerWriter, rowsPerTx = 2, 4, 30, 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers+readers)
+	done := make(chan struct{})
+
+	for w := 0; w < writers; w++ {
+		db := open()
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < txPerWriter; i++ {
+				tx, err := db.Begin()
+				if err != nil {
+					errs <- fmt.Errorf("writer %d begin: %w", w, err)
+					return
+				}
+				var count int
+				if err := tx.QueryRow("SELECT COUNT(*) FROM chunks WHERE writer = ?", w).Scan(&count); err != nil {
+					tx.Rollback()
+					errs <- fmt.Errorf("writer %d read: %w", w, err)
+					return
+				}
+				for j := 0; j < rowsPerTx; j++ {
+					if _, err := tx.Exec("INSERT INTO chunks (writer, n) VALUES (?, ?)", w, count+j); err != nil {
+						tx.Rollback()
+						errs <- fmt.Errorf("writer %d insert: %w", w, err)
+						return
+					}
+				}
+				if err := tx.Commit(); err != nil {
+					errs <- fmt.Errorf("writer %d commit: %w", w, err)
+					return
+				}
+			}
+		}(w)
+	}
+
+	var readerWG sync.WaitGroup
+	for r := 0; r < readers; r++ {
+		db := open()
+		readerWG.Add(1)
+		go func(r int) {
+			defer readerWG.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				var count int
+				if err := db.QueryRow("SELECT COUNT(*) FROM chunks").Scan(&count); err != nil {
+					errs <- fmt.Errorf("reader %d: %w", r, err)
+					return
+				}
+			}
+		}(r)
+	}
+
+	wg.Wait()
+	close(done)
+	readerWG.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	var total int
+	if err := setup.QueryRow("SELECT COUNT(*) FROM chunks").Scan(&total); err != nil {
+		t.Fatalf("counting rows: %v", err)
+	}
+	if want := writers * txPerWriter * rowsPerTx; total != want {
+		t.Errorf("got %d rows, want %d", total, want)
+	}
+}
@@ -18,6 +18,7 @@ type SQLiteVecStore struct {
 	dimensions   int
 	tableName    string
 	vecTableName string
+	metric       string
 	useVec0      bool // Whether sqlite-vec is available
 }
 
@@ -31,6 +32,11 @@ type SQLiteVecConfig struct {
 
 	// VecTableName is the vec0 virtual table name (default: vec_embeddings)
 	VecTableName string
+
+	// DistanceMetric is "cosine" (default) or "euclidean". sqlite-vec has
+	// no inner-product distance, so "dot_product" disables vec0 and
+	// callers fall back to brute force.
+	DistanceMetric string
 }
 
 // NewSQLiteVecStore creates a new sqlite-vec backed vector store.
@@ -48,11 +54,12 @@ func NewSQLiteVecStore(database DB, cfg SQLiteVecConfig) (*SQLiteVecStore, error
 		dimensions:   cfg.Dimensions,
 		tableName:    cfg.TableName,
 		vecTableName: cfg.VecTableName,
+		metric:       cfg.DistanceMetric,
 		useVec0:      false,
 	}
 
-	// Check if sqlite-vec is available
-	if store.checkVecAvailable() {
+	// Check if sqlite-vec is available and supports the metric
+	if _, ok := vec0DistanceMetric(store.metric); ok && store.checkVecAvailable() {
 		store.useVec0 = true
 		if err := store.initVecTable(); err != nil {
 			// Log but don't fail - fall back to brute force
@@ -83,16 +90,35 @@ func (s *SQLiteVecStore) checkVecAvailable() bool {
 	return true
 }
 
-// initVecTable creates the vec0 virtual table for vector search.
+// vec0DistanceMetric returns the vec0 distance_metric option for a
+// metric name, and false if sqlite-vec cannot compute it.
+func vec0DistanceMetric(metric string) (string, bool) {
+	switch metric {
+	case "", "cosine":
+		return "cosine", true
+	case "euclidean":
+		return "L2", true
+	default:
+		return "", false
+	}
+}
+
+// initVecTable creates the vec0 virtual table for vector search. A table
+// created with another metric is kept until Rebuild recreates it.
 func (s *SQLiteVecStore) initVecTable() error {
+	distance, ok := vec0DistanceMetric(s.metric)
+	if !ok {
+		return fmt.Errorf("sqlite-vec does not support distance metric %q", s.metric)
+	}
+
 	// vec0 virtual table schema
 	// content_hash is used to link back to the main embeddings table
 	createSQL := fmt.Sprintf(`
 		CREATE VIRTUAL TABLE IF NOT EXISTS %s USING vec0(
 			content_hash TEXT PRIMARY KEY,
-			embedding FLOAT[%d]
+			embedding FLOAT[%d] distance_metric=%s
 		)
-	`, s.vecTableName, s.dimensions)
+	`, s.vecTableName, s.dimensions, distance)
 
 	_, err := s.db.Exec(createSQL)
 	if err != nil {
@@ -190,11 +216,7 @@ func (s *SQLiteVecStore) Search(ctx context.Context, query []float32, k int) ([]
 		if err := rows.Scan(&r.ContentHash, &r.Distance); err != nil {
 			return nil, fmt.Errorf("scanning search result: %w", err)
 		}
-		// Convert distance to similarity score (assuming cosine/L2)
-		r.Score = 1.0 - r.Distance
-		if r.Score < 0 {
-			r.Score = 1.0 / (1.0 + r.Distance)
-		}
+		r.Score = distanceToScore(r.Distance, s.metric)
 		results = append(results, r)
 	}
 
@@ -247,10 +269,7 @@ func (s *SQLiteVecStore) SearchWithRepoFilter(ctx context.Context, query []float
 		if err := rows.Scan(&r.ContentHash, &r.Distance); err != nil {
 			return nil, fmt.Errorf("scanning search result: %w", err)
 		}
-		r.Score = 1.0 - r.Distance
-		if r.Score < 0 {
-			r.Score = 1.0 / (1.0 + r.Distance)
-		}
+		r.Score = distanceToScore(r.Distance, s.metric)
 		results = append(results, r)
 	}
 
@@ -255,3 +255,28 @@ func BenchmarkBlobToFloat32Slice(b *testing.B) {
 		_ = blobToFloat32Slice(blob)
 	}
 }
+
+func TestVec0DistanceMetric(t *testing.T) {
+	tests := []struct {
+		metric string
+		want   string
+		ok     bool
+	}{
+		{"", "cosine", true},
+		{"cosine", "cosine", true},
+		{"euclidean", "L2", true},
+		{"dot_product", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := vec0DistanceMetric(tt.metric)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("vec0DistanceMetric(%q) = %q, %v; want %q, %v", tt.metric, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	// Unsupported metrics never enable vec0, so callers fall back to brute force
+	store := &SQLiteVecStore{vecTableName: "vec_embeddings", dimensions: 3, metric: "dot_product"}
+	if err := store.initVecTable(); err == nil {
+		t.Error("initVecTable succeeded for dot_product")
+	}
+}
@@ -1,8 +1,8 @@
 package embedding
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"strings"
 	"sync"
@@ -16,7 +16,8 @@ import (
 // across files, repos, and time. Identical code chunks share one embedding.
 //
 // For PostgreSQL, uses dimension-grouped tables (embedding_cache_768, etc.)
-// For SQLite, uses a single embedding_cache table with JSON vectors.
+// For SQLite, uses a single embedding_cache table with JSON vectors, or
+// quantized ones (see SetEncoding).
 type EmbeddingCache struct {
 	database   db.DB
 	dialect    db.Dialect
@@ -24,8 +25,32 @@ type EmbeddingCache struct {
 	dimensions int
 	model      string
 	mu         sync.RWMutex // Protects concurrent access
+
+	// Access stats from Get and GetBatch are written by one goroutine,
+	// started on the first hit (see cache_stats.go)
+	statsMu     sync.RWMutex       // Guards statsClosed and the channels
+	statsQueue  chan []string      // Hashes of hits, one message per lookup
+	statsFlush  chan chan struct{} // Flush requests, each closed once written
+	statsDone   chan struct{}      // Closed when the writer has exited
+	statsClosed bool               // Set by Close
+	statsErr    error              // First write error, read after statsDone
+
+	writeBatchSize int // Entries per PutBatch transaction
+	writeWorkers   int // Parallel PutBatch transactions (PostgreSQL only)
+
+	encoding CacheEncoding // Vector encoding on SQLite, see SetEncoding
 }
 
+const (
+	// DefaultWriteBatchSize is the number of entries PutBatch commits per
+	// transaction when no size is configured.
+	DefaultWriteBatchSize = 500
+
+	// DefaultWriteWorkers is how many PutBatch transactions run in
+	// parallel on PostgreSQL when no count is configured.
+	DefaultWriteWorkers = 4
+)
+
 // CacheEntry represents a cached embedding with metadata.
 type CacheEntry struct {
 	ContentHash  string    `json:"content_hash"`
@@ -67,6 +92,42 @@ func NewEmbeddingCache(database db.DB, dialect db.Dialect, dimensions int, model
 	return cache, nil
 }
 
+// SetWriteConcurrency sets how PutBatch splits large writes: batchSize
+// entries per transaction, with up to workers transactions in flight on
+// PostgreSQL. Zero or negative values keep the defaults.
+func (c *EmbeddingCache) SetWriteConcurrency(batchSize, workers int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeBatchSize = batchSize
+	c.writeWorkers = workers
+}
+
+// SetEncoding sets how vectors are stored from now on: CacheEncodingJSON,
+// the default, or CacheEncodingInt8 to store them about a tenth of the
+// size, slightly less precisely. Entries already stored keep their
+// encoding and are still read. It has no effect on PostgreSQL, which
+// stores native vectors. An empty encoding is JSON.
+func (c *EmbeddingCache) SetEncoding(enc CacheEncoding) error {
+	switch enc {
+	case "", CacheEncodingJSON, CacheEncodingInt8:
+	default:
+		return fmt.Errorf("unknown cache encoding %q (supported: json, int8)", enc)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.encoding = enc
+	return nil
+}
+
+// encodeEmbedding serializes a vector for the embedding column. The
+// caller must hold c.mu.
+func (c *EmbeddingCache) encodeEmbedding(embedding []float32) (string, error) {
+	if c.dialect.Name() == "postgres" {
+		return encodeVector(embedding, CacheEncodingJSON) // pgvector parses the JSON array
+	}
+	return encodeVector(embedding, c.encoding)
+}
+
 // initSchema creates the embedding_cache table if it doesn't exist.
 func (c *EmbeddingCache) initSchema() error {
 	tableName := c.tableName()
@@ -207,16 +268,16 @@ func (c *EmbeddingCache) Get(contentHash string) (*CacheEntry, error) {
 		return nil, fmt.Errorf("scanning cache entry: %w", err)
 	}
 
-	// Parse embedding from JSON
-	if err := json.Unmarshal([]byte(embeddingData), &entry.Embedding); err != nil {
+	// Parse embedding in whichever encoding it was stored
+	if entry.Embedding, err = decodeVector(embeddingData); err != nil {
 		return nil, fmt.Errorf("parsing embedding: %w", err)
 	}
 
 	entry.CreatedAt = time.Unix(createdAt, 0)
 	entry.LastAccessed = time.Unix(lastAccessed, 0)
 
-	// Update access stats asynchronously (fire-and-forget)
-	go c.updateAccessStats(contentHash)
+	// Update access stats in the background
+	c.recordAccess([]string{contentHash})
 
 	return &entry, nil
 }
@@ -298,7 +359,8 @@ func (c *EmbeddingCache) GetBatch(hashes []string) (map[string]*CacheEntry, erro
 		}
 
 		// Parse embedding
-		if err := json.Unmarshal([]byte(embeddingData), &entry.Embedding); err != nil {
+		var parseErr error
+		if entry.Embedding, parseErr = decodeVector(embeddingData); parseErr != nil {
 			continue // Skip malformed embeddings
 		}
 
@@ -315,14 +377,15 @@ func (c *EmbeddingCache) GetBatch(hashes []string) (map[string]*CacheEntry, erro
 
 	// Update access stats asynchronously for found entries
 	if len(foundHashes) > 0 {
-		go c.updateAccessStatsBatch(foundHashes)
+		c.recordAccess(foundHashes)
 	}
 
 	return result, nil
 }
 
 // Put stores an embedding in the cache.
-// If the hash already exists, increments access_count and updates last_accessed.
+// If the hash already exists, replaces its embedding and model, increments
+// access_count and updates last_accessed.
 func (c *EmbeddingCache) Put(contentHash string, embedding []float32) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -330,8 +393,8 @@ func (c *EmbeddingCache) Put(contentHash string, embedding []float32) error {
 	tableName := c.tableName()
 	now := time.Now().Unix()
 
-	// Serialize embedding to JSON
-	embJSON, err := json.Marshal(embedding)
+	// Serialize embedding in the configured encoding
+	embData, err := c.encodeEmbedding(embedding)
 	if err != nil {
 		return fmt.Errorf("marshaling embedding: %w", err)
 	}
@@ -347,20 +410,24 @@ func (c *EmbeddingCache) Put(contentHash string, embedding []float32) error {
 			INSERT INTO %s (content_hash, embedding, model, created_at, access_count, last_accessed)
 			VALUES ($1, $2, $3, $4, 1, $5)
 			ON CONFLICT (content_hash) DO UPDATE SET
+				embedding = excluded.embedding,
+				model = excluded.model,
 				access_count = %s.access_count + 1,
 				last_accessed = $6
 		`, tableName, tableName)
-		args = []interface{}{contentHash, string(embJSON), c.model, now, now, now}
+		args = []interface{}{contentHash, embData, c.model, now, now, now}
 	} else {
 		// SQLite: include dimensions column
 		upsertSQL = c.schema.SubstitutePlaceholders(fmt.Sprintf(`
 			INSERT INTO %s (content_hash, embedding, model, dimensions, created_at, access_count, last_accessed)
 			VALUES (?, ?, ?, ?, ?, 1, ?)
 			ON CONFLICT (content_hash) DO UPDATE SET
+				embedding = excluded.embedding,
+				model = excluded.model,
 				access_count = access_count + 1,
 				last_accessed = ?
 		`, tableName))
-		args = []interface{}{contentHash, string(embJSON), c.model, c.dimensions, now, now, now}
+		args = []interface{}{contentHash, embData, c.model, c.dimensions, now, now, now}
 	}
 
 	_, err = c.database.Exec(upsertSQL, args...)
@@ -371,9 +438,23 @@ func (c *EmbeddingCache) Put(contentHash string, embedding []float32) error {
 	return nil
 }
 
-// PutBatch stores multiple embeddings in a transaction.
-// More efficient than individual Put calls for bulk operations.
+// PutBatch stores multiple embeddings, committing them in transactions of
+// at most the write batch size (see SetWriteConcurrency) so a large run
+// never holds one giant transaction. On PostgreSQL up to the configured
+// number of transactions run in parallel; SQLite has a single writer, so
+// its transactions always run one after another.
+//
+// Batches are not atomic as a whole: if one transaction fails, others may
+// already be committed. Writes are upserts, so retrying is safe.
 func (c *EmbeddingCache) PutBatch(entries map[string][]float32) error {
+	return c.PutBatchModel(entries, c.model)
+}
+
+// PutBatchModel stores embeddings like PutBatch, tagging them with model
+// instead of the cache's model. It is used for vectors produced by a
+// fallback provider (see FallbackEmbedder), which must have the cache's
+// dimensions.
+func (c *EmbeddingCache) PutBatchModel(entries map[string][]float32, model string) error {
 	if len(entries) == 0 {
 		return nil
 	}
@@ -381,6 +462,66 @@ func (c *EmbeddingCache) PutBatch(entries map[string][]float32) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	hashes := make([]string, 0, len(entries))
+	for hash := range entries {
+		hashes = append(hashes, hash)
+	}
+
+	batchSize := c.writeBatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultWriteBatchSize
+	}
+	var batches [][]string
+	for start := 0; start < len(hashes); start += batchSize {
+		batches = append(batches, hashes[start:min(start+batchSize, len(hashes))])
+	}
+
+	now := time.Now().Unix()
+	workers := c.writeWorkers
+	if workers <= 0 {
+		workers = DefaultWriteWorkers
+	}
+	if c.dialect.Name() != "postgres" || len(batches) == 1 {
+		workers = 1
+	}
+
+	if workers == 1 {
+		for _, batch := range batches {
+			if err := c.putTx(batch, entries, model, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	errs := make(chan error, len(batches))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+
+	for _, batch := range batches {
+		wg.Add(1)
+		go func(batch []string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			errs <- c.putTx(batch, entries, model, now)
+		}(batch)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putTx upserts the embeddings for hashes, tagged with model, in one
+// transaction. The caller must hold c.mu.
+func (c *EmbeddingCache) putTx(hashes []string, entries map[string][]float32, model string, now int64) error {
 	tx, err := c.database.Begin()
 	if err != nil {
 		return fmt.Errorf("beginning transaction: %w", err)
@@ -388,7 +529,6 @@ func (c *EmbeddingCache) PutBatch(entries map[string][]float32) error {
 	defer tx.Rollback() //nolint:errcheck
 
 	tableName := c.tableName()
-	now := time.Now().Unix()
 
 	// Prepare statement based on dialect
 	var stmtSQL string
@@ -397,6 +537,8 @@ func (c *EmbeddingCache) PutBatch(entries map[string][]float32) error {
 			INSERT INTO %s (content_hash, embedding, model, created_at, access_count, last_accessed)
 			VALUES ($1, $2, $3, $4, 1, $5)
 			ON CONFLICT (content_hash) DO UPDATE SET
+				embedding = excluded.embedding,
+				model = excluded.model,
 				access_count = %s.access_count + 1,
 				last_accessed = $6
 		`, tableName, tableName)
@@ -405,6 +547,8 @@ func (c *EmbeddingCache) PutBatch(entries map[string][]float32) error {
 			INSERT INTO %s (content_hash, embedding, model, dimensions, created_at, access_count, last_accessed)
 			VALUES (?, ?, ?, ?, ?, 1, ?)
 			ON CONFLICT (content_hash) DO UPDATE SET
+				embedding = excluded.embedding,
+				model = excluded.model,
 				access_count = access_count + 1,
 				last_accessed = ?
 		`, tableName))
@@ -416,17 +560,17 @@ func (c *EmbeddingCache) PutBatch(entries map[string][]float32) error {
 	}
 	defer stmt.Close()
 
-	for hash, embedding := range entries {
-		embJSON, err := json.Marshal(embedding)
+	for _, hash := range hashes {
+		embData, err := c.encodeEmbedding(entries[hash])
 		if err != nil {
 			return fmt.Errorf("marshaling embedding for %s: %w", hash, err)
 		}
 
 		var execErr error
 		if c.dialect.Name() == "postgres" {
-			_, execErr = stmt.Exec(hash, string(embJSON), c.model, now, now, now)
+			_, execErr = stmt.Exec(hash, embData, model, now, now, now)
 		} else {
-			_, execErr = stmt.Exec(hash, string(embJSON), c.model, c.dimensions, now, now, now)
+			_, execErr = stmt.Exec(hash, embData, model, c.dimensions, now, now, now)
 		}
 
 		if execErr != nil {
@@ -485,6 +629,41 @@ func (c *EmbeddingCache) Count() (int, error) {
 	return count, err
 }
 
+// CachedHash is a content hash stored in a cache table, with the model its
+// vector is tagged with.
+type CachedHash struct {
+	ContentHash string
+	Model       string
+}
+
+// HashesAfter returns up to limit of the content hashes stored in the
+// cache's table that sort after after, in order, to page through the
+// table: pass "" for the first page and the last hash returned for the
+// next. Caches of the same dimensions share a table (all caches do on
+// SQLite), so their entries are included too.
+func (c *EmbeddingCache) HashesAfter(after string, limit int) ([]CachedHash, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	query := fmt.Sprintf("SELECT content_hash, model FROM %s WHERE content_hash > %s ORDER BY content_hash LIMIT %d",
+		c.tableName(), c.dialect.Placeholder(1), limit)
+	rows, err := c.database.Query(query, after)
+	if err != nil {
+		return nil, fmt.Errorf("querying hashes: %w", err)
+	}
+	defer rows.Close()
+
+	var hashes []CachedHash
+	for rows.Next() {
+		var h CachedHash
+		if err := rows.Scan(&h.ContentHash, &h.Model); err != nil {
+			return nil, fmt.Errorf("scanning hash: %w", err)
+		}
+		hashes = append(hashes, h)
+	}
+	return hashes, rows.Err()
+}
+
 // Stats returns cache statistics.
 func (c *EmbeddingCache) Stats() (*CacheStats, error) {
 	c.mu.RLock()
@@ -613,46 +792,25 @@ func (c *EmbeddingCache) EvictByModel(model string) (int, error) {
 	return int(evicted), nil
 }
 
-// updateAccessStats updates access_count and last_accessed for a single entry.
-func (c *EmbeddingCache) updateAccessStats(contentHash string) {
-	tableName := c.tableName()
-	now := time.Now().Unix()
-
-	query := c.schema.SubstitutePlaceholders(fmt.Sprintf(`
-		UPDATE %s SET access_count = access_count + 1, last_accessed = ?
-		WHERE content_hash = ?
-	`, tableName))
-
-	// Fire-and-forget, ignore errors
-	c.database.Exec(query, now, contentHash)
-}
-
-// updateAccessStatsBatch updates access stats for multiple entries.
-func (c *EmbeddingCache) updateAccessStatsBatch(hashes []string) {
-	if len(hashes) == 0 {
-		return
+// Flush waits for pending access stat updates from Get and GetBatch calls
+// that returned before it to be written, asking the writer to write them
+// now. It returns ctx's error if
+// ctx is done first; the updates are still written in the background.
+func (c *EmbeddingCache) Flush(ctx context.Context) error {
+	done, err := c.requestStatsFlush(ctx)
+	if err != nil {
+		return fmt.Errorf("flushing cache access stats: %w", err)
 	}
-
-	tableName := c.tableName()
-	now := time.Now().Unix()
-
-	// Build placeholders starting at index 2 (index 1 is for timestamp)
-	placeholders := make([]string, len(hashes))
-	args := make([]interface{}, len(hashes)+1)
-	args[0] = now
-
-	for i, hash := range hashes {
-		placeholders[i] = c.dialect.Placeholder(i + 2)
-		args[i+1] = hash
+	if done == nil {
+		return nil
 	}
 
-	query := fmt.Sprintf(`
-		UPDATE %s SET access_count = access_count + 1, last_accessed = %s
-		WHERE content_hash IN (%s)
-	`, tableName, c.dialect.Placeholder(1), strings.Join(placeholders, ", "))
-
-	// Fire-and-forget, ignore errors
-	c.database.Exec(query, args...)
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("flushing cache access stats: %w", ctx.Err())
+	}
 }
 
 // Model returns the embedding model this cache is configured for.
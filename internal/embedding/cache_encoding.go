@@ -0,0 +1,101 @@
+package embedding
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// CacheEncoding is how EmbeddingCache stores vectors on SQLite. PostgreSQL
+// always stores native pgvector vectors. Entries are decoded by their own
+// format, so changing the encoding needs no migration: existing entries
+// stay readable and only new writes use the new encoding.
+type CacheEncoding string
+
+const (
+	// CacheEncodingJSON stores vectors as JSON arrays of float32, exactly
+	// but at around 15KB of text per 768-dimension vector. It is the
+	// default.
+	CacheEncodingJSON CacheEncoding = "json"
+
+	// CacheEncodingInt8 stores vectors with int8 scalar quantization: one
+	// float32 scale per vector, the largest absolute component over 127,
+	// and each component rounded to a multiple of it, base64 encoded. A
+	// 768-dimension vector takes about 1KB. Each component is off by at
+	// most half a step, which keeps embedding vectors at a cosine
+	// similarity above 0.999 to the original, so only results whose
+	// scores were near ties can change order.
+	CacheEncodingInt8 CacheEncoding = "int8"
+)
+
+// int8Prefix marks a vector stored with CacheEncodingInt8. JSON vectors
+// always start with '['.
+const int8Prefix = "i8:"
+
+// encodeVector serializes v in encoding enc.
+func encodeVector(v []float32, enc CacheEncoding) (string, error) {
+	if enc == CacheEncodingInt8 {
+		return quantizeInt8(v)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// decodeVector parses a vector stored in either encoding.
+func decodeVector(data string) ([]float32, error) {
+	if encoded, ok := strings.CutPrefix(data, int8Prefix); ok {
+		return dequantizeInt8(encoded)
+	}
+	var v []float32
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// quantizeInt8 encodes v as int8Prefix followed by the base64 of its
+// little-endian float32 scale and one int8 per component.
+func quantizeInt8(v []float32) (string, error) {
+	var maxAbs float64
+	for _, f := range v {
+		a := math.Abs(float64(f))
+		if math.IsNaN(a) || math.IsInf(a, 0) {
+			return "", fmt.Errorf("cannot quantize non-finite value %v", f)
+		}
+		maxAbs = math.Max(maxAbs, a)
+	}
+	scale := float32(maxAbs / 127)
+
+	buf := make([]byte, 4+len(v))
+	binary.LittleEndian.PutUint32(buf, math.Float32bits(scale))
+	if scale > 0 {
+		for i, f := range v {
+			q := math.Round(float64(f) / float64(scale))
+			buf[4+i] = byte(int8(math.Max(-127, math.Min(127, q))))
+		}
+	}
+	return int8Prefix + base64.StdEncoding.EncodeToString(buf), nil
+}
+
+// dequantizeInt8 decodes the base64 part of a quantizeInt8 vector.
+func dequantizeInt8(encoded string) ([]float32, error) {
+	buf, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decoding int8 vector: %w", err)
+	}
+	if len(buf) < 4 {
+		return nil, fmt.Errorf("int8 vector of %d bytes has no scale", len(buf))
+	}
+	scale := math.Float32frombits(binary.LittleEndian.Uint32(buf))
+	v := make([]float32, len(buf)-4)
+	for i, b := range buf[4:] {
+		v[i] = float32(int8(b)) * scale
+	}
+	return v, nil
+}
@@ -0,0 +1,428 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Search granularities for CacheSearcher.
+const (
+	GranularityChunk = "chunk" // Chunk-level locations only (default)
+	GranularityFile  = "file"  // File-level locations only
+	GranularityAll   = "all"   // Both chunk and file locations
+)
+
+// CacheSearcher performs semantic search over the v2 content-addressed
+// embedding cache. Vectors are looked up by the content hashes referenced
+// from a repo's chunk locations and scored against the query by brute force,
+// or, with a vector index, only those of the candidates it finds.
+type CacheSearcher struct {
+	cache     *EmbeddingCache
+	locations *LocationStore
+	embedder  Embedder
+	results   *ResultCache     // Optional cache of ranked results
+	index     *RepoVectorIndex // Optional source of candidates
+	metric    Metric
+	spaces    []ModelSpace // Selectable with CacheSearchOptions.Model
+	indexed   *IndexModel  // Model the index was built with, if recorded
+
+	maxInputBytes int // Truncation of example chunks, as at indexing
+}
+
+// NewCacheSearcher creates a searcher over the given cache and locations.
+func NewCacheSearcher(cache *EmbeddingCache, locations *LocationStore, embedder Embedder) *CacheSearcher {
+	return &CacheSearcher{
+		cache:     cache,
+		locations: locations,
+		embedder:  embedder,
+	}
+}
+
+// SetResultCache enables caching of ranked results. Cached results are
+// reused for repeated queries until their TTL expires or the index changes.
+// A nil cache disables result caching.
+func (s *CacheSearcher) SetResultCache(rc *ResultCache) {
+	s.results = rc
+}
+
+// SetVectorIndex makes searches of the primary model score only the
+// indexCandidateFactor*Limit nearest vectors the index finds, re-ranked
+// exactly by the searcher's metric. When the candidates leave fewer than
+// Limit results after filtering, the search falls back to scoring every
+// vector. A nil index scores every vector.
+func (s *CacheSearcher) SetVectorIndex(idx *RepoVectorIndex) {
+	s.index = idx
+}
+
+// indexCandidateFactor is how many candidates per requested result are
+// taken from the vector index, to leave enough after filtering by
+// repository, granularity and metadata.
+const indexCandidateFactor = 10
+
+// SetMetric selects the similarity function used to score vectors. It
+// should match the metric the index was built with. The default is cosine.
+func (s *CacheSearcher) SetMetric(metric Metric) {
+	s.metric = metric
+}
+
+// SetMaxInputBytes truncates the text of example chunks embedded by
+// SearchChunks, as WithMaxInputBytes does at indexing. 0 means no limit.
+func (s *CacheSearcher) SetMaxInputBytes(n int) {
+	s.maxInputBytes = n
+}
+
+// SetModelSpaces makes the vectors of the given model spaces searchable,
+// by naming a space in CacheSearchOptions.Model.
+func (s *CacheSearcher) SetModelSpaces(spaces []ModelSpace) {
+	s.spaces = spaces
+}
+
+// SetIndexModel makes searches of the primary model fail with a
+// *ModelMismatchError when the cache's model, or the dimensions of the
+// query vector, differ from those the index was built with. A nil model
+// checks only that query and indexed vectors have the same dimensions.
+func (s *CacheSearcher) SetIndexModel(m *IndexModel) {
+	s.indexed = m
+}
+
+// searchSpace is the cache, embedder and cache keys a search reads.
+type searchSpace struct {
+	cache    *EmbeddingCache
+	embedder Embedder
+	key      func(hash string) string
+}
+
+// space returns what a search of model reads: the primary model's vectors
+// when model is empty or the cache's own model, else a model space's.
+func (s *CacheSearcher) space(model string) (*searchSpace, error) {
+	if model == "" || model == s.cache.Model() {
+		return &searchSpace{cache: s.cache, embedder: s.embedder, key: func(hash string) string { return hash }}, nil
+	}
+	for _, m := range s.spaces {
+		if m.Model == model {
+			return &searchSpace{cache: m.Cache, embedder: m.Embedder, key: m.Key}, nil
+		}
+	}
+	return nil, fmt.Errorf("model %q is not indexed", model)
+}
+
+// ResultCache returns the result cache, or nil if caching is disabled.
+func (s *CacheSearcher) ResultCache() *ResultCache {
+	return s.results
+}
+
+// CacheSearchOptions configures a CacheSearcher query.
+type CacheSearchOptions struct {
+	RepoRoot    string // Repository to search (required)
+	Limit       int    // Maximum results (default: 10)
+	Granularity string // GranularityChunk, GranularityFile or GranularityAll (default: chunk)
+
+	// Metadata restricts results to locations whose metadata has every
+	// key-value pair given
+	Metadata map[string]string
+
+	// Model selects the vectors to search: those of a model space (see
+	// CacheSearcher.SetModelSpaces), or the primary model's if empty
+	Model string
+
+	// DedupByContent collapses results with the same content hash into
+	// the best-ranked one, listing the other locations in its AlsoAt.
+	// Limit then counts distinct contents.
+	DedupByContent bool
+
+	// MinScore drops results less similar than this, so a query with no
+	// close match returns none rather than its weakest matches. 0 keeps
+	// every positive score.
+	MinScore float32
+}
+
+// CacheSearchResult is a scored chunk location.
+type CacheSearchResult struct {
+	ChunkLocation
+	Score float32 `json:"score"`
+
+	// AlsoAt lists other locations with identical content, when searched
+	// with DedupByContent
+	AlsoAt []ChunkLocation `json:"also_at,omitempty"`
+}
+
+// Available reports whether the embedder can embed queries.
+func (s *CacheSearcher) Available() bool {
+	return s.embedder != nil && s.embedder.Available()
+}
+
+// Search embeds the query and returns the best-matching locations.
+func (s *CacheSearcher) Search(ctx context.Context, query string, opts CacheSearchOptions) ([]CacheSearchResult, error) {
+	space, err := s.space(opts.Model)
+	if err != nil {
+		return nil, err
+	}
+	if space.embedder == nil || !space.embedder.Available() {
+		return nil, fmt.Errorf("embedding provider not available")
+	}
+
+	embeddings, err := space.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("embedding query: %w", err)
+	}
+	if len(embeddings) == 0 {
+		return nil, fmt.Errorf("no embedding returned for query")
+	}
+
+	return s.SearchVector(ctx, embeddings[0], opts)
+}
+
+// SearchChunks returns the locations most like the example chunks, for
+// "find code like this" searches with a code snippet. Unlike Search, the
+// chunks are embedded as documents, from their ContextualInput exactly as
+// the pipeline embeds indexed chunks, so an example matches code with the
+// same shape rather than code answering a question. Vectors already in the
+// cache are reused, and several chunks are pooled into one query vector
+// under the searcher's metric.
+func (s *CacheSearcher) SearchChunks(ctx context.Context, chunks []Chunk, opts CacheSearchOptions) ([]CacheSearchResult, error) {
+	space, err := s.space(opts.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes, inputs []string
+	seen := make(map[string]bool)
+	for _, c := range chunks {
+		if c.Content == "" {
+			continue
+		}
+		hash := space.key(c.CacheKey())
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		hashes = append(hashes, hash)
+		input, _ := TruncateInput(c.ContextualInput(), s.maxInputBytes)
+		inputs = append(inputs, input)
+	}
+	if len(hashes) == 0 {
+		return nil, fmt.Errorf("example has no content to search with")
+	}
+
+	cached, err := space.cache.GetBatch(hashes)
+	if err != nil {
+		return nil, fmt.Errorf("loading embeddings: %w", err)
+	}
+	vectors := make([][]float32, 0, len(hashes))
+	var toEmbed []string
+	for i, hash := range hashes {
+		if entry, ok := cached[hash]; ok {
+			vectors = append(vectors, entry.Embedding)
+		} else {
+			toEmbed = append(toEmbed, inputs[i])
+		}
+	}
+
+	if len(toEmbed) > 0 {
+		if space.embedder == nil || !space.embedder.Available() {
+			return nil, fmt.Errorf("embedding provider not available")
+		}
+		embeddings, err := space.embedder.Embed(ctx, toEmbed)
+		if err != nil {
+			return nil, fmt.Errorf("embedding example: %w", err)
+		}
+		if len(embeddings) != len(toEmbed) {
+			return nil, fmt.Errorf("embedder returned %d vectors for %d example chunks", len(embeddings), len(toEmbed))
+		}
+		vectors = append(vectors, embeddings...)
+	}
+
+	query := s.metric.Pool(vectors)
+	if query == nil {
+		return nil, fmt.Errorf("example chunk vectors have mismatched dimensions")
+	}
+	return s.SearchVector(ctx, query, opts)
+}
+
+// SearchVector returns the locations whose vectors best match query.
+func (s *CacheSearcher) SearchVector(ctx context.Context, query []float32, opts CacheSearchOptions) ([]CacheSearchResult, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = 10
+	}
+	limit := opts.Limit
+
+	space, err := s.space(opts.Model)
+	if err != nil {
+		return nil, err
+	}
+	if space.cache == s.cache {
+		if err := s.indexed.Check(s.cache.Model(), len(query)); err != nil {
+			return nil, err
+		}
+	}
+
+	var cacheKey, version string
+	if s.results != nil {
+		v, err := indexVersion(s.locations, space.cache, opts.RepoRoot)
+		if err != nil {
+			return nil, fmt.Errorf("checking index version: %w", err)
+		}
+		cacheKey, version = ResultCacheKey(query, opts), v
+		if cached, ok := s.results.Get(cacheKey, version); ok {
+			return cached, nil
+		}
+	}
+
+	locs, err := s.locations.GetByMetadata(opts.RepoRoot, opts.Metadata)
+	if err != nil {
+		return nil, fmt.Errorf("getting locations: %w", err)
+	}
+
+	// Filter by granularity and group by hash
+	byHash := make(map[string][]ChunkLocation)
+	for _, loc := range locs {
+		if !matchesGranularity(loc, opts.Granularity) {
+			continue
+		}
+		byHash[loc.ContentHash] = append(byHash[loc.ContentHash], loc)
+	}
+
+	// Score the index's candidates if it has them, else every vector
+	every := make([]string, 0, len(byHash))
+	for hash := range byHash {
+		every = append(every, hash)
+	}
+	candidates, exhaustive := every, true
+	if s.index != nil && space.cache == s.cache {
+		k := limit * indexCandidateFactor
+		found, ok, err := s.index.Search(ctx, opts.RepoRoot, query, k)
+		if err != nil {
+			return nil, fmt.Errorf("searching vector index: %w", err)
+		}
+		if ok {
+			candidates = make([]string, 0, len(found))
+			for _, r := range found {
+				if _, inRepo := byHash[r.ContentHash]; inRepo {
+					candidates = append(candidates, r.ContentHash)
+				}
+			}
+			exhaustive = len(found) < k
+		}
+	}
+
+	results, err := s.score(ctx, space, query, candidates, byHash, opts)
+	if err != nil {
+		return nil, err
+	}
+	if !exhaustive && len(results) < limit {
+		// Too few of the candidates passed the filters
+		if results, err = s.score(ctx, space, query, every, byHash, opts); err != nil {
+			return nil, err
+		}
+	}
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	if s.results != nil {
+		s.results.Put(cacheKey, version, results)
+	}
+
+	return results, nil
+}
+
+// score ranks the locations of hashes by the similarity of their vectors in
+// space to query, best first.
+func (s *CacheSearcher) score(ctx context.Context, space *searchSpace, query []float32, hashes []string, byHash map[string][]ChunkLocation, opts CacheSearchOptions) ([]CacheSearchResult, error) {
+	// Cache keys in the searched space, mapped back to content hashes
+	keys := make([]string, 0, len(hashes))
+	keyHashes := make(map[string]string, len(hashes))
+	for _, hash := range hashes {
+		key := space.key(hash)
+		keys = append(keys, key)
+		keyHashes[key] = hash
+	}
+
+	vectors := make(map[string][]float32, len(keys))
+	for i := 0; i < len(keys); i += hasEntryBatchSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		end := min(i+hasEntryBatchSize, len(keys))
+		entries, err := space.cache.GetBatch(keys[i:end])
+		if err != nil {
+			return nil, fmt.Errorf("loading embeddings: %w", err)
+		}
+		for key, entry := range entries {
+			vectors[keyHashes[key]] = entry.Embedding
+		}
+	}
+
+	var results []CacheSearchResult
+	for hash, vec := range vectors {
+		if len(vec) != len(query) {
+			return nil, &ModelMismatchError{
+				RepoRoot:        opts.RepoRoot,
+				IndexDimensions: len(vec),
+				QueryModel:      space.cache.Model(),
+				QueryDimensions: len(query),
+			}
+		}
+		score := s.metric.Similarity(query, vec)
+		if score <= 0 || score < opts.MinScore {
+			continue // Skip zero/negative similarity
+		}
+		for _, loc := range byHash[hash] {
+			results = append(results, CacheSearchResult{ChunkLocation: loc, Score: score})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if results[i].Path != results[j].Path {
+			return results[i].Path < results[j].Path
+		}
+		return results[i].StartLine < results[j].StartLine
+	})
+
+	if opts.DedupByContent {
+		results = dedupByContent(results)
+	}
+	return results, nil
+}
+
+// dedupByContent collapses ranked results sharing a content hash into the
+// first of them, keeping the order of those that remain.
+func dedupByContent(results []CacheSearchResult) []CacheSearchResult {
+	return CollapseDuplicates(results,
+		func(r CacheSearchResult) string { return r.ContentHash },
+		func(kept *CacheSearchResult, dup CacheSearchResult) {
+			kept.AlsoAt = append(kept.AlsoAt, dup.ChunkLocation)
+		})
+}
+
+// indexVersion identifies the state of the locations and embeddings a
+// search reads, so cached results and vector indexes are invalidated by
+// re-indexing or by embeddings being added or evicted.
+func indexVersion(locations *LocationStore, cache *EmbeddingCache, repoRoot string) (string, error) {
+	locVersion, err := locations.Version(repoRoot)
+	if err != nil {
+		return "", err
+	}
+	count, err := cache.Count()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:%d", locVersion, count), nil
+}
+
+// matchesGranularity reports whether a location belongs to the requested
+// search granularity.
+func matchesGranularity(loc ChunkLocation, granularity string) bool {
+	switch granularity {
+	case GranularityAll:
+		return true
+	case GranularityFile:
+		return loc.NodeType == NodeTypeFile
+	default:
+		return loc.NodeType != NodeTypeFile
+	}
+}
@@ -0,0 +1,473 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"codetect/internal/db"
+)
+
+// keywordEmbedder maps text to a vector with one dimension per keyword,
+// giving predictable similarities in search tests.
+type keywordEmbedder struct {
+	keywords []string
+}
+
+func (k *keywordEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	result := make([][]float32, len(texts))
+	for i, text := range texts {
+		vec := make([]float32, len(k.keywords)+1)
+		for j, kw := range k.keywords {
+			vec[j] = float32(strings.Count(text, kw))
+		}
+		vec[len(k.keywords)] = 0.1 // Avoid zero vectors
+		result[i] = vec
+	}
+	return result, nil
+}
+
+func (k *keywordEmbedder) Available() bool    { return true }
+func (k *keywordEmbedder) ProviderID() string { return "keyword:test" }
+func (k *keywordEmbedder) Dimensions() int    { return len(k.keywords) + 1 }
+
+func setupFilePipeline(t *testing.T, opts ...PipelineOption) (*Pipeline, *keywordEmbedder) {
+	t.Helper()
+
+	cfg := db.DefaultConfig(":memory:")
+	database, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	cache, err := NewEmbeddingCache(database, cfg.Dialect(), 3, "test-model")
+	if err != nil {
+		t.Fatalf("creating cache: %v", err)
+	}
+	locations, err := NewLocationStore(database, cfg.Dialect())
+	if err != nil {
+		t.Fatalf("creating location store: %v", err)
+	}
+
+	embedder := &keywordEmbedder{keywords: []string{"alpha", "beta"}}
+	return NewPipeline(cache, locations, embedder, opts...), embedder
+}
+
+func TestFileEmbeddingsCreated(t *testing.T) {
+	pipeline, _ := setupFilePipeline(t, WithFileEmbeddings(true))
+	ctx := context.Background()
+
+	chunks := []Chunk{
+		{Path: "a.go", StartLine: 1, EndLine: 5, Content: "alpha alpha"},
+		{Path: "a.go", StartLine: 6, EndLine: 12, Content: "alpha beta"},
+		{Path: "b.go", StartLine: 1, EndLine: 4, Content: "beta beta"},
+	}
+
+	result, err := pipeline.EmbedChunks(ctx, "/project", chunks)
+	if err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	if result.FileEmbeddings != 2 {
+		t.Errorf("FileEmbeddings = %d, want 2", result.FileEmbeddings)
+	}
+
+	fileLocs, err := pipeline.Locations().GetLocationsByType("/project", NodeTypeFile)
+	if err != nil {
+		t.Fatalf("GetLocationsByType failed: %v", err)
+	}
+	if len(fileLocs) != 2 {
+		t.Fatalf("got %d file locations, want 2", len(fileLocs))
+	}
+
+	for _, loc := range fileLocs {
+		if loc.StartLine != 0 {
+			t.Errorf("%s: StartLine = %d, want 0", loc.Path, loc.StartLine)
+		}
+		if loc.Path == "a.go" && loc.EndLine != 12 {
+			t.Errorf("a.go: EndLine = %d, want 12", loc.EndLine)
+		}
+		ok, err := pipeline.Cache().HasEntry(loc.ContentHash)
+		if err != nil {
+			t.Fatalf("HasEntry failed: %v", err)
+		}
+		if !ok {
+			t.Errorf("%s: file embedding not cached", loc.Path)
+		}
+	}
+
+	// Chunk locations are unaffected
+	count, err := pipeline.Locations().CountByRepo("/project")
+	if err != nil {
+		t.Fatalf("CountByRepo failed: %v", err)
+	}
+	if count != 5 {
+		t.Errorf("CountByRepo = %d, want 5 (3 chunks + 2 files)", count)
+	}
+}
+
+func TestFileEmbeddingsDisabledByDefault(t *testing.T) {
+	pipeline, _ := setupFilePipeline(t)
+	ctx := context.Background()
+
+	chunks := []Chunk{{Path: "a.go", StartLine: 1, EndLine: 5, Content: "alpha"}}
+	result, err := pipeline.EmbedChunks(ctx, "/project", chunks)
+	if err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	if result.FileEmbeddings != 0 {
+		t.Errorf("FileEmbeddings = %d, want 0", result.FileEmbeddings)
+	}
+
+	fileLocs, err := pipeline.Locations().GetLocationsByType("/project", NodeTypeFile)
+	if err != nil {
+		t.Fatalf("GetLocationsByType failed: %v", err)
+	}
+	if len(fileLocs) != 0 {
+		t.Errorf("got %d file locations, want 0", len(fileLocs))
+	}
+}
+
+func TestCacheSearcherGranularity(t *testing.T) {
+	pipeline, embedder := setupFilePipeline(t, WithFileEmbeddings(true))
+	ctx := context.Background()
+
+	chunks := []Chunk{
+		{Path: "a.go", StartLine: 1, EndLine: 5, Content: "alpha alpha"},
+		{Path: "a.go", StartLine: 6, EndLine: 12, Content: "alpha beta"},
+		{Path: "b.go", StartLine: 1, EndLine: 4, Content: "beta beta"},
+	}
+	if _, err := pipeline.EmbedChunks(ctx, "/project", chunks); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+
+	searcher := NewCacheSearcher(pipeline.Cache(), pipeline.Locations(), embedder)
+
+	// File granularity returns only file-level locations
+	files, err := searcher.Search(ctx, "alpha", CacheSearchOptions{
+		RepoRoot:    "/project",
+		Granularity: GranularityFile,
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("got %d file results, want 2", len(files))
+	}
+	for _, r := range files {
+		if r.NodeType != NodeTypeFile {
+			t.Errorf("file search returned NodeType %q", r.NodeType)
+		}
+	}
+	if files[0].Path != "a.go" {
+		t.Errorf("top file for 'alpha' = %s, want a.go", files[0].Path)
+	}
+
+	// Chunk granularity (default) never returns file-level locations
+	chunkResults, err := searcher.Search(ctx, "beta", CacheSearchOptions{RepoRoot: "/project"})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(chunkResults) != 3 {
+		t.Fatalf("got %d chunk results, want 3", len(chunkResults))
+	}
+	for _, r := range chunkResults {
+		if r.NodeType == NodeTypeFile {
+			t.Error("chunk search returned a file-level location")
+		}
+	}
+	if chunkResults[0].Path != "b.go" {
+		t.Errorf("top chunk for 'beta' = %s, want b.go", chunkResults[0].Path)
+	}
+
+	// All granularity returns both
+	all, err := searcher.Search(ctx, "alpha", CacheSearchOptions{
+		RepoRoot:    "/project",
+		Granularity: GranularityAll,
+		Limit:       10,
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(all) != 5 {
+		t.Errorf("got %d results, want 5", len(all))
+	}
+}
+
+func TestIncrementalUpdateWithFileEmbeddings(t *testing.T) {
+	pipeline, _ := setupFilePipeline(t, WithFileEmbeddings(true))
+	ctx := context.Background()
+
+	files := map[string][]Chunk{
+		"a.go": {
+			{Path: "a.go", StartLine: 1, EndLine: 5, Content: "alpha"},
+			{Path: "a.go", StartLine: 6, EndLine: 9, Content: "beta"},
+		},
+	}
+	if _, err := pipeline.IncrementalUpdate(ctx, "/project", files); err != nil {
+		t.Fatalf("IncrementalUpdate failed: %v", err)
+	}
+
+	// Unchanged file is detected as unchanged despite the extra file location
+	result, err := pipeline.IncrementalUpdate(ctx, "/project", files)
+	if err != nil {
+		t.Fatalf("IncrementalUpdate failed: %v", err)
+	}
+	if result.Embedded != 0 || result.FileEmbeddings != 0 {
+		t.Errorf("unchanged file re-embedded: Embedded=%d FileEmbeddings=%d", result.Embedded, result.FileEmbeddings)
+	}
+}
+
+func TestFileEmbeddingsFollowMetric(t *testing.T) {
+	ctx := context.Background()
+	chunks := []Chunk{
+		{Path: "a.go", StartLine: 1, EndLine: 5, Content: "alpha alpha"}, // (2, 0, 0.1)
+		{Path: "a.go", StartLine: 6, EndLine: 9, Content: "alpha beta"},  // (1, 1, 0.1)
+	}
+
+	pooled := func(metric Metric) (string, []float32) {
+		t.Helper()
+		pipeline, _ := setupFilePipeline(t, WithFileEmbeddings(true), WithMetric(metric))
+		if _, err := pipeline.EmbedChunks(ctx, "/project", chunks); err != nil {
+			t.Fatalf("EmbedChunks failed: %v", err)
+		}
+		locs, err := pipeline.Locations().GetLocationsByType("/project", NodeTypeFile)
+		if err != nil || len(locs) != 1 {
+			t.Fatalf("file locations = %v, %v; want 1", locs, err)
+		}
+		entry, err := pipeline.Cache().Get(locs[0].ContentHash)
+		if err != nil || entry == nil {
+			t.Fatalf("Get file embedding: %v", err)
+		}
+		return locs[0].ContentHash, entry.Embedding
+	}
+
+	cosHash, cosVec := pooled(MetricCosine)
+	if m := Magnitude(cosVec); math.Abs(float64(m)-1) > 1e-4 {
+		t.Errorf("cosine file vector magnitude = %f, want 1", m)
+	}
+
+	dotHash, dotVec := pooled(MetricDotProduct)
+	want := []float32{1.5, 0.5, 0.1}
+	for i := range want {
+		if math.Abs(float64(dotVec[i]-want[i])) > 1e-4 {
+			t.Fatalf("dot_product file vector = %v, want plain mean %v", dotVec, want)
+		}
+	}
+	if cosHash == dotHash {
+		t.Error("normalized and plain file vectors share a cache key")
+	}
+}
+
+func TestCacheSearcherMetric(t *testing.T) {
+	pipeline, embedder := setupFilePipeline(t)
+	ctx := context.Background()
+
+	// Cosine prefers the pure match, dot product the longer vector
+	chunks := []Chunk{
+		{Path: "pure.go", StartLine: 1, EndLine: 2, Content: "alpha"},
+		{Path: "long.go", StartLine: 1, EndLine: 2, Content: "alpha alpha alpha beta beta"},
+	}
+	if _, err := pipeline.EmbedChunks(ctx, "/project", chunks); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+
+	searcher := NewCacheSearcher(pipeline.Cache(), pipeline.Locations(), embedder)
+	for metric, want := range map[Metric]string{MetricCosine: "pure.go", MetricDotProduct: "long.go"} {
+		searcher.SetMetric(metric)
+		results, err := searcher.Search(ctx, "alpha", CacheSearchOptions{RepoRoot: "/project"})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(results) == 0 || results[0].Path != want {
+			t.Errorf("%s: top result = %v, want %s", metric, results, want)
+		}
+	}
+}
+
+func TestCacheSearcherMetadataFilter(t *testing.T) {
+	pipeline, embedder := setupFilePipeline(t)
+	ctx := context.Background()
+
+	payments := map[string]string{"team": "payments"}
+	identity := map[string]string{"team": "identity"}
+	chunks := []Chunk{
+		{Path: "pay/a.go", StartLine: 1, EndLine: 5, Content: "alpha alpha", Metadata: payments},
+		{Path: "auth/b.go", StartLine: 1, EndLine: 5, Content: "alpha alpha alpha", Metadata: identity},
+		{Path: "pay/c.go", StartLine: 1, EndLine: 5, Content: "alpha beta", Metadata: payments},
+		{Path: "d.go", StartLine: 1, EndLine: 5, Content: "alpha"},
+	}
+	if _, err := pipeline.EmbedChunks(ctx, "/project", chunks); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	if err := pipeline.Locations().SetIndexedMetadataKeys([]string{"team"}); err != nil {
+		t.Fatalf("SetIndexedMetadataKeys failed: %v", err)
+	}
+
+	searcher := NewCacheSearcher(pipeline.Cache(), pipeline.Locations(), embedder)
+	searcher.SetResultCache(NewResultCache(16, time.Minute))
+
+	results, err := searcher.Search(ctx, "alpha", CacheSearchOptions{
+		RepoRoot: "/project",
+		Metadata: payments,
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2: %+v", len(results), results)
+	}
+	for _, r := range results {
+		if r.Metadata["team"] != "payments" {
+			t.Errorf("filtered search returned %s with metadata %v", r.Path, r.Metadata)
+		}
+	}
+
+	// The same query without the filter is not served from the filtered
+	// cache entry
+	all, err := searcher.Search(ctx, "alpha", CacheSearchOptions{RepoRoot: "/project"})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(all) != 4 {
+		t.Errorf("got %d unfiltered results, want 4", len(all))
+	}
+}
+
+func TestCacheSearcherDedupByContent(t *testing.T) {
+	pipeline, embedder := setupFilePipeline(t)
+	ctx := context.Background()
+
+	chunks := []Chunk{
+		{Path: "vendor/x/util.go", StartLine: 10, EndLine: 12, Content: "alpha"},
+		{Path: "util.go", StartLine: 1, EndLine: 3, Content: "alpha"},
+		{Path: "copy/util.go", StartLine: 4, EndLine: 6, Content: "alpha"},
+		{Path: "mixed.go", StartLine: 1, EndLine: 3, Content: "alpha beta"},
+	}
+	if _, err := pipeline.EmbedChunks(ctx, "/project", chunks); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+
+	searcher := NewCacheSearcher(pipeline.Cache(), pipeline.Locations(), embedder)
+	searcher.SetResultCache(NewResultCache(16, time.Minute))
+
+	all, err := searcher.Search(ctx, "alpha", CacheSearchOptions{RepoRoot: "/project"})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(all) != 4 {
+		t.Fatalf("got %d results without dedup, want 4", len(all))
+	}
+
+	results, err := searcher.Search(ctx, "alpha", CacheSearchOptions{RepoRoot: "/project", DedupByContent: true})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d deduplicated results, want 2: %+v", len(results), results)
+	}
+
+	// The best-ranked of the identical chunks represents them
+	top := results[0]
+	if top.Path != "copy/util.go" {
+		t.Errorf("representative = %s, want copy/util.go", top.Path)
+	}
+	var aliases []string
+	for _, loc := range top.AlsoAt {
+		if loc.ContentHash != top.ContentHash {
+			t.Errorf("alias %s has a different content hash", loc.Path)
+		}
+		aliases = append(aliases, loc.Path)
+	}
+	if strings.Join(aliases, ",") != "util.go,vendor/x/util.go" {
+		t.Errorf("AlsoAt = %v, want [util.go vendor/x/util.go]", aliases)
+	}
+	if results[1].Path != "mixed.go" || len(results[1].AlsoAt) != 0 {
+		t.Errorf("second result = %+v, want mixed.go without aliases", results[1])
+	}
+
+	// Limit counts distinct contents
+	limited, err := searcher.Search(ctx, "alpha", CacheSearchOptions{RepoRoot: "/project", Limit: 1, DedupByContent: true})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(limited) != 1 || len(limited[0].AlsoAt) != 2 {
+		t.Errorf("limited results = %+v, want one with two aliases", limited)
+	}
+}
+
+func TestCacheSearcherMinScore(t *testing.T) {
+	pipeline, embedder := setupFilePipeline(t)
+	ctx := context.Background()
+
+	chunks := []Chunk{
+		{Path: "a.go", StartLine: 1, EndLine: 5, Kind: "function", Content: "alpha alpha alpha"},
+		{Path: "b.go", StartLine: 1, EndLine: 5, Kind: "function", Content: "alpha alpha beta"},
+	}
+	if _, err := pipeline.EmbedChunks(ctx, "/project", chunks); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	searcher := NewCacheSearcher(pipeline.Cache(), pipeline.Locations(), embedder)
+	searcher.SetResultCache(NewResultCache(8, time.Minute))
+
+	// An example with no real relative still gets its weakest matches
+	isolated := []Chunk{{Path: "x.go", Content: "beta"}}
+	results, err := searcher.SearchChunks(ctx, isolated, CacheSearchOptions{RepoRoot: "/project"})
+	if err != nil {
+		t.Fatalf("SearchChunks failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results without a minimum, want 2", len(results))
+	}
+
+	results, err = searcher.SearchChunks(ctx, isolated, CacheSearchOptions{RepoRoot: "/project", MinScore: 0.5})
+	if err != nil {
+		t.Fatalf("SearchChunks failed: %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("got %+v with MinScore 0.5, want none", results)
+	}
+
+	related := []Chunk{{Path: "x.go", Content: "alpha alpha alpha"}}
+	results, err = searcher.SearchChunks(ctx, related, CacheSearchOptions{RepoRoot: "/project", MinScore: 0.5})
+	if err != nil {
+		t.Fatalf("SearchChunks failed: %v", err)
+	}
+	if len(results) != 2 || results[0].Path != "a.go" {
+		t.Errorf("got %+v for a related example, want a.go then b.go", results)
+	}
+}
+
+func TestCacheSearcherModelMismatch(t *testing.T) {
+	pipeline, embedder := setupFilePipeline(t)
+	ctx := context.Background()
+
+	chunks := []Chunk{{Path: "a.go", StartLine: 1, EndLine: 5, Content: "alpha beta"}}
+	if _, err := pipeline.EmbedChunks(ctx, "/project", chunks); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	searcher := NewCacheSearcher(pipeline.Cache(), pipeline.Locations(), embedder)
+	opts := CacheSearchOptions{RepoRoot: "/project"}
+
+	searcher.SetIndexModel(&IndexModel{RepoRoot: "/project", Model: "test-model", Dimensions: 3})
+	if _, err := searcher.Search(ctx, "alpha", opts); err != nil {
+		t.Fatalf("Search with the indexed model failed: %v", err)
+	}
+
+	// The index was built with another model than the cache is opened with
+	searcher.SetIndexModel(&IndexModel{RepoRoot: "/project", Model: "old-model", Dimensions: 3})
+	var mismatch *ModelMismatchError
+	if _, err := searcher.Search(ctx, "alpha", opts); !errors.As(err, &mismatch) || mismatch.IndexModel != "old-model" {
+		t.Fatalf("Search error = %v, want a mismatch with old-model", err)
+	}
+
+	// Without a recorded model, vectors of other dimensions than the
+	// query's are still refused
+	wider := NewCacheSearcher(pipeline.Cache(), pipeline.Locations(), &keywordEmbedder{keywords: []string{"alpha", "beta", "gamma"}})
+	if _, err := wider.Search(ctx, "alpha", opts); !errors.As(err, &mismatch) || mismatch.IndexDimensions != 3 || mismatch.QueryDimensions != 4 {
+		t.Errorf("Search error = %v, want a 3 vs 4 dimension mismatch", err)
+	}
+}
@@ -0,0 +1,210 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// accessStatsQueueSize is how many Get and GetBatch hits can wait for
+	// the access stat writer before lookups block on it.
+	accessStatsQueueSize = 256
+
+	// accessStatsBatchSize is how many distinct entries the writer
+	// collects before writing their access stats, and the most entries
+	// one UPDATE names.
+	accessStatsBatchSize = 500
+
+	// accessStatsInterval is the longest the writer holds collected
+	// access stats before writing them.
+	accessStatsInterval = time.Second
+)
+
+// recordAccess queues an access stat bump for each of hashes. The first
+// call starts the cache's writer goroutine; calls after Close are dropped.
+func (c *EmbeddingCache) recordAccess(hashes []string) {
+	c.startStatsWriter()
+
+	c.statsMu.RLock()
+	defer c.statsMu.RUnlock()
+	if c.statsClosed {
+		return
+	}
+	c.statsQueue <- hashes
+}
+
+// startStatsWriter starts the writer goroutine unless it is running or the
+// cache is closed. The channels are made under the write lock, so every
+// holder of the read lock sees them.
+func (c *EmbeddingCache) startStatsWriter() {
+	c.statsMu.RLock()
+	started := c.statsQueue != nil || c.statsClosed
+	c.statsMu.RUnlock()
+	if started {
+		return
+	}
+
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	if c.statsQueue != nil || c.statsClosed {
+		return
+	}
+	c.statsQueue = make(chan []string, accessStatsQueueSize)
+	c.statsFlush = make(chan chan struct{})
+	c.statsDone = make(chan struct{})
+	go c.runStatsWriter()
+}
+
+// requestStatsFlush asks the writer to write what it holds and everything
+// queued so far, without waiting for a full batch or the interval. It
+// returns a channel closed once that is written, or nil if the writer was
+// never started. After Close the channel is closed when the writer exits.
+// It returns ctx's error if ctx is done before the writer takes the request.
+func (c *EmbeddingCache) requestStatsFlush(ctx context.Context) (<-chan struct{}, error) {
+	c.statsMu.RLock()
+	defer c.statsMu.RUnlock()
+	if c.statsQueue == nil {
+		return nil, nil
+	}
+	if c.statsClosed {
+		return c.statsDone, nil
+	}
+
+	done := make(chan struct{})
+	select {
+	case c.statsFlush <- done:
+		return done, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close writes the access stats still queued or held and stops the
+// writer goroutine. Call it before closing the database. Lookups after
+// Close no longer update access stats. It returns the first error from
+// writing access stats, if any.
+func (c *EmbeddingCache) Close() error {
+	c.statsMu.Lock()
+	if c.statsClosed {
+		c.statsMu.Unlock()
+		return nil
+	}
+	c.statsClosed = true
+	started := c.statsQueue != nil
+	if started {
+		close(c.statsQueue)
+	}
+	c.statsMu.Unlock()
+
+	if !started {
+		return nil
+	}
+	<-c.statsDone
+	return c.statsErr
+}
+
+// runStatsWriter coalesces queued access stat bumps by entry and writes
+// them when accessStatsBatchSize entries are held, every
+// accessStatsInterval, on request, and when the queue is closed.
+func (c *EmbeddingCache) runStatsWriter() {
+	defer close(c.statsDone)
+
+	ticker := time.NewTicker(accessStatsInterval)
+	defer ticker.Stop()
+
+	counts := make(map[string]int)
+	collect := func(hashes []string) {
+		for _, hash := range hashes {
+			counts[hash]++
+		}
+	}
+	write := func() {
+		if len(counts) == 0 {
+			return
+		}
+		if err := c.writeAccessStats(counts, time.Now().Unix()); err != nil && c.statsErr == nil {
+			c.statsErr = err
+		}
+		clear(counts)
+	}
+
+	for {
+		select {
+		case hashes, ok := <-c.statsQueue:
+			if !ok {
+				write()
+				return
+			}
+			collect(hashes)
+			if len(counts) >= accessStatsBatchSize {
+				write()
+			}
+		case done := <-c.statsFlush:
+			// Take everything queued before the request
+			for drained := false; !drained; {
+				select {
+				case hashes, ok := <-c.statsQueue:
+					if !ok {
+						write()
+						close(done)
+						return
+					}
+					collect(hashes)
+				default:
+					drained = true
+				}
+			}
+			write()
+			close(done)
+		case <-ticker.C:
+			write()
+		}
+	}
+}
+
+// writeAccessStats adds counts to the access_count of their entries and
+// sets their last_accessed to now, in one transaction.
+func (c *EmbeddingCache) writeAccessStats(counts map[string]int, now int64) error {
+	byCount := make(map[int][]string)
+	for hash, n := range counts {
+		byCount[n] = append(byCount[n], hash)
+	}
+
+	tx, err := c.database.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning access stats transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	tableName := c.tableName()
+	for n, hashes := range byCount {
+		for start := 0; start < len(hashes); start += accessStatsBatchSize {
+			batch := hashes[start:min(start+accessStatsBatchSize, len(hashes))]
+
+			// Placeholders 1 and 2 are the count and timestamp
+			placeholders := make([]string, len(batch))
+			args := make([]interface{}, len(batch)+2)
+			args[0], args[1] = n, now
+			for i, hash := range batch {
+				placeholders[i] = c.dialect.Placeholder(i + 3)
+				args[i+2] = hash
+			}
+
+			query := fmt.Sprintf(`
+				UPDATE %s SET access_count = access_count + %s, last_accessed = %s
+				WHERE content_hash IN (%s)
+			`, tableName, c.dialect.Placeholder(1), c.dialect.Placeholder(2), strings.Join(placeholders, ", "))
+
+			if _, err := tx.Exec(query, args...); err != nil {
+				return fmt.Errorf("updating access stats: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing access stats: %w", err)
+	}
+	return nil
+}
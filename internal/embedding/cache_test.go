@@ -1,7 +1,13 @@
 package embedding
 
 import (
+	"context"
+	"fmt"
+	"math"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -434,6 +440,255 @@ func TestEmptyBatchOperations(t *testing.T) {
 	}
 }
 
+func TestCacheAccessStatsWriter(t *testing.T) {
+	// The stats writer commits on its own connection, so use a file that
+	// all connections share
+	cfg := db.DefaultConfig(filepath.Join(t.TempDir(), "cache.db"))
+	database, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	cache, err := NewEmbeddingCache(database, cfg.Dialect(), 768, "test-model")
+	if err != nil {
+		t.Fatalf("creating cache: %v", err)
+	}
+
+	hashes := []string{"hash-a", "hash-b", "hash-c"}
+	for _, hash := range hashes {
+		if err := cache.Put(hash, randomEmbedding(768)); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	accessCounts := func() map[string]int {
+		counts := make(map[string]int)
+		rows, err := database.Query("SELECT content_hash, access_count FROM embedding_cache")
+		if err != nil {
+			t.Fatalf("reading access counts: %v", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var hash string
+			var count int
+			if err := rows.Scan(&hash, &count); err != nil {
+				t.Fatalf("scanning access count: %v", err)
+			}
+			counts[hash] = count
+		}
+		return counts
+	}
+	before := accessCounts()
+
+	// Concurrent lookups, as during a search, all feed the one writer
+	const workers, lookups = 16, 50
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < lookups; i++ {
+				if _, err := cache.Get(hashes[i%len(hashes)]); err != nil {
+					t.Errorf("Get failed: %v", err)
+					return
+				}
+				if _, err := cache.GetBatch(hashes); err != nil {
+					t.Errorf("GetBatch failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := cache.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	after := accessCounts()
+	total := 0
+	for _, hash := range hashes {
+		total += after[hash] - before[hash]
+	}
+	if want := workers * lookups * (1 + len(hashes)); total != want {
+		t.Errorf("access counts grew by %d, want %d", total, want)
+	}
+
+	// Lookups after Close still work but no longer count
+	if entry, err := cache.Get(hashes[0]); err != nil || entry == nil {
+		t.Fatalf("Get after Close = %v, %v", entry, err)
+	}
+	if err := cache.Flush(context.Background()); err != nil {
+		t.Errorf("Flush after Close failed: %v", err)
+	}
+	if err := cache.Close(); err != nil {
+		t.Errorf("second Close failed: %v", err)
+	}
+	if got := accessCounts()[hashes[0]]; got != after[hashes[0]] {
+		t.Errorf("access count changed after Close: %d, want %d", got, after[hashes[0]])
+	}
+}
+
+func TestCacheFlushDuringLookups(t *testing.T) {
+	cfg := db.DefaultConfig(filepath.Join(t.TempDir(), "cache.db"))
+	database, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	cache, err := NewEmbeddingCache(database, cfg.Dialect(), 768, "test-model")
+	if err != nil {
+		t.Fatalf("creating cache: %v", err)
+	}
+	hash := "hash-a"
+	if err := cache.Put(hash, randomEmbedding(768)); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	// Flushes race the first lookup, which starts the writer, and the
+	// lookups after it; run with -race
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				if _, err := cache.Get(hash); err != nil {
+					t.Errorf("Get failed: %v", err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				if err := cache.Flush(ctx); err != nil {
+					t.Errorf("Flush failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := cache.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+}
+
+// stallStatsWriter gives c an access stats writer that never takes a
+// request, like one stuck writing, so Flush waits until its context is
+// done. The cache must not be closed afterwards.
+func stallStatsWriter(c *EmbeddingCache) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	c.statsQueue = make(chan []string, accessStatsQueueSize)
+	c.statsFlush = make(chan chan struct{})
+	c.statsDone = make(chan struct{})
+}
+
+func TestCacheCloseWithoutLookups(t *testing.T) {
+	cache := setupTestCache(t)
+	if err := cache.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+}
+
+func TestPutBatchChunked(t *testing.T) {
+	cache := setupTestCache(t)
+	cache.SetWriteConcurrency(7, 3) // Workers are ignored on SQLite
+
+	verifyPutBatch(t, cache, 50)
+}
+
+func TestPutBatchParallelPostgres(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN not set, skipping PostgreSQL cache test")
+	}
+
+	cfg := db.PostgresConfig(dsn)
+	database, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("opening PostgreSQL: %v", err)
+	}
+	defer database.Close()
+
+	model := fmt.Sprintf("put-batch-test-%d", time.Now().UnixNano())
+	cache, err := NewEmbeddingCache(database, db.GetDialect(db.DatabasePostgres), 768, model)
+	if err != nil {
+		t.Fatalf("creating cache: %v", err)
+	}
+	defer cache.EvictByModel(model) //nolint:errcheck
+
+	cache.SetWriteConcurrency(16, 4)
+	verifyPutBatch(t, cache, 200)
+}
+
+// verifyPutBatch writes n entries in one PutBatch and checks every one was
+// persisted with its own vector.
+func verifyPutBatch(t *testing.T, cache *EmbeddingCache, n int) {
+	t.Helper()
+
+	entries := make(map[string][]float32, n)
+	for i := 0; i < n; i++ {
+		entries[HashContent(fmt.Sprintf("%s chunk %d", t.Name(), i))] = randomEmbedding(768)
+	}
+	if err := cache.PutBatch(entries); err != nil {
+		t.Fatalf("PutBatch failed: %v", err)
+	}
+
+	hashes := make([]string, 0, n)
+	for hash := range entries {
+		hashes = append(hashes, hash)
+	}
+	got, err := cache.GetBatch(hashes)
+	if err != nil {
+		t.Fatalf("GetBatch failed: %v", err)
+	}
+	if len(got) != n {
+		t.Fatalf("persisted %d of %d entries", len(got), n)
+	}
+	for hash, want := range entries {
+		if entry := got[hash]; entry.Embedding[0] != want[0] || entry.Embedding[767] != want[767] {
+			t.Errorf("entry %s has the wrong vector", hash[:8])
+		}
+	}
+}
+
+func BenchmarkPutBatch(b *testing.B) {
+	entries := make(map[string][]float32, 2000)
+	for i := 0; i < 2000; i++ {
+		entries[HashContent(fmt.Sprintf("bench chunk %d", i))] = randomEmbedding(768)
+	}
+
+	for _, size := range []int{100, 500, 2000} {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			cfg := db.DefaultConfig(":memory:")
+			database, err := db.Open(cfg)
+			if err != nil {
+				b.Fatalf("opening database: %v", err)
+			}
+			defer database.Close()
+
+			cache, err := NewEmbeddingCache(database, cfg.Dialect(), 768, "bench-model")
+			if err != nil {
+				b.Fatalf("creating cache: %v", err)
+			}
+			cache.SetWriteConcurrency(size, 0)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := cache.PutBatch(entries); err != nil {
+					b.Fatalf("PutBatch failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
 // randomEmbedding generates a random embedding vector
 func randomEmbedding(dim int) []float32 {
 	emb := make([]float32, dim)
@@ -442,3 +697,106 @@ func randomEmbedding(dim int) []float32 {
 	}
 	return emb
 }
+
+func TestCacheEncodingInt8(t *testing.T) {
+	cache := setupTestCache(t)
+	rng := rand.New(rand.NewSource(1))
+	vector := func() []float32 {
+		v := make([]float32, 768)
+		for i := range v {
+			v[i] = float32(rng.NormFloat64())
+		}
+		return v
+	}
+
+	original := vector()
+	if err := cache.Put("json", original); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := cache.SetEncoding(CacheEncodingInt8); err != nil {
+		t.Fatalf("SetEncoding failed: %v", err)
+	}
+	if err := cache.Put("int8", original); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	batch := map[string][]float32{"batch1": vector(), "batch2": vector()}
+	if err := cache.PutBatch(batch); err != nil {
+		t.Fatalf("PutBatch failed: %v", err)
+	}
+
+	// Quantized vectors stay close to the originals
+	const minSimilarity = 0.999
+	entry, err := cache.Get("int8")
+	if err != nil || entry == nil {
+		t.Fatalf("Get = %v, %v", entry, err)
+	}
+	if len(entry.Embedding) != len(original) {
+		t.Fatalf("dequantized %d dimensions, want %d", len(entry.Embedding), len(original))
+	}
+	if sim := CosineSimilarity(original, entry.Embedding); sim < minSimilarity {
+		t.Errorf("cosine similarity to the original = %f, want at least %f", sim, minSimilarity)
+	}
+
+	// Entries written before the switch still read back exactly
+	entries, err := cache.GetBatch([]string{"json", "batch1", "batch2"})
+	if err != nil {
+		t.Fatalf("GetBatch failed: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("GetBatch returned %d entries, want 3", len(entries))
+	}
+	for i, v := range original {
+		if entries["json"].Embedding[i] != v {
+			t.Fatalf("JSON entry changed at %d: %f, want %f", i, entries["json"].Embedding[i], v)
+		}
+	}
+	for hash, v := range batch {
+		if sim := CosineSimilarity(v, entries[hash].Embedding); sim < minSimilarity {
+			t.Errorf("%s: cosine similarity to the original = %f, want at least %f", hash, sim, minSimilarity)
+		}
+	}
+
+	// A 768-dimension entry shrinks at least 4x
+	size := func(hash string) int {
+		var n int
+		if err := cache.database.QueryRow("SELECT LENGTH(embedding) FROM embedding_cache WHERE content_hash = ?", hash).Scan(&n); err != nil {
+			t.Fatalf("measuring %s: %v", hash, err)
+		}
+		return n
+	}
+	if jsonSize, int8Size := size("json"), size("int8"); int8Size*4 > jsonSize {
+		t.Errorf("int8 entry is %d bytes, JSON %d; want at least 4x smaller", int8Size, jsonSize)
+	}
+}
+
+func TestCacheEncodingEdgeCases(t *testing.T) {
+	cache := setupTestCache(t)
+	if err := cache.SetEncoding("float16"); err == nil {
+		t.Error("SetEncoding with an unknown encoding should fail")
+	}
+	if err := cache.SetEncoding(CacheEncodingInt8); err != nil {
+		t.Fatalf("SetEncoding failed: %v", err)
+	}
+
+	// The zero vector has no scale
+	if err := cache.Put("zero", make([]float32, 8)); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	entry, err := cache.Get("zero")
+	if err != nil || entry == nil || len(entry.Embedding) != 8 {
+		t.Fatalf("Get(zero) = %v, %v", entry, err)
+	}
+	for _, v := range entry.Embedding {
+		if v != 0 {
+			t.Fatalf("zero vector read back as %v", entry.Embedding)
+		}
+	}
+
+	// The largest component sets the scale, so it reads back unchanged
+	if err := cache.Put("peak", []float32{-0.5, 0.25, 1.5}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if entry, err = cache.Get("peak"); err != nil || math.Abs(float64(entry.Embedding[2])-1.5) > 1e-6 {
+		t.Errorf("Get(peak) = %v, %v, want 1.5 kept", entry, err)
+	}
+}
@@ -20,7 +20,122 @@ type Chunk struct {
 	StartLine int    `json:"start_line"`
 	EndLine   int    `json:"end_line"`
 	Content   string `json:"content"`
-	Kind      string `json:"kind"` // "function", "class", "type", "block", "fixed"
+	Kind      string `json:"kind"`           // "function", "class", "type", "block", "fixed"
+	Name      string `json:"name,omitempty"` // Symbol name, if the chunk is a named definition
+
+	// EmbedContent overrides the text sent to the embedder (e.g. with
+	// comments stripped). Empty means embed Content.
+	EmbedContent string `json:"embed_content,omitempty"`
+
+	// Description is a short natural-language summary embedded in place
+	// of the chunk text, for content whose raw form embeds poorly (config,
+	// data files). See Summarizer. Content and locations are unaffected.
+	Description string `json:"description,omitempty"`
+
+	// NeighborContext is a short summary of the surrounding chunks,
+	// prepended to the embedder input. See CacheKey for how it affects
+	// caching.
+	NeighborContext string `json:"neighbor_context,omitempty"`
+
+	// QualifiedName is the chunk's symbol path, such as
+	// "auth.Middleware.Handle". When set it is prepended to the embedder
+	// input, covered by the cache key, and stored with the chunk's location.
+	QualifiedName string `json:"qualified_name,omitempty"`
+
+	// PathContext is the chunk's repo-relative path when it is embedded
+	// with it, so queries naming a domain or module ("payments retry")
+	// match code filed under it. When set it is prepended to the embedder
+	// input and covered by the cache key.
+	PathContext string `json:"path_context,omitempty"`
+
+	// LocationOnly records the chunk's location without embedding it, for
+	// chunks worth finding by name but not by meaning, such as trivial
+	// getters. See LocationKey.
+	LocationOnly bool `json:"location_only,omitempty"`
+
+	// Refresh embeds the chunk even if its embedding is cached, replacing
+	// the cached vector, for content whose old embedding is not trusted.
+	Refresh bool `json:"refresh,omitempty"`
+
+	// Metadata is copied to the chunk's location (see ChunkLocation.Metadata)
+	// and does not affect its embedding.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// NeighborContextVersion is mixed into the cache key of chunks embedded with
+// neighbor context, so their vectors never collide with plain ones. Bump it
+// when the context format changes.
+const NeighborContextVersion = "neighbors-v1"
+
+// EmbeddingInput returns the chunk's own text to embed, without neighbor
+// context: Description if set, then EmbedContent, then Content.
+func (c Chunk) EmbeddingInput() string {
+	if c.Description != "" {
+		return c.Description
+	}
+	if c.EmbedContent != "" {
+		return c.EmbedContent
+	}
+	return c.Content
+}
+
+// ContextualInput returns the full text sent to the embedder: the path
+// context, the qualified name and the neighbor context, if any, followed by
+// EmbeddingInput.
+func (c Chunk) ContextualInput() string {
+	var header []string
+	if c.PathContext != "" {
+		header = append(header, c.PathContext)
+	}
+	if c.QualifiedName != "" {
+		header = append(header, c.QualifiedName)
+	}
+	if c.NeighborContext != "" {
+		header = append(header, c.NeighborContext)
+	}
+	if len(header) == 0 {
+		return c.EmbeddingInput()
+	}
+	return strings.Join(header, "\n") + "\n\n" + c.EmbeddingInput()
+}
+
+// CacheKey returns the hash the chunk's embedding is cached under. It
+// covers the chunk's own input plus NeighborContextVersion when neighbor
+// context is present, but not the neighbors' text: editing one function
+// does not re-embed the functions around it, at the cost of their context
+// going slightly stale until they change themselves. The qualified name is
+// covered in full, so renaming a class re-embeds its methods, and so is
+// the path context, so moving a file embedded with it re-embeds it.
+func (c Chunk) CacheKey() string {
+	input := c.EmbeddingInput()
+	if c.NeighborContext != "" {
+		input = NeighborContextVersion + "\x00" + input
+	}
+	if c.QualifiedName != "" {
+		input = "qualified:" + c.QualifiedName + "\x00" + input
+	}
+	if c.PathContext != "" {
+		input = "path:" + c.PathContext + "\x00" + input
+	}
+	return HashContent(input)
+}
+
+// LocationOnlyPrefix marks the content hashes of LocationOnly chunks, which
+// have no embedding, so coverage checks do not report them missing.
+const LocationOnlyPrefix = "location-only:"
+
+// LocationKey returns the content hash recorded with the chunk's location:
+// CacheKey, prefixed with LocationOnlyPrefix for a LocationOnly chunk.
+func (c Chunk) LocationKey() string {
+	if c.LocationOnly {
+		return LocationOnlyPrefix + c.CacheKey()
+	}
+	return c.CacheKey()
+}
+
+// embeds reports whether the pipeline embeds the chunk.
+func (c Chunk) embeds() bool {
+	return c.Content != "" && !c.LocationOnly
 }
 
 // ChunkerConfig configures the chunking behavior
@@ -0,0 +1,78 @@
+package embedding
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// compressMinBytes is the smallest request body gzipped when compression
+// is on; smaller bodies save too little transfer time to be worth it.
+const compressMinBytes = 1024
+
+// requestCompressor sends JSON request bodies to one endpoint, gzipped
+// with a "Content-Encoding: gzip" header when enabled. The zero value
+// sends them uncompressed. An endpoint that rejects a compressed body with
+// 415 Unsupported Media Type is sent the body again uncompressed, and no
+// later request to it is compressed.
+type requestCompressor struct {
+	enabled atomic.Bool
+}
+
+// setEnabled turns compression on or off.
+func (rc *requestCompressor) setEnabled(on bool) {
+	rc.enabled.Store(on)
+}
+
+// post sends body to url with client, calling setHeaders on the request
+// to add headers besides the content type and encoding.
+func (rc *requestCompressor) post(ctx context.Context, client *http.Client, url string, body []byte, setHeaders func(*http.Request)) (*http.Response, error) {
+	compress := rc.enabled.Load() && len(body) >= compressMinBytes
+	resp, err := sendJSON(ctx, client, url, body, compress, setHeaders)
+	if err != nil || !compress || resp.StatusCode != http.StatusUnsupportedMediaType {
+		return resp, err
+	}
+
+	// The endpoint does not accept gzip; stop compressing for it
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	rc.enabled.Store(false)
+	return sendJSON(ctx, client, url, body, false, setHeaders)
+}
+
+// sendJSON posts body to url as JSON, gzipped if compress is set.
+func sendJSON(ctx context.Context, client *http.Client, url string, body []byte, compress bool, setHeaders func(*http.Request)) (*http.Response, error) {
+	if compress {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return nil, fmt.Errorf("compressing request: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("compressing request: %w", err)
+		}
+		body = buf.Bytes()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if compress {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if setHeaders != nil {
+		setHeaders(req)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sending request: %w", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,215 @@
+package embedding
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// compressionServer is a mock OpenAI-compatible and Ollama embedding
+// server that decodes gzipped request bodies, recording each request's
+// encoding and decoded inputs.
+type compressionServer struct {
+	*httptest.Server
+	rejectGzip bool // Answer gzipped bodies with 415
+
+	mu        sync.Mutex
+	encodings []string
+	inputs    [][]string
+}
+
+func newCompressionServer(t *testing.T, rejectGzip bool) *compressionServer {
+	t.Helper()
+	s := &compressionServer{rejectGzip: rejectGzip}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := r.Header.Get("Content-Encoding")
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", r.Header.Get("Content-Type"))
+		}
+
+		body := io.Reader(r.Body)
+		if encoding == "gzip" {
+			if s.rejectGzip {
+				s.record(encoding, nil)
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				return
+			}
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("request body is not gzip: %v", err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body = zr
+		}
+
+		var req struct {
+			Input  []string `json:"input"`
+			Prompt string   `json:"prompt"`
+		}
+		if err := json.NewDecoder(body).Decode(&req); err != nil {
+			t.Errorf("request body (encoding %q) is not JSON: %v", encoding, err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if r.URL.Path == "/api/embeddings" {
+			s.record(encoding, []string{req.Prompt})
+			json.NewEncoder(w).Encode(embedResponse{Embedding: []float32{float32(len(req.Prompt))}})
+			return
+		}
+		s.record(encoding, req.Input)
+		var resp openAIEmbeddingResponse
+		for i, input := range req.Input {
+			resp.Data = append(resp.Data, struct {
+				Embedding []float32 `json:"embedding"`
+				Index     int       `json:"index"`
+			}{Embedding: []float32{float32(len(input))}, Index: i})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *compressionServer) record(encoding string, inputs []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.encodings = append(s.encodings, encoding)
+	s.inputs = append(s.inputs, inputs)
+}
+
+// largeTexts returns texts whose request body exceeds compressMinBytes.
+func largeTexts() []string {
+	return []string{strings.Repeat("func a() {}\n", 100), strings.Repeat("func b() {}\n", 120)}
+}
+
+func TestLiteLLMClient_Compression(t *testing.T) {
+	texts := largeTexts()
+
+	t.Run("enabled gzips the body", func(t *testing.T) {
+		server := newCompressionServer(t, false)
+		client := NewLiteLLMClient(WithLiteLLMBaseURL(server.URL), WithLiteLLMCompression(true))
+
+		embeddings, err := client.Embed(context.Background(), texts)
+		if err != nil {
+			t.Fatalf("Embed() error = %v", err)
+		}
+		if len(server.encodings) != 1 || server.encodings[0] != "gzip" {
+			t.Fatalf("encodings = %q, want one gzip request", server.encodings)
+		}
+		if strings.Join(server.inputs[0], "|") != strings.Join(texts, "|") {
+			t.Error("decompressed inputs differ from the texts sent")
+		}
+		for i, text := range texts {
+			if embeddings[i][0] != float32(len(text)) {
+				t.Errorf("embedding %d = %v, want the length of text %d", i, embeddings[i], i)
+			}
+		}
+	})
+
+	t.Run("disabled sends plain JSON", func(t *testing.T) {
+		server := newCompressionServer(t, false)
+		client := NewLiteLLMClient(WithLiteLLMBaseURL(server.URL))
+
+		if _, err := client.Embed(context.Background(), texts); err != nil {
+			t.Fatalf("Embed() error = %v", err)
+		}
+		if len(server.encodings) != 1 || server.encodings[0] != "" {
+			t.Errorf("encodings = %q, want one plain request", server.encodings)
+		}
+	})
+
+	t.Run("small bodies are not compressed", func(t *testing.T) {
+		server := newCompressionServer(t, false)
+		client := NewLiteLLMClient(WithLiteLLMBaseURL(server.URL), WithLiteLLMCompression(true))
+
+		if _, err := client.Embed(context.Background(), []string{"short"}); err != nil {
+			t.Fatalf("Embed() error = %v", err)
+		}
+		if len(server.encodings) != 1 || server.encodings[0] != "" {
+			t.Errorf("encodings = %q, want one plain request", server.encodings)
+		}
+	})
+
+	t.Run("endpoint rejecting gzip gets plain JSON", func(t *testing.T) {
+		server := newCompressionServer(t, true)
+		client := NewLiteLLMClient(WithLiteLLMBaseURL(server.URL), WithLiteLLMCompression(true))
+
+		for i := 0; i < 2; i++ {
+			if _, err := client.Embed(context.Background(), texts); err != nil {
+				t.Fatalf("Embed() error = %v", err)
+			}
+		}
+		// Rejected once, retried plain, then never compressed again
+		want := []string{"gzip", "", ""}
+		if strings.Join(server.encodings, ",") != strings.Join(want, ",") {
+			t.Errorf("encodings = %q, want %q", server.encodings, want)
+		}
+	})
+}
+
+func TestOllamaClient_Compression(t *testing.T) {
+	text := largeTexts()[0]
+
+	for _, compress := range []bool{true, false} {
+		server := newCompressionServer(t, false)
+		client := NewOllamaClient(WithBaseURL(server.URL), WithCompression(compress))
+
+		embedding, err := client.EmbedWithContext(context.Background(), text)
+		if err != nil {
+			t.Fatalf("EmbedWithContext(compress=%v) error = %v", compress, err)
+		}
+		if embedding[0] != float32(len(text)) {
+			t.Errorf("compress=%v: embedding = %v, want the text's length", compress, embedding)
+		}
+		want := ""
+		if compress {
+			want = "gzip"
+		}
+		if len(server.encodings) != 1 || server.encodings[0] != want {
+			t.Errorf("compress=%v: encodings = %q, want one %q request", compress, server.encodings, want)
+		}
+		if server.inputs[0][0] != text {
+			t.Errorf("compress=%v: server received a different prompt", compress)
+		}
+	}
+}
+
+func TestLoadConfigFromEnvCompress(t *testing.T) {
+	t.Setenv("CODETECT_EMBEDDING_PROVIDER", "litellm")
+	t.Setenv("CODETECT_EMBEDDING_FALLBACK_PROVIDER", "ollama")
+	t.Setenv("CODETECT_EMBEDDING_COMPRESS", "")
+	t.Setenv("CODETECT_EMBEDDING_FALLBACK_COMPRESS", "")
+
+	if cfg := LoadConfigFromEnv(); cfg.Compress || cfg.Fallback.Compress {
+		t.Errorf("compression on by default: %v, fallback %v", cfg.Compress, cfg.Fallback.Compress)
+	}
+
+	// The fallback is usually another endpoint, so it is not compressed
+	// unless asked
+	t.Setenv("CODETECT_EMBEDDING_COMPRESS", "true")
+	cfg := LoadConfigFromEnv()
+	if !cfg.Compress || cfg.Fallback.Compress {
+		t.Errorf("Compress = %v, fallback %v, want true and false", cfg.Compress, cfg.Fallback.Compress)
+	}
+
+	t.Setenv("CODETECT_EMBEDDING_FALLBACK_COMPRESS", "1")
+	if cfg := LoadConfigFromEnv(); !cfg.Fallback.Compress {
+		t.Error("fallback Compress = false, want true")
+	}
+
+	embedder, err := NewEmbedder(ProviderConfig{Provider: ProviderLiteLLM, Compress: true})
+	if err != nil {
+		t.Fatalf("NewEmbedder() error = %v", err)
+	}
+	if !embedder.(*LiteLLMClient).compressor.enabled.Load() {
+		t.Error("NewEmbedder() did not enable compression")
+	}
+}
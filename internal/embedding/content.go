@@ -0,0 +1,174 @@
+package embedding
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"codetect/internal/db"
+)
+
+// ContentStore keeps the text of indexed chunks, gzip-compressed and keyed
+// by content hash like the embedding cache, so snippets can be served from
+// the index when the files it was built from have moved or changed.
+// Identical chunks share one row. See WithContentStore.
+type ContentStore struct {
+	database db.DB
+	dialect  db.Dialect
+	schema   *db.SchemaBuilder
+	mu       sync.RWMutex
+}
+
+// NewContentStore creates a content store in database.
+func NewContentStore(database db.DB, dialect db.Dialect) (*ContentStore, error) {
+	s := &ContentStore{
+		database: database,
+		dialect:  dialect,
+		schema:   db.NewSchemaBuilder(database, dialect),
+	}
+	columns := []db.ColumnDef{
+		{Name: "content_hash", Type: db.ColTypeText, PrimaryKey: true},
+		{Name: "content", Type: db.ColTypeBlob, Nullable: false},
+	}
+	if _, err := database.Exec(dialect.CreateTableSQL("chunk_contents", columns)); err != nil {
+		return nil, fmt.Errorf("creating chunk_contents table: %w", err)
+	}
+	return s, nil
+}
+
+// PutBatch stores the content of each chunk by content hash, in one
+// transaction.
+func (s *ContentStore) PutBatch(contents map[string]string) error {
+	if len(contents) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.database.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	upsertSQL := s.dialect.UpsertSQL("chunk_contents", []string{"content_hash", "content"},
+		[]string{"content_hash"}, []string{"content"})
+	stmt, err := tx.Prepare(s.schema.SubstitutePlaceholders(upsertSQL))
+	if err != nil {
+		return fmt.Errorf("preparing statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for hash, content := range contents {
+		compressed, err := compressContent(content)
+		if err != nil {
+			return fmt.Errorf("compressing content %s: %w", hash, err)
+		}
+		if _, err := stmt.Exec(hash, compressed); err != nil {
+			return fmt.Errorf("storing content %s: %w", hash, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Get returns the stored content for hash, or false if there is none.
+func (s *ContentStore) Get(hash string) (string, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := s.schema.SubstitutePlaceholders("SELECT content FROM chunk_contents WHERE content_hash = ?")
+	var compressed []byte
+	if err := s.database.QueryRow(query, hash).Scan(&compressed); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("reading content %s: %w", hash, err)
+	}
+	content, err := decompressContent(compressed)
+	if err != nil {
+		return "", false, fmt.Errorf("decompressing content %s: %w", hash, err)
+	}
+	return content, true, nil
+}
+
+// DeleteOrphaned removes content no longer referenced by any location in
+// the chunk_locations table of the same database, returning how many rows
+// were removed.
+func (s *ContentStore) DeleteOrphaned() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.database.Exec(`DELETE FROM chunk_contents WHERE content_hash NOT IN
+		(SELECT content_hash FROM chunk_locations)`)
+	if err != nil {
+		return 0, fmt.Errorf("deleting orphaned content: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// Lines returns lines start through end of path in repoRoot, cut from the
+// stored content of the smallest indexed chunk covering them, or false if
+// no such chunk has stored content. File-level locations have none.
+func (s *ContentStore) Lines(locations *LocationStore, repoRoot, path string, start, end int) ([]string, bool, error) {
+	locs, err := locations.GetByPath(repoRoot, path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var best *ChunkLocation
+	for i, loc := range locs {
+		if loc.NodeType == NodeTypeFile || loc.StartLine > start || loc.EndLine < end {
+			continue
+		}
+		if best == nil || loc.EndLine-loc.StartLine < best.EndLine-best.StartLine {
+			best = &locs[i]
+		}
+	}
+	if best == nil {
+		return nil, false, nil
+	}
+
+	content, ok, err := s.Get(best.ContentHash)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	lines := strings.Split(content, "\n")
+	from, to := start-best.StartLine, end-best.StartLine+1
+	if to > len(lines) {
+		return nil, false, nil
+	}
+	return lines[from:to], true, nil
+}
+
+func compressContent(content string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(w, content); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decompressContent(compressed []byte) (string, error) {
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,83 @@
+package embedding
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"codetect/internal/db"
+)
+
+func TestContentStore(t *testing.T) {
+	cfg := db.DefaultConfig(":memory:")
+	database, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	cache, err := NewEmbeddingCache(database, cfg.Dialect(), 3, "test-model")
+	if err != nil {
+		t.Fatalf("creating cache: %v", err)
+	}
+	locations, err := NewLocationStore(database, cfg.Dialect())
+	if err != nil {
+		t.Fatalf("creating location store: %v", err)
+	}
+	contents, err := NewContentStore(database, cfg.Dialect())
+	if err != nil {
+		t.Fatalf("NewContentStore failed: %v", err)
+	}
+	embedder := &keywordEmbedder{keywords: []string{"alpha", "beta"}}
+	pipeline := NewPipeline(cache, locations, embedder, WithContentStore(contents), WithFileEmbeddings(true))
+
+	ctx := context.Background()
+	outer := "func Outer() {\n\talpha()\n\tinner := func() {\n\t\tbeta()\n\t}\n}"
+	inner := "\tinner := func() {\n\t\tbeta()\n\t}"
+	chunks := []Chunk{
+		{Path: "a.go", StartLine: 10, EndLine: 15, Content: outer},
+		{Path: "a.go", StartLine: 12, EndLine: 14, Content: inner},
+	}
+	if _, err := pipeline.EmbedChunks(ctx, "/project", chunks); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+
+	got, ok, err := contents.Get(chunks[0].CacheKey())
+	if err != nil || !ok || got != outer {
+		t.Fatalf("Get = %q, %v, %v; want the outer chunk's content", got, ok, err)
+	}
+	if _, ok, err := contents.Get("missing"); ok || err != nil {
+		t.Errorf("Get(missing) = %v, %v; want not found", ok, err)
+	}
+
+	tests := []struct {
+		start, end int
+		want       []string
+		ok         bool
+	}{
+		{10, 15, strings.Split(outer, "\n"), true},
+		{11, 11, []string{"\talpha()"}, true},
+		{13, 13, []string{"\t\tbeta()"}, true}, // From the inner chunk
+		{14, 16, nil, false},                   // No chunk covers line 16
+		{1, 2, nil, false},
+	}
+	for _, tt := range tests {
+		lines, ok, err := contents.Lines(locations, "/project", "a.go", tt.start, tt.end)
+		if err != nil || ok != tt.ok || !reflect.DeepEqual(lines, tt.want) {
+			t.Errorf("Lines(%d, %d) = %q, %v, %v; want %q, %v", tt.start, tt.end, lines, ok, err, tt.want, tt.ok)
+		}
+	}
+
+	// Content of chunks no location refers to is removed
+	if err := locations.DeleteByPath("/project", "a.go"); err != nil {
+		t.Fatalf("DeleteByPath failed: %v", err)
+	}
+	removed, err := contents.DeleteOrphaned()
+	if err != nil || removed != 2 {
+		t.Errorf("DeleteOrphaned = %d, %v; want 2", removed, err)
+	}
+	if _, ok, _ := contents.Get(chunks[0].CacheKey()); ok {
+		t.Error("orphaned content still stored")
+	}
+}
@@ -0,0 +1,29 @@
+package embedding
+
+// ResultLocation is where a search result's content also appears, when
+// results with identical content are collapsed.
+type ResultLocation struct {
+	Path      string `json:"path"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+}
+
+// CollapseDuplicates collapses ranked results with the same key into the
+// first of them, keeping the order of those that remain; merge records each
+// dropped duplicate on the result kept. Results with an empty key are
+// always kept. The dedup_by_content option of the search tools uses it,
+// keyed by content hash.
+func CollapseDuplicates[T any](results []T, key func(T) string, merge func(kept *T, dup T)) []T {
+	first := make(map[string]int, len(results))
+	deduped := results[:0]
+	for _, r := range results {
+		k := key(r)
+		if i, ok := first[k]; ok && k != "" {
+			merge(&deduped[i], r)
+			continue
+		}
+		first[k] = len(deduped)
+		deduped = append(deduped, r)
+	}
+	return deduped
+}
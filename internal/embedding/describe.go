@@ -0,0 +1,131 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Summarizer produces a short natural-language description of a chunk.
+// When a chunk has a description it is embedded instead of the raw text;
+// the chunk's content and location are stored unchanged. Returning "" keeps
+// the raw text for that chunk.
+type Summarizer interface {
+	Summarize(ctx context.Context, chunk Chunk) (string, error)
+}
+
+// SummarizerFunc adapts a function to the Summarizer interface.
+type SummarizerFunc func(ctx context.Context, chunk Chunk) (string, error)
+
+// Summarize calls f.
+func (f SummarizerFunc) Summarize(ctx context.Context, chunk Chunk) (string, error) {
+	return f(ctx, chunk)
+}
+
+// DescribeChunks fills in Description for chunks that do not already have
+// one. Chunks whose description comes back empty keep embedding their
+// content.
+func DescribeChunks(ctx context.Context, s Summarizer, chunks []Chunk) error {
+	if s == nil {
+		return nil
+	}
+	for i := range chunks {
+		if chunks[i].Description != "" || chunks[i].Content == "" {
+			continue
+		}
+		desc, err := s.Summarize(ctx, chunks[i])
+		if err != nil {
+			return fmt.Errorf("describing %s:%d: %w", chunks[i].Path, chunks[i].StartLine, err)
+		}
+		chunks[i].Description = strings.TrimSpace(desc)
+	}
+	return nil
+}
+
+// maxDescribedKeys caps how many keys DataFileSummarizer lists per chunk.
+const maxDescribedKeys = 12
+
+var (
+	jsonKeyPattern    = regexp.MustCompile(`"([^"\\]{1,64})"\s*:`)
+	yamlKeyPattern    = regexp.MustCompile(`^([A-Za-z0-9_.\-]{1,64}):(\s|$)`)
+	assignKeyPattern  = regexp.MustCompile(`^([A-Za-z0-9_.\-]{1,64})\s*=`)
+	sectionKeyPattern = regexp.MustCompile(`^\[+([^\]]{1,64})\]+`)
+)
+
+// DataFileSummarizer describes chunks of configuration and data files
+// (JSON, YAML, TOML, INI, .env, CSV) by their path and the keys they
+// define, which embeds far better than the raw values. Other files are left
+// to embed their content.
+type DataFileSummarizer struct{}
+
+// Summarize implements Summarizer.
+func (DataFileSummarizer) Summarize(_ context.Context, chunk Chunk) (string, error) {
+	name := strings.ToLower(filepath.Base(chunk.Path))
+	ext := strings.TrimPrefix(filepath.Ext(name), ".")
+	if strings.HasPrefix(name, ".env") {
+		ext = "env"
+	}
+
+	var kind, noun string
+	var keys []string
+	switch ext {
+	case "json":
+		kind, noun = "JSON", "keys"
+		keys = matchKeys(jsonKeyPattern, []string{chunk.Content})
+	case "yaml", "yml":
+		kind, noun = "YAML", "keys"
+		keys = matchKeys(yamlKeyPattern, strings.Split(chunk.Content, "\n"))
+	case "toml", "ini", "cfg", "conf":
+		kind, noun = strings.ToUpper(ext), "sections and keys"
+		lines := strings.Split(chunk.Content, "\n")
+		keys = append(matchKeys(sectionKeyPattern, lines), matchKeys(assignKeyPattern, lines)...)
+	case "env":
+		kind, noun = "environment", "variables"
+		keys = matchKeys(assignKeyPattern, strings.Split(chunk.Content, "\n"))
+	case "csv", "tsv":
+		kind, noun = strings.ToUpper(ext), "columns"
+		header, _, _ := strings.Cut(chunk.Content, "\n")
+		if chunk.StartLine <= 1 {
+			sep := ","
+			if ext == "tsv" {
+				sep = "\t"
+			}
+			for _, col := range strings.Split(header, sep) {
+				if col = strings.Trim(strings.TrimSpace(col), `"`); col != "" {
+					keys = append(keys, col)
+				}
+			}
+		}
+	default:
+		return "", nil
+	}
+
+	desc := fmt.Sprintf("%s file %s", kind, filepath.ToSlash(chunk.Path))
+	if len(keys) > maxDescribedKeys {
+		keys = append(keys[:maxDescribedKeys], "...")
+	}
+	if len(keys) > 0 {
+		desc += " defining " + noun + ": " + strings.Join(keys, ", ")
+	}
+	return desc, nil
+}
+
+// matchKeys returns the first capture group of pattern across lines, in
+// order and without duplicates. Leading whitespace is kept, so
+// line-anchored patterns only see top-level keys.
+func matchKeys(pattern *regexp.Regexp, lines []string) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, line := range lines {
+		for _, m := range pattern.FindAllStringSubmatch(strings.TrimRight(line, "\r"), -1) {
+			key := strings.TrimSpace(m[1])
+			if key != "" && !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
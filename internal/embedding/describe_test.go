@@ -0,0 +1,93 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestDataFileSummarizer(t *testing.T) {
+	tests := []struct {
+		name  string
+		chunk Chunk
+		want  string
+	}{
+		{
+			name:  "json keys",
+			chunk: Chunk{Path: "package.json", StartLine: 1, Content: `{"name": "app", "scripts": {"build": "tsc"}}`},
+			want:  "JSON file package.json defining keys: name, scripts, build",
+		},
+		{
+			name:  "yaml top-level keys only",
+			chunk: Chunk{Path: "ci.yml", StartLine: 1, Content: "jobs:\n  test:\n    runs-on: ubuntu\non: push\n"},
+			want:  "YAML file ci.yml defining keys: jobs, on",
+		},
+		{
+			name:  "toml sections and keys",
+			chunk: Chunk{Path: "Cargo.toml", StartLine: 1, Content: "[package]\nname = \"x\"\n[dependencies]\n"},
+			want:  "TOML file Cargo.toml defining sections and keys: package, dependencies, name",
+		},
+		{
+			name:  "dotenv",
+			chunk: Chunk{Path: ".env.local", StartLine: 1, Content: "API_KEY=abc\n# comment\nDEBUG=1\n"},
+			want:  "environment file .env.local defining variables: API_KEY, DEBUG",
+		},
+		{
+			name:  "csv header",
+			chunk: Chunk{Path: "data/users.csv", StartLine: 1, Content: "id,\"email\",created\n1,a@b.c,2024\n"},
+			want:  "CSV file data/users.csv defining columns: id, email, created",
+		},
+		{
+			name:  "csv body chunk has no header",
+			chunk: Chunk{Path: "data/users.csv", StartLine: 40, Content: "40,x@y.z,2024\n"},
+			want:  "CSV file data/users.csv",
+		},
+		{
+			name:  "source file is left alone",
+			chunk: Chunk{Path: "main.go", StartLine: 1, Content: "package main"},
+			want:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DataFileSummarizer{}.Summarize(context.Background(), tt.chunk)
+			if err != nil {
+				t.Fatalf("Summarize failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Summarize = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDescribeChunks(t *testing.T) {
+	calls := 0
+	s := SummarizerFunc(func(_ context.Context, c Chunk) (string, error) {
+		calls++
+		return "  summary of " + c.Path + "\n", nil
+	})
+
+	chunks := []Chunk{
+		{Path: "a.txt", Content: "alpha"},
+		{Path: "b.txt", Content: "beta", Description: "provided"},
+		{Path: "c.txt"},
+	}
+	if err := DescribeChunks(context.Background(), s, chunks); err != nil {
+		t.Fatalf("DescribeChunks failed: %v", err)
+	}
+	if chunks[0].Description != "summary of a.txt" {
+		t.Errorf("Description = %q, want trimmed summary", chunks[0].Description)
+	}
+	if chunks[1].Description != "provided" || calls != 1 {
+		t.Errorf("provided descriptions and empty chunks should not be summarized (calls = %d)", calls)
+	}
+
+	failing := SummarizerFunc(func(context.Context, Chunk) (string, error) {
+		return "", errors.New("model unavailable")
+	})
+	if err := DescribeChunks(context.Background(), failing, []Chunk{{Path: "x", Content: "y"}}); err == nil {
+		t.Error("expected summarizer error to propagate")
+	}
+}
@@ -0,0 +1,227 @@
+package embedding
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// IndexDiff describes how the index of one repository (B) differs from
+// another (A): files only in B, files only in A, and files in both whose
+// chunks differ. Files are compared by the content hashes of their chunks,
+// so chunks that only moved within a file do not make it changed, while
+// indexes built with different chunking or embedding-text settings see
+// every file as changed.
+type IndexDiff struct {
+	RepoA     string     `json:"repo_a"`
+	RepoB     string     `json:"repo_b"`
+	FilesA    int        `json:"files_a"`
+	FilesB    int        `json:"files_b"`
+	ChunksA   int        `json:"chunks_a"`
+	ChunksB   int        `json:"chunks_b"`
+	Added     []FileDiff `json:"added"`
+	Removed   []FileDiff `json:"removed"`
+	Changed   []FileDiff `json:"changed"`
+	Unchanged int        `json:"unchanged"`
+}
+
+// FileDiff is one file's entry in an IndexDiff. Symbols are the names of
+// the file's chunks; a symbol defined twice counts twice.
+type FileDiff struct {
+	Path           string   `json:"path"`
+	ChunksA        int      `json:"chunks_a"`
+	ChunksB        int      `json:"chunks_b"`
+	SymbolsAdded   []string `json:"symbols_added,omitempty"`
+	SymbolsRemoved []string `json:"symbols_removed,omitempty"`
+}
+
+// Empty reports whether the two indexes hold the same files and chunks.
+func (d *IndexDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// SymbolDelta returns the total number of symbols added and removed.
+func (d *IndexDiff) SymbolDelta() (added, removed int) {
+	for _, files := range [][]FileDiff{d.Added, d.Removed, d.Changed} {
+		for _, f := range files {
+			added += len(f.SymbolsAdded)
+			removed += len(f.SymbolsRemoved)
+		}
+	}
+	return added, removed
+}
+
+// fileIndex is what DiffIndexes compares for one file.
+type fileIndex struct {
+	chunks  int
+	hashes  []string // Sorted, including the file-level entry
+	symbols []string
+}
+
+// DiffIndexes compares the locations of repoA in a with those of repoB in
+// b. The stores may be the same, to compare two repositories sharing a
+// database. Paths are compared relative to each repository root.
+func DiffIndexes(a *LocationStore, repoA string, b *LocationStore, repoB string) (*IndexDiff, error) {
+	filesA, err := loadFileIndexes(a, repoA)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", repoA, err)
+	}
+	filesB, err := loadFileIndexes(b, repoB)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", repoB, err)
+	}
+
+	diff := &IndexDiff{
+		RepoA:   repoA,
+		RepoB:   repoB,
+		FilesA:  len(filesA),
+		FilesB:  len(filesB),
+		Added:   []FileDiff{},
+		Removed: []FileDiff{},
+		Changed: []FileDiff{},
+	}
+	for path, fa := range filesA {
+		diff.ChunksA += fa.chunks
+		fb, ok := filesB[path]
+		if !ok {
+			diff.Removed = append(diff.Removed, FileDiff{
+				Path:           path,
+				ChunksA:        fa.chunks,
+				SymbolsRemoved: fa.symbols,
+			})
+			continue
+		}
+		if slices.Equal(fa.hashes, fb.hashes) {
+			diff.Unchanged++
+			continue
+		}
+		added, removed := symbolDelta(fa.symbols, fb.symbols)
+		diff.Changed = append(diff.Changed, FileDiff{
+			Path:           path,
+			ChunksA:        fa.chunks,
+			ChunksB:        fb.chunks,
+			SymbolsAdded:   added,
+			SymbolsRemoved: removed,
+		})
+	}
+	for path, fb := range filesB {
+		diff.ChunksB += fb.chunks
+		if _, ok := filesA[path]; ok {
+			continue
+		}
+		diff.Added = append(diff.Added, FileDiff{
+			Path:         path,
+			ChunksB:      fb.chunks,
+			SymbolsAdded: fb.symbols,
+		})
+	}
+
+	for _, files := range [][]FileDiff{diff.Added, diff.Removed, diff.Changed} {
+		sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	}
+	return diff, nil
+}
+
+// loadFileIndexes groups the locations of repoRoot by path.
+func loadFileIndexes(s *LocationStore, repoRoot string) (map[string]*fileIndex, error) {
+	locs, err := s.GetByRepo(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*fileIndex)
+	for _, loc := range locs {
+		f := files[loc.Path]
+		if f == nil {
+			f = &fileIndex{}
+			files[loc.Path] = f
+		}
+		f.hashes = append(f.hashes, loc.ContentHash)
+		if loc.NodeType == "file" {
+			continue
+		}
+		f.chunks++
+		if loc.NodeName != "" {
+			f.symbols = append(f.symbols, loc.NodeName)
+		}
+	}
+	for _, f := range files {
+		sort.Strings(f.hashes)
+		sort.Strings(f.symbols)
+	}
+	return files, nil
+}
+
+// symbolDelta returns the symbols in b but not a and those in a but not b,
+// counting duplicates. Both must be sorted.
+func symbolDelta(a, b []string) (added, removed []string) {
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j == len(b) || (i < len(a) && a[i] < b[j]):
+			removed = append(removed, a[i])
+			i++
+		case i == len(a) || b[j] < a[i]:
+			added = append(added, b[j])
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	return added, removed
+}
+
+// WriteText writes a human-readable summary of the diff to w: one line per
+// added (+), removed (-) and changed (~) file, then totals.
+func (d *IndexDiff) WriteText(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "A: %s (%d files, %d chunks)\nB: %s (%d files, %d chunks)\n",
+		d.RepoA, d.FilesA, d.ChunksA, d.RepoB, d.FilesB, d.ChunksB); err != nil {
+		return err
+	}
+	if d.Empty() {
+		_, err := fmt.Fprintln(w, "No differences")
+		return err
+	}
+
+	if _, err := fmt.Fprintln(w); err != nil {
+		return err
+	}
+	write := func(mark string, f FileDiff, chunks string) error {
+		line := fmt.Sprintf("%s %s (%s)", mark, f.Path, chunks)
+		var symbols []string
+		for _, s := range f.SymbolsAdded {
+			symbols = append(symbols, "+"+s)
+		}
+		for _, s := range f.SymbolsRemoved {
+			symbols = append(symbols, "-"+s)
+		}
+		if len(symbols) > 0 {
+			line += "  " + strings.Join(symbols, " ")
+		}
+		_, err := fmt.Fprintln(w, line)
+		return err
+	}
+	for _, f := range d.Added {
+		if err := write("+", f, fmt.Sprintf("%d chunks", f.ChunksB)); err != nil {
+			return err
+		}
+	}
+	for _, f := range d.Removed {
+		if err := write("-", f, fmt.Sprintf("%d chunks", f.ChunksA)); err != nil {
+			return err
+		}
+	}
+	for _, f := range d.Changed {
+		if err := write("~", f, fmt.Sprintf("%d -> %d chunks", f.ChunksA, f.ChunksB)); err != nil {
+			return err
+		}
+	}
+
+	added, removed := d.SymbolDelta()
+	_, err := fmt.Fprintf(w, "\n%d added, %d removed, %d changed, %d unchanged files; symbols +%d -%d\n",
+		len(d.Added), len(d.Removed), len(d.Changed), d.Unchanged, added, removed)
+	return err
+}
@@ -0,0 +1,94 @@
+package embedding
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffIndexes(t *testing.T) {
+	a := setupTestLocationStore(t)
+	b := setupTestLocationStore(t)
+
+	a.SaveLocationsBatch([]ChunkLocation{
+		{RepoRoot: "/a", Path: "same.go", StartLine: 1, EndLine: 5, ContentHash: "s1", NodeType: "function", NodeName: "Same"},
+		{RepoRoot: "/a", Path: "moved.go", StartLine: 1, EndLine: 5, ContentHash: "m1", NodeType: "function", NodeName: "Moved"},
+		{RepoRoot: "/a", Path: "edit.go", StartLine: 1, EndLine: 5, ContentHash: "e1", NodeType: "function", NodeName: "Keep"},
+		{RepoRoot: "/a", Path: "edit.go", StartLine: 6, EndLine: 9, ContentHash: "e2", NodeType: "function", NodeName: "Old"},
+		{RepoRoot: "/a", Path: "edit.go", StartLine: 1, EndLine: 9, ContentHash: "ef", NodeType: "file"},
+		{RepoRoot: "/a", Path: "gone.go", StartLine: 1, EndLine: 5, ContentHash: "g1", NodeType: "function", NodeName: "Gone"},
+	})
+	b.SaveLocationsBatch([]ChunkLocation{
+		{RepoRoot: "/b", Path: "same.go", StartLine: 1, EndLine: 5, ContentHash: "s1", NodeType: "function", NodeName: "Same"},
+		// Same content at other lines is not a change
+		{RepoRoot: "/b", Path: "moved.go", StartLine: 3, EndLine: 7, ContentHash: "m1", NodeType: "function", NodeName: "Moved"},
+		{RepoRoot: "/b", Path: "edit.go", StartLine: 1, EndLine: 5, ContentHash: "e1", NodeType: "function", NodeName: "Keep"},
+		{RepoRoot: "/b", Path: "edit.go", StartLine: 6, EndLine: 9, ContentHash: "e3", NodeType: "function", NodeName: "New"},
+		{RepoRoot: "/b", Path: "edit.go", StartLine: 10, EndLine: 12, ContentHash: "e4", NodeType: "block"},
+		{RepoRoot: "/b", Path: "edit.go", StartLine: 1, EndLine: 12, ContentHash: "eg", NodeType: "file"},
+		{RepoRoot: "/b", Path: "new.go", StartLine: 1, EndLine: 5, ContentHash: "n1", NodeType: "function", NodeName: "Fresh"},
+	})
+
+	diff, err := DiffIndexes(a, "/a", b, "/b")
+	if err != nil {
+		t.Fatalf("DiffIndexes failed: %v", err)
+	}
+
+	want := &IndexDiff{
+		RepoA: "/a", RepoB: "/b",
+		FilesA: 4, FilesB: 4,
+		ChunksA: 5, ChunksB: 6,
+		Added:     []FileDiff{{Path: "new.go", ChunksB: 1, SymbolsAdded: []string{"Fresh"}}},
+		Removed:   []FileDiff{{Path: "gone.go", ChunksA: 1, SymbolsRemoved: []string{"Gone"}}},
+		Changed:   []FileDiff{{Path: "edit.go", ChunksA: 2, ChunksB: 3, SymbolsAdded: []string{"New"}, SymbolsRemoved: []string{"Old"}}},
+		Unchanged: 2,
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("DiffIndexes = %+v\nwant %+v", diff, want)
+	}
+
+	var out strings.Builder
+	if err := diff.WriteText(&out); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	wantText := `A: /a (4 files, 5 chunks)
+B: /b (4 files, 6 chunks)
+
++ new.go (1 chunks)  +Fresh
+- gone.go (1 chunks)  -Gone
+~ edit.go (2 -> 3 chunks)  +New -Old
+
+1 added, 1 removed, 1 changed, 2 unchanged files; symbols +2 -2
+`
+	if out.String() != wantText {
+		t.Errorf("WriteText =\n%s\nwant\n%s", out.String(), wantText)
+	}
+}
+
+func TestDiffIndexesSharedStore(t *testing.T) {
+	store := setupTestLocationStore(t)
+	store.SaveLocationsBatch([]ChunkLocation{
+		{RepoRoot: "/main", Path: "a.go", StartLine: 1, EndLine: 5, ContentHash: "h1", NodeType: "function", NodeName: "F"},
+		{RepoRoot: "/main", Path: "a.go", StartLine: 6, EndLine: 9, ContentHash: "h2", NodeType: "function", NodeName: "F"},
+		{RepoRoot: "/branch", Path: "a.go", StartLine: 1, EndLine: 5, ContentHash: "h1", NodeType: "function", NodeName: "F"},
+	})
+
+	// Duplicate symbol names are counted
+	diff, err := DiffIndexes(store, "/main", store, "/branch")
+	if err != nil {
+		t.Fatalf("DiffIndexes failed: %v", err)
+	}
+	if len(diff.Changed) != 1 || !reflect.DeepEqual(diff.Changed[0].SymbolsRemoved, []string{"F"}) || diff.Changed[0].SymbolsAdded != nil {
+		t.Errorf("Changed = %+v, want a.go with one F removed", diff.Changed)
+	}
+
+	diff, err = DiffIndexes(store, "/main", store, "/main")
+	if err != nil {
+		t.Fatalf("DiffIndexes failed: %v", err)
+	}
+	var out strings.Builder
+	diff.WriteText(&out)
+	if !diff.Empty() || !strings.HasSuffix(out.String(), "No differences\n") {
+		t.Errorf("diff of a repo with itself = %+v, output %q", diff, out.String())
+	}
+}
@@ -0,0 +1,183 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// fallbackRetryInterval is how long a FallbackEmbedder keeps using its
+// fallback before trying the primary again.
+const fallbackRetryInterval = time.Minute
+
+// ModelEmbedder is implemented by embedders whose vectors may come from
+// more than one model. EmbedModel reports the model that produced the
+// returned vectors, so they can be stored under it.
+type ModelEmbedder interface {
+	Embedder
+	EmbedModel(ctx context.Context, texts []string) ([][]float32, string, error)
+}
+
+// FallbackEmbedder embeds with a primary provider and switches to a
+// fallback when the primary is unavailable or a call fails, for example a
+// remote LiteLLM backed by a local Ollama. Both must produce vectors of the
+// same size. After a switch the fallback is used for fallbackRetryInterval
+// before the primary is tried again.
+//
+// ProviderID and Dimensions describe the primary, so indexes stay keyed by
+// the configured provider; EmbedModel reports which model actually ran.
+type FallbackEmbedder struct {
+	primary  Embedder
+	fallback Embedder
+	logger   *slog.Logger
+
+	mu            sync.Mutex
+	checked       bool      // primary Available() has been consulted
+	fallbackUntil time.Time // use the fallback until then
+	now           func() time.Time
+}
+
+// NewFallbackEmbedder returns an embedder that uses fallback when primary
+// fails. It returns an error if their dimensions differ.
+func NewFallbackEmbedder(primary, fallback Embedder) (*FallbackEmbedder, error) {
+	if pd, fd := primary.Dimensions(), fallback.Dimensions(); pd != fd {
+		return nil, fmt.Errorf("fallback %s has %d dimensions, primary %s has %d",
+			fallback.ProviderID(), fd, primary.ProviderID(), pd)
+	}
+	return &FallbackEmbedder{
+		primary:  primary,
+		fallback: fallback,
+		logger:   slog.Default(),
+		now:      time.Now,
+	}, nil
+}
+
+// SetLogger sets the logger that reports switches to the fallback.
+// Default: slog.Default().
+func (f *FallbackEmbedder) SetLogger(logger *slog.Logger) {
+	if logger != nil {
+		f.logger = logger
+	}
+}
+
+// Embed implements Embedder.
+func (f *FallbackEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors, _, err := f.EmbedModel(ctx, texts)
+	return vectors, err
+}
+
+// EmbedModel implements ModelEmbedder.
+func (f *FallbackEmbedder) EmbedModel(ctx context.Context, texts []string) ([][]float32, string, error) {
+	if f.usePrimary() {
+		vectors, err := f.primary.Embed(ctx, texts)
+		if err == nil {
+			return vectors, embedderModel(f.primary), nil
+		}
+		if ctx.Err() != nil {
+			return nil, "", err
+		}
+		f.switchToFallback("error", err)
+	}
+
+	vectors, err := f.fallback.Embed(ctx, texts)
+	if err != nil {
+		return nil, "", fmt.Errorf("fallback %s: %w", f.fallback.ProviderID(), err)
+	}
+	for _, v := range vectors {
+		if len(v) != f.primary.Dimensions() {
+			return nil, "", fmt.Errorf("fallback %s returned %d dimensions, want %d",
+				f.fallback.ProviderID(), len(v), f.primary.Dimensions())
+		}
+	}
+	return vectors, embedderModel(f.fallback), nil
+}
+
+// usePrimary reports whether the next call should go to the primary. The
+// first call checks the primary's availability.
+func (f *FallbackEmbedder) usePrimary() bool {
+	f.mu.Lock()
+	checked := f.checked
+	f.checked = true
+	onFallback := f.now().Before(f.fallbackUntil)
+	f.mu.Unlock()
+
+	if onFallback {
+		return false
+	}
+	if !checked && !f.primary.Available() {
+		f.switchToFallback("reason", "unavailable")
+		return false
+	}
+	return true
+}
+
+func (f *FallbackEmbedder) switchToFallback(args ...any) {
+	f.mu.Lock()
+	f.fallbackUntil = f.now().Add(fallbackRetryInterval)
+	f.mu.Unlock()
+
+	f.logger.Warn("embedding provider failed, using fallback",
+		append([]any{"primary", f.primary.ProviderID(), "fallback", f.fallback.ProviderID()}, args...)...)
+}
+
+// staleModel returns the fallback's model while the primary is in use,
+// or "" while the fallback is in use or both report the same model.
+func (f *FallbackEmbedder) staleModel() string {
+	f.mu.Lock()
+	onFallback := f.now().Before(f.fallbackUntil)
+	f.mu.Unlock()
+
+	primary, fallback := embedderModel(f.primary), embedderModel(f.fallback)
+	if onFallback || primary == fallback {
+		return ""
+	}
+	return fallback
+}
+
+// dropFallbackHits removes from existing the cache entries embedded by
+// embedder's fallback while its primary is in use, so they are embedded
+// again and replaced with the primary's vectors.
+func dropFallbackHits(embedder Embedder, existing map[string]*CacheEntry) {
+	f, ok := embedder.(*FallbackEmbedder)
+	if !ok {
+		return
+	}
+	stale := f.staleModel()
+	if stale == "" {
+		return
+	}
+	for hash, entry := range existing {
+		if entry.Model == stale {
+			delete(existing, hash)
+		}
+	}
+}
+
+// Available reports whether either provider is ready.
+func (f *FallbackEmbedder) Available() bool {
+	return f.primary.Available() || f.fallback.Available()
+}
+
+// ProviderID returns the primary's ID.
+func (f *FallbackEmbedder) ProviderID() string {
+	return f.primary.ProviderID()
+}
+
+// Dimensions returns the vector size shared by both providers.
+func (f *FallbackEmbedder) Dimensions() int {
+	return f.primary.Dimensions()
+}
+
+// embedderModel returns the model name e uses, falling back to its
+// provider ID when it does not report one.
+func embedderModel(e Embedder) string {
+	if m, ok := e.(interface{ Model() string }); ok && m.Model() != "" {
+		return m.Model()
+	}
+	return e.ProviderID()
+}
+
+// Ensure FallbackEmbedder implements ModelEmbedder
+var _ ModelEmbedder = (*FallbackEmbedder)(nil)
@@ -0,0 +1,281 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"codetect/internal/db"
+)
+
+// stubEmbedder returns constant vectors, or err when set.
+type stubEmbedder struct {
+	model      string
+	dimensions int
+	available  bool
+	err        error
+	calls      int
+}
+
+func (s *stubEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	result := make([][]float32, len(texts))
+	for i := range texts {
+		vec := make([]float32, s.dimensions)
+		vec[0] = 1
+		result[i] = vec
+	}
+	return result, nil
+}
+
+func (s *stubEmbedder) Available() bool    { return s.available }
+func (s *stubEmbedder) ProviderID() string { return "stub:" + s.model }
+func (s *stubEmbedder) Dimensions() int    { return s.dimensions }
+func (s *stubEmbedder) Model() string      { return s.model }
+
+func TestFallbackEmbedderPrimaryUnavailable(t *testing.T) {
+	primary := &stubEmbedder{model: "remote", dimensions: 4, available: false}
+	fallback := &stubEmbedder{model: "local", dimensions: 4, available: true}
+
+	f, err := NewFallbackEmbedder(primary, fallback)
+	if err != nil {
+		t.Fatalf("NewFallbackEmbedder failed: %v", err)
+	}
+
+	vectors, model, err := f.EmbedModel(context.Background(), []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("EmbedModel failed: %v", err)
+	}
+	if len(vectors) != 2 || model != "local" {
+		t.Errorf("got %d vectors from %q, want 2 from local", len(vectors), model)
+	}
+	if primary.calls != 0 {
+		t.Errorf("unavailable primary was called %d times", primary.calls)
+	}
+	if !f.Available() {
+		t.Error("Available() = false with a healthy fallback")
+	}
+	if f.ProviderID() != "stub:remote" {
+		t.Errorf("ProviderID() = %q, want the primary's", f.ProviderID())
+	}
+}
+
+func TestFallbackEmbedderPrimaryError(t *testing.T) {
+	primary := &stubEmbedder{model: "remote", dimensions: 4, available: true, err: errors.New("502 bad gateway")}
+	fallback := &stubEmbedder{model: "local", dimensions: 4, available: true}
+
+	f, err := NewFallbackEmbedder(primary, fallback)
+	if err != nil {
+		t.Fatalf("NewFallbackEmbedder failed: %v", err)
+	}
+	now := time.Now()
+	f.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	if _, model, err := f.EmbedModel(ctx, []string{"a"}); err != nil || model != "local" {
+		t.Fatalf("EmbedModel = %q, %v; want local", model, err)
+	}
+	if primary.calls != 1 {
+		t.Fatalf("primary calls = %d, want 1", primary.calls)
+	}
+
+	// The failed primary is skipped until the retry interval passes
+	if _, model, _ := f.EmbedModel(ctx, []string{"b"}); model != "local" || primary.calls != 1 {
+		t.Errorf("second call used %q with %d primary calls, want local and 1", model, primary.calls)
+	}
+
+	primary.err = nil
+	now = now.Add(fallbackRetryInterval + time.Second)
+	if _, model, err := f.EmbedModel(ctx, []string{"c"}); err != nil || model != "remote" {
+		t.Errorf("after retry interval EmbedModel = %q, %v; want remote", model, err)
+	}
+}
+
+func TestFallbackEmbedderSetLogger(t *testing.T) {
+	primary := &stubEmbedder{model: "remote", dimensions: 4, available: false}
+	fallback := &stubEmbedder{model: "local", dimensions: 4, available: true}
+
+	f, err := NewFallbackEmbedder(primary, fallback)
+	if err != nil {
+		t.Fatalf("NewFallbackEmbedder failed: %v", err)
+	}
+	var logs bytes.Buffer
+	f.SetLogger(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	if _, err := f.Embed(context.Background(), []string{"a"}); err != nil {
+		t.Fatalf("Embed failed: %v", err)
+	}
+	if !strings.Contains(logs.String(), "using fallback") || !strings.Contains(logs.String(), "reason=unavailable") {
+		t.Errorf("logs = %q, want the switch to the fallback", logs.String())
+	}
+}
+
+func TestFallbackEmbedderBothFail(t *testing.T) {
+	primary := &stubEmbedder{model: "remote", dimensions: 4, available: true, err: errors.New("down")}
+	fallback := &stubEmbedder{model: "local", dimensions: 4, available: true, err: errors.New("also down")}
+
+	f, err := NewFallbackEmbedder(primary, fallback)
+	if err != nil {
+		t.Fatalf("NewFallbackEmbedder failed: %v", err)
+	}
+	if _, err := f.Embed(context.Background(), []string{"a"}); err == nil {
+		t.Error("expected an error when both providers fail")
+	}
+}
+
+func TestFallbackEmbedderDimensionMismatch(t *testing.T) {
+	primary := &stubEmbedder{model: "remote", dimensions: 1536, available: true}
+	fallback := &stubEmbedder{model: "local", dimensions: 768, available: true}
+
+	if _, err := NewFallbackEmbedder(primary, fallback); err == nil {
+		t.Error("expected an error for mismatched dimensions")
+	}
+}
+
+func TestNewEmbedderWithFallback(t *testing.T) {
+	e, err := NewEmbedder(ProviderConfig{
+		Provider:   ProviderLiteLLM,
+		LiteLLMURL: "http://127.0.0.1:1",
+		Dimensions: 768,
+		Fallback:   &ProviderConfig{Provider: ProviderOllama, OllamaURL: "http://127.0.0.1:1"},
+	})
+	if err != nil {
+		t.Fatalf("NewEmbedder failed: %v", err)
+	}
+	if _, ok := e.(*FallbackEmbedder); !ok {
+		t.Fatalf("NewEmbedder returned %T, want *FallbackEmbedder", e)
+	}
+
+	// text-embedding-3-small's 1536 dimensions cannot fall back to nomic-embed-text
+	_, err = NewEmbedder(ProviderConfig{
+		Provider: ProviderLiteLLM,
+		Fallback: &ProviderConfig{Provider: ProviderOllama},
+	})
+	if err == nil {
+		t.Error("expected an error for a fallback with different dimensions")
+	}
+}
+
+func TestPipelineTagsFallbackModel(t *testing.T) {
+	cfg := db.DefaultConfig(":memory:")
+	database, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	cache, err := NewEmbeddingCache(database, cfg.Dialect(), 8, "remote")
+	if err != nil {
+		t.Fatalf("creating cache: %v", err)
+	}
+	locations, err := NewLocationStore(database, cfg.Dialect())
+	if err != nil {
+		t.Fatalf("creating location store: %v", err)
+	}
+
+	primary := &stubEmbedder{model: "remote", dimensions: 8, available: true, err: errors.New("connection refused")}
+	fallback := &stubEmbedder{model: "local", dimensions: 8, available: true}
+	embedder, err := NewFallbackEmbedder(primary, fallback)
+	if err != nil {
+		t.Fatalf("NewFallbackEmbedder failed: %v", err)
+	}
+	pipeline := NewPipeline(cache, locations, embedder)
+
+	chunks := []Chunk{
+		{Path: "a.go", StartLine: 1, EndLine: 3, Content: "func a() {}"},
+		{Path: "b.go", StartLine: 1, EndLine: 3, Content: "func b() {}"},
+	}
+	result, err := pipeline.EmbedChunks(context.Background(), "/project", chunks)
+	if err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	if result.Embedded != 2 {
+		t.Errorf("Embedded = %d, want 2", result.Embedded)
+	}
+
+	for _, chunk := range chunks {
+		entry, err := cache.Get(chunk.CacheKey())
+		if err != nil || entry == nil {
+			t.Fatalf("cache entry for %s: %v, %v", chunk.Path, entry, err)
+		}
+		if entry.Model != "local" {
+			t.Errorf("%s tagged with model %q, want local", chunk.Path, entry.Model)
+		}
+		if len(entry.Embedding) != 8 {
+			t.Errorf("%s has %d dimensions, want 8", chunk.Path, len(entry.Embedding))
+		}
+	}
+}
+
+func TestPipelineReplacesFallbackVectors(t *testing.T) {
+	cfg := db.DefaultConfig(":memory:")
+	database, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	cache, err := NewEmbeddingCache(database, cfg.Dialect(), 8, "remote")
+	if err != nil {
+		t.Fatalf("creating cache: %v", err)
+	}
+	locations, err := NewLocationStore(database, cfg.Dialect())
+	if err != nil {
+		t.Fatalf("creating location store: %v", err)
+	}
+
+	primary := &stubEmbedder{model: "remote", dimensions: 8, available: true, err: errors.New("connection refused")}
+	fallback := &stubEmbedder{model: "local", dimensions: 8, available: true}
+	embedder, err := NewFallbackEmbedder(primary, fallback)
+	if err != nil {
+		t.Fatalf("NewFallbackEmbedder failed: %v", err)
+	}
+	now := time.Now()
+	embedder.now = func() time.Time { return now }
+	pipeline := NewPipeline(cache, locations, embedder)
+
+	ctx := context.Background()
+	chunks := []Chunk{{Path: "a.go", StartLine: 1, EndLine: 3, Content: "func a() {}"}}
+	if _, err := pipeline.EmbedChunks(ctx, "/project", chunks); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+
+	// While the fallback is in use its vectors are cache hits
+	result, err := pipeline.EmbedChunks(ctx, "/project", chunks)
+	if err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	if result.Embedded != 0 || fallback.calls != 1 {
+		t.Errorf("on fallback: Embedded = %d with %d fallback calls, want 0 and 1", result.Embedded, fallback.calls)
+	}
+
+	// Once the primary is back they are embedded again and replaced
+	primary.err = nil
+	now = now.Add(fallbackRetryInterval + time.Second)
+	result, err = pipeline.EmbedChunks(ctx, "/project", chunks)
+	if err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	if result.Embedded != 1 {
+		t.Errorf("after recovery Embedded = %d, want 1", result.Embedded)
+	}
+	entry, err := cache.Get(chunks[0].CacheKey())
+	if err != nil || entry == nil {
+		t.Fatalf("cache entry: %v, %v", entry, err)
+	}
+	if entry.Model != "remote" {
+		t.Errorf("entry tagged with model %q after recovery, want remote", entry.Model)
+	}
+
+	// Primary vectors are hits from then on
+	if result, _ := pipeline.EmbedChunks(ctx, "/project", chunks); result == nil || result.Embedded != 0 {
+		t.Errorf("primary vectors were embedded again: %+v", result)
+	}
+}
@@ -0,0 +1,79 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// DefaultHighlightLines is the highlight window used when none is given.
+const DefaultHighlightLines = 3
+
+// Highlight marks the lines of a result that best match the query.
+type Highlight struct {
+	StartLine int     `json:"start_line"`
+	EndLine   int     `json:"end_line"`
+	Score     float32 `json:"score"`
+}
+
+// HighlightLines scores windows of about windowLines lines against the
+// query embedding and returns the best one. lines are the chunk's text and
+// startLine the line number of lines[0]. Windows overlap by half, so a
+// relevant passage is not split between two of them; blank windows are
+// skipped. All windows are embedded in one call.
+//
+// It returns nil if lines contain no text.
+func HighlightLines(ctx context.Context, embedder Embedder, queryVec []float32, lines []string, startLine, windowLines int) (*Highlight, error) {
+	if windowLines <= 0 {
+		windowLines = DefaultHighlightLines
+	}
+	stride := max(1, windowLines/2)
+
+	type window struct{ start, end int } // indexes into lines, end exclusive
+	var windows []window
+	var texts []string
+	for i := 0; i < len(lines); i += stride {
+		end := min(i+windowLines, len(lines))
+		// Trim blank edges so the highlight covers only text
+		start := i
+		for start < end && strings.TrimSpace(lines[start]) == "" {
+			start++
+		}
+		for end > start && strings.TrimSpace(lines[end-1]) == "" {
+			end--
+		}
+		if start < end {
+			windows = append(windows, window{start, end})
+			texts = append(texts, strings.Join(lines[start:end], "\n"))
+		}
+		if i+windowLines >= len(lines) {
+			break
+		}
+	}
+	if len(windows) == 0 {
+		return nil, nil
+	}
+
+	vectors, err := embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, fmt.Errorf("embedding highlight windows: %w", err)
+	}
+	if len(vectors) != len(windows) {
+		return nil, fmt.Errorf("embedding highlight windows: got %d vectors for %d windows", len(vectors), len(windows))
+	}
+
+	best := -1
+	var bestScore float32
+	for i, vec := range vectors {
+		score := CosineSimilarity(queryVec, vec)
+		if best < 0 || score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+
+	return &Highlight{
+		StartLine: startLine + windows[best].start,
+		EndLine:   startLine + windows[best].end - 1,
+		Score:     bestScore,
+	}, nil
+}
@@ -0,0 +1,143 @@
+package embedding
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"codetect/internal/db"
+)
+
+// refundChunk is a chunk starting at line 20. Only line 26 mentions both
+// refunds and payments.
+var refundChunk = []string{
+	"func HandleCharge(c Charge) error {", // 20
+	"\tlog.Printf(\"charge %s\", c.ID)",   // 21
+	"\tif err := validate(c); err != nil {",
+	"\t\treturn err",
+	"\t}",
+	"",
+	"\t// refund the payment before retrying",      // 26
+	"\tif err := refund(c.Previous); err != nil {", // 27
+	"\t\treturn err",
+	"\t}",
+	"\treturn charge(c)",
+	"}", // 31
+}
+
+// coversOnly reports whether h includes line and spans at most window lines.
+func coversOnly(h *Highlight, line, window int) bool {
+	return h != nil && h.StartLine <= line && h.EndLine >= line && h.EndLine-h.StartLine < window
+}
+
+func TestHighlightLines(t *testing.T) {
+	embedder := &keywordEmbedder{keywords: []string{"refund", "payment", "log"}}
+	ctx := context.Background()
+
+	query, err := embedder.Embed(ctx, []string{"refund payment"})
+	if err != nil {
+		t.Fatalf("embedding query: %v", err)
+	}
+
+	h, err := HighlightLines(ctx, embedder, query[0], refundChunk, 20, 2)
+	if err != nil {
+		t.Fatalf("HighlightLines failed: %v", err)
+	}
+	if h == nil {
+		t.Fatal("expected a highlight")
+	}
+	if h.StartLine < 20 || h.EndLine > 31 || h.StartLine > h.EndLine {
+		t.Fatalf("highlight %d-%d is outside chunk 20-31", h.StartLine, h.EndLine)
+	}
+	if !coversOnly(h, 26, 2) {
+		t.Errorf("highlight = %d-%d, want line 26", h.StartLine, h.EndLine)
+	}
+	if h.Score <= 0 {
+		t.Errorf("Score = %v, want > 0", h.Score)
+	}
+
+	// A different query moves the highlight
+	query, _ = embedder.Embed(ctx, []string{"log"})
+	h, err = HighlightLines(ctx, embedder, query[0], refundChunk, 20, 2)
+	if err != nil || h == nil {
+		t.Fatalf("HighlightLines = %v, %v", h, err)
+	}
+	if h.StartLine > 21 || h.EndLine < 21 {
+		t.Errorf("highlight = %d-%d, want it to cover the log line 21", h.StartLine, h.EndLine)
+	}
+}
+
+func TestHighlightLinesEdges(t *testing.T) {
+	embedder := &keywordEmbedder{keywords: []string{"x"}}
+	ctx := context.Background()
+	query := []float32{1, 0.1}
+
+	// Blank text has nothing to highlight
+	if h, err := HighlightLines(ctx, embedder, query, []string{"", "  "}, 1, 3); err != nil || h != nil {
+		t.Errorf("blank lines: got %+v, %v; want nil", h, err)
+	}
+
+	// A chunk shorter than the window is highlighted whole, without its
+	// blank edges
+	h, err := HighlightLines(ctx, embedder, query, []string{"", "x := 1", ""}, 5, 10)
+	if err != nil || h == nil {
+		t.Fatalf("short chunk: got %v, %v", h, err)
+	}
+	if h.StartLine != 6 || h.EndLine != 6 {
+		t.Errorf("short chunk highlight = %d-%d, want 6-6", h.StartLine, h.EndLine)
+	}
+}
+
+func TestSearchWithHighlight(t *testing.T) {
+	database, err := db.Open(db.DefaultConfig(":memory:"))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	store, err := NewEmbeddingStore(database, "/project")
+	if err != nil {
+		t.Fatalf("creating store: %v", err)
+	}
+
+	embedder := &keywordEmbedder{keywords: []string{"refund", "payment", "log"}}
+	content := strings.Join(refundChunk, "\n")
+	vecs, _ := embedder.Embed(context.Background(), []string{content})
+	chunk := Chunk{Path: "pay.go", StartLine: 20, EndLine: 31, Content: content}
+	if err := store.Save(chunk, vecs[0], embedder.ProviderID()); err != nil {
+		t.Fatalf("saving chunk: %v", err)
+	}
+
+	searcher := NewSemanticSearcher(store, embedder)
+	readLines := func(path string, start, end int) ([]string, error) {
+		if path != "pay.go" || start != 20 || end != 31 {
+			t.Errorf("ReadLines(%s, %d, %d), want pay.go 20-31", path, start, end)
+		}
+		return refundChunk, nil
+	}
+
+	result, err := searcher.SearchWithOptions(context.Background(), "refund payment", SearchOptions{
+		Limit:          5,
+		HighlightLines: 2,
+		ReadLines:      readLines,
+	}, nil)
+	if err != nil {
+		t.Fatalf("SearchWithOptions failed: %v", err)
+	}
+	if len(result.Results) != 1 {
+		t.Fatalf("got %d results, want 1", len(result.Results))
+	}
+	h := result.Results[0].Highlight
+	if !coversOnly(h, 26, 2) {
+		t.Errorf("Highlight = %+v, want line 26", h)
+	}
+
+	// Highlighting is off unless requested
+	result, err = searcher.SearchWithOptions(context.Background(), "refund", SearchOptions{Limit: 5}, nil)
+	if err != nil {
+		t.Fatalf("SearchWithOptions failed: %v", err)
+	}
+	if result.Results[0].Highlight != nil {
+		t.Errorf("unexpected highlight %+v", result.Results[0].Highlight)
+	}
+}
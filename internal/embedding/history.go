@@ -0,0 +1,139 @@
+package embedding
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"codetect/internal/db"
+)
+
+// MaxRunHistory is how many runs RunHistory keeps per repository; older
+// ones are dropped as new runs are recorded.
+const MaxRunHistory = 1000
+
+// IndexRun summarizes one indexing run of a repository.
+type IndexRun struct {
+	RepoRoot   string        `json:"repo_root"`
+	StartedAt  time.Time     `json:"started_at"`
+	Duration   time.Duration `json:"duration"`
+	ChangeType string        `json:"change_type"` // "full" or "incremental"
+	Files      int           `json:"files"`       // Files chunked and embedded
+	Total      int           `json:"total"`       // Chunks created
+	CacheHits  int           `json:"cache_hits"`
+	Embedded   int           `json:"embedded"`
+}
+
+// HitRate returns the percentage of the run's chunk embeddings served from
+// the cache rather than embedded, or 0 if it needed none.
+func (r IndexRun) HitRate() float64 {
+	if r.CacheHits+r.Embedded == 0 {
+		return 0
+	}
+	return float64(r.CacheHits) / float64(r.CacheHits+r.Embedded) * 100
+}
+
+// RunHistory records a summary of each indexing run, so the cache hit rate
+// of incremental indexing can be followed across runs.
+type RunHistory struct {
+	database db.DB
+	dialect  db.Dialect
+	schema   *db.SchemaBuilder
+	mu       sync.Mutex
+}
+
+// NewRunHistory creates a run history in database.
+func NewRunHistory(database db.DB, dialect db.Dialect) (*RunHistory, error) {
+	h := &RunHistory{
+		database: database,
+		dialect:  dialect,
+		schema:   db.NewSchemaBuilder(database, dialect),
+	}
+	columns := []db.ColumnDef{
+		{Name: "id", Type: db.ColTypeAutoIncrement},
+		{Name: "repo_root", Type: db.ColTypeText, Nullable: false},
+		{Name: "started_at", Type: db.ColTypeInteger, Nullable: false},
+		{Name: "duration_ms", Type: db.ColTypeInteger, Nullable: false},
+		{Name: "change_type", Type: db.ColTypeText, Nullable: false},
+		{Name: "files", Type: db.ColTypeInteger, Nullable: false},
+		{Name: "total", Type: db.ColTypeInteger, Nullable: false},
+		{Name: "cache_hits", Type: db.ColTypeInteger, Nullable: false},
+		{Name: "embedded", Type: db.ColTypeInteger, Nullable: false},
+	}
+	if _, err := database.Exec(dialect.CreateTableSQL("index_runs", columns)); err != nil {
+		return nil, fmt.Errorf("creating index_runs table: %w", err)
+	}
+	idxRepo := dialect.CreateIndexSQL("index_runs", "idx_index_runs_repo", []string{"repo_root", "started_at"}, false)
+	if _, err := database.Exec(idxRepo); err != nil {
+		return nil, fmt.Errorf("creating index_runs index: %w", err)
+	}
+	return h, nil
+}
+
+// Record stores run, dropping the repository's oldest runs beyond
+// MaxRunHistory.
+func (h *RunHistory) Record(run IndexRun) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	insert := h.schema.SubstitutePlaceholders(`
+		INSERT INTO index_runs (repo_root, started_at, duration_ms, change_type, files, total, cache_hits, embedded)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if _, err := h.database.Exec(insert, run.RepoRoot, run.StartedAt.UnixMilli(), run.Duration.Milliseconds(),
+		run.ChangeType, run.Files, run.Total, run.CacheHits, run.Embedded); err != nil {
+		return fmt.Errorf("recording index run: %w", err)
+	}
+
+	prune := h.schema.SubstitutePlaceholders(`
+		DELETE FROM index_runs WHERE repo_root = ? AND id NOT IN (
+			SELECT id FROM index_runs WHERE repo_root = ? ORDER BY id DESC LIMIT ?
+		)
+	`)
+	if _, err := h.database.Exec(prune, run.RepoRoot, run.RepoRoot, MaxRunHistory); err != nil {
+		return fmt.Errorf("pruning index runs: %w", err)
+	}
+	return nil
+}
+
+// List returns the repository's last limit runs, oldest first. A limit of
+// 0 or less returns every run kept.
+func (h *RunHistory) List(repoRoot string, limit int) ([]IndexRun, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if limit <= 0 {
+		limit = MaxRunHistory
+	}
+	query := h.schema.SubstitutePlaceholders(`
+		SELECT started_at, duration_ms, change_type, files, total, cache_hits, embedded
+		FROM index_runs WHERE repo_root = ? ORDER BY id DESC LIMIT ?
+	`)
+	rows, err := h.database.Query(query, repoRoot, limit)
+	if err != nil {
+		return nil, fmt.Errorf("querying index runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []IndexRun
+	for rows.Next() {
+		run := IndexRun{RepoRoot: repoRoot}
+		var startedAt, durationMs int64
+		if err := rows.Scan(&startedAt, &durationMs, &run.ChangeType, &run.Files,
+			&run.Total, &run.CacheHits, &run.Embedded); err != nil {
+			return nil, fmt.Errorf("scanning index run: %w", err)
+		}
+		run.StartedAt = time.UnixMilli(startedAt)
+		run.Duration = time.Duration(durationMs) * time.Millisecond
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Newest were read first
+	for i, j := 0, len(runs)-1; i < j; i, j = i+1, j-1 {
+		runs[i], runs[j] = runs[j], runs[i]
+	}
+	return runs, nil
+}
@@ -0,0 +1,82 @@
+package embedding
+
+import (
+	"testing"
+	"time"
+
+	"codetect/internal/db"
+)
+
+func TestRunHistory(t *testing.T) {
+	cfg := db.DefaultConfig(":memory:")
+	database, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	history, err := NewRunHistory(database, cfg.Dialect())
+	if err != nil {
+		t.Fatalf("NewRunHistory failed: %v", err)
+	}
+
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	runs := []IndexRun{
+		{RepoRoot: "/project", StartedAt: start, Duration: 3 * time.Second, ChangeType: "full", Files: 10, Total: 40, Embedded: 40},
+		{RepoRoot: "/other", StartedAt: start.Add(time.Minute), ChangeType: "full", Total: 5, Embedded: 5},
+		{RepoRoot: "/project", StartedAt: start.Add(time.Hour), Duration: 250 * time.Millisecond, ChangeType: "incremental", Files: 2, Total: 8, CacheHits: 6, Embedded: 2},
+		{RepoRoot: "/project", StartedAt: start.Add(2 * time.Hour), ChangeType: "incremental", Files: 1, Total: 4, CacheHits: 4},
+	}
+	for _, run := range runs {
+		if err := history.Record(run); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+
+	got, err := history.List("/project", 0)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	want := []IndexRun{runs[0], runs[2], runs[3]}
+	if len(got) != len(want) {
+		t.Fatalf("List returned %d runs, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if !got[i].StartedAt.Equal(want[i].StartedAt) {
+			t.Errorf("run %d started %v, want %v", i, got[i].StartedAt, want[i].StartedAt)
+		}
+		got[i].StartedAt = want[i].StartedAt
+		if got[i] != want[i] {
+			t.Errorf("run %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if rates := []float64{got[0].HitRate(), got[1].HitRate(), got[2].HitRate()}; rates[0] != 0 || rates[1] != 75 || rates[2] != 100 {
+		t.Errorf("hit rates = %v, want [0 75 100]", rates)
+	}
+
+	// A limit keeps the most recent runs, still oldest first
+	latest, err := history.List("/project", 2)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(latest) != 2 || latest[0].Total != 8 || latest[1].Total != 4 {
+		t.Errorf("List(2) = %+v, want the last two runs in order", latest)
+	}
+
+	// Old runs are dropped beyond MaxRunHistory
+	for i := 0; i < MaxRunHistory; i++ {
+		if err := history.Record(IndexRun{RepoRoot: "/project", StartedAt: start.Add(time.Duration(i+3) * time.Hour), ChangeType: "incremental"}); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+	all, err := history.List("/project", 0)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(all) != MaxRunHistory || all[0].ChangeType != "incremental" || all[0].Total != 0 {
+		t.Errorf("kept %d runs starting with %+v, want the newest %d", len(all), all[0], MaxRunHistory)
+	}
+	if other, _ := history.List("/other", 0); len(other) != 1 {
+		t.Errorf("other repo kept %d runs, want 1", len(other))
+	}
+}
@@ -0,0 +1,131 @@
+package embedding
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ImportRecord is one precomputed embedding read by ImportEmbeddings.
+// ContentHash is the chunk's cache key: the SHA-256 hex of the text that
+// was embedded (see Chunk.CacheKey).
+type ImportRecord struct {
+	ContentHash string    `json:"content_hash"`
+	Embedding   []float32 `json:"embedding"`
+	Model       string    `json:"model,omitempty"`
+}
+
+// ImportResult contains statistics from an ImportEmbeddings call.
+type ImportResult struct {
+	Records      int           `json:"records"`      // Records read
+	Imported     int           `json:"imported"`     // Records stored in the cache
+	Unreferenced int           `json:"unreferenced"` // Stored hashes with no chunk location in the repo
+	Duration     time.Duration `json:"duration"`
+}
+
+// ImportEmbeddings stores embeddings computed outside codetect, read from r
+// as a stream of JSON ImportRecord objects (for example JSONL), so they can
+// be searched without calling the embedder. Every vector must have the
+// cache's dimensions. When the cache has a model, a record's model, if set,
+// must match it, since queries are embedded with that model; untagged
+// records are tagged with the cache's model.
+//
+// Records are written in batches as they are read. On an invalid record the
+// import stops with an error naming it; earlier batches stay stored.
+// Hashes that no chunk location in repoRoot references are stored but
+// counted as Unreferenced, which usually means they were computed from
+// different chunk text. File-level embeddings are not built from imports.
+func (p *Pipeline) ImportEmbeddings(ctx context.Context, repoRoot string, r io.Reader) (*ImportResult, error) {
+	start := time.Now()
+	result := &ImportResult{}
+
+	known, err := p.locations.GetHashesForRepo(repoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("getting repo hashes: %w", err)
+	}
+	referenced := make(map[string]bool, len(known))
+	for _, hash := range known {
+		referenced[hash] = true
+	}
+
+	// Pending records by model
+	batch := make(map[string]map[string][]float32)
+	pending := 0
+	flush := func() error {
+		for model, entries := range batch {
+			if err := p.cache.PutBatchModel(entries, model); err != nil {
+				return fmt.Errorf("storing embeddings: %w", err)
+			}
+			result.Imported += len(entries)
+		}
+		batch = make(map[string]map[string][]float32)
+		pending = 0
+		return nil
+	}
+
+	dec := json.NewDecoder(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		var rec ImportRecord
+		if err := dec.Decode(&rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return result, fmt.Errorf("record %d: %w", result.Records+1, err)
+		}
+		result.Records++
+		rec.ContentHash = strings.ToLower(rec.ContentHash)
+
+		if err := p.validateImport(rec); err != nil {
+			return result, fmt.Errorf("record %d: %w", result.Records, err)
+		}
+		if !referenced[rec.ContentHash] {
+			result.Unreferenced++
+		}
+
+		model := rec.Model
+		if model == "" {
+			model = p.cache.Model()
+		}
+		if batch[model] == nil {
+			batch[model] = make(map[string][]float32)
+		}
+		batch[model][rec.ContentHash] = rec.Embedding
+		if pending++; pending >= DefaultWriteBatchSize {
+			if err := flush(); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return result, err
+	}
+
+	result.Duration = time.Since(start)
+	return result, nil
+}
+
+// validateImport checks that rec can be stored in the cache.
+func (p *Pipeline) validateImport(rec ImportRecord) error {
+	if b, err := hex.DecodeString(rec.ContentHash); err != nil || len(b) != 32 {
+		return fmt.Errorf("content_hash %q is not a SHA-256 hex digest", rec.ContentHash)
+	}
+	if len(rec.Embedding) != p.cache.Dimensions() {
+		return fmt.Errorf("%s: embedding has %d dimensions, want %d",
+			rec.ContentHash, len(rec.Embedding), p.cache.Dimensions())
+	}
+	if model := p.cache.Model(); model != "" && rec.Model != "" && rec.Model != model {
+		return fmt.Errorf("%s: model %q does not match the index model %q",
+			rec.ContentHash, rec.Model, model)
+	}
+	return nil
+}
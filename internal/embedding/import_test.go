@@ -0,0 +1,106 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// importLines encodes records as JSONL.
+func importLines(t *testing.T, records ...ImportRecord) string {
+	t.Helper()
+	var b strings.Builder
+	for _, rec := range records {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			t.Fatalf("encoding record: %v", err)
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func TestImportEmbeddingsSearchable(t *testing.T) {
+	pipeline, embedder := setupFilePipeline(t)
+	ctx := context.Background()
+
+	// Locations from an index run without an embedder
+	chunks := []Chunk{
+		{Path: "a.go", StartLine: 1, EndLine: 5, Content: "alpha alpha"},
+		{Path: "b.go", StartLine: 1, EndLine: 4, Content: "beta beta"},
+	}
+	var locs []ChunkLocation
+	for _, c := range chunks {
+		locs = append(locs, ChunkLocation{
+			RepoRoot: "/project", Path: c.Path, StartLine: c.StartLine, EndLine: c.EndLine,
+			ContentHash: c.CacheKey(), NodeType: "function", Language: "go",
+		})
+	}
+	if err := pipeline.Locations().SaveLocationsBatch(locs); err != nil {
+		t.Fatalf("saving locations: %v", err)
+	}
+
+	// Vectors computed elsewhere, plus one for a chunk this repo lacks
+	var records []ImportRecord
+	for _, c := range append(chunks, Chunk{Content: "alpha beta"}) {
+		vecs, _ := embedder.Embed(ctx, []string{c.Content})
+		records = append(records, ImportRecord{ContentHash: c.CacheKey(), Embedding: vecs[0]})
+	}
+	records[0].Model = "test-model"
+
+	result, err := pipeline.ImportEmbeddings(ctx, "/project", strings.NewReader(importLines(t, records...)))
+	if err != nil {
+		t.Fatalf("ImportEmbeddings failed: %v", err)
+	}
+	if result.Records != 3 || result.Imported != 3 || result.Unreferenced != 1 {
+		t.Errorf("result = %+v, want 3 records, 3 imported, 1 unreferenced", result)
+	}
+
+	entry, err := pipeline.Cache().Get(chunks[1].CacheKey())
+	if err != nil || entry == nil {
+		t.Fatalf("cache entry: %v, %v", entry, err)
+	}
+	if entry.Model != "test-model" {
+		t.Errorf("untagged record stored with model %q, want test-model", entry.Model)
+	}
+
+	searcher := NewCacheSearcher(pipeline.Cache(), pipeline.Locations(), embedder)
+	results, err := searcher.Search(ctx, "beta", CacheSearchOptions{RepoRoot: "/project", Limit: 1})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Path != "b.go" {
+		t.Errorf("Search(beta) = %+v, want b.go", results)
+	}
+}
+
+func TestImportEmbeddingsValidation(t *testing.T) {
+	pipeline, _ := setupFilePipeline(t)
+	ctx := context.Background()
+	hash := HashContent("alpha")
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"wrong dimensions", importLines(t, ImportRecord{ContentHash: hash, Embedding: []float32{1, 2}}), "dimensions"},
+		{"other model", importLines(t, ImportRecord{ContentHash: hash, Embedding: []float32{1, 2, 3}, Model: "other"}), "does not match"},
+		{"bad hash", importLines(t, ImportRecord{ContentHash: "abc", Embedding: []float32{1, 2, 3}}), "SHA-256"},
+		{"bad JSON", "{\"content_hash\": ", "record 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := pipeline.ImportEmbeddings(ctx, "/project", strings.NewReader(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+
+	if n, _ := pipeline.Cache().Count(); n != 0 {
+		t.Errorf("invalid records stored %d entries", n)
+	}
+}
@@ -0,0 +1,117 @@
+package embedding
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"codetect/internal/db"
+)
+
+// IndexModel is the embedding model and dimensions a repository's index
+// was last built with.
+type IndexModel struct {
+	RepoRoot   string    `json:"repo_root"`
+	Model      string    `json:"model"`
+	Dimensions int       `json:"dimensions"` // 0 if the embedder did not report them
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ModelMismatchError is returned by searches whose query was embedded with
+// another model, or into vectors of other dimensions, than the index was
+// built with. Scores across embedding spaces are meaningless, so such
+// searches are refused rather than returning arbitrary results.
+type ModelMismatchError struct {
+	RepoRoot        string
+	IndexModel      string // Empty if only the dimensions are known
+	IndexDimensions int
+	QueryModel      string
+	QueryDimensions int
+}
+
+func (e *ModelMismatchError) Error() string {
+	index := fmt.Sprintf("%d-dimension vectors", e.IndexDimensions)
+	if e.IndexModel != "" {
+		index = fmt.Sprintf("model %q (%d dimensions)", e.IndexModel, e.IndexDimensions)
+	}
+	return fmt.Sprintf("index of %s was built with %s but queries use model %q (%d dimensions); "+
+		"reindex or set CODETECT_EMBEDDING_MODEL back to the indexed model",
+		e.RepoRoot, index, e.QueryModel, e.QueryDimensions)
+}
+
+// Check returns a *ModelMismatchError if a query embedded by model into
+// vectors of dimensions cannot be compared with the index. Dimensions of 0
+// on either side are not compared.
+func (m *IndexModel) Check(model string, dimensions int) error {
+	if m == nil {
+		return nil
+	}
+	if m.Model != model || (m.Dimensions > 0 && dimensions > 0 && m.Dimensions != dimensions) {
+		return &ModelMismatchError{
+			RepoRoot:        m.RepoRoot,
+			IndexModel:      m.Model,
+			IndexDimensions: m.Dimensions,
+			QueryModel:      model,
+			QueryDimensions: dimensions,
+		}
+	}
+	return nil
+}
+
+// IndexModelStore records the embedding model each repository was indexed
+// with, so searches can detect a query-time model that differs from it.
+type IndexModelStore struct {
+	database db.DB
+	dialect  db.Dialect
+	schema   *db.SchemaBuilder
+}
+
+// NewIndexModelStore creates an index model store in database.
+func NewIndexModelStore(database db.DB, dialect db.Dialect) (*IndexModelStore, error) {
+	s := &IndexModelStore{
+		database: database,
+		dialect:  dialect,
+		schema:   db.NewSchemaBuilder(database, dialect),
+	}
+	columns := []db.ColumnDef{
+		{Name: "repo_root", Type: db.ColTypeText, PrimaryKey: true},
+		{Name: "model", Type: db.ColTypeText, Nullable: false},
+		{Name: "dimensions", Type: db.ColTypeInteger, Nullable: false},
+		{Name: "updated_at", Type: db.ColTypeInteger, Nullable: false},
+	}
+	if _, err := database.Exec(dialect.CreateTableSQL("index_models", columns)); err != nil {
+		return nil, fmt.Errorf("creating index_models table: %w", err)
+	}
+	return s, nil
+}
+
+// Get returns the model repoRoot was indexed with, or nil if it has not
+// been recorded.
+func (s *IndexModelStore) Get(repoRoot string) (*IndexModel, error) {
+	query := s.schema.SubstitutePlaceholders(
+		"SELECT model, dimensions, updated_at FROM index_models WHERE repo_root = ?")
+
+	m := IndexModel{RepoRoot: repoRoot}
+	var updatedAt int64
+	err := s.database.QueryRow(query, repoRoot).Scan(&m.Model, &m.Dimensions, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying index model: %w", err)
+	}
+	m.UpdatedAt = time.Unix(updatedAt, 0)
+	return &m, nil
+}
+
+// Set records that repoRoot was indexed with model and dimensions.
+func (s *IndexModelStore) Set(repoRoot, model string, dimensions int) error {
+	upsertSQL := s.dialect.UpsertSQL("index_models", []string{"repo_root", "model", "dimensions", "updated_at"},
+		[]string{"repo_root"}, []string{"model", "dimensions", "updated_at"})
+	if _, err := s.database.Exec(s.schema.SubstitutePlaceholders(upsertSQL),
+		repoRoot, model, dimensions, time.Now().Unix()); err != nil {
+		return fmt.Errorf("recording index model: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package embedding
+
+import (
+	"errors"
+	"testing"
+
+	"codetect/internal/db"
+)
+
+func TestIndexModelStore(t *testing.T) {
+	cfg := db.DefaultConfig(":memory:")
+	database, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	store, err := NewIndexModelStore(database, cfg.Dialect())
+	if err != nil {
+		t.Fatalf("NewIndexModelStore failed: %v", err)
+	}
+	if m, err := store.Get("/project"); m != nil || err != nil {
+		t.Fatalf("Get before Set = %+v, %v; want nil", m, err)
+	}
+
+	if err := store.Set("/project", "nomic-embed-text", 768); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := store.Set("/project", "bge-m3", 1024); err != nil {
+		t.Fatalf("second Set failed: %v", err)
+	}
+	m, err := store.Get("/project")
+	if err != nil || m == nil || m.Model != "bge-m3" || m.Dimensions != 1024 {
+		t.Fatalf("Get = %+v, %v; want bge-m3 with 1024 dimensions", m, err)
+	}
+	if m, _ := store.Get("/other"); m != nil {
+		t.Errorf("Get(/other) = %+v, want nil", m)
+	}
+}
+
+func TestIndexModelCheck(t *testing.T) {
+	indexed := &IndexModel{RepoRoot: "/project", Model: "nomic-embed-text", Dimensions: 768}
+
+	tests := []struct {
+		name       string
+		model      string
+		dimensions int
+		mismatch   bool
+	}{
+		{"same model", "nomic-embed-text", 768, false},
+		{"unknown dimensions", "nomic-embed-text", 0, false},
+		{"other model", "bge-m3", 768, true},
+		{"other dimensions", "nomic-embed-text", 1024, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := indexed.Check(tt.model, tt.dimensions)
+			var mismatch *ModelMismatchError
+			if got := errors.As(err, &mismatch); got != tt.mismatch {
+				t.Fatalf("Check(%q, %d) = %v, want mismatch %v", tt.model, tt.dimensions, err, tt.mismatch)
+			}
+			if tt.mismatch && (mismatch.IndexModel != "nomic-embed-text" || mismatch.QueryModel != tt.model) {
+				t.Errorf("mismatch = %+v", mismatch)
+			}
+		})
+	}
+
+	var unrecorded *IndexModel
+	if err := unrecorded.Check("anything", 3); err != nil {
+		t.Errorf("Check on an unrecorded model = %v, want nil", err)
+	}
+}
@@ -0,0 +1,87 @@
+package embedding
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// RequestStats summarizes the requests sent to the embedding backend, one
+// per batch, to tell a slow backend apart from a large workload.
+type RequestStats struct {
+	Requests       int           `json:"requests"`
+	Duration       time.Duration `json:"duration"`         // Wall time spent embedding
+	RequestsPerSec float64       `json:"requests_per_sec"` // Requests over Duration
+	P50            time.Duration `json:"p50"`
+	P95            time.Duration `json:"p95"`
+	P99            time.Duration `json:"p99"`
+	Max            time.Duration `json:"max"`
+
+	latencies []time.Duration // Sorted, kept for Merge
+}
+
+// newRequestStats summarizes latencies of requests made over wall time.
+// It returns nil when there were no requests.
+func newRequestStats(latencies []time.Duration, wall time.Duration) *RequestStats {
+	if len(latencies) == 0 {
+		return nil
+	}
+	sorted := slices.Clone(latencies)
+	slices.Sort(sorted)
+
+	s := &RequestStats{
+		Requests:  len(sorted),
+		Duration:  wall,
+		P50:       percentile(sorted, 50),
+		P95:       percentile(sorted, 95),
+		P99:       percentile(sorted, 99),
+		Max:       sorted[len(sorted)-1],
+		latencies: sorted,
+	}
+	if wall > 0 {
+		s.RequestsPerSec = float64(s.Requests) / wall.Seconds()
+	}
+	return s
+}
+
+// Merge returns stats covering the requests of s and other, made one after
+// the other. Either may be nil.
+func (s *RequestStats) Merge(other *RequestStats) *RequestStats {
+	if s == nil {
+		return other
+	}
+	if other == nil {
+		return s
+	}
+	return newRequestStats(append(slices.Clone(s.latencies), other.latencies...), s.Duration+other.Duration)
+}
+
+// percentile returns the nearest-rank pth percentile of sorted.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+// latencyRecorder collects request latencies from concurrent batches.
+type latencyRecorder struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+}
+
+// add records one request's latency. A nil recorder discards it.
+func (r *latencyRecorder) add(d time.Duration) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.latencies = append(r.latencies, d)
+	r.mu.Unlock()
+}
+
+// stats summarizes the recorded requests, made over wall time.
+func (r *latencyRecorder) stats(wall time.Duration) *RequestStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return newRequestStats(r.latencies, wall)
+}
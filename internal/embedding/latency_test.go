@@ -0,0 +1,39 @@
+package embedding
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequestStats(t *testing.T) {
+	var latencies []time.Duration
+	for i := 100; i >= 1; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+
+	stats := newRequestStats(latencies, 10*time.Second)
+	if stats.Requests != 100 || stats.RequestsPerSec != 10 {
+		t.Errorf("Requests = %d, RequestsPerSec = %v, want 100 and 10", stats.Requests, stats.RequestsPerSec)
+	}
+	if stats.P50 != 50*time.Millisecond || stats.P95 != 95*time.Millisecond ||
+		stats.P99 != 99*time.Millisecond || stats.Max != 100*time.Millisecond {
+		t.Errorf("percentiles = %v/%v/%v/%v, want 50ms/95ms/99ms/100ms", stats.P50, stats.P95, stats.P99, stats.Max)
+	}
+
+	// Merging covers both sets of requests and their combined wall time
+	other := newRequestStats([]time.Duration{time.Second}, 10*time.Second)
+	merged := stats.Merge(other)
+	if merged.Requests != 101 || merged.Duration != 20*time.Second || merged.Max != time.Second {
+		t.Errorf("merged = %+v", merged)
+	}
+	if stats.Requests != 100 {
+		t.Error("Merge modified its receiver")
+	}
+
+	if newRequestStats(nil, time.Second) != nil {
+		t.Error("stats for no requests should be nil")
+	}
+	if (*RequestStats)(nil).Merge(other) != other {
+		t.Error("nil.Merge(other) should return other")
+	}
+}
@@ -1,7 +1,6 @@
 package embedding
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -25,6 +24,7 @@ type LiteLLMClient struct {
 	dimensions int
 	timeout    time.Duration
 	httpClient *http.Client
+	compressor requestCompressor
 }
 
 // LiteLLMOption configures the LiteLLM client
@@ -65,6 +65,15 @@ func WithLiteLLMTimeout(timeout time.Duration) LiteLLMOption {
 	}
 }
 
+// WithLiteLLMCompression gzips request bodies, for endpoints behind slow
+// links that accept "Content-Encoding: gzip". An endpoint answering 415
+// Unsupported Media Type is sent uncompressed bodies from then on.
+func WithLiteLLMCompression(on bool) LiteLLMOption {
+	return func(c *LiteLLMClient) {
+		c.compressor.setEnabled(on)
+	}
+}
+
 // NewLiteLLMClient creates a new LiteLLM client
 func NewLiteLLMClient(opts ...LiteLLMOption) *LiteLLMClient {
 	c := &LiteLLMClient{
@@ -123,19 +132,13 @@ func (c *LiteLLMClient) Embed(ctx context.Context, texts []string) ([][]float32,
 		return nil, fmt.Errorf("marshaling request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/v1/embeddings", bytes.NewReader(body))
-	if err != nil {
-		return nil, fmt.Errorf("creating request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	if c.apiKey != "" {
-		req.Header.Set("Authorization", "Bearer "+c.apiKey)
-	}
-
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.compressor.post(ctx, c.httpClient, c.baseURL+"/v1/embeddings", body, func(req *http.Request) {
+		if c.apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+c.apiKey)
+		}
+	})
 	if err != nil {
-		return nil, fmt.Errorf("sending request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
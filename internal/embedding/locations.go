@@ -1,8 +1,17 @@
 package embedding
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,7 +22,8 @@ import (
 // Multiple locations can reference the same content hash, enabling
 // deduplication when code is copied, moved, or appears in multiple repos.
 type ChunkLocation struct {
-	ID          int64     `json:"id"`
+	ID          int64     `json:"id"`       // Row ID, reassigned when a file is reindexed
+	ChunkID     string    `json:"chunk_id"` // Stable ID, see ChunkID
 	RepoRoot    string    `json:"repo_root"`
 	Path        string    `json:"path"`
 	StartLine   int       `json:"start_line"`
@@ -23,6 +33,33 @@ type ChunkLocation struct {
 	NodeName    string    `json:"node_name"`    // Symbol name
 	Language    string    `json:"language"`
 	CreatedAt   time.Time `json:"created_at"`
+
+	// Metadata holds arbitrary tags for the chunk, such as an owning team
+	// or build target. It is stored as JSON; see SetIndexedMetadataKeys.
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// QualifiedName is the symbol path of the chunk, such as
+	// "auth.Middleware.Handle", when it was embedded with one. See
+	// Chunk.QualifiedName.
+	QualifiedName string `json:"qualified_name,omitempty"`
+}
+
+// ChunkID returns the stable identifier of a chunk: a SHA-256 over its
+// repository, path, start line and content hash. Unlike the row ID it is
+// the same after a reindex as long as the chunk is unchanged and has not
+// moved, so it can be kept in external references and resolved with
+// LocationStore.GetByChunkID.
+func ChunkID(repoRoot, path string, startLine int, contentHash string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%d\x00%s", repoRoot, path, startLine, contentHash)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// NormalizePath returns a repo-relative path with forward slashes, the form
+// locations store, so an index built on Windows matches one built
+// elsewhere. Methods taking a path accept either separator.
+func NormalizePath(p string) string {
+	return strings.ReplaceAll(p, `\`, "/")
 }
 
 // LocationStore manages chunk locations in the database.
@@ -35,8 +72,20 @@ type LocationStore struct {
 	dialect  db.Dialect
 	schema   *db.SchemaBuilder
 	mu       sync.RWMutex
+
+	// Metadata keys also written to chunk_location_metadata, so filters
+	// on them are answered by an index rather than decoding every row.
+	// Loaded from chunk_location_metadata_keys.
+	indexedKeys []string
+
+	writeBatchSize int // Locations per SaveLocationsBatch transaction
+	writeWorkers   int // Parallel SaveLocationsBatch transactions (PostgreSQL only)
 }
 
+// DefaultLocationBatchSize is the number of locations SaveLocationsBatch
+// commits per transaction when no size is configured.
+const DefaultLocationBatchSize = 5000
+
 // NewLocationStore creates a new location store.
 func NewLocationStore(database db.DB, dialect db.Dialect) (*LocationStore, error) {
 	store := &LocationStore{
@@ -65,6 +114,9 @@ func (s *LocationStore) initSchema() error {
 		{Name: "node_name", Type: db.ColTypeText, Nullable: true},
 		{Name: "language", Type: db.ColTypeText, Nullable: true},
 		{Name: "created_at", Type: db.ColTypeInteger, Nullable: false},
+		{Name: "metadata", Type: db.ColTypeText, Nullable: true},
+		{Name: "chunk_id", Type: db.ColTypeText, Nullable: true},
+		{Name: "qualified_name", Type: db.ColTypeText, Nullable: true},
 	}
 
 	// Create table
@@ -73,6 +125,33 @@ func (s *LocationStore) initSchema() error {
 		return fmt.Errorf("creating chunk_locations table: %w", err)
 	}
 
+	// Tables created before metadata was added lack the column
+	if _, err := s.database.Exec("SELECT metadata FROM chunk_locations WHERE 1 = 0"); err != nil {
+		alterSQL := "ALTER TABLE chunk_locations ADD COLUMN metadata " + s.dialect.TextType()
+		if _, err := s.database.Exec(alterSQL); err != nil {
+			return fmt.Errorf("adding metadata column: %w", err)
+		}
+	}
+
+	// Tables created before chunk IDs were added lack the column
+	if _, err := s.database.Exec("SELECT chunk_id FROM chunk_locations WHERE 1 = 0"); err != nil {
+		alterSQL := "ALTER TABLE chunk_locations ADD COLUMN chunk_id " + s.dialect.TextType()
+		if _, err := s.database.Exec(alterSQL); err != nil {
+			return fmt.Errorf("adding chunk_id column: %w", err)
+		}
+	}
+	if err := s.backfillChunkIDs(); err != nil {
+		return err
+	}
+
+	// Tables created before qualified names were added lack the column
+	if _, err := s.database.Exec("SELECT qualified_name FROM chunk_locations WHERE 1 = 0"); err != nil {
+		alterSQL := "ALTER TABLE chunk_locations ADD COLUMN qualified_name " + s.dialect.TextType()
+		if _, err := s.database.Exec(alterSQL); err != nil {
+			return fmt.Errorf("adding qualified_name column: %w", err)
+		}
+	}
+
 	// Create unique constraint for upserts (repo, path, start, end)
 	idxUnique := s.dialect.CreateIndexSQL("chunk_locations", "idx_chunk_locations_unique",
 		[]string{"repo_root", "path", "start_line", "end_line"}, true)
@@ -101,6 +180,388 @@ func (s *LocationStore) initSchema() error {
 		return fmt.Errorf("creating hash index: %w", err)
 	}
 
+	// Create index for case-insensitive symbol lookups
+	idxSymbol := s.dialect.CreateIndexSQL("chunk_locations", "idx_chunk_locations_symbol_lower",
+		[]string{"repo_root", "LOWER(node_name)"}, false)
+	if _, err := s.database.Exec(idxSymbol); err != nil {
+		return fmt.Errorf("creating symbol index: %w", err)
+	}
+
+	// Create index for resolving stable chunk IDs
+	idxChunkID := s.dialect.CreateIndexSQL("chunk_locations", "idx_chunk_locations_chunk_id",
+		[]string{"chunk_id"}, false)
+	if _, err := s.database.Exec(idxChunkID); err != nil {
+		return fmt.Errorf("creating chunk_id index: %w", err)
+	}
+
+	// Indexed metadata keys, one row per location and key
+	metaColumns := []db.ColumnDef{
+		{Name: "repo_root", Type: db.ColTypeText, Nullable: false},
+		{Name: "path", Type: db.ColTypeText, Nullable: false},
+		{Name: "start_line", Type: db.ColTypeInteger, Nullable: false},
+		{Name: "end_line", Type: db.ColTypeInteger, Nullable: false},
+		{Name: "meta_key", Type: db.ColTypeText, Nullable: false},
+		{Name: "meta_value", Type: db.ColTypeText, Nullable: false},
+	}
+	if _, err := s.database.Exec(s.dialect.CreateTableSQL("chunk_location_metadata", metaColumns)); err != nil {
+		return fmt.Errorf("creating chunk_location_metadata table: %w", err)
+	}
+
+	idxMetaUnique := s.dialect.CreateIndexSQL("chunk_location_metadata", "idx_chunk_location_metadata_unique",
+		[]string{"repo_root", "path", "start_line", "end_line", "meta_key"}, true)
+	if _, err := s.database.Exec(idxMetaUnique); err != nil {
+		return fmt.Errorf("creating metadata unique index: %w", err)
+	}
+
+	idxMetaValue := s.dialect.CreateIndexSQL("chunk_location_metadata", "idx_chunk_location_metadata_value",
+		[]string{"repo_root", "meta_key", "meta_value"}, false)
+	if _, err := s.database.Exec(idxMetaValue); err != nil {
+		return fmt.Errorf("creating metadata value index: %w", err)
+	}
+
+	keyColumns := []db.ColumnDef{
+		{Name: "meta_key", Type: db.ColTypeText, Nullable: false},
+	}
+	if _, err := s.database.Exec(s.dialect.CreateTableSQL("chunk_location_metadata_keys", keyColumns)); err != nil {
+		return fmt.Errorf("creating chunk_location_metadata_keys table: %w", err)
+	}
+
+	idxKeys := s.dialect.CreateIndexSQL("chunk_location_metadata_keys", "idx_chunk_location_metadata_keys",
+		[]string{"meta_key"}, true)
+	if _, err := s.database.Exec(idxKeys); err != nil {
+		return fmt.Errorf("creating metadata keys index: %w", err)
+	}
+
+	if err := s.normalizeStoredPaths(); err != nil {
+		return err
+	}
+
+	return s.loadIndexedMetadataKeys()
+}
+
+// windowsPathsMigration names, in location_migrations, the one-time
+// rewrite of backslash-separated paths recorded on Windows before paths
+// were normalized (see NormalizePath).
+const windowsPathsMigration = "windows_paths"
+
+// normalizeStoredPaths runs the windows_paths migration unless it has
+// already been applied. Backslashes are legal in file names elsewhere, so
+// only repositories rooted at a Windows path are rewritten, or every
+// repository when running on Windows.
+func (s *LocationStore) normalizeStoredPaths() error {
+	columns := []db.ColumnDef{
+		{Name: "name", Type: db.ColTypeText, Nullable: false},
+		{Name: "applied_at", Type: db.ColTypeInteger, Nullable: false},
+	}
+	if _, err := s.database.Exec(s.dialect.CreateTableSQL("location_migrations", columns)); err != nil {
+		return fmt.Errorf("creating location_migrations table: %w", err)
+	}
+	idx := s.dialect.CreateIndexSQL("location_migrations", "idx_location_migrations_name",
+		[]string{"name"}, true)
+	if _, err := s.database.Exec(idx); err != nil {
+		return fmt.Errorf("creating location migrations index: %w", err)
+	}
+
+	var applied int
+	query := s.schema.SubstitutePlaceholders("SELECT COUNT(*) FROM location_migrations WHERE name = ?")
+	if err := s.database.QueryRow(query, windowsPathsMigration).Scan(&applied); err != nil {
+		return fmt.Errorf("checking %s migration: %w", windowsPathsMigration, err)
+	}
+	if applied > 0 {
+		return nil
+	}
+
+	roots, err := s.windowsRepoRoots()
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"chunk_locations", "chunk_location_metadata"} {
+		set := `path = REPLACE(path, '\', '/')`
+		if table == "chunk_locations" {
+			set += ", chunk_id = NULL"
+		}
+		updateSQL := s.schema.SubstitutePlaceholders("UPDATE " + table + " SET " + set +
+			` WHERE repo_root = ? AND path <> REPLACE(path, '\', '/')`)
+		for _, root := range roots {
+			if _, err := s.database.Exec(updateSQL, root); err != nil {
+				return fmt.Errorf("normalizing paths in %s: %w", table, err)
+			}
+		}
+	}
+	if err := s.backfillChunkIDs(); err != nil {
+		return err
+	}
+
+	record := s.schema.SubstitutePlaceholders(s.dialect.UpsertSQL("location_migrations",
+		[]string{"name", "applied_at"}, []string{"name"}, []string{"applied_at"}))
+	if _, err := s.database.Exec(record, windowsPathsMigration, time.Now().Unix()); err != nil {
+		return fmt.Errorf("recording %s migration: %w", windowsPathsMigration, err)
+	}
+	return nil
+}
+
+// windowsRepoRoots returns the repository roots whose stored paths may
+// have been written on Windows.
+func (s *LocationStore) windowsRepoRoots() ([]string, error) {
+	rows, err := s.database.Query(`
+		SELECT repo_root FROM chunk_locations
+		UNION
+		SELECT repo_root FROM chunk_location_metadata
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("querying repository roots: %w", err)
+	}
+	defer rows.Close()
+
+	var roots []string
+	for rows.Next() {
+		var root string
+		if err := rows.Scan(&root); err != nil {
+			return nil, fmt.Errorf("scanning repository root: %w", err)
+		}
+		if runtime.GOOS == "windows" || isWindowsRoot(root) {
+			roots = append(roots, root)
+		}
+	}
+	return roots, rows.Err()
+}
+
+// isWindowsRoot reports whether root is a Windows absolute path, either
+// a drive path such as C:\src or a UNC path such as \\server\share.
+func isWindowsRoot(root string) bool {
+	if strings.HasPrefix(root, `\\`) {
+		return true
+	}
+	if len(root) < 3 || root[1] != ':' || (root[2] != '\\' && root[2] != '/') {
+		return false
+	}
+	c := root[0] | 0x20
+	return c >= 'a' && c <= 'z'
+}
+
+// backfillChunkIDs sets chunk_id on locations written before the column
+// existed.
+func (s *LocationStore) backfillChunkIDs() error {
+	rows, err := s.database.Query(`
+		SELECT id, repo_root, path, start_line, content_hash
+		FROM chunk_locations
+		WHERE chunk_id IS NULL
+	`)
+	if err != nil {
+		return fmt.Errorf("querying locations without chunk_id: %w", err)
+	}
+
+	type pending struct {
+		id      int64
+		chunkID string
+	}
+	var updates []pending
+	for rows.Next() {
+		var id int64
+		var repoRoot, path, contentHash string
+		var startLine int
+		if err := rows.Scan(&id, &repoRoot, &path, &startLine, &contentHash); err != nil {
+			rows.Close()
+			return fmt.Errorf("scanning location: %w", err)
+		}
+		updates = append(updates, pending{id, ChunkID(repoRoot, path, startLine, contentHash)})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("querying locations without chunk_id: %w", err)
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+
+	tx, err := s.database.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	updateSQL := s.schema.SubstitutePlaceholders("UPDATE chunk_locations SET chunk_id = ? WHERE id = ?")
+	for _, u := range updates {
+		if _, err := tx.Exec(updateSQL, u.chunkID, u.id); err != nil {
+			return fmt.Errorf("setting chunk_id: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// SetIndexedMetadataKeys selects the metadata keys kept in an indexed side
+// table, making GetByMetadata filters on them fast in large repositories.
+// Filters on other keys still work but decode every candidate's metadata.
+//
+// The selection is stored in the database and loaded by every
+// LocationStore opened on it, so all writers index the same keys. Existing
+// locations are indexed for newly added keys; index rows for keys no longer
+// selected are dropped.
+func (s *LocationStore) SetIndexedMetadataKeys(keys []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	selected := make(map[string]bool, len(keys))
+	var added []string
+	for _, key := range keys {
+		if key == "" || selected[key] {
+			continue
+		}
+		selected[key] = true
+		if !slices.Contains(s.indexedKeys, key) {
+			added = append(added, key)
+		}
+	}
+	var removed []string
+	for _, key := range s.indexedKeys {
+		if !selected[key] {
+			removed = append(removed, key)
+		}
+	}
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	// Read locations needing backfill before the transaction, which holds
+	// the only connection on SQLite
+	var backfill []ChunkLocation
+	if len(added) > 0 {
+		rows, err := s.database.Query(`
+			SELECT repo_root, path, start_line, end_line, metadata
+			FROM chunk_locations
+			WHERE metadata IS NOT NULL
+		`)
+		if err != nil {
+			return fmt.Errorf("querying metadata: %w", err)
+		}
+		for rows.Next() {
+			var loc ChunkLocation
+			var metadata sql.NullString
+			if err := rows.Scan(&loc.RepoRoot, &loc.Path, &loc.StartLine, &loc.EndLine, &metadata); err != nil {
+				rows.Close()
+				return fmt.Errorf("scanning metadata: %w", err)
+			}
+			loc.Metadata = decodeMetadata(metadata)
+			backfill = append(backfill, loc)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	tx, err := s.database.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	for _, key := range removed {
+		for _, table := range []string{"chunk_location_metadata", "chunk_location_metadata_keys"} {
+			query := s.schema.SubstitutePlaceholders("DELETE FROM " + table + " WHERE meta_key = ?")
+			if _, err := tx.Exec(query, key); err != nil {
+				return fmt.Errorf("dropping metadata index for %q: %w", key, err)
+			}
+		}
+	}
+
+	insertKey := s.schema.SubstitutePlaceholders("INSERT INTO chunk_location_metadata_keys (meta_key) VALUES (?)")
+	insertValue := s.schema.SubstitutePlaceholders(`
+		INSERT INTO chunk_location_metadata (repo_root, path, start_line, end_line, meta_key, meta_value)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`)
+	for _, key := range added {
+		if _, err := tx.Exec(insertKey, key); err != nil {
+			return fmt.Errorf("selecting metadata key %q: %w", key, err)
+		}
+		for _, loc := range backfill {
+			value, ok := loc.Metadata[key]
+			if !ok {
+				continue
+			}
+			if _, err := tx.Exec(insertValue, loc.RepoRoot, loc.Path, loc.StartLine, loc.EndLine, key, value); err != nil {
+				return fmt.Errorf("indexing metadata for %s:%d-%d: %w", loc.Path, loc.StartLine, loc.EndLine, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.indexedKeys = s.indexedKeys[:0]
+	for _, key := range keys {
+		if selected[key] && !slices.Contains(s.indexedKeys, key) {
+			s.indexedKeys = append(s.indexedKeys, key)
+		}
+	}
+	return nil
+}
+
+// IndexedMetadataKeys returns the metadata keys selected for indexing.
+func (s *LocationStore) IndexedMetadataKeys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.indexedKeys...)
+}
+
+// loadIndexedMetadataKeys reads the key selection saved by
+// SetIndexedMetadataKeys.
+func (s *LocationStore) loadIndexedMetadataKeys() error {
+	rows, err := s.database.Query("SELECT meta_key FROM chunk_location_metadata_keys ORDER BY meta_key")
+	if err != nil {
+		return fmt.Errorf("querying metadata keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return fmt.Errorf("scanning metadata key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	s.indexedKeys = keys
+	return nil
+}
+
+// execer is the Exec method shared by db.DB and db.Tx.
+type execer interface {
+	Exec(query string, args ...any) (db.Result, error)
+}
+
+// writeMetadataIndex replaces a location's rows in chunk_location_metadata
+// with its values for the indexed keys. The caller holds s.mu.
+func (s *LocationStore) writeMetadataIndex(ex execer, loc ChunkLocation) error {
+	if len(s.indexedKeys) == 0 {
+		return nil
+	}
+
+	deleteSQL := s.schema.SubstitutePlaceholders(`
+		DELETE FROM chunk_location_metadata
+		WHERE repo_root = ? AND path = ? AND start_line = ? AND end_line = ?
+	`)
+	if _, err := ex.Exec(deleteSQL, loc.RepoRoot, loc.Path, loc.StartLine, loc.EndLine); err != nil {
+		return fmt.Errorf("clearing metadata index for %s:%d-%d: %w", loc.Path, loc.StartLine, loc.EndLine, err)
+	}
+
+	insertSQL := s.schema.SubstitutePlaceholders(`
+		INSERT INTO chunk_location_metadata (repo_root, path, start_line, end_line, meta_key, meta_value)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`)
+	for _, key := range s.indexedKeys {
+		value, ok := loc.Metadata[key]
+		if !ok {
+			continue
+		}
+		if _, err := ex.Exec(insertSQL, loc.RepoRoot, loc.Path, loc.StartLine, loc.EndLine, key, value); err != nil {
+			return fmt.Errorf("indexing metadata for %s:%d-%d: %w", loc.Path, loc.StartLine, loc.EndLine, err)
+		}
+	}
 	return nil
 }
 
@@ -113,25 +574,52 @@ func (s *LocationStore) SaveLocation(loc ChunkLocation) error {
 	if loc.CreatedAt.IsZero() {
 		loc.CreatedAt = time.Now()
 	}
+	loc.Path = NormalizePath(loc.Path)
 
 	// Use upsert for idempotent saves
 	columns := []string{"repo_root", "path", "start_line", "end_line", "content_hash",
-		"node_type", "node_name", "language", "created_at"}
+		"node_type", "node_name", "language", "created_at", "metadata", "chunk_id", "qualified_name"}
 	conflictColumns := []string{"repo_root", "path", "start_line", "end_line"}
-	updateColumns := []string{"content_hash", "node_type", "node_name", "language"}
+	updateColumns := []string{"content_hash", "node_type", "node_name", "language", "metadata", "chunk_id", "qualified_name"}
 
 	upsertSQL := s.dialect.UpsertSQL("chunk_locations", columns, conflictColumns, updateColumns)
 	upsertSQL = s.schema.SubstitutePlaceholders(upsertSQL)
 
-	_, err := s.database.Exec(upsertSQL,
+	metadata, err := encodeMetadata(loc.Metadata)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.database.Exec(upsertSQL,
 		loc.RepoRoot, loc.Path, loc.StartLine, loc.EndLine, loc.ContentHash,
-		nullString(loc.NodeType), nullString(loc.NodeName), nullString(loc.Language), now,
+		nullString(loc.NodeType), nullString(loc.NodeName), nullString(loc.Language), now, metadata,
+		ChunkID(loc.RepoRoot, loc.Path, loc.StartLine, loc.ContentHash), nullString(loc.QualifiedName),
 	)
+	if err != nil {
+		return err
+	}
 
-	return err
+	return s.writeMetadataIndex(s.database, loc)
 }
 
-// SaveLocationsBatch saves multiple locations in a transaction.
+// SetWriteConcurrency sets how SaveLocationsBatch splits large writes:
+// batchSize locations per transaction, with up to workers transactions in
+// flight on PostgreSQL. Zero or negative values keep the defaults
+// (DefaultLocationBatchSize and DefaultWriteWorkers).
+func (s *LocationStore) SetWriteConcurrency(batchSize, workers int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writeBatchSize = batchSize
+	s.writeWorkers = workers
+}
+
+// SaveLocationsBatch saves multiple locations, committing them in
+// transactions of the configured batch size (see SetWriteConcurrency).
+// A batch no larger than that is saved atomically. Larger ones are not: if
+// a transaction fails, the locations of transactions already committed
+// remain saved. Saving is an upsert, so retrying the whole batch, as the
+// next index run does, completes it. With parallel writers, a location
+// listed more than once may keep any of its entries.
 func (s *LocationStore) SaveLocationsBatch(locs []ChunkLocation) error {
 	if len(locs) == 0 {
 		return nil
@@ -140,6 +628,60 @@ func (s *LocationStore) SaveLocationsBatch(locs []ChunkLocation) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	batchSize := s.writeBatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultLocationBatchSize
+	}
+	var batches [][]ChunkLocation
+	for start := 0; start < len(locs); start += batchSize {
+		batches = append(batches, locs[start:min(start+batchSize, len(locs))])
+	}
+
+	now := time.Now().Unix()
+	workers := s.writeWorkers
+	if workers <= 0 {
+		workers = DefaultWriteWorkers
+	}
+	if s.dialect.Name() != "postgres" || len(batches) == 1 {
+		workers = 1
+	}
+
+	if workers == 1 {
+		for _, batch := range batches {
+			if err := s.saveTx(batch, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	errs := make(chan error, len(batches))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+
+	for _, batch := range batches {
+		wg.Add(1)
+		go func(batch []ChunkLocation) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			errs <- s.saveTx(batch, now)
+		}(batch)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveTx upserts locs in one transaction. The caller must hold s.mu.
+func (s *LocationStore) saveTx(locs []ChunkLocation, now int64) error {
 	tx, err := s.database.Begin()
 	if err != nil {
 		return fmt.Errorf("beginning transaction: %w", err)
@@ -147,9 +689,9 @@ func (s *LocationStore) SaveLocationsBatch(locs []ChunkLocation) error {
 	defer tx.Rollback() //nolint:errcheck
 
 	columns := []string{"repo_root", "path", "start_line", "end_line", "content_hash",
-		"node_type", "node_name", "language", "created_at"}
+		"node_type", "node_name", "language", "created_at", "metadata", "chunk_id", "qualified_name"}
 	conflictColumns := []string{"repo_root", "path", "start_line", "end_line"}
-	updateColumns := []string{"content_hash", "node_type", "node_name", "language"}
+	updateColumns := []string{"content_hash", "node_type", "node_name", "language", "metadata", "chunk_id", "qualified_name"}
 
 	upsertSQL := s.dialect.UpsertSQL("chunk_locations", columns, conflictColumns, updateColumns)
 	upsertSQL = s.schema.SubstitutePlaceholders(upsertSQL)
@@ -160,16 +702,24 @@ func (s *LocationStore) SaveLocationsBatch(locs []ChunkLocation) error {
 	}
 	defer stmt.Close()
 
-	now := time.Now().Unix()
 	for _, loc := range locs {
-		_, err := stmt.Exec(
+		loc.Path = NormalizePath(loc.Path)
+		metadata, err := encodeMetadata(loc.Metadata)
+		if err != nil {
+			return err
+		}
+		_, err = stmt.Exec(
 			loc.RepoRoot, loc.Path, loc.StartLine, loc.EndLine, loc.ContentHash,
-			nullString(loc.NodeType), nullString(loc.NodeName), nullString(loc.Language), now,
+			nullString(loc.NodeType), nullString(loc.NodeName), nullString(loc.Language), now, metadata,
+			ChunkID(loc.RepoRoot, loc.Path, loc.StartLine, loc.ContentHash), nullString(loc.QualifiedName),
 		)
 		if err != nil {
 			return fmt.Errorf("inserting location for %s:%d-%d: %w",
 				loc.Path, loc.StartLine, loc.EndLine, err)
 		}
+		if err := s.writeMetadataIndex(tx, loc); err != nil {
+			return err
+		}
 	}
 
 	return tx.Commit()
@@ -177,12 +727,13 @@ func (s *LocationStore) SaveLocationsBatch(locs []ChunkLocation) error {
 
 // GetByPath retrieves all chunk locations for a file.
 func (s *LocationStore) GetByPath(repoRoot, path string) ([]ChunkLocation, error) {
+	path = NormalizePath(path)
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	query := s.schema.SubstitutePlaceholders(`
 		SELECT id, repo_root, path, start_line, end_line, content_hash,
-		       node_type, node_name, language, created_at
+		       node_type, node_name, language, created_at, metadata, chunk_id, qualified_name
 		FROM chunk_locations
 		WHERE repo_root = ? AND path = ?
 		ORDER BY start_line
@@ -204,7 +755,7 @@ func (s *LocationStore) GetByRepo(repoRoot string) ([]ChunkLocation, error) {
 
 	query := s.schema.SubstitutePlaceholders(`
 		SELECT id, repo_root, path, start_line, end_line, content_hash,
-		       node_type, node_name, language, created_at
+		       node_type, node_name, language, created_at, metadata, chunk_id, qualified_name
 		FROM chunk_locations
 		WHERE repo_root = ?
 		ORDER BY path, start_line
@@ -227,7 +778,7 @@ func (s *LocationStore) GetByHash(contentHash string) ([]ChunkLocation, error) {
 
 	query := s.schema.SubstitutePlaceholders(`
 		SELECT id, repo_root, path, start_line, end_line, content_hash,
-		       node_type, node_name, language, created_at
+		       node_type, node_name, language, created_at, metadata, chunk_id, qualified_name
 		FROM chunk_locations
 		WHERE content_hash = ?
 		ORDER BY repo_root, path, start_line
@@ -242,19 +793,267 @@ func (s *LocationStore) GetByHash(contentHash string) ([]ChunkLocation, error) {
 	return scanLocations(rows)
 }
 
+// GetByChunkID resolves a stable chunk ID (see ChunkID) to its location.
+// It returns nil if no indexed chunk has the ID, for example because the
+// chunk was edited or moved since the ID was recorded.
+func (s *LocationStore) GetByChunkID(chunkID string) (*ChunkLocation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := s.schema.SubstitutePlaceholders(`
+		SELECT id, repo_root, path, start_line, end_line, content_hash,
+		       node_type, node_name, language, created_at, metadata, chunk_id, qualified_name
+		FROM chunk_locations
+		WHERE chunk_id = ?
+		ORDER BY id
+	`)
+
+	rows, err := s.database.Query(query, chunkID)
+	if err != nil {
+		return nil, fmt.Errorf("querying locations: %w", err)
+	}
+	defer rows.Close()
+
+	locs, err := scanLocations(rows)
+	if err != nil || len(locs) == 0 {
+		return nil, err
+	}
+	return &locs[0], nil
+}
+
 // DeleteByPath removes all locations for a file.
 // Called when a file is re-indexed or deleted.
 func (s *LocationStore) DeleteByPath(repoRoot, path string) error {
+	path = NormalizePath(path)
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	query := s.schema.SubstitutePlaceholders(
 		"DELETE FROM chunk_locations WHERE repo_root = ? AND path = ?",
 	)
-	_, err := s.database.Exec(query, repoRoot, path)
+	if _, err := s.database.Exec(query, repoRoot, path); err != nil {
+		return err
+	}
+
+	metaQuery := s.schema.SubstitutePlaceholders(
+		"DELETE FROM chunk_location_metadata WHERE repo_root = ? AND path = ?",
+	)
+	_, err := s.database.Exec(metaQuery, repoRoot, path)
 	return err
 }
 
+// DeleteLocations deletes the given locations, matched by repository,
+// path and line range, along with their metadata index entries.
+func (s *LocationStore) DeleteLocations(locs []ChunkLocation) error {
+	if len(locs) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.database.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	for _, table := range []string{"chunk_locations", "chunk_location_metadata"} {
+		query := s.schema.SubstitutePlaceholders(fmt.Sprintf(
+			"DELETE FROM %s WHERE repo_root = ? AND path = ? AND start_line = ? AND end_line = ?", table,
+		))
+		stmt, err := tx.Prepare(query)
+		if err != nil {
+			return fmt.Errorf("preparing statement: %w", err)
+		}
+		for _, loc := range locs {
+			if _, err := stmt.Exec(loc.RepoRoot, NormalizePath(loc.Path), loc.StartLine, loc.EndLine); err != nil {
+				stmt.Close()
+				return fmt.Errorf("deleting location for %s:%d-%d: %w",
+					loc.Path, loc.StartLine, loc.EndLine, err)
+			}
+		}
+		stmt.Close()
+	}
+
+	return tx.Commit()
+}
+
+// RenamePath moves a file's locations from oldPath to newPath, for a file
+// that was moved without changing its content, and returns how many were
+// moved. Content hashes, metadata and creation times are kept and chunk
+// IDs are recomputed for the new path; locations already recorded at
+// newPath are replaced. The rows are re-inserted rather than updated so
+// that Version changes and cached search results see the new path.
+func (s *LocationStore) RenamePath(repoRoot, oldPath, newPath string) (int, error) {
+	oldPath = NormalizePath(oldPath)
+	newPath = NormalizePath(newPath)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.database.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	type row struct {
+		startLine, endLine int
+		contentHash        string
+		nodeType, nodeName sql.NullString
+		language, metadata sql.NullString
+		qualifiedName      sql.NullString
+		createdAt          int64
+	}
+	rows, err := tx.Query(s.schema.SubstitutePlaceholders(`
+		SELECT start_line, end_line, content_hash, node_type, node_name, language, created_at, metadata,
+		       qualified_name
+		FROM chunk_locations
+		WHERE repo_root = ? AND path = ?
+	`), repoRoot, oldPath)
+	if err != nil {
+		return 0, fmt.Errorf("querying locations: %w", err)
+	}
+	var moved []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.startLine, &r.endLine, &r.contentHash, &r.nodeType, &r.nodeName,
+			&r.language, &r.createdAt, &r.metadata, &r.qualifiedName); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scanning location: %w", err)
+		}
+		moved = append(moved, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("querying locations: %w", err)
+	}
+
+	for _, table := range []string{"chunk_locations", "chunk_location_metadata"} {
+		deleteSQL := s.schema.SubstitutePlaceholders("DELETE FROM " + table + " WHERE repo_root = ? AND path = ?")
+		if _, err := tx.Exec(deleteSQL, repoRoot, newPath); err != nil {
+			return 0, fmt.Errorf("clearing %s: %w", newPath, err)
+		}
+	}
+	deleteSQL := s.schema.SubstitutePlaceholders("DELETE FROM chunk_locations WHERE repo_root = ? AND path = ?")
+	if _, err := tx.Exec(deleteSQL, repoRoot, oldPath); err != nil {
+		return 0, fmt.Errorf("removing %s: %w", oldPath, err)
+	}
+
+	insertSQL := s.schema.SubstitutePlaceholders(`
+		INSERT INTO chunk_locations (repo_root, path, start_line, end_line, content_hash,
+			node_type, node_name, language, created_at, metadata, chunk_id, qualified_name)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	for _, r := range moved {
+		if _, err := tx.Exec(insertSQL, repoRoot, newPath, r.startLine, r.endLine, r.contentHash,
+			r.nodeType, r.nodeName, r.language, r.createdAt, r.metadata,
+			ChunkID(repoRoot, newPath, r.startLine, r.contentHash), r.qualifiedName); err != nil {
+			return 0, fmt.Errorf("inserting location for %s:%d-%d: %w", newPath, r.startLine, r.endLine, err)
+		}
+	}
+
+	metaSQL := s.schema.SubstitutePlaceholders(
+		"UPDATE chunk_location_metadata SET path = ? WHERE repo_root = ? AND path = ?",
+	)
+	if _, err := tx.Exec(metaSQL, newPath, repoRoot, oldPath); err != nil {
+		return 0, fmt.Errorf("moving metadata index: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(moved), nil
+}
+
+// RelocateRepo moves all of a repository's locations from oldRoot to
+// newRoot, for an index copied to another checkout, and returns how many
+// were moved. Chunk IDs are recomputed for the new root. newRoot must not
+// have locations of its own.
+func (s *LocationStore) RelocateRepo(oldRoot, newRoot string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.database.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var existing int
+	countSQL := s.schema.SubstitutePlaceholders("SELECT COUNT(*) FROM chunk_locations WHERE repo_root = ?")
+	if err := tx.QueryRow(countSQL, newRoot).Scan(&existing); err != nil {
+		return 0, fmt.Errorf("counting locations: %w", err)
+	}
+	if existing > 0 {
+		return 0, fmt.Errorf("%s already has %d locations", newRoot, existing)
+	}
+
+	type pending struct {
+		id      int64
+		chunkID string
+	}
+	rows, err := tx.Query(s.schema.SubstitutePlaceholders(
+		"SELECT id, path, start_line, content_hash FROM chunk_locations WHERE repo_root = ?",
+	), oldRoot)
+	if err != nil {
+		return 0, fmt.Errorf("querying locations: %w", err)
+	}
+	var updates []pending
+	for rows.Next() {
+		var id int64
+		var path, contentHash string
+		var startLine int
+		if err := rows.Scan(&id, &path, &startLine, &contentHash); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scanning location: %w", err)
+		}
+		updates = append(updates, pending{id, ChunkID(newRoot, path, startLine, contentHash)})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("querying locations: %w", err)
+	}
+
+	updateSQL := s.schema.SubstitutePlaceholders("UPDATE chunk_locations SET repo_root = ?, chunk_id = ? WHERE id = ?")
+	for _, u := range updates {
+		if _, err := tx.Exec(updateSQL, newRoot, u.chunkID, u.id); err != nil {
+			return 0, fmt.Errorf("relocating location: %w", err)
+		}
+	}
+	metaSQL := s.schema.SubstitutePlaceholders("UPDATE chunk_location_metadata SET repo_root = ? WHERE repo_root = ?")
+	if _, err := tx.Exec(metaSQL, newRoot, oldRoot); err != nil {
+		return 0, fmt.Errorf("relocating metadata index: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(updates), nil
+}
+
+// Repos returns the repository roots that have locations, sorted.
+func (s *LocationStore) Repos() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.database.Query("SELECT DISTINCT repo_root FROM chunk_locations ORDER BY repo_root")
+	if err != nil {
+		return nil, fmt.Errorf("querying repos: %w", err)
+	}
+	defer rows.Close()
+
+	var repos []string
+	for rows.Next() {
+		var repo string
+		if err := rows.Scan(&repo); err != nil {
+			return nil, fmt.Errorf("scanning repo: %w", err)
+		}
+		repos = append(repos, repo)
+	}
+	return repos, rows.Err()
+}
+
 // DeleteByRepo removes all locations for a repository.
 func (s *LocationStore) DeleteByRepo(repoRoot string) error {
 	s.mu.Lock()
@@ -263,7 +1062,14 @@ func (s *LocationStore) DeleteByRepo(repoRoot string) error {
 	query := s.schema.SubstitutePlaceholders(
 		"DELETE FROM chunk_locations WHERE repo_root = ?",
 	)
-	_, err := s.database.Exec(query, repoRoot)
+	if _, err := s.database.Exec(query, repoRoot); err != nil {
+		return err
+	}
+
+	metaQuery := s.schema.SubstitutePlaceholders(
+		"DELETE FROM chunk_location_metadata WHERE repo_root = ?",
+	)
+	_, err := s.database.Exec(metaQuery, repoRoot)
 	return err
 }
 
@@ -297,6 +1103,7 @@ func (s *LocationStore) GetHashesForRepo(repoRoot string) ([]string, error) {
 
 // GetHashesForPath returns all content hashes used in a file.
 func (s *LocationStore) GetHashesForPath(repoRoot, path string) ([]string, error) {
+	path = NormalizePath(path)
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -337,8 +1144,27 @@ func (s *LocationStore) CountByRepo(repoRoot string) (int, error) {
 	return count, err
 }
 
+// Version returns a token that changes whenever a repository's locations
+// are added, removed or replaced. It is cheap enough to check before every
+// search and works across processes, since it is derived from the table.
+func (s *LocationStore) Version(repoRoot string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := s.schema.SubstitutePlaceholders(
+		"SELECT COUNT(*), COALESCE(MAX(id), 0) FROM chunk_locations WHERE repo_root = ?",
+	)
+
+	var count, maxID int64
+	if err := s.database.QueryRow(query, repoRoot).Scan(&count, &maxID); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d:%d", count, maxID), nil
+}
+
 // CountByPath returns the number of chunk locations in a file.
 func (s *LocationStore) CountByPath(repoRoot, path string) (int, error) {
+	path = NormalizePath(path)
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -351,48 +1177,77 @@ func (s *LocationStore) CountByPath(repoRoot, path string) (int, error) {
 	return count, err
 }
 
-// GetOrphanedHashes returns content hashes that are no longer referenced
-// by any location. These embeddings can be safely deleted from the cache.
-func (s *LocationStore) GetOrphanedHashes(allCacheHashes []string) ([]string, error) {
-	if len(allCacheHashes) == 0 {
+// GetOrphanedHashes returns those of hashes, in order, that no location in
+// any repository references; the embeddings cached under them can be
+// safely deleted. Each call is one query, so callers pass cache hashes in
+// batches (see Pipeline.CleanupOrphanedEmbeddings).
+func (s *LocationStore) GetOrphanedHashes(hashes []string) ([]string, error) {
+	if len(hashes) == 0 {
 		return nil, nil
 	}
 
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	// Get all referenced hashes from chunk_locations
-	referencedQuery := "SELECT DISTINCT content_hash FROM chunk_locations"
-	rows, err := s.database.Query(referencedQuery)
+	query := s.schema.SubstitutePlaceholders(fmt.Sprintf(
+		"SELECT DISTINCT content_hash FROM chunk_locations WHERE content_hash IN (%s)",
+		strings.TrimSuffix(strings.Repeat("?, ", len(hashes)), ", "),
+	))
+	args := make([]any, len(hashes))
+	for i, hash := range hashes {
+		args[i] = hash
+	}
+	rows, err := s.database.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("querying referenced hashes: %w", err)
 	}
 	defer rows.Close()
 
-	referenced := make(map[string]bool)
+	referenced := make(map[string]bool, len(hashes))
 	for rows.Next() {
 		var hash string
 		if err := rows.Scan(&hash); err != nil {
-			continue
+			return nil, fmt.Errorf("scanning hash: %w", err)
 		}
 		referenced[hash] = true
 	}
-
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	// Find orphaned hashes
 	var orphaned []string
-	for _, hash := range allCacheHashes {
+	for _, hash := range hashes {
 		if !referenced[hash] {
 			orphaned = append(orphaned, hash)
 		}
 	}
-
 	return orphaned, nil
 }
 
+// ReferencedHashes returns the content hashes referenced by a location in
+// any repository.
+func (s *LocationStore) ReferencedHashes() (map[string]bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.database.Query("SELECT DISTINCT content_hash FROM chunk_locations")
+	if err != nil {
+		return nil, fmt.Errorf("querying referenced hashes: %w", err)
+	}
+	defer rows.Close()
+
+	referenced := make(map[string]bool)
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			continue
+		}
+		referenced[hash] = true
+	}
+
+	return referenced, rows.Err()
+}
+
 // ListPaths returns all unique file paths in a repository.
 func (s *LocationStore) ListPaths(repoRoot string) ([]string, error) {
 	s.mu.RLock()
@@ -424,14 +1279,32 @@ func (s *LocationStore) ListPaths(repoRoot string) ([]string, error) {
 
 // GetLocationsBySymbol finds chunks by symbol name (function name, class name, etc.)
 func (s *LocationStore) GetLocationsBySymbol(repoRoot, nodeName string) ([]ChunkLocation, error) {
+	return s.GetLocationsBySymbolWithOptions(repoRoot, nodeName, SymbolLookupOptions{})
+}
+
+// SymbolLookupOptions configures GetLocationsBySymbolWithOptions.
+type SymbolLookupOptions struct {
+	// IgnoreCase matches names regardless of case, so "greet" finds
+	// "Greet". SQLite folds ASCII letters only.
+	IgnoreCase bool
+}
+
+// GetLocationsBySymbolWithOptions finds chunks by symbol name. Exact
+// matching is case-sensitive; see SymbolLookupOptions.IgnoreCase.
+func (s *LocationStore) GetLocationsBySymbolWithOptions(repoRoot, nodeName string, opts SymbolLookupOptions) ([]ChunkLocation, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	// The LOWER form matches idx_chunk_locations_symbol_lower
+	match := "node_name = ?"
+	if opts.IgnoreCase {
+		match = "LOWER(node_name) = LOWER(?)"
+	}
 	query := s.schema.SubstitutePlaceholders(`
 		SELECT id, repo_root, path, start_line, end_line, content_hash,
-		       node_type, node_name, language, created_at
+		       node_type, node_name, language, created_at, metadata, chunk_id, qualified_name
 		FROM chunk_locations
-		WHERE repo_root = ? AND node_name = ?
+		WHERE repo_root = ? AND ` + match + `
 		ORDER BY path, start_line
 	`)
 
@@ -451,7 +1324,7 @@ func (s *LocationStore) GetLocationsByType(repoRoot, nodeType string) ([]ChunkLo
 
 	query := s.schema.SubstitutePlaceholders(`
 		SELECT id, repo_root, path, start_line, end_line, content_hash,
-		       node_type, node_name, language, created_at
+		       node_type, node_name, language, created_at, metadata, chunk_id, qualified_name
 		FROM chunk_locations
 		WHERE repo_root = ? AND node_type = ?
 		ORDER BY path, start_line
@@ -466,6 +1339,73 @@ func (s *LocationStore) GetLocationsByType(repoRoot, nodeType string) ([]ChunkLo
 	return scanLocations(rows)
 }
 
+// GetByMetadata finds a repository's chunks whose metadata contains every
+// key-value pair in filter. Keys selected with SetIndexedMetadataKeys are
+// matched through the metadata index; the rest are checked per row. An
+// empty filter returns the same locations as GetByRepo.
+func (s *LocationStore) GetByMetadata(repoRoot string, filter map[string]string) ([]ChunkLocation, error) {
+	if len(filter) == 0 {
+		return s.GetByRepo(repoRoot)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Sorted so the same filter always builds the same query
+	keys := make([]string, 0, len(filter))
+	for key := range filter {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	indexed := make(map[string]bool, len(s.indexedKeys))
+	for _, key := range s.indexedKeys {
+		indexed[key] = true
+	}
+
+	var sb strings.Builder
+	sb.WriteString(`
+		SELECT id, repo_root, path, start_line, end_line, content_hash,
+		       node_type, node_name, language, created_at, metadata, chunk_id, qualified_name
+		FROM chunk_locations l
+		WHERE repo_root = ? AND metadata IS NOT NULL`)
+	args := []any{repoRoot}
+	for _, key := range keys {
+		if !indexed[key] {
+			continue
+		}
+		sb.WriteString(`
+		  AND EXISTS (
+		      SELECT 1 FROM chunk_location_metadata m
+		      WHERE m.repo_root = l.repo_root AND m.path = l.path
+		        AND m.start_line = l.start_line AND m.end_line = l.end_line
+		        AND m.meta_key = ? AND m.meta_value = ?)`)
+		args = append(args, key, filter[key])
+	}
+	sb.WriteString(`
+		ORDER BY path, start_line`)
+
+	rows, err := s.database.Query(s.schema.SubstitutePlaceholders(sb.String()), args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying locations: %w", err)
+	}
+	defer rows.Close()
+
+	locs, err := scanLocations(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// Confirm every pair, including indexed ones, against the stored JSON
+	matched := locs[:0]
+	for _, loc := range locs {
+		if MatchesMetadata(loc, filter) {
+			matched = append(matched, loc)
+		}
+	}
+	return matched, nil
+}
+
 // scanLocations scans rows into ChunkLocation structs.
 func scanLocations(rows db.Rows) ([]ChunkLocation, error) {
 	var locations []ChunkLocation
@@ -473,11 +1413,12 @@ func scanLocations(rows db.Rows) ([]ChunkLocation, error) {
 	for rows.Next() {
 		var loc ChunkLocation
 		var createdAt int64
-		var nodeType, nodeName, language sql.NullString
+		var nodeType, nodeName, language, metadata, chunkID, qualifiedName sql.NullString
 
 		err := rows.Scan(
 			&loc.ID, &loc.RepoRoot, &loc.Path, &loc.StartLine, &loc.EndLine,
-			&loc.ContentHash, &nodeType, &nodeName, &language, &createdAt,
+			&loc.ContentHash, &nodeType, &nodeName, &language, &createdAt, &metadata, &chunkID,
+			&qualifiedName,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("scanning location: %w", err)
@@ -487,6 +1428,12 @@ func scanLocations(rows db.Rows) ([]ChunkLocation, error) {
 		loc.NodeName = nodeName.String
 		loc.Language = language.String
 		loc.CreatedAt = time.Unix(createdAt, 0)
+		loc.Metadata = decodeMetadata(metadata)
+		loc.QualifiedName = qualifiedName.String
+		loc.ChunkID = chunkID.String
+		if loc.ChunkID == "" {
+			loc.ChunkID = ChunkID(loc.RepoRoot, loc.Path, loc.StartLine, loc.ContentHash)
+		}
 
 		locations = append(locations, loc)
 	}
@@ -494,6 +1441,41 @@ func scanLocations(rows db.Rows) ([]ChunkLocation, error) {
 	return locations, rows.Err()
 }
 
+// encodeMetadata converts metadata to JSON, or NULL when empty.
+func encodeMetadata(metadata map[string]string) (interface{}, error) {
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("encoding metadata: %w", err)
+	}
+	return string(data), nil
+}
+
+// decodeMetadata parses a metadata column. Unreadable values are treated
+// as no metadata.
+func decodeMetadata(s sql.NullString) map[string]string {
+	if !s.Valid || s.String == "" {
+		return nil
+	}
+	var metadata map[string]string
+	if err := json.Unmarshal([]byte(s.String), &metadata); err != nil {
+		return nil
+	}
+	return metadata
+}
+
+// MatchesMetadata reports whether loc has every key-value pair in filter.
+func MatchesMetadata(loc ChunkLocation, filter map[string]string) bool {
+	for key, value := range filter {
+		if v, ok := loc.Metadata[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
 // nullString converts an empty string to NULL for database storage.
 func nullString(s string) interface{} {
 	if s == "" {
@@ -582,3 +1564,171 @@ func (s *LocationStore) Stats(repoRoot string) (*LocationStats, error) {
 
 	return stats, nil
 }
+
+// FileStats summarizes the chunks recorded for one file.
+type FileStats struct {
+	Path     string `json:"path"`
+	Chunks   int    `json:"chunks"`
+	Lines    int    `json:"lines"` // Last line covered by a chunk
+	Language string `json:"language,omitempty"`
+}
+
+// FileStats returns per-file chunk counts for a repository, ordered by path.
+// File-level embedding entries are not counted as chunks.
+func (s *LocationStore) FileStats(repoRoot string) ([]FileStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := s.schema.SubstitutePlaceholders(`
+		SELECT path,
+		       SUM(CASE WHEN node_type = 'file' THEN 0 ELSE 1 END),
+		       MAX(end_line),
+		       COALESCE(MAX(language), '')
+		FROM chunk_locations
+		WHERE repo_root = ?
+		GROUP BY path
+		ORDER BY path
+	`)
+
+	rows, err := s.database.Query(query, repoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("querying file stats: %w", err)
+	}
+	defer rows.Close()
+
+	var files []FileStats
+	for rows.Next() {
+		var fs FileStats
+		if err := rows.Scan(&fs.Path, &fs.Chunks, &fs.Lines, &fs.Language); err != nil {
+			return nil, fmt.Errorf("scanning file stats: %w", err)
+		}
+		files = append(files, fs)
+	}
+
+	return files, rows.Err()
+}
+
+// DirectoryStats summarizes the indexed files under one directory.
+type DirectoryStats struct {
+	Dir    string `json:"dir"`
+	Files  int    `json:"files"`
+	Chunks int    `json:"chunks"`
+	Lines  int    `json:"lines"`
+}
+
+// StatsByDirectory groups FileStats by directory, truncated to the first
+// depth path components (depth 1 gives top-level directories). Files at the
+// repository root are grouped under ".". Results are ordered by file count,
+// largest first.
+func (s *LocationStore) StatsByDirectory(repoRoot string, depth int) ([]DirectoryStats, error) {
+	files, err := s.FileStats(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	if depth < 1 {
+		depth = 1
+	}
+
+	byDir := make(map[string]*DirectoryStats)
+	var dirs []*DirectoryStats
+	for _, f := range files {
+		dir := path.Dir(filepath.ToSlash(f.Path))
+		if parts := strings.Split(dir, "/"); len(parts) > depth {
+			dir = strings.Join(parts[:depth], "/")
+		}
+
+		ds := byDir[dir]
+		if ds == nil {
+			ds = &DirectoryStats{Dir: dir}
+			byDir[dir] = ds
+			dirs = append(dirs, ds)
+		}
+		ds.Files++
+		ds.Chunks += f.Chunks
+		ds.Lines += f.Lines
+	}
+
+	sort.SliceStable(dirs, func(i, j int) bool {
+		return dirs[i].Files > dirs[j].Files
+	})
+
+	result := make([]DirectoryStats, len(dirs))
+	for i, ds := range dirs {
+		result[i] = *ds
+	}
+	return result, nil
+}
+
+// DuplicateExamples is the number of example locations TopDuplicated
+// returns per content hash.
+const DuplicateExamples = 3
+
+// DuplicatedChunk is a chunk content found at several locations.
+type DuplicatedChunk struct {
+	ContentHash string          `json:"content_hash"`
+	Count       int             `json:"count"`    // Locations holding the content
+	Examples    []ChunkLocation `json:"examples"` // The first DuplicateExamples, by path
+}
+
+// TopDuplicated returns the n chunk contents of a repository found at the
+// most locations, most duplicated first, with ties broken by hash. Only
+// contents at two or more locations are returned, and file-level embedding
+// entries are not counted.
+func (s *LocationStore) TopDuplicated(repoRoot string, n int) ([]DuplicatedChunk, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := s.schema.SubstitutePlaceholders(`
+		SELECT content_hash, COUNT(*) AS occurrences
+		FROM chunk_locations
+		WHERE repo_root = ? AND (node_type IS NULL OR node_type <> 'file')
+		GROUP BY content_hash
+		HAVING COUNT(*) > 1
+		ORDER BY occurrences DESC, content_hash
+		LIMIT ?
+	`)
+	rows, err := s.database.Query(query, repoRoot, n)
+	if err != nil {
+		return nil, fmt.Errorf("querying duplicated chunks: %w", err)
+	}
+	var dups []DuplicatedChunk
+	for rows.Next() {
+		var dup DuplicatedChunk
+		if err := rows.Scan(&dup.ContentHash, &dup.Count); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scanning duplicated chunk: %w", err)
+		}
+		dups = append(dups, dup)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	exampleQuery := s.schema.SubstitutePlaceholders(`
+		SELECT id, repo_root, path, start_line, end_line, content_hash,
+		       node_type, node_name, language, created_at, metadata, chunk_id, qualified_name
+		FROM chunk_locations
+		WHERE repo_root = ? AND content_hash = ? AND (node_type IS NULL OR node_type <> 'file')
+		ORDER BY path, start_line
+		LIMIT ?
+	`)
+	for i := range dups {
+		rows, err := s.database.Query(exampleQuery, repoRoot, dups[i].ContentHash, DuplicateExamples)
+		if err != nil {
+			return nil, fmt.Errorf("querying duplicate locations: %w", err)
+		}
+		dups[i].Examples, err = scanLocations(rows)
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return dups, nil
+}
@@ -1,6 +1,12 @@
 package embedding
 
 import (
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -244,6 +250,67 @@ func TestDeleteByPath(t *testing.T) {
 	}
 }
 
+func TestRenamePath(t *testing.T) {
+	store := setupTestLocationStore(t)
+	if err := store.SetIndexedMetadataKeys([]string{"team"}); err != nil {
+		t.Fatalf("SetIndexedMetadataKeys failed: %v", err)
+	}
+
+	team := map[string]string{"team": "billing"}
+	store.SaveLocationsBatch([]ChunkLocation{
+		{RepoRoot: "/project", Path: "old.go", StartLine: 1, EndLine: 10, ContentHash: "h1", NodeName: "A", Metadata: team},
+		{RepoRoot: "/project", Path: "old.go", StartLine: 12, EndLine: 20, ContentHash: "h2", Metadata: team},
+		{RepoRoot: "/project", Path: "new.go", StartLine: 1, EndLine: 3, ContentHash: "stale"},
+	})
+	if _, err := store.database.Exec("UPDATE chunk_locations SET created_at = 1000"); err != nil {
+		t.Fatalf("backdating locations: %v", err)
+	}
+	before, _ := store.Version("/project")
+
+	n, err := store.RenamePath("/project", "old.go", "new.go")
+	if err != nil {
+		t.Fatalf("RenamePath failed: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("RenamePath moved %d locations, want 2", n)
+	}
+
+	if old, _ := store.GetByPath("/project", "old.go"); len(old) != 0 {
+		t.Errorf("old.go still has %d locations", len(old))
+	}
+	locs, _ := store.GetByPath("/project", "new.go")
+	if len(locs) != 2 {
+		t.Fatalf("new.go has %d locations, want 2 with the stale one replaced", len(locs))
+	}
+	for _, loc := range locs {
+		if loc.CreatedAt.Unix() != 1000 {
+			t.Errorf("%s:%d CreatedAt = %v, want it kept", loc.Path, loc.StartLine, loc.CreatedAt)
+		}
+		if loc.ChunkID != ChunkID("/project", "new.go", loc.StartLine, loc.ContentHash) {
+			t.Errorf("%s:%d ChunkID not recomputed for the new path", loc.Path, loc.StartLine)
+		}
+		if loc.Metadata["team"] != "billing" {
+			t.Errorf("%s:%d Metadata = %v", loc.Path, loc.StartLine, loc.Metadata)
+		}
+	}
+	if locs[0].NodeName != "A" || locs[0].ContentHash != "h1" {
+		t.Errorf("first location = %+v", locs[0])
+	}
+
+	// Indexed metadata follows the move
+	matched, err := store.GetByMetadata("/project", team)
+	if err != nil {
+		t.Fatalf("GetByMetadata failed: %v", err)
+	}
+	if len(matched) != 2 || matched[0].Path != "new.go" {
+		t.Errorf("GetByMetadata = %+v, want the 2 moved locations", matched)
+	}
+
+	if after, _ := store.Version("/project"); after == before {
+		t.Error("Version unchanged after RenamePath")
+	}
+}
+
 func TestDeleteByRepo(t *testing.T) {
 	store := setupTestLocationStore(t)
 
@@ -407,6 +474,60 @@ func TestGetLocationsBySymbol(t *testing.T) {
 	}
 }
 
+func TestGetLocationsBySymbolIgnoreCase(t *testing.T) {
+	store := setupTestLocationStore(t)
+	store.SaveLocationsBatch([]ChunkLocation{
+		{RepoRoot: "/project", Path: "a.go", StartLine: 1, EndLine: 5, ContentHash: "h1", NodeName: "Greet"},
+		{RepoRoot: "/project", Path: "b.py", StartLine: 1, EndLine: 5, ContentHash: "h2", NodeName: "greet"},
+		{RepoRoot: "/project", Path: "c.go", StartLine: 1, EndLine: 5, ContentHash: "h3", NodeName: "Greeter"},
+		{RepoRoot: "/other", Path: "d.go", StartLine: 1, EndLine: 5, ContentHash: "h4", NodeName: "GREET"},
+	})
+
+	names := func(locs []ChunkLocation) []string {
+		var got []string
+		for _, loc := range locs {
+			got = append(got, loc.NodeName)
+		}
+		return got
+	}
+
+	exact, err := store.GetLocationsBySymbolWithOptions("/project", "greet", SymbolLookupOptions{})
+	if err != nil {
+		t.Fatalf("GetLocationsBySymbolWithOptions failed: %v", err)
+	}
+	if got := names(exact); len(got) != 1 || got[0] != "greet" {
+		t.Errorf("exact lookup of greet = %v, want [greet]", got)
+	}
+
+	folded, err := store.GetLocationsBySymbolWithOptions("/project", "GREET", SymbolLookupOptions{IgnoreCase: true})
+	if err != nil {
+		t.Fatalf("GetLocationsBySymbolWithOptions failed: %v", err)
+	}
+	if got := names(folded); len(got) != 2 || got[0] != "Greet" || got[1] != "greet" {
+		t.Errorf("case-insensitive lookup of GREET = %v, want [Greet greet]", got)
+	}
+
+	// The lookup is answered by the expression index
+	rows, err := store.database.Query(`EXPLAIN QUERY PLAN
+		SELECT id FROM chunk_locations WHERE repo_root = ? AND LOWER(node_name) = LOWER(?)`, "/project", "greet")
+	if err != nil {
+		t.Fatalf("EXPLAIN failed: %v", err)
+	}
+	defer rows.Close()
+	var plan strings.Builder
+	for rows.Next() {
+		var id, parent, notused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notused, &detail); err != nil {
+			t.Fatalf("scanning plan: %v", err)
+		}
+		plan.WriteString(detail + "\n")
+	}
+	if !strings.Contains(plan.String(), "idx_chunk_locations_symbol_lower") {
+		t.Errorf("query plan does not use the symbol index:\n%s", plan.String())
+	}
+}
+
 func TestGetLocationsByType(t *testing.T) {
 	store := setupTestLocationStore(t)
 
@@ -594,3 +715,678 @@ func TestBatchPerformance(t *testing.T) {
 		t.Errorf("expected 1000 locations, got %d", count)
 	}
 }
+
+func TestSaveLocationsBatchChunked(t *testing.T) {
+	store := setupTestLocationStore(t)
+	if err := store.SetIndexedMetadataKeys([]string{"team"}); err != nil {
+		t.Fatalf("SetIndexedMetadataKeys failed: %v", err)
+	}
+	store.SetWriteConcurrency(7, 3) // Workers are ignored on SQLite
+
+	verifySaveLocationsBatch(t, store, "/project", 50)
+}
+
+func TestSaveLocationsBatchParallelPostgres(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN not set, skipping PostgreSQL location test")
+	}
+
+	cfg := db.PostgresConfig(dsn)
+	database, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("opening PostgreSQL: %v", err)
+	}
+	defer database.Close()
+
+	store, err := NewLocationStore(database, db.GetDialect(db.DatabasePostgres))
+	if err != nil {
+		t.Fatalf("creating location store: %v", err)
+	}
+	repoRoot := fmt.Sprintf("/save-batch-test-%d", time.Now().UnixNano())
+	defer store.DeleteByRepo(repoRoot) //nolint:errcheck
+
+	store.SetWriteConcurrency(16, 4)
+	verifySaveLocationsBatch(t, store, repoRoot, 200)
+}
+
+// verifySaveLocationsBatch saves n locations in one SaveLocationsBatch and
+// checks every one was persisted with its own content hash and metadata.
+func verifySaveLocationsBatch(t *testing.T, store *LocationStore, repoRoot string, n int) {
+	t.Helper()
+
+	locs := make([]ChunkLocation, n)
+	for i := range locs {
+		locs[i] = ChunkLocation{
+			RepoRoot:    repoRoot,
+			Path:        fmt.Sprintf("pkg%d/file.go", i%5),
+			StartLine:   i * 10,
+			EndLine:     i*10 + 9,
+			ContentHash: HashContent(fmt.Sprintf("chunk %d", i)),
+			Metadata:    map[string]string{"team": fmt.Sprintf("team%d", i%2)},
+		}
+	}
+	if err := store.SaveLocationsBatch(locs); err != nil {
+		t.Fatalf("SaveLocationsBatch failed: %v", err)
+	}
+
+	saved, err := store.GetByRepo(repoRoot)
+	if err != nil {
+		t.Fatalf("GetByRepo failed: %v", err)
+	}
+	if len(saved) != n {
+		t.Fatalf("persisted %d of %d locations", len(saved), n)
+	}
+	want := make(map[string]string, n)
+	for _, loc := range locs {
+		want[fmt.Sprintf("%s:%d", loc.Path, loc.StartLine)] = loc.ContentHash
+	}
+	for _, loc := range saved {
+		if hash := want[fmt.Sprintf("%s:%d", loc.Path, loc.StartLine)]; loc.ContentHash != hash {
+			t.Errorf("location %s:%d has hash %s, want %s", loc.Path, loc.StartLine, loc.ContentHash, hash)
+		}
+	}
+
+	team0, err := store.GetByMetadata(repoRoot, map[string]string{"team": "team0"})
+	if err != nil {
+		t.Fatalf("GetByMetadata failed: %v", err)
+	}
+	if len(team0) != n/2 {
+		t.Errorf("got %d locations for team0, want %d", len(team0), n/2)
+	}
+}
+
+func BenchmarkSaveLocationsBatch(b *testing.B) {
+	locs := make([]ChunkLocation, 20000)
+	for i := range locs {
+		locs[i] = ChunkLocation{
+			RepoRoot:    "/project",
+			Path:        fmt.Sprintf("pkg%d/file.go", i%100),
+			StartLine:   i * 10,
+			EndLine:     i*10 + 9,
+			ContentHash: HashContent(fmt.Sprintf("bench chunk %d", i)),
+		}
+	}
+
+	for _, size := range []int{1000, DefaultLocationBatchSize, len(locs)} {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			cfg := db.DefaultConfig(":memory:")
+			database, err := db.Open(cfg)
+			if err != nil {
+				b.Fatalf("opening database: %v", err)
+			}
+			defer database.Close()
+
+			store, err := NewLocationStore(database, cfg.Dialect())
+			if err != nil {
+				b.Fatalf("creating location store: %v", err)
+			}
+			store.SetWriteConcurrency(size, 0)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := store.SaveLocationsBatch(locs); err != nil {
+					b.Fatalf("SaveLocationsBatch failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestStatsByDirectory(t *testing.T) {
+	store := setupTestLocationStore(t)
+
+	locations := []ChunkLocation{
+		{RepoRoot: "/project", Path: "main.go", StartLine: 1, EndLine: 8, ContentHash: "h1", NodeType: "function", Language: "go"},
+		{RepoRoot: "/project", Path: "internal/a/a.go", StartLine: 1, EndLine: 10, ContentHash: "h2", NodeType: "function", Language: "go"},
+		{RepoRoot: "/project", Path: "internal/a/a.go", StartLine: 11, EndLine: 20, ContentHash: "h3", NodeType: "function", Language: "go"},
+		{RepoRoot: "/project", Path: "internal/a/a.go", StartLine: 1, EndLine: 20, ContentHash: "f1", NodeType: NodeTypeFile, Language: "go"},
+		{RepoRoot: "/project", Path: "internal/b/b.py", StartLine: 1, EndLine: 5, ContentHash: "h4", NodeType: "class", Language: "python"},
+		{RepoRoot: "/other", Path: "internal/c.go", StartLine: 1, EndLine: 5, ContentHash: "h5", NodeType: "function", Language: "go"},
+	}
+	if err := store.SaveLocationsBatch(locations); err != nil {
+		t.Fatalf("SaveLocationsBatch failed: %v", err)
+	}
+
+	files, err := store.FileStats("/project")
+	if err != nil {
+		t.Fatalf("FileStats failed: %v", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("FileStats returned %d files, want 3", len(files))
+	}
+	if a := files[0]; a.Path != "internal/a/a.go" || a.Chunks != 2 || a.Lines != 20 {
+		t.Errorf("FileStats[0] = %+v, want internal/a/a.go with 2 chunks and 20 lines", a)
+	}
+
+	dirs, err := store.StatsByDirectory("/project", 1)
+	if err != nil {
+		t.Fatalf("StatsByDirectory failed: %v", err)
+	}
+	if len(dirs) != 2 || dirs[0].Dir != "internal" || dirs[0].Files != 2 || dirs[0].Chunks != 3 {
+		t.Errorf("depth 1 = %+v, want internal (2 files, 3 chunks) then .", dirs)
+	}
+	if len(dirs) == 2 && (dirs[1].Dir != "." || dirs[1].Files != 1) {
+		t.Errorf("root entry = %+v, want . with 1 file", dirs[1])
+	}
+
+	dirs, err = store.StatsByDirectory("/project", 2)
+	if err != nil {
+		t.Fatalf("StatsByDirectory failed: %v", err)
+	}
+	if len(dirs) != 3 {
+		t.Errorf("depth 2 returned %d directories, want 3: %+v", len(dirs), dirs)
+	}
+}
+
+func TestLocationMetadata(t *testing.T) {
+	store := setupTestLocationStore(t)
+	repo := "/project"
+
+	locs := []ChunkLocation{
+		{RepoRoot: repo, Path: "pay/charge.go", StartLine: 1, EndLine: 10, ContentHash: "h1",
+			Metadata: map[string]string{"team": "payments", "target": "//pay:lib"}},
+		{RepoRoot: repo, Path: "pay/refund.go", StartLine: 1, EndLine: 8, ContentHash: "h2",
+			Metadata: map[string]string{"team": "payments", "target": "//pay:refund"}},
+		{RepoRoot: repo, Path: "auth/login.go", StartLine: 1, EndLine: 12, ContentHash: "h3",
+			Metadata: map[string]string{"team": "identity"}},
+		{RepoRoot: repo, Path: "main.go", StartLine: 1, EndLine: 5, ContentHash: "h4"},
+	}
+	if err := store.SaveLocationsBatch(locs); err != nil {
+		t.Fatalf("SaveLocationsBatch failed: %v", err)
+	}
+
+	// Metadata round-trips through the JSON column
+	got, err := store.GetByPath(repo, "pay/charge.go")
+	if err != nil {
+		t.Fatalf("GetByPath failed: %v", err)
+	}
+	if len(got) != 1 || got[0].Metadata["team"] != "payments" || got[0].Metadata["target"] != "//pay:lib" {
+		t.Fatalf("metadata not stored: %+v", got)
+	}
+	if got, _ := store.GetByPath(repo, "main.go"); len(got) != 1 || got[0].Metadata != nil {
+		t.Errorf("expected no metadata for main.go, got %+v", got)
+	}
+
+	check := func(name string, filter map[string]string, want ...string) {
+		t.Helper()
+		matched, err := store.GetByMetadata(repo, filter)
+		if err != nil {
+			t.Fatalf("%s: GetByMetadata failed: %v", name, err)
+		}
+		var paths []string
+		for _, loc := range matched {
+			paths = append(paths, loc.Path)
+		}
+		if strings.Join(paths, ",") != strings.Join(want, ",") {
+			t.Errorf("%s: got %v, want %v", name, paths, want)
+		}
+	}
+
+	// Unindexed keys are matched against the stored JSON
+	check("unindexed", map[string]string{"team": "payments"}, "pay/charge.go", "pay/refund.go")
+	check("unindexed pair", map[string]string{"team": "payments", "target": "//pay:refund"}, "pay/refund.go")
+	check("no match", map[string]string{"team": "growth"})
+
+	// Indexing a key backfills existing locations
+	if err := store.SetIndexedMetadataKeys([]string{"team"}); err != nil {
+		t.Fatalf("SetIndexedMetadataKeys failed: %v", err)
+	}
+	check("indexed", map[string]string{"team": "payments"}, "pay/charge.go", "pay/refund.go")
+	check("indexed and unindexed", map[string]string{"team": "payments", "target": "//pay:lib"}, "pay/charge.go")
+
+	// Locations saved afterwards are indexed on write, and re-saving
+	// replaces their indexed values
+	if err := store.SaveLocation(ChunkLocation{RepoRoot: repo, Path: "auth/login.go", StartLine: 1, EndLine: 12,
+		ContentHash: "h3", Metadata: map[string]string{"team": "payments"}}); err != nil {
+		t.Fatalf("SaveLocation failed: %v", err)
+	}
+	check("updated", map[string]string{"team": "payments"}, "auth/login.go", "pay/charge.go", "pay/refund.go")
+	check("stale value", map[string]string{"team": "identity"})
+
+	// An empty filter returns every location
+	check("empty filter", nil, "auth/login.go", "main.go", "pay/charge.go", "pay/refund.go")
+
+	// Deleting a file drops its indexed metadata
+	if err := store.DeleteByPath(repo, "pay/refund.go"); err != nil {
+		t.Fatalf("DeleteByPath failed: %v", err)
+	}
+	check("after delete", map[string]string{"team": "payments"}, "auth/login.go", "pay/charge.go")
+}
+
+func TestIndexedMetadataKeysPersist(t *testing.T) {
+	cfg := db.DefaultConfig(":memory:")
+	database, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	store, err := NewLocationStore(database, cfg.Dialect())
+	if err != nil {
+		t.Fatalf("creating location store: %v", err)
+	}
+	if err := store.SetIndexedMetadataKeys([]string{"team", "target"}); err != nil {
+		t.Fatalf("SetIndexedMetadataKeys failed: %v", err)
+	}
+
+	// A second store on the same database indexes the same keys
+	other, err := NewLocationStore(database, cfg.Dialect())
+	if err != nil {
+		t.Fatalf("creating second location store: %v", err)
+	}
+	if keys := other.IndexedMetadataKeys(); strings.Join(keys, ",") != "target,team" {
+		t.Errorf("IndexedMetadataKeys = %v, want [target team]", keys)
+	}
+
+	if err := other.SetIndexedMetadataKeys([]string{"team"}); err != nil {
+		t.Fatalf("SetIndexedMetadataKeys failed: %v", err)
+	}
+	reopened, err := NewLocationStore(database, cfg.Dialect())
+	if err != nil {
+		t.Fatalf("reopening location store: %v", err)
+	}
+	if keys := reopened.IndexedMetadataKeys(); strings.Join(keys, ",") != "team" {
+		t.Errorf("IndexedMetadataKeys after removal = %v, want [team]", keys)
+	}
+}
+
+func TestLocationMetadataColumnMigration(t *testing.T) {
+	cfg := db.DefaultConfig(":memory:")
+	database, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	// Table as created before metadata was added
+	if _, err := database.Exec(`CREATE TABLE chunk_locations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		repo_root TEXT NOT NULL, path TEXT NOT NULL,
+		start_line INTEGER NOT NULL, end_line INTEGER NOT NULL,
+		content_hash TEXT NOT NULL, node_type TEXT, node_name TEXT, language TEXT,
+		created_at INTEGER NOT NULL)`); err != nil {
+		t.Fatalf("creating legacy table: %v", err)
+	}
+	if _, err := database.Exec(`INSERT INTO chunk_locations
+		(repo_root, path, start_line, end_line, content_hash, created_at)
+		VALUES ('/project', 'old.go', 1, 3, 'h0', 0)`); err != nil {
+		t.Fatalf("inserting legacy row: %v", err)
+	}
+
+	store, err := NewLocationStore(database, cfg.Dialect())
+	if err != nil {
+		t.Fatalf("creating location store: %v", err)
+	}
+	if err := store.SaveLocation(ChunkLocation{RepoRoot: "/project", Path: "new.go", StartLine: 1, EndLine: 2,
+		ContentHash: "h1", Metadata: map[string]string{"team": "core"}}); err != nil {
+		t.Fatalf("SaveLocation failed: %v", err)
+	}
+
+	locs, err := store.GetByRepo("/project")
+	if err != nil {
+		t.Fatalf("GetByRepo failed: %v", err)
+	}
+	if len(locs) != 2 || locs[0].Metadata["team"] != "core" || locs[1].Metadata != nil {
+		t.Errorf("unexpected locations after migration: %+v", locs)
+	}
+}
+
+func TestChunkIDStableAcrossReindex(t *testing.T) {
+	store := setupTestLocationStore(t)
+
+	loc := ChunkLocation{RepoRoot: "/project", Path: "main.go", StartLine: 10, EndLine: 20, ContentHash: "abc"}
+	if err := store.SaveLocationsBatch([]ChunkLocation{loc}); err != nil {
+		t.Fatalf("SaveLocationsBatch failed: %v", err)
+	}
+	first, err := store.GetByPath("/project", "main.go")
+	if err != nil || len(first) != 1 {
+		t.Fatalf("GetByPath = %v, %v", first, err)
+	}
+
+	// Reindexing deletes and reinserts the file's locations
+	if err := store.DeleteByPath("/project", "main.go"); err != nil {
+		t.Fatalf("DeleteByPath failed: %v", err)
+	}
+	if err := store.SaveLocation(loc); err != nil {
+		t.Fatalf("SaveLocation failed: %v", err)
+	}
+	second, err := store.GetByPath("/project", "main.go")
+	if err != nil || len(second) != 1 {
+		t.Fatalf("GetByPath = %v, %v", second, err)
+	}
+
+	if second[0].ID == first[0].ID {
+		t.Fatalf("expected a new row ID after reinsert, got %d twice", first[0].ID)
+	}
+	want := ChunkID("/project", "main.go", 10, "abc")
+	if first[0].ChunkID != want || second[0].ChunkID != want {
+		t.Errorf("ChunkID = %q then %q, want %q", first[0].ChunkID, second[0].ChunkID, want)
+	}
+
+	// Any change to the identifying fields gives a different ID
+	for _, other := range []string{
+		ChunkID("/other", "main.go", 10, "abc"),
+		ChunkID("/project", "util.go", 10, "abc"),
+		ChunkID("/project", "main.go", 11, "abc"),
+		ChunkID("/project", "main.go", 10, "abd"),
+	} {
+		if other == want {
+			t.Errorf("ChunkID collision with %q", want)
+		}
+	}
+}
+
+func TestGetByChunkID(t *testing.T) {
+	store := setupTestLocationStore(t)
+
+	if err := store.SaveLocationsBatch([]ChunkLocation{
+		{RepoRoot: "/project", Path: "a.go", StartLine: 1, EndLine: 5, ContentHash: "h1", NodeName: "A"},
+		{RepoRoot: "/project", Path: "b.go", StartLine: 1, EndLine: 5, ContentHash: "h1", NodeName: "B"},
+	}); err != nil {
+		t.Fatalf("SaveLocationsBatch failed: %v", err)
+	}
+
+	loc, err := store.GetByChunkID(ChunkID("/project", "b.go", 1, "h1"))
+	if err != nil {
+		t.Fatalf("GetByChunkID failed: %v", err)
+	}
+	if loc == nil || loc.Path != "b.go" || loc.NodeName != "B" {
+		t.Errorf("GetByChunkID = %+v, want b.go", loc)
+	}
+
+	loc, err = store.GetByChunkID(ChunkID("/project", "b.go", 1, "changed"))
+	if err != nil {
+		t.Fatalf("GetByChunkID failed: %v", err)
+	}
+	if loc != nil {
+		t.Errorf("GetByChunkID of an unknown ID = %+v, want nil", loc)
+	}
+}
+
+func TestChunkIDColumnBackfill(t *testing.T) {
+	cfg := db.DefaultConfig(":memory:")
+	database, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	// Table as created before chunk IDs were added
+	if _, err := database.Exec(`CREATE TABLE chunk_locations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		repo_root TEXT NOT NULL, path TEXT NOT NULL,
+		start_line INTEGER NOT NULL, end_line INTEGER NOT NULL,
+		content_hash TEXT NOT NULL, node_type TEXT, node_name TEXT, language TEXT,
+		created_at INTEGER NOT NULL, metadata TEXT)`); err != nil {
+		t.Fatalf("creating legacy table: %v", err)
+	}
+	if _, err := database.Exec(`INSERT INTO chunk_locations
+		(repo_root, path, start_line, end_line, content_hash, created_at)
+		VALUES ('/project', 'old.go', 4, 9, 'h0', 0)`); err != nil {
+		t.Fatalf("inserting legacy row: %v", err)
+	}
+
+	store, err := NewLocationStore(database, cfg.Dialect())
+	if err != nil {
+		t.Fatalf("creating location store: %v", err)
+	}
+
+	want := ChunkID("/project", "old.go", 4, "h0")
+	loc, err := store.GetByChunkID(want)
+	if err != nil {
+		t.Fatalf("GetByChunkID failed: %v", err)
+	}
+	if loc == nil || loc.Path != "old.go" || loc.ChunkID != want {
+		t.Errorf("legacy row not backfilled: %+v", loc)
+	}
+}
+
+func TestRelocateRepo(t *testing.T) {
+	store := setupTestLocationStore(t)
+	if err := store.SetIndexedMetadataKeys([]string{"team"}); err != nil {
+		t.Fatalf("SetIndexedMetadataKeys failed: %v", err)
+	}
+
+	team := map[string]string{"team": "billing"}
+	store.SaveLocationsBatch([]ChunkLocation{
+		{RepoRoot: "/old", Path: "a.go", StartLine: 1, EndLine: 10, ContentHash: "h1", Metadata: team},
+		{RepoRoot: "/old", Path: "b.go", StartLine: 1, EndLine: 5, ContentHash: "h2"},
+		{RepoRoot: "/other", Path: "c.go", StartLine: 1, EndLine: 5, ContentHash: "h3"},
+	})
+
+	n, err := store.RelocateRepo("/old", "/new")
+	if err != nil {
+		t.Fatalf("RelocateRepo failed: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("RelocateRepo moved %d locations, want 2", n)
+	}
+
+	repos, err := store.Repos()
+	if err != nil {
+		t.Fatalf("Repos failed: %v", err)
+	}
+	if len(repos) != 2 || repos[0] != "/new" || repos[1] != "/other" {
+		t.Errorf("Repos = %v, want [/new /other]", repos)
+	}
+	locs, _ := store.GetByPath("/new", "a.go")
+	if len(locs) != 1 || locs[0].ChunkID != ChunkID("/new", "a.go", 1, "h1") {
+		t.Errorf("a.go locations = %+v, want one with a recomputed ChunkID", locs)
+	}
+	if matched, _ := store.GetByMetadata("/new", team); len(matched) != 1 {
+		t.Errorf("GetByMetadata = %+v, want the relocated a.go", matched)
+	}
+
+	if _, err := store.RelocateRepo("/other", "/new"); err == nil {
+		t.Error("RelocateRepo onto a repo with locations succeeded")
+	}
+}
+
+func TestWindowsPathsNormalized(t *testing.T) {
+	store := setupTestLocationStore(t)
+	if err := store.SetIndexedMetadataKeys([]string{"team"}); err != nil {
+		t.Fatalf("SetIndexedMetadataKeys failed: %v", err)
+	}
+
+	team := map[string]string{"team": "billing"}
+	if err := store.SaveLocationsBatch([]ChunkLocation{
+		{RepoRoot: "/project", Path: `pkg\sub\a.go`, StartLine: 1, EndLine: 10, ContentHash: "h1", Metadata: team},
+		{RepoRoot: "/project", Path: "pkg/sub/a.go", StartLine: 11, EndLine: 20, ContentHash: "h2"},
+	}); err != nil {
+		t.Fatalf("SaveLocationsBatch failed: %v", err)
+	}
+	if err := store.SaveLocation(ChunkLocation{RepoRoot: "/project", Path: `pkg\b.go`, StartLine: 1, EndLine: 5, ContentHash: "h3"}); err != nil {
+		t.Fatalf("SaveLocation failed: %v", err)
+	}
+
+	paths, err := store.ListPaths("/project")
+	if err != nil {
+		t.Fatalf("ListPaths failed: %v", err)
+	}
+	if strings.Join(paths, ",") != "pkg/b.go,pkg/sub/a.go" {
+		t.Errorf("ListPaths = %v, want forward-slash paths", paths)
+	}
+
+	// Either separator finds the file
+	for _, path := range []string{"pkg/sub/a.go", `pkg\sub\a.go`} {
+		locs, err := store.GetByPath("/project", path)
+		if err != nil || len(locs) != 2 {
+			t.Fatalf("GetByPath(%q) = %d locations, %v; want 2", path, len(locs), err)
+		}
+		if locs[0].Path != "pkg/sub/a.go" || locs[0].ChunkID != ChunkID("/project", "pkg/sub/a.go", 1, "h1") {
+			t.Errorf("GetByPath(%q)[0] = %+v, want a normalized path and chunk ID", path, locs[0])
+		}
+		if n, _ := store.CountByPath("/project", path); n != 2 {
+			t.Errorf("CountByPath(%q) = %d, want 2", path, n)
+		}
+		if hashes, _ := store.GetHashesForPath("/project", path); len(hashes) != 2 {
+			t.Errorf("GetHashesForPath(%q) = %v, want 2 hashes", path, hashes)
+		}
+	}
+	if matched, _ := store.GetByMetadata("/project", team); len(matched) != 1 || matched[0].Path != "pkg/sub/a.go" {
+		t.Errorf("GetByMetadata = %+v, want pkg/sub/a.go", matched)
+	}
+
+	if n, err := store.RenamePath("/project", `pkg\sub\a.go`, `pkg\c.go`); err != nil || n != 2 {
+		t.Fatalf("RenamePath = %d, %v; want 2", n, err)
+	}
+	if locs, _ := store.GetByPath("/project", "pkg/c.go"); len(locs) != 2 {
+		t.Errorf("renamed file has %d locations, want 2", len(locs))
+	}
+	if err := store.DeleteByPath("/project", `pkg\c.go`); err != nil {
+		t.Fatalf("DeleteByPath failed: %v", err)
+	}
+	if n, _ := store.CountByRepo("/project"); n != 1 {
+		t.Errorf("CountByRepo after delete = %d, want 1", n)
+	}
+}
+
+func TestWindowsPathMigration(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("every repository is migrated on Windows")
+	}
+	store := setupTestLocationStore(t)
+	insert := func(root, path string) {
+		t.Helper()
+		query := store.schema.SubstitutePlaceholders(`INSERT INTO chunk_locations
+			(repo_root, path, start_line, end_line, content_hash, created_at, chunk_id)
+			VALUES (?, ?, 1, 5, 'h1', 0, 'stale')`)
+		if _, err := store.database.Exec(query, root, path); err != nil {
+			t.Fatalf("inserting legacy row: %v", err)
+		}
+	}
+	reopen := func() *LocationStore {
+		t.Helper()
+		reopened, err := NewLocationStore(store.database, store.dialect)
+		if err != nil {
+			t.Fatalf("reopening location store: %v", err)
+		}
+		return reopened
+	}
+	paths := func(s *LocationStore, root string) []string {
+		t.Helper()
+		locs, err := s.GetByRepo(root)
+		if err != nil {
+			t.Fatalf("GetByRepo failed: %v", err)
+		}
+		var got []string
+		for _, loc := range locs {
+			got = append(got, loc.Path)
+		}
+		return got
+	}
+
+	// The store was created before these rows, so drop the record of the
+	// migration to simulate a database written by an older version
+	if _, err := store.database.Exec("DELETE FROM location_migrations"); err != nil {
+		t.Fatalf("clearing migrations: %v", err)
+	}
+	// Rows written with backslashes before paths were normalized, and a
+	// legal backslash in a file name on Linux
+	insert(`C:\src`, `pkg\a.go`)
+	insert("/project", `pkg\a.go`)
+
+	reopened := reopen()
+	locs, err := reopened.GetByRepo(`C:\src`)
+	if err != nil {
+		t.Fatalf("GetByRepo failed: %v", err)
+	}
+	if len(locs) != 1 || locs[0].Path != "pkg/a.go" || locs[0].ChunkID != ChunkID(`C:\src`, "pkg/a.go", 1, "h1") {
+		t.Errorf("legacy row not normalized: %+v", locs)
+	}
+	if got := paths(reopened, "/project"); !reflect.DeepEqual(got, []string{`pkg\a.go`}) {
+		t.Errorf("non-Windows repository paths = %q, want unchanged", got)
+	}
+
+	// The migration runs once
+	insert(`C:\src`, `pkg\b.go`)
+	if got := paths(reopen(), `C:\src`); !slices.Contains(got, `pkg\b.go`) {
+		t.Errorf("paths after reopening = %q, want pkg\\b.go kept", got)
+	}
+}
+
+func TestIsWindowsRoot(t *testing.T) {
+	tests := map[string]bool{
+		`C:\src`:         true,
+		"d:/src":         true,
+		`\\server\share`: true,
+		"/project":       false,
+		"C:":             false,
+		"1:/src":         false,
+		"relative":       false,
+	}
+	for root, want := range tests {
+		if got := isWindowsRoot(root); got != want {
+			t.Errorf("isWindowsRoot(%q) = %v, want %v", root, got, want)
+		}
+	}
+}
+
+func TestTopDuplicated(t *testing.T) {
+	store := setupTestLocationStore(t)
+
+	// "h3" appears 4 times, "h2" and "h2b" 2 times, "h1" once
+	var locs []ChunkLocation
+	add := func(path string, line int, hash, nodeType string) {
+		locs = append(locs, ChunkLocation{
+			RepoRoot: "/project", Path: path, StartLine: line, EndLine: line + 5,
+			ContentHash: hash, NodeType: nodeType,
+		})
+	}
+	add("a.go", 1, "h1", "function")
+	add("a.go", 10, "h2", "function")
+	add("b.go", 10, "h2", "function")
+	add("b.go", 20, "h2b", "function")
+	add("c.go", 20, "h2b", "")
+	for i, path := range []string{"z.go", "y.go", "x.go", "w.go"} {
+		add(path, i+1, "h3", "function")
+	}
+	// File entries and other repositories are not counted
+	add("a.go", 1, "h1", NodeTypeFile)
+	add("b.go", 1, "h1", NodeTypeFile)
+	locs = append(locs,
+		ChunkLocation{RepoRoot: "/other", Path: "a.go", StartLine: 1, EndLine: 5, ContentHash: "h1"},
+		ChunkLocation{RepoRoot: "/other", Path: "b.go", StartLine: 1, EndLine: 5, ContentHash: "h1"},
+		ChunkLocation{RepoRoot: "/other", Path: "c.go", StartLine: 1, EndLine: 5, ContentHash: "h1"},
+	)
+	if err := store.SaveLocationsBatch(locs); err != nil {
+		t.Fatalf("SaveLocationsBatch failed: %v", err)
+	}
+
+	dups, err := store.TopDuplicated("/project", 10)
+	if err != nil {
+		t.Fatalf("TopDuplicated failed: %v", err)
+	}
+	var got []string
+	for _, dup := range dups {
+		got = append(got, fmt.Sprintf("%s=%d", dup.ContentHash, dup.Count))
+	}
+	if want := "h3=4 h2=2 h2b=2"; strings.Join(got, " ") != want {
+		t.Fatalf("TopDuplicated = %v, want %s", got, want)
+	}
+
+	examples := dups[0].Examples
+	if len(examples) != DuplicateExamples {
+		t.Fatalf("got %d examples, want %d", len(examples), DuplicateExamples)
+	}
+	if examples[0].Path != "w.go" || examples[1].Path != "x.go" || examples[2].Path != "y.go" {
+		t.Errorf("examples = %s, %s, %s; want w.go, x.go, y.go", examples[0].Path, examples[1].Path, examples[2].Path)
+	}
+	if len(dups[1].Examples) != 2 {
+		t.Errorf("got %d examples for h2, want 2", len(dups[1].Examples))
+	}
+
+	// The limit keeps the most duplicated
+	dups, err = store.TopDuplicated("/project", 1)
+	if err != nil {
+		t.Fatalf("TopDuplicated failed: %v", err)
+	}
+	if len(dups) != 1 || dups[0].ContentHash != "h3" {
+		t.Errorf("TopDuplicated(1) = %+v, want h3", dups)
+	}
+
+	if dups, err := store.TopDuplicated("/project", 0); err != nil || len(dups) != 0 {
+		t.Errorf("TopDuplicated(0) = %v, %v; want none", dups, err)
+	}
+}
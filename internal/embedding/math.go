@@ -87,6 +87,11 @@ type ScoredItem struct {
 // TopKByCosineSimilarity finds the top-k most similar vectors to query
 // Returns indices and scores sorted by similarity (highest first)
 func TopKByCosineSimilarity(query []float32, vectors [][]float32, k int) []ScoredItem {
+	return TopKBySimilarity(query, vectors, k, MetricCosine)
+}
+
+// TopKBySimilarity is TopKByCosineSimilarity for any metric.
+func TopKBySimilarity(query []float32, vectors [][]float32, k int, metric Metric) []ScoredItem {
 	if k <= 0 || len(vectors) == 0 {
 		return nil
 	}
@@ -96,7 +101,7 @@ func TopKByCosineSimilarity(query []float32, vectors [][]float32, k int) []Score
 	for i, v := range vectors {
 		similarities[i] = ScoredItem{
 			Index: i,
-			Score: CosineSimilarity(query, v),
+			Score: metric.Similarity(query, v),
 		}
 	}
 
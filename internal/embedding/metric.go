@@ -0,0 +1,96 @@
+package embedding
+
+import (
+	"codetect/internal/config"
+	"codetect/internal/db"
+)
+
+// Metric is a vector similarity function named by one of the config.Metric*
+// constants. The zero value is cosine.
+type Metric string
+
+// Supported metrics.
+const (
+	MetricCosine     Metric = config.MetricCosine
+	MetricEuclidean  Metric = config.MetricEuclidean
+	MetricDotProduct Metric = config.MetricDotProduct
+)
+
+// MetricFromConfig converts a config metric name, treating unknown or empty
+// names as cosine. Names should already be validated with
+// config.ParseDistanceMetric.
+func MetricFromConfig(name string) Metric {
+	canonical, err := config.ParseDistanceMetric(name)
+	if err != nil {
+		return MetricCosine
+	}
+	return Metric(canonical)
+}
+
+// Similarity scores b against a, higher meaning more similar. Scores use
+// the same scale as the database backends: cosine similarity, 1/(1+d) for
+// Euclidean distance d, and the raw inner product.
+func (m Metric) Similarity(a, b []float32) float32 {
+	switch m {
+	case MetricEuclidean:
+		return 1 / (1 + EuclideanDistance(a, b))
+	case MetricDotProduct:
+		return DotProduct(a, b)
+	default:
+		return CosineSimilarity(a, b)
+	}
+}
+
+// Normalizes reports whether vectors are unit-normalized under this metric.
+// Only cosine ignores vector length, so pooled vectors are normalized for
+// cosine and left as plain means otherwise, where normalizing would change
+// distances.
+func (m Metric) Normalizes() bool {
+	return m != MetricEuclidean && m != MetricDotProduct
+}
+
+// Pool combines vectors into one, their mean under this metric: normalized
+// if the metric Normalizes. It returns nil if vectors is empty or their
+// lengths differ.
+func (m Metric) Pool(vectors [][]float32) []float32 {
+	if len(vectors) == 0 || len(vectors[0]) == 0 {
+		return nil
+	}
+	sum := make([]float32, len(vectors[0]))
+	for _, vec := range vectors {
+		if len(vec) != len(sum) {
+			return nil
+		}
+		for i, v := range vec {
+			sum[i] += v
+		}
+	}
+	if m.Normalizes() {
+		return Normalize(sum)
+	}
+	n := float32(len(vectors))
+	for i := range sum {
+		sum[i] /= n
+	}
+	return sum
+}
+
+// VectorDB returns the equivalent db.DistanceMetric.
+func (m Metric) VectorDB() db.DistanceMetric {
+	switch m {
+	case MetricEuclidean:
+		return db.DistanceEuclidean
+	case MetricDotProduct:
+		return db.DistanceDotProduct
+	default:
+		return db.DistanceCosine
+	}
+}
+
+// String returns the metric name, "cosine" for the zero value.
+func (m Metric) String() string {
+	if m == "" {
+		return string(MetricCosine)
+	}
+	return string(m)
+}
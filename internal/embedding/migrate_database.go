@@ -20,6 +20,10 @@ type MigrationOptions struct {
 
 	// DryRun performs validation without actually migrating data
 	DryRun bool
+
+	// DistanceMetric is the metric of the target's vector index
+	// (default: cosine)
+	DistanceMetric string
 }
 
 // DefaultMigrationOptions returns sensible defaults for migration.
@@ -199,12 +203,13 @@ func MigrateDatabaseWithVectorIndex(
 		}
 
 		// Create vector index using PgVectorDB
-		vdb, err := db.NewPgVectorDB(target.db, target.vectorDim, db.DistanceCosine)
+		metric := MetricFromConfig(opts.DistanceMetric).VectorDB()
+		vdb, err := db.NewPgVectorDB(target.db, target.vectorDim, metric)
 		if err != nil {
 			return fmt.Errorf("creating vector database: %w", err)
 		}
 
-		if err := vdb.CreateVectorIndex(ctx, "embeddings", target.vectorDim, db.DistanceCosine); err != nil {
+		if err := vdb.CreateVectorIndex(ctx, "embeddings", target.vectorDim, metric); err != nil {
 			return fmt.Errorf("creating vector index: %w", err)
 		}
 	}
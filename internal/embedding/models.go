@@ -0,0 +1,42 @@
+package embedding
+
+import (
+	"fmt"
+
+	"codetect/internal/db"
+)
+
+// ModelSpace is an additional embedding model that a pipeline embeds every
+// chunk with, alongside its primary embedder, for comparing retrieval
+// quality across models on the same index. Its vectors are stored under
+// ModelCacheKey, so they never replace the primary model's, and a
+// CacheSearcher searches them when CacheSearchOptions.Model names the
+// space.
+type ModelSpace struct {
+	Model    string          // Name selected by CacheSearchOptions.Model
+	Embedder Embedder        // Embeds chunks and queries for this space
+	Cache    *EmbeddingCache // Holds the space's vectors
+}
+
+// NewModelSpace creates a model space for embedder, storing its vectors in
+// database in a cache of the embedder's dimensions. The space is named
+// after the embedder's model.
+func NewModelSpace(database db.DB, dialect db.Dialect, embedder Embedder) (ModelSpace, error) {
+	model := embedderModel(embedder)
+	cache, err := NewEmbeddingCache(database, dialect, embedder.Dimensions(), model)
+	if err != nil {
+		return ModelSpace{}, fmt.Errorf("creating cache for model %s: %w", model, err)
+	}
+	return ModelSpace{Model: model, Embedder: embedder, Cache: cache}, nil
+}
+
+// ModelCacheKey returns the key under which model's vector for the chunk
+// with cache key hash (see Chunk.CacheKey) is stored in a model space.
+func ModelCacheKey(model, hash string) string {
+	return HashContent("model:" + model + "\x00" + hash)
+}
+
+// Key returns the space's cache key for the chunk with cache key hash.
+func (m ModelSpace) Key(hash string) string {
+	return ModelCacheKey(m.Model, hash)
+}
@@ -0,0 +1,125 @@
+package embedding
+
+import (
+	"context"
+	"testing"
+
+	"codetect/internal/db"
+)
+
+// namedEmbedder is a keywordEmbedder reporting a model name.
+type namedEmbedder struct {
+	keywordEmbedder
+	model string
+}
+
+func (n *namedEmbedder) Model() string { return n.model }
+
+func TestModelSpaces(t *testing.T) {
+	cfg := db.DefaultConfig(":memory:")
+	database, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	cache, err := NewEmbeddingCache(database, cfg.Dialect(), 3, "primary")
+	if err != nil {
+		t.Fatalf("creating cache: %v", err)
+	}
+	locations, err := NewLocationStore(database, cfg.Dialect())
+	if err != nil {
+		t.Fatalf("creating location store: %v", err)
+	}
+	primary := &namedEmbedder{keywordEmbedder{keywords: []string{"alpha", "beta"}}, "primary"}
+	other := &namedEmbedder{keywordEmbedder{keywords: []string{"gamma", "delta", "epsilon"}}, "other"}
+
+	space, err := NewModelSpace(database, cfg.Dialect(), other)
+	if err != nil {
+		t.Fatalf("NewModelSpace failed: %v", err)
+	}
+	if space.Model != "other" || space.Cache.Dimensions() != 4 {
+		t.Fatalf("space = %s with %d dimensions, want other with 4", space.Model, space.Cache.Dimensions())
+	}
+	pipeline := NewPipeline(cache, locations, primary, WithModelSpaces(space), WithFileEmbeddings(true))
+
+	ctx := context.Background()
+	chunks := []Chunk{
+		{Path: "a.go", StartLine: 1, EndLine: 5, Content: "alpha gamma"},
+		{Path: "b.go", StartLine: 1, EndLine: 5, Content: "beta delta"},
+		{Path: "c.go", StartLine: 1, EndLine: 5, Content: "beta epsilon"},
+	}
+	result, err := pipeline.EmbedChunks(ctx, "/project", chunks)
+	if err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	if result.Embedded != 3 || result.ModelEmbedded != 3 {
+		t.Errorf("Embedded = %d, ModelEmbedded = %d, want 3 and 3", result.Embedded, result.ModelEmbedded)
+	}
+
+	// Every location, file-level ones included, has a vector from each
+	// model, stored apart
+	locs, err := locations.GetByRepo("/project")
+	if err != nil {
+		t.Fatalf("GetByRepo failed: %v", err)
+	}
+	if len(locs) != 6 {
+		t.Fatalf("got %d locations, want 3 chunks and 3 files", len(locs))
+	}
+	for _, loc := range locs {
+		entry, err := cache.Get(loc.ContentHash)
+		if err != nil || entry == nil || entry.Model != "primary" || len(entry.Embedding) != 3 {
+			t.Errorf("%s:%d primary entry = %+v, %v", loc.Path, loc.StartLine, entry, err)
+		}
+		entry, err = space.Cache.Get(space.Key(loc.ContentHash))
+		if err != nil || entry == nil || entry.Model != "other" || len(entry.Embedding) != 4 {
+			t.Errorf("%s:%d other entry = %+v, %v", loc.Path, loc.StartLine, entry, err)
+		}
+	}
+
+	// Vectors already stored for a model are reused
+	result, err = pipeline.EmbedChunks(ctx, "/project", chunks)
+	if err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	if result.Embedded != 0 || result.ModelEmbedded != 0 {
+		t.Errorf("re-embedding: Embedded = %d, ModelEmbedded = %d, want 0 and 0", result.Embedded, result.ModelEmbedded)
+	}
+
+	searcher := NewCacheSearcher(cache, locations, primary)
+	searcher.SetModelSpaces([]ModelSpace{space})
+	search := func(query, model string) []CacheSearchResult {
+		t.Helper()
+		results, err := searcher.Search(ctx, query, CacheSearchOptions{RepoRoot: "/project", Model: model})
+		if err != nil {
+			t.Fatalf("Search(%q, %q) failed: %v", query, model, err)
+		}
+		if len(results) != 3 {
+			t.Fatalf("Search(%q, %q) returned %d results, want all 3 chunks", query, model, len(results))
+		}
+		return results
+	}
+
+	// Each model ranks by its own vectors
+	if got := search("alpha", ""); got[0].Path != "a.go" {
+		t.Errorf("primary search for alpha ranked %s first, want a.go", got[0].Path)
+	}
+	if got := search("alpha", "primary"); got[0].Path != "a.go" {
+		t.Errorf("search of the primary model by name ranked %s first, want a.go", got[0].Path)
+	}
+	if got := search("epsilon", "other"); got[0].Path != "c.go" {
+		t.Errorf("other search for epsilon ranked %s first, want c.go", got[0].Path)
+	}
+
+	results, err := searcher.SearchChunks(ctx, []Chunk{{Path: "x.go", Content: "delta"}}, CacheSearchOptions{RepoRoot: "/project", Model: "other"})
+	if err != nil {
+		t.Fatalf("SearchChunks failed: %v", err)
+	}
+	if len(results) == 0 || results[0].Path != "b.go" {
+		t.Errorf("other example search = %+v, want b.go first", results)
+	}
+
+	if _, err := searcher.Search(ctx, "alpha", CacheSearchOptions{RepoRoot: "/project", Model: "missing"}); err == nil {
+		t.Error("Search of an unknown model succeeded")
+	}
+}
@@ -1,7 +1,6 @@
 package embedding
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -25,6 +24,7 @@ type OllamaClient struct {
 	timeout    time.Duration
 	batchSize  int
 	httpClient *http.Client
+	compressor requestCompressor
 }
 
 // OllamaOption configures the Ollama client
@@ -51,6 +51,16 @@ func WithTimeout(timeout time.Duration) OllamaOption {
 	}
 }
 
+// WithCompression gzips request bodies, for servers behind slow links
+// whose proxy accepts "Content-Encoding: gzip"; Ollama itself does not.
+// An endpoint answering 415 Unsupported Media Type is sent uncompressed
+// bodies from then on.
+func WithCompression(on bool) OllamaOption {
+	return func(c *OllamaClient) {
+		c.compressor.setEnabled(on)
+	}
+}
+
 // NewOllamaClient creates a new Ollama client
 func NewOllamaClient(opts ...OllamaOption) *OllamaClient {
 	c := &OllamaClient{
@@ -160,15 +170,9 @@ func (c *OllamaClient) EmbedWithContext(ctx context.Context, text string) ([]flo
 		return nil, fmt.Errorf("marshaling request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/embeddings", bytes.NewReader(body))
-	if err != nil {
-		return nil, fmt.Errorf("creating request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.compressor.post(ctx, c.httpClient, c.baseURL+"/api/embeddings", body, nil)
 	if err != nil {
-		return nil, fmt.Errorf("sending request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
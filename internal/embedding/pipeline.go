@@ -4,9 +4,15 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"log/slog"
+	"maps"
+	"sort"
+	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 // EmbedResult contains statistics from an embedding operation.
@@ -21,6 +27,15 @@ type EmbedResult struct {
 	CacheTime   time.Duration `json:"cache_time"`   // Time spent on cache operations
 	HitRate     float64       `json:"hit_rate"`     // Cache hit percentage
 	ChunksPerSec float64      `json:"chunks_per_sec"` // Throughput
+	FileEmbeddings int        `json:"file_embeddings,omitempty"` // File-level embeddings stored
+	Requests       *RequestStats `json:"requests,omitempty"`     // Embedding backend requests; nil if none
+	ModelEmbedded  int           `json:"model_embedded,omitempty"` // New embeddings for model spaces, see WithModelSpaces
+
+	// Location rows of changed files written, deleted and left in place
+	// by EmbedFiles and IncrementalUpdate with WithChunkDeltas
+	LocationsWritten   int `json:"locations_written,omitempty"`
+	LocationsDeleted   int `json:"locations_deleted,omitempty"`
+	LocationsUnchanged int `json:"locations_unchanged,omitempty"`
 }
 
 // Pipeline provides a cache-aware embedding pipeline.
@@ -33,6 +48,15 @@ type Pipeline struct {
 	// Configuration
 	batchSize int
 	maxWorkers int
+	fileEmbeddings bool
+	maxInputBytes int
+	maxEmbeddings int
+	metric Metric
+	logger *slog.Logger
+	spaces []ModelSpace
+	contents *ContentStore
+	chunkDeltas bool
+	maxBatchSplits int
 }
 
 // PipelineOption configures a Pipeline.
@@ -56,6 +80,103 @@ func WithMaxWorkers(workers int) PipelineOption {
 	}
 }
 
+// WithFileEmbeddings enables file-level embeddings in addition to chunk
+// embeddings. See embedFiles for how they are computed.
+func WithFileEmbeddings(enabled bool) PipelineOption {
+	return func(p *Pipeline) {
+		p.fileEmbeddings = enabled
+	}
+}
+
+// WithMaxInputBytes caps the text sent to the embedder per chunk, so one
+// pathological chunk cannot exceed the provider's input limit and fail its
+// whole batch. Longer inputs are truncated before embedding; stored content
+// and content hashes are unaffected. Zero means no limit.
+func WithMaxInputBytes(n int) PipelineOption {
+	return func(p *Pipeline) {
+		if n >= 0 {
+			p.maxInputBytes = n
+		}
+	}
+}
+
+// WithMaxEmbeddings caps the new embeddings a single call may request. A
+// call whose cache misses exceed n fails with a *BudgetError before
+// anything is embedded, guarding against an accidental run over far more
+// content than intended. Zero means no limit.
+func WithMaxEmbeddings(n int) PipelineOption {
+	return func(p *Pipeline) {
+		if n >= 0 {
+			p.maxEmbeddings = n
+		}
+	}
+}
+
+// WithMetric sets the distance metric search will use, which decides how
+// file-level vectors are pooled (see Metric.Normalizes). Default: cosine.
+func WithMetric(metric Metric) PipelineOption {
+	return func(p *Pipeline) {
+		p.metric = metric
+	}
+}
+
+// WithLogger sets the logger for pipeline warnings such as truncated input.
+func WithLogger(logger *slog.Logger) PipelineOption {
+	return func(p *Pipeline) {
+		if logger != nil {
+			p.logger = logger
+		}
+	}
+}
+
+// WithModelSpaces makes the pipeline also embed every chunk with each
+// space's model, for comparing models (see ModelSpace). Their vectors do
+// not count toward WithMaxEmbeddings.
+func WithModelSpaces(spaces ...ModelSpace) PipelineOption {
+	return func(p *Pipeline) {
+		p.spaces = append(p.spaces, spaces...)
+	}
+}
+
+// WithContentStore makes the pipeline store the content of every chunk it
+// saves a location for, so snippets can be served from the index (see
+// ContentStore). Off by default, as it roughly adds the compressed size of
+// the indexed source to the database.
+func WithContentStore(store *ContentStore) PipelineOption {
+	return func(p *Pipeline) {
+		p.contents = store
+	}
+}
+
+// WithChunkDeltas makes EmbedFiles and IncrementalUpdate write only the
+// locations of a changed file that differ from those recorded, rather
+// than saving or deleting and re-saving all of them. A chunk whose content
+// and lines are unchanged keeps its row, so a localized edit to a large
+// file touches a few rows. Off by default.
+func WithChunkDeltas(enabled bool) PipelineOption {
+	return func(p *Pipeline) {
+		p.chunkDeltas = enabled
+	}
+}
+
+// DefaultMaxBatchSplits is how many times a batch answered with the wrong
+// number of embeddings is halved by default, enough to bring a batch of
+// 256 inputs down to single ones.
+const DefaultMaxBatchSplits = 8
+
+// WithMaxBatchSplits sets how many times a batch for which the embedder
+// returns a different number of vectors than inputs is split in half and
+// retried, as some providers silently drop inputs from a batch over their
+// limits. Zero fails such a batch immediately. Default:
+// DefaultMaxBatchSplits.
+func WithMaxBatchSplits(n int) PipelineOption {
+	return func(p *Pipeline) {
+		if n >= 0 {
+			p.maxBatchSplits = n
+		}
+	}
+}
+
 // NewPipeline creates a new embedding pipeline.
 func NewPipeline(cache *EmbeddingCache, locations *LocationStore, embedder Embedder, opts ...PipelineOption) *Pipeline {
 	p := &Pipeline{
@@ -64,6 +185,9 @@ func NewPipeline(cache *EmbeddingCache, locations *LocationStore, embedder Embed
 		embedder:   embedder,
 		batchSize:  32, // Default batch size
 		maxWorkers: 1,  // Default single worker
+		metric:     MetricCosine,
+		logger:     slog.Default(),
+		maxBatchSplits: DefaultMaxBatchSplits,
 	}
 
 	for _, opt := range opts {
@@ -74,7 +198,8 @@ func NewPipeline(cache *EmbeddingCache, locations *LocationStore, embedder Embed
 }
 
 // PipelineChunk extends Chunk with content hash for pipeline processing.
-// If ContentHash is empty, it will be computed from Content.
+// If ContentHash is empty, it will be computed with the chunk's CacheKey,
+// so chunks embedded from different text never share a cache entry.
 type PipelineChunk struct {
 	Chunk
 	ContentHash string `json:"content_hash"`
@@ -90,12 +215,32 @@ type PipelineChunk struct {
 // This achieves near-100% cache hit rate on unchanged code.
 func (p *Pipeline) EmbedChunks(ctx context.Context, repoRoot string, chunks []Chunk) (*EmbedResult, error) {
 	start := time.Now()
-	result := &EmbedResult{
-		Total: len(chunks),
+	if len(chunks) == 0 {
+		return &EmbedResult{}, nil
 	}
 
-	if len(chunks) == 0 {
-		return result, nil
+	result, pChunks, locations, err := p.embedChunks(ctx, repoRoot, chunks)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.storeContents(pChunks); err != nil {
+		return nil, err
+	}
+	if err := p.locations.SaveLocationsBatch(locations); err != nil {
+		return nil, fmt.Errorf("location store failed: %w", err)
+	}
+
+	finishResult(result, start)
+	return result, nil
+}
+
+// embedChunks embeds chunks as EmbedChunks does, and returns them with
+// their content hashes and the locations to record, including file-level
+// ones, without saving the locations or contents.
+func (p *Pipeline) embedChunks(ctx context.Context, repoRoot string, chunks []Chunk) (*EmbedResult, []PipelineChunk, []ChunkLocation, error) {
+	result := &EmbedResult{
+		Total: len(chunks),
 	}
 
 	// 1. Convert to pipeline chunks with content hashes
@@ -103,38 +248,42 @@ func (p *Pipeline) EmbedChunks(ctx context.Context, repoRoot string, chunks []Ch
 	for i, chunk := range chunks {
 		pChunks[i] = PipelineChunk{
 			Chunk:       chunk,
-			ContentHash: HashContent(chunk.Content),
+			ContentHash: chunk.LocationKey(),
 		}
 	}
 
-	// 2. Collect unique hashes
+	// 2. Collect unique hashes, leaving out those to refresh
 	hashSet := make(map[string]bool)
 	for _, pc := range pChunks {
-		if pc.Content == "" {
+		if !pc.embeds() {
 			result.Skipped++
 			continue
 		}
 		hashSet[pc.ContentHash] = true
 	}
+	refresh := refreshHashes(pChunks)
 
 	uniqueHashes := make([]string, 0, len(hashSet))
 	for hash := range hashSet {
-		uniqueHashes = append(uniqueHashes, hash)
+		if !refresh[hash] {
+			uniqueHashes = append(uniqueHashes, hash)
+		}
 	}
 
 	// 3. Batch lookup existing embeddings
 	cacheStart := time.Now()
 	existing, err := p.cache.GetBatch(uniqueHashes)
 	if err != nil {
-		return nil, fmt.Errorf("cache lookup failed: %w", err)
+		return nil, nil, nil, fmt.Errorf("cache lookup failed: %w", err)
 	}
+	dropFallbackHits(p.embedder, existing)
 	result.CacheHits = len(existing)
 	result.CacheTime = time.Since(cacheStart)
 
 	// 4. Identify chunks needing embedding
 	toEmbed := make([]PipelineChunk, 0)
 	for _, pc := range pChunks {
-		if pc.Content == "" {
+		if !pc.embeds() {
 			continue
 		}
 		if _, found := existing[pc.ContentHash]; !found {
@@ -142,25 +291,46 @@ func (p *Pipeline) EmbedChunks(ctx context.Context, repoRoot string, chunks []Ch
 		}
 	}
 
+	if err := p.checkBudget(toEmbed); err != nil {
+		return nil, nil, nil, err
+	}
+
 	// 5. Embed new chunks
+	var newEmbeddings map[string][]float32
 	if len(toEmbed) > 0 {
 		embedStart := time.Now()
-		newEmbeddings, err := p.embedNewChunks(ctx, toEmbed)
+		var models map[string]string
+		recorder := &latencyRecorder{}
+		newEmbeddings, models, err = p.embedNewChunks(ctx, toEmbed, recorder)
 		if err != nil {
-			return nil, fmt.Errorf("embedding failed: %w", err)
+			return nil, nil, nil, fmt.Errorf("embedding failed: %w", err)
 		}
 		result.EmbedTime = time.Since(embedStart)
+		result.Requests = recorder.stats(result.EmbedTime)
+		p.logRequests(result.Requests)
 
 		// 6. Store in cache
 		cacheStoreStart := time.Now()
-		if err := p.cache.PutBatch(newEmbeddings); err != nil {
-			return nil, fmt.Errorf("cache store failed: %w", err)
+		if err := p.evict(p.cache, refresh); err != nil {
+			return nil, nil, nil, err
+		}
+		if err := p.storeEmbeddings(newEmbeddings, models); err != nil {
+			return nil, nil, nil, fmt.Errorf("cache store failed: %w", err)
 		}
 		result.CacheTime += time.Since(cacheStoreStart)
 
 		result.Embedded = len(newEmbeddings)
 	}
 
+	// Embed with any additional models
+	for _, space := range p.spaces {
+		embedded, err := p.embedModelSpace(ctx, space, pChunks)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("embedding with model %s: %w", space.Model, err)
+		}
+		result.ModelEmbedded += embedded
+	}
+
 	// 7. Save all chunk locations
 	locations := make([]ChunkLocation, 0, len(pChunks)-result.Skipped)
 	for _, pc := range pChunks {
@@ -168,74 +338,572 @@ func (p *Pipeline) EmbedChunks(ctx context.Context, repoRoot string, chunks []Ch
 			continue
 		}
 		locations = append(locations, ChunkLocation{
-			RepoRoot:    repoRoot,
-			Path:        pc.Path,
-			StartLine:   pc.StartLine,
-			EndLine:     pc.EndLine,
-			ContentHash: pc.ContentHash,
-			NodeType:    pc.Kind,
-			NodeName:    "", // Could be extracted from chunk metadata
-			Language:    detectLanguage(pc.Path),
+			RepoRoot:      repoRoot,
+			Path:          pc.Path,
+			StartLine:     pc.StartLine,
+			EndLine:       pc.EndLine,
+			ContentHash:   pc.ContentHash,
+			NodeType:      pc.Kind,
+			NodeName:      pc.Name,
+			Language:      detectLanguage(pc.Path),
+			Metadata:      pc.Metadata,
+			QualifiedName: pc.QualifiedName,
 		})
 	}
 
-	if err := p.locations.SaveLocationsBatch(locations); err != nil {
-		return nil, fmt.Errorf("location store failed: %w", err)
+	// 8. Pool chunk vectors into file-level embeddings
+	if p.fileEmbeddings {
+		vectors := make(map[string][]float32, len(existing)+len(newEmbeddings))
+		for hash, entry := range existing {
+			vectors[hash] = entry.Embedding
+		}
+		for hash, vec := range newEmbeddings {
+			vectors[hash] = vec
+		}
+		fileLocs, err := p.embedFiles(repoRoot, pChunks, vectors)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		locations = append(locations, fileLocs...)
+		result.FileEmbeddings = len(fileLocs)
 	}
 
-	// Calculate final stats
+	return result, pChunks, locations, nil
+}
+
+// finishResult sets result's duration since start and the rates derived
+// from it.
+func finishResult(result *EmbedResult, start time.Time) {
 	result.Duration = time.Since(start)
 	processed := result.Total - result.Skipped
 	if processed > 0 {
 		result.HitRate = float64(result.CacheHits) / float64(processed) * 100
 		result.ChunksPerSec = float64(processed) / result.Duration.Seconds()
 	}
+}
 
-	return result, nil
+// NodeTypeFile is the NodeType of file-level embedding locations.
+const NodeTypeFile = "file"
+
+// FileEmbeddingHash returns the cache key for a file-level embedding pooled
+// from chunks with the given content hashes, in file order. The key changes
+// whenever any chunk changes, so unchanged files reuse their pooled vector.
+func FileEmbeddingHash(chunkHashes []string) string {
+	return HashContent("file:" + strings.Join(chunkHashes, "\n"))
 }
 
-// embedNewChunks embeds chunks that weren't found in cache.
-func (p *Pipeline) embedNewChunks(ctx context.Context, chunks []PipelineChunk) (map[string][]float32, error) {
-	if len(chunks) == 0 {
-		return make(map[string][]float32), nil
+// fileEmbeddingHash is FileEmbeddingHash, with a separate key for the
+// unnormalized means pooled under metrics that do not normalize.
+func (p *Pipeline) fileEmbeddingHash(chunkHashes []string) string {
+	if p.metric.Normalizes() {
+		return FileEmbeddingHash(chunkHashes)
 	}
+	return HashContent("file-mean:" + strings.Join(chunkHashes, "\n"))
+}
 
-	// Deduplicate by hash (multiple chunks may have same content)
-	hashToContent := make(map[string]string)
-	for _, pc := range chunks {
-		hashToContent[pc.ContentHash] = pc.Content
+// embedFiles computes a file-level embedding for each file in pChunks and
+// returns the locations to record for them.
+//
+// File vectors are the mean of the file's chunk vectors, L2-normalized
+// under cosine, rather than an embedding of the whole file's text. Pooling needs no extra embedder
+// calls, is not limited by the model's context window (large files would
+// otherwise be truncated), and reuses vectors already in the cache. The
+// trade-off is that it can only capture what the chunks capture.
+//
+// File locations span the whole file and use StartLine 0 so they never
+// collide with a chunk location covering the same lines. Files with any
+// chunk vector unavailable (e.g. embedding disabled) are skipped.
+func (p *Pipeline) embedFiles(repoRoot string, pChunks []PipelineChunk, vectors map[string][]float32) ([]ChunkLocation, error) {
+	pooled, locations := p.poolFiles(repoRoot, pChunks, vectors)
+	if err := p.evict(p.cache, refreshedFiles(pChunks, locations)); err != nil {
+		return nil, err
+	}
+	if err := p.cache.PutBatch(pooled); err != nil {
+		return nil, fmt.Errorf("storing file embeddings: %w", err)
+	}
+
+	return locations, nil
+}
+
+// poolFiles pools the chunk vectors of each file in pChunks, keyed by
+// chunk hash, and returns the pooled vectors keyed by file hash along with
+// the file locations. Files missing any chunk vector are skipped.
+func (p *Pipeline) poolFiles(repoRoot string, pChunks []PipelineChunk, vectors map[string][]float32) (map[string][]float32, []ChunkLocation) {
+	type fileChunks struct {
+		hashes   []string
+		endLine  int
+		metadata map[string]string // From the file's first chunk
+	}
+
+	var paths []string
+	files := make(map[string]*fileChunks)
+	for _, pc := range pChunks {
+		if !pc.embeds() || pc.Kind == NodeTypeFile {
+			continue
+		}
+		fc, ok := files[pc.Path]
+		if !ok {
+			fc = &fileChunks{metadata: pc.Metadata}
+			files[pc.Path] = fc
+			paths = append(paths, pc.Path)
+		}
+		fc.hashes = append(fc.hashes, pc.ContentHash)
+		fc.endLine = max(fc.endLine, pc.EndLine)
+	}
+
+	pooled := make(map[string][]float32)
+	var locations []ChunkLocation
+	for _, path := range paths {
+		fc := files[path]
+
+		chunkVecs := make([][]float32, 0, len(fc.hashes))
+		for _, hash := range fc.hashes {
+			vec, ok := vectors[hash]
+			if !ok {
+				break
+			}
+			chunkVecs = append(chunkVecs, vec)
+		}
+		if len(chunkVecs) != len(fc.hashes) {
+			continue
+		}
+		vec := p.metric.Pool(chunkVecs)
+		if vec == nil {
+			continue
+		}
+
+		fileHash := p.fileEmbeddingHash(fc.hashes)
+		pooled[fileHash] = vec
+		locations = append(locations, ChunkLocation{
+			RepoRoot:    repoRoot,
+			Path:        path,
+			StartLine:   0,
+			EndLine:     fc.endLine,
+			ContentHash: fileHash,
+			NodeType:    NodeTypeFile,
+			Language:    detectLanguage(path),
+			Metadata:    fc.metadata,
+		})
+	}
+
+	return pooled, locations
+}
+
+// refreshHashes returns the content hashes of the chunks in pChunks to
+// embed again although they may be cached (see Chunk.Refresh).
+func refreshHashes(pChunks []PipelineChunk) map[string]bool {
+	refresh := make(map[string]bool)
+	for _, pc := range pChunks {
+		if pc.Refresh && pc.embeds() {
+			refresh[pc.ContentHash] = true
+		}
+	}
+	return refresh
+}
+
+// refreshedFiles returns the hashes of the pooled file locations whose
+// file has a chunk to refresh.
+func refreshedFiles(pChunks []PipelineChunk, locations []ChunkLocation) map[string]bool {
+	paths := make(map[string]bool)
+	for _, pc := range pChunks {
+		if pc.Refresh {
+			paths[pc.Path] = true
+		}
 	}
+	stale := make(map[string]bool)
+	for _, loc := range locations {
+		if paths[loc.Path] {
+			stale[loc.ContentHash] = true
+		}
+	}
+	return stale
+}
 
-	// Convert to slices for batch embedding
-	hashes := make([]string, 0, len(hashToContent))
-	contents := make([]string, 0, len(hashToContent))
-	for hash, content := range hashToContent {
+// evict deletes the entries for keys from cache, so vectors stored under
+// them next replace the old ones instead of being ignored as duplicates.
+func (p *Pipeline) evict(cache *EmbeddingCache, keys map[string]bool) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	hashes := make([]string, 0, len(keys))
+	for hash := range keys {
 		hashes = append(hashes, hash)
-		contents = append(contents, content)
+	}
+	if err := cache.DeleteBatch(hashes); err != nil {
+		return fmt.Errorf("evicting refreshed embeddings: %w", err)
+	}
+	return nil
+}
+
+// embedModelSpace embeds the chunks whose vectors space does not have yet
+// with its embedder, and pools file vectors for it if file embeddings are
+// enabled. It returns the number of chunk vectors embedded.
+func (p *Pipeline) embedModelSpace(ctx context.Context, space ModelSpace, pChunks []PipelineChunk) (int, error) {
+	var keys []string
+	seen := make(map[string]bool)
+	refresh := refreshHashes(pChunks)
+	for _, pc := range pChunks {
+		if !pc.embeds() || seen[pc.ContentHash] || refresh[pc.ContentHash] {
+			continue
+		}
+		seen[pc.ContentHash] = true
+		keys = append(keys, space.Key(pc.ContentHash))
+	}
+	existing, err := space.Cache.GetBatch(keys)
+	if err != nil {
+		return 0, fmt.Errorf("cache lookup failed: %w", err)
+	}
+	dropFallbackHits(space.Embedder, existing)
+
+	var toEmbed []PipelineChunk
+	for _, pc := range pChunks {
+		if !pc.embeds() {
+			continue
+		}
+		if _, found := existing[space.Key(pc.ContentHash)]; !found {
+			toEmbed = append(toEmbed, pc)
+		}
+	}
+	embeddings, _, err := p.embedWith(ctx, space.Embedder, toEmbed, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	vectors := make(map[string][]float32, len(existing)+len(embeddings))
+	for _, pc := range pChunks {
+		if entry, ok := existing[space.Key(pc.ContentHash)]; ok {
+			vectors[pc.ContentHash] = entry.Embedding
+		}
+	}
+	entries := make(map[string][]float32, len(embeddings))
+	for hash, vec := range embeddings {
+		vectors[hash] = vec
+		entries[space.Key(hash)] = vec
+	}
+	stale := make(map[string]bool, len(refresh))
+	for hash := range refresh {
+		stale[space.Key(hash)] = true
+	}
+	if p.fileEmbeddings {
+		pooled, locations := p.poolFiles("", pChunks, vectors)
+		for hash, vec := range pooled {
+			entries[space.Key(hash)] = vec
+		}
+		for hash := range refreshedFiles(pChunks, locations) {
+			stale[space.Key(hash)] = true
+		}
+	}
+	if err := p.evict(space.Cache, stale); err != nil {
+		return 0, err
+	}
+	if err := space.Cache.PutBatchModel(entries, space.Model); err != nil {
+		return 0, fmt.Errorf("cache store failed: %w", err)
+	}
+
+	return len(embeddings), nil
+}
+
+// embedNewChunks embeds chunks that weren't found in cache, adding the
+// latency of each request to recorder, which may be nil. When the
+// embedder reports the model behind each batch (see ModelEmbedder), the
+// second result maps hashes to it.
+func (p *Pipeline) embedNewChunks(ctx context.Context, chunks []PipelineChunk, recorder *latencyRecorder) (map[string][]float32, map[string]string, error) {
+	return p.embedWith(ctx, p.embedder, chunks, recorder)
+}
+
+// embedWith is embedNewChunks with the given embedder.
+func (p *Pipeline) embedWith(ctx context.Context, embedder Embedder, chunks []PipelineChunk, recorder *latencyRecorder) (map[string][]float32, map[string]string, error) {
+	if len(chunks) == 0 {
+		return make(map[string][]float32), nil, nil
+	}
+
+	// Deduplicate by hash (multiple chunks may have same content), keeping
+	// chunk order
+	seen := make(map[string]bool)
+	hashes := make([]string, 0, len(chunks))
+	contents := make([]string, 0, len(chunks))
+	for _, pc := range chunks {
+		if seen[pc.ContentHash] {
+			continue
+		}
+		seen[pc.ContentHash] = true
+		input := pc.ContextualInput()
+		if truncated, ok := TruncateInput(input, p.maxInputBytes); ok {
+			p.logger.Warn("truncated embedding input",
+				"path", pc.Path,
+				"start_line", pc.StartLine,
+				"end_line", pc.EndLine,
+				"bytes", len(input),
+				"max_bytes", p.maxInputBytes)
+			input = truncated
+		}
+		hashes = append(hashes, pc.ContentHash)
+		contents = append(contents, input)
 	}
 
 	// Embed in batches
 	result := make(map[string][]float32)
+	var models map[string]string
 	for i := 0; i < len(contents); i += p.batchSize {
 		end := i + p.batchSize
 		if end > len(contents) {
 			end = len(contents)
 		}
 
-		batchContents := contents[i:end]
 		batchHashes := hashes[i:end]
-
-		embeddings, err := p.embedder.Embed(ctx, batchContents)
+		embeddings, batchModels, err := p.embedBatch(ctx, embedder, contents[i:end], 0, recorder)
 		if err != nil {
-			return nil, fmt.Errorf("embedding batch %d-%d: %w", i, end, err)
+			return nil, nil, fmt.Errorf("embedding batch %d-%d: %w", i, end, err)
 		}
 
 		for j, emb := range embeddings {
 			result[batchHashes[j]] = emb
+			if batchModels != nil && batchModels[j] != "" {
+				if models == nil {
+					models = make(map[string]string)
+				}
+				models[batchHashes[j]] = batchModels[j]
+			}
 		}
 	}
 
-	return result, nil
+	return result, models, nil
+}
+
+// embedBatch embeds one batch of inputs, returning a vector and, when the
+// embedder reports it, a model for each. A response with a different
+// number of vectors than inputs cannot be matched up with them, so the
+// batch is split in half and each half embedded on its own, up to
+// p.maxBatchSplits levels deep; splits counts the levels already taken.
+func (p *Pipeline) embedBatch(ctx context.Context, embedder Embedder, contents []string, splits int, recorder *latencyRecorder) ([][]float32, []string, error) {
+	var embeddings [][]float32
+	var model string
+	var err error
+	requestStart := time.Now()
+	if modelEmbedder, ok := embedder.(ModelEmbedder); ok {
+		embeddings, model, err = modelEmbedder.EmbedModel(ctx, contents)
+	} else {
+		embeddings, err = embedder.Embed(ctx, contents)
+	}
+	recorder.add(time.Since(requestStart))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// With embedding off no vectors are expected
+	if _, off := embedder.(*NullEmbedder); off {
+		return nil, nil, nil
+	}
+	if len(embeddings) == len(contents) {
+		var models []string
+		if model != "" {
+			models = make([]string, len(contents))
+			for i := range models {
+				models[i] = model
+			}
+		}
+		return embeddings, models, nil
+	}
+	if len(contents) < 2 || splits >= p.maxBatchSplits {
+		return nil, nil, fmt.Errorf("embedder returned %d vectors for %d inputs", len(embeddings), len(contents))
+	}
+
+	p.logger.Warn("embedding count mismatch, splitting batch",
+		"inputs", len(contents),
+		"vectors", len(embeddings),
+		"depth", splits+1)
+	mid := len(contents) / 2
+	first, firstModels, err := p.embedBatch(ctx, embedder, contents[:mid], splits+1, recorder)
+	if err != nil {
+		return nil, nil, err
+	}
+	second, secondModels, err := p.embedBatch(ctx, embedder, contents[mid:], splits+1, recorder)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var models []string
+	if firstModels != nil || secondModels != nil {
+		models = make([]string, len(contents))
+		copy(models, firstModels)
+		copy(models[mid:], secondModels)
+	}
+	return append(first, second...), models, nil
+}
+
+// logRequests logs a summary of embedding backend requests at debug level.
+func (p *Pipeline) logRequests(stats *RequestStats) {
+	if stats == nil {
+		return
+	}
+	p.logger.Debug("embedding requests",
+		"provider", p.embedder.ProviderID(),
+		"requests", stats.Requests,
+		"requests_per_sec", fmt.Sprintf("%.1f", stats.RequestsPerSec),
+		"p50", stats.P50,
+		"p95", stats.P95,
+		"p99", stats.P99,
+		"max", stats.Max)
+}
+
+// BudgetError is returned when a call needs more new embeddings than the
+// limit set with WithMaxEmbeddings.
+type BudgetError struct {
+	Needed int // Distinct chunks not in the cache
+	Max    int // Configured limit
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("%d new embeddings needed, over the limit of %d; check ignore rules or raise the limit",
+		e.Needed, e.Max)
+}
+
+// CheckBudget returns a *BudgetError if needed new embeddings exceed the
+// limit set with WithMaxEmbeddings. Nothing is counted when embedding is
+// off.
+func (p *Pipeline) CheckBudget(needed int) error {
+	if p.maxEmbeddings == 0 {
+		return nil
+	}
+	if _, off := p.embedder.(*NullEmbedder); off {
+		return nil
+	}
+	if needed > p.maxEmbeddings {
+		return &BudgetError{Needed: needed, Max: p.maxEmbeddings}
+	}
+	return nil
+}
+
+// checkBudget is CheckBudget for chunks about to be embedded. Chunks
+// sharing a content hash count once.
+func (p *Pipeline) checkBudget(chunks []PipelineChunk) error {
+	hashes := make(map[string]bool, len(chunks))
+	for _, pc := range chunks {
+		hashes[pc.ContentHash] = true
+	}
+	return p.CheckBudget(len(hashes))
+}
+
+// MissingEmbeddings returns how many of the given cache keys (see
+// Chunk.CacheKey) have no cached embedding. Keys must be distinct. Lookups
+// do not count as cache accesses.
+func (p *Pipeline) MissingEmbeddings(hashes []string) (int, error) {
+	missing, err := p.missingHashes(hashes)
+	if err != nil {
+		return 0, err
+	}
+	return len(missing), nil
+}
+
+// missingHashes returns the given cache keys that have no cached
+// embedding, in their original order, querying the cache in batches.
+func (p *Pipeline) missingHashes(hashes []string) ([]string, error) {
+	var missing []string
+	for i := 0; i < len(hashes); i += hasEntryBatchSize {
+		end := min(i+hasEntryBatchSize, len(hashes))
+		exists, err := p.cache.HasEntryBatch(hashes[i:end])
+		if err != nil {
+			return nil, fmt.Errorf("checking cache: %w", err)
+		}
+		for _, hash := range hashes[i:end] {
+			if !exists[hash] {
+				missing = append(missing, hash)
+			}
+		}
+	}
+	return missing, nil
+}
+
+// EmbeddingCoverage reports how many of a repo's distinct chunk hashes
+// have a cached embedding.
+type EmbeddingCoverage struct {
+	Hashes        int      `json:"hashes"`                   // Distinct content hashes with a location in the repo
+	Embedded      int      `json:"embedded"`                 // Hashes found in the cache
+	Missing       int      `json:"missing"`                  // Hashes not found in the cache
+	MissingHashes []string `json:"missing_hashes,omitempty"` // Sorted; only filled in on request
+}
+
+// Percent returns the share of hashes that are embedded, from 0 to 100.
+// A repo with no chunks is fully embedded.
+func (c *EmbeddingCoverage) Percent() float64 {
+	if c.Hashes == 0 {
+		return 100
+	}
+	return 100 * float64(c.Embedded) / float64(c.Hashes)
+}
+
+// Coverage reports which of repoRoot's chunk hashes lack a cached
+// embedding. With withHashes, the missing hashes themselves are returned
+// too; otherwise only the counts. LocationOnly chunks are not counted.
+// Lookups do not count as cache accesses.
+func (p *Pipeline) Coverage(repoRoot string, withHashes bool) (*EmbeddingCoverage, error) {
+	all, err := p.locations.GetHashesForRepo(repoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("getting hashes: %w", err)
+	}
+	hashes := all[:0]
+	for _, hash := range all {
+		if !strings.HasPrefix(hash, LocationOnlyPrefix) {
+			hashes = append(hashes, hash)
+		}
+	}
+	sort.Strings(hashes)
+
+	missing, err := p.missingHashes(hashes)
+	if err != nil {
+		return nil, err
+	}
+	coverage := &EmbeddingCoverage{
+		Hashes:   len(hashes),
+		Embedded: len(hashes) - len(missing),
+		Missing:  len(missing),
+	}
+	if withHashes {
+		coverage.MissingHashes = missing
+	}
+	return coverage, nil
+}
+
+// storeEmbeddings writes new vectors to the cache, tagged with the model
+// that produced them. Hashes missing from models use the cache's model.
+func (p *Pipeline) storeEmbeddings(vectors map[string][]float32, models map[string]string) error {
+	byModel := make(map[string]map[string][]float32)
+	for hash, vec := range vectors {
+		model := models[hash]
+		if model == "" {
+			model = p.cache.Model()
+		}
+		if byModel[model] == nil {
+			byModel[model] = make(map[string][]float32)
+		}
+		byModel[model][hash] = vec
+	}
+
+	for model, entries := range byModel {
+		if err := p.cache.PutBatchModel(entries, model); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TruncateInput shortens text to at most maxBytes, cutting at a line break
+// when one falls in the last quarter of the allowed range and never inside
+// a UTF-8 sequence. It reports whether text was truncated. A maxBytes of
+// zero or less means no limit.
+func TruncateInput(text string, maxBytes int) (string, bool) {
+	if maxBytes <= 0 || len(text) <= maxBytes {
+		return text, false
+	}
+
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	if nl := strings.LastIndexByte(text[:cut], '\n'); nl >= cut*3/4 {
+		cut = nl + 1
+	}
+	return text[:cut], true
 }
 
 // EmbedFile processes a single file through the pipeline.
@@ -260,6 +928,20 @@ func (p *Pipeline) ReindexFile(ctx context.Context, repoRoot, path string, chunk
 	return p.EmbedChunks(ctx, repoRoot, chunks)
 }
 
+// RenameFile records that a file moved from oldPath to newPath with its
+// content unchanged, by moving its locations (see
+// LocationStore.RenamePath). Nothing is chunked or embedded and the cache
+// is not touched, so it is only correct when the new path chunks and
+// describes the content exactly as the old one did. It returns the number
+// of locations moved.
+func (p *Pipeline) RenameFile(repoRoot, oldPath, newPath string) (int, error) {
+	n, err := p.locations.RenamePath(repoRoot, oldPath, newPath)
+	if err != nil {
+		return 0, fmt.Errorf("renaming locations: %w", err)
+	}
+	return n, nil
+}
+
 // ReindexRepo re-indexes an entire repository.
 // Clears all locations and processes new chunks.
 func (p *Pipeline) ReindexRepo(ctx context.Context, repoRoot string, chunks []Chunk) (*EmbedResult, error) {
@@ -287,9 +969,18 @@ func (p *Pipeline) IncrementalUpdate(ctx context.Context, repoRoot string, files
 
 		// Compute new hashes
 		newHashes := make(map[string]bool)
+		chunkHashes := make([]string, 0, len(chunks))
 		for _, chunk := range chunks {
-			hash := HashContent(chunk.Content)
+			hash := chunk.LocationKey()
 			newHashes[hash] = true
+			if chunk.embeds() {
+				chunkHashes = append(chunkHashes, hash)
+			}
+		}
+		expected := len(chunks)
+		if p.fileEmbeddings && len(chunks) > 0 {
+			newHashes[p.fileEmbeddingHash(chunkHashes)] = true
+			expected++
 		}
 
 		// Check if file has changed
@@ -298,7 +989,7 @@ func (p *Pipeline) IncrementalUpdate(ctx context.Context, repoRoot string, files
 			existingSet[h] = true
 		}
 
-		changed := len(existingHashes) != len(chunks)
+		changed := len(existingHashes) != expected
 		if !changed {
 			for hash := range newHashes {
 				if !existingSet[hash] {
@@ -316,7 +1007,12 @@ func (p *Pipeline) IncrementalUpdate(ctx context.Context, repoRoot string, files
 		}
 
 		// File changed, re-index
-		result, err := p.ReindexFile(ctx, repoRoot, path, chunks)
+		var result *EmbedResult
+		if p.chunkDeltas {
+			result, err = p.EmbedFiles(ctx, repoRoot, []string{path}, chunks)
+		} else {
+			result, err = p.ReindexFile(ctx, repoRoot, path, chunks)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("reindexing %s: %w", path, err)
 		}
@@ -329,6 +1025,11 @@ func (p *Pipeline) IncrementalUpdate(ctx context.Context, repoRoot string, files
 		totalResult.Errors += result.Errors
 		totalResult.EmbedTime += result.EmbedTime
 		totalResult.CacheTime += result.CacheTime
+		totalResult.FileEmbeddings += result.FileEmbeddings
+		totalResult.Requests = totalResult.Requests.Merge(result.Requests)
+		totalResult.LocationsWritten += result.LocationsWritten
+		totalResult.LocationsDeleted += result.LocationsDeleted
+		totalResult.LocationsUnchanged += result.LocationsUnchanged
 	}
 
 	totalResult.Duration = time.Since(start)
@@ -340,23 +1041,280 @@ func (p *Pipeline) IncrementalUpdate(ctx context.Context, repoRoot string, files
 	return totalResult, nil
 }
 
-// CleanupOrphanedEmbeddings removes embeddings not referenced by any location.
+// EmbedFiles embeds chunks, which are all of the chunks of the files at
+// paths, as EmbedChunks does. With WithChunkDeltas it then updates the
+// locations recorded for each file to the delta from its chunks: a
+// recorded location left without a chunk is deleted, and a chunk's
+// location is written unless an identical one is recorded. Locations are
+// matched by content hash, so a chunk that only moved is told apart from
+// new code and its content is not stored again. Every chunk is still
+// looked up in the cache, so unchanged chunks count as cache hits. A file
+// at paths without chunks has its locations deleted.
+//
+// Without WithChunkDeltas it is EmbedChunks.
+func (p *Pipeline) EmbedFiles(ctx context.Context, repoRoot string, paths []string, chunks []Chunk) (*EmbedResult, error) {
+	if !p.chunkDeltas {
+		return p.EmbedChunks(ctx, repoRoot, chunks)
+	}
+
+	start := time.Now()
+	result := &EmbedResult{}
+	var pChunks []PipelineChunk
+	var locations []ChunkLocation
+	if len(chunks) > 0 {
+		var err error
+		result, pChunks, locations, err = p.embedChunks(ctx, repoRoot, chunks)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	chunksByPath := make(map[string][]PipelineChunk)
+	for _, pc := range pChunks {
+		path := NormalizePath(pc.Path)
+		chunksByPath[path] = append(chunksByPath[path], pc)
+	}
+	locationsByPath := make(map[string][]ChunkLocation)
+	for _, loc := range locations {
+		path := NormalizePath(loc.Path)
+		locationsByPath[path] = append(locationsByPath[path], loc)
+	}
+	for _, path := range paths {
+		path = NormalizePath(path)
+		if err := p.writeDelta(repoRoot, path, chunksByPath[path], locationsByPath[path], result); err != nil {
+			return nil, fmt.Errorf("updating locations of %s: %w", path, err)
+		}
+	}
+
+	finishResult(result, start)
+	return result, nil
+}
+
+// writeDelta updates the locations recorded for the file at path to
+// locations, the new locations of its chunks pChunks, as described for
+// EmbedFiles, and counts the rows written, deleted and left in result.
+func (p *Pipeline) writeDelta(repoRoot, path string, pChunks []PipelineChunk, locations []ChunkLocation, result *EmbedResult) error {
+	existing, err := p.locations.GetByPath(repoRoot, path)
+	if err != nil {
+		return fmt.Errorf("getting locations: %w", err)
+	}
+	recorded := make(map[string][]ChunkLocation, len(existing))
+	for _, loc := range existing {
+		recorded[loc.ContentHash] = append(recorded[loc.ContentHash], loc)
+	}
+
+	type lineRange struct{ start, end int }
+	writing := make(map[lineRange]bool)
+	newHashes := make(map[string]bool)
+	var changed, stale []ChunkLocation
+	for _, loc := range locations {
+		// Prefer the recorded location of the same content that is
+		// identical, then any other, which the chunk moved from
+		candidates := recorded[loc.ContentHash]
+		match := -1
+		for i, old := range candidates {
+			if sameLocation(old, loc) {
+				match = i
+				break
+			}
+		}
+		if match < 0 && len(candidates) > 0 {
+			match = 0
+		}
+		if match >= 0 {
+			old := candidates[match]
+			recorded[loc.ContentHash] = append(candidates[:match:match], candidates[match+1:]...)
+			if sameLocation(old, loc) {
+				result.LocationsUnchanged++
+				continue
+			}
+			stale = append(stale, old) // The chunk moved
+		} else {
+			newHashes[loc.ContentHash] = true
+		}
+		changed = append(changed, loc)
+		writing[lineRange{loc.StartLine, loc.EndLine}] = true
+	}
+
+	// Rows at lines being written are replaced by the upsert
+	for _, locs := range recorded {
+		stale = append(stale, locs...)
+	}
+	var removed []ChunkLocation
+	for _, loc := range stale {
+		if !writing[lineRange{loc.StartLine, loc.EndLine}] {
+			removed = append(removed, loc)
+		}
+	}
+
+	var newChunks []PipelineChunk
+	for _, pc := range pChunks {
+		if newHashes[pc.ContentHash] {
+			newChunks = append(newChunks, pc)
+		}
+	}
+	if err := p.storeContents(newChunks); err != nil {
+		return err
+	}
+	if err := p.locations.DeleteLocations(removed); err != nil {
+		return fmt.Errorf("deleting old locations: %w", err)
+	}
+	if err := p.locations.SaveLocationsBatch(changed); err != nil {
+		return fmt.Errorf("location store failed: %w", err)
+	}
+	result.LocationsWritten += len(changed)
+	result.LocationsDeleted += len(removed)
+	return nil
+}
+
+// sameLocation reports whether a and b record the same chunk at the same
+// lines, ignoring row IDs and creation times.
+func sameLocation(a, b ChunkLocation) bool {
+	return a.StartLine == b.StartLine &&
+		a.EndLine == b.EndLine &&
+		a.ContentHash == b.ContentHash &&
+		a.NodeType == b.NodeType &&
+		a.NodeName == b.NodeName &&
+		a.Language == b.Language &&
+		a.QualifiedName == b.QualifiedName &&
+		maps.Equal(a.Metadata, b.Metadata)
+}
+
+// CleanupOrphanedEmbeddings removes the embeddings that no location of any
+// repository references, and returns how many it removed. The cache is
+// read a batch of hashes at a time; each batch's orphans are found with
+// LocationStore.GetOrphanedHashes and deleted before the next is read.
 func (p *Pipeline) CleanupOrphanedEmbeddings(ctx context.Context) (int, error) {
-	// Get all cache hashes
-	stats, err := p.cache.Stats()
+	removed := 0
+	_, err := p.orphanPages(ctx, func(cache *EmbeddingCache, orphaned []OrphanedEmbedding) error {
+		hashes := make([]string, len(orphaned))
+		for i, orphan := range orphaned {
+			hashes[i] = orphan.ContentHash
+		}
+		if err := cache.DeleteBatch(hashes); err != nil {
+			return fmt.Errorf("deleting orphaned embeddings: %w", err)
+		}
+		removed += len(hashes)
+		return nil
+	})
+	return removed, err
+}
+
+// MissingResult contains statistics from an EmbedMissing run.
+type MissingResult struct {
+	Locations    int           `json:"locations"`     // Locations in the repo
+	UniqueHashes int           `json:"unique_hashes"` // Distinct content hashes referenced
+	Missing      int           `json:"missing"`       // Hashes not found in the cache
+	Files        int           `json:"files"`         // Files re-chunked to recover content
+	Embedded     int           `json:"embedded"`      // Missing hashes that were embedded
+	Unresolved   int           `json:"unresolved"`    // Missing hashes whose content could not be recovered
+	Duration     time.Duration `json:"duration"`
+	Requests     *RequestStats `json:"requests,omitempty"` // Embedding backend requests; nil if none
+}
+
+// hasEntryBatchSize bounds the number of hashes per HasEntryBatch query
+// to stay well under database parameter limits.
+const hasEntryBatchSize = 500
+
+// EmbedMissing fills in cache entries for chunks that have a location in
+// repoRoot but whose content hash is not in the embedding cache (e.g. after
+// eviction or a model change). Only files containing a missing hash are
+// re-chunked, via chunkFile, and only chunks with a missing hash are sent to
+// the embedder. Locations are not modified.
+//
+// Missing hashes whose content no longer appears in the file (the file
+// changed since it was indexed) are counted as Unresolved.
+func (p *Pipeline) EmbedMissing(ctx context.Context, repoRoot string, chunkFile func(path string) ([]Chunk, error)) (*MissingResult, error) {
+	start := time.Now()
+	result := &MissingResult{}
+
+	locs, err := p.locations.GetByRepo(repoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("getting locations: %w", err)
+	}
+	result.Locations = len(locs)
+
+	// Map each hash to the files that reference it
+	hashPaths := make(map[string][]string)
+	for _, loc := range locs {
+		hashPaths[loc.ContentHash] = append(hashPaths[loc.ContentHash], loc.Path)
+	}
+
+	// Find hashes absent from the cache
+	coverage, err := p.Coverage(repoRoot, true)
 	if err != nil {
-		return 0, fmt.Errorf("getting cache stats: %w", err)
+		return nil, err
+	}
+	result.UniqueHashes = coverage.Hashes
+	result.Missing = coverage.Missing
+	missing := make(map[string]bool, len(coverage.MissingHashes))
+	for _, hash := range coverage.MissingHashes {
+		missing[hash] = true
+	}
+
+	if len(missing) == 0 {
+		result.Duration = time.Since(start)
+		return result, nil
 	}
 
-	if stats.TotalEntries == 0 {
-		return 0, nil
+	// Collect the files that hold missing content
+	fileSet := make(map[string]bool)
+	for hash := range missing {
+		for _, path := range hashPaths[hash] {
+			fileSet[path] = true
+		}
+	}
+	files := make([]string, 0, len(fileSet))
+	for path := range fileSet {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	result.Files = len(files)
+
+	// Re-chunk those files and keep only chunks with a missing hash
+	toEmbed := make([]PipelineChunk, 0, len(missing))
+	found := make(map[string]bool)
+	for _, path := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		chunks, err := chunkFile(path)
+		if err != nil {
+			continue
+		}
+		for _, chunk := range chunks {
+			hash := chunk.CacheKey()
+			if missing[hash] && !found[hash] {
+				found[hash] = true
+				toEmbed = append(toEmbed, PipelineChunk{Chunk: chunk, ContentHash: hash})
+			}
+		}
 	}
 
-	// This is a simplified approach - in production, you'd want to
-	// iterate through cache entries in batches
-	// For now, we'll skip this optimization
+	if err := p.checkBudget(toEmbed); err != nil {
+		return nil, err
+	}
 
-	return 0, nil
+	if len(toEmbed) > 0 {
+		embedStart := time.Now()
+		recorder := &latencyRecorder{}
+		embeddings, models, err := p.embedNewChunks(ctx, toEmbed, recorder)
+		if err != nil {
+			return nil, fmt.Errorf("embedding failed: %w", err)
+		}
+		result.Requests = recorder.stats(time.Since(embedStart))
+		p.logRequests(result.Requests)
+		if err := p.storeEmbeddings(embeddings, models); err != nil {
+			return nil, fmt.Errorf("cache store failed: %w", err)
+		}
+		result.Embedded = len(embeddings)
+	}
+
+	result.Unresolved = result.Missing - result.Embedded
+	result.Duration = time.Since(start)
+
+	return result, nil
 }
 
 // ParallelEmbedChunks embeds chunks using multiple workers.
@@ -377,23 +1335,26 @@ func (p *Pipeline) ParallelEmbedChunks(ctx context.Context, repoRoot string, chu
 	for i, chunk := range chunks {
 		pChunks[i] = PipelineChunk{
 			Chunk:       chunk,
-			ContentHash: HashContent(chunk.Content),
+			ContentHash: chunk.LocationKey(),
 		}
 	}
 
-	// Collect unique hashes
+	// Collect unique hashes, leaving out those to refresh
 	hashSet := make(map[string]bool)
 	for _, pc := range pChunks {
-		if pc.Content == "" {
+		if !pc.embeds() {
 			result.Skipped++
 			continue
 		}
 		hashSet[pc.ContentHash] = true
 	}
+	refresh := refreshHashes(pChunks)
 
 	uniqueHashes := make([]string, 0, len(hashSet))
 	for hash := range hashSet {
-		uniqueHashes = append(uniqueHashes, hash)
+		if !refresh[hash] {
+			uniqueHashes = append(uniqueHashes, hash)
+		}
 	}
 
 	// Batch lookup existing embeddings
@@ -401,12 +1362,13 @@ func (p *Pipeline) ParallelEmbedChunks(ctx context.Context, repoRoot string, chu
 	if err != nil {
 		return nil, fmt.Errorf("cache lookup failed: %w", err)
 	}
+	dropFallbackHits(p.embedder, existing)
 	result.CacheHits = len(existing)
 
 	// Identify chunks needing embedding
 	var toEmbed []PipelineChunk
 	for _, pc := range pChunks {
-		if pc.Content == "" {
+		if !pc.embeds() {
 			continue
 		}
 		if _, found := existing[pc.ContentHash]; !found {
@@ -414,13 +1376,25 @@ func (p *Pipeline) ParallelEmbedChunks(ctx context.Context, repoRoot string, chu
 		}
 	}
 
+	if err := p.checkBudget(toEmbed); err != nil {
+		return nil, err
+	}
+
 	// Parallel embedding
+	allEmbeddings := make(map[string][]float32)
+	allModels := make(map[string]string)
 	if len(toEmbed) > 0 {
 		// Split into work items
 		workItems := splitIntoBatches(toEmbed, p.batchSize)
+		embedStart := time.Now()
+		recorder := &latencyRecorder{}
 
 		// Create worker pool
-		results := make(chan map[string][]float32, len(workItems))
+		type batchResult struct {
+			embeddings map[string][]float32
+			models     map[string]string
+		}
+		results := make(chan batchResult, len(workItems))
 		errors := make(chan error, len(workItems))
 
 		var wg sync.WaitGroup
@@ -433,12 +1407,12 @@ func (p *Pipeline) ParallelEmbedChunks(ctx context.Context, repoRoot string, chu
 				sem <- struct{}{}
 				defer func() { <-sem }()
 
-				embeddings, err := p.embedNewChunks(ctx, batch)
+				embeddings, models, err := p.embedNewChunks(ctx, batch, recorder)
 				if err != nil {
 					errors <- err
 					return
 				}
-				results <- embeddings
+				results <- batchResult{embeddings, models}
 			}(batch)
 		}
 
@@ -450,11 +1424,13 @@ func (p *Pipeline) ParallelEmbedChunks(ctx context.Context, repoRoot string, chu
 		}()
 
 		// Collect results
-		allEmbeddings := make(map[string][]float32)
-		for emb := range results {
-			for hash, vec := range emb {
+		for res := range results {
+			for hash, vec := range res.embeddings {
 				allEmbeddings[hash] = vec
 			}
+			for hash, model := range res.models {
+				allModels[hash] = model
+			}
 		}
 
 		// Check for errors
@@ -463,9 +1439,15 @@ func (p *Pipeline) ParallelEmbedChunks(ctx context.Context, repoRoot string, chu
 				return nil, err
 			}
 		}
+		result.EmbedTime = time.Since(embedStart)
+		result.Requests = recorder.stats(result.EmbedTime)
+		p.logRequests(result.Requests)
 
 		// Store in cache
-		if err := p.cache.PutBatch(allEmbeddings); err != nil {
+		if err := p.evict(p.cache, refresh); err != nil {
+			return nil, err
+		}
+		if err := p.storeEmbeddings(allEmbeddings, allModels); err != nil {
 			return nil, fmt.Errorf("cache store failed: %w", err)
 		}
 
@@ -479,28 +1461,44 @@ func (p *Pipeline) ParallelEmbedChunks(ctx context.Context, repoRoot string, chu
 			continue
 		}
 		locations = append(locations, ChunkLocation{
-			RepoRoot:    repoRoot,
-			Path:        pc.Path,
-			StartLine:   pc.StartLine,
-			EndLine:     pc.EndLine,
-			ContentHash: pc.ContentHash,
-			NodeType:    pc.Kind,
-			Language:    detectLanguage(pc.Path),
+			RepoRoot:      repoRoot,
+			Path:          pc.Path,
+			StartLine:     pc.StartLine,
+			EndLine:       pc.EndLine,
+			ContentHash:   pc.ContentHash,
+			NodeType:      pc.Kind,
+			NodeName:      pc.Name,
+			Language:      detectLanguage(pc.Path),
+			Metadata:      pc.Metadata,
+			QualifiedName: pc.QualifiedName,
 		})
 	}
 
-	if err := p.locations.SaveLocationsBatch(locations); err != nil {
-		return nil, fmt.Errorf("location store failed: %w", err)
+	// Pool chunk vectors into file-level embeddings
+	if p.fileEmbeddings {
+		vectors := make(map[string][]float32, len(existing)+len(allEmbeddings))
+		for hash, entry := range existing {
+			vectors[hash] = entry.Embedding
+		}
+		for hash, vec := range allEmbeddings {
+			vectors[hash] = vec
+		}
+		fileLocs, err := p.embedFiles(repoRoot, pChunks, vectors)
+		if err != nil {
+			return nil, err
+		}
+		locations = append(locations, fileLocs...)
+		result.FileEmbeddings = len(fileLocs)
 	}
 
-	// Calculate final stats
-	result.Duration = time.Since(start)
-	processed := result.Total - result.Skipped
-	if processed > 0 {
-		result.HitRate = float64(result.CacheHits) / float64(processed) * 100
-		result.ChunksPerSec = float64(processed) / result.Duration.Seconds()
+	if err := p.storeContents(pChunks); err != nil {
+		return nil, err
+	}
+	if err := p.locations.SaveLocationsBatch(locations); err != nil {
+		return nil, fmt.Errorf("location store failed: %w", err)
 	}
 
+	finishResult(result, start)
 	return result, nil
 }
 
@@ -587,6 +1585,24 @@ func detectLanguage(path string) string {
 	}
 }
 
+// storeContents saves the content of chunks to the content store, if the
+// pipeline has one.
+func (p *Pipeline) storeContents(chunks []PipelineChunk) error {
+	if p.contents == nil {
+		return nil
+	}
+	contents := make(map[string]string, len(chunks))
+	for _, pc := range chunks {
+		if pc.Content != "" {
+			contents[pc.ContentHash] = pc.Content
+		}
+	}
+	if err := p.contents.PutBatch(contents); err != nil {
+		return fmt.Errorf("content store failed: %w", err)
+	}
+	return nil
+}
+
 // Cache returns the underlying embedding cache.
 func (p *Pipeline) Cache() *EmbeddingCache {
 	return p.cache
@@ -597,7 +1613,34 @@ func (p *Pipeline) Locations() *LocationStore {
 	return p.locations
 }
 
+// Contents returns the content store, or nil if content is not stored.
+func (p *Pipeline) Contents() *ContentStore {
+	return p.contents
+}
+
 // Embedder returns the underlying embedder.
 func (p *Pipeline) Embedder() Embedder {
 	return p.embedder
 }
+
+// Close waits for the pipeline's background writes, the cache access stat
+// updates of every model space's cache, to be committed. Call it before
+// closing the database. It returns ctx's error if ctx is done first.
+func (p *Pipeline) Close(ctx context.Context) error {
+	// Each cache queues its own updates, even when model spaces share a
+	// table as on SQLite, so unlike caches() this keeps every one
+	caches := []*EmbeddingCache{p.cache}
+	for _, space := range p.spaces {
+		if space.Cache != p.cache {
+			caches = append(caches, space.Cache)
+		}
+	}
+
+	var errs []error
+	for _, cache := range caches {
+		if err := cache.Flush(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -1,8 +1,16 @@
 package embedding
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"codetect/internal/db"
 )
@@ -12,6 +20,7 @@ type mockEmbedder struct {
 	embedCount int
 	dimensions int
 	available  bool
+	inputs     []string
 }
 
 func newMockEmbedder(dims int) *mockEmbedder {
@@ -23,6 +32,7 @@ func newMockEmbedder(dims int) *mockEmbedder {
 
 func (m *mockEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
 	m.embedCount += len(texts)
+	m.inputs = append(m.inputs, texts...)
 	result := make([][]float32, len(texts))
 	for i, text := range texts {
 		// Generate deterministic embedding based on text
@@ -374,6 +384,84 @@ func TestIncrementalUpdate(t *testing.T) {
 	t.Logf("IncrementalUpdate result: %+v", result)
 }
 
+func TestIncrementalUpdateChunkDeltas(t *testing.T) {
+	pipeline, embedder := setupTestPipeline(t)
+	WithChunkDeltas(true)(pipeline)
+	ctx := context.Background()
+
+	// A file of 20 five-line functions
+	fileChunks := func(edited int, body string) []Chunk {
+		chunks := make([]Chunk, 20)
+		for i := range chunks {
+			content := fmt.Sprintf("func f%02d() {\n\treturn %d\n}", i, i)
+			if i == edited {
+				content = body
+			}
+			chunks[i] = Chunk{
+				Path: "big.go", StartLine: i*5 + 1, EndLine: i*5 + 5,
+				Content: content, Kind: "function_declaration", Name: fmt.Sprintf("f%02d", i),
+			}
+		}
+		return chunks
+	}
+	if _, err := pipeline.EmbedChunks(ctx, "/project", fileChunks(-1, "")); err != nil {
+		t.Fatalf("initial EmbedChunks failed: %v", err)
+	}
+	before, err := pipeline.Locations().GetByPath("/project", "big.go")
+	if err != nil {
+		t.Fatalf("GetByPath failed: %v", err)
+	}
+	embedder.embedCount = 0
+
+	// Edit one function in place
+	edited := fileChunks(7, "func f07() {\n\treturn 700\n}")
+	result, err := pipeline.IncrementalUpdate(ctx, "/project", map[string][]Chunk{"big.go": edited})
+	if err != nil {
+		t.Fatalf("IncrementalUpdate failed: %v", err)
+	}
+	if result.LocationsWritten != 1 || result.LocationsDeleted != 0 || result.LocationsUnchanged != 19 {
+		t.Errorf("written/deleted/unchanged = %d/%d/%d, want 1/0/19",
+			result.LocationsWritten, result.LocationsDeleted, result.LocationsUnchanged)
+	}
+	if result.CacheHits != 19 || result.Embedded != 1 || embedder.embedCount != 1 {
+		t.Errorf("CacheHits = %d, Embedded = %d, embedded texts = %d; want 19, 1, 1",
+			result.CacheHits, result.Embedded, embedder.embedCount)
+	}
+
+	after, err := pipeline.Locations().GetByPath("/project", "big.go")
+	if err != nil {
+		t.Fatalf("GetByPath failed: %v", err)
+	}
+	if len(after) != 20 {
+		t.Fatalf("got %d locations after the update, want 20", len(after))
+	}
+	// Unchanged rows are left in place rather than deleted and re-inserted
+	var rewritten []string
+	for i := range after {
+		if after[i].ContentHash != before[i].ContentHash {
+			rewritten = append(rewritten, after[i].NodeName)
+		} else if after[i].ID != before[i].ID {
+			t.Errorf("unchanged %s was re-inserted", after[i].NodeName)
+		}
+	}
+	if len(rewritten) != 1 || rewritten[0] != "f07" {
+		t.Errorf("rows changed for %v, want only f07", rewritten)
+	}
+
+	// Removing the last function deletes its row and writes nothing else
+	result, err = pipeline.IncrementalUpdate(ctx, "/project", map[string][]Chunk{"big.go": edited[:19]})
+	if err != nil {
+		t.Fatalf("IncrementalUpdate failed: %v", err)
+	}
+	if result.LocationsWritten != 0 || result.LocationsDeleted != 1 || result.LocationsUnchanged != 19 {
+		t.Errorf("written/deleted/unchanged = %d/%d/%d, want 0/1/19",
+			result.LocationsWritten, result.LocationsDeleted, result.LocationsUnchanged)
+	}
+	if n, _ := pipeline.Locations().CountByPath("/project", "big.go"); n != 19 {
+		t.Errorf("got %d locations, want 19", n)
+	}
+}
+
 func TestPipelineStats(t *testing.T) {
 	pipeline, _ := setupTestPipeline(t)
 	ctx := context.Background()
@@ -555,6 +643,139 @@ func TestPipelineAccessors(t *testing.T) {
 	}
 }
 
+func TestEmbedChunksBudget(t *testing.T) {
+	pipeline, embedder := setupTestPipeline(t)
+	WithMaxEmbeddings(2)(pipeline)
+	ctx := context.Background()
+
+	chunks := []Chunk{
+		{Path: "a.go", StartLine: 1, EndLine: 3, Content: "func a() {}"},
+		{Path: "b.go", StartLine: 1, EndLine: 3, Content: "func b() {}"},
+		{Path: "c.go", StartLine: 1, EndLine: 3, Content: "func c() {}"},
+		{Path: "d.go", StartLine: 1, EndLine: 3, Content: "func a() {}"}, // Same content as a.go
+	}
+
+	_, err := pipeline.EmbedChunks(ctx, "/project", chunks)
+	var budgetErr *BudgetError
+	if !errors.As(err, &budgetErr) {
+		t.Fatalf("EmbedChunks error = %v, want *BudgetError", err)
+	}
+	if budgetErr.Needed != 3 || budgetErr.Max != 2 {
+		t.Errorf("BudgetError = %+v, want 3 needed of 2", budgetErr)
+	}
+	if embedder.embedCount != 0 {
+		t.Errorf("embedded %d texts despite the budget", embedder.embedCount)
+	}
+	if locs, _ := pipeline.Locations().GetByRepo("/project"); len(locs) != 0 {
+		t.Errorf("refused run saved %d locations", len(locs))
+	}
+
+	// Cached content does not count against the budget
+	if _, err := pipeline.EmbedChunks(ctx, "/project", chunks[:2]); err != nil {
+		t.Fatalf("EmbedChunks within budget failed: %v", err)
+	}
+	if n, err := pipeline.MissingEmbeddings([]string{chunks[0].CacheKey(), chunks[2].CacheKey()}); err != nil || n != 1 {
+		t.Errorf("MissingEmbeddings = %d, %v; want 1", n, err)
+	}
+	result, err := pipeline.EmbedChunks(ctx, "/project", chunks)
+	if err != nil {
+		t.Fatalf("EmbedChunks with cached content failed: %v", err)
+	}
+	if result.Embedded != 1 {
+		t.Errorf("Embedded = %d, want 1", result.Embedded)
+	}
+}
+
+func TestPipelineCloseWaitsForAccessStats(t *testing.T) {
+	// Stat updates run on other connections, so use a file that they share
+	cfg := db.DefaultConfig(filepath.Join(t.TempDir(), "index.db"))
+	database, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	cache, err := NewEmbeddingCache(database, cfg.Dialect(), 768, "test-model")
+	if err != nil {
+		t.Fatalf("creating cache: %v", err)
+	}
+	locations, err := NewLocationStore(database, cfg.Dialect())
+	if err != nil {
+		t.Fatalf("creating location store: %v", err)
+	}
+	pipeline := NewPipeline(cache, locations, newMockEmbedder(768))
+	ctx := context.Background()
+
+	chunks := []Chunk{
+		{Path: "a.go", StartLine: 1, EndLine: 10, Content: "func a() {}"},
+		{Path: "b.go", StartLine: 1, EndLine: 10, Content: "func b() {}"},
+	}
+	if _, err := pipeline.EmbedChunks(ctx, "/project", chunks); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	if err := pipeline.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	accessCount := func() int {
+		var total int
+		query := "SELECT COALESCE(SUM(access_count), 0) FROM " + cache.tableName()
+		if err := cache.database.QueryRow(query).Scan(&total); err != nil {
+			t.Fatalf("reading access counts: %v", err)
+		}
+		return total
+	}
+	before := accessCount()
+
+	// Every lookup queues a stat update in the background
+	const lookups = 20
+	for i := 0; i < lookups; i++ {
+		if _, err := cache.GetBatch([]string{chunks[0].CacheKey(), chunks[1].CacheKey()}); err != nil {
+			t.Fatalf("GetBatch failed: %v", err)
+		}
+	}
+	if err := pipeline.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if got, want := accessCount()-before, lookups*len(chunks); got != want {
+		t.Errorf("access count grew by %d after Close, want %d", got, want)
+	}
+}
+
+func TestPipelineCloseContextDone(t *testing.T) {
+	pipeline, _ := setupTestPipeline(t)
+
+	stallStatsWriter(pipeline.Cache())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := pipeline.Close(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Close with pending writes = %v, want context.Canceled", err)
+	}
+}
+
+func TestPipelineCloseModelSpaces(t *testing.T) {
+	pipeline, _ := setupTestPipeline(t)
+	primary := pipeline.Cache()
+
+	other := &namedEmbedder{keywordEmbedder{keywords: []string{"gamma", "delta"}}, "other"}
+	space, err := NewModelSpace(primary.database, primary.dialect, other)
+	if err != nil {
+		t.Fatalf("NewModelSpace failed: %v", err)
+	}
+	pipeline = NewPipeline(primary, pipeline.locations, pipeline.embedder, WithModelSpaces(space))
+
+	// Writes pending on a model space's cache hold up Close too
+	stallStatsWriter(space.Cache)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := pipeline.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close with pending model space writes = %v, want context.DeadlineExceeded", err)
+	}
+}
+
 func TestEmbedChunksTiming(t *testing.T) {
 	pipeline, _ := setupTestPipeline(t)
 	ctx := context.Background()
@@ -581,6 +802,565 @@ func TestEmbedChunksTiming(t *testing.T) {
 		result.Duration, result.EmbedTime, result.CacheTime)
 }
 
+func TestEmbedMissing(t *testing.T) {
+	pipeline, embedder := setupTestPipeline(t)
+	ctx := context.Background()
+
+	files := map[string][]Chunk{
+		"a.go": {
+			{Path: "a.go", StartLine: 1, EndLine: 5, Content: "func a1() {}"},
+			{Path: "a.go", StartLine: 6, EndLine: 10, Content: "func a2() {}"},
+		},
+		"b.go": {
+			{Path: "b.go", StartLine: 1, EndLine: 5, Content: "func b1() {}"},
+		},
+		"c.go": {
+			{Path: "c.go", StartLine: 1, EndLine: 5, Content: "func c1() {}"},
+		},
+	}
+
+	var all []Chunk
+	for _, path := range []string{"a.go", "b.go", "c.go"} {
+		all = append(all, files[path]...)
+	}
+	if _, err := pipeline.EmbedChunks(ctx, "/project", all); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+
+	// Evict two embeddings
+	evicted := []string{HashContent("func a2() {}"), HashContent("func c1() {}")}
+	if err := pipeline.Cache().DeleteBatch(evicted); err != nil {
+		t.Fatalf("DeleteBatch failed: %v", err)
+	}
+
+	embedder.embedCount = 0
+	var chunked []string
+	chunkFile := func(path string) ([]Chunk, error) {
+		chunked = append(chunked, path)
+		return files[path], nil
+	}
+
+	result, err := pipeline.EmbedMissing(ctx, "/project", chunkFile)
+	if err != nil {
+		t.Fatalf("EmbedMissing failed: %v", err)
+	}
+
+	if result.Locations != 4 {
+		t.Errorf("Locations = %d, want 4", result.Locations)
+	}
+	if result.Missing != 2 {
+		t.Errorf("Missing = %d, want 2", result.Missing)
+	}
+	if result.Embedded != 2 {
+		t.Errorf("Embedded = %d, want 2", result.Embedded)
+	}
+	if result.Unresolved != 0 {
+		t.Errorf("Unresolved = %d, want 0", result.Unresolved)
+	}
+	if embedder.embedCount != 2 {
+		t.Errorf("embedder called for %d texts, want 2", embedder.embedCount)
+	}
+
+	// Only files containing missing hashes are re-chunked
+	if len(chunked) != 2 || chunked[0] != "a.go" || chunked[1] != "c.go" {
+		t.Errorf("chunked files = %v, want [a.go c.go]", chunked)
+	}
+
+	for _, hash := range evicted {
+		ok, err := pipeline.Cache().HasEntry(hash)
+		if err != nil {
+			t.Fatalf("HasEntry failed: %v", err)
+		}
+		if !ok {
+			t.Errorf("hash %s not restored to cache", hash[:8])
+		}
+	}
+
+	// Nothing left to do on a second run
+	embedder.embedCount = 0
+	result, err = pipeline.EmbedMissing(ctx, "/project", chunkFile)
+	if err != nil {
+		t.Fatalf("EmbedMissing failed: %v", err)
+	}
+	if result.Missing != 0 || embedder.embedCount != 0 {
+		t.Errorf("second run: Missing = %d, embedded %d texts, want 0 and 0", result.Missing, embedder.embedCount)
+	}
+}
+
+func TestEmbedMissingUnresolved(t *testing.T) {
+	pipeline, embedder := setupTestPipeline(t)
+	ctx := context.Background()
+
+	chunks := []Chunk{{Path: "a.go", StartLine: 1, EndLine: 5, Content: "func old() {}"}}
+	if _, err := pipeline.EmbedChunks(ctx, "/project", chunks); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	if err := pipeline.Cache().Delete(HashContent("func old() {}")); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	// The file changed since indexing, so the missing content is gone
+	embedder.embedCount = 0
+	result, err := pipeline.EmbedMissing(ctx, "/project", func(path string) ([]Chunk, error) {
+		return []Chunk{{Path: "a.go", StartLine: 1, EndLine: 5, Content: "func new() {}"}}, nil
+	})
+	if err != nil {
+		t.Fatalf("EmbedMissing failed: %v", err)
+	}
+	if result.Unresolved != 1 {
+		t.Errorf("Unresolved = %d, want 1", result.Unresolved)
+	}
+	if embedder.embedCount != 0 {
+		t.Errorf("embedder called for %d texts, want 0", embedder.embedCount)
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	pipeline, _ := setupTestPipeline(t)
+	ctx := context.Background()
+
+	chunks := []Chunk{
+		{Path: "a.go", StartLine: 1, EndLine: 5, Content: "func a1() {}"},
+		{Path: "a.go", StartLine: 6, EndLine: 10, Content: "func a2() {}"},
+		{Path: "b.go", StartLine: 1, EndLine: 5, Content: "func b1() {}"},
+		// Duplicate content counts once
+		{Path: "c.go", StartLine: 1, EndLine: 5, Content: "func b1() {}"},
+	}
+	if _, err := pipeline.EmbedChunks(ctx, "/project", chunks); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	// Another repo's gaps do not count
+	if _, err := pipeline.EmbedChunks(ctx, "/other", []Chunk{{Path: "o.go", StartLine: 1, EndLine: 5, Content: "func o() {}"}}); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+
+	coverage, err := pipeline.Coverage("/project", true)
+	if err != nil {
+		t.Fatalf("Coverage failed: %v", err)
+	}
+	if coverage.Hashes != 3 || coverage.Missing != 0 || coverage.Percent() != 100 {
+		t.Errorf("Coverage = %+v (%.1f%%), want 3 hashes fully embedded", coverage, coverage.Percent())
+	}
+
+	evicted := []string{HashContent("func a2() {}"), HashContent("func o() {}")}
+	if err := pipeline.Cache().DeleteBatch(evicted); err != nil {
+		t.Fatalf("DeleteBatch failed: %v", err)
+	}
+
+	coverage, err = pipeline.Coverage("/project", true)
+	if err != nil {
+		t.Fatalf("Coverage failed: %v", err)
+	}
+	want := &EmbeddingCoverage{Hashes: 3, Embedded: 2, Missing: 1, MissingHashes: []string{HashContent("func a2() {}")}}
+	if !reflect.DeepEqual(coverage, want) {
+		t.Errorf("Coverage = %+v, want %+v", coverage, want)
+	}
+	if got := coverage.Percent(); got < 66.6 || got > 66.7 {
+		t.Errorf("Percent() = %v, want 66.7", got)
+	}
+
+	// Counts only
+	coverage, err = pipeline.Coverage("/project", false)
+	if err != nil {
+		t.Fatalf("Coverage failed: %v", err)
+	}
+	if coverage.Missing != 1 || coverage.MissingHashes != nil {
+		t.Errorf("Coverage without hashes = %+v, want 1 missing and no hashes", coverage)
+	}
+
+	empty, err := pipeline.Coverage("/none", true)
+	if err != nil {
+		t.Fatalf("Coverage failed: %v", err)
+	}
+	if empty.Hashes != 0 || empty.Percent() != 100 {
+		t.Errorf("Coverage of an empty repo = %+v (%.1f%%), want 0 hashes at 100%%", empty, empty.Percent())
+	}
+}
+
+func TestEmbedChunksUsesEmbedContent(t *testing.T) {
+	pipeline, embedder := setupTestPipeline(t)
+	ctx := context.Background()
+
+	content := "// license header\nfunc a() {}"
+	chunks := []Chunk{
+		{Path: "a.go", StartLine: 1, EndLine: 2, Content: content, EmbedContent: "func a() {}"},
+	}
+
+	if _, err := pipeline.EmbedChunks(ctx, "/project", chunks); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+
+	if len(embedder.inputs) != 1 || embedder.inputs[0] != "func a() {}" {
+		t.Errorf("embedder inputs = %q, want [\"func a() {}\"]", embedder.inputs)
+	}
+
+	// The cache key reflects the embedding input, not the stored content
+	locs, err := pipeline.Locations().GetByPath("/project", "a.go")
+	if err != nil {
+		t.Fatalf("GetByPath failed: %v", err)
+	}
+	if len(locs) != 1 || locs[0].ContentHash != HashContent("func a() {}") {
+		t.Errorf("location hash does not match embedding input")
+	}
+
+	// Same content without stripping is a separate cache entry
+	embedder.inputs = nil
+	chunks[0].EmbedContent = ""
+	if _, err := pipeline.EmbedChunks(ctx, "/project", chunks); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	if len(embedder.inputs) != 1 || embedder.inputs[0] != content {
+		t.Errorf("embedder inputs = %q, want full content", embedder.inputs)
+	}
+}
+
+func TestEmbedChunksUsesDescription(t *testing.T) {
+	pipeline, embedder := setupTestPipeline(t)
+	ctx := context.Background()
+
+	content := "server:\n  port: 8080\ndatabase:\n  host: db.internal\n"
+	chunks := []Chunk{
+		{Path: "deploy/app.yaml", StartLine: 1, EndLine: 4, Content: content, Kind: "block"},
+		{Path: "main.go", StartLine: 1, EndLine: 1, Content: "package main"},
+	}
+	if err := DescribeChunks(ctx, DataFileSummarizer{}, chunks); err != nil {
+		t.Fatalf("DescribeChunks failed: %v", err)
+	}
+
+	want := "YAML file deploy/app.yaml defining keys: server, database"
+	if chunks[0].Description != want {
+		t.Fatalf("Description = %q, want %q", chunks[0].Description, want)
+	}
+	if chunks[1].Description != "" {
+		t.Errorf("source file was described: %q", chunks[1].Description)
+	}
+
+	if _, err := pipeline.EmbedChunks(ctx, "/project", chunks); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+
+	// The embedder sees the description; source files still embed raw text
+	inputs := strings.Join(embedder.inputs, "|")
+	if !strings.Contains(inputs, want) || !strings.Contains(inputs, "package main") || strings.Contains(inputs, "db.internal") {
+		t.Errorf("embedder inputs = %q, want description and raw Go source", embedder.inputs)
+	}
+
+	// Content and location still describe the raw text
+	if chunks[0].Content != content {
+		t.Errorf("Content changed to %q", chunks[0].Content)
+	}
+	locs, err := pipeline.Locations().GetByPath("/project", "deploy/app.yaml")
+	if err != nil {
+		t.Fatalf("GetByPath failed: %v", err)
+	}
+	if len(locs) != 1 {
+		t.Fatalf("got %d locations, want 1", len(locs))
+	}
+	loc := locs[0]
+	if loc.StartLine != 1 || loc.EndLine != 4 || loc.NodeType != "block" || loc.Language != "yaml" {
+		t.Errorf("location = %+v, want the raw chunk's lines 1-4", loc)
+	}
+	if loc.ContentHash != HashContent(want) {
+		t.Error("location hash should key the embedded description")
+	}
+}
+
+func TestEmbedChunksNeighborContext(t *testing.T) {
+	pipeline, embedder := setupTestPipeline(t)
+	ctx := context.Background()
+
+	chunk := Chunk{
+		Path: "a.go", StartLine: 5, EndLine: 7,
+		Content:         "func b() {\n\treturn\n}",
+		NeighborContext: "previous: func a() {\nnext: func c() {",
+	}
+	if _, err := pipeline.EmbedChunks(ctx, "/project", []Chunk{chunk}); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+
+	want := "previous: func a() {\nnext: func c() {\n\nfunc b() {\n\treturn\n}"
+	if len(embedder.inputs) != 1 || embedder.inputs[0] != want {
+		t.Errorf("embedder inputs = %q, want %q", embedder.inputs, want)
+	}
+
+	// Neighbors are not part of the key: new neighbors hit the cache
+	embedder.inputs = nil
+	chunk.NeighborContext = "previous: func renamed() {"
+	result, err := pipeline.EmbedChunks(ctx, "/project", []Chunk{chunk})
+	if err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	if result.CacheHits != 1 || len(embedder.inputs) != 0 {
+		t.Errorf("CacheHits = %d, inputs = %q; want a hit without embedding", result.CacheHits, embedder.inputs)
+	}
+
+	// Without context the chunk embeds its plain content under another key
+	embedder.inputs = nil
+	plain := chunk
+	plain.NeighborContext = ""
+	if plain.CacheKey() == chunk.CacheKey() {
+		t.Error("plain and contextual chunks share a cache key")
+	}
+	if plain.CacheKey() != HashContent(plain.Content) {
+		t.Error("plain cache key should be the content hash")
+	}
+	if _, err := pipeline.EmbedChunks(ctx, "/project", []Chunk{plain}); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	if len(embedder.inputs) != 1 || embedder.inputs[0] != plain.Content {
+		t.Errorf("embedder inputs = %q, want plain content", embedder.inputs)
+	}
+}
+
+func TestEmbedChunksQualifiedName(t *testing.T) {
+	pipeline, embedder := setupTestPipeline(t)
+	ctx := context.Background()
+
+	chunk := Chunk{
+		Path: "auth.py", StartLine: 2, EndLine: 3,
+		Content:       "def handle(self, request):\n    return True",
+		Kind:          "function_definition",
+		Name:          "handle",
+		QualifiedName: "AuthMiddleware.handle",
+	}
+	if _, err := pipeline.EmbedChunks(ctx, "/project", []Chunk{chunk}); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+
+	want := "AuthMiddleware.handle\n\ndef handle(self, request):\n    return True"
+	if len(embedder.inputs) != 1 || embedder.inputs[0] != want {
+		t.Errorf("embedder inputs = %q, want %q", embedder.inputs, want)
+	}
+
+	locs, err := pipeline.locations.GetByPath("/project", "auth.py")
+	if err != nil {
+		t.Fatalf("GetByPath failed: %v", err)
+	}
+	if len(locs) != 1 || locs[0].QualifiedName != "AuthMiddleware.handle" || locs[0].NodeName != "handle" {
+		t.Errorf("locations = %+v, want handle qualified as AuthMiddleware.handle", locs)
+	}
+
+	// The name is part of the key: moving the method to another class
+	// re-embeds it
+	moved := chunk
+	moved.QualifiedName = "SessionMiddleware.handle"
+	plain := chunk
+	plain.QualifiedName = ""
+	if moved.CacheKey() == chunk.CacheKey() || plain.CacheKey() == chunk.CacheKey() {
+		t.Error("chunks with different qualified names share a cache key")
+	}
+	if plain.CacheKey() != HashContent(plain.Content) {
+		t.Error("plain cache key should be the content hash")
+	}
+
+	both := chunk
+	both.NeighborContext = "next: def check(self, request):"
+	if got := both.ContextualInput(); !strings.HasPrefix(got, "AuthMiddleware.handle\nnext: def check") {
+		t.Errorf("ContextualInput() = %q, want the qualified name before the neighbors", got)
+	}
+}
+
+func TestEmbedChunksPathContext(t *testing.T) {
+	pipeline, embedder := setupTestPipeline(t)
+	ctx := context.Background()
+
+	content := "func Retry(n int) error {\n\treturn nil\n}"
+	chunks := []Chunk{
+		{Path: "payments/retry.go", StartLine: 1, EndLine: 3, Content: content, PathContext: "payments/retry.go"},
+		{Path: "billing/retry.go", StartLine: 1, EndLine: 3, Content: content, PathContext: "billing/retry.go"},
+	}
+	if _, err := pipeline.EmbedChunks(ctx, "/project", chunks); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+
+	// Identical code at two paths is embedded once per path
+	want := []string{"payments/retry.go\n\n" + content, "billing/retry.go\n\n" + content}
+	if strings.Join(embedder.inputs, "|") != strings.Join(want, "|") {
+		t.Errorf("embedder inputs = %q, want %q", embedder.inputs, want)
+	}
+	if chunks[0].CacheKey() == chunks[1].CacheKey() {
+		t.Error("chunks embedded with different paths share a cache key")
+	}
+	plain := chunks[0]
+	plain.PathContext = ""
+	if plain.CacheKey() == chunks[0].CacheKey() || plain.CacheKey() != HashContent(content) {
+		t.Error("path context should be covered by the cache key, and only when set")
+	}
+
+	locs, err := pipeline.locations.GetByPath("/project", "payments/retry.go")
+	if err != nil {
+		t.Fatalf("GetByPath failed: %v", err)
+	}
+	if len(locs) != 1 || locs[0].ContentHash != chunks[0].CacheKey() {
+		t.Errorf("locations = %+v, want one keyed with the path", locs)
+	}
+
+	both := chunks[0]
+	both.QualifiedName = "payments.Retry"
+	if got := both.ContextualInput(); !strings.HasPrefix(got, "payments/retry.go\npayments.Retry\n\n") {
+		t.Errorf("ContextualInput() = %q, want the path before the qualified name", got)
+	}
+}
+
+// limitedEmbedder fails the whole batch when any input exceeds maxBytes,
+// like providers with a hard context limit.
+// delayEmbedder sleeps before each request, for the duration at the
+// request's index in delays.
+type delayEmbedder struct {
+	*mockEmbedder
+	delays []time.Duration
+	calls  int
+}
+
+func (d *delayEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	time.Sleep(d.delays[d.calls])
+	d.calls++
+	return d.mockEmbedder.Embed(ctx, texts)
+}
+
+func TestEmbedChunksRequestStats(t *testing.T) {
+	pipeline, _ := setupTestPipeline(t)
+	pipeline.batchSize = 1
+	ctx := context.Background()
+
+	// 18 fast requests and 2 slow ones
+	fast, slow := 2*time.Millisecond, 50*time.Millisecond
+	embedder := &delayEmbedder{mockEmbedder: newMockEmbedder(768)}
+	var chunks []Chunk
+	for i := 0; i < 20; i++ {
+		delay := fast
+		if i >= 18 {
+			delay = slow
+		}
+		embedder.delays = append(embedder.delays, delay)
+		chunks = append(chunks, Chunk{Path: "a.go", StartLine: i + 1, EndLine: i + 1, Content: fmt.Sprintf("func f%d() {}", i)})
+	}
+	pipeline.embedder = embedder
+
+	result, err := pipeline.EmbedChunks(ctx, "/project", chunks)
+	if err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+
+	stats := result.Requests
+	if stats == nil || stats.Requests != 20 {
+		t.Fatalf("Requests = %+v, want 20 requests", stats)
+	}
+	if stats.P50 < fast || stats.P50 >= slow {
+		t.Errorf("P50 = %v, want between %v and %v", stats.P50, fast, slow)
+	}
+	if stats.P95 < slow || stats.P99 < slow || stats.Max < slow {
+		t.Errorf("P95 = %v, P99 = %v, Max = %v, want at least %v", stats.P95, stats.P99, stats.Max, slow)
+	}
+	if want := 20 / result.EmbedTime.Seconds(); stats.RequestsPerSec != want {
+		t.Errorf("RequestsPerSec = %v, want %v", stats.RequestsPerSec, want)
+	}
+
+	// Cache hits make no requests
+	result, err = pipeline.EmbedChunks(ctx, "/project", chunks)
+	if err != nil {
+		t.Fatalf("second EmbedChunks failed: %v", err)
+	}
+	if result.Requests != nil {
+		t.Errorf("Requests = %+v for cached chunks, want nil", result.Requests)
+	}
+}
+
+type limitedEmbedder struct {
+	*mockEmbedder
+	maxBytes int
+}
+
+func (l *limitedEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	for _, text := range texts {
+		if len(text) > l.maxBytes {
+			return nil, fmt.Errorf("input of %d bytes exceeds limit of %d", len(text), l.maxBytes)
+		}
+	}
+	return l.mockEmbedder.Embed(ctx, texts)
+}
+
+func TestEmbedChunksTruncatesOversizedInput(t *testing.T) {
+	base, _ := setupTestPipeline(t)
+	ctx := context.Background()
+
+	embedder := &limitedEmbedder{mockEmbedder: newMockEmbedder(768), maxBytes: 100}
+	huge := strings.Repeat("x := compute(y)\n", 50) // 800 bytes
+	chunks := []Chunk{
+		{Path: "a.go", StartLine: 1, EndLine: 3, Content: "func a() {}"},
+		{Path: "gen.go", StartLine: 1, EndLine: 50, Content: huge},
+	}
+
+	// Without a cap the oversized chunk fails the whole batch
+	uncapped := NewPipeline(base.Cache(), base.Locations(), embedder)
+	if _, err := uncapped.EmbedChunks(ctx, "/project", chunks); err == nil {
+		t.Fatal("expected batch failure without input cap")
+	}
+
+	var logs bytes.Buffer
+	pipeline := NewPipeline(base.Cache(), base.Locations(), embedder,
+		WithMaxInputBytes(100),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+
+	result, err := pipeline.EmbedChunks(ctx, "/project", chunks)
+	if err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	if result.Embedded != 2 {
+		t.Errorf("Embedded = %d, want 2", result.Embedded)
+	}
+
+	var sawTruncated bool
+	for _, input := range embedder.inputs {
+		if len(input) > 100 {
+			t.Errorf("provider received %d bytes, want <= 100", len(input))
+		}
+		if strings.HasPrefix(huge, input) && input != huge {
+			sawTruncated = true
+			if !strings.HasSuffix(input, "\n") {
+				t.Errorf("expected truncation at a line break, got %q", input)
+			}
+		}
+	}
+	if !sawTruncated {
+		t.Errorf("provider inputs %q do not include truncated chunk", embedder.inputs)
+	}
+
+	// Stored location keeps the hash of the full chunk
+	locs, err := pipeline.Locations().GetByPath("/project", "gen.go")
+	if err != nil {
+		t.Fatalf("GetByPath failed: %v", err)
+	}
+	if len(locs) != 1 || locs[0].ContentHash != HashContent(huge) {
+		t.Errorf("location hash does not match full content")
+	}
+
+	if !strings.Contains(logs.String(), "truncated embedding input") || !strings.Contains(logs.String(), "gen.go") {
+		t.Errorf("expected truncation warning, got logs:\n%s", logs.String())
+	}
+}
+
+func TestTruncateInput(t *testing.T) {
+	if got, ok := TruncateInput("short", 100); ok || got != "short" {
+		t.Errorf("TruncateInput(short) = %q, %v; want unchanged", got, ok)
+	}
+	if got, ok := TruncateInput("anything", 0); ok || got != "anything" {
+		t.Errorf("TruncateInput with no limit = %q, %v; want unchanged", got, ok)
+	}
+
+	// Never split a multi-byte rune
+	got, ok := TruncateInput("abéé", 3)
+	if !ok || got != "ab" {
+		t.Errorf("TruncateInput(multibyte) = %q, %v; want \"ab\", true", got, ok)
+	}
+
+	// Line breaks far before the limit are not used
+	got, _ = TruncateInput("a\n"+strings.Repeat("b", 20), 10)
+	if got != "a\n"+strings.Repeat("b", 8) {
+		t.Errorf("TruncateInput = %q, want hard cut at 10 bytes", got)
+	}
+}
+
 func BenchmarkEmbedChunks(b *testing.B) {
 	cfg := db.DefaultConfig(":memory:")
 	database, err := db.Open(cfg)
@@ -643,3 +1423,196 @@ func BenchmarkCacheHitRate(b *testing.B) {
 		pipeline.EmbedChunks(ctx, "/project2", chunks)
 	}
 }
+
+func TestEmbedChunksRefresh(t *testing.T) {
+	pipeline, embedder := setupFilePipeline(t, WithFileEmbeddings(true))
+	ctx := context.Background()
+
+	chunks := []Chunk{
+		{Path: "a.go", StartLine: 1, EndLine: 5, Content: "alpha alpha"},
+		{Path: "b.go", StartLine: 1, EndLine: 4, Content: "beta beta"},
+	}
+	if _, err := pipeline.EmbedChunks(ctx, "/project", chunks); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	fileHash := func(path string) string {
+		t.Helper()
+		locs, err := pipeline.Locations().GetByPath("/project", path)
+		if err != nil {
+			t.Fatalf("GetByPath failed: %v", err)
+		}
+		for _, loc := range locs {
+			if loc.NodeType == NodeTypeFile {
+				return loc.ContentHash
+			}
+		}
+		t.Fatalf("%s has no file embedding", path)
+		return ""
+	}
+	vector := func(hash string) []float32 {
+		t.Helper()
+		entry, err := pipeline.Cache().Get(hash)
+		if err != nil || entry == nil {
+			t.Fatalf("Get(%s) = %v, %v", hash, entry, err)
+		}
+		return entry.Embedding
+	}
+
+	// A changed model embeds the same text differently; only a.go is
+	// refreshed despite the full cache hit
+	embedder.keywords = []string{"beta", "alpha"}
+	chunks[0].Refresh = true
+	result, err := pipeline.EmbedChunks(ctx, "/project", chunks)
+	if err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	if result.Embedded != 1 || result.CacheHits != 1 {
+		t.Errorf("Embedded = %d, CacheHits = %d, want 1 and 1", result.Embedded, result.CacheHits)
+	}
+
+	if got := vector(chunks[0].CacheKey()); got[0] != 0 || got[1] != 2 {
+		t.Errorf("refreshed vector = %v, want the new model's", got)
+	}
+	if got := vector(chunks[1].CacheKey()); got[0] != 0 || got[1] != 2 {
+		t.Errorf("cached vector = %v, want the old model's", got)
+	}
+	if got := vector(fileHash("a.go")); got[0] != 0 {
+		t.Errorf("a.go file vector = %v, want it pooled from the refreshed chunk", got)
+	}
+}
+
+// shortEmbedder drops the inputs of a batch beyond limit, like providers
+// that silently truncate oversized batches. Each vector's first value
+// indexes the input it was computed for in texts.
+type shortEmbedder struct {
+	*mockEmbedder
+	limit int
+	texts []string
+}
+
+func (s *shortEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	s.embedCount += len(texts)
+	if len(texts) > s.limit {
+		texts = texts[:s.limit]
+	}
+	result := make([][]float32, len(texts))
+	for i, text := range texts {
+		result[i] = make([]float32, s.dimensions)
+		result[i][0] = float32(len(s.texts))
+		s.texts = append(s.texts, text)
+	}
+	return result, nil
+}
+
+func TestEmbedChunksSplitsShortBatches(t *testing.T) {
+	base, _ := setupTestPipeline(t)
+	ctx := context.Background()
+
+	embedder := &shortEmbedder{mockEmbedder: newMockEmbedder(4), limit: 3}
+	var logs bytes.Buffer
+	pipeline := NewPipeline(base.Cache(), base.Locations(), embedder,
+		WithBatchSize(10),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+
+	var chunks []Chunk
+	for i := 0; i < 10; i++ {
+		chunks = append(chunks, Chunk{Path: fmt.Sprintf("f%d.go", i), StartLine: 1, EndLine: 1, Content: fmt.Sprintf("func f%d() {}", i)})
+	}
+	result, err := pipeline.EmbedChunks(ctx, "/project", chunks)
+	if err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	if result.Embedded != 10 {
+		t.Errorf("Embedded = %d, want 10", result.Embedded)
+	}
+
+	// Every chunk got the vector computed for its own content
+	for _, c := range chunks {
+		locs, err := pipeline.Locations().GetByPath("/project", c.Path)
+		if err != nil || len(locs) != 1 {
+			t.Fatalf("GetByPath(%s) = %v, %v", c.Path, locs, err)
+		}
+		entry, err := pipeline.Cache().Get(locs[0].ContentHash)
+		if err != nil || entry == nil {
+			t.Fatalf("Get(%s) = %v, %v", c.Path, entry, err)
+		}
+		if text := embedder.texts[int(entry.Embedding[0])]; !strings.Contains(text, c.Content) {
+			t.Errorf("%s got the vector of %q", c.Path, text)
+		}
+	}
+	if !strings.Contains(logs.String(), "embedding count mismatch") {
+		t.Errorf("expected a split warning, got logs:\n%s", logs.String())
+	}
+
+	// Without splits a short batch fails instead of misassigning vectors
+	strict := NewPipeline(base.Cache(), base.Locations(), embedder, WithBatchSize(10), WithMaxBatchSplits(0))
+	for i := range chunks {
+		chunks[i].Content += " // changed"
+	}
+	if _, err := strict.EmbedChunks(ctx, "/project", chunks); err == nil || !strings.Contains(err.Error(), "3 vectors for 10 inputs") {
+		t.Errorf("EmbedChunks without splits error = %v, want a count mismatch", err)
+	}
+}
+
+func TestEmbedFilesChunkDeltas(t *testing.T) {
+	pipeline, embedder := setupTestPipeline(t)
+	WithChunkDeltas(true)(pipeline)
+	ctx := context.Background()
+
+	fn := func(i, line int) Chunk {
+		return Chunk{
+			Path: "big.go", StartLine: line, EndLine: line + 4,
+			Content: fmt.Sprintf("func f%02d() {\n\treturn %d\n}", i, i), Name: fmt.Sprintf("f%02d", i),
+		}
+	}
+	var chunks []Chunk
+	for i := 0; i < 5; i++ {
+		chunks = append(chunks, fn(i, i*5+1))
+	}
+	if _, err := pipeline.EmbedFiles(ctx, "/project", []string{"big.go"}, chunks); err != nil {
+		t.Fatalf("EmbedFiles failed: %v", err)
+	}
+	embedder.embedCount = 0
+
+	// A function inserted at the top moves the others down: their rows
+	// are rewritten at the new lines but nothing is embedded again
+	shifted := []Chunk{fn(99, 1)}
+	for i := 0; i < 5; i++ {
+		shifted = append(shifted, fn(i, i*5+6))
+	}
+	result, err := pipeline.EmbedFiles(ctx, "/project", []string{"big.go"}, shifted)
+	if err != nil {
+		t.Fatalf("EmbedFiles failed: %v", err)
+	}
+	if result.Embedded != 1 || result.CacheHits != 5 || embedder.embedCount != 1 {
+		t.Errorf("Embedded = %d, CacheHits = %d, embedded texts = %d; want 1, 5, 1",
+			result.Embedded, result.CacheHits, embedder.embedCount)
+	}
+	if result.LocationsWritten != 6 || result.LocationsDeleted != 0 {
+		t.Errorf("written/deleted = %d/%d, want 6/0", result.LocationsWritten, result.LocationsDeleted)
+	}
+	locs, err := pipeline.Locations().GetByPath("/project", "big.go")
+	if err != nil {
+		t.Fatalf("GetByPath failed: %v", err)
+	}
+	if len(locs) != 6 {
+		t.Fatalf("got %d locations, want 6", len(locs))
+	}
+	for _, loc := range locs {
+		if loc.NodeName == "f00" && loc.StartLine != 6 {
+			t.Errorf("f00 recorded at line %d, want 6", loc.StartLine)
+		}
+	}
+
+	// A file listed without chunks loses all its locations
+	result, err = pipeline.EmbedFiles(ctx, "/project", []string{"big.go"}, nil)
+	if err != nil {
+		t.Fatalf("EmbedFiles failed: %v", err)
+	}
+	if result.LocationsDeleted != 6 {
+		t.Errorf("LocationsDeleted = %d, want 6", result.LocationsDeleted)
+	}
+	if n, _ := pipeline.Locations().CountByPath("/project", "big.go"); n != 0 {
+		t.Errorf("got %d locations for an emptied file, want 0", n)
+	}
+}
@@ -0,0 +1,304 @@
+package embedding
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+
+	"codetect/internal/config"
+)
+
+// pqMagic identifies a serialized PQ codebook.
+const pqMagic = "PQ01"
+
+// pqTrainSeed makes codebook training deterministic for a given sample.
+const pqTrainSeed = 42
+
+// PQCodec encodes vectors with product quantization. Each vector is
+// L2-normalized and split into equal-width sub-vectors; each sub-vector is
+// replaced by the index of its nearest centroid in that subspace's codebook.
+// Because inputs are normalized, squared L2 distance between codes ranks
+// results the same way cosine similarity does.
+type PQCodec struct {
+	dimensions int
+	subspaces  int
+	centroids  int
+	subDim     int
+	codebooks  [][]float32 // [subspace][centroid*subDim + j]
+}
+
+// TrainPQ learns PQ codebooks from a sample of vectors using k-means in each
+// subspace. If the sample is smaller than cfg.Centroids, the codebook size is
+// reduced to the sample size.
+func TrainPQ(vectors [][]float32, cfg config.PQConfig) (*PQCodec, error) {
+	if len(vectors) == 0 {
+		return nil, fmt.Errorf("no training vectors")
+	}
+	dims := len(vectors[0])
+	if err := cfg.Validate(dims); err != nil {
+		return nil, fmt.Errorf("invalid PQ config: %w", err)
+	}
+
+	rng := rand.New(rand.NewSource(pqTrainSeed))
+
+	// Subsample and normalize the training set
+	sample := vectors
+	if cfg.TrainSampleSize > 0 && len(sample) > cfg.TrainSampleSize {
+		sample = make([][]float32, cfg.TrainSampleSize)
+		for i, j := range rng.Perm(len(vectors))[:cfg.TrainSampleSize] {
+			sample[i] = vectors[j]
+		}
+	}
+	normalized := make([][]float32, len(sample))
+	for i, v := range sample {
+		if len(v) != dims {
+			return nil, fmt.Errorf("vector %d has %d dimensions, want %d", i, len(v), dims)
+		}
+		normalized[i] = Normalize(v)
+	}
+
+	k := min(cfg.Centroids, len(normalized))
+	codec := &PQCodec{
+		dimensions: dims,
+		subspaces:  cfg.Subspaces,
+		centroids:  k,
+		subDim:     dims / cfg.Subspaces,
+		codebooks:  make([][]float32, cfg.Subspaces),
+	}
+
+	points := make([][]float32, len(normalized))
+	for m := 0; m < codec.subspaces; m++ {
+		lo := m * codec.subDim
+		for i, v := range normalized {
+			points[i] = v[lo : lo+codec.subDim]
+		}
+		codec.codebooks[m] = kmeans(points, k, cfg.Iterations, rng)
+	}
+
+	return codec, nil
+}
+
+// Dimensions returns the vector dimensions the codec was trained for.
+func (c *PQCodec) Dimensions() int { return c.dimensions }
+
+// Subspaces returns the number of sub-vectors, which is also the code length in bytes.
+func (c *PQCodec) Subspaces() int { return c.subspaces }
+
+// Centroids returns the codebook size per subspace.
+func (c *PQCodec) Centroids() int { return c.centroids }
+
+// Encode quantizes a vector to one byte per subspace.
+func (c *PQCodec) Encode(v []float32) ([]byte, error) {
+	if len(v) != c.dimensions {
+		return nil, fmt.Errorf("vector has %d dimensions, codec expects %d", len(v), c.dimensions)
+	}
+	v = Normalize(v)
+
+	codes := make([]byte, c.subspaces)
+	for m := 0; m < c.subspaces; m++ {
+		sub := v[m*c.subDim : (m+1)*c.subDim]
+		codes[m] = byte(nearestCentroid(sub, c.codebooks[m], c.subDim))
+	}
+	return codes, nil
+}
+
+// Decode reconstructs an approximate (normalized) vector from its codes.
+func (c *PQCodec) Decode(codes []byte) ([]float32, error) {
+	if len(codes) != c.subspaces {
+		return nil, fmt.Errorf("code has %d bytes, codec expects %d", len(codes), c.subspaces)
+	}
+
+	v := make([]float32, c.dimensions)
+	for m, code := range codes {
+		if int(code) >= c.centroids {
+			return nil, fmt.Errorf("code %d out of range for subspace %d", code, m)
+		}
+		off := int(code) * c.subDim
+		copy(v[m*c.subDim:], c.codebooks[m][off:off+c.subDim])
+	}
+	return v, nil
+}
+
+// DistanceTable precomputes the squared distance from each sub-vector of the
+// (normalized) query to every centroid, for asymmetric distance computation.
+func (c *PQCodec) DistanceTable(query []float32) ([]float32, error) {
+	if len(query) != c.dimensions {
+		return nil, fmt.Errorf("query has %d dimensions, codec expects %d", len(query), c.dimensions)
+	}
+	query = Normalize(query)
+
+	table := make([]float32, c.subspaces*c.centroids)
+	for m := 0; m < c.subspaces; m++ {
+		sub := query[m*c.subDim : (m+1)*c.subDim]
+		for k := 0; k < c.centroids; k++ {
+			table[m*c.centroids+k] = squaredL2(sub, c.codebooks[m][k*c.subDim:(k+1)*c.subDim])
+		}
+	}
+	return table, nil
+}
+
+// ADCDistance returns the approximate squared distance between the query
+// used to build table and the vector encoded by codes.
+func (c *PQCodec) ADCDistance(table []float32, codes []byte) float32 {
+	var d float32
+	for m, code := range codes {
+		d += table[m*c.centroids+int(code)]
+	}
+	return d
+}
+
+// MarshalBinary serializes the codebooks.
+func (c *PQCodec) MarshalBinary() ([]byte, error) {
+	size := len(pqMagic) + 12 + c.subspaces*c.centroids*c.subDim*4
+	buf := make([]byte, 0, size)
+	buf = append(buf, pqMagic...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(c.dimensions))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(c.subspaces))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(c.centroids))
+	for _, cb := range c.codebooks {
+		for _, x := range cb {
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(x))
+		}
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary restores codebooks serialized by MarshalBinary.
+func (c *PQCodec) UnmarshalBinary(data []byte) error {
+	header := len(pqMagic) + 12
+	if len(data) < header || string(data[:len(pqMagic)]) != pqMagic {
+		return errors.New("invalid PQ codebook data")
+	}
+
+	dims := int(binary.LittleEndian.Uint32(data[4:]))
+	subspaces := int(binary.LittleEndian.Uint32(data[8:]))
+	centroids := int(binary.LittleEndian.Uint32(data[12:]))
+	if subspaces == 0 || dims%subspaces != 0 || centroids == 0 || centroids > 256 {
+		return fmt.Errorf("invalid PQ codebook header (dims=%d, subspaces=%d, centroids=%d)", dims, subspaces, centroids)
+	}
+	subDim := dims / subspaces
+	if len(data) != header+subspaces*centroids*subDim*4 {
+		return fmt.Errorf("PQ codebook data has %d bytes, want %d", len(data), header+subspaces*centroids*subDim*4)
+	}
+
+	codebooks := make([][]float32, subspaces)
+	off := header
+	for m := range codebooks {
+		cb := make([]float32, centroids*subDim)
+		for i := range cb {
+			cb[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[off:]))
+			off += 4
+		}
+		codebooks[m] = cb
+	}
+
+	*c = PQCodec{
+		dimensions: dims,
+		subspaces:  subspaces,
+		centroids:  centroids,
+		subDim:     subDim,
+		codebooks:  codebooks,
+	}
+	return nil
+}
+
+// kmeans clusters points into k centroids using k-means++ seeding followed
+// by Lloyd iterations. Returns the centroids flattened to k*len(points[0]).
+func kmeans(points [][]float32, k, iterations int, rng *rand.Rand) []float32 {
+	dim := len(points[0])
+	centroids := make([]float32, k*dim)
+
+	// k-means++ seeding: pick each new centroid with probability
+	// proportional to its squared distance from the nearest existing one
+	copy(centroids, points[rng.Intn(len(points))])
+	dist := make([]float64, len(points))
+	for i, p := range points {
+		dist[i] = float64(squaredL2(p, centroids[:dim]))
+	}
+	for c := 1; c < k; c++ {
+		var total float64
+		for _, d := range dist {
+			total += d
+		}
+		chosen := rng.Intn(len(points))
+		if total > 0 {
+			target := rng.Float64() * total
+			for i, d := range dist {
+				target -= d
+				if target <= 0 {
+					chosen = i
+					break
+				}
+			}
+		}
+		centroid := centroids[c*dim : (c+1)*dim]
+		copy(centroid, points[chosen])
+		for i, p := range points {
+			if d := float64(squaredL2(p, centroid)); d < dist[i] {
+				dist[i] = d
+			}
+		}
+	}
+
+	assign := make([]int, len(points))
+	sums := make([]float64, k*dim)
+	counts := make([]int, k)
+	for iter := 0; iter < iterations; iter++ {
+		changed := iter == 0
+		for i, p := range points {
+			if c := nearestCentroid(p, centroids, dim); c != assign[i] {
+				assign[i] = c
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+
+		clear(sums)
+		clear(counts)
+		for i, p := range points {
+			c := assign[i]
+			counts[c]++
+			for j, x := range p {
+				sums[c*dim+j] += float64(x)
+			}
+		}
+		for c := 0; c < k; c++ {
+			if counts[c] == 0 {
+				// Re-seed empty clusters from a random point
+				copy(centroids[c*dim:(c+1)*dim], points[rng.Intn(len(points))])
+				continue
+			}
+			for j := 0; j < dim; j++ {
+				centroids[c*dim+j] = float32(sums[c*dim+j] / float64(counts[c]))
+			}
+		}
+	}
+
+	return centroids
+}
+
+// nearestCentroid returns the index of the centroid closest to v.
+func nearestCentroid(v, centroids []float32, dim int) int {
+	best := 0
+	bestDist := float32(math.MaxFloat32)
+	for c := 0; c*dim < len(centroids); c++ {
+		if d := squaredL2(v, centroids[c*dim:(c+1)*dim]); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+// squaredL2 returns the squared Euclidean distance between equal-length vectors.
+func squaredL2(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return sum
+}
@@ -0,0 +1,457 @@
+package embedding
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"codetect/internal/config"
+	"codetect/internal/db"
+)
+
+// ErrPQNotTrained is returned when inserting into a PQ index before its
+// codebooks have been trained.
+var ErrPQNotTrained = errors.New("PQ codebooks not trained")
+
+// VectorSource loads full-precision vectors by content hash. Hashes that
+// cannot be found are omitted from the result.
+type VectorSource func(ctx context.Context, hashes []string) (map[string][]float32, error)
+
+// CacheVectorSource returns a VectorSource backed by an embedding cache.
+func CacheVectorSource(cache *EmbeddingCache) VectorSource {
+	return func(ctx context.Context, hashes []string) (map[string][]float32, error) {
+		entries, err := cache.GetBatch(hashes)
+		if err != nil {
+			return nil, err
+		}
+		vectors := make(map[string][]float32, len(entries))
+		for hash, entry := range entries {
+			vectors[hash] = entry.Embedding
+		}
+		return vectors, nil
+	}
+}
+
+// PQVectorIndex implements VectorIndex over product-quantized vectors.
+// Codes and codebooks are persisted in the database per embedding model, and
+// only the codes are held in memory. Search scores every code with
+// asymmetric distance computation (ADC), then re-ranks the best candidates
+// by the index's metric: exactly, against full-precision vectors from the
+// VectorSource if one is set, or approximately, against vectors decoded from
+// their codes.
+//
+// A vector costs Subspaces bytes in memory instead of 4*dimensions.
+type PQVectorIndex struct {
+	database   db.DB
+	dialect    db.Dialect
+	schema     *db.SchemaBuilder
+	dimensions int
+	model      string
+	config     config.PQConfig
+	metric     Metric
+	source     VectorSource
+
+	mu     sync.RWMutex
+	codec  *PQCodec
+	codes  map[string][]byte
+	loaded bool
+}
+
+// NewPQVectorIndex creates a PQ-compressed index of model's vectors,
+// loading previously trained codebooks for the model and dimensions if
+// present. Indexes of different models share the tables but not their rows.
+func NewPQVectorIndex(database db.DB, dialect db.Dialect, dimensions int, model string, cfg config.PQConfig) (*PQVectorIndex, error) {
+	if err := cfg.Validate(dimensions); err != nil {
+		return nil, fmt.Errorf("invalid PQ config: %w", err)
+	}
+
+	idx := &PQVectorIndex{
+		database:   database,
+		dialect:    dialect,
+		schema:     db.NewSchemaBuilder(database, dialect),
+		dimensions: dimensions,
+		model:      model,
+		config:     cfg,
+		codes:      make(map[string][]byte),
+	}
+
+	if err := idx.initSchema(); err != nil {
+		return nil, fmt.Errorf("initializing PQ schema: %w", err)
+	}
+	if err := idx.loadCodebook(); err != nil {
+		return nil, err
+	}
+
+	return idx, nil
+}
+
+// initSchema creates the codebook and codes tables.
+func (p *PQVectorIndex) initSchema() error {
+	codebooks := p.dialect.CreateTableSQL("pq_codebooks", []db.ColumnDef{
+		{Name: "model", Type: db.ColTypeText, Nullable: false, PrimaryKey: true},
+		{Name: "dimensions", Type: db.ColTypeInteger, Nullable: false, PrimaryKey: true},
+		{Name: "codebook", Type: db.ColTypeBlob, Nullable: false},
+		{Name: "created_at", Type: db.ColTypeInteger, Nullable: false},
+	})
+	if _, err := p.database.Exec(codebooks); err != nil {
+		return fmt.Errorf("creating pq_codebooks table: %w", err)
+	}
+
+	codes := p.dialect.CreateTableSQL(p.codesTable(), []db.ColumnDef{
+		{Name: "model", Type: db.ColTypeText, Nullable: false, PrimaryKey: true},
+		{Name: "content_hash", Type: db.ColTypeText, Nullable: false, PrimaryKey: true},
+		{Name: "codes", Type: db.ColTypeBlob, Nullable: false},
+	})
+	if _, err := p.database.Exec(codes); err != nil {
+		return fmt.Errorf("creating %s table: %w", p.codesTable(), err)
+	}
+
+	return nil
+}
+
+// codesTable returns the dimension-grouped table holding PQ codes, keyed
+// by model and content hash.
+func (p *PQVectorIndex) codesTable() string {
+	return fmt.Sprintf("pq_codes_%d", p.dimensions)
+}
+
+// loadCodebook restores trained codebooks from the database, if any.
+func (p *PQVectorIndex) loadCodebook() error {
+	query := p.schema.SubstitutePlaceholders("SELECT codebook FROM pq_codebooks WHERE model = ? AND dimensions = ?")
+
+	var data []byte
+	err := p.database.QueryRow(query, p.model, p.dimensions).Scan(&data)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil // Not trained yet
+		}
+		return fmt.Errorf("loading PQ codebook: %w", err)
+	}
+
+	var codec PQCodec
+	if err := codec.UnmarshalBinary(data); err != nil {
+		return fmt.Errorf("decoding PQ codebook: %w", err)
+	}
+	p.codec = &codec
+	return nil
+}
+
+// SetVectorSource sets where full-precision vectors are loaded from for
+// exact re-ranking of ANN candidates. A nil source re-ranks decoded vectors.
+func (p *PQVectorIndex) SetVectorSource(source VectorSource) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.source = source
+}
+
+// SetMetric selects the similarity function candidates are re-ranked by.
+// It should match the metric the vectors are searched with elsewhere. The
+// default is cosine.
+func (p *PQVectorIndex) SetMetric(metric Metric) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.metric = metric
+}
+
+// Trained reports whether codebooks are available for encoding.
+func (p *PQVectorIndex) Trained() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.codec != nil
+}
+
+// Codec returns the trained codec, or nil if not trained.
+func (p *PQVectorIndex) Codec() *PQCodec {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.codec
+}
+
+// Train learns codebooks from a sample of vectors and persists them.
+// Codes encoded with previous codebooks are meaningless under new ones, so
+// the model's existing codes are deleted; callers must re-insert their
+// vectors.
+func (p *PQVectorIndex) Train(ctx context.Context, sample [][]float32) error {
+	codec, err := TrainPQ(sample, p.config)
+	if err != nil {
+		return fmt.Errorf("training PQ codebooks: %w", err)
+	}
+	if codec.Dimensions() != p.dimensions {
+		return fmt.Errorf("training vectors have %d dimensions, index expects %d", codec.Dimensions(), p.dimensions)
+	}
+
+	data, err := codec.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("encoding PQ codebook: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.schema.Upsert(ctx, "pq_codebooks",
+		[]string{"model", "dimensions", "codebook", "created_at"},
+		[]string{"model", "dimensions"}, nil,
+		p.model, p.dimensions, data, time.Now().Unix(),
+	); err != nil {
+		return fmt.Errorf("storing PQ codebook: %w", err)
+	}
+
+	query := p.schema.SubstitutePlaceholders(fmt.Sprintf("DELETE FROM %s WHERE model = ?", p.codesTable()))
+	if _, err := p.database.ExecContext(ctx, query, p.model); err != nil {
+		return fmt.Errorf("clearing stale PQ codes: %w", err)
+	}
+
+	p.codec = codec
+	p.codes = make(map[string][]byte)
+	p.loaded = true
+	return nil
+}
+
+// Insert encodes and stores an embedding.
+func (p *PQVectorIndex) Insert(ctx context.Context, contentHash string, embedding []float32) error {
+	return p.InsertBatch(ctx, map[string][]float32{contentHash: embedding})
+}
+
+// InsertBatch encodes and stores multiple embeddings in a transaction.
+// Returns ErrPQNotTrained if Train has not been called.
+func (p *PQVectorIndex) InsertBatch(ctx context.Context, entries map[string][]float32) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.codec == nil {
+		return ErrPQNotTrained
+	}
+
+	encoded := make(map[string][]byte, len(entries))
+	rows := make([][]any, 0, len(entries))
+	for hash, emb := range entries {
+		codes, err := p.codec.Encode(emb)
+		if err != nil {
+			return fmt.Errorf("encoding %s: %w", hash, err)
+		}
+		encoded[hash] = codes
+		rows = append(rows, []any{p.model, hash, codes})
+	}
+
+	if err := p.schema.UpsertBatch(ctx, p.codesTable(),
+		[]string{"model", "content_hash", "codes"},
+		[]string{"model", "content_hash"}, nil, rows,
+	); err != nil {
+		return fmt.Errorf("storing PQ codes: %w", err)
+	}
+
+	if p.loaded {
+		for hash, codes := range encoded {
+			p.codes[hash] = codes
+		}
+	}
+	return nil
+}
+
+// Search finds the k nearest neighbors. The k*RerankFactor best candidates
+// by ADC distance are re-ranked by the index's metric.
+func (p *PQVectorIndex) Search(ctx context.Context, query []float32, k int) ([]VectorResult, error) {
+	if k <= 0 {
+		return nil, nil
+	}
+	if err := p.ensureLoaded(ctx); err != nil {
+		return nil, err
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.codec == nil || len(p.codes) == 0 {
+		return nil, nil
+	}
+
+	table, err := p.codec.DistanceTable(query)
+	if err != nil {
+		return nil, err
+	}
+
+	type candidate struct {
+		hash string
+		dist float32
+	}
+	candidates := make([]candidate, 0, len(p.codes))
+	for hash, codes := range p.codes {
+		candidates = append(candidates, candidate{hash: hash, dist: p.codec.ADCDistance(table, codes)})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].dist != candidates[j].dist {
+			return candidates[i].dist < candidates[j].dist
+		}
+		return candidates[i].hash < candidates[j].hash
+	})
+	if n := k * p.config.RerankFactor; len(candidates) > n {
+		candidates = candidates[:n]
+	}
+
+	// Load full-precision vectors for exact re-ranking when available
+	var exact map[string][]float32
+	if p.source != nil {
+		hashes := make([]string, len(candidates))
+		for i, c := range candidates {
+			hashes[i] = c.hash
+		}
+		if exact, err = p.source(ctx, hashes); err != nil {
+			return nil, fmt.Errorf("loading vectors for re-ranking: %w", err)
+		}
+	}
+
+	results := make([]VectorResult, 0, len(candidates))
+	for _, c := range candidates {
+		vec, ok := exact[c.hash]
+		if !ok {
+			decoded, err := p.codec.Decode(p.codes[c.hash])
+			if err != nil {
+				continue // Skip corrupt codes
+			}
+			vec = decoded
+		}
+		score := p.metric.Similarity(query, vec)
+		results = append(results, VectorResult{
+			ContentHash: c.hash,
+			Distance:    similarityToDistance(score, p.metric),
+			Score:       score,
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ContentHash < results[j].ContentHash
+	})
+	if len(results) > k {
+		results = results[:k]
+	}
+
+	return results, nil
+}
+
+// SearchWithFilter finds k nearest neighbors. Like the brute-force index,
+// the PQ index has no repository information, so filtering by repo is left
+// to the caller with location data.
+func (p *PQVectorIndex) SearchWithFilter(ctx context.Context, query []float32, k int, repoRoots []string) ([]VectorResult, error) {
+	return p.Search(ctx, query, k)
+}
+
+// Delete removes an embedding from the index.
+func (p *PQVectorIndex) Delete(ctx context.Context, contentHash string) error {
+	return p.DeleteBatch(ctx, []string{contentHash})
+}
+
+// DeleteBatch removes multiple embeddings.
+func (p *PQVectorIndex) DeleteBatch(ctx context.Context, contentHashes []string) error {
+	if len(contentHashes) == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	placeholders := make([]string, len(contentHashes))
+	args := make([]any, 0, len(contentHashes)+1)
+	args = append(args, p.model)
+	for i, hash := range contentHashes {
+		placeholders[i] = p.dialect.Placeholder(i + 2)
+		args = append(args, hash)
+	}
+	query := fmt.Sprintf("DELETE FROM %s WHERE model = %s AND content_hash IN (%s)",
+		p.codesTable(), p.dialect.Placeholder(1), strings.Join(placeholders, ", "))
+	if _, err := p.database.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("deleting PQ codes: %w", err)
+	}
+
+	for _, hash := range contentHashes {
+		delete(p.codes, hash)
+	}
+	return nil
+}
+
+// Rebuild reloads codebooks and codes from the database.
+func (p *PQVectorIndex) Rebuild(ctx context.Context) error {
+	p.mu.Lock()
+	p.codes = make(map[string][]byte)
+	p.loaded = false
+	err := p.loadCodebook()
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return p.ensureLoaded(ctx)
+}
+
+// IsNative returns false (PQ search is an in-process scan, not native HNSW).
+func (p *PQVectorIndex) IsNative() bool {
+	return false
+}
+
+// Count returns the number of encoded vectors in the index.
+func (p *PQVectorIndex) Count(ctx context.Context) (int, error) {
+	if err := p.ensureLoaded(ctx); err != nil {
+		return 0, err
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.codes), nil
+}
+
+// holds returns which of hashes have codes in the index, so vectors
+// persisted by an earlier process are not encoded again.
+func (p *PQVectorIndex) holds(ctx context.Context, hashes []string) (map[string]bool, error) {
+	if err := p.ensureLoaded(ctx); err != nil {
+		return nil, err
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	held := make(map[string]bool)
+	for _, hash := range hashes {
+		if _, ok := p.codes[hash]; ok {
+			held[hash] = true
+		}
+	}
+	return held, nil
+}
+
+// ensureLoaded loads all codes into memory on first use.
+func (p *PQVectorIndex) ensureLoaded(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.loaded {
+		return nil
+	}
+
+	query := p.schema.SubstitutePlaceholders(fmt.Sprintf("SELECT content_hash, codes FROM %s WHERE model = ?", p.codesTable()))
+	rows, err := p.database.QueryContext(ctx, query, p.model)
+	if err != nil {
+		return fmt.Errorf("loading PQ codes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash string
+		var codes []byte
+		if err := rows.Scan(&hash, &codes); err != nil {
+			continue // Skip malformed rows
+		}
+		p.codes[hash] = codes
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterating PQ codes: %w", err)
+	}
+
+	p.loaded = true
+	return nil
+}
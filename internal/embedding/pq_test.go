@@ -0,0 +1,321 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"codetect/internal/config"
+	"codetect/internal/db"
+)
+
+// clusteredVectors generates n vectors around the given number of random
+// cluster centers, with Gaussian noise of the given scale.
+func clusteredVectors(rng *rand.Rand, n, dims, clusters int, noise float64) [][]float32 {
+	centers := make([][]float32, clusters)
+	for c := range centers {
+		centers[c] = make([]float32, dims)
+		for j := range centers[c] {
+			centers[c][j] = float32(rng.NormFloat64())
+		}
+	}
+
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		center := centers[rng.Intn(clusters)]
+		v := make([]float32, dims)
+		for j := range v {
+			v[j] = center[j] + float32(rng.NormFloat64()*noise)
+		}
+		vectors[i] = v
+	}
+	return vectors
+}
+
+func testPQConfig() config.PQConfig {
+	cfg := config.DefaultPQConfig()
+	cfg.Subspaces = 16
+	cfg.Centroids = 64
+	cfg.Iterations = 15
+	return cfg
+}
+
+func TestPQCodecRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	vectors := clusteredVectors(rng, 500, 32, 8, 0.3)
+
+	cfg := testPQConfig()
+	cfg.Subspaces = 8
+	codec, err := TrainPQ(vectors, cfg)
+	if err != nil {
+		t.Fatalf("TrainPQ failed: %v", err)
+	}
+
+	codes, err := codec.Encode(vectors[0])
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if len(codes) != 8 {
+		t.Fatalf("code length = %d, want 8", len(codes))
+	}
+
+	decoded, err := codec.Decode(codes)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if sim := CosineSimilarity(vectors[0], decoded); sim < 0.9 {
+		t.Errorf("reconstruction similarity = %.3f, want >= 0.9", sim)
+	}
+
+	// Serialized codebooks decode identically
+	data, err := codec.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	var restored PQCodec
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	again, err := restored.Decode(codes)
+	if err != nil {
+		t.Fatalf("Decode after restore failed: %v", err)
+	}
+	for i := range decoded {
+		if decoded[i] != again[i] {
+			t.Fatalf("restored codec decodes differently at %d", i)
+		}
+	}
+
+	if err := restored.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Error("expected error for truncated codebook data")
+	}
+}
+
+func TestTrainPQRejectsBadConfig(t *testing.T) {
+	vectors := [][]float32{{1, 2, 3}, {4, 5, 6}}
+	cfg := testPQConfig()
+	cfg.Subspaces = 2 // Does not divide 3
+
+	if _, err := TrainPQ(vectors, cfg); err == nil {
+		t.Error("expected error when subspaces does not divide dimensions")
+	}
+	if _, err := TrainPQ(nil, testPQConfig()); err == nil {
+		t.Error("expected error for empty training set")
+	}
+}
+
+func TestPQVectorIndexRecall(t *testing.T) {
+	const (
+		dims      = 64
+		n         = 3000
+		queries   = 30
+		k         = 10
+		minRecall = 0.85
+	)
+
+	rng := rand.New(rand.NewSource(7))
+	vectors := clusteredVectors(rng, n+queries, dims, 50, 0.4)
+	data, queryVecs := vectors[:n], vectors[n:]
+
+	database, err := db.Open(db.DefaultConfig(":memory:"))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	defer database.Close()
+
+	ctx := context.Background()
+	idx, err := NewPQVectorIndex(database, db.GetDialect(db.DatabaseSQLite), dims, "test-model", testPQConfig())
+	if err != nil {
+		t.Fatalf("NewPQVectorIndex failed: %v", err)
+	}
+
+	if err := idx.Insert(ctx, "early", data[0]); !errors.Is(err, ErrPQNotTrained) {
+		t.Fatalf("Insert before Train: err = %v, want ErrPQNotTrained", err)
+	}
+
+	if err := idx.Train(ctx, data); err != nil {
+		t.Fatalf("Train failed: %v", err)
+	}
+
+	entries := make(map[string][]float32, n)
+	hashes := make([]string, n)
+	for i, v := range data {
+		hashes[i] = fmt.Sprintf("h%04d", i)
+		entries[hashes[i]] = v
+	}
+	if err := idx.InsertBatch(ctx, entries); err != nil {
+		t.Fatalf("InsertBatch failed: %v", err)
+	}
+
+	// Re-rank candidates against full-precision vectors
+	idx.SetVectorSource(func(ctx context.Context, want []string) (map[string][]float32, error) {
+		vectors := make(map[string][]float32, len(want))
+		for _, h := range want {
+			vectors[h] = entries[h]
+		}
+		return vectors, nil
+	})
+
+	var totalRecall float64
+	for _, q := range queryVecs {
+		want := make(map[string]bool, k)
+		for _, item := range TopKByCosineSimilarity(q, data, k) {
+			want[hashes[item.Index]] = true
+		}
+
+		got, err := idx.Search(ctx, q, k)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(got) != k {
+			t.Fatalf("got %d results, want %d", len(got), k)
+		}
+
+		hits := 0
+		for _, r := range got {
+			if want[r.ContentHash] {
+				hits++
+			}
+		}
+		totalRecall += float64(hits) / k
+	}
+
+	recall := totalRecall / queries
+	t.Logf("PQ recall@%d = %.3f", k, recall)
+	if recall < minRecall {
+		t.Errorf("recall@%d = %.3f, want >= %.2f", k, recall, minRecall)
+	}
+}
+
+func TestPQVectorIndexPersistence(t *testing.T) {
+	const dims = 32
+
+	rng := rand.New(rand.NewSource(3))
+	vectors := clusteredVectors(rng, 300, dims, 10, 0.3)
+
+	database, err := db.Open(db.DefaultConfig(":memory:"))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	defer database.Close()
+
+	ctx := context.Background()
+	dialect := db.GetDialect(db.DatabaseSQLite)
+	cfg := testPQConfig()
+	cfg.Subspaces = 8
+
+	idx, err := NewPQVectorIndex(database, dialect, dims, "test-model", cfg)
+	if err != nil {
+		t.Fatalf("NewPQVectorIndex failed: %v", err)
+	}
+	if err := idx.Train(ctx, vectors); err != nil {
+		t.Fatalf("Train failed: %v", err)
+	}
+	for i, v := range vectors[:20] {
+		if err := idx.Insert(ctx, fmt.Sprintf("h%d", i), v); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	if err := idx.Delete(ctx, "h0"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	// A new index over the same database picks up codebooks and codes
+	reopened, err := NewPQVectorIndex(database, dialect, dims, "test-model", cfg)
+	if err != nil {
+		t.Fatalf("reopening index: %v", err)
+	}
+	if !reopened.Trained() {
+		t.Fatal("reopened index is not trained")
+	}
+	count, err := reopened.Count(ctx)
+	if err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	if count != 19 {
+		t.Errorf("Count = %d, want 19", count)
+	}
+
+	results, err := reopened.Search(ctx, vectors[5], 1)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Score < 0.9 {
+		t.Errorf("self-query results = %+v, want a close match", results)
+	}
+}
+
+func TestPQVectorIndexModels(t *testing.T) {
+	const dims = 32
+
+	rng := rand.New(rand.NewSource(5))
+	vectors := clusteredVectors(rng, 200, dims, 10, 0.3)
+
+	database, err := db.Open(db.DefaultConfig(":memory:"))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	defer database.Close()
+
+	ctx := context.Background()
+	dialect := db.GetDialect(db.DatabaseSQLite)
+	cfg := testPQConfig()
+	cfg.Subspaces = 8
+
+	primary, err := NewPQVectorIndex(database, dialect, dims, "primary", cfg)
+	if err != nil {
+		t.Fatalf("NewPQVectorIndex failed: %v", err)
+	}
+	if err := primary.Train(ctx, vectors); err != nil {
+		t.Fatalf("Train failed: %v", err)
+	}
+	for i, v := range vectors[:10] {
+		if err := primary.Insert(ctx, fmt.Sprintf("h%d", i), v); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	// A model of the same dimensions has codebooks and codes of its own
+	extra, err := NewPQVectorIndex(database, dialect, dims, "extra", cfg)
+	if err != nil {
+		t.Fatalf("NewPQVectorIndex failed: %v", err)
+	}
+	if extra.Trained() {
+		t.Fatal("index of another model loaded the primary model's codebooks")
+	}
+	if err := extra.Train(ctx, vectors[100:]); err != nil {
+		t.Fatalf("Train failed: %v", err)
+	}
+	if err := extra.Insert(ctx, "h0", vectors[150]); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if err := primary.Rebuild(ctx); err != nil {
+		t.Fatalf("Rebuild failed: %v", err)
+	}
+	if n, _ := primary.Count(ctx); n != 10 {
+		t.Errorf("primary model has %d codes after training another, want 10", n)
+	}
+	if n, _ := extra.Count(ctx); n != 1 {
+		t.Errorf("extra model has %d codes, want 1", n)
+	}
+
+	// Candidates are re-ranked by the index's metric
+	exact := make(map[string][]float32)
+	for i, v := range vectors[:10] {
+		exact[fmt.Sprintf("h%d", i)] = v
+	}
+	primary.SetVectorSource(func(ctx context.Context, hashes []string) (map[string][]float32, error) {
+		return exact, nil
+	})
+	primary.SetMetric(MetricDotProduct)
+	results, err := primary.Search(ctx, vectors[3], 1)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("Search = %+v, %v", results, err)
+	}
+	want := DotProduct(vectors[3], exact[results[0].ContentHash])
+	if results[0].Score != want || results[0].Distance != -want {
+		t.Errorf("dot product result = %+v, want score %v and distance %v", results[0], want, -want)
+	}
+}
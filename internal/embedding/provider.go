@@ -24,6 +24,19 @@ type ProviderConfig struct {
 	LiteLLMKey string   // API key for LiteLLM
 	Model      string   // model name (provider-specific default if empty)
 	Dimensions int      // embedding dimensions (0 = auto-detect)
+
+	// Compress gzips embedding request bodies, for an endpoint that
+	// accepts "Content-Encoding: gzip" (see WithLiteLLMCompression)
+	Compress bool
+
+	// Fallback, if set, is used when this provider is unavailable or an
+	// embedding call fails (see FallbackEmbedder). Its dimensions must
+	// match.
+	Fallback *ProviderConfig
+
+	// ExtraModels are further models of this provider that v2 indexing
+	// also embeds every chunk with, for comparison (see ModelSpace)
+	ExtraModels []string
 }
 
 // DefaultProviderConfig returns the default provider configuration
@@ -43,14 +56,9 @@ func LoadConfigFromEnv() ProviderConfig {
 
 	// Provider selection
 	if p := os.Getenv("CODETECT_EMBEDDING_PROVIDER"); p != "" {
-		switch strings.ToLower(p) {
-		case "ollama":
-			cfg.Provider = ProviderOllama
-		case "litellm":
-			cfg.Provider = ProviderLiteLLM
-		case "off", "disabled", "none":
-			cfg.Provider = ProviderOff
-		default:
+		if provider, ok := parseProvider(p); ok {
+			cfg.Provider = provider
+		} else {
 			// Log warning but use default
 			fmt.Fprintf(os.Stderr, "warning: unknown embedding provider %q, using ollama\n", p)
 		}
@@ -81,11 +89,73 @@ func LoadConfigFromEnv() ProviderConfig {
 		}
 	}
 
+	// Request compression
+	if v := os.Getenv("CODETECT_EMBEDDING_COMPRESS"); v != "" {
+		if on, err := strconv.ParseBool(v); err == nil {
+			cfg.Compress = on
+		}
+	}
+
+	// Fallback provider, sharing the URLs, key and dimensions above
+	if p := os.Getenv("CODETECT_EMBEDDING_FALLBACK_PROVIDER"); p != "" {
+		provider, ok := parseProvider(p)
+		switch {
+		case !ok:
+			fmt.Fprintf(os.Stderr, "warning: unknown fallback embedding provider %q, ignoring\n", p)
+		case provider != ProviderOff:
+			fallback := cfg
+			fallback.Provider = provider
+			fallback.Model = os.Getenv("CODETECT_EMBEDDING_FALLBACK_MODEL")
+			// Often a different endpoint, so compressed only if asked
+			fallback.Compress, _ = strconv.ParseBool(os.Getenv("CODETECT_EMBEDDING_FALLBACK_COMPRESS"))
+			cfg.Fallback = &fallback
+		}
+	}
+
+	// Extra models to embed with, for comparing models
+	for _, model := range strings.Split(os.Getenv("CODETECT_EMBEDDING_EXTRA_MODELS"), ",") {
+		if model = strings.TrimSpace(model); model != "" {
+			cfg.ExtraModels = append(cfg.ExtraModels, model)
+		}
+	}
+
 	return cfg
 }
 
-// NewEmbedder creates an Embedder from the configuration
+// parseProvider parses a provider name as accepted by
+// CODETECT_EMBEDDING_PROVIDER.
+func parseProvider(name string) (Provider, bool) {
+	switch strings.ToLower(name) {
+	case "ollama":
+		return ProviderOllama, true
+	case "litellm":
+		return ProviderLiteLLM, true
+	case "off", "disabled", "none":
+		return ProviderOff, true
+	default:
+		return "", false
+	}
+}
+
+// NewEmbedder creates an Embedder from the configuration. A configured
+// Fallback wraps the result in a FallbackEmbedder.
 func NewEmbedder(cfg ProviderConfig) (Embedder, error) {
+	if cfg.Fallback != nil && cfg.Provider != ProviderOff {
+		fallbackCfg := *cfg.Fallback
+		fallbackCfg.Fallback = nil
+		cfg.Fallback = nil
+
+		primary, err := NewEmbedder(cfg)
+		if err != nil {
+			return nil, err
+		}
+		fallback, err := NewEmbedder(fallbackCfg)
+		if err != nil {
+			return nil, fmt.Errorf("fallback: %w", err)
+		}
+		return NewFallbackEmbedder(primary, fallback)
+	}
+
 	switch cfg.Provider {
 	case ProviderOff:
 		return &NullEmbedder{}, nil
@@ -97,6 +167,9 @@ func NewEmbedder(cfg ProviderConfig) (Embedder, error) {
 		if cfg.Model != "" {
 			opts = append(opts, WithModel(cfg.Model))
 		}
+		if cfg.Compress {
+			opts = append(opts, WithCompression(true))
+		}
 		return NewOllamaClient(opts...), nil
 
 	case ProviderLiteLLM:
@@ -112,6 +185,9 @@ func NewEmbedder(cfg ProviderConfig) (Embedder, error) {
 		if cfg.Dimensions > 0 {
 			opts = append(opts, WithLiteLLMDimensions(cfg.Dimensions))
 		}
+		if cfg.Compress {
+			opts = append(opts, WithLiteLLMCompression(true))
+		}
 		return NewLiteLLMClient(opts...), nil
 
 	default:
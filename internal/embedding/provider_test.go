@@ -127,6 +127,50 @@ func TestLoadConfigFromEnv(t *testing.T) {
 	})
 }
 
+func TestLoadConfigFromEnvFallback(t *testing.T) {
+	for _, key := range []string{"CODETECT_EMBEDDING_PROVIDER", "CODETECT_EMBEDDING_FALLBACK_PROVIDER",
+		"CODETECT_EMBEDDING_FALLBACK_MODEL", "CODETECT_OLLAMA_URL", "CODETECT_EMBEDDING_MODEL"} {
+		orig, ok := os.LookupEnv(key)
+		defer func(key, orig string, ok bool) {
+			if ok {
+				os.Setenv(key, orig)
+			} else {
+				os.Unsetenv(key)
+			}
+		}(key, orig, ok)
+		os.Unsetenv(key)
+	}
+
+	if cfg := LoadConfigFromEnv(); cfg.Fallback != nil {
+		t.Errorf("expected no fallback by default, got %+v", cfg.Fallback)
+	}
+
+	os.Setenv("CODETECT_EMBEDDING_PROVIDER", "litellm")
+	os.Setenv("CODETECT_EMBEDDING_MODEL", "text-embedding-3-small")
+	os.Setenv("CODETECT_EMBEDDING_FALLBACK_PROVIDER", "ollama")
+	os.Setenv("CODETECT_EMBEDDING_FALLBACK_MODEL", "nomic-embed-text")
+	os.Setenv("CODETECT_OLLAMA_URL", "http://local:11434")
+
+	cfg := LoadConfigFromEnv()
+	if cfg.Fallback == nil {
+		t.Fatal("expected a fallback provider")
+	}
+	if cfg.Fallback.Provider != ProviderOllama || cfg.Fallback.Model != "nomic-embed-text" {
+		t.Errorf("unexpected fallback %+v", cfg.Fallback)
+	}
+	if cfg.Fallback.OllamaURL != "http://local:11434" {
+		t.Errorf("fallback OllamaURL = %q, want the shared URL", cfg.Fallback.OllamaURL)
+	}
+	if cfg.Fallback.Fallback != nil {
+		t.Error("fallback should not have a fallback of its own")
+	}
+
+	os.Setenv("CODETECT_EMBEDDING_FALLBACK_PROVIDER", "off")
+	if cfg := LoadConfigFromEnv(); cfg.Fallback != nil {
+		t.Errorf("expected no fallback for off, got %+v", cfg.Fallback)
+	}
+}
+
 func TestNewEmbedder(t *testing.T) {
 	t.Run("creates NullEmbedder for off", func(t *testing.T) {
 		cfg := ProviderConfig{Provider: ProviderOff}
@@ -0,0 +1,174 @@
+package embedding
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"codetect/internal/db"
+)
+
+// MaxQueryLog is how many queries QueryLog keeps per repository; older
+// ones are dropped as new queries are recorded.
+const MaxQueryLog = 10000
+
+// Query log modes, chosen by CODETECT_QUERY_LOG. Hashed logs let frequent
+// queries be counted without storing what was searched for.
+const (
+	QueryLogOff    = ""
+	QueryLogHashed = "hashed"
+	QueryLogRaw    = "raw"
+)
+
+// LoggedQuery is one search recorded in a QueryLog, with its top result.
+type LoggedQuery struct {
+	RepoRoot string    `json:"repo_root"`
+	Tool     string    `json:"tool"`
+	Query    string    `json:"query"`  // The query, or its HashQuery if Hashed
+	Hashed   bool      `json:"hashed"` // Query holds a hash
+	Results  int       `json:"results"`
+	TopPath  string    `json:"top_path,omitempty"`
+	TopLine  int       `json:"top_line,omitempty"`
+	TopScore float64   `json:"top_score,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+// QuerySummary aggregates the logged searches of one query by one tool.
+type QuerySummary struct {
+	Tool        string    `json:"tool"`
+	Query       string    `json:"query"`
+	Hashed      bool      `json:"hashed"`
+	Count       int       `json:"count"`
+	Empty       int       `json:"empty"`         // Searches that returned nothing
+	AvgResults  float64   `json:"avg_results"`   // Results per search
+	AvgTopScore float64   `json:"avg_top_score"` // Over searches with results
+	LastAt      time.Time `json:"last_at"`
+}
+
+// HashQuery returns the hash a hashed query log stores for query. Case
+// and surrounding whitespace are ignored, so repeats of a query are
+// counted together.
+func HashQuery(query string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(query))))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// QueryLog records searches and their top results, so what users search
+// for and how well it is answered can be analyzed later. Logging is
+// opt-in; see indexer.Config.QueryLog.
+type QueryLog struct {
+	database db.DB
+	dialect  db.Dialect
+	schema   *db.SchemaBuilder
+	mu       sync.Mutex
+}
+
+// NewQueryLog creates a query log in database.
+func NewQueryLog(database db.DB, dialect db.Dialect) (*QueryLog, error) {
+	l := &QueryLog{
+		database: database,
+		dialect:  dialect,
+		schema:   db.NewSchemaBuilder(database, dialect),
+	}
+	columns := []db.ColumnDef{
+		{Name: "id", Type: db.ColTypeAutoIncrement},
+		{Name: "repo_root", Type: db.ColTypeText, Nullable: false},
+		{Name: "tool", Type: db.ColTypeText, Nullable: false},
+		{Name: "query", Type: db.ColTypeText, Nullable: false},
+		{Name: "hashed", Type: db.ColTypeInteger, Nullable: false},
+		{Name: "results", Type: db.ColTypeInteger, Nullable: false},
+		{Name: "top_path", Type: db.ColTypeText, Nullable: false},
+		{Name: "top_line", Type: db.ColTypeInteger, Nullable: false},
+		{Name: "top_score", Type: db.ColTypeReal, Nullable: false},
+		{Name: "logged_at", Type: db.ColTypeInteger, Nullable: false},
+	}
+	if _, err := database.Exec(dialect.CreateTableSQL("query_log", columns)); err != nil {
+		return nil, fmt.Errorf("creating query_log table: %w", err)
+	}
+	idxRepo := dialect.CreateIndexSQL("query_log", "idx_query_log_repo", []string{"repo_root", "query"}, false)
+	if _, err := database.Exec(idxRepo); err != nil {
+		return nil, fmt.Errorf("creating query_log index: %w", err)
+	}
+	return l, nil
+}
+
+// Record stores q, dropping the repository's oldest queries beyond
+// MaxQueryLog. A zero At is the current time.
+func (l *QueryLog) Record(q LoggedQuery) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if q.At.IsZero() {
+		q.At = time.Now()
+	}
+	hashed := 0
+	if q.Hashed {
+		hashed = 1
+	}
+	insert := l.schema.SubstitutePlaceholders(`
+		INSERT INTO query_log (repo_root, tool, query, hashed, results, top_path, top_line, top_score, logged_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if _, err := l.database.Exec(insert, q.RepoRoot, q.Tool, q.Query, hashed, q.Results,
+		q.TopPath, q.TopLine, q.TopScore, q.At.UnixMilli()); err != nil {
+		return fmt.Errorf("recording query: %w", err)
+	}
+
+	prune := l.schema.SubstitutePlaceholders(`
+		DELETE FROM query_log WHERE repo_root = ? AND id NOT IN (
+			SELECT id FROM query_log WHERE repo_root = ? ORDER BY id DESC LIMIT ?
+		)
+	`)
+	if _, err := l.database.Exec(prune, q.RepoRoot, q.RepoRoot, MaxQueryLog); err != nil {
+		return fmt.Errorf("pruning query log: %w", err)
+	}
+	return nil
+}
+
+// Summarize returns the repository's limit most frequent queries per tool,
+// most frequent first. A limit of 0 or less returns all of them.
+func (l *QueryLog) Summarize(repoRoot string, limit int) ([]QuerySummary, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if limit <= 0 {
+		limit = MaxQueryLog
+	}
+	query := l.schema.SubstitutePlaceholders(`
+		SELECT tool, query, hashed, COUNT(*),
+			SUM(CASE WHEN results = 0 THEN 1 ELSE 0 END),
+			AVG(results),
+			AVG(CASE WHEN results > 0 THEN top_score END),
+			MAX(logged_at)
+		FROM query_log WHERE repo_root = ?
+		GROUP BY tool, query, hashed
+		ORDER BY COUNT(*) DESC, MAX(logged_at) DESC
+		LIMIT ?
+	`)
+	rows, err := l.database.Query(query, repoRoot, limit)
+	if err != nil {
+		return nil, fmt.Errorf("querying query log: %w", err)
+	}
+	defer rows.Close()
+
+	var summaries []QuerySummary
+	for rows.Next() {
+		var s QuerySummary
+		var hashed int
+		var avgTopScore sql.NullFloat64
+		var lastAt int64
+		if err := rows.Scan(&s.Tool, &s.Query, &hashed, &s.Count, &s.Empty,
+			&s.AvgResults, &avgTopScore, &lastAt); err != nil {
+			return nil, fmt.Errorf("scanning query summary: %w", err)
+		}
+		s.Hashed = hashed != 0
+		s.AvgTopScore = avgTopScore.Float64
+		s.LastAt = time.UnixMilli(lastAt)
+		summaries = append(summaries, s)
+	}
+	return summaries, rows.Err()
+}
@@ -0,0 +1,75 @@
+package embedding
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"codetect/internal/db"
+)
+
+func TestQueryLog(t *testing.T) {
+	cfg := db.DefaultConfig(":memory:")
+	database, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	log, err := NewQueryLog(database, cfg.Dialect())
+	if err != nil {
+		t.Fatalf("NewQueryLog failed: %v", err)
+	}
+	if s, err := log.Summarize("/project", 0); len(s) != 0 || err != nil {
+		t.Fatalf("Summarize before Record = %+v, %v; want none", s, err)
+	}
+
+	base := time.UnixMilli(1_700_000_000_000)
+	for i, q := range []LoggedQuery{
+		{Tool: "hybrid_search_v2", Query: "auth middleware", Results: 5, TopPath: "auth.go", TopLine: 10, TopScore: 0.04},
+		{Tool: "hybrid_search_v2", Query: "auth middleware", Results: 3, TopPath: "auth.go", TopLine: 10, TopScore: 0.02},
+		{Tool: "hybrid_search_v2", Query: "auth middleware", Results: 0},
+		{Tool: "hybrid_search_v2", Query: "retry loop", Results: 1, TopPath: "retry.go", TopLine: 3, TopScore: 0.01},
+	} {
+		q.RepoRoot, q.At = "/project", base.Add(time.Duration(i)*time.Minute)
+		if err := log.Record(q); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+	if err := log.Record(LoggedQuery{RepoRoot: "/other", Tool: "hybrid_search_v2", Query: "retry loop"}); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+
+	summaries, err := log.Summarize("/project", 0)
+	if err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	if len(summaries) != 2 {
+		t.Fatalf("Summarize = %+v, want 2 queries", summaries)
+	}
+	auth := summaries[0]
+	if auth.Query != "auth middleware" || auth.Count != 3 || auth.Empty != 1 ||
+		auth.AvgResults != 8.0/3 || auth.AvgTopScore != 0.03 || !auth.LastAt.Equal(base.Add(2*time.Minute)) {
+		t.Errorf("most frequent = %+v, want auth middleware 3 times, 1 empty, top score 0.03", auth)
+	}
+	if summaries[1].Query != "retry loop" || summaries[1].Count != 1 {
+		t.Errorf("second = %+v, want retry loop once", summaries[1])
+	}
+
+	if limited, _ := log.Summarize("/project", 1); len(limited) != 1 {
+		t.Errorf("Summarize with limit 1 returned %d queries", len(limited))
+	}
+}
+
+func TestHashQuery(t *testing.T) {
+	h := HashQuery("Auth Middleware")
+	if !strings.HasPrefix(h, "sha256:") || strings.Contains(h, "Auth") {
+		t.Errorf("HashQuery = %q, want a sha256 hash hiding the query", h)
+	}
+	if HashQuery("  auth middleware ") != h {
+		t.Error("HashQuery differs by case and surrounding whitespace")
+	}
+	if HashQuery("auth handler") == h {
+		t.Error("HashQuery is the same for different queries")
+	}
+}
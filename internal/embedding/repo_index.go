@@ -0,0 +1,252 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// RepoVectorIndex keeps a VectorIndex filled with the vectors an
+// EmbeddingCache holds for repositories' chunk locations, so a
+// CacheSearcher can take its candidates from the index instead of scoring
+// every vector (see CacheSearcher.SetVectorIndex). Each search first syncs
+// its repository: vectors of chunks added since the last sync are inserted
+// and those of removed chunks deleted. Indexes held in memory are filled by
+// the first sync of a repository in a process. A ShardedVectorIndex gets
+// each repository's vectors in its shard and is searched by shard.
+//
+// An untrained PQVectorIndex is trained on the repository's vectors once
+// there are at least as many as its codebooks have centroids; until then it
+// serves no searches.
+type RepoVectorIndex struct {
+	index     VectorIndex
+	cache     *EmbeddingCache
+	locations *LocationStore
+
+	mu    sync.Mutex
+	repos map[string]*syncedRepo // By repository root
+}
+
+// syncedRepo is what the last sync of a repository left in the index.
+type syncedRepo struct {
+	version string          // indexVersion at the sync
+	hashes  map[string]bool // Content hashes whose vectors are in the index
+	ready   bool            // Whether the index can serve the repo's searches
+}
+
+// vectorHolder is implemented by indexes that persist their vectors, so
+// vectors held since an earlier process are not inserted again.
+type vectorHolder interface {
+	holds(ctx context.Context, hashes []string) (map[string]bool, error)
+}
+
+// NewRepoVectorIndex creates a RepoVectorIndex filling index with the
+// vectors of cache's model referenced from locations.
+func NewRepoVectorIndex(index VectorIndex, cache *EmbeddingCache, locations *LocationStore) *RepoVectorIndex {
+	return &RepoVectorIndex{
+		index:     index,
+		cache:     cache,
+		locations: locations,
+		repos:     make(map[string]*syncedRepo),
+	}
+}
+
+// Index returns the filled index.
+func (r *RepoVectorIndex) Index() VectorIndex {
+	return r.index
+}
+
+// Sync brings the index up to date with the locations of repoRoot. It is
+// cheap when nothing changed since the last sync.
+func (r *RepoVectorIndex) Sync(ctx context.Context, repoRoot string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := r.sync(ctx, repoRoot)
+	return err
+}
+
+// Search syncs repoRoot and returns the k nearest neighbors of query from
+// the index. The results may include vectors of other repositories. ok is
+// false, with no error, when the index cannot serve the search yet.
+func (r *RepoVectorIndex) Search(ctx context.Context, repoRoot string, query []float32, k int) (results []VectorResult, ok bool, err error) {
+	r.mu.Lock()
+	repo, err := r.sync(ctx, repoRoot)
+	r.mu.Unlock()
+	if err != nil || !repo.ready {
+		return nil, false, err
+	}
+
+	if sharded, isSharded := r.index.(*ShardedVectorIndex); isSharded {
+		results, err = sharded.SearchWithFilter(ctx, query, k, []string{repoRoot})
+	} else {
+		results, err = r.index.Search(ctx, query, k)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return results, true, nil
+}
+
+// sync updates the index for repoRoot and returns its state. The caller
+// must hold r.mu.
+func (r *RepoVectorIndex) sync(ctx context.Context, repoRoot string) (*syncedRepo, error) {
+	version, err := indexVersion(r.locations, r.cache, repoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("checking index version: %w", err)
+	}
+	repo := r.repos[repoRoot]
+	if repo != nil && repo.version == version {
+		return repo, nil
+	}
+	if repo == nil {
+		repo = &syncedRepo{hashes: make(map[string]bool)}
+	}
+
+	hashes, err := r.locations.GetHashesForRepo(repoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("getting repo hashes: %w", err)
+	}
+	current := make(map[string]bool, len(hashes))
+	var added []string
+	for _, hash := range hashes {
+		current[hash] = true
+		if !repo.hashes[hash] {
+			added = append(added, hash)
+		}
+	}
+	var removed []string
+	for hash := range repo.hashes {
+		if !current[hash] {
+			removed = append(removed, hash)
+		}
+	}
+
+	if holder, ok := r.index.(vectorHolder); ok && len(added) > 0 {
+		held, err := holder.holds(ctx, added)
+		if err != nil {
+			return nil, fmt.Errorf("checking indexed vectors: %w", err)
+		}
+		missing := added[:0]
+		for _, hash := range added {
+			if held[hash] {
+				repo.hashes[hash] = true
+			} else {
+				missing = append(missing, hash)
+			}
+		}
+		added = missing
+	}
+
+	if pq, ok := r.index.(*PQVectorIndex); ok && !pq.Trained() {
+		trained, err := r.train(ctx, pq, added)
+		if err != nil {
+			return nil, err
+		}
+		if !trained {
+			repo.version, repo.ready = version, false
+			r.repos[repoRoot] = repo
+			return repo, nil
+		}
+	}
+
+	sharded, isSharded := r.index.(*ShardedVectorIndex)
+	for i := 0; i < len(added); i += hasEntryBatchSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		batch, err := r.load(added[i:min(i+hasEntryBatchSize, len(added))])
+		if err != nil {
+			return nil, err
+		}
+		if isSharded {
+			err = sharded.InsertForRepo(ctx, repoRoot, batch)
+		} else {
+			err = r.index.InsertBatch(ctx, batch)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("inserting vectors: %w", err)
+		}
+		for hash := range batch {
+			repo.hashes[hash] = true
+		}
+	}
+
+	// Vectors of another synced repository stay, unless in its own shard
+	var stale []string
+	for _, hash := range removed {
+		if isSharded || !r.heldForOther(repoRoot, hash) {
+			stale = append(stale, hash)
+		}
+	}
+	target := r.index
+	if isSharded {
+		target = sharded.Shard(repoRoot)
+	}
+	if len(stale) > 0 && target != nil {
+		if err := target.DeleteBatch(ctx, stale); err != nil {
+			return nil, fmt.Errorf("deleting vectors: %w", err)
+		}
+	}
+	for _, hash := range removed {
+		delete(repo.hashes, hash)
+	}
+
+	repo.version, repo.ready = version, true
+	r.repos[repoRoot] = repo
+	return repo, nil
+}
+
+// train trains pq on up to its TrainSampleSize of the vectors of hashes,
+// and reports false without training if there are fewer vectors than
+// codebook centroids.
+func (r *RepoVectorIndex) train(ctx context.Context, pq *PQVectorIndex, hashes []string) (bool, error) {
+	if len(hashes) < pq.config.Centroids {
+		return false, nil
+	}
+	if n := pq.config.TrainSampleSize; n > 0 && len(hashes) > n {
+		hashes = hashes[:n] // Content hashes are in no meaningful order
+	}
+
+	var sample [][]float32
+	for i := 0; i < len(hashes); i += hasEntryBatchSize {
+		batch, err := r.load(hashes[i:min(i+hasEntryBatchSize, len(hashes))])
+		if err != nil {
+			return false, err
+		}
+		for _, vec := range batch {
+			sample = append(sample, vec)
+		}
+	}
+	if len(sample) < pq.config.Centroids {
+		return false, nil
+	}
+	if err := pq.Train(ctx, sample); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// load returns the cached vectors of hashes. Hashes without one are left
+// out.
+func (r *RepoVectorIndex) load(hashes []string) (map[string][]float32, error) {
+	entries, err := r.cache.GetBatch(hashes)
+	if err != nil {
+		return nil, fmt.Errorf("loading embeddings: %w", err)
+	}
+	vectors := make(map[string][]float32, len(entries))
+	for hash, entry := range entries {
+		vectors[hash] = entry.Embedding
+	}
+	return vectors, nil
+}
+
+// heldForOther reports whether hash is in the index for a repository other
+// than repoRoot.
+func (r *RepoVectorIndex) heldForOther(repoRoot, hash string) bool {
+	for root, repo := range r.repos {
+		if root != repoRoot && repo.hashes[hash] {
+			return true
+		}
+	}
+	return false
+}
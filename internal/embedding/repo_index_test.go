@@ -0,0 +1,173 @@
+package embedding
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"codetect/internal/config"
+	"codetect/internal/db"
+)
+
+func TestRepoVectorIndexSync(t *testing.T) {
+	pipeline, embedder := setupFilePipeline(t)
+	ctx := context.Background()
+
+	shared := Chunk{Path: "c.go", StartLine: 1, EndLine: 3, Content: "alpha beta beta"}
+	if _, err := pipeline.EmbedChunks(ctx, "/project", []Chunk{
+		{Path: "a.go", StartLine: 1, EndLine: 5, Content: "alpha alpha"},
+		{Path: "b.go", StartLine: 1, EndLine: 4, Content: "beta beta"},
+		shared,
+	}); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	if _, err := pipeline.EmbedChunks(ctx, "/other", []Chunk{shared}); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+
+	index := NewBruteForceVectorIndex(nil, 3)
+	vectors := NewRepoVectorIndex(index, pipeline.Cache(), pipeline.Locations())
+	for _, repo := range []string{"/project", "/other"} {
+		if err := vectors.Sync(ctx, repo); err != nil {
+			t.Fatalf("Sync(%s) failed: %v", repo, err)
+		}
+	}
+	if n, _ := index.Count(ctx); n != 3 {
+		t.Fatalf("index holds %d vectors after syncing, want 3", n)
+	}
+
+	// A changed file's old vector leaves the index, a shared one stays
+	if _, err := pipeline.ReindexFile(ctx, "/project", "b.go", []Chunk{
+		{Path: "b.go", StartLine: 1, EndLine: 4, Content: "beta beta beta alpha"},
+	}); err != nil {
+		t.Fatalf("ReindexFile failed: %v", err)
+	}
+	if err := pipeline.Locations().DeleteByPath("/project", "c.go"); err != nil {
+		t.Fatalf("DeleteByPath failed: %v", err)
+	}
+	if err := vectors.Sync(ctx, "/project"); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	want, err := pipeline.Locations().ReferencedHashes()
+	if err != nil {
+		t.Fatalf("ReferencedHashes failed: %v", err)
+	}
+	got := make(map[string]bool)
+	index.mu.RLock()
+	for hash := range index.vectors {
+		got[hash] = true
+	}
+	index.mu.RUnlock()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("index holds %v, want the referenced hashes %v", got, want)
+	}
+
+	// Searches through the index rank as scoring every vector does
+	exact := NewCacheSearcher(pipeline.Cache(), pipeline.Locations(), embedder)
+	searcher := NewCacheSearcher(pipeline.Cache(), pipeline.Locations(), embedder)
+	searcher.SetVectorIndex(vectors)
+	for _, query := range []string{"alpha", "beta"} {
+		opts := CacheSearchOptions{RepoRoot: "/project"}
+		wantResults, err := exact.Search(ctx, query, opts)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		gotResults, err := searcher.Search(ctx, query, opts)
+		if err != nil {
+			t.Fatalf("Search through index failed: %v", err)
+		}
+		if !reflect.DeepEqual(gotResults, wantResults) {
+			t.Errorf("Search(%q) through index = %+v, want %+v", query, gotResults, wantResults)
+		}
+	}
+}
+
+func TestRepoVectorIndexFiltered(t *testing.T) {
+	pipeline, embedder := setupFilePipeline(t)
+	ctx := context.Background()
+
+	// Many alpha chunks crowd the one beta chunk out of the candidates
+	var chunks []Chunk
+	for i := range 20 {
+		chunks = append(chunks, Chunk{Path: "alpha.go", StartLine: i*10 + 1, EndLine: i*10 + 5,
+			Content: "alpha " + string(rune('a'+i))})
+	}
+	chunks = append(chunks, Chunk{Path: "beta.go", StartLine: 1, EndLine: 5, Content: "beta",
+		Metadata: map[string]string{"kind": "beta"}})
+	if _, err := pipeline.EmbedChunks(ctx, "/project", chunks); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+
+	searcher := NewCacheSearcher(pipeline.Cache(), pipeline.Locations(), embedder)
+	searcher.SetVectorIndex(NewRepoVectorIndex(NewBruteForceVectorIndex(nil, 3), pipeline.Cache(), pipeline.Locations()))
+	results, err := searcher.Search(ctx, "alpha", CacheSearchOptions{
+		RepoRoot: "/project",
+		Limit:    1,
+		Metadata: map[string]string{"kind": "beta"},
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Path != "beta.go" {
+		t.Errorf("filtered Search = %+v, want beta.go from scoring every vector", results)
+	}
+}
+
+func TestRepoVectorIndexPQ(t *testing.T) {
+	pipeline, embedder := setupFilePipeline(t)
+	ctx := context.Background()
+	if _, err := pipeline.EmbedChunks(ctx, "/project", []Chunk{
+		{Path: "a.go", StartLine: 1, EndLine: 5, Content: "alpha alpha"},
+		{Path: "b.go", StartLine: 1, EndLine: 4, Content: "beta beta"},
+	}); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+
+	cfg := config.DefaultPQConfig()
+	cfg.Subspaces = 3
+	cfg.Centroids = 4
+	database := pipeline.Cache().database
+	pq, err := NewPQVectorIndex(database, db.GetDialect(db.DatabaseSQLite), 3, "test-model", cfg)
+	if err != nil {
+		t.Fatalf("NewPQVectorIndex failed: %v", err)
+	}
+	vectors := NewRepoVectorIndex(pq, pipeline.Cache(), pipeline.Locations())
+	searcher := NewCacheSearcher(pipeline.Cache(), pipeline.Locations(), embedder)
+	searcher.SetVectorIndex(vectors)
+
+	// Too few vectors to train on: searches score every vector
+	if _, ok, err := vectors.Search(ctx, "/project", []float32{1, 0, 0.1}, 1); ok || err != nil {
+		t.Fatalf("Search before training: ok = %v, err = %v; want not ok", ok, err)
+	}
+	results, err := searcher.Search(ctx, "alpha", CacheSearchOptions{RepoRoot: "/project", Limit: 1})
+	if err != nil || len(results) != 1 || results[0].Path != "a.go" {
+		t.Fatalf("Search before training = %+v, %v; want a.go", results, err)
+	}
+
+	// Enough of them trains the codebooks and encodes every vector
+	if _, err := pipeline.EmbedChunks(ctx, "/project", []Chunk{
+		{Path: "c.go", StartLine: 1, EndLine: 5, Content: "alpha beta"},
+		{Path: "d.go", StartLine: 1, EndLine: 4, Content: "beta beta alpha"},
+	}); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	if _, ok, err := vectors.Search(ctx, "/project", []float32{1, 0, 0.1}, 1); !ok || err != nil {
+		t.Fatalf("Search after training: ok = %v, err = %v; want ok", ok, err)
+	}
+	if n, _ := pq.Count(ctx); !pq.Trained() || n != 4 {
+		t.Errorf("trained = %v with %d codes, want trained with 4", pq.Trained(), n)
+	}
+
+	// A new process finds the codes already in the database
+	reopened, err := NewPQVectorIndex(database, db.GetDialect(db.DatabaseSQLite), 3, "test-model", cfg)
+	if err != nil {
+		t.Fatalf("reopening index: %v", err)
+	}
+	resynced := NewRepoVectorIndex(reopened, pipeline.Cache(), pipeline.Locations())
+	if err := resynced.Sync(ctx, "/project"); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if n := len(resynced.repos["/project"].hashes); n != 4 {
+		t.Errorf("resynced repo has %d vectors, want 4", n)
+	}
+}
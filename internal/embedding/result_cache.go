@@ -0,0 +1,219 @@
+package embedding
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// resultCacheQuantum is the precision query vectors are rounded to when
+// building cache keys, so near-identical query embeddings share an entry.
+const resultCacheQuantum = 1e-4
+
+// ResultCache is an LRU cache of ranked search results keyed by query
+// embedding and search options, for CacheSearcher and SemanticSearcher.
+// Entries expire after a TTL and are invalidated when the index version
+// they were computed against changes.
+type ResultCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	entries  map[string]*list.Element
+	order    *list.List // Front = most recently used
+	hits     int64
+	misses   int64
+	now      func() time.Time
+}
+
+type resultCacheEntry struct {
+	key     string
+	version string
+	value   any // []CacheSearchResult or []SemanticResult
+	expires time.Time
+}
+
+// ResultCacheStats reports cache effectiveness.
+type ResultCacheStats struct {
+	Entries int   `json:"entries"`
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+}
+
+// NewResultCache creates a result cache holding at most capacity entries,
+// each valid for ttl. A ttl of zero means entries only expire on eviction
+// or invalidation.
+func NewResultCache(capacity int, ttl time.Duration) *ResultCache {
+	if capacity <= 0 {
+		capacity = 128
+	}
+	return &ResultCache{
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+// Get returns cached results for key if present, unexpired, and computed
+// against the given index version. Stale entries are removed.
+func (c *ResultCache) Get(key, version string) ([]CacheSearchResult, bool) {
+	value, ok := c.get(key, version)
+	results, isResults := value.([]CacheSearchResult)
+	if !ok || !isResults {
+		return nil, false
+	}
+	return append([]CacheSearchResult(nil), results...), true
+}
+
+// Put stores results for key, computed against the given index version.
+func (c *ResultCache) Put(key, version string, results []CacheSearchResult) {
+	c.put(key, version, append([]CacheSearchResult(nil), results...))
+}
+
+// getSemantic is Get for SemanticSearcher rankings.
+func (c *ResultCache) getSemantic(key, version string) ([]SemanticResult, bool) {
+	value, ok := c.get(key, version)
+	results, isResults := value.([]SemanticResult)
+	if !ok || !isResults {
+		return nil, false
+	}
+	return append([]SemanticResult(nil), results...), true
+}
+
+// putSemantic is Put for SemanticSearcher rankings.
+func (c *ResultCache) putSemantic(key, version string, results []SemanticResult) {
+	c.put(key, version, append([]SemanticResult(nil), results...))
+}
+
+func (c *ResultCache) get(key, version string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+
+	entry := elem.Value.(*resultCacheEntry)
+	if entry.version != version || (c.ttl > 0 && c.now().After(entry.expires)) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		c.misses++
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	c.hits++
+	return entry.value, true
+}
+
+func (c *ResultCache) put(key, version string, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &resultCacheEntry{
+		key:     key,
+		version: version,
+		value:   value,
+		expires: c.now().Add(c.ttl),
+	}
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*resultCacheEntry).key)
+	}
+}
+
+// Invalidate removes all entries.
+func (c *ResultCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+// Stats returns the current entry count and hit/miss counters.
+func (c *ResultCache) Stats() ResultCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ResultCacheStats{
+		Entries: c.order.Len(),
+		Hits:    c.hits,
+		Misses:  c.misses,
+	}
+}
+
+// ResultCacheKey builds a cache key from a query embedding, rounded to
+// resultCacheQuantum, and the options that affect ranking.
+func ResultCacheKey(query []float32, opts CacheSearchOptions) string {
+	h := sha256.New()
+	var buf [8]byte
+	for _, x := range query {
+		binary.LittleEndian.PutUint64(buf[:], uint64(int64(math.Round(float64(x)/resultCacheQuantum))))
+		h.Write(buf[:])
+	}
+	h.Write([]byte{0})
+	h.Write([]byte(opts.RepoRoot))
+	h.Write([]byte{0})
+	h.Write([]byte(opts.Granularity))
+	binary.LittleEndian.PutUint64(buf[:], uint64(opts.Limit))
+	h.Write(buf[:])
+	keys := make([]string, 0, len(opts.Metadata))
+	for key := range opts.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		h.Write([]byte{0})
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write([]byte(opts.Metadata[key]))
+	}
+	if opts.Model != "" {
+		h.Write([]byte{1}) // Cannot be mistaken for a metadata pair
+		h.Write([]byte(opts.Model))
+	}
+	if opts.DedupByContent {
+		h.Write([]byte{2})
+	}
+	if opts.MinScore != 0 {
+		h.Write([]byte{3})
+		binary.LittleEndian.PutUint64(buf[:], uint64(math.Float32bits(opts.MinScore)))
+		h.Write(buf[:])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// semanticCacheKey builds a cache key for a SemanticSearcher ranking. It
+// extends ResultCacheKey with what else shapes the ranking, the excluded
+// path and the metric, and never equals a CacheSearcher key.
+func semanticCacheKey(query []float32, repoRoot string, limit int, metric Metric, opts SearchOptions) string {
+	h := sha256.New()
+	h.Write([]byte("semantic"))
+	h.Write([]byte{0})
+	h.Write([]byte(ResultCacheKey(query, CacheSearchOptions{
+		RepoRoot:       repoRoot,
+		Limit:          limit,
+		DedupByContent: opts.DedupByContent,
+	})))
+	h.Write([]byte{0})
+	h.Write([]byte(opts.ExcludePath))
+	h.Write([]byte{0})
+	h.Write([]byte(metric.String()))
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,120 @@
+package embedding
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestResultCacheLRUAndTTL(t *testing.T) {
+	cache := NewResultCache(2, time.Minute)
+	now := time.Unix(1000, 0)
+	cache.now = func() time.Time { return now }
+
+	results := []CacheSearchResult{{Score: 0.9}}
+	cache.Put("a", "v1", results)
+	cache.Put("b", "v1", results)
+
+	if _, ok := cache.Get("a", "v1"); !ok {
+		t.Fatal("expected hit for a")
+	}
+
+	// Inserting c evicts the least recently used entry (b)
+	cache.Put("c", "v1", results)
+	if _, ok := cache.Get("b", "v1"); ok {
+		t.Error("expected b to be evicted")
+	}
+	if _, ok := cache.Get("a", "v1"); !ok {
+		t.Error("expected a to survive eviction")
+	}
+
+	// A different index version misses and drops the entry
+	if _, ok := cache.Get("a", "v2"); ok {
+		t.Error("expected miss for changed version")
+	}
+	if _, ok := cache.Get("a", "v1"); ok {
+		t.Error("expected stale entry to be removed")
+	}
+
+	// Entries expire after the TTL
+	now = now.Add(2 * time.Minute)
+	if _, ok := cache.Get("c", "v1"); ok {
+		t.Error("expected expired entry to miss")
+	}
+
+	stats := cache.Stats()
+	if stats.Hits != 2 || stats.Entries != 0 {
+		t.Errorf("Stats = %+v, want 2 hits and 0 entries", stats)
+	}
+}
+
+func TestResultCacheKeyRoundsQuery(t *testing.T) {
+	opts := CacheSearchOptions{RepoRoot: "/project", Limit: 10}
+
+	a := ResultCacheKey([]float32{0.12345, 0.5}, opts)
+	b := ResultCacheKey([]float32{0.123451, 0.5}, opts)
+	if a != b {
+		t.Error("near-identical queries should share a key")
+	}
+
+	if a == ResultCacheKey([]float32{0.2, 0.5}, opts) {
+		t.Error("different queries should not share a key")
+	}
+
+	opts.Granularity = GranularityFile
+	if a == ResultCacheKey([]float32{0.12345, 0.5}, opts) {
+		t.Error("different options should not share a key")
+	}
+}
+
+func TestCacheSearcherResultCache(t *testing.T) {
+	pipeline, embedder := setupFilePipeline(t)
+	ctx := context.Background()
+
+	chunks := []Chunk{
+		{Path: "a.go", StartLine: 1, EndLine: 5, Content: "alpha alpha"},
+		{Path: "b.go", StartLine: 1, EndLine: 4, Content: "beta beta"},
+	}
+	if _, err := pipeline.EmbedChunks(ctx, "/project", chunks); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+
+	searcher := NewCacheSearcher(pipeline.Cache(), pipeline.Locations(), embedder)
+	rc := NewResultCache(16, time.Minute)
+	searcher.SetResultCache(rc)
+
+	opts := CacheSearchOptions{RepoRoot: "/project"}
+	first, err := searcher.Search(ctx, "alpha", opts)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	// Repeated identical query is served from the cache
+	second, err := searcher.Search(ctx, "alpha", opts)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if stats := rc.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("after repeat: Stats = %+v, want 1 hit and 1 miss", stats)
+	}
+	if len(first) != len(second) || first[0].Path != second[0].Path || first[0].Score != second[0].Score {
+		t.Errorf("cached results differ: %+v vs %+v", first, second)
+	}
+
+	// Updating the index invalidates cached results
+	more := []Chunk{{Path: "c.go", StartLine: 1, EndLine: 3, Content: "alpha alpha alpha"}}
+	if _, err := pipeline.EmbedChunks(ctx, "/project", more); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+
+	third, err := searcher.Search(ctx, "alpha", opts)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if stats := rc.Stats(); stats.Hits != 1 || stats.Misses != 2 {
+		t.Errorf("after update: Stats = %+v, want 1 hit and 2 misses", stats)
+	}
+	if len(third) != 3 {
+		t.Errorf("got %d results after update, want 3 (new chunk included)", len(third))
+	}
+}
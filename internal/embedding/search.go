@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -16,6 +17,20 @@ type SemanticResult struct {
 	EndLine   int     `json:"end_line"`
 	Snippet   string  `json:"snippet"`
 	Score     float32 `json:"score"`
+
+	// Source names the retriever that found the result, "semantic" or
+	// "keyword", when a search may mix them
+	Source string `json:"source,omitempty"`
+
+	// Highlight marks the lines that best match the query, when requested
+	// with SearchOptions.HighlightLines
+	Highlight *Highlight `json:"highlight,omitempty"`
+
+	// AlsoAt lists other locations with identical content, when searched
+	// with SearchOptions.DedupByContent
+	AlsoAt []ResultLocation `json:"also_at,omitempty"`
+
+	contentHash string
 }
 
 // SemanticSearchResult is the full result of a semantic search
@@ -23,12 +38,30 @@ type SemanticSearchResult struct {
 	Available bool             `json:"available"`
 	Results   []SemanticResult `json:"results"`
 	Error     string           `json:"error,omitempty"`
+
+	// Fallback names the retriever whose results replaced semantic
+	// results that were not relevant, if any
+	Fallback string `json:"fallback,omitempty"`
+
+	// Truncated is set when the search was cancelled or timed out while
+	// results were resolved; Results then holds the best matches resolved
+	// so far.
+	Truncated bool `json:"truncated,omitempty"`
 }
 
 // SemanticSearcher performs semantic search over embedded code
 type SemanticSearcher struct {
 	store    *EmbeddingStore
 	embedder Embedder
+	metric   Metric
+	results  *ResultCache // Optional cache of rankings
+
+	// Vectors held in memory after Preload, with the store version they
+	// were read at
+	mu         sync.RWMutex
+	preloaded  bool
+	records    []EmbeddingRecord
+	recordsVer string
 }
 
 // NewSemanticSearcher creates a new semantic searcher from an EmbeddingStore.
@@ -39,6 +72,19 @@ func NewSemanticSearcher(store *EmbeddingStore, embedder Embedder) *SemanticSear
 	}
 }
 
+// SetMetric sets the similarity metric chunks are ranked by, which
+// should match the metric the index was built with. The default is cosine.
+func (s *SemanticSearcher) SetMetric(metric Metric) {
+	s.metric = metric
+}
+
+// SetResultCache enables caching of rankings. A cached ranking is reused
+// for the same query, options and metric until the store's version
+// changes; snippets and highlights are still read on every search.
+func (s *SemanticSearcher) SetResultCache(rc *ResultCache) {
+	s.results = rc
+}
+
 // Available checks if semantic search is available
 func (s *SemanticSearcher) Available() bool {
 	if s.embedder == nil {
@@ -52,8 +98,37 @@ func (s *SemanticSearcher) Search(query string, limit int) (*SemanticSearchResul
 	return s.SearchWithContext(context.Background(), query, limit)
 }
 
+// SearchOptions refines a semantic search.
+type SearchOptions struct {
+	Limit int // Maximum results (default: 10)
+
+	// ExcludePath drops results from this file, typically the one the
+	// caller is editing. Relative to the repository root or absolute.
+	ExcludePath string
+
+	// HighlightLines, if positive, marks the window of about this many
+	// lines in each result that best matches the query (see
+	// HighlightLines). Chunk text is read with ReadLines. Each result
+	// costs one more embedding call.
+	HighlightLines int
+	ReadLines      func(path string, start, end int) ([]string, error)
+
+	// DedupByContent collapses results with the same content hash into
+	// the best-ranked one, listing the other locations in its AlsoAt.
+	// Limit then counts distinct contents.
+	DedupByContent bool
+}
+
 // SearchWithContext performs a semantic search with a custom context
 func (s *SemanticSearcher) SearchWithContext(ctx context.Context, query string, limit int) (*SemanticSearchResult, error) {
+	result, _, err := s.search(ctx, query, SearchOptions{Limit: limit})
+	return result, err
+}
+
+// search ranks the indexed chunks against query and also returns the query
+// embedding, or nil when no search ran. Snippets are read with getSnippet.
+func (s *SemanticSearcher) search(ctx context.Context, query string, opts SearchOptions) (*SemanticSearchResult, []float32, error) {
+	limit := opts.Limit
 	if limit <= 0 {
 		limit = 10
 	}
@@ -64,13 +139,13 @@ func (s *SemanticSearcher) SearchWithContext(ctx context.Context, query string,
 			Available: false,
 			Results:   []SemanticResult{},
 			Error:     "Embedding provider not available",
-		}, nil
+		}, nil, nil
 	}
 
 	// Get all embeddings
-	records, err := s.store.GetAll()
+	records, err := s.loadRecords()
 	if err != nil {
-		return nil, fmt.Errorf("getting embeddings: %w", err)
+		return nil, nil, fmt.Errorf("getting embeddings: %w", err)
 	}
 
 	if len(records) == 0 {
@@ -78,27 +153,74 @@ func (s *SemanticSearcher) SearchWithContext(ctx context.Context, query string,
 			Available: true,
 			Results:   []SemanticResult{},
 			Error:     "No embeddings indexed. Run 'make embed' first.",
-		}, nil
+		}, nil, nil
+	}
+
+	// Drop excluded chunks before ranking, so the top limit results
+	// all come from other files
+	if opts.ExcludePath != "" {
+		records = s.excludePath(records, opts.ExcludePath)
 	}
 
 	// Embed the query
 	queryEmbeddings, err := s.embedder.Embed(ctx, []string{query})
 	if err != nil {
-		return nil, fmt.Errorf("embedding query: %w", err)
+		return nil, nil, fmt.Errorf("embedding query: %w", err)
 	}
 	if len(queryEmbeddings) == 0 {
-		return nil, fmt.Errorf("no embedding returned for query")
+		return nil, nil, fmt.Errorf("no embedding returned for query")
 	}
 	queryEmbedding := queryEmbeddings[0]
 
+	// Refuse to compare vectors from different embedding spaces
+	if err := s.recordsModel(records).Check(s.ProviderID(), len(queryEmbedding)); err != nil {
+		return nil, nil, err
+	}
+
+	// Rank the chunks, or reuse the ranking of the same search while the
+	// index is unchanged; snippets are read afresh either way
+	var results []SemanticResult
+	cached := false
+	var cacheKey, version string
+	if s.results != nil {
+		v, err := s.store.Version()
+		if err != nil {
+			return nil, nil, fmt.Errorf("checking index version: %w", err)
+		}
+		cacheKey, version = semanticCacheKey(queryEmbedding, s.store.repoRoot, limit, s.metric, opts), v
+		results, cached = s.results.getSemantic(cacheKey, version)
+	}
+	if !cached {
+		results = s.rank(queryEmbedding, records, limit, opts)
+		if s.results != nil {
+			s.results.putSemantic(cacheKey, version, results)
+		}
+	}
+	for i := range results {
+		results[i].Snippet = getSnippet(results[i].Path, results[i].StartLine, results[i].EndLine)
+	}
+
+	return &SemanticSearchResult{
+		Available: true,
+		Results:   results,
+	}, queryEmbedding, nil
+}
+
+// rank returns the limit records most similar to query, best first.
+func (s *SemanticSearcher) rank(query []float32, records []EmbeddingRecord, limit int, opts SearchOptions) []SemanticResult {
 	// Build vector list for search
 	vectors := make([][]float32, len(records))
 	for i, r := range records {
 		vectors[i] = r.Embedding
 	}
 
-	// Find top-k most similar
-	topK := TopKByCosineSimilarity(queryEmbedding, vectors, limit)
+	// Find top-k most similar, ranking every chunk when duplicates are
+	// collapsed, since they would take places in the top k
+	k := limit
+	if opts.DedupByContent {
+		k = len(vectors)
+	}
+	topK := TopKBySimilarity(query, vectors, k, s.metric)
 
 	// Build results
 	results := make([]SemanticResult, 0, len(topK))
@@ -108,21 +230,116 @@ func (s *SemanticSearcher) SearchWithContext(ctx context.Context, query string,
 		}
 
 		record := records[item.Index]
-		snippet := getSnippet(record.Path, record.StartLine, record.EndLine)
-
 		results = append(results, SemanticResult{
-			Path:      record.Path,
-			StartLine: record.StartLine,
-			EndLine:   record.EndLine,
-			Snippet:   snippet,
-			Score:     item.Score,
+			Path:        record.Path,
+			StartLine:   record.StartLine,
+			EndLine:     record.EndLine,
+			Score:       item.Score,
+			contentHash: record.ContentHash,
 		})
 	}
+	if opts.DedupByContent {
+		results = CollapseDuplicates(results,
+			func(r SemanticResult) string { return r.contentHash },
+			func(kept *SemanticResult, dup SemanticResult) {
+				kept.AlsoAt = append(kept.AlsoAt, ResultLocation{Path: dup.Path, StartLine: dup.StartLine, EndLine: dup.EndLine})
+			})
+		if len(results) > limit {
+			results = results[:limit]
+		}
+	}
+	return results
+}
 
-	return &SemanticSearchResult{
-		Available: true,
-		Results:   results,
-	}, nil
+// recordsModel returns the provider and dimensions records were embedded
+// with, as read from the first of them, or nil if it is not tagged.
+func (s *SemanticSearcher) recordsModel(records []EmbeddingRecord) *IndexModel {
+	if len(records) == 0 || records[0].Model == "" {
+		return nil
+	}
+	return &IndexModel{
+		RepoRoot:   s.store.repoRoot,
+		Model:      records[0].Model,
+		Dimensions: len(records[0].Embedding),
+	}
+}
+
+// Preload reads every embedding into memory, so searches scan vectors
+// held by the searcher instead of loading them from the database on each
+// query. Later searches check the store version and reload only when the
+// index has changed.
+func (s *SemanticSearcher) Preload(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	version, err := s.store.Version()
+	if err != nil {
+		return fmt.Errorf("checking index version: %w", err)
+	}
+	records, err := s.store.GetAll()
+	if err != nil {
+		return fmt.Errorf("loading embeddings: %w", err)
+	}
+
+	s.mu.Lock()
+	s.preloaded, s.records, s.recordsVer = true, records, version
+	s.mu.Unlock()
+	return nil
+}
+
+// PreloadedCount returns the number of vectors held in memory, or 0 if
+// Preload has not run.
+func (s *SemanticSearcher) PreloadedCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.records)
+}
+
+// loadRecords returns the embeddings to rank: the preloaded set while it
+// is current, otherwise a fresh read from the store.
+func (s *SemanticSearcher) loadRecords() ([]EmbeddingRecord, error) {
+	s.mu.RLock()
+	preloaded, records, version := s.preloaded, s.records, s.recordsVer
+	s.mu.RUnlock()
+
+	if !preloaded {
+		return s.store.GetAll()
+	}
+
+	current, err := s.store.Version()
+	if err != nil {
+		return nil, fmt.Errorf("checking index version: %w", err)
+	}
+	if current == version {
+		return records, nil
+	}
+
+	if err := s.Preload(context.Background()); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.records, nil
+}
+
+// excludePath returns records not located in path. Absolute paths are
+// resolved against the store's repository root.
+func (s *SemanticSearcher) excludePath(records []EmbeddingRecord, path string) []EmbeddingRecord {
+	if filepath.IsAbs(path) && s.store.repoRoot != "" {
+		if rel, err := filepath.Rel(s.store.repoRoot, path); err == nil {
+			path = rel
+		}
+	}
+	path = filepath.Clean(path)
+
+	kept := records[:0:0]
+	for _, r := range records {
+		if filepath.Clean(r.Path) != path {
+			kept = append(kept, r)
+		}
+	}
+	return kept
 }
 
 // Store returns the underlying embedding store
@@ -183,19 +400,23 @@ func (s *SemanticSearcher) IndexChunks(ctx context.Context, chunks []Chunk, prog
 	var successfulChunks []Chunk
 	var successfulEmbeddings [][]float32
 	var skippedCount int
+	interrupted := false
+
+	// In-flight requests are allowed to finish after cancellation so that
+	// completed work is saved rather than discarded
+	embedCtx := context.WithoutCancel(ctx)
 
 	for i, chunk := range toEmbed {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
+		if ctx.Err() != nil {
+			interrupted = true
+			break
 		}
 
 		if progressFn != nil {
 			progressFn(i+1, len(toEmbed))
 		}
 
-		embs, err := s.embedder.Embed(ctx, []string{chunk.Content})
+		embs, err := s.embedder.Embed(embedCtx, []string{chunk.Content})
 		if err != nil {
 			// Log and skip chunks that fail to embed
 			fmt.Fprintf(os.Stderr, "\n[codetect-index] failed to embed %s:%d-%d: %v\n", chunk.Path, chunk.StartLine, chunk.EndLine, err)
@@ -212,18 +433,7 @@ func (s *SemanticSearcher) IndexChunks(ctx context.Context, chunks []Chunk, prog
 		successfulEmbeddings = append(successfulEmbeddings, embs[0])
 	}
 
-	if skippedCount > 0 {
-		fmt.Fprintf(os.Stderr, "\n[codetect-index] skipped %d chunks that failed to embed\n", skippedCount)
-	}
-
-	// Save all successful embeddings with provider ID
-	if len(successfulChunks) > 0 {
-		if err := s.store.SaveBatch(successfulChunks, successfulEmbeddings, providerID); err != nil {
-			return fmt.Errorf("saving embeddings: %w", err)
-		}
-	}
-
-	return nil
+	return s.saveIndexed(ctx, successfulChunks, successfulEmbeddings, skippedCount, len(toEmbed), interrupted)
 }
 
 // IndexChunksParallel embeds and stores chunks with configurable parallelism.
@@ -286,6 +496,8 @@ func (s *SemanticSearcher) IndexChunksParallel(ctx context.Context, chunks []Chu
 	var completed atomic.Int32
 	total := int32(len(toEmbed))
 
+	embedCtx := context.WithoutCancel(ctx)
+
 	// Spawn workers
 	var wg sync.WaitGroup
 	for i := 0; i < parallelism; i++ {
@@ -293,15 +505,12 @@ func (s *SemanticSearcher) IndexChunksParallel(ctx context.Context, chunks []Chu
 		go func() {
 			defer wg.Done()
 			for j := range jobs {
-				select {
-				case <-ctx.Done():
-					results <- result{err: ctx.Err()}
-					return
-				default:
+				if ctx.Err() != nil {
+					return // Stop taking new work; queued jobs are dropped
 				}
 
-				// Embed chunk
-				embs, err := s.embedder.Embed(ctx, []string{j.chunk.Content})
+				// Embed chunk (in-flight requests finish after cancellation)
+				embs, err := s.embedder.Embed(embedCtx, []string{j.chunk.Content})
 				if err != nil {
 					results <- result{chunk: j.chunk, err: err}
 				} else if len(embs) == 0 || len(embs[0]) == 0 {
@@ -338,9 +547,6 @@ func (s *SemanticSearcher) IndexChunksParallel(ctx context.Context, chunks []Chu
 
 	for res := range results {
 		if res.err != nil {
-			if res.err == ctx.Err() {
-				return res.err
-			}
 			// Log the error with chunk details
 			fmt.Fprintf(os.Stderr, "\n[codetect-index] failed to embed %s:%d-%d: %v\n", res.chunk.Path, res.chunk.StartLine, res.chunk.EndLine, res.err)
 			skippedCount++
@@ -350,17 +556,50 @@ func (s *SemanticSearcher) IndexChunksParallel(ctx context.Context, chunks []Chu
 		successfulEmbeddings = append(successfulEmbeddings, res.embedding)
 	}
 
-	if skippedCount > 0 {
-		fmt.Fprintf(os.Stderr, "\n[codetect-index] skipped %d chunks that failed to embed\n", skippedCount)
+	return s.saveIndexed(ctx, successfulChunks, successfulEmbeddings, skippedCount, len(toEmbed), ctx.Err() != nil)
+}
+
+// InterruptedError reports that indexing was cancelled part-way through.
+// Embeddings completed before cancellation were saved; the rest were not.
+type InterruptedError struct {
+	Saved   int   // Embeddings committed before stopping
+	Skipped int   // Chunks that failed to embed
+	Total   int   // Chunks that needed embedding
+	Err     error // The context error that caused the interruption
+}
+
+func (e *InterruptedError) Error() string {
+	return fmt.Sprintf("indexing interrupted after %d/%d chunks: %v", e.Saved, e.Total, e.Err)
+}
+
+func (e *InterruptedError) Unwrap() error {
+	return e.Err
+}
+
+// saveIndexed commits the embeddings completed by an indexing run in a
+// single transaction, then reports an InterruptedError if the run was
+// cancelled before all chunks were embedded.
+func (s *SemanticSearcher) saveIndexed(ctx context.Context, chunks []Chunk, embeddings [][]float32, skipped, total int, interrupted bool) error {
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "\n[codetect-index] skipped %d chunks that failed to embed\n", skipped)
 	}
 
 	// Save all successful embeddings with provider ID
-	if len(successfulChunks) > 0 {
-		if err := s.store.SaveBatch(successfulChunks, successfulEmbeddings, providerID); err != nil {
+	if len(chunks) > 0 {
+		if err := s.store.SaveBatch(chunks, embeddings, s.embedder.ProviderID()); err != nil {
 			return fmt.Errorf("saving embeddings: %w", err)
 		}
 	}
 
+	if interrupted && len(chunks)+skipped < total {
+		return &InterruptedError{
+			Saved:   len(chunks),
+			Skipped: skipped,
+			Total:   total,
+			Err:     ctx.Err(),
+		}
+	}
+
 	return nil
 }
 
@@ -425,7 +664,7 @@ func (s *SemanticSearcher) SearchAcrossRepos(ctx context.Context, query string,
 	}
 
 	// Find top-k most similar
-	topK := TopKByCosineSimilarity(queryEmbedding, vectors, limit)
+	topK := TopKBySimilarity(queryEmbedding, vectors, limit, s.metric)
 
 	// Build results
 	results := make([]CrossRepoSearchResult, 0, len(topK))
@@ -457,20 +696,42 @@ func (s *SemanticSearcher) SearchAcrossRepos(ctx context.Context, query string,
 
 // SearchWithSnippets performs semantic search and includes actual code snippets
 func (s *SemanticSearcher) SearchWithSnippets(ctx context.Context, query string, limit int, snippetFn func(path string, start, end int) string) (*SemanticSearchResult, error) {
-	result, err := s.SearchWithContext(ctx, query, limit)
+	return s.SearchWithOptions(ctx, query, SearchOptions{Limit: limit}, snippetFn)
+}
+
+// SearchWithOptions is SearchWithSnippets with full search options.
+// Ranking needs every vector and happens up front, but snippets and
+// highlights are read one result at a time, best match first. A search
+// cancelled while they are read stops without reading the rest and
+// returns the results resolved so far, marked Truncated.
+func (s *SemanticSearcher) SearchWithOptions(ctx context.Context, query string, opts SearchOptions, snippetFn func(path string, start, end int) string) (*SemanticSearchResult, error) {
+	result, queryVec, err := s.search(ctx, query, opts)
 	if err != nil {
 		return nil, err
 	}
+	highlight := opts.HighlightLines > 0 && opts.ReadLines != nil && queryVec != nil
+
+	for i := range result.Results {
+		if ctx.Err() != nil {
+			result.Results, result.Truncated = result.Results[:i], true
+			break
+		}
+		r := &result.Results[i]
 
-	if snippetFn != nil && result.Available && len(result.Results) > 0 {
-		for i := range result.Results {
-			r := &result.Results[i]
+		if snippetFn != nil {
 			r.Snippet = snippetFn(r.Path, r.StartLine, r.EndLine)
 			// Truncate long snippets
 			if len(r.Snippet) > 500 {
 				r.Snippet = r.Snippet[:500] + "..."
 			}
 		}
+
+		// A result that cannot be highlighted is still returned
+		if highlight {
+			if lines, err := opts.ReadLines(r.Path, r.StartLine, r.EndLine); err == nil {
+				r.Highlight, _ = HighlightLines(ctx, s.embedder, queryVec, lines, r.StartLine, opts.HighlightLines)
+			}
+		}
 	}
 
 	return result, nil
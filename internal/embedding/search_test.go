@@ -0,0 +1,458 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"codetect/internal/db"
+)
+
+// fixedEmbedder returns the same query vector for every input.
+type fixedEmbedder struct {
+	vector []float32
+}
+
+func (f *fixedEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	result := make([][]float32, len(texts))
+	for i := range texts {
+		result[i] = f.vector
+	}
+	return result, nil
+}
+
+func (f *fixedEmbedder) Available() bool    { return true }
+func (f *fixedEmbedder) ProviderID() string { return "fixed:test" }
+func (f *fixedEmbedder) Dimensions() int    { return len(f.vector) }
+
+// setupRankedSearcher creates a searcher over n chunks whose similarity to
+// the query decreases with their index.
+func setupRankedSearcher(t *testing.T, n int) *SemanticSearcher {
+	t.Helper()
+
+	database, err := db.Open(db.DefaultConfig(":memory:"))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	store, err := NewEmbeddingStore(database, "/project")
+	if err != nil {
+		t.Fatalf("creating store: %v", err)
+	}
+
+	for i := 0; i < n; i++ {
+		chunk := Chunk{
+			Path:      fmt.Sprintf("file%02d.go", i),
+			StartLine: 1,
+			EndLine:   10,
+			Content:   fmt.Sprintf("func f%d() {}", i),
+		}
+		vec := []float32{1, float32(i) * 0.1, 0}
+		if err := store.Save(chunk, vec, "fixed:test"); err != nil {
+			t.Fatalf("saving chunk: %v", err)
+		}
+	}
+
+	return NewSemanticSearcher(store, &fixedEmbedder{vector: []float32{1, 0, 0}})
+}
+
+func TestSearchWithSnippetsBestFirst(t *testing.T) {
+	searcher := setupRankedSearcher(t, 15)
+
+	var read []string
+	snippetFn := func(path string, start, end int) string {
+		read = append(read, path)
+		return fmt.Sprintf("%s:%d-%d", path, start, end)
+	}
+
+	result, err := searcher.SearchWithSnippets(context.Background(), "query", 12, snippetFn)
+	if err != nil {
+		t.Fatalf("SearchWithSnippets failed: %v", err)
+	}
+	if !result.Available {
+		t.Error("expected Available=true")
+	}
+	if len(result.Results) != 12 {
+		t.Fatalf("got %d results, want 12", len(result.Results))
+	}
+
+	// Snippets are read for the returned results only, best match first
+	want := make([]string, 12)
+	for i, r := range result.Results {
+		want[i] = r.Path
+		if r.Snippet != fmt.Sprintf("%s:1-10", r.Path) {
+			t.Errorf("result %d: Snippet = %q", i, r.Snippet)
+		}
+	}
+	if !reflect.DeepEqual(read, want) {
+		t.Errorf("snippets read for %v, want %v", read, want)
+	}
+	if want[0] != "file00.go" {
+		t.Errorf("best match = %s, want file00.go", want[0])
+	}
+}
+
+func TestSearchWithSnippetsCancelled(t *testing.T) {
+	searcher := setupRankedSearcher(t, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	snippetReads := 0
+	snippetFn := func(path string, start, end int) string {
+		snippetReads++
+		if snippetReads == 3 {
+			cancel()
+		}
+		return path
+	}
+
+	result, err := searcher.SearchWithSnippets(ctx, "query", 10, snippetFn)
+	if err != nil {
+		t.Fatalf("SearchWithSnippets failed: %v", err)
+	}
+	if snippetReads != 3 {
+		t.Errorf("read %d snippets, want 3 (the rest should not be read)", snippetReads)
+	}
+	if !result.Truncated || len(result.Results) != 3 {
+		t.Errorf("Truncated = %v with %d results, want the 3 resolved before cancelling", result.Truncated, len(result.Results))
+	}
+}
+
+func TestSearchWithSnippetsIncremental(t *testing.T) {
+	searcher := setupRankedSearcher(t, 8)
+	snippetFn := func(path string, start, end int) string {
+		return fmt.Sprintf("%s:%d-%d", path, start, end)
+	}
+
+	batch, err := searcher.SearchWithSnippets(context.Background(), "query", 8, snippetFn)
+	if err != nil {
+		t.Fatalf("SearchWithSnippets failed: %v", err)
+	}
+	if batch.Truncated || len(batch.Results) != 8 {
+		t.Fatalf("batch search: Truncated = %v with %d results, want all 8", batch.Truncated, len(batch.Results))
+	}
+
+	// Results are resolved one at a time, best first: cut short after any
+	// number of them, the search returns exactly that prefix of the batch
+	for n := 1; n < len(batch.Results); n++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		reads := 0
+		result, err := searcher.SearchWithSnippets(ctx, "query", 8, func(path string, start, end int) string {
+			if reads++; reads == n {
+				cancel()
+			}
+			return snippetFn(path, start, end)
+		})
+		cancel()
+		if err != nil {
+			t.Fatalf("cut after %d: SearchWithSnippets failed: %v", n, err)
+		}
+		if !result.Truncated || !reflect.DeepEqual(result.Results, batch.Results[:n]) {
+			t.Errorf("cut after %d: got %+v (truncated %v), want the first %d batch results", n, result.Results, result.Truncated, n)
+		}
+	}
+}
+
+// cancellingEmbedder cancels the indexing context after embedding a given
+// number of texts, simulating Ctrl-C part-way through a run.
+type cancellingEmbedder struct {
+	fixedEmbedder
+	mu     sync.Mutex
+	calls  int
+	after  int
+	cancel context.CancelFunc
+}
+
+func (c *cancellingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err // In-flight requests must not see the cancellation
+	}
+	c.mu.Lock()
+	c.calls++
+	if c.calls == c.after {
+		c.cancel()
+	}
+	c.mu.Unlock()
+	return c.fixedEmbedder.Embed(ctx, texts)
+}
+
+func TestIndexChunksInterrupted(t *testing.T) {
+	for _, parallelism := range []int{1, 4} {
+		t.Run(fmt.Sprintf("parallel=%d", parallelism), func(t *testing.T) {
+			database, err := db.Open(db.DefaultConfig(":memory:"))
+			if err != nil {
+				t.Fatalf("opening database: %v", err)
+			}
+			defer database.Close()
+
+			store, err := NewEmbeddingStore(database, "/project")
+			if err != nil {
+				t.Fatalf("creating store: %v", err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			embedder := &cancellingEmbedder{
+				fixedEmbedder: fixedEmbedder{vector: []float32{1, 0, 0}},
+				after:         5,
+				cancel:        cancel,
+			}
+			searcher := NewSemanticSearcher(store, embedder)
+
+			chunks := make([]Chunk, 50)
+			for i := range chunks {
+				chunks[i] = Chunk{
+					Path:      fmt.Sprintf("file%02d.go", i),
+					StartLine: 1,
+					EndLine:   10,
+					Content:   fmt.Sprintf("func f%d() {}", i),
+				}
+			}
+
+			err = searcher.IndexChunksParallel(ctx, chunks, parallelism, nil)
+
+			var interrupted *InterruptedError
+			if !errors.As(err, &interrupted) {
+				t.Fatalf("err = %v, want InterruptedError", err)
+			}
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("err does not wrap context.Canceled: %v", err)
+			}
+			if interrupted.Total != 50 {
+				t.Errorf("Total = %d, want 50", interrupted.Total)
+			}
+			if interrupted.Saved < 5 || interrupted.Saved >= 50 {
+				t.Errorf("Saved = %d, want between 5 and 49", interrupted.Saved)
+			}
+
+			// Everything reported as saved was committed
+			count, err := store.Count()
+			if err != nil {
+				t.Fatalf("Count failed: %v", err)
+			}
+			if count != interrupted.Saved {
+				t.Errorf("store has %d embeddings, interruption reported %d saved", count, interrupted.Saved)
+			}
+
+			// A follow-up run resumes with only the remaining chunks
+			embedder.after = -1
+			if err := searcher.IndexChunksParallel(context.Background(), chunks, parallelism, nil); err != nil {
+				t.Fatalf("resumed run failed: %v", err)
+			}
+			if count, _ := store.Count(); count != 50 {
+				t.Errorf("after resume store has %d embeddings, want 50", count)
+			}
+			if embedder.calls != 50 {
+				t.Errorf("embedder called %d times in total, want 50 (no re-embedding)", embedder.calls)
+			}
+		})
+	}
+}
+
+func TestSearchExcludePath(t *testing.T) {
+	searcher := setupRankedSearcher(t, 8)
+	ctx := context.Background()
+
+	// The current file holds the best matches
+	for i, start := range []int{20, 40, 60} {
+		chunk := Chunk{Path: "file00.go", StartLine: start, EndLine: start + 10, Content: fmt.Sprintf("func g%d() {}", i)}
+		if err := searcher.Store().Save(chunk, []float32{1, 0, 0}, searcher.ProviderID()); err != nil {
+			t.Fatalf("saving chunk: %v", err)
+		}
+	}
+
+	for _, exclude := range []string{"file00.go", "./file00.go", "/project/file00.go"} {
+		result, err := searcher.SearchWithOptions(ctx, "query", SearchOptions{Limit: 5, ExcludePath: exclude}, nil)
+		if err != nil {
+			t.Fatalf("SearchWithOptions(%q) failed: %v", exclude, err)
+		}
+		if len(result.Results) != 5 {
+			t.Errorf("exclude %q: got %d results, want 5 from other files", exclude, len(result.Results))
+		}
+		for _, r := range result.Results {
+			if r.Path == "file00.go" {
+				t.Errorf("exclude %q: excluded file returned at lines %d-%d", exclude, r.StartLine, r.EndLine)
+			}
+		}
+	}
+
+	// Without exclusion the current file dominates
+	result, err := searcher.SearchWithOptions(ctx, "query", SearchOptions{Limit: 5}, nil)
+	if err != nil {
+		t.Fatalf("SearchWithOptions failed: %v", err)
+	}
+	if len(result.Results) == 0 || result.Results[0].Path != "file00.go" {
+		t.Errorf("expected file00.go to rank first without exclusion, got %+v", result.Results)
+	}
+}
+
+func TestSearchRefusesOtherModel(t *testing.T) {
+	searcher := setupRankedSearcher(t, 3)
+	ctx := context.Background()
+
+	// Indexed with fixed:test, queried with another provider
+	other := NewSemanticSearcher(searcher.Store(), &stubEmbedder{model: "other", dimensions: 3, available: true})
+	_, err := other.Search("query", 5)
+	var mismatch *ModelMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Search with another model = %v, want *ModelMismatchError", err)
+	}
+	if mismatch.IndexModel != "fixed:test" || mismatch.QueryModel != "stub:other" {
+		t.Errorf("mismatch = %+v, want index fixed:test and query stub:other", mismatch)
+	}
+
+	// Vectors of other dimensions are refused too
+	wide := NewSemanticSearcher(searcher.Store(), &fixedEmbedder{vector: []float32{1, 0, 0, 0}})
+	if _, err := wide.SearchWithContext(ctx, "query", 5); !errors.As(err, &mismatch) {
+		t.Errorf("Search with 4-dimension queries = %v, want *ModelMismatchError", err)
+	}
+
+	if _, err := searcher.SearchWithContext(ctx, "query", 5); err != nil {
+		t.Errorf("Search with the indexed model failed: %v", err)
+	}
+}
+
+func TestSearchDedupByContent(t *testing.T) {
+	database, err := db.Open(db.DefaultConfig(":memory:"))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	store, err := NewEmbeddingStore(database, "/project")
+	if err != nil {
+		t.Fatalf("creating store: %v", err)
+	}
+
+	// vendor/a.go copies a.go; b.go ranks below both
+	chunks := []struct {
+		path, content string
+		vec           []float32
+	}{
+		{"a.go", "func A() {}", []float32{1, 0, 0}},
+		{"vendor/a.go", "func A() {}", []float32{1, 0, 0}},
+		{"b.go", "func B() {}", []float32{1, 0.5, 0}},
+	}
+	for _, c := range chunks {
+		if err := store.Save(Chunk{Path: c.path, StartLine: 1, EndLine: 3, Content: c.content}, c.vec, "fixed:test"); err != nil {
+			t.Fatalf("saving chunk: %v", err)
+		}
+	}
+	searcher := NewSemanticSearcher(store, &fixedEmbedder{vector: []float32{1, 0, 0}})
+
+	result, err := searcher.SearchWithOptions(context.Background(), "query", SearchOptions{Limit: 2, DedupByContent: true}, nil)
+	if err != nil {
+		t.Fatalf("SearchWithOptions failed: %v", err)
+	}
+	if len(result.Results) != 2 || result.Results[1].Path != "b.go" {
+		t.Fatalf("results = %+v, want the copy collapsed and b.go second", result.Results)
+	}
+	first := result.Results[0]
+	if len(first.AlsoAt) != 1 || first.AlsoAt[0].Path == first.Path {
+		t.Errorf("first result %s also at %+v, want the other copy", first.Path, first.AlsoAt)
+	}
+}
+
+func TestSemanticSearcherMetric(t *testing.T) {
+	database, err := db.Open(db.DefaultConfig(":memory:"))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	store, err := NewEmbeddingStore(database, "/project")
+	if err != nil {
+		t.Fatalf("creating store: %v", err)
+	}
+
+	// Cosine prefers the pure match, dot product the longer vector
+	chunks := []struct {
+		path string
+		vec  []float32
+	}{
+		{"pure.go", []float32{1, 0, 0}},
+		{"long.go", []float32{3, 2, 0}},
+	}
+	for _, c := range chunks {
+		if err := store.Save(Chunk{Path: c.path, StartLine: 1, EndLine: 2, Content: c.path}, c.vec, "fixed:test"); err != nil {
+			t.Fatalf("saving chunk: %v", err)
+		}
+	}
+
+	searcher := NewSemanticSearcher(store, &fixedEmbedder{vector: []float32{1, 0, 0}})
+	ctx := context.Background()
+	for metric, want := range map[Metric]string{MetricCosine: "pure.go", MetricDotProduct: "long.go"} {
+		searcher.SetMetric(metric)
+		result, err := searcher.SearchWithContext(ctx, "alpha", 2)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(result.Results) == 0 || result.Results[0].Path != want {
+			t.Errorf("%s: top result = %+v, want %s", metric, result.Results, want)
+		}
+
+		across, err := searcher.SearchAcrossRepos(ctx, "alpha", 2, nil)
+		if err != nil {
+			t.Fatalf("SearchAcrossRepos failed: %v", err)
+		}
+		if len(across.Results) == 0 || across.Results[0].Path != want {
+			t.Errorf("%s: top cross-repo result = %+v, want %s", metric, across.Results, want)
+		}
+	}
+}
+
+func TestSemanticSearcherResultCache(t *testing.T) {
+	searcher := setupRankedSearcher(t, 3)
+	cache := NewResultCache(8, time.Minute)
+	searcher.SetResultCache(cache)
+	ctx := context.Background()
+
+	snippet := "old"
+	snippetFn := func(path string, start, end int) string { return snippet }
+	search := func() *SemanticSearchResult {
+		t.Helper()
+		result, err := searcher.SearchWithOptions(ctx, "query", SearchOptions{Limit: 2}, snippetFn)
+		if err != nil {
+			t.Fatalf("SearchWithOptions failed: %v", err)
+		}
+		return result
+	}
+
+	first := search()
+
+	// The ranking is reused, but snippets reflect the files as they are now
+	snippet = "new"
+	second := search()
+	if stats := cache.Stats(); stats.Hits != 1 {
+		t.Errorf("Stats = %+v, want 1 hit", stats)
+	}
+	if len(second.Results) != len(first.Results) || second.Results[0].Path != first.Results[0].Path {
+		t.Errorf("cached results = %+v, want %+v", second.Results, first.Results)
+	}
+	if second.Results[0].Snippet != "new" {
+		t.Errorf("cached result snippet = %q, want it read again", second.Results[0].Snippet)
+	}
+
+	// Other options rank afresh
+	if _, err := searcher.SearchWithOptions(ctx, "query", SearchOptions{Limit: 2, ExcludePath: "file00.go"}, snippetFn); err != nil {
+		t.Fatalf("SearchWithOptions failed: %v", err)
+	}
+	if stats := cache.Stats(); stats.Hits != 1 {
+		t.Errorf("Stats after excluding a path = %+v, want still 1 hit", stats)
+	}
+
+	// Re-indexing invalidates the ranking
+	added := Chunk{Path: "added.go", StartLine: 1, EndLine: 10, Content: "func added() {}"}
+	if err := searcher.Store().Save(added, []float32{1, 0.05, 0}, "fixed:test"); err != nil {
+		t.Fatalf("saving chunk: %v", err)
+	}
+	if got := search(); len(got.Results) != 2 || got.Results[1].Path != "added.go" {
+		t.Errorf("results after re-indexing = %+v, want added.go second", got.Results)
+	}
+	if stats := cache.Stats(); stats.Hits != 1 {
+		t.Errorf("Stats after re-indexing = %+v, want still 1 hit", stats)
+	}
+}
@@ -0,0 +1,281 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ShardRouter returns the repository roots each of hashes is indexed
+// under. A content hash shared by several repositories belongs to the
+// shard of each; hashes with no repository may be left out of the map.
+type ShardRouter func(ctx context.Context, hashes []string) (map[string][]string, error)
+
+// LocationShardRouter routes content hashes to the repositories whose
+// locations hold them. Hashes must have locations when they are inserted,
+// so save locations before inserting vectors, or insert with
+// ShardedVectorIndex.InsertForRepo.
+func LocationShardRouter(locations *LocationStore) ShardRouter {
+	return func(ctx context.Context, hashes []string) (map[string][]string, error) {
+		routes := make(map[string][]string, len(hashes))
+		for _, hash := range hashes {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			locs, err := locations.GetByHash(hash)
+			if err != nil {
+				return nil, err
+			}
+			for _, loc := range locs {
+				if repos := routes[hash]; len(repos) == 0 || repos[len(repos)-1] != loc.RepoRoot {
+					routes[hash] = append(repos, loc.RepoRoot) // Ordered by repo root
+				}
+			}
+		}
+		return routes, nil
+	}
+}
+
+// ShardedVectorIndex splits vectors across one VectorIndex per repository,
+// for shared indexes too large to search as one. Searches filtered by
+// repository only search those repositories' shards; unfiltered searches
+// query every shard in parallel and merge the results. Shards are created
+// on first insert by the newShard function, so each can be a brute-force,
+// threshold or native index as suits its size.
+type ShardedVectorIndex struct {
+	mu       sync.RWMutex
+	shards   map[string]VectorIndex // By repository root
+	route    ShardRouter
+	newShard func(repoRoot string) (VectorIndex, error)
+}
+
+// NewShardedVectorIndex creates an empty index that places vectors with
+// route and creates each repository's shard with newShard.
+func NewShardedVectorIndex(route ShardRouter, newShard func(repoRoot string) (VectorIndex, error)) *ShardedVectorIndex {
+	return &ShardedVectorIndex{
+		shards:   make(map[string]VectorIndex),
+		route:    route,
+		newShard: newShard,
+	}
+}
+
+// Shards returns the repository roots that have a shard, sorted.
+func (s *ShardedVectorIndex) Shards() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	roots := make([]string, 0, len(s.shards))
+	for root := range s.shards {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+	return roots
+}
+
+// Shard returns the shard of repoRoot, or nil if it has none.
+func (s *ShardedVectorIndex) Shard(repoRoot string) VectorIndex {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.shards[repoRoot]
+}
+
+// shardFor returns the shard of repoRoot, creating it if needed.
+func (s *ShardedVectorIndex) shardFor(repoRoot string) (VectorIndex, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if shard, ok := s.shards[repoRoot]; ok {
+		return shard, nil
+	}
+	shard, err := s.newShard(repoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("creating shard for %s: %w", repoRoot, err)
+	}
+	s.shards[repoRoot] = shard
+	return shard, nil
+}
+
+// all returns every shard.
+func (s *ShardedVectorIndex) all() []VectorIndex {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	shards := make([]VectorIndex, 0, len(s.shards))
+	for _, shard := range s.shards {
+		shards = append(shards, shard)
+	}
+	return shards
+}
+
+// InsertForRepo adds embeddings to the shard of repoRoot, without routing.
+func (s *ShardedVectorIndex) InsertForRepo(ctx context.Context, repoRoot string, entries map[string][]float32) error {
+	shard, err := s.shardFor(repoRoot)
+	if err != nil {
+		return err
+	}
+	return shard.InsertBatch(ctx, entries)
+}
+
+// Insert adds an embedding to the shards of the repositories it is routed
+// to.
+func (s *ShardedVectorIndex) Insert(ctx context.Context, contentHash string, embedding []float32) error {
+	return s.InsertBatch(ctx, map[string][]float32{contentHash: embedding})
+}
+
+// InsertBatch adds embeddings to the shards of the repositories they are
+// routed to. Embeddings the router places in no repository are not
+// inserted, and an error reports how many.
+func (s *ShardedVectorIndex) InsertBatch(ctx context.Context, entries map[string][]float32) error {
+	hashes := make([]string, 0, len(entries))
+	for hash := range entries {
+		hashes = append(hashes, hash)
+	}
+	routes, err := s.route(ctx, hashes)
+	if err != nil {
+		return fmt.Errorf("routing vectors: %w", err)
+	}
+
+	byRepo := make(map[string]map[string][]float32)
+	unrouted := 0
+	for _, hash := range hashes {
+		repos := routes[hash]
+		if len(repos) == 0 {
+			unrouted++
+			continue
+		}
+		for _, repo := range repos {
+			if byRepo[repo] == nil {
+				byRepo[repo] = make(map[string][]float32)
+			}
+			byRepo[repo][hash] = entries[hash]
+		}
+	}
+	for repo, batch := range byRepo {
+		if err := s.InsertForRepo(ctx, repo, batch); err != nil {
+			return err
+		}
+	}
+	if unrouted > 0 {
+		return fmt.Errorf("%d of %d vectors belong to no repository", unrouted, len(entries))
+	}
+	return nil
+}
+
+// Search finds k nearest neighbors across every shard.
+func (s *ShardedVectorIndex) Search(ctx context.Context, query []float32, k int) ([]VectorResult, error) {
+	return s.SearchWithFilter(ctx, query, k, nil)
+}
+
+// SearchWithFilter finds k nearest neighbors in the shards of repoRoots,
+// or in every shard if repoRoots is empty. Repositories without a shard
+// have no vectors and are skipped. Shards are searched in parallel and a
+// hash found in several is returned once.
+func (s *ShardedVectorIndex) SearchWithFilter(ctx context.Context, query []float32, k int, repoRoots []string) ([]VectorResult, error) {
+	var shards []VectorIndex
+	if len(repoRoots) == 0 {
+		shards = s.all()
+	} else {
+		for _, root := range repoRoots {
+			if shard := s.Shard(root); shard != nil {
+				shards = append(shards, shard)
+			}
+		}
+	}
+	if len(shards) == 1 {
+		return shards[0].Search(ctx, query, k)
+	}
+
+	results := make([][]VectorResult, len(shards))
+	errs := make([]error, len(shards))
+	var wg sync.WaitGroup
+	for i, shard := range shards {
+		wg.Add(1)
+		go func(i int, shard VectorIndex) {
+			defer wg.Done()
+			results[i], errs[i] = shard.Search(ctx, query, k)
+		}(i, shard)
+	}
+	wg.Wait()
+
+	best := make(map[string]VectorResult)
+	for i := range shards {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		for _, r := range results[i] {
+			if prev, ok := best[r.ContentHash]; !ok || r.Distance < prev.Distance {
+				best[r.ContentHash] = r
+			}
+		}
+	}
+	merged := make([]VectorResult, 0, len(best))
+	for _, r := range best {
+		merged = append(merged, r)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].Distance != merged[j].Distance {
+			return merged[i].Distance < merged[j].Distance
+		}
+		return merged[i].ContentHash < merged[j].ContentHash
+	})
+	if len(merged) > k {
+		merged = merged[:k]
+	}
+	return merged, nil
+}
+
+// Delete removes an embedding from every shard.
+func (s *ShardedVectorIndex) Delete(ctx context.Context, contentHash string) error {
+	return s.DeleteBatch(ctx, []string{contentHash})
+}
+
+// DeleteBatch removes embeddings from every shard.
+func (s *ShardedVectorIndex) DeleteBatch(ctx context.Context, contentHashes []string) error {
+	for _, shard := range s.all() {
+		if err := shard.DeleteBatch(ctx, contentHashes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteRepo drops the shard of repoRoot, for a repository removed from
+// the index, so it is no longer searched.
+func (s *ShardedVectorIndex) DeleteRepo(repoRoot string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.shards, repoRoot)
+}
+
+// Rebuild rebuilds every shard.
+func (s *ShardedVectorIndex) Rebuild(ctx context.Context) error {
+	for _, shard := range s.all() {
+		if err := shard.Rebuild(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsNative reports whether there are shards and all of them are native.
+func (s *ShardedVectorIndex) IsNative() bool {
+	shards := s.all()
+	for _, shard := range shards {
+		if !shard.IsNative() {
+			return false
+		}
+	}
+	return len(shards) > 0
+}
+
+// Count returns the number of vectors across shards. A vector in several
+// shards is counted once per shard.
+func (s *ShardedVectorIndex) Count(ctx context.Context) (int, error) {
+	total := 0
+	for _, shard := range s.all() {
+		n, err := shard.Count(ctx)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
@@ -0,0 +1,141 @@
+package embedding
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// countingIndex counts the searches a shard serves.
+type countingIndex struct {
+	*BruteForceVectorIndex
+	searches int
+}
+
+func (c *countingIndex) Search(ctx context.Context, query []float32, k int) ([]VectorResult, error) {
+	c.searches++
+	return c.BruteForceVectorIndex.Search(ctx, query, k)
+}
+
+func TestShardedVectorIndex(t *testing.T) {
+	ctx := context.Background()
+	routes := map[string][]string{
+		"a1":     {"/a"},
+		"a2":     {"/a"},
+		"b1":     {"/b"},
+		"b2":     {"/b"},
+		"shared": {"/a", "/b"},
+	}
+	shards := make(map[string]*countingIndex)
+	idx := NewShardedVectorIndex(
+		func(ctx context.Context, hashes []string) (map[string][]string, error) {
+			return routes, nil
+		},
+		func(repoRoot string) (VectorIndex, error) {
+			shards[repoRoot] = &countingIndex{BruteForceVectorIndex: NewBruteForceVectorIndex(nil, 2)}
+			return shards[repoRoot], nil
+		},
+	)
+
+	err := idx.InsertBatch(ctx, map[string][]float32{
+		"a1":     {1, 0},
+		"a2":     {0.6, 0.8},
+		"b1":     {0.95, 0.31},
+		"b2":     {0, 1},
+		"shared": {0.8, 0.6},
+	})
+	if err != nil {
+		t.Fatalf("InsertBatch failed: %v", err)
+	}
+	if got := strings.Join(idx.Shards(), ","); got != "/a,/b" {
+		t.Fatalf("Shards() = %s, want /a,/b", got)
+	}
+	if n, _ := idx.Count(ctx); n != 6 {
+		t.Errorf("Count() = %d, want 6 (shared counted in both shards)", n)
+	}
+
+	hashes := func(results []VectorResult) string {
+		var out []string
+		for _, r := range results {
+			out = append(out, r.ContentHash)
+		}
+		return strings.Join(out, ",")
+	}
+	query := []float32{1, 0}
+
+	// A filtered query only searches its repository's shard
+	results, err := idx.SearchWithFilter(ctx, query, 5, []string{"/a"})
+	if err != nil {
+		t.Fatalf("SearchWithFilter failed: %v", err)
+	}
+	if got := hashes(results); got != "a1,shared,a2" {
+		t.Errorf("results for /a = %s, want a1,shared,a2", got)
+	}
+	if shards["/a"].searches != 1 || shards["/b"].searches != 0 {
+		t.Errorf("searches = /a %d, /b %d; want 1, 0", shards["/a"].searches, shards["/b"].searches)
+	}
+
+	// An unfiltered query merges every shard by distance, once per hash
+	results, err = idx.Search(ctx, query, 4)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if got := hashes(results); got != "a1,b1,shared,a2" {
+		t.Errorf("merged results = %s, want a1,b1,shared,a2", got)
+	}
+	if shards["/a"].searches != 2 || shards["/b"].searches != 1 {
+		t.Errorf("searches = /a %d, /b %d; want 2, 1", shards["/a"].searches, shards["/b"].searches)
+	}
+	for i := 1; i < len(results); i++ {
+		if results[i].Distance < results[i-1].Distance {
+			t.Errorf("results not ordered by distance: %+v", results)
+		}
+	}
+
+	// Repositories without a shard have no results
+	results, err = idx.SearchWithFilter(ctx, query, 5, []string{"/c"})
+	if err != nil || len(results) != 0 {
+		t.Errorf("SearchWithFilter(/c) = %v, %v; want none", results, err)
+	}
+
+	// Deletes reach every shard holding the hash
+	if err := idx.Delete(ctx, "shared"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	results, _ = idx.Search(ctx, query, 10)
+	if got := hashes(results); strings.Contains(got, "shared") {
+		t.Errorf("results after delete = %s, still has shared", got)
+	}
+
+	// Vectors routed nowhere are reported
+	if err := idx.Insert(ctx, "orphan", []float32{1, 1}); err == nil {
+		t.Error("Insert of an unrouted vector succeeded")
+	}
+}
+
+func TestLocationShardRouter(t *testing.T) {
+	store := setupTestLocationStore(t)
+	err := store.SaveLocationsBatch([]ChunkLocation{
+		{RepoRoot: "/b", Path: "x.go", StartLine: 1, EndLine: 5, ContentHash: "h1"},
+		{RepoRoot: "/a", Path: "x.go", StartLine: 1, EndLine: 5, ContentHash: "h1"},
+		{RepoRoot: "/a", Path: "y.go", StartLine: 1, EndLine: 5, ContentHash: "h1"},
+		{RepoRoot: "/a", Path: "z.go", StartLine: 1, EndLine: 5, ContentHash: "h2"},
+	})
+	if err != nil {
+		t.Fatalf("SaveLocationsBatch failed: %v", err)
+	}
+
+	routes, err := LocationShardRouter(store)(context.Background(), []string{"h1", "h2", "h3"})
+	if err != nil {
+		t.Fatalf("routing failed: %v", err)
+	}
+	if got := strings.Join(routes["h1"], ","); got != "/a,/b" {
+		t.Errorf("h1 routed to %s, want /a,/b", got)
+	}
+	if got := strings.Join(routes["h2"], ","); got != "/a" {
+		t.Errorf("h2 routed to %s, want /a", got)
+	}
+	if len(routes["h3"]) != 0 {
+		t.Errorf("h3 routed to %v, want nowhere", routes["h3"])
+	}
+}
@@ -0,0 +1,259 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// DefaultSimilarThreshold is the similarity above which FindSimilar
+// considers two functions near-duplicates when none is given.
+const DefaultSimilarThreshold = 0.95
+
+// functionNodeTypes are the node types of function and method chunks: the
+// AST node types across the chunker's languages, and the symbol chunker's
+// kinds.
+var functionNodeTypes = []string{
+	"function", "function_declaration", "function_definition", "function_item",
+	"method_declaration", "method_definition", "constructor_declaration",
+	"arrow_function", "method", "singleton_method",
+}
+
+// IsFunctionNodeType reports whether chunks of the AST node type nodeType
+// are functions or methods.
+func IsFunctionNodeType(nodeType string) bool {
+	return slices.Contains(functionNodeTypes, nodeType)
+}
+
+// SimilarOptions configures FindSimilar.
+type SimilarOptions struct {
+	RepoRoot  string  // Repository to search (required)
+	Threshold float32 // Minimum similarity linking two functions (default: DefaultSimilarThreshold)
+	Limit     int     // Maximum groups, largest first (default: 20)
+
+	// Metadata restricts the functions compared to locations whose
+	// metadata has every key-value pair given
+	Metadata map[string]string
+
+	// Model selects the vectors compared, as CacheSearchOptions.Model does
+	Model string
+
+	// MinScore is a floor on Threshold, for a configured minimum that a
+	// caller's threshold cannot go below
+	MinScore float32
+
+	// Neighbors caps the near-duplicates each function is linked to, its
+	// closest ones (default: 10)
+	Neighbors int
+
+	// MaxCandidates caps the distinct functions compared (default: 5000).
+	// Larger selections are refused rather than compared partially; narrow
+	// them with Metadata
+	MaxCandidates int
+}
+
+// TooManyCandidatesError is returned by FindSimilar when more distinct
+// functions match than SimilarOptions.MaxCandidates allows.
+type TooManyCandidatesError struct {
+	Candidates, Max int
+}
+
+func (e *TooManyCandidatesError) Error() string {
+	return fmt.Sprintf("%d functions to compare, more than the maximum of %d; narrow them with metadata", e.Candidates, e.Max)
+}
+
+// SimilarGroup is a set of near-duplicate functions: each is at least
+// Threshold similar to another in the group, and the group holds at least
+// two different contents. Exact copies of a member are included.
+type SimilarGroup struct {
+	Functions     []ChunkLocation `json:"functions"`
+	MinSimilarity float32         `json:"min_similarity"` // Weakest link joining the group
+	MaxSimilarity float32         `json:"max_similarity"` // Closest pair of different contents
+}
+
+// FindSimilar groups the repository's functions whose stored vectors are
+// at least opts.Threshold similar, as refactoring candidates. Groups are
+// linked transitively, so A and C share a group when both are close to B.
+// Functions with identical content share a vector and are never a group
+// on their own; only groups of differing contents are returned. Each
+// function is linked to its opts.Neighbors nearest neighbours above the
+// threshold, found by one nearest-neighbour query per function; the
+// queries scan the candidates, so opts.MaxCandidates bounds the cost.
+func (s *CacheSearcher) FindSimilar(ctx context.Context, opts SimilarOptions) ([]SimilarGroup, error) {
+	if opts.Threshold <= 0 {
+		opts.Threshold = DefaultSimilarThreshold
+	}
+	opts.Threshold = max(opts.Threshold, opts.MinScore)
+	if opts.Limit <= 0 {
+		opts.Limit = 20
+	}
+	if opts.Neighbors <= 0 {
+		opts.Neighbors = 10
+	}
+	if opts.MaxCandidates <= 0 {
+		opts.MaxCandidates = 5000
+	}
+
+	space, err := s.space(opts.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	locs, err := s.locations.GetByMetadata(opts.RepoRoot, opts.Metadata)
+	if err != nil {
+		return nil, fmt.Errorf("getting locations: %w", err)
+	}
+	byHash := make(map[string][]ChunkLocation)
+	for _, loc := range locs {
+		if IsFunctionNodeType(loc.NodeType) {
+			byHash[loc.ContentHash] = append(byHash[loc.ContentHash], loc)
+		}
+	}
+
+	if len(byHash) > opts.MaxCandidates {
+		return nil, &TooManyCandidatesError{Candidates: len(byHash), Max: opts.MaxCandidates}
+	}
+
+	// Vectors of distinct contents, in a stable order
+	hashes := make([]string, 0, len(byHash))
+	for hash := range byHash {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	vectors := make(map[string][]float32, len(hashes))
+	for i := 0; i < len(hashes); i += hasEntryBatchSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		batch := hashes[i:min(i+hasEntryBatchSize, len(hashes))]
+		keys := make([]string, len(batch))
+		keyHashes := make(map[string]string, len(batch))
+		for j, hash := range batch {
+			keys[j] = space.key(hash)
+			keyHashes[keys[j]] = hash
+		}
+		entries, err := space.cache.GetBatch(keys)
+		if err != nil {
+			return nil, fmt.Errorf("loading embeddings: %w", err)
+		}
+		for key, entry := range entries {
+			vectors[keyHashes[key]] = entry.Embedding
+		}
+	}
+	embedded := hashes[:0]
+	candidates := make([][]float32, 0, len(hashes))
+	for _, hash := range hashes {
+		if vectors[hash] != nil {
+			embedded = append(embedded, hash)
+			candidates = append(candidates, vectors[hash])
+		}
+	}
+	hashes = embedded
+
+	// Link each function to its nearest neighbours above the threshold,
+	// tracking each cluster's weakest and strongest link
+	parent := make([]int, len(hashes))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	type linkRange struct{ weakest, closest float32 }
+	links := make(map[int]linkRange)
+	for i := range hashes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for _, n := range s.nearest(candidates, i, opts.Neighbors, opts.Threshold) {
+			ri, rj := find(i), find(n.index)
+			merged := linkRange{n.score, n.score}
+			for _, r := range []int{ri, rj} {
+				if l, ok := links[r]; ok {
+					if l.weakest < merged.weakest {
+						merged.weakest = l.weakest
+					}
+					if l.closest > merged.closest {
+						merged.closest = l.closest
+					}
+				}
+			}
+			delete(links, ri)
+			delete(links, rj)
+			parent[rj] = ri
+			links[ri] = merged
+		}
+	}
+
+	members := make(map[int][]ChunkLocation)
+	for i, hash := range hashes {
+		root := find(i)
+		if _, linked := links[root]; linked {
+			members[root] = append(members[root], byHash[hash]...)
+		}
+	}
+	groups := make([]SimilarGroup, 0, len(members))
+	for root, functions := range members {
+		sort.Slice(functions, func(i, j int) bool {
+			if functions[i].Path != functions[j].Path {
+				return functions[i].Path < functions[j].Path
+			}
+			return functions[i].StartLine < functions[j].StartLine
+		})
+		groups = append(groups, SimilarGroup{
+			Functions:     functions,
+			MinSimilarity: links[root].weakest,
+			MaxSimilarity: links[root].closest,
+		})
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		if len(a.Functions) != len(b.Functions) {
+			return len(a.Functions) > len(b.Functions)
+		}
+		if a.MaxSimilarity != b.MaxSimilarity {
+			return a.MaxSimilarity > b.MaxSimilarity
+		}
+		return a.Functions[0].Path < b.Functions[0].Path
+	})
+	if len(groups) > opts.Limit {
+		groups = groups[:opts.Limit]
+	}
+	return groups, nil
+}
+
+// neighbor is a candidate found by nearest, with its similarity.
+type neighbor struct {
+	index int
+	score float32
+}
+
+// nearest returns up to k of vectors at least threshold similar to
+// vectors[i], closest first.
+func (s *CacheSearcher) nearest(vectors [][]float32, i, k int, threshold float32) []neighbor {
+	var found []neighbor
+	for j, v := range vectors {
+		if j == i {
+			continue
+		}
+		if score := s.metric.Similarity(vectors[i], v); score >= threshold {
+			found = append(found, neighbor{j, score})
+		}
+	}
+	sort.Slice(found, func(a, b int) bool {
+		if found[a].score != found[b].score {
+			return found[a].score > found[b].score
+		}
+		return found[a].index < found[b].index
+	})
+	if len(found) > k {
+		found = found[:k]
+	}
+	return found
+}
@@ -0,0 +1,155 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFindSimilar(t *testing.T) {
+	pipeline, embedder := setupFilePipeline(t)
+	ctx := context.Background()
+
+	// Total and Sum differ only in variable names, which the keyword
+	// embedder ignores; Copy is an exact copy of Total
+	chunks := []Chunk{
+		{Path: "a.go", StartLine: 1, EndLine: 5, Kind: "function_declaration", Content: "func Total(xs) { alpha alpha beta }"},
+		{Path: "b.go", StartLine: 1, EndLine: 5, Kind: "function_declaration", Content: "func Sum(values) { alpha alpha beta }"},
+		{Path: "c.go", StartLine: 1, EndLine: 5, Kind: "function_declaration", Content: "func Total(xs) { alpha alpha beta }"},
+		{Path: "d.go", StartLine: 1, EndLine: 5, Kind: "function_declaration", Content: "func Fetch() { beta beta beta }"},
+		{Path: "e.go", StartLine: 1, EndLine: 5, Kind: "type_declaration", Content: "type Totals { alpha alpha beta }"},
+	}
+	if _, err := pipeline.EmbedChunks(ctx, "/project", chunks); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	searcher := NewCacheSearcher(pipeline.Cache(), pipeline.Locations(), embedder)
+
+	groups, err := searcher.FindSimilar(ctx, SimilarOptions{RepoRoot: "/project"})
+	if err != nil {
+		t.Fatalf("FindSimilar failed: %v", err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("got %d groups, want 1: %+v", len(groups), groups)
+	}
+	var paths []string
+	for _, fn := range groups[0].Functions {
+		paths = append(paths, fn.Path)
+	}
+	if len(paths) != 3 || paths[0] != "a.go" || paths[1] != "b.go" || paths[2] != "c.go" {
+		t.Errorf("group functions = %v, want [a.go b.go c.go]", paths)
+	}
+	if g := groups[0]; g.MinSimilarity < DefaultSimilarThreshold || g.MaxSimilarity < g.MinSimilarity {
+		t.Errorf("group similarity range = [%v, %v]", g.MinSimilarity, g.MaxSimilarity)
+	}
+
+	// Too many functions are refused, not compared partially
+	_, err = searcher.FindSimilar(ctx, SimilarOptions{RepoRoot: "/project", MaxCandidates: 2})
+	var tooMany *TooManyCandidatesError
+	if !errors.As(err, &tooMany) || tooMany.Candidates != 3 {
+		t.Errorf("FindSimilar() with MaxCandidates 2 error = %v, want 3 candidates refused", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := searcher.FindSimilar(cancelled, SimilarOptions{RepoRoot: "/project"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("FindSimilar() with a cancelled context error = %v, want context.Canceled", err)
+	}
+}
+
+func TestFindSimilarNeighbors(t *testing.T) {
+	pipeline, embedder := setupFilePipeline(t)
+	ctx := context.Background()
+
+	// b.go is closer to a.go than c.go is, and c.go is closer to b.go
+	// than to a.go
+	chunks := []Chunk{
+		{Path: "a.go", StartLine: 1, EndLine: 5, Kind: "function", Content: "alpha alpha alpha alpha"},
+		{Path: "b.go", StartLine: 1, EndLine: 5, Kind: "function", Content: "alpha alpha alpha beta"},
+		{Path: "c.go", StartLine: 1, EndLine: 5, Kind: "function", Content: "alpha alpha beta beta"},
+	}
+	if _, err := pipeline.EmbedChunks(ctx, "/project", chunks); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	searcher := NewCacheSearcher(pipeline.Cache(), pipeline.Locations(), embedder)
+
+	// With one neighbour each, c.go still joins through b.go
+	groups, err := searcher.FindSimilar(ctx, SimilarOptions{RepoRoot: "/project", Threshold: 0.5, Neighbors: 1})
+	if err != nil {
+		t.Fatalf("FindSimilar failed: %v", err)
+	}
+	if len(groups) != 1 || len(groups[0].Functions) != 3 {
+		t.Fatalf("groups = %+v, want one of 3 functions", groups)
+	}
+	// The a.go-c.go pair, neither's nearest neighbour, is not a link
+	all, err := searcher.FindSimilar(ctx, SimilarOptions{RepoRoot: "/project", Threshold: 0.5})
+	if err != nil {
+		t.Fatalf("FindSimilar failed: %v", err)
+	}
+	if groups[0].MinSimilarity <= all[0].MinSimilarity {
+		t.Errorf("weakest link with 1 neighbour = %v, want above %v with all links", groups[0].MinSimilarity, all[0].MinSimilarity)
+	}
+}
+
+func TestFindSimilarThreshold(t *testing.T) {
+	pipeline, embedder := setupFilePipeline(t)
+	ctx := context.Background()
+
+	chunks := []Chunk{
+		{Path: "a.go", StartLine: 1, EndLine: 5, Kind: "function", Content: "alpha alpha"},
+		{Path: "b.go", StartLine: 1, EndLine: 5, Kind: "function", Content: "alpha alpha beta"},
+		{Path: "c.go", StartLine: 1, EndLine: 5, Kind: "function", Content: "alpha alpha"},
+	}
+	if _, err := pipeline.EmbedChunks(ctx, "/project", chunks); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	searcher := NewCacheSearcher(pipeline.Cache(), pipeline.Locations(), embedder)
+
+	// a.go and b.go are about 0.89 similar
+	groups, err := searcher.FindSimilar(ctx, SimilarOptions{RepoRoot: "/project"})
+	if err != nil {
+		t.Fatalf("FindSimilar failed: %v", err)
+	}
+	if len(groups) != 0 {
+		t.Errorf("got %d groups at the default threshold, want 0 (a.go and c.go are only copies)", len(groups))
+	}
+
+	groups, err = searcher.FindSimilar(ctx, SimilarOptions{RepoRoot: "/project", Threshold: 0.8})
+	if err != nil {
+		t.Fatalf("FindSimilar failed: %v", err)
+	}
+	if len(groups) != 1 || len(groups[0].Functions) != 3 {
+		t.Errorf("groups at threshold 0.8 = %+v, want one of 3 functions", groups)
+	}
+}
+
+func TestFindSimilarMinScore(t *testing.T) {
+	pipeline, embedder := setupFilePipeline(t)
+	ctx := context.Background()
+
+	// Two functions with nothing closer than about 0.8 in common
+	chunks := []Chunk{
+		{Path: "a.go", StartLine: 1, EndLine: 5, Kind: "function", Content: "alpha alpha beta"},
+		{Path: "b.go", StartLine: 1, EndLine: 5, Kind: "function", Content: "alpha beta beta"},
+	}
+	if _, err := pipeline.EmbedChunks(ctx, "/project", chunks); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+	searcher := NewCacheSearcher(pipeline.Cache(), pipeline.Locations(), embedder)
+
+	groups, err := searcher.FindSimilar(ctx, SimilarOptions{RepoRoot: "/project", Threshold: 0.5})
+	if err != nil {
+		t.Fatalf("FindSimilar failed: %v", err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("got %d groups at threshold 0.5, want the weak pair", len(groups))
+	}
+
+	// The minimum overrides a lower threshold, leaving no relations
+	groups, err = searcher.FindSimilar(ctx, SimilarOptions{RepoRoot: "/project", Threshold: 0.5, MinScore: 0.9})
+	if err != nil {
+		t.Fatalf("FindSimilar failed: %v", err)
+	}
+	if len(groups) != 0 {
+		t.Errorf("got %+v with MinScore 0.9, want no groups", groups)
+	}
+}
@@ -599,6 +599,20 @@ func (s *EmbeddingStore) Count() (int, error) {
 	return count, err
 }
 
+// Version identifies the current contents of this repo's embeddings. It
+// changes whenever embeddings are added, removed, or re-saved, so callers
+// holding vectors in memory can tell when to reload them.
+func (s *EmbeddingStore) Version() (string, error) {
+	tableName := s.tableName()
+	query := s.schema.SubstitutePlaceholders(fmt.Sprintf(
+		"SELECT COUNT(*), COALESCE(MAX(id), 0), COALESCE(MAX(created_at), 0) FROM %s WHERE repo_root = ?", tableName))
+	var count, maxID, latest int64
+	if err := s.db.QueryRow(query, s.repoRoot).Scan(&count, &maxID, &latest); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d:%d:%d", count, maxID, latest), nil
+}
+
 // Stats returns embedding statistics within this repo
 func (s *EmbeddingStore) Stats() (count int, fileCount int, err error) {
 	tableName := s.tableName()
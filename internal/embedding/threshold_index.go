@@ -0,0 +1,180 @@
+package embedding
+
+import (
+	"context"
+	"sync"
+)
+
+// Vector search modes, as reported by VectorIndexMode.
+const (
+	VectorModeBruteForce = "brute_force"
+	VectorModeNative     = "native"
+	VectorModePQ         = "pq"
+)
+
+// VectorIndexMode reports how idx searches: VectorModeNative for a native
+// HNSW or vec0 index, VectorModePQ for a PQVectorIndex, and
+// VectorModeBruteForce otherwise, including for a nil index.
+func VectorIndexMode(idx VectorIndex) string {
+	if _, ok := idx.(*PQVectorIndex); ok {
+		return VectorModePQ
+	}
+	if idx != nil && idx.IsNative() {
+		return VectorModeNative
+	}
+	return VectorModeBruteForce
+}
+
+// ThresholdVectorIndex searches by brute force until it holds minVectors
+// vectors, then builds the native index and uses it from then on. For small
+// repos a scan is about as fast as HNSW or vec0 and saves building and
+// maintaining them.
+type ThresholdVectorIndex struct {
+	mu         sync.RWMutex
+	bruteForce *BruteForceVectorIndex
+	native     VectorIndex // Set once promoted
+	newNative  func() (VectorIndex, error)
+	minVectors int
+	failed     bool // The native index turned out unavailable
+}
+
+// NewThresholdVectorIndex creates an index that uses bruteForce until it
+// holds minVectors vectors and then the index returned by newNative. If
+// newNative fails or returns an index that is not native, brute force is
+// kept.
+func NewThresholdVectorIndex(bruteForce *BruteForceVectorIndex, minVectors int, newNative func() (VectorIndex, error)) *ThresholdVectorIndex {
+	return &ThresholdVectorIndex{
+		bruteForce: bruteForce,
+		newNative:  newNative,
+		minVectors: minVectors,
+	}
+}
+
+// active returns the index currently serving requests.
+func (t *ThresholdVectorIndex) active() VectorIndex {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.native != nil {
+		return t.native
+	}
+	return t.bruteForce
+}
+
+// MaybePromote switches to the native index if the vector count has
+// reached the threshold. It is called after every insertion; call it
+// directly to promote an index over a store that is already large.
+func (t *ThresholdVectorIndex) MaybePromote(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.native != nil || t.failed {
+		return nil
+	}
+
+	count, err := t.vectorCount(ctx)
+	if err != nil {
+		return err
+	}
+	if count < t.minVectors {
+		return nil
+	}
+
+	native, err := t.newNative()
+	if err != nil || !native.IsNative() {
+		t.failed = true
+		return nil
+	}
+
+	// Vectors inserted directly rather than through the store
+	t.bruteForce.mu.RLock()
+	pending := make(map[string][]float32, len(t.bruteForce.vectors))
+	for hash, vec := range t.bruteForce.vectors {
+		pending[hash] = vec
+	}
+	t.bruteForce.mu.RUnlock()
+	if err := native.InsertBatch(ctx, pending); err != nil {
+		return err
+	}
+	if syncer, ok := native.(interface{ Sync(context.Context) error }); ok {
+		if err := syncer.Sync(ctx); err != nil {
+			return err
+		}
+	}
+
+	t.native = native
+	t.bruteForce.mu.Lock()
+	t.bruteForce.vectors = make(map[string][]float32) // No longer searched
+	t.bruteForce.mu.Unlock()
+	return nil
+}
+
+// vectorCount returns the number of vectors the index covers: those in
+// the backing store, or those inserted directly if there are more.
+func (t *ThresholdVectorIndex) vectorCount(ctx context.Context) (int, error) {
+	count, err := t.bruteForce.Count(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if t.bruteForce.store != nil {
+		stored, err := t.bruteForce.store.Count()
+		if err != nil {
+			return 0, err
+		}
+		count = max(count, stored)
+	}
+	return count, nil
+}
+
+// Insert adds an embedding to the active index.
+func (t *ThresholdVectorIndex) Insert(ctx context.Context, contentHash string, embedding []float32) error {
+	if err := t.active().Insert(ctx, contentHash, embedding); err != nil {
+		return err
+	}
+	return t.MaybePromote(ctx)
+}
+
+// InsertBatch adds multiple embeddings to the active index.
+func (t *ThresholdVectorIndex) InsertBatch(ctx context.Context, entries map[string][]float32) error {
+	if err := t.active().InsertBatch(ctx, entries); err != nil {
+		return err
+	}
+	return t.MaybePromote(ctx)
+}
+
+// Search finds k nearest neighbors with the active index.
+func (t *ThresholdVectorIndex) Search(ctx context.Context, query []float32, k int) ([]VectorResult, error) {
+	return t.active().Search(ctx, query, k)
+}
+
+// SearchWithFilter finds k nearest neighbors filtered by repository.
+func (t *ThresholdVectorIndex) SearchWithFilter(ctx context.Context, query []float32, k int, repoRoots []string) ([]VectorResult, error) {
+	return t.active().SearchWithFilter(ctx, query, k, repoRoots)
+}
+
+// Delete removes an embedding from the active index.
+func (t *ThresholdVectorIndex) Delete(ctx context.Context, contentHash string) error {
+	return t.active().Delete(ctx, contentHash)
+}
+
+// DeleteBatch removes multiple embeddings from the active index.
+func (t *ThresholdVectorIndex) DeleteBatch(ctx context.Context, contentHashes []string) error {
+	return t.active().DeleteBatch(ctx, contentHashes)
+}
+
+// Rebuild rebuilds the active index, promoting it if the reloaded vectors
+// reach the threshold.
+func (t *ThresholdVectorIndex) Rebuild(ctx context.Context) error {
+	if err := t.active().Rebuild(ctx); err != nil {
+		return err
+	}
+	return t.MaybePromote(ctx)
+}
+
+// IsNative reports whether the index has been promoted to a native index.
+func (t *ThresholdVectorIndex) IsNative() bool {
+	return t.active().IsNative()
+}
+
+// Count returns the number of vectors in the active index.
+func (t *ThresholdVectorIndex) Count(ctx context.Context) (int, error) {
+	return t.active().Count(ctx)
+}
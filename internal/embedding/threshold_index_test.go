@@ -0,0 +1,115 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"codetect/internal/config"
+	"codetect/internal/db"
+)
+
+// fakeNativeIndex stands in for HNSW or vec0, which need PostgreSQL or the
+// CGO sqlite driver.
+type fakeNativeIndex struct {
+	*BruteForceVectorIndex
+	syncs int
+}
+
+func (f *fakeNativeIndex) IsNative() bool { return true }
+
+func (f *fakeNativeIndex) Sync(ctx context.Context) error {
+	f.syncs++
+	return nil
+}
+
+func TestThresholdVectorIndex(t *testing.T) {
+	ctx := context.Background()
+	var native *fakeNativeIndex
+	builds := 0
+	idx := NewThresholdVectorIndex(NewBruteForceVectorIndex(nil, 2), 3, func() (VectorIndex, error) {
+		builds++
+		native = &fakeNativeIndex{BruteForceVectorIndex: NewBruteForceVectorIndex(nil, 2)}
+		return native, nil
+	})
+
+	// Below the threshold: brute force, no native index built
+	if err := idx.InsertBatch(ctx, map[string][]float32{"a": {1, 0}, "b": {0, 1}}); err != nil {
+		t.Fatalf("InsertBatch failed: %v", err)
+	}
+	if builds != 0 || idx.IsNative() || VectorIndexMode(idx) != VectorModeBruteForce {
+		t.Fatalf("below threshold: builds = %d, mode = %s, want brute force", builds, VectorIndexMode(idx))
+	}
+	results, err := idx.Search(ctx, []float32{1, 0}, 1)
+	if err != nil || len(results) != 1 || results[0].ContentHash != "a" {
+		t.Fatalf("brute-force Search = %v, %v", results, err)
+	}
+
+	// Reaching it builds the native index with every vector so far
+	if err := idx.Insert(ctx, "c", []float32{1, 1}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if builds != 1 || !idx.IsNative() || VectorIndexMode(idx) != VectorModeNative {
+		t.Fatalf("at threshold: builds = %d, mode = %s, want native", builds, VectorIndexMode(idx))
+	}
+	if n, _ := native.Count(ctx); n != 3 || native.syncs != 1 {
+		t.Errorf("native index has %d vectors after %d syncs, want 3 after 1", n, native.syncs)
+	}
+
+	// Later writes and searches go to the native index
+	if err := idx.Insert(ctx, "d", []float32{-1, 0}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if n, _ := native.Count(ctx); n != 4 || builds != 1 {
+		t.Errorf("native index has %d vectors after %d builds, want 4 after 1", n, builds)
+	}
+	results, err = idx.Search(ctx, []float32{-1, 0}, 1)
+	if err != nil || len(results) != 1 || results[0].ContentHash != "d" {
+		t.Errorf("native Search = %v, %v", results, err)
+	}
+}
+
+func TestThresholdVectorIndexNativeUnavailable(t *testing.T) {
+	ctx := context.Background()
+	builds := 0
+	idx := NewThresholdVectorIndex(NewBruteForceVectorIndex(nil, 2), 1, func() (VectorIndex, error) {
+		builds++
+		return nil, fmt.Errorf("no pgvector")
+	})
+
+	for _, hash := range []string{"a", "b"} {
+		if err := idx.Insert(ctx, hash, []float32{1, 0}); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	if builds != 1 || VectorIndexMode(idx) != VectorModeBruteForce {
+		t.Errorf("builds = %d, mode = %s, want one attempt and brute force", builds, VectorIndexMode(idx))
+	}
+	if n, _ := idx.Count(ctx); n != 2 {
+		t.Errorf("Count = %d, want 2 kept in brute force", n)
+	}
+}
+
+func TestNewVectorIndexMinVectors(t *testing.T) {
+	cfg := db.DefaultConfig(":memory:")
+	database, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	defer database.Close()
+
+	hnsw := config.DefaultHNSWConfig()
+	idx, err := NewVectorIndex(database, cfg.Dialect(), 3, nil, hnsw)
+	if err != nil {
+		t.Fatalf("NewVectorIndex failed: %v", err)
+	}
+	if _, ok := idx.(*ThresholdVectorIndex); !ok {
+		t.Fatalf("NewVectorIndex returned %T, want a threshold index below MinVectors", idx)
+	}
+	if VectorIndexMode(idx) != VectorModeBruteForce {
+		t.Errorf("mode = %s, want brute force for an empty index", VectorIndexMode(idx))
+	}
+	if VectorIndexMode(nil) != VectorModeBruteForce {
+		t.Error("a nil index should report brute force")
+	}
+}
@@ -54,7 +54,8 @@ type VectorResult struct {
 	// Lower values indicate more similar vectors.
 	Distance float32 `json:"distance"`
 
-	// Score is the similarity score (1 - distance for cosine).
+	// Score is the similarity score (1 - distance for cosine; see
+	// Metric.Similarity for other metrics).
 	// Higher values indicate more similar vectors.
 	Score float32 `json:"score"`
 }
@@ -71,15 +72,13 @@ type PostgresVectorIndex struct {
 
 // NewPostgresVectorIndex creates a new PostgreSQL-backed vector index.
 func NewPostgresVectorIndex(database db.DB, dimensions int, cfg config.HNSWConfig) (*PostgresVectorIndex, error) {
-	tableName := fmt.Sprintf("embeddings_%d", dimensions)
+	return newPostgresVectorIndex(database, fmt.Sprintf("embeddings_%d", dimensions), dimensions, cfg)
+}
 
-	// Convert config.HNSWConfig to db.HNSWConfig
-	dbCfg := db.HNSWConfig{
-		M:              cfg.M,
-		EfConstruction: cfg.EfConstruction,
-		EfSearch:       cfg.EfSearch,
-		DistanceMetric: cfg.DistanceMetric,
-	}
+// newPostgresVectorIndex creates an HNSW index over the embedding column
+// of tableName.
+func newPostgresVectorIndex(database db.DB, tableName string, dimensions int, cfg config.HNSWConfig) (*PostgresVectorIndex, error) {
+	dbCfg := dbHNSWConfig(cfg)
 
 	hnsw := db.NewPostgresHNSW(database)
 
@@ -100,6 +99,17 @@ func NewPostgresVectorIndex(database db.DB, dimensions int, cfg config.HNSWConfi
 	}, nil
 }
 
+// dbHNSWConfig converts cfg to the db package's form, with the metric in
+// canonical form so it selects the matching operator class.
+func dbHNSWConfig(cfg config.HNSWConfig) db.HNSWConfig {
+	return db.HNSWConfig{
+		M:              cfg.M,
+		EfConstruction: cfg.EfConstruction,
+		EfSearch:       cfg.EfSearch,
+		DistanceMetric: MetricFromConfig(cfg.DistanceMetric).String(),
+	}
+}
+
 // Insert adds an embedding to the index.
 // For PostgreSQL, this inserts into the embeddings table; the HNSW index updates automatically.
 func (p *PostgresVectorIndex) Insert(ctx context.Context, contentHash string, embedding []float32) error {
@@ -117,12 +127,7 @@ func (p *PostgresVectorIndex) InsertBatch(ctx context.Context, entries map[strin
 
 // Search finds k nearest neighbors using HNSW.
 func (p *PostgresVectorIndex) Search(ctx context.Context, query []float32, k int) ([]VectorResult, error) {
-	dbCfg := db.HNSWConfig{
-		M:              p.config.M,
-		EfConstruction: p.config.EfConstruction,
-		EfSearch:       p.config.EfSearch,
-		DistanceMetric: p.config.DistanceMetric,
-	}
+	dbCfg := dbHNSWConfig(p.config)
 
 	results, err := p.hnsw.Search(ctx, p.tableName, query, k, dbCfg)
 	if err != nil {
@@ -143,12 +148,7 @@ func (p *PostgresVectorIndex) Search(ctx context.Context, query []float32, k int
 
 // SearchWithFilter finds k nearest neighbors filtered by repository.
 func (p *PostgresVectorIndex) SearchWithFilter(ctx context.Context, query []float32, k int, repoRoots []string) ([]VectorResult, error) {
-	dbCfg := db.HNSWConfig{
-		M:              p.config.M,
-		EfConstruction: p.config.EfConstruction,
-		EfSearch:       p.config.EfSearch,
-		DistanceMetric: p.config.DistanceMetric,
-	}
+	dbCfg := dbHNSWConfig(p.config)
 
 	results, err := p.hnsw.SearchWithRepoFilter(ctx, p.tableName, query, k, dbCfg, repoRoots)
 	if err != nil {
@@ -181,12 +181,7 @@ func (p *PostgresVectorIndex) DeleteBatch(ctx context.Context, contentHashes []s
 
 // Rebuild recreates the HNSW index.
 func (p *PostgresVectorIndex) Rebuild(ctx context.Context) error {
-	dbCfg := db.HNSWConfig{
-		M:              p.config.M,
-		EfConstruction: p.config.EfConstruction,
-		EfSearch:       p.config.EfSearch,
-		DistanceMetric: p.config.DistanceMetric,
-	}
+	dbCfg := dbHNSWConfig(p.config)
 	return p.hnsw.RebuildIndex(ctx, p.tableName, dbCfg)
 }
 
@@ -210,12 +205,15 @@ type SQLiteVectorIndex struct {
 	dimensions int
 }
 
-// NewSQLiteVectorIndex creates a new SQLite-backed vector index.
-func NewSQLiteVectorIndex(database db.DB, dimensions int) (*SQLiteVectorIndex, error) {
+// NewSQLiteVectorIndex creates a new SQLite-backed vector index. sqlite-vec
+// has no dot-product distance; with MetricDotProduct the index reports
+// IsNative() == false.
+func NewSQLiteVectorIndex(database db.DB, dimensions int, metric Metric) (*SQLiteVectorIndex, error) {
 	cfg := db.SQLiteVecConfig{
-		Dimensions:   dimensions,
-		TableName:    "embeddings",
-		VecTableName: "vec_embeddings",
+		Dimensions:     dimensions,
+		TableName:      "embeddings",
+		VecTableName:   "vec_embeddings",
+		DistanceMetric: metric.String(),
 	}
 
 	store, err := db.NewSQLiteVecStore(database, cfg)
@@ -315,6 +313,7 @@ type BruteForceVectorIndex struct {
 	vectors    map[string][]float32
 	mu         sync.RWMutex
 	dimensions int
+	metric     Metric
 }
 
 // NewBruteForceVectorIndex creates a new brute-force vector index.
@@ -327,6 +326,20 @@ func NewBruteForceVectorIndex(store *EmbeddingStore, dimensions int) *BruteForce
 	}
 }
 
+// SetMetric selects the similarity function used to rank results.
+// The default is cosine.
+func (b *BruteForceVectorIndex) SetMetric(metric Metric) {
+	b.metric = metric
+}
+
+// Metric returns the similarity function used to rank results.
+func (b *BruteForceVectorIndex) Metric() Metric {
+	if b.metric == "" {
+		return MetricCosine
+	}
+	return b.metric
+}
+
 // Insert adds an embedding to the in-memory index.
 func (b *BruteForceVectorIndex) Insert(ctx context.Context, contentHash string, embedding []float32) error {
 	b.mu.Lock()
@@ -360,7 +373,7 @@ func (b *BruteForceVectorIndex) Search(ctx context.Context, query []float32, k i
 		b.mu.RLock()
 	}
 
-	// Convert to slice for TopKByCosineSimilarity
+	// Convert to slice for TopKBySimilarity
 	hashes := make([]string, 0, len(b.vectors))
 	vectors := make([][]float32, 0, len(b.vectors))
 	for hash, vec := range b.vectors {
@@ -369,13 +382,14 @@ func (b *BruteForceVectorIndex) Search(ctx context.Context, query []float32, k i
 	}
 
 	// Find top-k
-	topK := TopKByCosineSimilarity(query, vectors, k)
+	metric := b.Metric()
+	topK := TopKBySimilarity(query, vectors, k, metric)
 
 	results := make([]VectorResult, len(topK))
 	for i, item := range topK {
 		results[i] = VectorResult{
 			ContentHash: hashes[item.Index],
-			Distance:    1.0 - item.Score, // Convert similarity to distance
+			Distance:    similarityToDistance(item.Score, metric),
 			Score:       item.Score,
 		}
 	}
@@ -468,30 +482,120 @@ func (b *BruteForceVectorIndex) loadFromStore(ctx context.Context) error {
 // NewVectorIndex creates the appropriate VectorIndex for the given database type.
 // Returns PostgresVectorIndex for PostgreSQL, SQLiteVectorIndex for SQLite,
 // or falls back to BruteForceVectorIndex if native HNSW is not available.
-func NewVectorIndex(database db.DB, dialect db.Dialect, dimensions int, store *EmbeddingStore) (VectorIndex, error) {
+// cfg.DistanceMetric applies to whichever backend is chosen. With
+// cfg.MinVectors set, a native index is only built once there are that
+// many vectors; until then a ThresholdVectorIndex searches by brute force.
+func NewVectorIndex(database db.DB, dialect db.Dialect, dimensions int, store *EmbeddingStore, cfg config.HNSWConfig) (VectorIndex, error) {
+	metric := MetricFromConfig(cfg.DistanceMetric)
+	bruteForce := func() *BruteForceVectorIndex {
+		idx := NewBruteForceVectorIndex(store, dimensions)
+		idx.SetMetric(metric)
+		return idx
+	}
+
+	// sqlite-vec has no inner product, so there is nothing to promote to
+	nativePossible := dialect.Name() == "postgres" ||
+		(dialect.Name() == "sqlite" && metric != MetricDotProduct)
+	if cfg.MinVectors > 0 && nativePossible {
+		minCfg := cfg
+		minCfg.MinVectors = 0
+		idx := NewThresholdVectorIndex(bruteForce(), cfg.MinVectors, func() (VectorIndex, error) {
+			return NewVectorIndex(database, dialect, dimensions, store, minCfg)
+		})
+		if err := idx.MaybePromote(context.Background()); err != nil {
+			return nil, fmt.Errorf("checking vector count: %w", err)
+		}
+		return idx, nil
+	}
+
 	switch dialect.Name() {
 	case "postgres":
-		cfg := config.DefaultHNSWConfig()
 		idx, err := NewPostgresVectorIndex(database, dimensions, cfg)
 		if err != nil {
 			// Fall back to brute force
-			return NewBruteForceVectorIndex(store, dimensions), nil
+			return bruteForce(), nil
 		}
 		return idx, nil
 
 	case "sqlite":
-		idx, err := NewSQLiteVectorIndex(database, dimensions)
+		idx, err := NewSQLiteVectorIndex(database, dimensions, metric)
 		if err != nil {
-			return NewBruteForceVectorIndex(store, dimensions), nil
+			return bruteForce(), nil
 		}
-		// Check if sqlite-vec is actually available
+		// Check if sqlite-vec is actually available for this metric
 		if !idx.IsNative() {
-			return NewBruteForceVectorIndex(store, dimensions), nil
+			return bruteForce(), nil
 		}
 		return idx, nil
 
 	default:
-		return NewBruteForceVectorIndex(store, dimensions), nil
+		return bruteForce(), nil
+	}
+}
+
+// NewCacheVectorIndex creates a native index over the vectors of an
+// EmbeddingCache, for the v2 index: HNSW on the cache's PostgreSQL table,
+// which it reads directly, so inserts and deletes are no-ops; or a
+// sqlite-vec table holding the vectors inserted into it. It fails where
+// neither is available, and cfg.MinVectors is ignored.
+func NewCacheVectorIndex(cache *EmbeddingCache, cfg config.HNSWConfig) (VectorIndex, error) {
+	metric := MetricFromConfig(cfg.DistanceMetric)
+	switch cache.dialect.Name() {
+	case "postgres":
+		return newPostgresVectorIndex(cache.database, cache.tableName(), cache.dimensions, cfg)
+
+	case "sqlite":
+		store, err := db.NewSQLiteVecStore(cache.database, db.SQLiteVecConfig{
+			Dimensions:     cache.dimensions,
+			TableName:      cache.tableName(),
+			VecTableName:   fmt.Sprintf("vec_%s_%d", cache.tableName(), cache.dimensions),
+			DistanceMetric: metric.String(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("creating sqlite-vec store: %w", err)
+		}
+		if !store.IsVecAvailable() {
+			return nil, fmt.Errorf("sqlite-vec is not available for %s distance", metric)
+		}
+		return &sqliteCacheVectorIndex{&SQLiteVectorIndex{
+			store:      store,
+			database:   cache.database,
+			dimensions: cache.dimensions,
+		}}, nil
+
+	default:
+		return nil, fmt.Errorf("no native vector index for %s", cache.dialect.Name())
+	}
+}
+
+// sqliteCacheVectorIndex is a sqlite-vec index of vectors inserted from an
+// EmbeddingCache. The cache table mixes models and encodings, so unlike
+// SQLiteVectorIndex it is never filled from its backing table.
+type sqliteCacheVectorIndex struct {
+	*SQLiteVectorIndex
+}
+
+// Sync does nothing: the index holds only the vectors inserted into it.
+func (s *sqliteCacheVectorIndex) Sync(ctx context.Context) error {
+	return nil
+}
+
+// Rebuild does nothing: there is no table to reload the vectors from, so
+// they must be inserted again.
+func (s *sqliteCacheVectorIndex) Rebuild(ctx context.Context) error {
+	return nil
+}
+
+// similarityToDistance inverts the score scale of Metric.Similarity so
+// brute-force distances match those reported by the database backends.
+func similarityToDistance(score float32, metric Metric) float32 {
+	switch metric {
+	case MetricEuclidean:
+		return 1/score - 1
+	case MetricDotProduct:
+		return -score
+	default:
+		return 1 - score
 	}
 }
 
@@ -4,6 +4,9 @@ import (
 	"context"
 	"math"
 	"testing"
+
+	"codetect/internal/config"
+	"codetect/internal/db"
 )
 
 func TestBruteForceVectorIndex_InsertAndSearch(t *testing.T) {
@@ -305,3 +308,80 @@ func randomVector(dim int) []float32 {
 	}
 	return v
 }
+
+func TestBruteForceVectorIndex_Metric(t *testing.T) {
+	ctx := context.Background()
+	vectors := map[string][]float32{
+		"short": {1, 0},
+		"long":  {10, 1},
+	}
+	query := []float32{2, 0}
+
+	tests := []struct {
+		metric       Metric
+		wantFirst    string
+		wantDistance float32
+	}{
+		{MetricCosine, "short", 0},      // Same direction
+		{MetricEuclidean, "short", 1},   // |(2,0) - (1,0)|
+		{MetricDotProduct, "long", -20}, // Negated inner product
+	}
+	for _, tt := range tests {
+		idx := NewBruteForceVectorIndex(nil, 2)
+		idx.SetMetric(tt.metric)
+		if err := idx.InsertBatch(ctx, vectors); err != nil {
+			t.Fatalf("InsertBatch failed: %v", err)
+		}
+		results, err := idx.Search(ctx, query, 2)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if results[0].ContentHash != tt.wantFirst {
+			t.Errorf("%s: first result = %s, want %s", tt.metric, results[0].ContentHash, tt.wantFirst)
+		}
+		if d := results[0].Distance; math.Abs(float64(d-tt.wantDistance)) > 1e-4 {
+			t.Errorf("%s: distance = %f, want %f", tt.metric, d, tt.wantDistance)
+		}
+	}
+}
+
+func TestNewVectorIndexMetric(t *testing.T) {
+	// PostgreSQL gets the canonical name, which selects the operator class
+	pg := dbHNSWConfig(config.HNSWConfig{M: 16, EfConstruction: 64, EfSearch: 40, DistanceMetric: "l2"})
+	if pg.DistanceMetric != config.MetricEuclidean {
+		t.Errorf("postgres DistanceMetric = %q, want euclidean", pg.DistanceMetric)
+	}
+
+	cfg := db.DefaultConfig(":memory:")
+	database, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	defer database.Close()
+
+	// sqlite-vec has no inner product, so dot_product always falls back to
+	// brute force with the same metric
+	hnsw := config.DefaultHNSWConfig()
+	hnsw.DistanceMetric = config.MetricDotProduct
+	idx, err := NewVectorIndex(database, cfg.Dialect(), 3, nil, hnsw)
+	if err != nil {
+		t.Fatalf("NewVectorIndex failed: %v", err)
+	}
+	bf, ok := idx.(*BruteForceVectorIndex)
+	if !ok {
+		t.Fatalf("NewVectorIndex returned %T, want brute force for dot_product", idx)
+	}
+	if bf.Metric() != MetricDotProduct {
+		t.Errorf("brute-force metric = %s, want dot_product", bf.Metric())
+	}
+
+	// With sqlite-vec unavailable, other metrics reach the fallback too
+	hnsw.DistanceMetric = config.MetricEuclidean
+	idx, err = NewVectorIndex(database, cfg.Dialect(), 3, nil, hnsw)
+	if err != nil {
+		t.Fatalf("NewVectorIndex failed: %v", err)
+	}
+	if bf, ok := idx.(*BruteForceVectorIndex); ok && bf.Metric() != MetricEuclidean {
+		t.Errorf("brute-force metric = %s, want euclidean", bf.Metric())
+	}
+}
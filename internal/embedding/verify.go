@@ -0,0 +1,209 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// OrphanedEmbedding is a cached vector that no location references.
+type OrphanedEmbedding struct {
+	ContentHash string `json:"content_hash"`
+	Model       string `json:"model"`
+}
+
+// VerifyResult reports inconsistencies between a repository's locations
+// and the embedding cache, left behind when indexing stops between writing
+// vectors and writing locations.
+type VerifyResult struct {
+	Locations  int `json:"locations"`  // Locations in the repo
+	Embeddings int `json:"embeddings"` // Cache entries checked, across repos
+
+	// DanglingLocations are the repo's locations whose content hash has no
+	// embedding, sorted by path and line; DanglingHashes counts their
+	// distinct hashes
+	DanglingLocations []ChunkLocation `json:"dangling_locations,omitempty"`
+	DanglingHashes    int             `json:"dangling_hashes"`
+
+	// Orphaned are embeddings that no location in any repository sharing
+	// the database references, sorted by model and hash
+	Orphaned []OrphanedEmbedding `json:"orphaned,omitempty"`
+
+	// Set by a repair: dangling hashes re-embedded and those whose content
+	// could not be recovered, and orphans deleted
+	Reembedded     int `json:"reembedded,omitempty"`
+	Unresolved     int `json:"unresolved,omitempty"`
+	OrphansDeleted int `json:"orphans_deleted,omitempty"`
+}
+
+// Consistent reports whether no dangling locations or orphaned embeddings
+// were found.
+func (r *VerifyResult) Consistent() bool {
+	return len(r.DanglingLocations) == 0 && len(r.Orphaned) == 0
+}
+
+// Verify cross-checks repoRoot's locations against the embedding cache,
+// reporting locations whose vector is missing and vectors no location
+// references. Vectors of model spaces are matched through their derived
+// keys (see ModelCacheKey), whether or not the pipeline has the space.
+// Writes made while Verify runs can be misreported, so run it when nothing
+// is indexing into the database.
+func (p *Pipeline) Verify(ctx context.Context, repoRoot string) (*VerifyResult, error) {
+	locs, err := p.locations.GetByRepo(repoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("getting locations: %w", err)
+	}
+	result := &VerifyResult{Locations: len(locs)}
+
+	coverage, err := p.Coverage(repoRoot, true)
+	if err != nil {
+		return nil, err
+	}
+	result.DanglingHashes = coverage.Missing
+	missing := make(map[string]bool, len(coverage.MissingHashes))
+	for _, hash := range coverage.MissingHashes {
+		missing[hash] = true
+	}
+	for _, loc := range locs {
+		if missing[loc.ContentHash] {
+			result.DanglingLocations = append(result.DanglingLocations, loc)
+		}
+	}
+	sort.Slice(result.DanglingLocations, func(i, j int) bool {
+		a, b := result.DanglingLocations[i], result.DanglingLocations[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.StartLine < b.StartLine
+	})
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	result.Orphaned, result.Embeddings, err = p.orphanedEmbeddings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// orphanedEmbeddings returns the vectors in the pipeline's cache tables
+// that no location references, and how many vectors were checked.
+func (p *Pipeline) orphanedEmbeddings(ctx context.Context) ([]OrphanedEmbedding, int, error) {
+	var orphaned []OrphanedEmbedding
+	checked, err := p.orphanPages(ctx, func(_ *EmbeddingCache, page []OrphanedEmbedding) error {
+		orphaned = append(orphaned, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sort.Slice(orphaned, func(i, j int) bool {
+		if orphaned[i].Model != orphaned[j].Model {
+			return orphaned[i].Model < orphaned[j].Model
+		}
+		return orphaned[i].ContentHash < orphaned[j].ContentHash
+	})
+	return orphaned, checked, nil
+}
+
+// orphanPages pages through the pipeline's cache tables in hash order,
+// calling fn with the orphaned embeddings of each page, and returns how
+// many vectors were checked. An embedding is orphaned when no location of
+// any repository references it, by its hash or, for a model space's
+// vector, by the hash its key was derived from (see ModelCacheKey), since
+// repositories sharing a database share the cache. fn may delete the
+// orphans it is given.
+func (p *Pipeline) orphanPages(ctx context.Context, fn func(cache *EmbeddingCache, orphaned []OrphanedEmbedding) error) (int, error) {
+	checked := 0
+	var referenced map[string]bool                // Loaded when first needed
+	spaceKeys := make(map[string]map[string]bool) // By model, built when first needed
+	for _, cache := range p.caches() {
+		after := ""
+		for {
+			if err := ctx.Err(); err != nil {
+				return checked, err
+			}
+			page, err := cache.HashesAfter(after, hasEntryBatchSize)
+			if err != nil {
+				return checked, err
+			}
+			if len(page) == 0 {
+				break
+			}
+			after = page[len(page)-1].ContentHash
+			checked += len(page)
+
+			hashes := make([]string, len(page))
+			models := make(map[string]string, len(page))
+			for i, h := range page {
+				hashes[i] = h.ContentHash
+				models[h.ContentHash] = h.Model
+			}
+			unreferenced, err := p.locations.GetOrphanedHashes(hashes)
+			if err != nil {
+				return checked, err
+			}
+
+			// Hashes not referenced directly may be a model space's keys
+			var orphaned []OrphanedEmbedding
+			for _, hash := range unreferenced {
+				model := models[hash]
+				if spaceKeys[model] == nil {
+					if referenced == nil {
+						if referenced, err = p.locations.ReferencedHashes(); err != nil {
+							return checked, err
+						}
+					}
+					keys := make(map[string]bool, len(referenced))
+					for ref := range referenced {
+						keys[ModelCacheKey(model, ref)] = true
+					}
+					spaceKeys[model] = keys
+				}
+				if !spaceKeys[model][hash] {
+					orphaned = append(orphaned, OrphanedEmbedding{ContentHash: hash, Model: model})
+				}
+			}
+			if len(orphaned) > 0 {
+				if err := fn(cache, orphaned); err != nil {
+					return checked, err
+				}
+			}
+		}
+	}
+	return checked, nil
+}
+
+// caches returns the pipeline's cache and its model spaces' caches, one
+// per table.
+func (p *Pipeline) caches() []*EmbeddingCache {
+	caches := []*EmbeddingCache{p.cache}
+	tables := map[string]bool{p.cache.tableName(): true}
+	for _, space := range p.spaces {
+		if table := space.Cache.tableName(); !tables[table] {
+			tables[table] = true
+			caches = append(caches, space.Cache)
+		}
+	}
+	return caches
+}
+
+// DeleteOrphans removes orphaned embeddings found by Verify from the
+// pipeline's cache tables and returns how many were removed.
+func (p *Pipeline) DeleteOrphans(orphaned []OrphanedEmbedding) (int, error) {
+	hashes := make([]string, len(orphaned))
+	for i, orphan := range orphaned {
+		hashes[i] = orphan.ContentHash
+	}
+	for i := 0; i < len(hashes); i += hasEntryBatchSize {
+		batch := hashes[i:min(i+hasEntryBatchSize, len(hashes))]
+		for _, cache := range p.caches() {
+			if err := cache.DeleteBatch(batch); err != nil {
+				return i, fmt.Errorf("deleting orphaned embeddings: %w", err)
+			}
+		}
+	}
+	return len(hashes), nil
+}
@@ -0,0 +1,145 @@
+package embedding
+
+import (
+	"context"
+	"testing"
+
+	"codetect/internal/db"
+)
+
+func TestCleanupOrphanedEmbeddings(t *testing.T) {
+	tests := []struct {
+		name    string
+		other   []Chunk  // Embedded for another repository sharing the database
+		extra   []string // Hashes put in the cache with no location
+		deleted []string // Files of /project whose locations are deleted
+		spaces  bool     // Also embed with a second model
+		want    int      // Embeddings removed
+		removed []string // Files of /project whose embeddings are removed
+	}{
+		{
+			name:  "unreferenced entry",
+			other: []Chunk{{Path: "copy.go", StartLine: 1, EndLine: 3, Content: "alpha beta"}},
+			extra: []string{HashContent("orphan")},
+			want:  1,
+		},
+		{
+			// b.go's content is still referenced by the other repository
+			name:    "deleted locations",
+			other:   []Chunk{{Path: "copy.go", StartLine: 1, EndLine: 3, Content: "beta"}},
+			deleted: []string{"a.go", "b.go"},
+			want:    1,
+			removed: []string{"a.go"},
+		},
+		{
+			name:    "model space",
+			deleted: []string{"a.go"},
+			spaces:  true,
+			want:    2,
+			removed: []string{"a.go"},
+		},
+		{
+			name:   "nothing orphaned",
+			spaces: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := db.DefaultConfig(":memory:")
+			database, err := db.Open(cfg)
+			if err != nil {
+				t.Fatalf("opening database: %v", err)
+			}
+			t.Cleanup(func() { database.Close() })
+			cache, err := NewEmbeddingCache(database, cfg.Dialect(), 3, "primary")
+			if err != nil {
+				t.Fatalf("creating cache: %v", err)
+			}
+			locations, err := NewLocationStore(database, cfg.Dialect())
+			if err != nil {
+				t.Fatalf("creating location store: %v", err)
+			}
+			var opts []PipelineOption
+			var spaces []ModelSpace
+			if tt.spaces {
+				other := &namedEmbedder{keywordEmbedder{keywords: []string{"alpha", "beta", "gamma", "delta"}}, "other"}
+				space, err := NewModelSpace(database, cfg.Dialect(), other)
+				if err != nil {
+					t.Fatalf("NewModelSpace failed: %v", err)
+				}
+				spaces = append(spaces, space)
+				opts = append(opts, WithModelSpaces(space))
+			}
+			primary := &namedEmbedder{keywordEmbedder{keywords: []string{"alpha", "beta"}}, "primary"}
+			pipeline := NewPipeline(cache, locations, primary, opts...)
+			ctx := context.Background()
+
+			chunks := []Chunk{
+				{Path: "a.go", StartLine: 1, EndLine: 3, Content: "alpha"},
+				{Path: "b.go", StartLine: 1, EndLine: 3, Content: "beta"},
+				{Path: "c.go", StartLine: 1, EndLine: 3, Content: "gamma"},
+			}
+			if _, err := pipeline.EmbedChunks(ctx, "/project", chunks); err != nil {
+				t.Fatalf("EmbedChunks failed: %v", err)
+			}
+			if len(tt.other) > 0 {
+				if _, err := pipeline.EmbedChunks(ctx, "/other", tt.other); err != nil {
+					t.Fatalf("EmbedChunks failed: %v", err)
+				}
+			}
+			for _, hash := range tt.extra {
+				if err := cache.Put(hash, []float32{1, 0, 0}); err != nil {
+					t.Fatalf("Put failed: %v", err)
+				}
+			}
+			for _, path := range tt.deleted {
+				if err := locations.DeleteByPath("/project", path); err != nil {
+					t.Fatalf("DeleteByPath(%s) failed: %v", path, err)
+				}
+			}
+
+			// Verify reports the embeddings cleanup removes
+			result, err := pipeline.Verify(ctx, "/project")
+			if err != nil {
+				t.Fatalf("Verify failed: %v", err)
+			}
+			if len(result.Orphaned) != tt.want {
+				t.Errorf("Verify found %d orphaned embeddings, want %d: %+v", len(result.Orphaned), tt.want, result.Orphaned)
+			}
+
+			removed, err := pipeline.CleanupOrphanedEmbeddings(ctx)
+			if err != nil {
+				t.Fatalf("CleanupOrphanedEmbeddings failed: %v", err)
+			}
+			if removed != tt.want {
+				t.Errorf("removed %d embeddings, want %d", removed, tt.want)
+			}
+
+			wantRemoved := make(map[string]bool)
+			for _, path := range tt.removed {
+				wantRemoved[path] = true
+			}
+			for _, c := range chunks {
+				if ok, err := cache.HasEntry(c.CacheKey()); err != nil || ok == wantRemoved[c.Path] {
+					t.Errorf("%s embedding kept = %v (err %v), want %v", c.Path, ok, err, !wantRemoved[c.Path])
+				}
+				for _, space := range spaces {
+					if ok, err := space.Cache.HasEntry(space.Key(c.CacheKey())); err != nil || ok == wantRemoved[c.Path] {
+						t.Errorf("%s %s embedding kept = %v (err %v), want %v", c.Path, space.Model, ok, err, !wantRemoved[c.Path])
+					}
+				}
+			}
+			for _, hash := range tt.extra {
+				if ok, _ := cache.HasEntry(hash); ok {
+					t.Errorf("unreferenced embedding %s was kept", hash)
+				}
+			}
+
+			// Nothing is left to clean up
+			if removed, err := pipeline.CleanupOrphanedEmbeddings(ctx); err != nil || removed != 0 {
+				t.Errorf("second cleanup removed %d (err %v), want 0", removed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package embedding
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WarmupState is the progress of a background index warm-up.
+type WarmupState string
+
+const (
+	WarmupLoading WarmupState = "loading"
+	WarmupReady   WarmupState = "ready"
+	WarmupFailed  WarmupState = "failed"
+)
+
+// WarmupStatus reports how far a warm-up has got.
+type WarmupStatus struct {
+	State      WarmupState `json:"state"`
+	Vectors    int         `json:"vectors"`
+	DurationMs int64       `json:"duration_ms,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// Warmup preloads a SemanticSearcher in the background so the first query
+// does not wait on reading every embedding from the database.
+type Warmup struct {
+	done chan struct{}
+
+	mu       sync.RWMutex
+	state    WarmupState
+	searcher *SemanticSearcher
+	err      error
+	duration time.Duration
+}
+
+// StartWarmup opens a searcher with open and preloads its index in a new
+// goroutine. It returns immediately; use Wait or Status to follow progress.
+func StartWarmup(ctx context.Context, open func() (*SemanticSearcher, error)) *Warmup {
+	w := &Warmup{
+		done:  make(chan struct{}),
+		state: WarmupLoading,
+	}
+	go w.run(ctx, open)
+	return w
+}
+
+func (w *Warmup) run(ctx context.Context, open func() (*SemanticSearcher, error)) {
+	defer close(w.done)
+
+	start := time.Now()
+	searcher, err := open()
+	if err == nil {
+		err = searcher.Preload(ctx)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.duration = time.Since(start)
+	if err != nil {
+		w.state, w.err = WarmupFailed, err
+		return
+	}
+	w.state, w.searcher = WarmupReady, searcher
+}
+
+// Wait blocks until the warm-up finishes or ctx is done, and returns the
+// warm-up error if it failed.
+func (w *Warmup) Wait(ctx context.Context) error {
+	select {
+	case <-w.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.err
+}
+
+// Status returns a snapshot of the warm-up's progress.
+func (w *Warmup) Status() WarmupStatus {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	status := WarmupStatus{State: w.state}
+	if w.state != WarmupLoading {
+		status.DurationMs = w.duration.Milliseconds()
+	}
+	if w.searcher != nil {
+		status.Vectors = w.searcher.PreloadedCount()
+	}
+	if w.err != nil {
+		status.Error = w.err.Error()
+	}
+	return status
+}
+
+// Searcher returns the preloaded searcher, or nil until the warm-up is
+// ready.
+func (w *Warmup) Searcher() *SemanticSearcher {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.searcher
+}
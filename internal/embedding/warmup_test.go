@@ -0,0 +1,88 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWarmupPreloadsBeforeSearch(t *testing.T) {
+	searcher := setupRankedSearcher(t, 5)
+	if got := searcher.PreloadedCount(); got != 0 {
+		t.Fatalf("PreloadedCount before warm-up = %d, want 0", got)
+	}
+
+	w := StartWarmup(context.Background(), func() (*SemanticSearcher, error) {
+		return searcher, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := w.Wait(ctx); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+
+	// The index is in memory before any search has run
+	status := w.Status()
+	if status.State != WarmupReady {
+		t.Errorf("State = %q, want %q", status.State, WarmupReady)
+	}
+	if status.Vectors != 5 {
+		t.Errorf("Vectors = %d, want 5", status.Vectors)
+	}
+	if w.Searcher() != searcher {
+		t.Fatal("Searcher did not return the warmed searcher")
+	}
+	if got := searcher.PreloadedCount(); got != 5 {
+		t.Fatalf("PreloadedCount = %d, want 5", got)
+	}
+
+	results, err := searcher.Search("query", 3)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results.Results) != 3 || results.Results[0].Path != "file00.go" {
+		t.Errorf("unexpected results after warm-up: %+v", results.Results)
+	}
+}
+
+func TestWarmupFailure(t *testing.T) {
+	w := StartWarmup(context.Background(), func() (*SemanticSearcher, error) {
+		return nil, errors.New("no index")
+	})
+
+	if err := w.Wait(context.Background()); err == nil {
+		t.Fatal("expected warm-up error")
+	}
+	status := w.Status()
+	if status.State != WarmupFailed || status.Error != "no index" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+	if w.Searcher() != nil {
+		t.Error("Searcher should be nil after a failed warm-up")
+	}
+}
+
+func TestPreloadReloadsOnIndexChange(t *testing.T) {
+	searcher := setupRankedSearcher(t, 3)
+	if err := searcher.Preload(context.Background()); err != nil {
+		t.Fatalf("Preload: %v", err)
+	}
+
+	chunk := Chunk{Path: "new.go", StartLine: 1, EndLine: 5, Content: "func g() {}"}
+	if err := searcher.store.Save(chunk, []float32{1, 0, 0}, searcher.ProviderID()); err != nil {
+		t.Fatalf("saving chunk: %v", err)
+	}
+
+	results, err := searcher.Search("query", 10)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results.Results) != 4 {
+		t.Errorf("got %d results, want 4 after index change", len(results.Results))
+	}
+	if got := searcher.PreloadedCount(); got != 4 {
+		t.Errorf("PreloadedCount = %d, want 4", got)
+	}
+}
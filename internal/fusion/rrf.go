@@ -6,6 +6,7 @@ package fusion
 
 import (
 	"sort"
+	"time"
 )
 
 // RRFConstant is the standard RRF parameter (typically 60).
@@ -38,6 +39,14 @@ type Result struct {
 	// Snippet is optional text content from the match
 	Snippet string
 
+	// NodeType is the AST node type of the chunk matched (e.g.
+	// "function_declaration", "gap"), empty if unknown
+	NodeType string
+
+	// ModTime is when the file was last modified, as of when it was
+	// indexed; zero if unknown
+	ModTime time.Time
+
 	// Metadata contains source-specific additional data
 	Metadata map[string]interface{}
 }
@@ -166,6 +175,70 @@ func WeightedRRF(weights map[string]float64, lists ...[]Result) []RRFResult {
 	return results
 }
 
+// WeightByNodeType scales each result's score by the weight of its node
+// type and re-sorts the list by the scaled score, so that down-weighted
+// chunks (such as imports and gaps between declarations) fall below
+// equally-scored chunks of other types before the list is fused. Results
+// of unknown or unweighted node types keep their score; ties keep their
+// original order. The list is modified in place and returned.
+//
+// Example weights:
+//
+//	{"gap": 0.5, "import_declaration": 0.5}
+func WeightByNodeType(list []Result, weights map[string]float64) []Result {
+	if len(weights) == 0 {
+		return list
+	}
+	for i := range list {
+		if weight, ok := weights[list[i].NodeType]; ok && list[i].NodeType != "" {
+			list[i].Score *= weight
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Score > list[j].Score
+	})
+	return list
+}
+
+// BoostByFreshness raises each result's score by up to weight, as a
+// fraction of the score, by how recently its file was modified compared to
+// the other results: the newest file gets the full boost and the oldest
+// none. The list is then re-sorted by the boosted score, so a small weight
+// only reorders near ties toward recent files. Results with an unknown
+// ModTime are not boosted; ties keep their original order. The list is
+// modified in place and returned; a weight of 0 leaves it unchanged.
+func BoostByFreshness(list []Result, weight float64) []Result {
+	if weight <= 0 {
+		return list
+	}
+	var oldest, newest time.Time
+	for _, r := range list {
+		if r.ModTime.IsZero() {
+			continue
+		}
+		if oldest.IsZero() || r.ModTime.Before(oldest) {
+			oldest = r.ModTime
+		}
+		if r.ModTime.After(newest) {
+			newest = r.ModTime
+		}
+	}
+	span := newest.Sub(oldest)
+	if span <= 0 {
+		return list
+	}
+	for i := range list {
+		if !list[i].ModTime.IsZero() {
+			freshness := float64(list[i].ModTime.Sub(oldest)) / float64(span)
+			list[i].Score *= 1 + weight*freshness
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Score > list[j].Score
+	})
+	return list
+}
+
 // TopN returns the top N results from an RRF result list.
 // If n is greater than the list length, returns all results.
 func TopN(results []RRFResult, n int) []RRFResult {
@@ -1,7 +1,9 @@
 package fusion
 
 import (
+	"fmt"
 	"testing"
+	"time"
 )
 
 func TestReciprocalRankFusion(t *testing.T) {
@@ -145,6 +147,112 @@ func TestWeightedRRFDefaultWeight(t *testing.T) {
 	}
 }
 
+func TestWeightByNodeType(t *testing.T) {
+	weights := map[string]float64{"gap": 0.5}
+
+	// Equally similar gap and function matches, in every interleaving a
+	// semantic search could return them
+	orders := [][]string{
+		{"gap", "function_declaration", "gap", "function_declaration"},
+		{"gap", "gap", "function_declaration", "function_declaration"},
+		{"function_declaration", "gap", "gap", "function_declaration"},
+	}
+	for i, order := range orders {
+		list := make([]Result, len(order))
+		for j, nodeType := range order {
+			list[j] = Result{
+				ID:       fmt.Sprintf("%s-%d", nodeType, j),
+				Score:    0.8,
+				Source:   "semantic",
+				NodeType: nodeType,
+			}
+		}
+
+		results := WeightedRRF(nil, WeightByNodeType(list, weights))
+		if len(results) != len(order) {
+			t.Fatalf("order %d: expected %d results, got %d", i, len(order), len(results))
+		}
+		for j, r := range results {
+			wantFunction := j < 2
+			if (r.NodeType == "function_declaration") != wantFunction {
+				t.Errorf("order %d: result %d is %q, want functions ranked above gaps", i, j, r.ID)
+			}
+		}
+	}
+}
+
+func TestWeightByNodeTypeKeepsUnweighted(t *testing.T) {
+	list := []Result{
+		{ID: "a", Score: 0.9, NodeType: "gap"},
+		{ID: "b", Score: 0.7, NodeType: "method_declaration"},
+		{ID: "c", Score: 0.6},
+	}
+
+	got := WeightByNodeType(list, map[string]float64{"gap": 0.5})
+
+	// "a" drops below the unweighted results, whose scores are unchanged
+	wantIDs := []string{"b", "c", "a"}
+	wantScores := []float64{0.7, 0.6, 0.45}
+	for i, r := range got {
+		if r.ID != wantIDs[i] || r.Score != wantScores[i] {
+			t.Errorf("result %d = %s (%f), want %s (%f)", i, r.ID, r.Score, wantIDs[i], wantScores[i])
+		}
+	}
+
+	// No weights leaves the list as it is
+	list = []Result{{ID: "a", Score: 0.1, NodeType: "gap"}, {ID: "b", Score: 0.9}}
+	if got := WeightByNodeType(list, nil); got[0].ID != "a" || got[0].Score != 0.1 {
+		t.Errorf("WeightByNodeType(nil) reordered or rescored the list: %+v", got)
+	}
+}
+
+func TestBoostByFreshness(t *testing.T) {
+	old := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	recent := old.Add(30 * 24 * time.Hour)
+
+	// Equally relevant chunks, the older file first
+	tied := func() []Result {
+		return []Result{
+			{ID: "old", Score: 0.8, Source: "semantic", ModTime: old},
+			{ID: "new", Score: 0.8, Source: "semantic", ModTime: recent},
+		}
+	}
+
+	results := WeightedRRF(nil, BoostByFreshness(tied(), 0.1))
+	if results[0].ID != "new" || results[1].ID != "old" {
+		t.Errorf("with boost, got order %s, %s, want the newer file first", results[0].ID, results[1].ID)
+	}
+	if results[1].Score != 0.8 {
+		t.Errorf("oldest result score = %f, want unboosted 0.8", results[1].Score)
+	}
+
+	results = WeightedRRF(nil, BoostByFreshness(tied(), 0))
+	if results[0].ID != "old" || results[0].Score != 0.8 || results[1].Score != 0.8 {
+		t.Errorf("zero weight reordered or rescored the list: %+v", results)
+	}
+}
+
+func TestBoostByFreshnessKeepsClearWinners(t *testing.T) {
+	old := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	list := []Result{
+		{ID: "relevant", Score: 0.9, ModTime: old},
+		{ID: "unknown", Score: 0.85},
+		{ID: "fresh", Score: 0.6, ModTime: old.Add(time.Hour)},
+	}
+
+	got := BoostByFreshness(list, 0.1)
+
+	// A slight boost does not lift the much less relevant fresh file, and
+	// a result with no modification time keeps its score
+	wantIDs := []string{"relevant", "unknown", "fresh"}
+	wantScores := []float64{0.9, 0.85, 0.6 * 1.1}
+	for i, r := range got {
+		if r.ID != wantIDs[i] || r.Score != wantScores[i] {
+			t.Errorf("result %d = %s (%f), want %s (%f)", i, r.ID, r.Score, wantIDs[i], wantScores[i])
+		}
+	}
+}
+
 func TestTopN(t *testing.T) {
 	results := []RRFResult{
 		{Result: Result{ID: "a"}, RRFScore: 1.0},
@@ -0,0 +1,316 @@
+package indexer
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"codetect/internal/config"
+	"codetect/internal/db"
+	"codetect/internal/embedding"
+	"codetect/internal/merkle"
+)
+
+// BundleFormatVersion is the layout version written by Export. ImportBundle
+// rejects bundles from a newer version.
+const BundleFormatVersion = 1
+
+// bundleManifestName and bundleDBName are the bundle's entries besides the
+// Merkle tree, which keeps its merkle.TreeFileName.
+const (
+	bundleManifestName = "manifest.json"
+	bundleDBName       = "index.db"
+)
+
+// BundleManifest describes an exported index. It is the first entry of a
+// bundle.
+type BundleManifest struct {
+	FormatVersion  int       `json:"format_version"`
+	CreatedBy      string    `json:"created_by,omitempty"` // Tool and version that wrote the bundle
+	CreatedAt      time.Time `json:"created_at"`
+	RepoRoot       string    `json:"repo_root"` // Repository the index was built for
+	EmbeddingModel string    `json:"embedding_model,omitempty"`
+	Dimensions     int       `json:"dimensions,omitempty"`
+	Locations      int       `json:"locations"`
+	Files          []string  `json:"files"` // Bundle entries after the manifest
+}
+
+// Export writes a portable bundle of the index to w: a gzipped tar holding
+// a BundleManifest, a consistent snapshot of the SQLite database and the
+// Merkle tree. Locations of other repositories sharing the database are
+// left out. createdBy is recorded in the manifest. Only SQLite indexes can
+// be exported.
+func (idx *Indexer) Export(w io.Writer, createdBy string) (*BundleManifest, error) {
+	if idx.config.databaseType() != db.DatabaseSQLite {
+		return nil, errors.New("export supports SQLite indexes only")
+	}
+
+	// Let pending access-stat writes land in the snapshot
+	if err := idx.cache.Flush(context.Background()); err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "codetect-export-")
+	if err != nil {
+		return nil, fmt.Errorf("creating temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	snapshot := filepath.Join(tmpDir, bundleDBName)
+	if _, err := idx.database.Exec("VACUUM INTO ?", snapshot); err != nil {
+		return nil, fmt.Errorf("snapshotting database: %w", err)
+	}
+	locations, err := pruneSnapshot(snapshot, idx.repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &BundleManifest{
+		FormatVersion:  BundleFormatVersion,
+		CreatedBy:      createdBy,
+		CreatedAt:      time.Now().UTC(),
+		RepoRoot:       idx.repoPath,
+		EmbeddingModel: idx.config.EmbeddingModel,
+		Dimensions:     idx.config.Dimensions,
+		Locations:      locations,
+		Files:          []string{bundleDBName},
+	}
+	files := map[string]string{bundleDBName: snapshot}
+	// A tree kept in the database travels with it
+	if store, ok := idx.merkleStore.(*merkle.Store); ok && store.Exists() {
+		manifest.Files = append(manifest.Files, merkle.TreeFileName)
+		files[merkle.TreeFileName] = store.Path()
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encoding manifest: %w", err)
+	}
+	if err := writeTarEntry(tw, bundleManifestName, data); err != nil {
+		return nil, err
+	}
+	for _, name := range manifest.Files {
+		data, err := os.ReadFile(files[name])
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", name, err)
+		}
+		if err := writeTarEntry(tw, name, data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("writing bundle: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("writing bundle: %w", err)
+	}
+	return manifest, nil
+}
+
+// pruneSnapshot removes the locations of repositories other than repoRoot
+// from the database at path and returns how many locations remain.
+func pruneSnapshot(path, repoRoot string) (int, error) {
+	return withLocationStore(path, func(locations *embedding.LocationStore) (int, error) {
+		repos, err := locations.Repos()
+		if err != nil {
+			return 0, err
+		}
+		for _, repo := range repos {
+			if repo == repoRoot {
+				continue
+			}
+			if err := locations.DeleteByRepo(repo); err != nil {
+				return 0, fmt.Errorf("removing locations of %s: %w", repo, err)
+			}
+		}
+		return locations.CountByRepo(repoRoot)
+	})
+}
+
+// withLocationStore opens the SQLite database at path and calls fn with
+// its location store.
+func withLocationStore(path string, fn func(*embedding.LocationStore) (int, error)) (int, error) {
+	cfg := db.DefaultConfig(path)
+	database, err := db.Open(cfg)
+	if err != nil {
+		return 0, fmt.Errorf("opening %s: %w", filepath.Base(path), err)
+	}
+	defer database.Close()
+
+	locations, err := embedding.NewLocationStore(database, cfg.Dialect())
+	if err != nil {
+		return 0, err
+	}
+	return fn(locations)
+}
+
+// writeTarEntry writes a regular file entry to tw.
+func writeTarEntry(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	return nil
+}
+
+// ImportBundleOptions configures ImportBundle.
+type ImportBundleOptions struct {
+	Force      bool // Replace an existing index
+	Dimensions int  // If set, reject bundles with vectors of other dimensions
+}
+
+// ImportBundle restores a bundle written by Export into repoPath's
+// .codetect directory and returns its manifest. The index is moved to
+// repoPath, so a bundle exported from one checkout can be used in another
+// of the same repository. An existing index is only replaced with
+// opts.Force. Nothing is changed if the bundle is invalid or from a newer
+// format version.
+func ImportBundle(r io.Reader, repoPath string, opts ImportBundleOptions) (*BundleManifest, error) {
+	absPath, err := config.NormalizeRepoRoot(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("resolving path: %w", err)
+	}
+	dataDir := filepath.Join(absPath, ".codetect")
+	dbPath := filepath.Join(dataDir, bundleDBName)
+	if _, err := os.Stat(dbPath); err == nil && !opts.Force {
+		return nil, fmt.Errorf("%s already has an index; force the import to replace it", absPath)
+	}
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, fmt.Errorf("creating data directory: %w", err)
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading bundle: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != bundleManifestName {
+		return nil, errors.New("not a codetect bundle: missing manifest")
+	}
+	var manifest BundleManifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	if err := manifest.check(opts); err != nil {
+		return nil, err
+	}
+
+	// Unpack next to the index, so installing is a rename
+	tmpDir, err := os.MkdirTemp(dataDir, "import-")
+	if err != nil {
+		return nil, fmt.Errorf("creating temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	found := make(map[string]bool)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading bundle: %w", err)
+		}
+		if hdr.Name != bundleDBName && hdr.Name != merkle.TreeFileName {
+			return nil, fmt.Errorf("unexpected entry %q in bundle", hdr.Name)
+		}
+		if err := extractTarEntry(tr, filepath.Join(tmpDir, hdr.Name)); err != nil {
+			return nil, err
+		}
+		found[hdr.Name] = true
+	}
+	if !found[bundleDBName] {
+		return nil, errors.New("bundle has no database")
+	}
+
+	if manifest.RepoRoot != absPath {
+		_, err := withLocationStore(filepath.Join(tmpDir, bundleDBName), func(locations *embedding.LocationStore) (int, error) {
+			return locations.RelocateRepo(manifest.RepoRoot, absPath)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("moving index to %s: %w", absPath, err)
+		}
+	}
+	if found[merkle.TreeFileName] {
+		store := merkle.NewStore(tmpDir)
+		tree, err := store.Load()
+		if err != nil {
+			return nil, err
+		}
+		tree.RepoPath = absPath
+		if err := store.Save(tree); err != nil {
+			return nil, err
+		}
+	}
+
+	// Install, dropping journal files of the database being replaced
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(dbPath + suffix); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("removing old index: %w", err)
+		}
+	}
+	if err := os.Rename(filepath.Join(tmpDir, bundleDBName), dbPath); err != nil {
+		return nil, fmt.Errorf("installing index: %w", err)
+	}
+	treePath := filepath.Join(dataDir, merkle.TreeFileName)
+	if found[merkle.TreeFileName] {
+		err = os.Rename(filepath.Join(tmpDir, merkle.TreeFileName), treePath)
+	} else {
+		// Without a tree the next index run compares every file
+		err = os.Remove(treePath)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("installing merkle tree: %w", err)
+	}
+
+	return &manifest, nil
+}
+
+// check returns an error if the bundle cannot be imported with opts.
+func (m *BundleManifest) check(opts ImportBundleOptions) error {
+	if m.FormatVersion < 1 {
+		return errors.New("not a codetect bundle: missing format version")
+	}
+	if m.FormatVersion > BundleFormatVersion {
+		return fmt.Errorf("bundle format %d is newer than the supported %d; upgrade codetect to import it",
+			m.FormatVersion, BundleFormatVersion)
+	}
+	if opts.Dimensions > 0 && m.Dimensions > 0 && m.Dimensions != opts.Dimensions {
+		return fmt.Errorf("bundle has %d-dimensional embeddings, configured dimensions are %d",
+			m.Dimensions, opts.Dimensions)
+	}
+	return nil
+}
+
+// extractTarEntry copies the current entry of tr to path.
+func extractTarEntry(tr *tar.Reader, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("extracting %s: %w", filepath.Base(path), err)
+	}
+	if _, err := io.Copy(f, tr); err != nil {
+		f.Close()
+		return fmt.Errorf("extracting %s: %w", filepath.Base(path), err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,127 @@
+package indexer
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"codetect/internal/embedding"
+)
+
+func TestIndexer_ExportImport(t *testing.T) {
+	files := map[string]string{
+		"billing/invoices.md": "# Invoices\n\nEach invoice lists invoice lines and totals.\n",
+		"billing/refunds.md":  "# Refunds\n\nA refund reverses a payment. Refund requests need approval.\n",
+		"ops/shipping.md":     "# Shipping\n\nShipping labels are printed when shipping starts.\n",
+	}
+	cfg := func() *Config {
+		return &Config{DBType: "sqlite", Dimensions: len(embedWords), Embedder: wordEmbedder{}}
+	}
+	ctx := context.Background()
+
+	src, err := New(writeRepo(t, files), cfg())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer src.Close()
+	if _, err := src.Index(ctx, IndexOptions{}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+
+	var bundle bytes.Buffer
+	manifest, err := src.Export(&bundle, "test")
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if manifest.FormatVersion != BundleFormatVersion || manifest.RepoRoot != src.RepoPath() || manifest.Locations == 0 {
+		t.Errorf("manifest = %+v", manifest)
+	}
+
+	// A fresh checkout of the same files elsewhere
+	dst := writeRepo(t, files)
+	data := bundle.Bytes()
+	if _, err := ImportBundle(bytes.NewReader(data), dst, ImportBundleOptions{Dimensions: len(embedWords)}); err != nil {
+		t.Fatalf("ImportBundle() error = %v", err)
+	}
+	if _, err := ImportBundle(bytes.NewReader(data), dst, ImportBundleOptions{}); err == nil {
+		t.Error("ImportBundle() over an existing index succeeded without Force")
+	}
+	if _, err := ImportBundle(bytes.NewReader(data), dst, ImportBundleOptions{Force: true}); err != nil {
+		t.Fatalf("ImportBundle(Force) error = %v", err)
+	}
+
+	idx, err := New(dst, cfg())
+	if err != nil {
+		t.Fatalf("New() on imported index error = %v", err)
+	}
+	defer idx.Close()
+
+	search := func(idx *Indexer, query string) []string {
+		t.Helper()
+		results, err := idx.Searcher().Search(ctx, query, embedding.CacheSearchOptions{RepoRoot: idx.RepoPath(), Limit: 3})
+		if err != nil {
+			t.Fatalf("Search(%q) error = %v", query, err)
+		}
+		var got []string
+		for _, r := range results {
+			got = append(got, filepath.ToSlash(r.Path))
+		}
+		return got
+	}
+	for _, query := range []string{"refund", "shipping", "invoice"} {
+		want := search(src, query)
+		if got := search(idx, query); len(want) == 0 || !reflect.DeepEqual(got, want) {
+			t.Errorf("Search(%q) on import = %v, export = %v", query, got, want)
+		}
+	}
+
+	// The imported tree matches the checkout, so nothing is reindexed
+	result, err := idx.Index(ctx, IndexOptions{})
+	if err != nil {
+		t.Fatalf("Index() on imported index error = %v", err)
+	}
+	if result.ChangeType != "none" {
+		t.Errorf("Index() after import = %+v, want no changes", result)
+	}
+}
+
+func TestImportBundle_RejectsIncompatible(t *testing.T) {
+	bundle := func(manifest BundleManifest) *bytes.Buffer {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		data, _ := json.Marshal(manifest)
+		if err := writeTarEntry(tw, bundleManifestName, data); err != nil {
+			t.Fatal(err)
+		}
+		tw.Close()
+		gz.Close()
+		return &buf
+	}
+
+	tests := []struct {
+		name     string
+		manifest BundleManifest
+		opts     ImportBundleOptions
+		wantErr  string
+	}{
+		{"newer format", BundleManifest{FormatVersion: BundleFormatVersion + 1}, ImportBundleOptions{}, "upgrade"},
+		{"no format", BundleManifest{}, ImportBundleOptions{}, "format version"},
+		{"dimensions", BundleManifest{FormatVersion: 1, Dimensions: 768}, ImportBundleOptions{Dimensions: 384}, "dimension"},
+		{"no database", BundleManifest{FormatVersion: 1}, ImportBundleOptions{}, "no database"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ImportBundle(bundle(tt.manifest), t.TempDir(), tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ImportBundle() error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
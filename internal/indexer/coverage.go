@@ -0,0 +1,145 @@
+package indexer
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"codetect/internal/chunker"
+)
+
+// LanguageCoverage counts the files of one language by how far they made
+// it into the index. Found is the sum of the other three.
+type LanguageCoverage struct {
+	Language   string `json:"language"`
+	Found      int    `json:"found"`      // Files in the repository's tree
+	Embedded   int    `json:"embedded"`   // Indexed, with an embedding for every chunk
+	Unembedded int    `json:"unembedded"` // Indexed, but some chunks have no embedding
+	Skipped    int    `json:"skipped"`    // Not indexed: filtered out, unparseable, empty or unreadable
+}
+
+func (c *LanguageCoverage) add(o LanguageCoverage) {
+	c.Found += o.Found
+	c.Embedded += o.Embedded
+	c.Unembedded += o.Unembedded
+	c.Skipped += o.Skipped
+}
+
+// CoverageReport breaks down by language how much of a repository the
+// index covers, so a language left out by accident, such as SQL files
+// filtered as generated, stands out.
+type CoverageReport struct {
+	Languages []LanguageCoverage `json:"languages"` // Sorted by language
+	Total     LanguageCoverage   `json:"total"`     // Language is empty
+}
+
+// Language returns the coverage of language, which is zero if the
+// repository has no such files.
+func (r *CoverageReport) Language(language string) LanguageCoverage {
+	for _, c := range r.Languages {
+		if c.Language == language {
+			return c
+		}
+	}
+	return LanguageCoverage{Language: language}
+}
+
+// WriteText writes the report as a table, one language per line.
+func (r *CoverageReport) WriteText(w io.Writer) error {
+	if r.Total.Found == 0 {
+		_, err := fmt.Fprintln(w, "No files found")
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "  %-14s %8s %8s %10s %8s\n", "LANGUAGE", "FOUND", "EMBEDDED", "UNEMBEDDED", "SKIPPED"); err != nil {
+		return err
+	}
+	for _, c := range append(r.Languages, r.Total) {
+		name := c.Language
+		if name == "" {
+			name = "total"
+		}
+		if _, err := fmt.Fprintf(w, "  %-14s %8d %8d %10d %8d\n", name, c.Found, c.Embedded, c.Unembedded, c.Skipped); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CoverageByLanguage reports, for each language, how many files of the
+// stored tree are indexed and embedded. It reflects the index as of the
+// last run, so it is empty before the first one.
+func (idx *Indexer) CoverageByLanguage() (*CoverageReport, error) {
+	report := &CoverageReport{}
+	tree, err := idx.merkleStore.Load()
+	if err != nil {
+		return nil, fmt.Errorf("loading merkle tree: %w", err)
+	}
+	if tree == nil {
+		return report, nil
+	}
+
+	locations, err := idx.locations.GetByRepo(idx.repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("getting locations: %w", err)
+	}
+	coverage, err := idx.pipeline.Coverage(idx.repoPath, true)
+	if err != nil {
+		return nil, fmt.Errorf("getting embedding coverage: %w", err)
+	}
+	missing := make(map[string]bool, len(coverage.MissingHashes))
+	for _, hash := range coverage.MissingHashes {
+		missing[hash] = true
+	}
+
+	// Whether each indexed file has all of its chunks embedded
+	embedded := make(map[string]bool)
+	for _, loc := range locations {
+		path := filepath.ToSlash(loc.Path)
+		complete, seen := embedded[path]
+		embedded[path] = (complete || !seen) && !missing[loc.ContentHash]
+	}
+
+	byLanguage := make(map[string]*LanguageCoverage)
+	for _, path := range idx.collectAllFiles(tree.Root) {
+		language := idx.coverageLanguage(path)
+		c := byLanguage[language]
+		if c == nil {
+			c = &LanguageCoverage{Language: language}
+			byLanguage[language] = c
+		}
+		c.Found++
+		switch complete, indexed := embedded[filepath.ToSlash(path)]; {
+		case !indexed:
+			c.Skipped++
+		case complete:
+			c.Embedded++
+		default:
+			c.Unembedded++
+		}
+	}
+
+	for _, c := range byLanguage {
+		report.Languages = append(report.Languages, *c)
+		report.Total.add(*c)
+	}
+	sort.Slice(report.Languages, func(i, j int) bool {
+		return report.Languages[i].Language < report.Languages[j].Language
+	})
+	return report, nil
+}
+
+// coverageLanguage names the language a file is counted under: the one the
+// chunker parses it as, or else its extension, so that files without a
+// grammar, such as SQL, are still told apart.
+func (idx *Indexer) coverageLanguage(path string) string {
+	if config := chunker.ResolveLanguageConfig(path, idx.astChunker.LanguageOverrides); config != nil {
+		return config.Name
+	}
+	if ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")); ext != "" {
+		return ext
+	}
+	return "unknown"
+}
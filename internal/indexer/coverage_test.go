@@ -0,0 +1,105 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestIndexer_CoverageByLanguage(t *testing.T) {
+	repo := writeRepo(t, map[string]string{
+		"a.go":          "package a\n\nfunc A() int {\n\treturn 1\n}\n",
+		"b.go":          "package a\n\nfunc B() int {\n\treturn 2\n}\n",
+		"gen.go":        "// Code generated by protoc. DO NOT EDIT.\n\npackage a\n\nfunc Gen() int {\n\treturn 3\n}\n",
+		"lib/util.py":   "def util():\n    return 1\n",
+		"lib/empty.py":  "",
+		"db/schema.sql": "CREATE TABLE users (id INTEGER PRIMARY KEY);\n",
+		"image.bin":     "\x00\x01\x02\x03",
+	})
+	idx, err := New(repo, &Config{DBType: "sqlite", Dimensions: 4, Embedder: &countingEmbedder{}, SkipNonSource: true})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+
+	report, err := idx.CoverageByLanguage()
+	if err != nil {
+		t.Fatalf("CoverageByLanguage() before indexing error = %v", err)
+	}
+	if report.Total.Found != 0 || len(report.Languages) != 0 {
+		t.Errorf("CoverageByLanguage() before indexing = %+v, want empty", report)
+	}
+
+	result, err := idx.Index(context.Background(), IndexOptions{ReportCoverage: true})
+	if err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	if result.Coverage == nil {
+		t.Fatal("Coverage is nil with ReportCoverage")
+	}
+
+	want := []LanguageCoverage{
+		{Language: "bin", Found: 1, Skipped: 1},
+		{Language: "go", Found: 3, Embedded: 2, Skipped: 1},
+		{Language: "python", Found: 2, Embedded: 1, Skipped: 1},
+		{Language: "sql", Found: 1, Embedded: 1},
+	}
+	if len(result.Coverage.Languages) != len(want) {
+		t.Fatalf("Languages = %+v, want %+v", result.Coverage.Languages, want)
+	}
+	for i, w := range want {
+		if got := result.Coverage.Languages[i]; got != w {
+			t.Errorf("Languages[%d] = %+v, want %+v", i, got, w)
+		}
+	}
+	total := LanguageCoverage{Found: 7, Embedded: 4, Skipped: 3}
+	if result.Coverage.Total != total {
+		t.Errorf("Total = %+v, want %+v", result.Coverage.Total, total)
+	}
+	if got := result.Coverage.Language("rust"); got != (LanguageCoverage{Language: "rust"}) {
+		t.Errorf("Language(rust) = %+v, want zero", got)
+	}
+
+	var buf bytes.Buffer
+	if err := result.Coverage.WriteText(&buf); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+	for _, line := range []string{"python", "sql", "total"} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("WriteText() output missing %q:\n%s", line, buf.String())
+		}
+	}
+
+	result, err = idx.Index(context.Background(), IndexOptions{})
+	if err != nil {
+		t.Fatalf("second Index() error = %v", err)
+	}
+	if result.Coverage != nil {
+		t.Errorf("Coverage = %+v without ReportCoverage, want nil", result.Coverage)
+	}
+}
+
+func TestIndexer_CoverageByLanguageUnembedded(t *testing.T) {
+	repo := writeRepo(t, map[string]string{
+		"a.go":    "package a\n\nfunc A() int {\n\treturn 1\n}\n",
+		"util.py": "def util():\n    return 1\n",
+	})
+	idx, err := New(repo, &Config{DBType: "sqlite", EmbeddingProvider: "off", Dimensions: 768})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+
+	result, err := idx.Index(context.Background(), IndexOptions{ReportCoverage: true})
+	if err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	total := LanguageCoverage{Found: 2, Unembedded: 2}
+	if result.Coverage.Total != total {
+		t.Errorf("Total = %+v, want %+v", result.Coverage.Total, total)
+	}
+	if got := result.Coverage.Language("go"); got.Unembedded != 1 {
+		t.Errorf("Language(go) = %+v, want 1 unembedded", got)
+	}
+}
@@ -0,0 +1,41 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"codetect/internal/embedding"
+)
+
+// exampleFileName is the path snippets without a path hint are chunked
+// under. It has no extension, so they are split by lines.
+const exampleFileName = "example"
+
+// SearchByExample returns the indexed code most like snippet, a pasted
+// piece of code. The snippet is chunked as a file at path would be, so the
+// extension of path selects its language (empty means plain text), and its
+// chunks are embedded the way indexed chunks are; see
+// embedding.CacheSearcher.SearchChunks. opts.RepoRoot defaults to this
+// repository.
+func (idx *Indexer) SearchByExample(ctx context.Context, snippet, path string, opts embedding.CacheSearchOptions) ([]embedding.CacheSearchResult, error) {
+	if strings.TrimSpace(snippet) == "" {
+		return nil, fmt.Errorf("snippet is empty")
+	}
+	if path == "" {
+		path = exampleFileName
+	}
+	if opts.RepoRoot == "" {
+		opts.RepoRoot = idx.repoPath
+	}
+
+	chunks, err := idx.chunkText(ctx, path, []byte(snippet), nil)
+	if err != nil {
+		return nil, fmt.Errorf("chunking snippet: %w", err)
+	}
+	// path only picks the language; it is not where the snippet lives
+	for i := range chunks {
+		chunks[i].PathContext = ""
+	}
+	return idx.Searcher().SearchChunks(ctx, chunks, opts)
+}
@@ -0,0 +1,147 @@
+package indexer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"codetect/internal/embedding"
+)
+
+// tokenEmbedder embeds code as counts of a few tokens, so functions doing
+// similar things get similar vectors.
+type tokenEmbedder struct {
+	texts []string
+}
+
+var embedTokens = []string{"range", "+=", "http.", "err != nil", "sort.", "json."}
+
+func (e *tokenEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.texts = append(e.texts, texts...)
+	result := make([][]float32, len(texts))
+	for i, text := range texts {
+		vec := make([]float32, len(embedTokens))
+		for j, token := range embedTokens {
+			vec[j] = float32(strings.Count(text, token))
+		}
+		result[i] = vec
+	}
+	return result, nil
+}
+
+func (e *tokenEmbedder) Available() bool    { return true }
+func (e *tokenEmbedder) ProviderID() string { return "tokens" }
+func (e *tokenEmbedder) Dimensions() int    { return len(embedTokens) }
+
+func TestIndexer_SearchByExample(t *testing.T) {
+	total := "func Total(xs []int) int {\n\tsum := 0\n\tfor _, x := range xs {\n\t\tsum += x\n\t}\n\treturn sum\n}\n"
+	repo := writeRepo(t, map[string]string{
+		"math.go": "package a\n\n" + total,
+		"fetch.go": "package a\n\nimport \"net/http\"\n\n" +
+			"func Fetch(url string) error {\n\tresp, err := http.Get(url)\n\tif err != nil {\n\t\treturn err\n\t}\n\treturn resp.Body.Close()\n}\n",
+		"order.go": "package a\n\nimport \"sort\"\n\nfunc Order(xs []int) {\n\tsort.Ints(xs)\n}\n",
+	})
+	embedder := &tokenEmbedder{}
+	idx, err := New(repo, &Config{
+		DBType:     "sqlite",
+		Dimensions: len(embedTokens),
+		Embedder:   embedder,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+	ctx := context.Background()
+
+	if _, err := idx.Index(ctx, IndexOptions{}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+
+	search := func(snippet, path string) []embedding.CacheSearchResult {
+		t.Helper()
+		results, err := idx.SearchByExample(ctx, snippet, path, embedding.CacheSearchOptions{Limit: 3})
+		if err != nil {
+			t.Fatalf("SearchByExample() error = %v", err)
+		}
+		if len(results) == 0 {
+			t.Fatal("SearchByExample() returned no results")
+		}
+		return results
+	}
+
+	// A differently named function with the same shape
+	sum := "func Add(values []float64) float64 {\n\tvar total float64\n\tfor _, v := range values {\n\t\ttotal += v\n\t}\n\treturn total\n}\n"
+	if got := search(sum, "snippet.go"); got[0].Path != "math.go" || got[0].NodeName != "Total" {
+		t.Errorf("summing snippet matched %s %s, want math.go Total", got[0].Path, got[0].NodeName)
+	}
+	get := "func load(u string) error {\n\tr, err := http.Get(u)\n\tif err != nil {\n\t\treturn err\n\t}\n\treturn r.Body.Close()\n}\n"
+	if got := search(get, "snippet.go"); got[0].Path != "fetch.go" {
+		t.Errorf("HTTP snippet matched %s, want fetch.go", got[0].Path)
+	}
+
+	// The snippet is embedded as chunked code, not as a raw query
+	last := embedder.texts[len(embedder.texts)-1]
+	if !strings.HasPrefix(last, "func load") {
+		t.Errorf("embedded %q, want the snippet's function chunk", last)
+	}
+
+	// Code already in the index reuses its cached vector
+	embedded := len(embedder.texts)
+	if got := search(total, "snippet.go"); got[0].Path != "math.go" || got[0].Score < 0.999 {
+		t.Errorf("indexed function matched %s with score %v, want math.go exactly", got[0].Path, got[0].Score)
+	}
+	if len(embedder.texts) != embedded {
+		t.Errorf("searching with indexed code embedded %d texts, want 0", len(embedder.texts)-embedded)
+	}
+
+	// Several functions are pooled into one query
+	got := search(sum+"\n"+get, "snippet.go")
+	if len(got) < 2 || got[0].Path == "order.go" || got[1].Path == "order.go" {
+		t.Errorf("pooled snippet results = %+v, want math.go and fetch.go first", got)
+	}
+
+	if _, err := idx.SearchByExample(ctx, "  \n", "snippet.go", embedding.CacheSearchOptions{}); err == nil {
+		t.Error("SearchByExample() with an empty snippet succeeded")
+	}
+}
+
+func TestIndexer_SharedResultCache(t *testing.T) {
+	repo := writeRepo(t, map[string]string{
+		"math.go": "package a\n\nfunc Total(xs []int) int {\n\tsum := 0\n\tfor _, x := range xs {\n\t\tsum += x\n\t}\n\treturn sum\n}\n",
+	})
+	results := embedding.NewResultCache(8, time.Minute)
+	open := func() *Indexer {
+		t.Helper()
+		idx, err := New(repo, &Config{
+			DBType:      "sqlite",
+			Dimensions:  len(embedTokens),
+			Embedder:    &tokenEmbedder{},
+			ResultCache: results,
+		})
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		t.Cleanup(func() { idx.Close() })
+		return idx
+	}
+	ctx := context.Background()
+
+	first := open()
+	if _, err := first.Index(ctx, IndexOptions{}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	snippet := "func Add(values []int) int {\n\tn := 0\n\tfor _, v := range values {\n\t\tn += v\n\t}\n\treturn n\n}\n"
+	opts := embedding.CacheSearchOptions{Limit: 3}
+	if _, err := first.SearchByExample(ctx, snippet, "snippet.go", opts); err != nil {
+		t.Fatalf("SearchByExample() error = %v", err)
+	}
+
+	// An indexer opened later, like one per MCP call, reuses the results
+	if _, err := open().SearchByExample(ctx, snippet, "snippet.go", opts); err != nil {
+		t.Fatalf("SearchByExample() error = %v", err)
+	}
+	if stats := results.Stats(); stats.Hits != 1 {
+		t.Errorf("result cache stats = %+v, want 1 hit", stats)
+	}
+}
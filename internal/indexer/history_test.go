@@ -0,0 +1,73 @@
+package indexer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIndexer_History(t *testing.T) {
+	repo := writeRepo(t, map[string]string{
+		"a.go": "package a\n\nfunc A() int {\n\treturn 1\n}\n",
+		"b.go": "package a\n\nfunc B() int {\n\treturn 2\n}\n",
+	})
+	idx, err := New(repo, &Config{
+		DBType:     "sqlite",
+		Dimensions: 4,
+		Embedder:   &countingEmbedder{},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+	ctx := context.Background()
+
+	index := func() *IndexResult {
+		t.Helper()
+		result, err := idx.Index(ctx, IndexOptions{})
+		if err != nil {
+			t.Fatalf("Index() error = %v", err)
+		}
+		return result
+	}
+
+	first := index()
+	// A copy of b.go is served from the cache
+	b, err := os.ReadFile(filepath.Join(repo, "b.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "c.go"), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	second := index()
+	// Runs without changes are not recorded
+	if none := index(); none.ChangeType != "none" {
+		t.Fatalf("third run ChangeType = %q, want none", none.ChangeType)
+	}
+
+	runs, err := idx.History(0)
+	if err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("History() = %+v, want 2 runs", runs)
+	}
+	for i, want := range []*IndexResult{first, second} {
+		run := runs[i]
+		if run.ChangeType != want.ChangeType || run.Files != want.FilesProcessed ||
+			run.Total != want.ChunksCreated || run.CacheHits != want.CacheHits || run.Embedded != want.ChunksEmbedded {
+			t.Errorf("run %d = %+v, want the counts of %+v", i, run, want)
+		}
+		if run.RepoRoot != idx.RepoPath() {
+			t.Errorf("run %d RepoRoot = %q", i, run.RepoRoot)
+		}
+	}
+	if runs[0].HitRate() != 0 || runs[1].HitRate() != 100 {
+		t.Errorf("hit rates = %.1f, %.1f, want 0 then 100", runs[0].HitRate(), runs[1].HitRate())
+	}
+	if runs[1].StartedAt.Before(runs[0].StartedAt) {
+		t.Error("runs are not oldest first")
+	}
+}
@@ -5,15 +5,23 @@ package indexer
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"maps"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	ignore "github.com/sabhiram/go-gitignore"
 
 	"codetect/internal/chunker"
+	"codetect/internal/config"
 	"codetect/internal/db"
 	"codetect/internal/embedding"
 	"codetect/internal/merkle"
@@ -29,22 +37,35 @@ type Indexer struct {
 	dataDir  string
 
 	// Components
-	merkleStore   *merkle.Store
+	merkleStore   merkle.TreeStore
 	merkleBuilder *merkle.Builder
+	source        ContentSource
 	astChunker    *chunker.ASTChunker
+	fileChunker   chunker.Chunker // Config.Chunker, or astChunker
 	cache         *embedding.EmbeddingCache
 	locations     *embedding.LocationStore
+	contents      *embedding.ContentStore
+	history       *embedding.RunHistory
+	models        *embedding.IndexModelStore
+	queries       *embedding.QueryLog
 	vectorIndex   embedding.VectorIndex
+	vectors       *embedding.RepoVectorIndex // Fills vectorIndex for searches; nil if not searched
 	embedder      embedding.Embedder
 	pipeline      *embedding.Pipeline
+	spaces        []embedding.ModelSpace // From ExtraModels or ExtraEmbedders
+	results       *embedding.ResultCache // Shared by Searcher(); nil if disabled
 
 	// Database
 	database db.DB
 	dialect  db.Dialect
+	ownsDB   bool // false when the connection came from Config.Database
 
 	// Configuration
 	config *Config
 	logger *slog.Logger
+
+	// treeMu guards the tree being indexed while files are read into it
+	treeMu sync.Mutex
 }
 
 // Config configures the indexer.
@@ -54,6 +75,32 @@ type Config struct {
 	DBPath string // SQLite path (for sqlite type)
 	DSN    string // PostgreSQL connection string
 
+	// SQLite lock wait in milliseconds (0 = db.DefaultBusyTimeout, negative = none)
+	DBBusyTimeout int
+
+	// PostgreSQL read retries after connection loss (0 = db.DefaultReadRetries,
+	// negative = none) and the delay before the first, in milliseconds
+	// (0 = db.DefaultRetryBackoff)
+	DBReadRetries  int
+	DBRetryBackoff int
+
+	// Database, if set, is used instead of opening a connection from the
+	// settings above. DBType must still describe it. The indexer does not
+	// close it.
+	Database db.DB
+
+	// Cache write settings (0 = embedding.DefaultWriteBatchSize / DefaultWriteWorkers)
+	CacheWriteBatchSize int // Cache entries committed per transaction
+	CacheWriteWorkers   int // Parallel cache and location write transactions (PostgreSQL only)
+
+	// LocationWriteBatchSize is how many chunk locations are committed per
+	// transaction (0 = embedding.DefaultLocationBatchSize)
+	LocationWriteBatchSize int
+
+	// CacheEncoding is how new cache entries store vectors on SQLite (""
+	// = embedding.CacheEncodingJSON); see EmbeddingCache.SetEncoding
+	CacheEncoding string
+
 	// Embedding settings
 	EmbeddingProvider string // "ollama", "litellm", or "off"
 	EmbeddingModel    string // Model name
@@ -61,15 +108,220 @@ type Config struct {
 	OllamaURL         string // Ollama API URL
 	LiteLLMURL        string // LiteLLM API URL
 	LiteLLMKey        string // LiteLLM API key
+	EmbeddingCompress bool   // Gzip embedding request bodies (see embedding.ProviderConfig.Compress)
+
+	// EmbeddingFallback, if set, is a provider used when the one above is
+	// unavailable or fails (see embedding.FallbackEmbedder). Its vectors
+	// must have the same dimensions.
+	EmbeddingFallback *embedding.ProviderConfig
+
+	// Embedder, if set, is used instead of creating one from the settings
+	// above.
+	Embedder embedding.Embedder
+
+	// ExtraModels are models, besides EmbeddingModel, that every chunk is
+	// also embedded with, from the same provider, so each can be searched
+	// on its own for comparison (see embedding.ModelSpace and
+	// CacheSearchOptions.Model)
+	ExtraModels []string
+
+	// ExtraEmbedders, if set, are used instead of creating embedders for
+	// ExtraModels.
+	ExtraEmbedders []embedding.Embedder
+
+	// Logger, if set, receives the indexer's and its pipeline's logs
+	// instead of slog.Default(). Wrap a custom slog.Handler with slog.New.
+	Logger *slog.Logger
 
 	// Pipeline settings
 	BatchSize  int // Batch size for embedding API calls
 	MaxWorkers int // Max concurrent embedding workers
 
+	// Concurrency, if positive, overlaps chunking and embedding: files are
+	// chunked on up to Concurrency workers and their chunks embedded as
+	// soon as a batch of them is ready, with chunking and embedding sharing
+	// the Concurrency slots. 0 chunks each batch of files before embedding it.
+	Concurrency int
+
+	// Chunking settings
+	StripComments     bool                     // Embed chunks with comments removed (stored content unchanged)
+	FileEmbeddings    bool                     // Also store a pooled file-level embedding per file
+	LanguageMap       []config.LanguageMapping // Pattern-to-language overrides checked before extensions
+	SkipNonSource     bool                     // Skip files over MaxFileSize, binary and generated files (see SkipFilter)
+	MaxFileSize       int64                    // Size limit of SkipNonSource (0 = DefaultMaxFileSize, negative = no limit)
+	MaxEmbedBytes     int                      // Truncate embedder input per chunk (0 = no limit)
+	SubChunkLines     int                      // Split large nodes into sub-chunks of about this many lines (0 = off)
+	NeighborContext   bool                     // Embed each chunk with its neighbors' signatures
+	QualifiedNames    bool                     // Embed each chunk with its qualified symbol name
+	EmbedPaths        bool                     // Embed each chunk with its repo-relative path
+	DescribeDataFiles bool                     // Embed config/data file chunks by a key summary instead of raw text
+
+	// SkipTrivialChunks drops chunks chunker.IsTrivial classifies as
+	// trivial, such as getters and setters, from the index. With
+	// TrivialChunkLocations they keep a location but are not embedded.
+	SkipTrivialChunks     bool
+	TrivialChunkLocations bool
+
+	// ExportedOnly lists languages whose files are indexed by their
+	// public symbols only (see chunker.FilterExported).
+	ExportedOnly []string
+
+	// MaxChunkSize, MaxChunkSizes, SkipGaps and SplitNodes override the
+	// AST chunker's defaults (see chunker.ASTChunker); zero values keep
+	// them.
+	MaxChunkSize  int
+	MaxChunkSizes map[string]int
+	SkipGaps      bool
+	SplitNodes    map[string][]string
+
+	// ExcludeTests skips test files (see IsTestFile) before chunking.
+	ExcludeTests bool
+
+	// LeadingComments extends chunks over the comments and decorators
+	// directly before them, separated by at most LeadingCommentGap blank
+	// lines (see chunker.ASTChunker.IncludeLeadingComments).
+	LeadingComments   bool
+	LeadingCommentGap int
+
+	// SplitOversized indexes nodes larger than the maximum chunk size only
+	// as their parts (see chunker.ASTChunker.SplitOversized).
+	SplitOversized bool
+
+	// MaxChunkTokens splits chunks estimated at more tokens into parts,
+	// using TokenEstimator or a heuristic if it is nil (see
+	// chunker.ASTChunker.MaxTokens). 0 disables the limit.
+	MaxChunkTokens int
+	TokenEstimator chunker.TokenEstimator
+
+	// SplitNestedFunctions lists languages whose named functions nested
+	// in other functions are always chunks of their own (see
+	// chunker.ASTChunker.SplitNestedFunctions).
+	SplitNestedFunctions []string
+
+	// Chunker, if set, splits files into chunks instead of an ASTChunker
+	// configured by the settings above; StripComments, SubChunkLines,
+	// NeighborContext, LanguageMap, MaxChunkSize, MaxChunkSizes,
+	// SkipGaps, SplitNodes, LeadingComments, SplitOversized,
+	// MaxChunkTokens and SplitNestedFunctions then have no effect on
+	// chunking.
+	// Its chunks' NodeType, NodeName and QualifiedName are recorded as
+	// for AST chunks.
+	Chunker chunker.Chunker
+
+	// Summarizer, if set, describes chunks to embed instead of their raw
+	// text (see embedding.Summarizer). It takes precedence over
+	// DescribeDataFiles.
+	Summarizer embedding.Summarizer
+
+	// ChunkMetadata, if set, returns metadata recorded on the locations of
+	// a repo-relative file's chunks, such as an owning team derived from
+	// CODEOWNERS. Searches can filter on it (see embedding.ChunkLocation).
+	ChunkMetadata func(relPath string) map[string]string
+
+	// IndexedMetadataKeys selects metadata keys to index for fast filtering
+	// (see embedding.LocationStore.SetIndexedMetadataKeys). Nil keeps the
+	// selection already stored in the database.
+	IndexedMetadataKeys []string
+
+	// Search settings
+	DistanceMetric  string        // "cosine" (default), "euclidean" or "dot_product"
+	ResultCacheSize int           // Cached queries for Searcher() (0 disables the cache)
+	ResultCacheTTL  time.Duration // Lifetime of cached results
+	QueryLog        string        // LogQuery mode: "" (off), "hashed" or "raw"; see embedding.QueryLogRaw
+
+	// ResultCache, if set, is used by Searcher() instead of a cache of
+	// ResultCacheSize, so indexers opened per request can share results
+	ResultCache *embedding.ResultCache
+
+	// HNSW configures the vector index, which searches by brute force
+	// until it holds HNSW.MinVectors vectors and is then promoted to a
+	// native index (see embedding.ThresholdVectorIndex). Indexing fills it
+	// and Searcher() takes its candidates from it. The zero value means
+	// config.DefaultHNSWConfig(); DistanceMetric, if set, takes precedence
+	// over HNSW.DistanceMetric
+	HNSW config.HNSWConfig
+
+	// NativeVectorIndex, if set, builds the native index instead of
+	// embedding.NewCacheVectorIndex.
+	NativeVectorIndex func() (embedding.VectorIndex, error)
+
+	// VectorIndex selects the vector index built: config.VectorIndexHNSW
+	// (the default when empty) or config.VectorIndexPQ, a PQ-compressed
+	// index configured by PQ (zero value = config.DefaultPQConfig()).
+	// The PQ index is trained once a repo has PQ.Centroids vectors; from
+	// then on Searcher() takes its candidates from it and re-ranks them
+	// against the embedding cache
+	VectorIndex string
+	PQ          config.PQConfig
+
+	// ShardByRepo splits the vector index into one brute-force shard per
+	// repository (see embedding.ShardedVectorIndex), so a search of one
+	// repo in a shared database scans only its vectors. The shards replace
+	// the native HNSW index, and VectorIndex "pq" is rejected since its
+	// codes keep every repository in one table
+	ShardByRepo bool
+
+	// Source, if set, supplies the content to index instead of the files
+	// under the repository path, which then only holds the index state
+	// and identifies the repository in the location store. The ignore
+	// and hidden directory settings below apply to files only.
+	Source ContentSource
+
 	// Ignore patterns (from .gitignore)
 	IgnorePatterns []string
+
+	// ForceIncludeDirs are repo-relative directories indexed even when
+	// IgnorePatterns or the built-in exclusions would skip them
+	ForceIncludeDirs []string
+
+	// IncludeHiddenDirs are repo-relative hidden directories indexed like
+	// ordinary ones; IgnorePatterns still apply inside them
+	IncludeHiddenDirs []string
+
+	// TrackRenames makes Index move the locations of a file moved with
+	// unchanged content, keeping their creation times, instead of deleting
+	// and reindexing it, when the move cannot change how it is chunked
+	TrackRenames bool
+
+	// StoreContent stores the compressed content of every chunk in the
+	// database, so ReadLines and Snippet serve indexed text even after the
+	// source has moved or changed. Off by default for its storage cost
+	StoreContent bool
+
+	// ChunkDeltas makes Index update the locations of a changed file to
+	// the delta from its new chunks, leaving unchanged rows in place and
+	// deleting those of removed chunks (see embedding.WithChunkDeltas).
+	// Off by default, when rows of removed chunks are kept until the file
+	// is deleted
+	ChunkDeltas bool
+
+	// MaxEmbeddings makes Index and EmbedMissing fail with an
+	// *embedding.BudgetError, before embedding anything, when more new
+	// embeddings than this would be needed. 0 means no limit
+	MaxEmbeddings int
+
+	// HashAlgo names the merkle.Hasher change detection hashes files
+	// with: merkle.HashSHA256 (the default when empty) or
+	// merkle.HashBLAKE3. Changing it reindexes every file once
+	HashAlgo string
+
+	// MerkleStore is where the tree of the last run is kept:
+	// MerkleStoreFile (the default when empty) in the data directory, or
+	// MerkleStoreDB in the index database
+	MerkleStore string
+
+	// MerkleBackups is how many previous trees a MerkleStoreFile store
+	// keeps as backups (see merkle.Store.SetBackupDepth). 0 means
+	// merkle.DefaultBackupDepth
+	MerkleBackups int
 }
 
+// Merkle tree stores, see Config.MerkleStore.
+const (
+	MerkleStoreFile = "file"
+	MerkleStoreDB   = "db"
+)
+
 // DefaultConfig returns the default indexer configuration.
 func DefaultConfig() *Config {
 	return &Config{
@@ -84,13 +336,85 @@ func DefaultConfig() *Config {
 	}
 }
 
+// ApplyChunking sets the chunking settings of c from chunkCfg.
+func (c *Config) ApplyChunking(chunkCfg config.ChunkingConfig) {
+	c.StripComments = chunkCfg.StripComments
+	c.LanguageMap = chunkCfg.LanguageMap
+	c.MaxEmbedBytes = chunkCfg.MaxEmbedBytes
+	c.SubChunkLines = chunkCfg.SubChunkLines
+	c.NeighborContext = chunkCfg.NeighborContext
+	c.QualifiedNames = chunkCfg.QualifiedNames
+	c.EmbedPaths = chunkCfg.EmbedPaths
+	c.DescribeDataFiles = chunkCfg.DescribeDataFiles
+	c.SkipTrivialChunks = chunkCfg.SkipTrivialChunks
+	c.TrivialChunkLocations = chunkCfg.TrivialChunkLocations
+	c.ExportedOnly = chunkCfg.ExportedOnly
+	c.MaxChunkSize = chunkCfg.MaxChunkSize
+	c.MaxChunkSizes = chunkCfg.MaxChunkSizes
+	c.SkipGaps = chunkCfg.SkipGaps
+	c.SplitNodes = chunkCfg.SplitNodes
+	c.ExcludeTests = chunkCfg.ExcludeTests
+	c.LeadingComments = chunkCfg.LeadingComments
+	c.LeadingCommentGap = chunkCfg.LeadingCommentGap
+	c.SplitOversized = chunkCfg.SplitOversized
+	c.MaxChunkTokens = chunkCfg.MaxChunkTokens
+	c.SplitNestedFunctions = chunkCfg.SplitNestedFunctions
+}
+
+// LoadChunking sets the chunking settings of c from the chunk profile of
+// the repo at repoRoot and the chunking variables (see
+// config.LoadChunkingConfig).
+func (c *Config) LoadChunking(repoRoot string) error {
+	chunkCfg, err := config.LoadChunkingConfig(repoRoot)
+	if err != nil {
+		return err
+	}
+	c.ApplyChunking(chunkCfg)
+	return nil
+}
+
+// ApplyMetadata makes c tag chunks by metaCfg's rules and index the
+// metadata keys it selects.
+func (c *Config) ApplyMetadata(metaCfg config.MetadataConfig) {
+	if len(metaCfg.Rules) > 0 {
+		rules := metaCfg.Rules
+		c.ChunkMetadata = func(relPath string) map[string]string {
+			var tags map[string]string
+			for _, rule := range rules {
+				if !matchesAnyGlob(rule.Paths, relPath) {
+					continue
+				}
+				if tags == nil {
+					tags = make(map[string]string, len(rule.Tags))
+				}
+				maps.Copy(tags, rule.Tags)
+			}
+			return tags
+		}
+	}
+	if metaCfg.IndexedKeys != nil {
+		c.IndexedMetadataKeys = metaCfg.IndexedKeys
+	}
+}
+
+// LoadMetadata sets the chunk metadata settings of c from the repo config
+// file of the repository at repoRoot (see config.LoadMetadataConfig).
+func (c *Config) LoadMetadata(repoRoot string) error {
+	metaCfg, err := config.LoadMetadataConfig(repoRoot)
+	if err != nil {
+		return err
+	}
+	c.ApplyMetadata(metaCfg)
+	return nil
+}
+
 // New creates a new v2 indexer.
 func New(repoPath string, cfg *Config) (*Indexer, error) {
 	if cfg == nil {
 		cfg = DefaultConfig()
 	}
 
-	absPath, err := filepath.Abs(repoPath)
+	absPath, err := config.NormalizeRepoRoot(repoPath)
 	if err != nil {
 		return nil, fmt.Errorf("resolving path: %w", err)
 	}
@@ -106,6 +430,9 @@ func New(repoPath string, cfg *Config) (*Indexer, error) {
 		config:   cfg,
 		logger:   slog.Default(),
 	}
+	if cfg.Logger != nil {
+		idx.logger = cfg.Logger
+	}
 
 	// Initialize database
 	if err := idx.initDatabase(); err != nil {
@@ -118,55 +445,136 @@ func New(repoPath string, cfg *Config) (*Indexer, error) {
 		return nil, fmt.Errorf("initializing components: %w", err)
 	}
 
+	// Earlier versions keyed the index by the plain absolute path
+	if legacyRoot, err := filepath.Abs(repoPath); err == nil && legacyRoot != absPath {
+		if err := idx.migrateRepoRoot(legacyRoot); err != nil {
+			idx.Close()
+			return nil, fmt.Errorf("migrating repository root: %w", err)
+		}
+	}
+
 	return idx, nil
 }
 
 // initDatabase opens the database connection.
 func (idx *Indexer) initDatabase() error {
+	idx.dialect = db.GetDialect(idx.config.databaseType())
+	if idx.config.Database != nil {
+		idx.database = idx.config.Database
+		return nil
+	}
+
+	database, err := openDatabase(idx.config, idx.dataDir)
+	if err != nil {
+		return err
+	}
+	idx.database = database
+	idx.ownsDB = true
+	return nil
+}
+
+// databaseType maps DBType to the db package's type.
+func (cfg *Config) databaseType() db.DatabaseType {
+	if cfg.DBType == "postgres" {
+		return db.DatabasePostgres
+	}
+	return db.DatabaseSQLite
+}
+
+// openDatabase opens the database described by cfg. A SQLite database
+// without DBPath lives in dataDir.
+func openDatabase(cfg *Config, dataDir string) (db.DB, error) {
 	var dbCfg db.Config
 
-	switch idx.config.DBType {
-	case "postgres":
+	switch cfg.databaseType() {
+	case db.DatabasePostgres:
 		dbCfg = db.Config{
-			Type: db.DatabasePostgres,
-			DSN:  idx.config.DSN,
+			Type:         db.DatabasePostgres,
+			DSN:          cfg.DSN,
+			ReadRetries:  cfg.DBReadRetries,
+			RetryBackoff: cfg.DBRetryBackoff,
 		}
 	default:
-		dbPath := idx.config.DBPath
+		dbPath := cfg.DBPath
 		if dbPath == "" {
-			dbPath = filepath.Join(idx.dataDir, "index.db")
-		}
-		dbCfg = db.Config{
-			Type: db.DatabaseSQLite,
-			Path: dbPath,
+			dbPath = filepath.Join(dataDir, "index.db")
 		}
+		dbCfg = db.DefaultConfig(dbPath)
+		dbCfg.BusyTimeout = cfg.DBBusyTimeout
 	}
 
 	database, err := db.Open(dbCfg)
 	if err != nil {
-		return fmt.Errorf("opening database: %w", err)
+		return nil, fmt.Errorf("opening database: %w", err)
 	}
-
-	idx.database = database
-	idx.dialect = db.GetDialect(dbCfg.Type)
-	return nil
+	return database, nil
 }
 
 // initComponents initializes all pipeline components.
 func (idx *Indexer) initComponents() error {
 	// Merkle tree components
-	idx.merkleStore = merkle.NewStore(idx.dataDir)
+	switch idx.config.MerkleStore {
+	case "", MerkleStoreFile:
+		store := merkle.NewStore(idx.dataDir)
+		if idx.config.MerkleBackups > 0 {
+			store.SetBackupDepth(idx.config.MerkleBackups)
+		}
+		idx.merkleStore = store
+	case MerkleStoreDB:
+		store, err := merkle.NewDBStore(idx.database, idx.dialect, idx.repoPath)
+		if err != nil {
+			return fmt.Errorf("creating merkle store: %w", err)
+		}
+		idx.merkleStore = store
+	default:
+		return fmt.Errorf("unknown merkle store %q", idx.config.MerkleStore)
+	}
 	idx.merkleBuilder = merkle.NewBuilder()
-	// Add any additional ignore patterns
-	if len(idx.config.IgnorePatterns) > 0 {
-		idx.merkleBuilder.IgnorePatterns = append(
-			idx.merkleBuilder.IgnorePatterns,
-			idx.config.IgnorePatterns...,
-		)
+	// Add any additional ignore patterns. The builder matches names, so
+	// directory-only patterns like "generated/" lose their trailing slash.
+	for _, p := range idx.config.IgnorePatterns {
+		idx.merkleBuilder.IgnorePatterns = append(idx.merkleBuilder.IgnorePatterns, strings.TrimSuffix(p, "/"))
+	}
+	idx.merkleBuilder.ForceInclude = idx.config.ForceIncludeDirs
+	idx.merkleBuilder.IncludeHiddenDirs = idx.config.IncludeHiddenDirs
+	idx.merkleBuilder.Hasher = merkle.HasherFor(idx.config.HashAlgo)
+	if idx.merkleBuilder.Hasher == nil {
+		return fmt.Errorf("unknown hash algorithm %q", idx.config.HashAlgo)
+	}
+
+	idx.source = idx.config.Source
+	if idx.source == nil {
+		idx.source = NewFileSource(idx.repoPath, idx.merkleBuilder)
 	}
 
 	// AST chunker
 	idx.astChunker = chunker.NewASTChunker()
+	idx.astChunker.StripComments = idx.config.StripComments
+	idx.astChunker.SubChunkLines = idx.config.SubChunkLines
+	idx.astChunker.NeighborContext = idx.config.NeighborContext
+	idx.astChunker.MaxChunkSize = idx.config.MaxChunkSize
+	idx.astChunker.MaxChunkSizes = idx.config.MaxChunkSizes
+	idx.astChunker.SkipGaps = idx.config.SkipGaps
+	idx.astChunker.SplitNodes = idx.config.SplitNodes
+	idx.astChunker.IncludeLeadingComments = idx.config.LeadingComments
+	idx.astChunker.LeadingCommentGap = idx.config.LeadingCommentGap
+	idx.astChunker.SplitOversized = idx.config.SplitOversized
+	idx.astChunker.MaxTokens = idx.config.MaxChunkTokens
+	idx.astChunker.TokenEstimator = idx.config.TokenEstimator
+	idx.astChunker.SplitNestedFunctions = idx.config.SplitNestedFunctions
+	for _, m := range idx.config.LanguageMap {
+		if chunker.GetLanguageConfigByName(m.Language) == nil {
+			idx.logger.Warn("ignoring language mapping for unsupported language",
+				"pattern", m.Pattern, "language", m.Language)
+			continue
+		}
+		idx.astChunker.LanguageOverrides = append(idx.astChunker.LanguageOverrides,
+			chunker.LanguageOverride{Pattern: m.Pattern, Language: m.Language})
+	}
+	idx.fileChunker = idx.config.Chunker
+	if idx.fileChunker == nil {
+		idx.fileChunker = idx.astChunker
+	}
 
 	// Embedding cache and locations
 	var err error
@@ -179,25 +587,59 @@ func (idx *Indexer) initComponents() error {
 	if err != nil {
 		return fmt.Errorf("creating embedding cache: %w", err)
 	}
+	idx.cache.SetWriteConcurrency(idx.config.CacheWriteBatchSize, idx.config.CacheWriteWorkers)
+	if err := idx.cache.SetEncoding(embedding.CacheEncoding(idx.config.CacheEncoding)); err != nil {
+		return fmt.Errorf("creating embedding cache: %w", err)
+	}
 
 	idx.locations, err = embedding.NewLocationStore(idx.database, idx.dialect)
 	if err != nil {
 		return fmt.Errorf("creating location store: %w", err)
 	}
+	idx.locations.SetWriteConcurrency(idx.config.LocationWriteBatchSize, idx.config.CacheWriteWorkers)
+	if idx.config.IndexedMetadataKeys != nil {
+		if err := idx.locations.SetIndexedMetadataKeys(idx.config.IndexedMetadataKeys); err != nil {
+			return fmt.Errorf("indexing metadata keys: %w", err)
+		}
+	}
+
+	// Chunk content is always readable, but only stored when configured
+	idx.contents, err = embedding.NewContentStore(idx.database, idx.dialect)
+	if err != nil {
+		return fmt.Errorf("creating content store: %w", err)
+	}
+	var contentStore *embedding.ContentStore
+	if idx.config.StoreContent {
+		contentStore = idx.contents
+	}
 
-	// Vector index (create brute force as fallback)
-	// The NewBruteForceVectorIndex needs an EmbeddingStore, but we can skip it
-	// for now since vector index is optional
-	idx.vectorIndex = nil // Will be initialized when needed
+	idx.history, err = embedding.NewRunHistory(idx.database, idx.dialect)
+	if err != nil {
+		return fmt.Errorf("creating run history: %w", err)
+	}
+	idx.models, err = embedding.NewIndexModelStore(idx.database, idx.dialect)
+	if err != nil {
+		return fmt.Errorf("creating index model store: %w", err)
+	}
+	idx.queries, err = embedding.NewQueryLog(idx.database, idx.dialect)
+	if err != nil {
+		return fmt.Errorf("creating query log: %w", err)
+	}
 
-	// Embedder (if enabled)
-	if idx.config.EmbeddingProvider != "off" {
-		idx.embedder, err = idx.createEmbedder()
-		if err != nil {
-			return fmt.Errorf("creating embedder: %w", err)
-		}
-	} else {
-		idx.embedder = &embedding.NullEmbedder{}
+	// Vector index, brute force until it holds HNSW.MinVectors vectors
+	idx.vectorIndex, err = idx.newVectorIndex()
+	if err != nil {
+		return fmt.Errorf("creating vector index: %w", err)
+	}
+	idx.vectors = embedding.NewRepoVectorIndex(idx.vectorIndex, idx.cache, idx.locations)
+
+	// Embedder
+	idx.embedder, err = newEmbedder(idx.config)
+	if err != nil {
+		return err
+	}
+	if err := idx.initModelSpaces(); err != nil {
+		return err
 	}
 
 	// Create pipeline
@@ -206,88 +648,294 @@ func (idx *Indexer) initComponents() error {
 		idx.locations,
 		idx.embedder,
 		embedding.WithBatchSize(idx.config.BatchSize),
+		embedding.WithMetric(embedding.MetricFromConfig(idx.config.DistanceMetric)),
 		embedding.WithMaxWorkers(idx.config.MaxWorkers),
+		embedding.WithFileEmbeddings(idx.config.FileEmbeddings),
+		embedding.WithMaxInputBytes(idx.config.MaxEmbedBytes),
+		embedding.WithMaxEmbeddings(idx.config.MaxEmbeddings),
+		embedding.WithLogger(idx.logger),
+		embedding.WithModelSpaces(idx.spaces...),
+		embedding.WithContentStore(contentStore),
+		embedding.WithChunkDeltas(idx.config.ChunkDeltas),
 	)
 
+	switch {
+	case idx.config.ResultCache != nil:
+		idx.results = idx.config.ResultCache
+	case idx.config.ResultCacheSize > 0:
+		idx.results = embedding.NewResultCache(idx.config.ResultCacheSize, idx.config.ResultCacheTTL)
+	}
+
 	return nil
 }
 
-// createEmbedder creates the appropriate embedder based on configuration.
-func (idx *Indexer) createEmbedder() (embedding.Embedder, error) {
-	cfg := embedding.ProviderConfig{
-		Model:      idx.config.EmbeddingModel,
-		OllamaURL:  idx.config.OllamaURL,
-		LiteLLMURL: idx.config.LiteLLMURL,
-		LiteLLMKey: idx.config.LiteLLMKey,
+// newEmbedder returns cfg.Embedder if set, a NullEmbedder if embedding is
+// off, or a new embedder for the configured provider.
+func newEmbedder(cfg *Config) (embedding.Embedder, error) {
+	if cfg.Embedder != nil {
+		return cfg.Embedder, nil
+	}
+	if cfg.EmbeddingProvider == "off" {
+		return &embedding.NullEmbedder{}, nil
+	}
+
+	providerCfg := embedding.ProviderConfig{
+		Model:      cfg.EmbeddingModel,
+		OllamaURL:  cfg.OllamaURL,
+		LiteLLMURL: cfg.LiteLLMURL,
+		LiteLLMKey: cfg.LiteLLMKey,
+		Compress:   cfg.EmbeddingCompress,
+		Fallback:   cfg.EmbeddingFallback,
 	}
 
-	switch idx.config.EmbeddingProvider {
+	switch cfg.EmbeddingProvider {
 	case "ollama":
-		cfg.Provider = embedding.ProviderOllama
+		providerCfg.Provider = embedding.ProviderOllama
 	case "litellm":
-		cfg.Provider = embedding.ProviderLiteLLM
+		providerCfg.Provider = embedding.ProviderLiteLLM
 	default:
-		cfg.Provider = embedding.ProviderOff
+		providerCfg.Provider = embedding.ProviderOff
+	}
+
+	embedder, err := embedding.NewEmbedder(providerCfg)
+	if err != nil {
+		return nil, fmt.Errorf("creating embedder: %w", err)
 	}
+	if fallback, ok := embedder.(*embedding.FallbackEmbedder); ok {
+		fallback.SetLogger(cfg.Logger)
+	}
+	return embedder, nil
+}
 
-	return embedding.NewEmbedder(cfg)
+// initModelSpaces creates a model space for each extra model.
+func (idx *Indexer) initModelSpaces() error {
+	embedders := idx.config.ExtraEmbedders
+	if embedders == nil {
+		for _, model := range idx.config.ExtraModels {
+			cfg := *idx.config
+			cfg.EmbeddingModel = model
+			cfg.EmbeddingFallback = nil
+			cfg.Embedder = nil
+			embedder, err := newEmbedder(&cfg)
+			if err != nil {
+				return fmt.Errorf("model %s: %w", model, err)
+			}
+			embedders = append(embedders, embedder)
+		}
+	}
+
+	for _, embedder := range embedders {
+		space, err := embedding.NewModelSpace(idx.database, idx.dialect, embedder)
+		if err != nil {
+			return err
+		}
+		idx.spaces = append(idx.spaces, space)
+	}
+	return nil
+}
+
+// Models returns the names of the models whose vectors can be searched:
+// the primary model, then any extra models.
+func (idx *Indexer) Models() []string {
+	models := []string{idx.cache.Model()}
+	for _, space := range idx.spaces {
+		models = append(models, space.Model)
+	}
+	return models
 }
 
-// Close releases all resources.
+// Close waits for the pipeline's pending writes and releases all
+// resources. It returns every error met on the way, joined.
 func (idx *Indexer) Close() error {
-	if idx.database != nil {
-		return idx.database.Close()
+	var errs []error
+	if idx.pipeline != nil {
+		if err := idx.pipeline.Close(context.Background()); err != nil {
+			errs = append(errs, fmt.Errorf("closing pipeline: %w", err))
+		}
 	}
-	return nil
+	if idx.cache != nil {
+		if err := idx.cache.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("closing cache: %w", err))
+		}
+	}
+	for _, space := range idx.spaces {
+		if err := space.Cache.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("closing %s cache: %w", space.Model, err))
+		}
+	}
+	if idx.database != nil && idx.ownsDB {
+		if err := idx.database.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("closing database: %w", err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // IndexOptions configures the index operation.
 type IndexOptions struct {
-	Force   bool // Force full reindex
-	Verbose bool // Enable verbose logging
+	Force         bool // Force full reindex
+	Verbose       bool // Enable verbose logging
+	ReportSkipped bool // Classify every skipped file in the repo into IndexResult.Skipped
+
+	// ReportCoverage fills in IndexResult.Coverage after the run
+	ReportCoverage bool
+
+	// AlwaysEmbed lists globs of files to reindex and re-embed on every
+	// run, changed or not, replacing their cached embeddings (see
+	// embedding.Chunk.Refresh). Globs without a "/" match the file name,
+	// others the repo-relative path; "dir/**" matches everything under dir.
+	AlwaysEmbed []string
 }
 
 // IndexResult contains statistics from an index operation.
 type IndexResult struct {
-	FilesProcessed int           `json:"files_processed"`
-	FilesDeleted   int           `json:"files_deleted"`
-	ChunksCreated  int           `json:"chunks_created"`
-	CacheHits      int           `json:"cache_hits"`
-	ChunksEmbedded int           `json:"chunks_embedded"`
-	Duration       time.Duration `json:"duration"`
-	ChangeType     string        `json:"change_type"` // "full", "incremental", "none"
+	FilesProcessed int             `json:"files_processed"`
+	FilesDeleted   int             `json:"files_deleted"`
+	FilesRenamed   int             `json:"files_renamed,omitempty"`   // Moved without reindexing, see Config.TrackRenames
+	FilesRefreshed int             `json:"files_refreshed,omitempty"` // Matched IndexOptions.AlwaysEmbed
+	FilesSkipped   int             `json:"files_skipped,omitempty"`   // Changed files left out, see SkipFilter
+	ChunksCreated  int             `json:"chunks_created"`
+	CacheHits      int             `json:"cache_hits"`
+	ChunksEmbedded int             `json:"chunks_embedded"`
+	Duration       time.Duration   `json:"duration"`
+	ChangeType     string          `json:"change_type"` // "full", "incremental", "none"
+	FastPath       bool            `json:"fast_path"`   // "none" decided by stat scan, without rebuilding the tree
+	Skipped        *SkipReport     `json:"skipped,omitempty"`
+	Coverage       *CoverageReport `json:"coverage,omitempty"` // See IndexOptions.ReportCoverage
+
+	// Latency and throughput of embedding backend requests; nil if nothing
+	// was embedded
+	EmbedRequests *embedding.RequestStats `json:"embed_requests,omitempty"`
+
+	// Files modified or deleted between change detection and being read.
+	// Changed files are indexed as read and recorded with their new hash;
+	// rescheduled ones could not be read consistently and are picked up
+	// again by the next run.
+	ChangedDuringIndex int      `json:"changed_during_index,omitempty"`
+	Rescheduled        []string `json:"rescheduled,omitempty"`
 }
 
 // Index performs incremental or full indexing.
 func (idx *Indexer) Index(ctx context.Context, opts IndexOptions) (*IndexResult, error) {
+	result, err := idx.index(ctx, opts)
+	if err != nil || !opts.ReportCoverage {
+		return result, err
+	}
+	if result.Coverage, err = idx.CoverageByLanguage(); err != nil {
+		return nil, fmt.Errorf("reporting coverage: %w", err)
+	}
+	return result, nil
+}
+
+// index is Index without the coverage report.
+func (idx *Indexer) index(ctx context.Context, opts IndexOptions) (*IndexResult, error) {
 	start := time.Now()
 	result := &IndexResult{}
+	for _, pattern := range opts.AlwaysEmbed {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid always-embed pattern %q: %w", pattern, err)
+		}
+	}
+
+	// 1. Skip the full build when a stat-only scan shows nothing changed.
+	// A skip report needs the full walk, so it disables the fast path, and
+	// other sources have nothing to stat.
+	files, onDisk := idx.source.(*FileSource)
+	var oldTree *merkle.Tree
+	if !opts.Force {
+		oldTree, _ = idx.merkleStore.Load()
+		if onDisk && !opts.ReportSkipped && len(opts.AlwaysEmbed) == 0 && oldTree != nil &&
+			oldTree.RepoPath == idx.repoPath && files.Builder.Unchanged(oldTree) {
+			result.ChangeType = "none"
+			result.FastPath = true
+			result.Duration = time.Since(start)
+			if opts.Verbose {
+				idx.logger.Info("no changes detected", "fast_path", true)
+			}
+			return result, nil
+		}
+	}
 
-	// 1. Build current Merkle tree
+	// 2. Build current Merkle tree
 	if opts.Verbose {
 		idx.logger.Info("building merkle tree", "path", idx.repoPath)
 	}
 
-	newTree, err := idx.merkleBuilder.Build(idx.repoPath)
+	if opts.ReportSkipped {
+		result.Skipped = NewSkipReport()
+	}
+
+	var newTree *merkle.Tree
+	var err error
+	if onDisk {
+		if result.Skipped != nil {
+			files.Builder.OnIgnore = idx.gitignoreRecorder(result.Skipped)
+			defer func() { files.Builder.OnIgnore = nil }()
+		}
+		// Files that look untouched since the stored tree keep their
+		// hashes; a forced run leaves oldTree nil and reads everything
+		files.Builder.PriorTree = oldTree
+		defer func() { files.Builder.PriorTree = nil }()
+		newTree, err = files.Builder.Build(files.Root)
+	} else {
+		newTree, err = idx.buildSourceTree(ctx, result.Skipped)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("building merkle tree: %w", err)
 	}
 
-	// 2. Determine what changed
+	if onDisk && result.Skipped != nil {
+		for _, path := range idx.collectAllFiles(newTree.Root) {
+			if reason := idx.checkSkip(path); reason != "" {
+				result.Skipped.Add(reason, path)
+			}
+		}
+	}
+
+	// Files to re-embed whatever the cache holds
+	var refresh map[string]bool
+	if len(opts.AlwaysEmbed) > 0 {
+		refresh = make(map[string]bool)
+		for _, path := range idx.collectAllFiles(newTree.Root) {
+			if matchesAnyGlob(opts.AlwaysEmbed, path) {
+				refresh[path] = true
+			}
+		}
+	}
+
+	// 3. Determine what changed
 	var filesToProcess []string
 	var filesToDelete []string
+	var moves []fileMove
+
+	// Hashes from another algorithm say nothing about the files, so a
+	// change of algorithm reindexes everything
+	rehashed := oldTree != nil && !oldTree.SameHashAlgo(newTree)
 
-	if opts.Force {
+	if opts.Force || rehashed {
 		result.ChangeType = "full"
 		filesToProcess = idx.collectAllFiles(newTree.Root)
-		if opts.Verbose {
+		if rehashed {
+			for _, path := range idx.collectAllFiles(oldTree.Root) {
+				if newTree.Find(path) == nil {
+					filesToDelete = append(filesToDelete, path)
+				}
+			}
+		}
+		if opts.Verbose && rehashed {
+			idx.logger.Info("hash algorithm changed",
+				"from", oldTree.HashAlgo, "to", newTree.HashAlgo,
+				"files", len(filesToProcess))
+		} else if opts.Verbose {
 			idx.logger.Info("force mode", "files", len(filesToProcess))
 		}
 	} else {
-		oldTree, _ := idx.merkleStore.Load()
-		changes := merkle.Diff(oldTree, newTree)
+		changes, err := merkle.Diff(oldTree, newTree)
+		if err != nil {
+			return nil, fmt.Errorf("comparing merkle trees: %w", err)
+		}
 
-		if changes.IsEmpty() {
+		if changes.IsEmpty() && len(refresh) == 0 {
 			result.ChangeType = "none"
 			result.Duration = time.Since(start)
 			if opts.Verbose {
@@ -297,6 +945,7 @@ func (idx *Indexer) Index(ctx context.Context, opts IndexOptions) (*IndexResult,
 		}
 
 		result.ChangeType = "incremental"
+		moves = idx.acceptMoves(newTree, changes)
 		filesToProcess = append(changes.Added, changes.Modified...)
 		filesToDelete = changes.Deleted
 
@@ -304,11 +953,34 @@ func (idx *Indexer) Index(ctx context.Context, opts IndexOptions) (*IndexResult,
 			idx.logger.Info("detected changes",
 				"added", len(changes.Added),
 				"modified", len(changes.Modified),
-				"deleted", len(changes.Deleted))
+				"deleted", len(changes.Deleted),
+				"renamed", len(moves),
+				"refreshed", len(refresh))
+		}
+	}
+
+	// Add the files to refresh that did not change
+	if len(refresh) > 0 {
+		queued := make(map[string]bool, len(filesToProcess))
+		for _, path := range filesToProcess {
+			queued[path] = true
+		}
+		for _, path := range idx.collectAllFiles(newTree.Root) {
+			if refresh[path] && !queued[path] {
+				filesToProcess = append(filesToProcess, path)
+			}
 		}
+		result.FilesRefreshed = len(refresh)
 	}
 
-	// 3. Handle deletions
+	// Refuse a run over the embedding budget before changing anything
+	if idx.config.MaxEmbeddings > 0 {
+		if err := idx.checkEmbeddingBudget(ctx, filesToProcess, refresh); err != nil {
+			return nil, err
+		}
+	}
+
+	// 4. Handle deletions
 	for _, path := range filesToDelete {
 		if err := idx.locations.DeleteByPath(idx.repoPath, path); err != nil {
 			idx.logger.Warn("failed to delete locations", "path", path, "error", err)
@@ -316,91 +988,464 @@ func (idx *Indexer) Index(ctx context.Context, opts IndexOptions) (*IndexResult,
 	}
 	result.FilesDeleted = len(filesToDelete)
 
-	// 4. Process files in batches
-	batchSize := 100
-	for i := 0; i < len(filesToProcess); i += batchSize {
-		end := i + batchSize
-		if end > len(filesToProcess) {
-			end = len(filesToProcess)
+	// Move the locations of renamed files; reindex any that fail
+	for _, m := range moves {
+		if _, err := idx.pipeline.RenameFile(idx.repoPath, m.oldPath, m.newPath); err != nil {
+			idx.logger.Warn("failed to move locations, reindexing",
+				"from", m.oldPath, "to", m.newPath, "error", err)
+			if err := idx.locations.DeleteByPath(idx.repoPath, m.oldPath); err != nil {
+				idx.logger.Warn("failed to delete locations", "path", m.oldPath, "error", err)
+			}
+			filesToProcess = append(filesToProcess, m.newPath)
+			continue
 		}
-		batch := filesToProcess[i:end]
+		result.FilesRenamed++
+	}
 
-		batchResult, err := idx.processBatch(ctx, batch, opts.Verbose)
-		if err != nil {
-			idx.logger.Warn("batch processing error", "error", err)
-			continue
+	// 5. Process files in batches, or as a stream
+	if idx.config.Concurrency > 0 {
+		result.add(idx.processStream(ctx, newTree, filesToProcess, refresh, opts.Verbose))
+	} else {
+		batchSize := 100
+		for i := 0; i < len(filesToProcess); i += batchSize {
+			end := i + batchSize
+			if end > len(filesToProcess) {
+				end = len(filesToProcess)
+			}
+			batch := filesToProcess[i:end]
+
+			batchResult, err := idx.processBatch(ctx, newTree, batch, refresh, opts.Verbose)
+			if err != nil {
+				idx.logger.Warn("batch processing error", "error", err)
+				continue
+			}
+			result.add(batchResult)
 		}
+	}
 
-		result.FilesProcessed += len(batch)
-		result.ChunksCreated += batchResult.ChunksCreated
-		result.CacheHits += batchResult.CacheHits
-		result.ChunksEmbedded += batchResult.ChunksEmbedded
+	// Drop stored content that no location refers to anymore
+	if idx.config.StoreContent {
+		if _, err := idx.contents.DeleteOrphaned(); err != nil {
+			idx.logger.Warn("failed to delete orphaned content", "error", err)
+		}
 	}
 
-	// 5. Save Merkle tree
-	if err := idx.merkleStore.Save(newTree); err != nil {
+	// 6. Save Merkle tree, backing up a file's previous tree for
+	// RestoreMerkleBackup
+	save := idx.merkleStore.Save
+	if store, ok := idx.merkleStore.(*merkle.Store); ok {
+		save = store.SaveWithBackup
+	}
+	if err := save(newTree); err != nil {
 		return nil, fmt.Errorf("saving merkle tree: %w", err)
 	}
 
 	result.Duration = time.Since(start)
+	if err := idx.history.Record(embedding.IndexRun{
+		RepoRoot:   idx.repoPath,
+		StartedAt:  start,
+		Duration:   result.Duration,
+		ChangeType: result.ChangeType,
+		Files:      result.FilesProcessed,
+		Total:      result.ChunksCreated,
+		CacheHits:  result.CacheHits,
+		Embedded:   result.ChunksEmbedded,
+	}); err != nil {
+		idx.logger.Warn("failed to record index run", "error", err)
+	}
+	idx.recordModel()
+
+	// Bring the vector index up to date with the chunks just indexed
+	if idx.vectors != nil {
+		if err := idx.vectors.Sync(ctx, idx.repoPath); err != nil {
+			idx.logger.Warn("failed to update vector index", "error", err)
+		}
+	}
 	return result, nil
 }
 
-// processBatch processes a batch of files.
-func (idx *Indexer) processBatch(ctx context.Context, files []string, verbose bool) (*IndexResult, error) {
-	result := &IndexResult{}
+// recordModel records the model the index was built with, for searches to
+// check their query embedder against (see embedding.IndexModel). A change
+// of model since the last run is logged: vectors of unchanged chunks are
+// reused from the cache, so the index then mixes both models.
+func (idx *Indexer) recordModel() {
+	if _, off := idx.embedder.(*embedding.NullEmbedder); off {
+		return
+	}
+	model, dimensions := idx.cache.Model(), idx.embedder.Dimensions()
+	if prev, err := idx.models.Get(idx.repoPath); err == nil && prev != nil && prev.Model != model {
+		idx.logger.Warn("embedding model changed since the last index run, cached vectors of unchanged chunks are from the old model; delete the index to rebuild it",
+			"old_model", prev.Model, "new_model", model)
+	}
+	if err := idx.models.Set(idx.repoPath, model, dimensions); err != nil {
+		idx.logger.Warn("failed to record index model", "error", err)
+	}
+}
 
-	// Chunk all files using AST chunker
-	var allChunks []embedding.Chunk
+// History returns the last limit runs of Index that found changes, oldest
+// first, for following the cache hit rate over time. A limit of 0 or less
+// returns all of them; see embedding.MaxRunHistory.
+func (idx *Indexer) History(limit int) ([]embedding.IndexRun, error) {
+	return idx.history.List(idx.repoPath, limit)
+}
+
+// LogQuery records a search of the repository in the query log, if
+// Config.QueryLog enables it; otherwise it does nothing. In hashed mode
+// only the HashQuery of q.Query is stored.
+func (idx *Indexer) LogQuery(q embedding.LoggedQuery) error {
+	switch idx.config.QueryLog {
+	case embedding.QueryLogRaw:
+	case embedding.QueryLogHashed:
+		q.Query, q.Hashed = embedding.HashQuery(q.Query), true
+	default:
+		return nil
+	}
+	q.RepoRoot = idx.repoPath
+	return idx.queries.Record(q)
+}
+
+// Queries summarizes the repository's limit most frequent logged queries;
+// see embedding.QueryLog.Summarize.
+func (idx *Indexer) Queries(limit int) ([]embedding.QuerySummary, error) {
+	return idx.queries.Summarize(idx.repoPath, limit)
+}
+
+// checkEmbeddingBudget chunks files and returns a *embedding.BudgetError if
+// embedding the chunks missing from the cache, and every chunk of the
+// files in refresh, would exceed MaxEmbeddings. Files that cannot be
+// chunked are not counted; processBatch skips them.
+func (idx *Indexer) checkEmbeddingBudget(ctx context.Context, files []string, refresh map[string]bool) error {
+	if _, off := idx.embedder.(*embedding.NullEmbedder); off {
+		return nil
+	}
+
+	hashSet := make(map[string]bool)
+	refreshed := make(map[string]bool)
 	for _, relPath := range files {
-		fullPath := filepath.Join(idx.repoPath, relPath)
-		content, err := os.ReadFile(fullPath)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		chunks, err := idx.chunkFile(ctx, relPath)
 		if err != nil {
-			if verbose {
-				idx.logger.Debug("skipping file", "path", relPath, "error", err)
-			}
 			continue
 		}
-
-		// Use AST chunker
-		astChunks, err := idx.astChunker.ChunkFile(ctx, relPath, content)
-		if err != nil {
-			if verbose {
-				idx.logger.Debug("chunk error", "path", relPath, "error", err)
+		for _, chunk := range chunks {
+			if chunk.Content == "" || chunk.LocationOnly {
+				continue
+			}
+			if refresh[relPath] {
+				refreshed[chunk.CacheKey()] = true
+			} else {
+				hashSet[chunk.CacheKey()] = true
 			}
-			continue
 		}
+	}
 
-		// Convert chunker.Chunk to embedding.Chunk
-		for _, ac := range astChunks {
-			allChunks = append(allChunks, embedding.Chunk{
-				Path:      ac.Path,
-				StartLine: ac.StartLine,
-				EndLine:   ac.EndLine,
-				Content:   ac.Content,
-				Kind:      ac.NodeType, // Map NodeType to Kind
-			})
+	hashes := make([]string, 0, len(hashSet))
+	for hash := range hashSet {
+		if !refreshed[hash] {
+			hashes = append(hashes, hash)
+		}
+	}
+	missing, err := idx.pipeline.MissingEmbeddings(hashes)
+	if err != nil {
+		return err
+	}
+	return idx.pipeline.CheckBudget(missing + len(refreshed))
+}
+
+// processBatch processes a batch of files from tree, re-embedding the
+// chunks of files in refresh even if cached. Files found to have changed
+// since tree was built are updated or invalidated in it, so the saved tree
+// matches what was indexed.
+func (idx *Indexer) processBatch(ctx context.Context, tree *merkle.Tree, files []string, refresh map[string]bool, verbose bool) (*IndexResult, error) {
+	result := &IndexResult{FilesProcessed: len(files)}
+
+	// Chunk all files
+	var allChunks []embedding.Chunk
+	var chunked []string
+	for _, relPath := range files {
+		f := idx.loadFile(ctx, tree, relPath, refresh[relPath])
+		allChunks = append(allChunks, idx.recordFile(tree, f, result, verbose)...)
+		if f.indexed() {
+			chunked = append(chunked, f.path)
 		}
 	}
 
 	result.ChunksCreated = len(allChunks)
 
-	if len(allChunks) == 0 {
+	if len(chunked) == 0 {
 		return result, nil
 	}
 
 	// Process through embedding pipeline
-	embedResult, err := idx.pipeline.EmbedChunks(ctx, idx.repoPath, allChunks)
+	embedResult, err := idx.pipeline.EmbedFiles(ctx, idx.repoPath, chunked, allChunks)
 	if err != nil {
 		return nil, fmt.Errorf("embedding chunks: %w", err)
 	}
 
 	result.CacheHits = embedResult.CacheHits
 	result.ChunksEmbedded = embedResult.Embedded
+	result.EmbedRequests = embedResult.Requests
 
 	return result, nil
 }
 
+// loadedFile is a file read and chunked for indexing by loadFile.
+type loadedFile struct {
+	path    string
+	chunks  []embedding.Chunk
+	changed bool  // The content read differs from the tree's
+	readErr error // The file could not be read; it is retried next run
+	err     error // The file could not be chunked
+}
+
+// indexed reports whether f was read and chunked, so its chunks, if any,
+// replace those recorded for it.
+func (f loadedFile) indexed() bool {
+	return f.readErr == nil && f.err == nil
+}
+
+// loadFile reads a file listed in tree and splits it into the chunks to
+// embed, marked to be re-embedded if refresh is set. It is safe to call
+// concurrently; recordFile handles the outcome.
+func (idx *Indexer) loadFile(ctx context.Context, tree *merkle.Tree, relPath string, refresh bool) loadedFile {
+	f := loadedFile{path: relPath}
+	var content []byte
+	content, f.changed, f.readErr = idx.readForIndex(ctx, tree, relPath)
+	if f.readErr != nil {
+		return f
+	}
+	f.chunks, f.err = idx.chunkContent(ctx, relPath, content)
+	if refresh {
+		for i := range f.chunks {
+			f.chunks[i].Refresh = true
+		}
+	}
+	return f
+}
+
+// recordFile updates result, tree and the location store for a file
+// loaded by loadFile, and returns the chunks to embed, if any.
+func (idx *Indexer) recordFile(tree *merkle.Tree, f loadedFile, result *IndexResult, verbose bool) []embedding.Chunk {
+	if f.readErr != nil {
+		// Deleted, unreadable, or still being written: leave it for the
+		// next run, which diffs against the invalidated entry
+		idx.treeMu.Lock()
+		tree.Invalidate(f.path)
+		idx.treeMu.Unlock()
+		result.Rescheduled = append(result.Rescheduled, f.path)
+		if errors.Is(f.readErr, os.ErrNotExist) {
+			if err := idx.locations.DeleteByPath(idx.repoPath, f.path); err != nil {
+				idx.logger.Warn("failed to delete locations", "path", f.path, "error", err)
+			}
+		}
+		idx.logger.Warn("file changed during indexing, will retry next run", "path", f.path, "error", f.readErr)
+		return nil
+	}
+	if f.changed {
+		result.ChangedDuringIndex++
+		idx.logger.Warn("file changed during indexing, indexing current content", "path", f.path)
+	}
+
+	if f.err != nil {
+		// Drop chunks left from before the file became unindexable
+		var skipErr *SkipError
+		if errors.As(f.err, &skipErr) {
+			result.FilesSkipped++
+			if skipErr.Reason != SkipUnparseable { // Already logged with the parse error
+				idx.logger.Info("skipping file", "path", f.path, "reason", skipErr.Reason)
+			}
+			if err := idx.locations.DeleteByPath(idx.repoPath, f.path); err != nil {
+				idx.logger.Warn("failed to delete locations", "path", f.path, "error", err)
+			}
+			return nil
+		}
+		if verbose {
+			idx.logger.Debug("skipping file", "path", f.path, "error", f.err)
+		}
+		return nil
+	}
+	return f.chunks
+}
+
+// add merges the outcome of processing a batch of files into r.
+func (r *IndexResult) add(batch *IndexResult) {
+	r.ChangedDuringIndex += batch.ChangedDuringIndex
+	r.Rescheduled = append(r.Rescheduled, batch.Rescheduled...)
+
+	r.FilesProcessed += batch.FilesProcessed
+	r.FilesSkipped += batch.FilesSkipped
+	r.ChunksCreated += batch.ChunksCreated
+	r.CacheHits += batch.CacheHits
+	r.ChunksEmbedded += batch.ChunksEmbedded
+	r.EmbedRequests = r.EmbedRequests.Merge(batch.EmbedRequests)
+}
+
+// matchesAnyGlob reports whether the repo-relative path matches one of
+// patterns, as described for IndexOptions.AlwaysEmbed.
+func matchesAnyGlob(patterns []string, relPath string) bool {
+	slashPath := filepath.ToSlash(relPath)
+	for _, pattern := range patterns {
+		if dir, ok := strings.CutSuffix(pattern, "/**"); ok {
+			if strings.HasPrefix(slashPath, dir+"/") {
+				return true
+			}
+			continue
+		}
+		target := slashPath
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(slashPath)
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// maxReadAttempts bounds how many times FileSource.Read re-reads a file
+// that is modified while being read.
+const maxReadAttempts = 3
+
+// ErrChangedDuringIndexing is returned for a file that kept changing while
+// being read for indexing.
+var ErrChangedDuringIndexing = errors.New("file changed during indexing")
+
+// readForIndex reads a repo-relative file listed in tree from the content
+// source. If the content read differs from the hash recorded when tree was
+// built, tree is updated to the content actually indexed and changed is
+// true.
+func (idx *Indexer) readForIndex(ctx context.Context, tree *merkle.Tree, relPath string) (content []byte, changed bool, err error) {
+	content, modTime, err := idx.source.Read(ctx, filepath.ToSlash(relPath))
+	if err != nil {
+		return nil, false, err
+	}
+
+	idx.treeMu.Lock()
+	defer idx.treeMu.Unlock()
+	if node := tree.Find(relPath); node != nil {
+		current := &merkle.Node{Path: relPath}
+		current.ComputeHashWith(tree.Hasher(), content)
+		if current.Hash != node.Hash {
+			tree.SetFile(relPath, content, modTime)
+			changed = true
+		}
+	}
+	return content, changed, nil
+}
+
+// chunkFile reads a repo-relative file and splits it with the chunker.
+func (idx *Indexer) chunkFile(ctx context.Context, relPath string) ([]embedding.Chunk, error) {
+	content, _, err := idx.source.Read(ctx, filepath.ToSlash(relPath))
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
+	}
+	return idx.chunkContent(ctx, relPath, content)
+}
+
+// chunkContent splits a repo-relative file's content with the chunker.
+func (idx *Indexer) chunkContent(ctx context.Context, relPath string, content []byte) ([]embedding.Chunk, error) {
+	if reason := idx.skipFilter().Check(relPath, int64(len(content)), content); reason != "" {
+		return nil, &SkipError{Path: relPath, Reason: reason}
+	}
+
+	var metadata map[string]string
+	if idx.config.ChunkMetadata != nil {
+		metadata = idx.config.ChunkMetadata(relPath)
+	}
+	return idx.chunkText(ctx, relPath, content, metadata)
+}
+
+// chunkText splits content with the chunker, which for the AST chunker
+// chooses the language by relPath, into the chunks the pipeline embeds.
+func (idx *Indexer) chunkText(ctx context.Context, relPath string, content []byte, metadata map[string]string) ([]embedding.Chunk, error) {
+	fileChunks, err := idx.fileChunker.ChunkFile(ctx, relPath, content)
+	if errors.Is(err, chunker.ErrUnparseable) {
+		// One bad file must not abort the whole run
+		idx.logger.Warn("skipping file that cannot be parsed", "path", relPath, "error", err)
+		return nil, &SkipError{Path: relPath, Reason: SkipUnparseable}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("chunking file: %w", err)
+	}
+
+	if len(fileChunks) > 0 && slices.Contains(idx.config.ExportedOnly, fileChunks[0].Language) {
+		fileChunks = chunker.FilterExported(fileChunks, content)
+	}
+
+	// Convert chunker.Chunk to embedding.Chunk
+	chunks := make([]embedding.Chunk, 0, len(fileChunks))
+	for _, ac := range fileChunks {
+		trivial := idx.config.SkipTrivialChunks && chunker.IsTrivial(ac)
+		if trivial && !idx.config.TrivialChunkLocations {
+			continue
+		}
+		chunks = append(chunks, embedding.Chunk{
+			Path:            ac.Path,
+			StartLine:       ac.StartLine,
+			EndLine:         ac.EndLine,
+			Content:         ac.Content,
+			Kind:            ac.NodeType, // Map NodeType to Kind
+			Name:            ac.NodeName,
+			EmbedContent:    ac.EmbedContent,
+			NeighborContext: ac.NeighborContext,
+			Metadata:        metadata,
+			LocationOnly:    trivial,
+		})
+		if idx.config.QualifiedNames {
+			chunks[len(chunks)-1].QualifiedName = ac.QualifiedName
+		}
+		if idx.config.EmbedPaths {
+			chunks[len(chunks)-1].PathContext = filepath.ToSlash(relPath)
+		}
+	}
+
+	if err := embedding.DescribeChunks(ctx, idx.summarizer(), chunks); err != nil {
+		return nil, err
+	}
+
+	return chunks, nil
+}
+
+// summarizer returns the configured chunk summarizer, or nil to embed raw
+// text.
+func (idx *Indexer) summarizer() embedding.Summarizer {
+	if idx.config.Summarizer != nil {
+		return idx.config.Summarizer
+	}
+	if idx.config.DescribeDataFiles {
+		return embedding.DataFileSummarizer{}
+	}
+	return nil
+}
+
+// EmbedMissing embeds chunks that have a location in this repo but no
+// entry in the embedding cache, re-chunking only the files that contain
+// them. Use it to fill gaps after cache eviction without a full reindex.
+func (idx *Indexer) EmbedMissing(ctx context.Context) (*embedding.MissingResult, error) {
+	if !idx.embedder.Available() {
+		return nil, fmt.Errorf("embedding provider %q not available", idx.embedder.ProviderID())
+	}
+
+	return idx.pipeline.EmbedMissing(ctx, idx.repoPath, func(path string) ([]embedding.Chunk, error) {
+		return idx.chunkFile(ctx, path)
+	})
+}
+
+// Coverage reports how many of this repo's chunk hashes have a cached
+// embedding and, with withHashes, which ones do not.
+func (idx *Indexer) Coverage(withHashes bool) (*embedding.EmbeddingCoverage, error) {
+	return idx.pipeline.Coverage(idx.repoPath, withHashes)
+}
+
+// ImportEmbeddings stores precomputed embeddings for this repo's chunks,
+// read from r as JSON records, without calling the embedder. See
+// embedding.Pipeline.ImportEmbeddings for the format.
+func (idx *Indexer) ImportEmbeddings(ctx context.Context, r io.Reader) (*embedding.ImportResult, error) {
+	return idx.pipeline.ImportEmbeddings(ctx, idx.repoPath, r)
+}
+
 // collectAllFiles recursively collects all file paths from a Merkle tree node.
 func (idx *Indexer) collectAllFiles(node *merkle.Node) []string {
 	var files []string
@@ -418,6 +1463,217 @@ func (idx *Indexer) collectAllFiles(node *merkle.Node) []string {
 	return files
 }
 
+// FileSymbol is a named definition recorded for an indexed file.
+type FileSymbol struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"` // AST node type, e.g. function_declaration
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	ChunkID   string `json:"chunk_id"` // Stable ID of the first chunk, see embedding.ChunkID
+}
+
+// FileSymbols returns the named definitions in a file, ordered by start
+// line, from the chunk locations written by Index. path may be absolute or
+// relative to the repository. Unnamed chunks (gaps, blocks, file-level
+// entries) are left out, and sub-chunks of one large definition are merged
+// back into a single symbol.
+func (idx *Indexer) FileSymbols(path string) ([]FileSymbol, error) {
+	relPath := path
+	if filepath.IsAbs(path) {
+		rel, err := filepath.Rel(idx.repoPath, path)
+		if err != nil {
+			return nil, fmt.Errorf("resolving path: %w", err)
+		}
+		relPath = rel
+	}
+	relPath = filepath.Clean(relPath)
+
+	locs, err := idx.locations.GetByPath(idx.repoPath, relPath)
+	if err != nil {
+		return nil, fmt.Errorf("getting locations: %w", err)
+	}
+
+	symbols := make([]FileSymbol, 0, len(locs))
+	for _, loc := range locs {
+		if loc.NodeName == "" || loc.NodeType == embedding.NodeTypeFile {
+			continue
+		}
+		if n := len(symbols); n > 0 {
+			last := &symbols[n-1]
+			if last.Name == loc.NodeName && last.Type == loc.NodeType && loc.StartLine <= last.EndLine+1 {
+				last.EndLine = max(last.EndLine, loc.EndLine)
+				continue
+			}
+		}
+		symbols = append(symbols, FileSymbol{
+			Name:      loc.NodeName,
+			Type:      loc.NodeType,
+			StartLine: loc.StartLine,
+			EndLine:   loc.EndLine,
+			ChunkID:   loc.ChunkID,
+		})
+	}
+	return symbols, nil
+}
+
+// MetadataMatcher returns a function reporting whether a line of a file
+// falls within a chunk whose metadata has every key-value pair in filter
+// (see embedding.LocationStore.GetByMetadata). Paths may be absolute or
+// relative to the repository; a line of 0 or less matches any matching
+// chunk in the file. It is used to filter results from signals, like
+// keyword search, that do not carry chunk metadata themselves.
+func (idx *Indexer) MetadataMatcher(filter map[string]string) (func(path string, line int) bool, error) {
+	locs, err := idx.locations.GetByMetadata(idx.repoPath, filter)
+	if err != nil {
+		return nil, fmt.Errorf("getting locations: %w", err)
+	}
+
+	byPath := make(map[string][]embedding.ChunkLocation)
+	for _, loc := range locs {
+		byPath[loc.Path] = append(byPath[loc.Path], loc)
+	}
+
+	return func(path string, line int) bool {
+		if filepath.IsAbs(path) {
+			rel, err := filepath.Rel(idx.repoPath, path)
+			if err != nil {
+				return false
+			}
+			path = rel
+		}
+		for _, loc := range byPath[embedding.NormalizePath(filepath.Clean(path))] {
+			if line <= 0 || loc.NodeType == embedding.NodeTypeFile ||
+				(line >= loc.StartLine && line <= loc.EndLine) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// NodeTypeResolver returns a function reporting the node type of the
+// indexed chunk spanning lines start to end of path (see ChunkResolver).
+// It returns "" for lines outside any chunk.
+func (idx *Indexer) NodeTypeResolver() (func(path string, start, end int) string, error) {
+	resolve, err := idx.ChunkResolver()
+	if err != nil {
+		return nil, err
+	}
+	return func(path string, start, end int) string {
+		loc, _ := resolve(path, start, end)
+		return loc.NodeType
+	}, nil
+}
+
+// ChunkResolver returns a function finding the indexed chunk spanning
+// lines start to end of path: the chunk with exactly those lines, or else
+// the smallest chunk containing them. It reports false for lines outside
+// any chunk. Paths may be absolute or relative to the repository.
+func (idx *Indexer) ChunkResolver() (func(path string, start, end int) (embedding.ChunkLocation, bool), error) {
+	locs, err := idx.locations.GetByRepo(idx.repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("getting locations: %w", err)
+	}
+
+	byPath := make(map[string][]embedding.ChunkLocation)
+	for _, loc := range locs {
+		if loc.NodeType != embedding.NodeTypeFile {
+			byPath[loc.Path] = append(byPath[loc.Path], loc)
+		}
+	}
+
+	return func(path string, start, end int) (embedding.ChunkLocation, bool) {
+		if filepath.IsAbs(path) {
+			rel, err := filepath.Rel(idx.repoPath, path)
+			if err != nil {
+				return embedding.ChunkLocation{}, false
+			}
+			path = rel
+		}
+		var found embedding.ChunkLocation
+		span := -1
+		for _, loc := range byPath[embedding.NormalizePath(filepath.Clean(path))] {
+			if loc.StartLine == start && loc.EndLine == end {
+				return loc, true
+			}
+			if start >= loc.StartLine && end <= loc.EndLine &&
+				(span < 0 || loc.EndLine-loc.StartLine < span) {
+				found, span = loc, loc.EndLine-loc.StartLine
+			}
+		}
+		return found, span >= 0
+	}, nil
+}
+
+// ModTimeResolver returns a function reporting when path was last
+// modified, as recorded in the merkle tree by the last index run. It
+// returns the zero time for files not in the tree or whose modification
+// time is unknown. Paths may be absolute or relative to the repository.
+func (idx *Indexer) ModTimeResolver() (func(path string) time.Time, error) {
+	tree, err := idx.merkleStore.Load()
+	if err != nil {
+		return nil, fmt.Errorf("loading merkle tree: %w", err)
+	}
+
+	modTimes := make(map[string]time.Time)
+	if tree != nil {
+		var walk func(n *merkle.Node)
+		walk = func(n *merkle.Node) {
+			if !n.IsDir {
+				modTimes[embedding.NormalizePath(n.Path)] = n.ModTime
+			}
+			for _, child := range n.Children {
+				walk(child)
+			}
+		}
+		walk(tree.Root)
+	}
+
+	return func(path string) time.Time {
+		if filepath.IsAbs(path) {
+			rel, err := filepath.Rel(idx.repoPath, path)
+			if err != nil {
+				return time.Time{}
+			}
+			path = rel
+		}
+		return modTimes[embedding.NormalizePath(filepath.Clean(path))]
+	}, nil
+}
+
+// fileMerkleStore returns the merkle store if it keeps the tree in a file,
+// the only store with backups.
+func (idx *Indexer) fileMerkleStore() (*merkle.Store, error) {
+	store, ok := idx.merkleStore.(*merkle.Store)
+	if !ok {
+		return nil, fmt.Errorf("merkle tree backups require the %q merkle store", MerkleStoreFile)
+	}
+	return store, nil
+}
+
+// MerkleBackups returns metadata about the backups of the merkle tree kept
+// by index runs, newest first.
+func (idx *Indexer) MerkleBackups() ([]merkle.Metadata, error) {
+	store, err := idx.fileMerkleStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.BackupMetadata()
+}
+
+// RestoreMerkleBackup replaces the merkle tree with its newest backup, the
+// tree of the run before the last, and returns the restored tree's
+// metadata. This recovers from a corrupt tree or one recorded by a bad
+// run: the next run reindexes the files that differ from the restored
+// tree. Returns merkle.ErrNoBackup if there is no backup.
+func (idx *Indexer) RestoreMerkleBackup() (*merkle.Metadata, error) {
+	store, err := idx.fileMerkleStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.RestoreFromBackup()
+}
+
 // Stats returns statistics about the index.
 func (idx *Indexer) Stats() (*IndexStats, error) {
 	stats := &IndexStats{}
@@ -440,7 +1696,19 @@ func (idx *Indexer) Stats() (*IndexStats, error) {
 	}
 	stats.CachedEmbeddings = cacheStats.TotalEntries
 
-	// Vector index stats
+	coverage, err := idx.Coverage(false)
+	if err != nil {
+		return nil, fmt.Errorf("getting embedding coverage: %w", err)
+	}
+	stats.EmbeddedHashes = coverage.Embedded
+	stats.EmbeddedPercent = coverage.Percent()
+
+	// Vector index stats, once it holds this repo's vectors
+	if idx.vectors != nil {
+		if err := idx.vectors.Sync(context.Background(), idx.repoPath); err != nil {
+			idx.logger.Warn("failed to update vector index", "error", err)
+		}
+	}
 	if idx.vectorIndex != nil {
 		count, err := idx.vectorIndex.Count(context.Background())
 		if err == nil {
@@ -448,6 +1716,7 @@ func (idx *Indexer) Stats() (*IndexStats, error) {
 		}
 		stats.VectorIndexNative = idx.vectorIndex.IsNative()
 	}
+	stats.VectorSearchMode = embedding.VectorIndexMode(idx.vectorIndex)
 
 	return stats, nil
 }
@@ -458,8 +1727,11 @@ type IndexStats struct {
 	UniqueHashes      int            `json:"unique_hashes"`
 	FileCount         int            `json:"file_count"`
 	CachedEmbeddings  int            `json:"cached_embeddings"`
+	EmbeddedHashes    int            `json:"embedded_hashes"`  // Unique hashes with a cached embedding
+	EmbeddedPercent   float64        `json:"embedded_percent"` // EmbeddedHashes as a share of UniqueHashes
 	IndexedVectors    int            `json:"indexed_vectors"`
 	VectorIndexNative bool           `json:"vector_index_native"`
+	VectorSearchMode  string         `json:"vector_search_mode"` // embedding.VectorModeBruteForce or VectorModeNative
 	ByNodeType        map[string]int `json:"by_node_type"`
 	ByLanguage        map[string]int `json:"by_language"`
 }
@@ -532,6 +1804,93 @@ func (idx *Indexer) Locations() *embedding.LocationStore {
 	return idx.locations
 }
 
+// newVectorIndex creates the vector index configured by
+// Config.ShardByRepo, Config.VectorIndex and Config.HNSW or Config.PQ.
+func (idx *Indexer) newVectorIndex() (embedding.VectorIndex, error) {
+	if idx.config.ShardByRepo {
+		if idx.config.VectorIndex == config.VectorIndexPQ {
+			return nil, fmt.Errorf("sharding by repository cannot be combined with the %s vector index", config.VectorIndexPQ)
+		}
+		metric := embedding.MetricFromConfig(idx.config.DistanceMetric)
+		return embedding.NewShardedVectorIndex(
+			embedding.LocationShardRouter(idx.locations),
+			func(repoRoot string) (embedding.VectorIndex, error) {
+				shard := embedding.NewBruteForceVectorIndex(nil, idx.config.Dimensions)
+				shard.SetMetric(metric)
+				return shard, nil
+			},
+		), nil
+	}
+
+	if idx.config.VectorIndex == config.VectorIndexPQ {
+		pqCfg := idx.config.PQ
+		if pqCfg == (config.PQConfig{}) {
+			pqCfg = config.DefaultPQConfig()
+		}
+		pq, err := embedding.NewPQVectorIndex(idx.database, idx.dialect, idx.config.Dimensions, idx.cache.Model(), pqCfg)
+		if err != nil {
+			return nil, err
+		}
+		pq.SetMetric(embedding.MetricFromConfig(idx.config.DistanceMetric))
+		pq.SetVectorSource(embedding.CacheVectorSource(idx.cache))
+		return pq, nil
+	}
+
+	hnswCfg := idx.config.HNSW
+	if hnswCfg == (config.HNSWConfig{}) {
+		hnswCfg = config.DefaultHNSWConfig()
+	}
+	if idx.config.DistanceMetric != "" {
+		hnswCfg.DistanceMetric = idx.config.DistanceMetric
+	}
+	newNative := idx.config.NativeVectorIndex
+	if newNative == nil {
+		newNative = func() (embedding.VectorIndex, error) {
+			return embedding.NewCacheVectorIndex(idx.cache, hnswCfg)
+		}
+	}
+	bruteForce := embedding.NewBruteForceVectorIndex(nil, idx.config.Dimensions)
+	bruteForce.SetMetric(embedding.MetricFromConfig(hnswCfg.DistanceMetric))
+	if hnswCfg.MinVectors > 0 {
+		return embedding.NewThresholdVectorIndex(bruteForce, hnswCfg.MinVectors, newNative), nil
+	}
+	if native, err := newNative(); err == nil && native.IsNative() {
+		return native, nil
+	}
+	return bruteForce, nil
+}
+
+// Searcher returns a semantic searcher over this index's cache and locations.
+// Searchers share one result cache when Config.ResultCache or
+// Config.ResultCacheSize is set, and take their candidates from the vector
+// index when it can serve them (see embedding.CacheSearcher.SetVectorIndex).
+// They refuse queries embedded with another model than the index was last
+// built with (see embedding.ModelMismatchError).
+func (idx *Indexer) Searcher() *embedding.CacheSearcher {
+	searcher := embedding.NewCacheSearcher(idx.cache, idx.locations, idx.embedder)
+	searcher.SetMetric(embedding.MetricFromConfig(idx.config.DistanceMetric))
+	searcher.SetMaxInputBytes(idx.config.MaxEmbedBytes)
+	searcher.SetModelSpaces(idx.spaces)
+	if indexed, err := idx.IndexModel(); err != nil {
+		idx.logger.Warn("failed to read index model", "error", err)
+	} else {
+		searcher.SetIndexModel(indexed)
+	}
+	if idx.results != nil {
+		searcher.SetResultCache(idx.results)
+	}
+	if idx.vectors != nil {
+		searcher.SetVectorIndex(idx.vectors)
+	}
+	return searcher
+}
+
+// IndexModel returns the embedding model the index was last built with,
+// or nil if none is recorded.
+func (idx *Indexer) IndexModel() (*embedding.IndexModel, error) {
+	return idx.models.Get(idx.repoPath)
+}
+
 // Cache returns the embedding cache for external use.
 func (idx *Indexer) Cache() *embedding.EmbeddingCache {
 	return idx.cache
@@ -1,10 +1,24 @@
 package indexer
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"codetect/internal/chunker"
+	"codetect/internal/config"
+	"codetect/internal/embedding"
+	"codetect/internal/merkle"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -209,6 +223,77 @@ func main() {
 	}
 }
 
+func TestIndexer_FastPathUnchanged(t *testing.T) {
+	tempDir := t.TempDir()
+
+	mainFile := filepath.Join(tempDir, "main.go")
+	if err := os.WriteFile(mainFile, []byte(`package main
+
+func main() {
+	println("hello")
+}
+`), 0644); err != nil {
+		t.Fatalf("writing main.go: %v", err)
+	}
+
+	cfg := &Config{
+		DBType:            "sqlite",
+		EmbeddingProvider: "off",
+		Dimensions:        768,
+	}
+
+	idx, err := New(tempDir, cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+
+	// Backdate the repo so the build falls outside the racy window
+	backdate := func() {
+		old := time.Now().Add(-time.Hour)
+		for _, path := range []string{tempDir, mainFile} {
+			if err := os.Chtimes(path, old, old); err != nil {
+				t.Fatalf("backdating %s: %v", path, err)
+			}
+		}
+	}
+	backdate()
+
+	ctx := context.Background()
+	if _, err := idx.Index(ctx, IndexOptions{Force: true}); err != nil {
+		t.Fatalf("First Index() error = %v", err)
+	}
+
+	// Untouched repo short-circuits without rebuilding the tree
+	result, err := idx.Index(ctx, IndexOptions{})
+	if err != nil {
+		t.Fatalf("Second Index() error = %v", err)
+	}
+	if result.ChangeType != "none" || !result.FastPath {
+		t.Errorf("untouched repo: ChangeType = %q, FastPath = %v; want none via fast path",
+			result.ChangeType, result.FastPath)
+	}
+
+	// Any file change bypasses the fast path
+	if err := os.WriteFile(mainFile, []byte(`package main
+
+func main() {
+	println("world")
+}
+`), 0644); err != nil {
+		t.Fatalf("modifying main.go: %v", err)
+	}
+
+	result, err = idx.Index(ctx, IndexOptions{})
+	if err != nil {
+		t.Fatalf("Third Index() error = %v", err)
+	}
+	if result.ChangeType != "incremental" || result.FastPath {
+		t.Errorf("modified repo: ChangeType = %q, FastPath = %v; want incremental via full build",
+			result.ChangeType, result.FastPath)
+	}
+}
+
 func TestIndexer_Stats(t *testing.T) {
 	// Create temp directory for testing
 	tempDir, err := os.MkdirTemp("", "indexer_test")
@@ -261,6 +346,346 @@ func main() {
 	if stats.FileCount == 0 {
 		t.Error("FileCount = 0, want > 0")
 	}
+	if stats.VectorSearchMode != embedding.VectorModeBruteForce {
+		t.Errorf("VectorSearchMode = %q, want %q", stats.VectorSearchMode, embedding.VectorModeBruteForce)
+	}
+}
+
+func TestIndexerVectorIndexThreshold(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := &Config{
+		DBType:            "sqlite",
+		EmbeddingProvider: "off",
+		Dimensions:        768,
+	}
+
+	idx, err := New(tempDir, cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+
+	// Below the default threshold the index searches by brute force
+	threshold, ok := idx.vectorIndex.(*embedding.ThresholdVectorIndex)
+	if !ok {
+		t.Fatalf("vector index is %T, want *embedding.ThresholdVectorIndex", idx.vectorIndex)
+	}
+	if threshold.IsNative() {
+		t.Error("empty index promoted to native")
+	}
+	stats, err := idx.Stats()
+	if err != nil {
+		t.Fatalf("Stats() error = %v", err)
+	}
+	if stats.VectorSearchMode != embedding.VectorModeBruteForce {
+		t.Errorf("VectorSearchMode = %q, want %q", stats.VectorSearchMode, embedding.VectorModeBruteForce)
+	}
+
+	// Without a threshold the native index is used from the start, where
+	// sqlite-vec is available
+	cfg.HNSW = config.DefaultHNSWConfig()
+	cfg.HNSW.MinVectors = 0
+	native, err := New(t.TempDir(), cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer native.Close()
+	if _, ok := native.vectorIndex.(*embedding.ThresholdVectorIndex); ok {
+		t.Error("MinVectors = 0 still built a threshold index")
+	}
+}
+
+// fakeNativeIndex stands in for HNSW or vec0, which need PostgreSQL or the
+// CGO sqlite driver.
+type fakeNativeIndex struct {
+	*embedding.BruteForceVectorIndex
+	searches int
+}
+
+func (f *fakeNativeIndex) IsNative() bool { return true }
+
+func (f *fakeNativeIndex) Search(ctx context.Context, query []float32, k int) ([]embedding.VectorResult, error) {
+	f.searches++
+	return f.BruteForceVectorIndex.Search(ctx, query, k)
+}
+
+func TestIndexerVectorIndexPromotion(t *testing.T) {
+	const minVectors = 10
+	var native *fakeNativeIndex
+	newIndexer := func(files int) *Indexer {
+		t.Helper()
+		hnsw := config.DefaultHNSWConfig()
+		hnsw.MinVectors = minVectors
+		idx, err := New(vocabRepo(t, files), &Config{
+			DBType:     "sqlite",
+			Dimensions: len(embedVocab),
+			Embedder:   vocabEmbedder{},
+			HNSW:       hnsw,
+			NativeVectorIndex: func() (embedding.VectorIndex, error) {
+				native = &fakeNativeIndex{BruteForceVectorIndex: embedding.NewBruteForceVectorIndex(nil, len(embedVocab))}
+				return native, nil
+			},
+		})
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		t.Cleanup(func() { idx.Close() })
+		if _, err := idx.Index(context.Background(), IndexOptions{}); err != nil {
+			t.Fatalf("Index() error = %v", err)
+		}
+		return idx
+	}
+	mode := func(idx *Indexer) (string, int) {
+		t.Helper()
+		stats, err := idx.Stats()
+		if err != nil {
+			t.Fatalf("Stats() error = %v", err)
+		}
+		return stats.VectorSearchMode, stats.IndexedVectors
+	}
+
+	// Below the threshold the indexed vectors are searched by brute force
+	small := newIndexer(3)
+	if got, n := mode(small); got != embedding.VectorModeBruteForce || n == 0 || n >= minVectors || native != nil {
+		t.Fatalf("small repo: mode = %s with %d vectors, want brute force with all of them", got, n)
+	}
+
+	// Indexing past it promotes the index, which searches then go through
+	idx := newIndexer(30)
+	got, n := mode(idx)
+	if got != embedding.VectorModeNative || native == nil {
+		t.Fatalf("VectorSearchMode = %s, want native after indexing %d vectors", got, n)
+	}
+	if held, _ := native.Count(context.Background()); held != n || held < minVectors {
+		t.Errorf("native index holds %d vectors, want all %d", held, n)
+	}
+
+	ctx := context.Background()
+	opts := embedding.CacheSearchOptions{RepoRoot: idx.RepoPath(), Limit: 3}
+	want, err := embedding.NewCacheSearcher(idx.Cache(), idx.Locations(), vocabEmbedder{}).Search(ctx, "kilo lima", opts)
+	if err != nil {
+		t.Fatalf("exact Search() error = %v", err)
+	}
+	results, err := idx.Searcher().Search(ctx, "kilo lima", opts)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if native.searches == 0 {
+		t.Error("Search() did not query the native index")
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("Search() = %+v, want %+v", results, want)
+	}
+}
+
+func TestIndexerVectorIndexPQ(t *testing.T) {
+	cfg := &Config{
+		DBType:            "sqlite",
+		EmbeddingProvider: "off",
+		Dimensions:        768,
+		VectorIndex:       config.VectorIndexPQ,
+	}
+
+	idx, err := New(t.TempDir(), cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+
+	if _, ok := idx.vectorIndex.(*embedding.PQVectorIndex); !ok {
+		t.Fatalf("vector index is %T, want *embedding.PQVectorIndex", idx.vectorIndex)
+	}
+	stats, err := idx.Stats()
+	if err != nil {
+		t.Fatalf("Stats() error = %v", err)
+	}
+	if stats.VectorSearchMode != embedding.VectorModePQ {
+		t.Errorf("VectorSearchMode = %q, want %q", stats.VectorSearchMode, embedding.VectorModePQ)
+	}
+
+	// PQ settings that do not fit the dimensions fail to open
+	cfg.PQ = config.DefaultPQConfig()
+	cfg.PQ.Subspaces = 7
+	if bad, err := New(t.TempDir(), cfg); err == nil {
+		bad.Close()
+		t.Error("expected error for subspaces not dividing the dimensions")
+	}
+}
+
+// vocabEmbedder embeds text as counts of vocabulary words, so chunks
+// sharing words get similar vectors.
+type vocabEmbedder struct{}
+
+var embedVocab = []string{
+	"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf", "hotel",
+	"india", "juliet", "kilo", "lima", "mike", "november", "oscar", "papa",
+}
+
+func (vocabEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	result := make([][]float32, len(texts))
+	for i, text := range texts {
+		vec := make([]float32, len(embedVocab))
+		for j, word := range embedVocab {
+			vec[j] = float32(strings.Count(text, word))
+		}
+		result[i] = vec
+	}
+	return result, nil
+}
+
+func (vocabEmbedder) Available() bool    { return true }
+func (vocabEmbedder) ProviderID() string { return "vocab" }
+func (vocabEmbedder) Dimensions() int    { return len(embedVocab) }
+
+// vocabRepo writes n Go files, each with a function using a different mix
+// of vocabulary words.
+func vocabRepo(t *testing.T, n int) string {
+	t.Helper()
+	files := make(map[string]string, n)
+	for i := range n {
+		var body strings.Builder
+		for j, word := range embedVocab {
+			for range (i*(j+3) + j*j) % 5 {
+				fmt.Fprintf(&body, "\t%s()\n", word)
+			}
+		}
+		files[fmt.Sprintf("f%03d.go", i)] = fmt.Sprintf("package a\n\nfunc F%d() {\n%s}\n", i, body.String())
+	}
+	return writeRepo(t, files)
+}
+
+func TestIndexerVectorIndexPQRecall(t *testing.T) {
+	const (
+		files     = 120
+		k         = 3
+		minRecall = 0.9
+	)
+	pq := config.DefaultPQConfig()
+	pq.Subspaces = 4
+	pq.Centroids = 16
+	pq.RerankFactor = 1 // Only the nearest codes reach the searcher
+	cfg := &Config{
+		DBType:      "sqlite",
+		Dimensions:  len(embedVocab),
+		Embedder:    vocabEmbedder{},
+		VectorIndex: config.VectorIndexPQ,
+		PQ:          pq,
+	}
+	idx, err := New(vocabRepo(t, files), cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+	ctx := context.Background()
+	if _, err := idx.Index(ctx, IndexOptions{}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+
+	// Indexing trained the codebooks and encoded every vector
+	stats, err := idx.Stats()
+	if err != nil {
+		t.Fatalf("Stats() error = %v", err)
+	}
+	if !idx.vectorIndex.(*embedding.PQVectorIndex).Trained() || stats.IndexedVectors != stats.EmbeddedHashes {
+		t.Fatalf("PQ index holds %d of %d vectors, want all after training", stats.IndexedVectors, stats.EmbeddedHashes)
+	}
+
+	// Searches through the index find what scoring every vector finds
+	exact := embedding.NewCacheSearcher(idx.Cache(), idx.Locations(), vocabEmbedder{})
+	searcher := idx.Searcher()
+	var recall float64
+	queries := 0
+	for i := 0; i < len(embedVocab); i++ {
+		for j := i + 1; j < len(embedVocab); j += 5 {
+			query := embedVocab[i] + " " + embedVocab[j]
+			opts := embedding.CacheSearchOptions{RepoRoot: idx.RepoPath(), Limit: k}
+			want, err := exact.Search(ctx, query, opts)
+			if err != nil {
+				t.Fatalf("exact Search(%q) error = %v", query, err)
+			}
+			got, err := searcher.Search(ctx, query, opts)
+			if err != nil {
+				t.Fatalf("Search(%q) error = %v", query, err)
+			}
+			wanted := make(map[string]bool, len(want))
+			for _, r := range want {
+				wanted[r.ContentHash] = true
+			}
+			hits := 0
+			for _, r := range got {
+				if wanted[r.ContentHash] {
+					hits++
+				}
+			}
+			recall += float64(hits) / float64(len(want))
+			queries++
+		}
+	}
+	recall /= float64(queries)
+	t.Logf("PQ recall@%d over %d queries = %.3f", k, queries, recall)
+	if recall < minRecall {
+		t.Errorf("recall@%d = %.3f, want >= %.2f", k, recall, minRecall)
+	}
+}
+
+func TestIndexerVectorIndexShardByRepo(t *testing.T) {
+	cfg := &Config{
+		DBType:      "sqlite",
+		Dimensions:  len(embedVocab),
+		Embedder:    vocabEmbedder{},
+		ShardByRepo: true,
+	}
+	idx, err := New(vocabRepo(t, 12), cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+
+	sharded, ok := idx.vectorIndex.(*embedding.ShardedVectorIndex)
+	if !ok {
+		t.Fatalf("vector index is %T, want *embedding.ShardedVectorIndex", idx.vectorIndex)
+	}
+
+	// Indexing fills the repository's shard with its vectors
+	ctx := context.Background()
+	if _, err := idx.Index(ctx, IndexOptions{}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	if got := sharded.Shards(); len(got) != 1 || got[0] != idx.RepoPath() {
+		t.Fatalf("Shards() = %v, want [%s]", got, idx.RepoPath())
+	}
+	hashes, err := idx.Locations().GetHashesForRepo(idx.RepoPath())
+	if err != nil {
+		t.Fatalf("GetHashesForRepo() error = %v", err)
+	}
+	if n, _ := sharded.Shard(idx.RepoPath()).Count(ctx); n == 0 || n != len(hashes) {
+		t.Errorf("shard holds %d vectors, want the repo's %d", n, len(hashes))
+	}
+
+	// Searches go through the shard and rank as scoring every vector does
+	opts := embedding.CacheSearchOptions{RepoRoot: idx.RepoPath(), Limit: 3}
+	want, err := embedding.NewCacheSearcher(idx.Cache(), idx.Locations(), vocabEmbedder{}).Search(ctx, "kilo lima", opts)
+	if err != nil {
+		t.Fatalf("exact Search() error = %v", err)
+	}
+	results, err := idx.Searcher().Search(ctx, "kilo lima", opts)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("Search() = %+v, want %+v", results, want)
+	}
+	query, _ := vocabEmbedder{}.Embed(ctx, []string{"kilo lima"})
+	if results, err := sharded.SearchWithFilter(ctx, query[0], 5, []string{"/other"}); err != nil || len(results) != 0 {
+		t.Errorf("search of another repo = %+v, %v; want none", results, err)
+	}
+
+	// PQ codes cannot be split by repository
+	cfg.VectorIndex = config.VectorIndexPQ
+	if bad, err := New(t.TempDir(), cfg); err == nil {
+		bad.Close()
+		t.Error("expected error for sharding with the pq vector index")
+	}
 }
 
 func TestLoadGitignore(t *testing.T) {
@@ -461,3 +886,1406 @@ func itoa(n int) string {
 	}
 	return string(buf[pos:])
 }
+
+func TestIndexer_EmbedMissingRequiresEmbedder(t *testing.T) {
+	tempDir := t.TempDir()
+
+	cfg := &Config{
+		DBType:            "sqlite",
+		EmbeddingProvider: "off",
+		Dimensions:        768,
+	}
+
+	idx, err := New(tempDir, cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+
+	if _, err := idx.EmbedMissing(context.Background()); err == nil {
+		t.Error("EmbedMissing() with embedding disabled should return an error")
+	}
+}
+
+func TestIndexer_Coverage(t *testing.T) {
+	repo := writeRepo(t, map[string]string{
+		"a.go": "package a\n\nfunc A() int {\n\treturn 1\n}\n",
+		"b.go": "package a\n\nfunc B() int {\n\treturn 2\n}\n",
+	})
+	idx, err := New(repo, &Config{
+		DBType:     "sqlite",
+		Dimensions: len(embedTokens),
+		Embedder:   &tokenEmbedder{},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+	ctx := context.Background()
+
+	if _, err := idx.Index(ctx, IndexOptions{}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+
+	// Evict the embeddings of b.go
+	locs, err := idx.Locations().GetByPath(repo, "b.go")
+	if err != nil || len(locs) == 0 {
+		t.Fatalf("GetByPath() = %v, %v", locs, err)
+	}
+	var evicted []string
+	for _, loc := range locs {
+		evicted = append(evicted, loc.ContentHash)
+	}
+	slices.Sort(evicted)
+	evicted = slices.Compact(evicted)
+	if err := idx.cache.DeleteBatch(evicted); err != nil {
+		t.Fatalf("DeleteBatch() error = %v", err)
+	}
+
+	coverage, err := idx.Coverage(true)
+	if err != nil {
+		t.Fatalf("Coverage() error = %v", err)
+	}
+	if coverage.Missing != len(evicted) || coverage.Embedded != coverage.Hashes-len(evicted) {
+		t.Errorf("Coverage() = %+v, want %d missing", coverage, len(evicted))
+	}
+	if !reflect.DeepEqual(coverage.MissingHashes, evicted) {
+		t.Errorf("MissingHashes = %v, want %v", coverage.MissingHashes, evicted)
+	}
+
+	stats, err := idx.Stats()
+	if err != nil {
+		t.Fatalf("Stats() error = %v", err)
+	}
+	if stats.EmbeddedHashes != coverage.Embedded || stats.EmbeddedPercent != coverage.Percent() || stats.EmbeddedPercent >= 100 {
+		t.Errorf("Stats() embedded %d (%.1f%%), want %d (%.1f%%)",
+			stats.EmbeddedHashes, stats.EmbeddedPercent, coverage.Embedded, coverage.Percent())
+	}
+
+	if _, err := idx.EmbedMissing(ctx); err != nil {
+		t.Fatalf("EmbedMissing() error = %v", err)
+	}
+	coverage, err = idx.Coverage(true)
+	if err != nil {
+		t.Fatalf("Coverage() error = %v", err)
+	}
+	if coverage.Missing != 0 || coverage.MissingHashes != nil || coverage.Percent() != 100 {
+		t.Errorf("Coverage() after EmbedMissing = %+v, want fully embedded", coverage)
+	}
+}
+
+func TestIndexer_Logger(t *testing.T) {
+	repo := writeRepo(t, map[string]string{
+		"a.go": "package a\n\nfunc A() int {\n\treturn 1\n}\n\nfunc B() int {\n\treturn 2\n}\n",
+	})
+	var logs bytes.Buffer
+	idx, err := New(repo, &Config{
+		DBType:        "sqlite",
+		Dimensions:    len(embedTokens),
+		Embedder:      &tokenEmbedder{},
+		MaxEmbedBytes: 16,
+		Logger:        slog.New(slog.NewTextHandler(&logs, nil)),
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+
+	if _, err := idx.Index(context.Background(), IndexOptions{Verbose: true}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+
+	// Records from both the indexer and its pipeline
+	for _, want := range []string{"building merkle tree", "truncated embedding input"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs missing %q:\n%s", want, logs.String())
+		}
+	}
+}
+
+func TestIndexer_ExtraModels(t *testing.T) {
+	repo := writeRepo(t, map[string]string{
+		"total.go":  "package a\n\nfunc Total(xs []int) (sum int) {\n\tfor _, x := range xs {\n\t\tsum += x\n\t}\n\treturn sum\n}\n",
+		"refund.go": "package a\n\n// Refund reverses an invoice\nfunc Refund(invoice string) error {\n\treturn nil\n}\n",
+	})
+	idx, err := New(repo, &Config{
+		DBType:         "sqlite",
+		EmbeddingModel: "tokens",
+		Dimensions:     len(embedTokens),
+		Embedder:       &tokenEmbedder{},
+		ExtraEmbedders: []embedding.Embedder{wordEmbedder{}},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+	ctx := context.Background()
+
+	if got := idx.Models(); !reflect.DeepEqual(got, []string{"tokens", "words"}) {
+		t.Errorf("Models() = %v, want [tokens words]", got)
+	}
+
+	result, err := idx.Index(ctx, IndexOptions{})
+	if err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	if result.ChunksCreated == 0 {
+		t.Fatal("Index() created no chunks")
+	}
+
+	// Both models have a vector for every chunk
+	hashes, err := idx.Locations().GetHashesForRepo(idx.RepoPath())
+	if err != nil {
+		t.Fatalf("GetHashesForRepo() error = %v", err)
+	}
+	space := idx.spaces[0]
+	for _, hash := range hashes {
+		if ok, _ := idx.cache.HasEntry(hash); !ok {
+			t.Errorf("no tokens vector for %s", hash)
+		}
+		if ok, _ := space.Cache.HasEntry(space.Key(hash)); !ok {
+			t.Errorf("no words vector for %s", hash)
+		}
+	}
+
+	// Each model answers from its own vectors
+	search := func(snippet, model string) string {
+		t.Helper()
+		results, err := idx.SearchByExample(ctx, snippet, "snippet.go", embedding.CacheSearchOptions{Limit: 1, Model: model})
+		if err != nil {
+			t.Fatalf("SearchByExample(%q) error = %v", model, err)
+		}
+		if len(results) == 0 {
+			t.Fatalf("SearchByExample(%q) returned no results", model)
+		}
+		return results[0].Path
+	}
+	loop := "func Sum(vs []int) (n int) {\n\tfor _, v := range vs {\n\t\tn += v\n\t}\n\treturn n\n}\n"
+	if got := search(loop, ""); got != "total.go" {
+		t.Errorf("tokens search matched %s, want total.go", got)
+	}
+	refund := "func Undo(invoice string) {\n\t// refund it\n}\n"
+	if got := search(refund, "words"); got != "refund.go" {
+		t.Errorf("words search matched %s, want refund.go", got)
+	}
+}
+
+func TestIndexer_FileSymbols(t *testing.T) {
+	tempDir := t.TempDir()
+
+	src := `package shapes
+
+type Circle struct {
+	Radius float64
+}
+
+func NewCircle(r float64) *Circle {
+	return &Circle{Radius: r}
+}
+
+func (c *Circle) Area() float64 {
+	return 3.14159 * c.Radius * c.Radius
+}
+`
+	if err := os.WriteFile(filepath.Join(tempDir, "shapes.go"), []byte(src), 0644); err != nil {
+		t.Fatalf("writing shapes.go: %v", err)
+	}
+
+	cfg := &Config{
+		DBType:            "sqlite",
+		EmbeddingProvider: "off",
+		Dimensions:        768,
+	}
+	idx, err := New(tempDir, cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+
+	if _, err := idx.Index(context.Background(), IndexOptions{Force: true}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+
+	syms, err := idx.FileSymbols("shapes.go")
+	if err != nil {
+		t.Fatalf("FileSymbols() error = %v", err)
+	}
+
+	want := []struct {
+		name       string
+		start, end int
+	}{
+		{"Circle", 3, 5},
+		{"NewCircle", 7, 9},
+		{"Area", 11, 13},
+	}
+	if len(syms) != len(want) {
+		t.Fatalf("FileSymbols() = %+v, want %d symbols", syms, len(want))
+	}
+	for i, w := range want {
+		got := syms[i]
+		if got.Name != w.name || got.StartLine != w.start || got.EndLine != w.end {
+			t.Errorf("symbol %d = %s [%d-%d], want %s [%d-%d]",
+				i, got.Name, got.StartLine, got.EndLine, w.name, w.start, w.end)
+		}
+		if got.Type == "" {
+			t.Errorf("symbol %s has no type", got.Name)
+		}
+	}
+
+	// Absolute paths resolve to the same file
+	abs, err := idx.FileSymbols(filepath.Join(tempDir, "shapes.go"))
+	if err != nil {
+		t.Fatalf("FileSymbols(abs) error = %v", err)
+	}
+	if len(abs) != len(syms) {
+		t.Errorf("FileSymbols(abs) returned %d symbols, want %d", len(abs), len(syms))
+	}
+}
+
+func TestIndexer_ChunkMetadata(t *testing.T) {
+	tempDir := t.TempDir()
+
+	files := map[string]string{
+		"pay/charge.go": "package pay\n\nfunc Charge() int {\n\treturn 1\n}\n",
+		"auth/login.go": "package auth\n\nfunc Login() int {\n\treturn 2\n}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("creating dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("writing %s: %v", name, err)
+		}
+	}
+
+	cfg := &Config{
+		DBType:            "sqlite",
+		EmbeddingProvider: "off",
+		Dimensions:        768,
+		ChunkMetadata: func(relPath string) map[string]string {
+			team, _, _ := strings.Cut(filepath.ToSlash(relPath), "/")
+			return map[string]string{"team": team}
+		},
+		IndexedMetadataKeys: []string{"team"},
+	}
+	idx, err := New(tempDir, cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+
+	if _, err := idx.Index(context.Background(), IndexOptions{Force: true}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+
+	locs, err := idx.Locations().GetByMetadata(idx.RepoPath(), map[string]string{"team": "pay"})
+	if err != nil {
+		t.Fatalf("GetByMetadata() error = %v", err)
+	}
+	if len(locs) == 0 {
+		t.Fatal("no locations tagged team=pay")
+	}
+	for _, loc := range locs {
+		if loc.Path != filepath.Join("pay", "charge.go") {
+			t.Errorf("team=pay matched %s", loc.Path)
+		}
+	}
+
+	matches, err := idx.MetadataMatcher(map[string]string{"team": "pay"})
+	if err != nil {
+		t.Fatalf("MetadataMatcher() error = %v", err)
+	}
+	if !matches("pay/charge.go", 3) {
+		t.Error("expected pay/charge.go:3 to match")
+	}
+	if !matches(filepath.Join(idx.RepoPath(), "pay", "charge.go"), 0) {
+		t.Error("expected absolute pay/charge.go path to match")
+	}
+	if !matches(`pay\charge.go`, 3) {
+		t.Error("expected backslash-separated pay/charge.go path to match")
+	}
+	if matches("auth/login.go", 3) {
+		t.Error("auth/login.go should not match team=pay")
+	}
+}
+
+func TestConfigApplyMetadata(t *testing.T) {
+	cfg := &Config{IndexedMetadataKeys: []string{"owner"}}
+	cfg.ApplyMetadata(config.MetadataConfig{
+		Rules: []config.MetadataRule{
+			{Paths: []string{"services/**"}, Tags: map[string]string{"team": "platform", "tier": "backend"}},
+			{Paths: []string{"services/payments/**"}, Tags: map[string]string{"team": "payments"}},
+		},
+	})
+
+	if want := []string{"owner"}; !slices.Equal(cfg.IndexedMetadataKeys, want) {
+		t.Errorf("IndexedMetadataKeys = %v, want %v kept", cfg.IndexedMetadataKeys, want)
+	}
+	tests := []struct {
+		path string
+		want map[string]string
+	}{
+		{"services/payments/charge.go", map[string]string{"team": "payments", "tier": "backend"}},
+		{"services/auth/login.go", map[string]string{"team": "platform", "tier": "backend"}},
+		{"cmd/main.go", nil},
+	}
+	for _, tt := range tests {
+		if got := cfg.ChunkMetadata(tt.path); !maps.Equal(got, tt.want) {
+			t.Errorf("ChunkMetadata(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestIndexer_QualifiedNames(t *testing.T) {
+	files := map[string]string{
+		"auth.go": "package auth\n\nfunc (m *Middleware) Handle(r *http.Request) error {\n\treturn nil\n}\n",
+	}
+	for _, enabled := range []bool{false, true} {
+		embedder := &tokenEmbedder{}
+		idx, err := New(writeRepo(t, files), &Config{
+			DBType:         "sqlite",
+			Dimensions:     len(embedTokens),
+			Embedder:       embedder,
+			QualifiedNames: enabled,
+		})
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		defer idx.Close()
+		if _, err := idx.Index(context.Background(), IndexOptions{}); err != nil {
+			t.Fatalf("Index() error = %v", err)
+		}
+
+		locs, err := idx.Locations().GetLocationsBySymbol(idx.RepoPath(), "Handle")
+		if err != nil || len(locs) != 1 {
+			t.Fatalf("GetLocationsBySymbol() = %+v, %v", locs, err)
+		}
+		embedded := strings.Join(embedder.texts, "\n---\n")
+		if enabled {
+			if locs[0].QualifiedName != "auth.Middleware.Handle" {
+				t.Errorf("QualifiedName = %q, want auth.Middleware.Handle", locs[0].QualifiedName)
+			}
+			if !strings.Contains(embedded, "auth.Middleware.Handle\n\nfunc (m *Middleware) Handle") {
+				t.Errorf("embedded %q, want the method prefixed with its qualified name", embedded)
+			}
+		} else if locs[0].QualifiedName != "" || strings.Contains(embedded, "auth.Middleware") {
+			t.Errorf("without the option: QualifiedName = %q, embedded %q", locs[0].QualifiedName, embedded)
+		}
+	}
+}
+
+func TestIndexer_EmbedPaths(t *testing.T) {
+	body := "\n\nfunc Retry() int {\n\treturn 1\n}\n"
+	files := map[string]string{
+		"payments/retry.go": "package payments" + body,
+		"billing/retry.go":  "package payments" + body,
+	}
+	for _, enabled := range []bool{false, true} {
+		embedder := &tokenEmbedder{}
+		idx, err := New(writeRepo(t, files), &Config{
+			DBType:       "sqlite",
+			Dimensions:   len(embedTokens),
+			Embedder:     embedder,
+			EmbedPaths:   enabled,
+			TrackRenames: true,
+		})
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		defer idx.Close()
+		if _, err := idx.Index(context.Background(), IndexOptions{}); err != nil {
+			t.Fatalf("Index() error = %v", err)
+		}
+
+		locs, err := idx.Locations().GetLocationsBySymbol(idx.RepoPath(), "Retry")
+		if err != nil || len(locs) != 2 {
+			t.Fatalf("GetLocationsBySymbol() = %+v, %v", locs, err)
+		}
+		embedded := strings.Join(embedder.texts, "\n---\n")
+		if enabled {
+			if !strings.Contains(embedded, "payments/retry.go\n\nfunc Retry()") ||
+				!strings.Contains(embedded, "billing/retry.go\n\nfunc Retry()") {
+				t.Errorf("embedded %q, want the function prefixed with each path", embedded)
+			}
+			if locs[0].ContentHash == locs[1].ContentHash {
+				t.Error("copies at different paths share a content hash")
+			}
+			if idx.chunksMoveWith("billing/retry.go", "billing/retry2.go", 10) {
+				t.Error("a move is detected as a rename although the path is embedded")
+			}
+		} else {
+			if strings.Contains(embedded, "retry.go") {
+				t.Errorf("without the option embedded %q", embedded)
+			}
+			if locs[0].ContentHash != locs[1].ContentHash {
+				t.Error("copies without path context have different content hashes")
+			}
+		}
+	}
+}
+
+func TestIndexer_SkipTrivialChunks(t *testing.T) {
+	files := map[string]string{
+		"user.go": "package user\n\nfunc (u *User) Name() string {\n\treturn u.name\n}\n\n" +
+			"func (u *User) Greeting(formal bool) string {\n\tif formal {\n\t\treturn \"Dear \" + u.name\n\t}\n\treturn \"Hi \" + u.name\n}\n",
+	}
+	for _, locations := range []bool{false, true} {
+		embedder := &countingEmbedder{}
+		idx, err := New(writeRepo(t, files), &Config{
+			DBType:                "sqlite",
+			Dimensions:            4,
+			Embedder:              embedder,
+			SkipTrivialChunks:     true,
+			TrivialChunkLocations: locations,
+		})
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		defer idx.Close()
+		ctx := context.Background()
+		if _, err := idx.Index(ctx, IndexOptions{}); err != nil {
+			t.Fatalf("Index() error = %v", err)
+		}
+
+		if embedder.texts != 1 {
+			t.Errorf("locations=%v: embedded %d texts, want only Greeting", locations, embedder.texts)
+		}
+		if locs, err := idx.Locations().GetLocationsBySymbol(idx.RepoPath(), "Greeting"); err != nil || len(locs) != 1 {
+			t.Errorf("locations=%v: Greeting locations = %+v, %v", locations, locs, err)
+		}
+		locs, err := idx.Locations().GetLocationsBySymbol(idx.RepoPath(), "Name")
+		if err != nil {
+			t.Fatalf("GetLocationsBySymbol() error = %v", err)
+		}
+		if locations != (len(locs) == 1) {
+			t.Errorf("locations=%v: getter locations = %+v", locations, locs)
+		}
+
+		// A location without an embedding is neither missing nor dangling
+		coverage, err := idx.Coverage(false)
+		if err != nil {
+			t.Fatalf("Coverage() error = %v", err)
+		}
+		if coverage.Hashes != 1 || coverage.Missing != 0 {
+			t.Errorf("locations=%v: Coverage() = %+v, want 1 hash embedded", locations, coverage)
+		}
+		verify, err := idx.Verify(ctx, false)
+		if err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+		if verify.DanglingHashes != 0 {
+			t.Errorf("locations=%v: Verify() found %d dangling hashes", locations, verify.DanglingHashes)
+		}
+	}
+}
+
+func TestIndexer_ExportedOnly(t *testing.T) {
+	files := map[string]string{
+		"api.go":  "package api\n\nfunc Serve() int {\n\treturn route()\n}\n\nfunc route() int {\n\treturn 1\n}\n",
+		"util.py": "def load(path):\n    return open(path).read()\n\ndef _parse(text):\n    return text.split()\n",
+		"app.rb":  "def _setup\n  1\nend\n",
+	}
+	idx, err := New(writeRepo(t, files), &Config{
+		DBType:       "sqlite",
+		Dimensions:   4,
+		Embedder:     &countingEmbedder{},
+		ExportedOnly: []string{"go", "python"},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+	if _, err := idx.Index(context.Background(), IndexOptions{}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+
+	for symbol, want := range map[string]int{"Serve": 1, "route": 0, "load": 1, "_parse": 0, "_setup": 1} {
+		locs, err := idx.Locations().GetLocationsBySymbol(idx.RepoPath(), symbol)
+		if err != nil {
+			t.Fatalf("GetLocationsBySymbol(%q) error = %v", symbol, err)
+		}
+		if len(locs) != want {
+			t.Errorf("%s: %d locations, want %d", symbol, len(locs), want)
+		}
+	}
+}
+
+func TestIndexer_SkipsUnparseableFile(t *testing.T) {
+	depth := chunker.MaxTreeDepth + 100
+	repo := writeRepo(t, map[string]string{
+		"good.go": "package a\n\nfunc Good() int {\n\treturn 1\n}\n",
+		"deep.go": "package a\n\nvar x = " + strings.Repeat("(", depth) + "1" + strings.Repeat(")", depth) + "\n",
+	})
+	idx, err := New(repo, &Config{DBType: "sqlite", EmbeddingProvider: "off", Dimensions: 768})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+
+	result, err := idx.Index(context.Background(), IndexOptions{})
+	if err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	if result.FilesProcessed != 2 {
+		t.Errorf("FilesProcessed = %d, want 2", result.FilesProcessed)
+	}
+
+	paths, err := idx.Locations().ListPaths(idx.RepoPath())
+	if err != nil {
+		t.Fatalf("ListPaths() error = %v", err)
+	}
+	if len(paths) != 1 || paths[0] != "good.go" {
+		t.Errorf("indexed paths = %v, want only good.go", paths)
+	}
+
+	var skipErr *SkipError
+	if _, err := idx.chunkFile(context.Background(), "deep.go"); !errors.As(err, &skipErr) || skipErr.Reason != SkipUnparseable {
+		t.Errorf("chunkFile(deep.go) error = %v, want an unparseable skip", err)
+	}
+}
+
+func TestIndexer_FileChangedDuringIndexing(t *testing.T) {
+	tempDir := t.TempDir()
+
+	files := map[string]string{
+		"edited.go":  "package main\n\nfunc Before() int {\n\treturn 1\n}\n",
+		"deleted.go": "package main\n\nfunc Gone() int {\n\treturn 2\n}\n",
+		"stable.go":  "package main\n\nfunc Stable() int {\n\treturn 3\n}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("writing %s: %v", name, err)
+		}
+	}
+
+	cfg := &Config{
+		DBType:            "sqlite",
+		EmbeddingProvider: "off",
+		Dimensions:        768,
+	}
+	idx, err := New(tempDir, cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+
+	// Build the tree, then change files before they are chunked
+	tree, err := idx.merkleBuilder.Build(idx.repoPath)
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	edited := "package main\n\nfunc After() int {\n\treturn 10\n}\n"
+	if err := os.WriteFile(filepath.Join(tempDir, "edited.go"), []byte(edited), 0644); err != nil {
+		t.Fatalf("editing file: %v", err)
+	}
+	if err := os.Remove(filepath.Join(tempDir, "deleted.go")); err != nil {
+		t.Fatalf("deleting file: %v", err)
+	}
+
+	result, err := idx.processBatch(context.Background(), tree, []string{"deleted.go", "edited.go", "stable.go"}, nil, false)
+	if err != nil {
+		t.Fatalf("processBatch() error = %v", err)
+	}
+
+	if result.ChangedDuringIndex != 1 {
+		t.Errorf("ChangedDuringIndex = %d, want 1", result.ChangedDuringIndex)
+	}
+	if len(result.Rescheduled) != 1 || result.Rescheduled[0] != "deleted.go" {
+		t.Errorf("Rescheduled = %v, want [deleted.go]", result.Rescheduled)
+	}
+
+	// The edited file is indexed as it was read, not as it was hashed
+	syms, err := idx.FileSymbols("edited.go")
+	if err != nil {
+		t.Fatalf("FileSymbols() error = %v", err)
+	}
+	if len(syms) != 1 || syms[0].Name != "After" {
+		t.Errorf("edited.go symbols = %+v, want [After]", syms)
+	}
+
+	// The tree now records what was indexed, so the next run has nothing
+	// to redo for the edited file and drops the deleted one
+	if err := idx.merkleStore.Save(tree); err != nil {
+		t.Fatalf("saving tree: %v", err)
+	}
+	next, err := idx.Index(context.Background(), IndexOptions{})
+	if err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	if next.FilesProcessed != 0 || next.FilesDeleted != 1 {
+		t.Errorf("next run processed %d and deleted %d files, want 0 and 1",
+			next.FilesProcessed, next.FilesDeleted)
+	}
+}
+
+func TestIndexer_StableChunkIDs(t *testing.T) {
+	tempDir := t.TempDir()
+
+	files := map[string]string{
+		"stable.go": "package main\n\nfunc Stable() int {\n\treturn 1\n}\n\nfunc Other() int {\n\treturn 2\n}\n",
+		"edited.go": "package main\n\nfunc Edited() int {\n\treturn 3\n}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("writing %s: %v", name, err)
+		}
+	}
+
+	idx, err := New(tempDir, &Config{DBType: "sqlite", EmbeddingProvider: "off", Dimensions: 768})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+
+	ctx := context.Background()
+	if _, err := idx.Index(ctx, IndexOptions{Force: true}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+
+	chunkIDs := func(path string) (map[int]string, map[int]int64) {
+		t.Helper()
+		locs, err := idx.Locations().GetByPath(idx.RepoPath(), path)
+		if err != nil {
+			t.Fatalf("GetByPath(%s) error = %v", path, err)
+		}
+		if len(locs) == 0 {
+			t.Fatalf("no locations for %s", path)
+		}
+		ids := make(map[int]string)
+		rowIDs := make(map[int]int64)
+		for _, loc := range locs {
+			if loc.ChunkID == "" {
+				t.Errorf("%s:%d has no chunk ID", path, loc.StartLine)
+			}
+			ids[loc.StartLine] = loc.ChunkID
+			rowIDs[loc.StartLine] = loc.ID
+		}
+		return ids, rowIDs
+	}
+
+	before, beforeRows := chunkIDs("stable.go")
+	editedBefore, _ := chunkIDs("edited.go")
+
+	// A full reindex rewrites every row; an edit changes edited.go's chunks
+	if err := os.WriteFile(filepath.Join(tempDir, "edited.go"),
+		[]byte("package main\n\nfunc Edited() int {\n\treturn 4\n}\n"), 0644); err != nil {
+		t.Fatalf("editing file: %v", err)
+	}
+	if _, err := idx.Index(ctx, IndexOptions{Force: true}); err != nil {
+		t.Fatalf("reindex error = %v", err)
+	}
+
+	after, afterRows := chunkIDs("stable.go")
+	for line, id := range before {
+		if after[line] != id {
+			t.Errorf("stable.go:%d chunk ID changed across reindex: %q -> %q", line, id, after[line])
+		}
+		if afterRows[line] == beforeRows[line] {
+			t.Errorf("stable.go:%d kept row ID %d; test no longer exercises a reinsert", line, beforeRows[line])
+		}
+	}
+
+	editedAfter, _ := chunkIDs("edited.go")
+	for line, id := range editedBefore {
+		if editedAfter[line] == id {
+			t.Errorf("edited.go:%d chunk ID unchanged after edit", line)
+		}
+	}
+
+	// Symbols and lookups expose the same IDs
+	syms, err := idx.FileSymbols("stable.go")
+	if err != nil {
+		t.Fatalf("FileSymbols() error = %v", err)
+	}
+	for _, sym := range syms {
+		if sym.ChunkID != after[sym.StartLine] {
+			t.Errorf("symbol %s chunk ID = %q, want %q", sym.Name, sym.ChunkID, after[sym.StartLine])
+		}
+		loc, err := idx.Locations().GetByChunkID(sym.ChunkID)
+		if err != nil || loc == nil || loc.NodeName != sym.Name {
+			t.Errorf("GetByChunkID(%s) = %+v, %v", sym.Name, loc, err)
+		}
+	}
+}
+
+// countingEmbedder returns constant vectors and counts embedded texts.
+type countingEmbedder struct {
+	texts int
+}
+
+func (c *countingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	c.texts += len(texts)
+	result := make([][]float32, len(texts))
+	for i := range texts {
+		result[i] = []float32{1, 0, 0, 0}
+	}
+	return result, nil
+}
+
+func (c *countingEmbedder) Available() bool    { return true }
+func (c *countingEmbedder) ProviderID() string { return "counting" }
+func (c *countingEmbedder) Dimensions() int    { return 4 }
+
+func TestIndexer_MaxEmbeddings(t *testing.T) {
+	repo := writeRepo(t, map[string]string{
+		"a.go": "package a\n\nfunc A() int {\n\treturn 1\n}\n",
+		"b.go": "package a\n\nfunc B() int {\n\treturn 2\n}\n",
+		"c.go": "package a\n\nfunc C() int {\n\treturn 3\n}\n",
+	})
+	dbPath := filepath.Join(t.TempDir(), "index.db")
+	embedder := &countingEmbedder{}
+
+	index := func(maxEmbeddings int, opts IndexOptions) (*IndexResult, error) {
+		t.Helper()
+		idx, err := New(repo, &Config{
+			DBType:        "sqlite",
+			DBPath:        dbPath,
+			Dimensions:    4,
+			Embedder:      embedder,
+			MaxEmbeddings: maxEmbeddings,
+		})
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		defer idx.Close()
+		return idx.Index(context.Background(), opts)
+	}
+
+	_, err := index(2, IndexOptions{})
+	var budgetErr *embedding.BudgetError
+	if !errors.As(err, &budgetErr) {
+		t.Fatalf("Index() error = %v, want *embedding.BudgetError", err)
+	}
+	if budgetErr.Needed <= 2 || budgetErr.Max != 2 {
+		t.Errorf("BudgetError = %+v, want more than 2 needed", budgetErr)
+	}
+	if embedder.texts != 0 {
+		t.Errorf("embedded %d texts despite the budget", embedder.texts)
+	}
+
+	// The refused run saved nothing, so an unlimited run indexes everything
+	result, err := index(0, IndexOptions{})
+	if err != nil {
+		t.Fatalf("Index() without a budget error = %v", err)
+	}
+	if result.FilesProcessed != 3 || result.ChunksEmbedded != budgetErr.Needed {
+		t.Errorf("result = %+v, want 3 files and %d embedded", result, budgetErr.Needed)
+	}
+	if result.EmbedRequests == nil || result.EmbedRequests.Requests == 0 {
+		t.Errorf("EmbedRequests = %+v, want the embedding requests made", result.EmbedRequests)
+	}
+
+	// Cached content does not count against the budget
+	if _, err := index(1, IndexOptions{Force: true}); err != nil {
+		t.Errorf("forced reindex of cached content error = %v", err)
+	}
+}
+
+func TestIndexer_QueryModelMismatch(t *testing.T) {
+	repo := writeRepo(t, map[string]string{
+		"a.go": "package a\n\nfunc A() int {\n\treturn 1\n}\n",
+	})
+	dbPath := filepath.Join(t.TempDir(), "index.db")
+
+	open := func(model string) *Indexer {
+		t.Helper()
+		idx, err := New(repo, &Config{
+			DBType:         "sqlite",
+			DBPath:         dbPath,
+			Dimensions:     4,
+			EmbeddingModel: model,
+			Embedder:       &countingEmbedder{},
+		})
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		t.Cleanup(func() { idx.Close() })
+		return idx
+	}
+	search := func(idx *Indexer) error {
+		_, err := idx.Searcher().Search(context.Background(), "A", embedding.CacheSearchOptions{RepoRoot: idx.RepoPath()})
+		return err
+	}
+
+	idx := open("model-a")
+	if _, err := idx.Index(context.Background(), IndexOptions{}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	if err := search(idx); err != nil {
+		t.Fatalf("Search() with the indexed model error = %v", err)
+	}
+
+	// CODETECT_EMBEDDING_MODEL changed after indexing
+	var mismatch *embedding.ModelMismatchError
+	if err := search(open("model-b")); !errors.As(err, &mismatch) {
+		t.Fatalf("Search() with another model error = %v, want *embedding.ModelMismatchError", err)
+	}
+	if mismatch.IndexModel != "model-a" || mismatch.QueryModel != "model-b" || mismatch.IndexDimensions != 4 {
+		t.Errorf("mismatch = %+v, want model-a (4 dimensions) vs model-b", mismatch)
+	}
+
+	// Reindexing with the new model records it
+	idx = open("model-b")
+	if _, err := idx.Index(context.Background(), IndexOptions{Force: true}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	if err := search(idx); err != nil {
+		t.Errorf("Search() after reindexing error = %v", err)
+	}
+}
+
+// lineChunker makes one chunk per non-blank line, refusing files named
+// bad.*, and records the files it chunked.
+type lineChunker struct {
+	files []string
+}
+
+func (c *lineChunker) ChunkFile(ctx context.Context, path string, content []byte) ([]chunker.Chunk, error) {
+	c.files = append(c.files, path)
+	if strings.HasPrefix(filepath.Base(path), "bad.") {
+		return nil, fmt.Errorf("%w: refusing %s", chunker.ErrUnparseable, path)
+	}
+	var chunks []chunker.Chunk
+	for i, line := range strings.Split(string(content), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		chunks = append(chunks, chunker.Chunk{
+			Path:      path,
+			StartLine: i + 1,
+			EndLine:   i + 1,
+			Content:   line,
+			NodeType:  "line",
+			NodeName:  fmt.Sprintf("line%d", i+1),
+		})
+	}
+	return chunks, nil
+}
+
+func TestIndexer_CustomChunker(t *testing.T) {
+	repo := writeRepo(t, map[string]string{
+		"a.go":   "package a\n\nfunc A() int {\n\treturn 1\n}\n",
+		"bad.go": "package a\n",
+	})
+	custom := &lineChunker{}
+	embedder := &tokenEmbedder{}
+	idx, err := New(repo, &Config{
+		DBType:     "sqlite",
+		Dimensions: len(embedTokens),
+		Embedder:   embedder,
+		Chunker:    custom,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+	ctx := context.Background()
+
+	if _, err := idx.Index(ctx, IndexOptions{}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	slices.Sort(custom.files)
+	if want := []string{"a.go", "bad.go"}; !slices.Equal(custom.files, want) {
+		t.Errorf("custom chunker called for %v, want %v", custom.files, want)
+	}
+
+	locs, err := idx.Locations().GetByPath(idx.RepoPath(), "a.go")
+	if err != nil {
+		t.Fatalf("GetByPath() error = %v", err)
+	}
+	var got []string
+	for _, loc := range locs {
+		if loc.NodeType != "line" || loc.StartLine != loc.EndLine {
+			t.Errorf("location %+v not from the custom chunker", loc)
+		}
+		got = append(got, loc.NodeName)
+	}
+	if want := []string{"line1", "line3", "line4", "line5"}; !slices.Equal(got, want) {
+		t.Errorf("chunks = %v, want %v", got, want)
+	}
+	if !slices.Contains(embedder.texts, "\treturn 1") {
+		t.Errorf("embedded %q, want the custom chunks' lines", embedder.texts)
+	}
+
+	// A file the chunker cannot handle is skipped
+	if n, err := idx.Locations().CountByPath(idx.RepoPath(), "bad.go"); err != nil || n != 0 {
+		t.Errorf("bad.go has %d locations (%v), want 0", n, err)
+	}
+}
+
+func TestIndexer_NodeTypeResolver(t *testing.T) {
+	repo := writeRepo(t, map[string]string{
+		"a.go": "package a\n\nimport \"fmt\"\n\nfunc A() {\n\tfmt.Println(1)\n\tfmt.Println(2)\n}\n",
+	})
+	idx, err := New(repo, &Config{
+		DBType:     "sqlite",
+		Dimensions: 4,
+		Embedder:   &countingEmbedder{},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+
+	if _, err := idx.Index(context.Background(), IndexOptions{}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	nodeType, err := idx.NodeTypeResolver()
+	if err != nil {
+		t.Fatalf("NodeTypeResolver() error = %v", err)
+	}
+
+	locs, err := idx.Locations().GetByPath(idx.RepoPath(), "a.go")
+	if err != nil {
+		t.Fatalf("GetByPath() error = %v", err)
+	}
+	var fn *embedding.ChunkLocation
+	for i := range locs {
+		if locs[i].NodeType == "function_declaration" {
+			fn = &locs[i]
+		}
+	}
+	if fn == nil {
+		t.Fatalf("no function chunk in %+v", locs)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		start, end int
+		want       string
+	}{
+		{"exact chunk", "a.go", fn.StartLine, fn.EndLine, "function_declaration"},
+		{"lines inside chunk", "a.go", fn.StartLine + 1, fn.StartLine + 2, "function_declaration"},
+		{"absolute path", filepath.Join(idx.RepoPath(), "a.go"), fn.StartLine, fn.EndLine, "function_declaration"},
+		{"unindexed file", "b.go", 1, 2, ""},
+		{"past the end", "a.go", 100, 101, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nodeType(tt.path, tt.start, tt.end); got != tt.want {
+				t.Errorf("node type of %s:%d-%d = %q, want %q", tt.path, tt.start, tt.end, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexer_ModTimeResolver(t *testing.T) {
+	repo := writeRepo(t, map[string]string{
+		"a.go":     "package a\n\nfunc A() int {\n\treturn 1\n}\n",
+		"sub/b.go": "package sub\n\nfunc B() int {\n\treturn 2\n}\n",
+	})
+	old := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	recent := old.Add(48 * time.Hour)
+	if err := os.Chtimes(filepath.Join(repo, "a.go"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(repo, "sub", "b.go"), recent, recent); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := New(repo, &Config{DBType: "sqlite", Dimensions: 4, Embedder: &countingEmbedder{}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+
+	if _, err := idx.Index(context.Background(), IndexOptions{}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	modTime, err := idx.ModTimeResolver()
+	if err != nil {
+		t.Fatalf("ModTimeResolver() error = %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want time.Time
+	}{
+		{"a.go", old},
+		{"sub/b.go", recent},
+		{filepath.Join(idx.RepoPath(), "sub", "b.go"), recent},
+		{"missing.go", time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := modTime(tt.path); !got.Equal(tt.want) {
+			t.Errorf("mod time of %s = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestIndexer_AlwaysEmbed(t *testing.T) {
+	repo := writeRepo(t, map[string]string{
+		"a.go":           "package a\n\nfunc A() int {\n\treturn 1\n}\n",
+		"api/b.proto.go": "package api\n\nfunc B() int {\n\treturn 2\n}\n",
+		"api/v1/c.go":    "package v1\n\nfunc C() int {\n\treturn 3\n}\n",
+	})
+	embedder := &countingEmbedder{}
+	idx, err := New(repo, &Config{DBType: "sqlite", Dimensions: 4, Embedder: embedder})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+	ctx := context.Background()
+
+	if _, err := idx.Index(ctx, IndexOptions{}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	if _, err := idx.Index(ctx, IndexOptions{AlwaysEmbed: []string{"api/[.go"}}); err == nil {
+		t.Error("Index() with a malformed pattern succeeded")
+	}
+
+	// Nothing changed and every chunk is cached, yet matching files are
+	// embedded again on each run
+	for run := 0; run < 2; run++ {
+		before := embedder.texts
+		result, err := idx.Index(ctx, IndexOptions{AlwaysEmbed: []string{"*.proto.go", "api/v1/**"}})
+		if err != nil {
+			t.Fatalf("Index() error = %v", err)
+		}
+		if result.ChangeType != "incremental" || result.FilesRefreshed != 2 || result.FilesProcessed != 2 {
+			t.Errorf("run %d: Index() = %+v, want 2 files refreshed", run, result)
+		}
+		if result.CacheHits != 0 || result.ChunksEmbedded == 0 || embedder.texts-before != result.ChunksEmbedded {
+			t.Errorf("run %d: %d cache hits and %d embedded (%d texts), want all embedded",
+				run, result.CacheHits, result.ChunksEmbedded, embedder.texts-before)
+		}
+	}
+
+	if result, err := idx.Index(ctx, IndexOptions{}); err != nil || result.ChangeType != "none" {
+		t.Errorf("Index() without AlwaysEmbed = %+v, %v, want no changes", result, err)
+	}
+	if result, err := idx.Index(ctx, IndexOptions{AlwaysEmbed: []string{"*.py"}}); err != nil || result.ChangeType != "none" {
+		t.Errorf("Index() with an unmatched pattern = %+v, %v, want no changes", result, err)
+	}
+}
+
+func TestMatchesAnyGlob(t *testing.T) {
+	patterns := []string{"*.proto", "gen/*.go", "vendor/**"}
+	for path, want := range map[string]bool{
+		"api.proto":                          true,
+		filepath.Join("x", "api.proto"):      true,
+		filepath.Join("gen", "a.go"):         true,
+		filepath.Join("gen", "x", "a.go"):    false,
+		filepath.Join("vendor", "x", "y.go"): true,
+		"vendor.go":                          false,
+		"a.go":                               false,
+	} {
+		if got := matchesAnyGlob(patterns, path); got != want {
+			t.Errorf("matchesAnyGlob(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestIndexer_HashAlgoChangeReindexes(t *testing.T) {
+	repo := writeRepo(t, map[string]string{
+		"a.go": "package a\n\nfunc A() int {\n\treturn 1\n}\n",
+		"b.go": "package a\n\nfunc B() int {\n\treturn 2\n}\n",
+	})
+	open := func(algo string) *Indexer {
+		t.Helper()
+		idx, err := New(repo, &Config{
+			DBType:     "sqlite",
+			Dimensions: 4,
+			Embedder:   &countingEmbedder{},
+			HashAlgo:   algo,
+		})
+		if err != nil {
+			t.Fatalf("New(%q) error = %v", algo, err)
+		}
+		return idx
+	}
+	ctx := context.Background()
+
+	idx := open("")
+	if _, err := idx.Index(ctx, IndexOptions{}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	idx.Close()
+	if err := os.Remove(filepath.Join(repo, "b.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	idx = open(merkle.HashBLAKE3)
+	defer idx.Close()
+	result, err := idx.Index(ctx, IndexOptions{})
+	if err != nil {
+		t.Fatalf("Index() with blake3 error = %v", err)
+	}
+	if result.ChangeType != "full" || result.FilesProcessed != 1 || result.FilesDeleted != 1 {
+		t.Errorf("result = %+v, want a full reindex of a.go and b.go deleted", result)
+	}
+	if locs, _ := idx.Locations().GetByPath(idx.RepoPath(), "b.go"); len(locs) != 0 {
+		t.Errorf("b.go still has %d locations", len(locs))
+	}
+
+	result, err = idx.Index(ctx, IndexOptions{})
+	if err != nil {
+		t.Fatalf("second Index() error = %v", err)
+	}
+	if result.ChangeType != "none" {
+		t.Errorf("ChangeType = %q after reindex, want none", result.ChangeType)
+	}
+
+	if _, err := New(repo, &Config{DBType: "sqlite", Dimensions: 4, Embedder: &countingEmbedder{}, HashAlgo: "md5"}); err == nil {
+		t.Error("New() with an unknown hash algorithm should fail")
+	}
+}
+
+func TestIndexer_CacheEncoding(t *testing.T) {
+	repo := writeRepo(t, map[string]string{
+		"a.go": "package a\n\nfunc A() int {\n\treturn 1\n}\n",
+	})
+	idx, err := New(repo, &Config{
+		DBType:        "sqlite",
+		Dimensions:    4,
+		Embedder:      &countingEmbedder{},
+		CacheEncoding: string(embedding.CacheEncodingInt8),
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+
+	if _, err := idx.Index(context.Background(), IndexOptions{}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+
+	var stored string
+	if err := idx.database.QueryRow("SELECT embedding FROM embedding_cache LIMIT 1").Scan(&stored); err != nil {
+		t.Fatalf("reading cache entry: %v", err)
+	}
+	if strings.HasPrefix(stored, "[") {
+		t.Errorf("cache entry stored as JSON with the int8 encoding: %s", stored)
+	}
+	coverage, err := idx.Coverage(false)
+	if err != nil || coverage.Missing != 0 || coverage.Embedded == 0 {
+		t.Errorf("Coverage() = %+v, %v, want every chunk embedded", coverage, err)
+	}
+
+	if _, err := New(repo, &Config{DBType: "sqlite", Dimensions: 4, Embedder: &countingEmbedder{}, CacheEncoding: "float16"}); err == nil {
+		t.Error("New() with an unknown cache encoding should fail")
+	}
+}
+
+func TestIndexer_MerkleBackups(t *testing.T) {
+	repo := writeRepo(t, map[string]string{
+		"a.go": "package a\n\nfunc A() int {\n\treturn 1\n}\n",
+	})
+	idx, err := New(repo, &Config{DBType: "sqlite", Dimensions: 4, Embedder: &countingEmbedder{}, MerkleBackups: 2})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+	ctx := context.Background()
+
+	for i, name := range []string{"", "b.go", "c.go"} {
+		if name != "" {
+			if err := os.WriteFile(filepath.Join(repo, name), []byte("package a\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := idx.Index(ctx, IndexOptions{}); err != nil {
+			t.Fatalf("Index() run %d error = %v", i+1, err)
+		}
+	}
+
+	backups, err := idx.MerkleBackups()
+	if err != nil {
+		t.Fatalf("MerkleBackups() error = %v", err)
+	}
+	if len(backups) != 2 || backups[0].FileCount != 2 || backups[1].FileCount != 1 {
+		t.Errorf("MerkleBackups() = %+v, want the trees of the two runs before", backups)
+	}
+}
+
+func TestIndexer_RestoreMerkleBackup(t *testing.T) {
+	repo := writeRepo(t, map[string]string{
+		"a.go": "package a\n\nfunc A() int {\n\treturn 1\n}\n",
+	})
+	idx, err := New(repo, &Config{DBType: "sqlite", Dimensions: 4, Embedder: &countingEmbedder{}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+	ctx := context.Background()
+
+	if _, err := idx.RestoreMerkleBackup(); !errors.Is(err, merkle.ErrNoBackup) {
+		t.Errorf("RestoreMerkleBackup() before indexing error = %v, want merkle.ErrNoBackup", err)
+	}
+
+	if _, err := idx.Index(ctx, IndexOptions{}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "b.go"), []byte("package a\n\nfunc B() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idx.Index(ctx, IndexOptions{}); err != nil {
+		t.Fatalf("second Index() error = %v", err)
+	}
+
+	backups, err := idx.MerkleBackups()
+	if err != nil {
+		t.Fatalf("MerkleBackups() error = %v", err)
+	}
+	if len(backups) != 1 || backups[0].FileCount != 1 {
+		t.Fatalf("MerkleBackups() = %+v, want the first run's tree of 1 file", backups)
+	}
+
+	// Corrupt the tree, then restore the first run's
+	treePath := filepath.Join(idx.dataDir, merkle.TreeFileName)
+	if err := os.WriteFile(treePath, []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	md, err := idx.RestoreMerkleBackup()
+	if err != nil {
+		t.Fatalf("RestoreMerkleBackup() error = %v", err)
+	}
+	if md.FileCount != 1 || md.RootHash != backups[0].RootHash {
+		t.Errorf("RestoreMerkleBackup() = %+v, want the backup %+v", md, backups[0])
+	}
+
+	// The next run picks up from the restored tree
+	result, err := idx.Index(ctx, IndexOptions{})
+	if err != nil {
+		t.Fatalf("Index() after restore error = %v", err)
+	}
+	if result.ChangeType != "incremental" || result.FilesProcessed != 1 {
+		t.Errorf("result = %+v, want only b.go reindexed", result)
+	}
+
+	dbIdx, err := New(writeRepo(t, nil), &Config{
+		DBType:      "sqlite",
+		Dimensions:  4,
+		Embedder:    &countingEmbedder{},
+		MerkleStore: MerkleStoreDB,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer dbIdx.Close()
+	if _, err := dbIdx.RestoreMerkleBackup(); err == nil {
+		t.Error("RestoreMerkleBackup() with the database store should fail")
+	}
+}
+
+func TestIndexer_MerkleStoreDB(t *testing.T) {
+	repo := writeRepo(t, map[string]string{
+		"a.go": "package a\n\nfunc A() int {\n\treturn 1\n}\n",
+	})
+	idx, err := New(repo, &Config{
+		DBType:      "sqlite",
+		Dimensions:  4,
+		Embedder:    &countingEmbedder{},
+		MerkleStore: MerkleStoreDB,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+	ctx := context.Background()
+
+	if _, err := idx.Index(ctx, IndexOptions{}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(idx.dataDir, merkle.TreeFileName)); !os.IsNotExist(err) {
+		t.Errorf("tree file exists with the database store: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(repo, "b.go"), []byte("package a\n\nfunc B() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := idx.Index(ctx, IndexOptions{})
+	if err != nil {
+		t.Fatalf("second Index() error = %v", err)
+	}
+	if result.ChangeType != "incremental" || result.FilesProcessed != 1 {
+		t.Errorf("result = %+v, want only b.go indexed", result)
+	}
+
+	if _, err := New(repo, &Config{DBType: "sqlite", Dimensions: 4, Embedder: &countingEmbedder{}, MerkleStore: "redis"}); err == nil {
+		t.Error("New() with an unknown merkle store should fail")
+	}
+}
+
+func TestConfigLoadChunking(t *testing.T) {
+	t.Setenv("CODETECT_MAX_CHUNK_SIZE", "3000")
+	t.Setenv("CODETECT_SKIP_GAPS", "true")
+	t.Setenv("CODETECT_SPLIT_NESTED_FUNCTIONS", "python")
+
+	cfg := DefaultConfig()
+	if err := cfg.LoadChunking(t.TempDir()); err != nil {
+		t.Fatalf("LoadChunking() error = %v", err)
+	}
+	if cfg.MaxChunkSize != 3000 || !cfg.SkipGaps || !slices.Equal(cfg.SplitNestedFunctions, []string{"python"}) {
+		t.Errorf("chunking settings = %d, %v, %v; want 3000, true, [python]",
+			cfg.MaxChunkSize, cfg.SkipGaps, cfg.SplitNestedFunctions)
+	}
+	if cfg.EmbeddingModel != DefaultConfig().EmbeddingModel {
+		t.Errorf("LoadChunking changed EmbeddingModel to %q", cfg.EmbeddingModel)
+	}
+}
+
+func TestIndexer_ChunkDeltas(t *testing.T) {
+	fn := func(name string) string {
+		return fmt.Sprintf("func %s(n int) int {\n\tif n > 0 {\n\t\treturn n * 2\n\t}\n\treturn 0\n}\n\n", name)
+	}
+	original := "package main\n\n" + fn("First") + fn("Second") + fn("Third")
+	edited := "package main\n\n" + fn("First") + fn("Second")
+
+	for _, concurrency := range []int{0, 2} {
+		t.Run(fmt.Sprintf("concurrency %d", concurrency), func(t *testing.T) {
+			repo := writeRepo(t, map[string]string{"main.go": original})
+			idx, err := New(repo, &Config{
+				DBType:      "sqlite",
+				Dimensions:  4,
+				Embedder:    &countingEmbedder{},
+				ChunkDeltas: true,
+				Concurrency: concurrency,
+			})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			t.Cleanup(func() { idx.Close() })
+
+			ctx := context.Background()
+			if _, err := idx.Index(ctx, IndexOptions{}); err != nil {
+				t.Fatalf("Index() error = %v", err)
+			}
+			before, err := idx.Locations().GetByPath(idx.repoPath, "main.go")
+			if err != nil {
+				t.Fatalf("GetByPath() error = %v", err)
+			}
+
+			// Removing the last function drops its rows and keeps the others
+			if err := os.WriteFile(filepath.Join(repo, "main.go"), []byte(edited), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := idx.Index(ctx, IndexOptions{}); err != nil {
+				t.Fatalf("Index() error = %v", err)
+			}
+			after, err := idx.Locations().GetByPath(idx.repoPath, "main.go")
+			if err != nil {
+				t.Fatalf("GetByPath() error = %v", err)
+			}
+			if len(after) == 0 || len(after) >= len(before) {
+				t.Fatalf("got %d locations after removing a function, had %d", len(after), len(before))
+			}
+			lines := strings.Count(edited, "\n")
+			kept := make(map[int64]bool, len(before))
+			for _, loc := range before {
+				kept[loc.ID] = true
+			}
+			for _, loc := range after {
+				if loc.EndLine > lines {
+					t.Errorf("stale location %d-%d left past the end of the %d-line file", loc.StartLine, loc.EndLine, lines)
+				}
+				if !kept[loc.ID] {
+					t.Errorf("unchanged location %d-%d was rewritten", loc.StartLine, loc.EndLine)
+				}
+			}
+		})
+	}
+}
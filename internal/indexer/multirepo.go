@@ -0,0 +1,90 @@
+package indexer
+
+import (
+	"fmt"
+	"os"
+
+	"codetect/internal/db"
+	"codetect/internal/embedding"
+)
+
+// MultiRepo opens indexers for several repositories that share one
+// embedder and, where the store allows it, one database connection, so a
+// single run can index sibling repos without reconnecting for each.
+//
+// Locations are kept apart by repo_root. PostgreSQL, or SQLite with
+// Config.DBPath set, puts every repo in the same store; SQLite without
+// DBPath keeps each repo in its own .codetect/index.db, as New does.
+type MultiRepo struct {
+	cfg      Config
+	database db.DB // nil when each repo opens its own SQLite database
+}
+
+// NewMultiRepo prepares the shared database connection and embedder
+// described by cfg. The caller must Close it after closing the indexers it
+// opened.
+func NewMultiRepo(cfg *Config) (*MultiRepo, error) {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	m := &MultiRepo{cfg: *cfg}
+
+	if m.cfg.Database == nil && (m.cfg.databaseType() == db.DatabasePostgres || m.cfg.DBPath != "") {
+		database, err := openDatabase(&m.cfg, "")
+		if err != nil {
+			return nil, err
+		}
+		m.database = database
+		m.cfg.Database = database
+	}
+
+	embedder, err := newEmbedder(&m.cfg)
+	if err != nil {
+		m.Close()
+		return nil, err
+	}
+	m.cfg.Embedder = embedder
+
+	return m, nil
+}
+
+// Open returns an indexer for repoPath using the shared connection and
+// embedder. The repo's .gitignore patterns are added to the configured
+// IgnorePatterns.
+func (m *MultiRepo) Open(repoPath string) (*Indexer, error) {
+	return m.OpenWith(repoPath, nil)
+}
+
+// OpenWith is like Open, but first passes the repo's copy of the
+// configuration to configure, if not nil, for settings that differ per
+// repo such as its chunk profile. An error from configure is returned
+// without opening the indexer.
+func (m *MultiRepo) OpenWith(repoPath string, configure func(*Config) error) (*Indexer, error) {
+	if info, err := os.Stat(repoPath); err != nil {
+		return nil, fmt.Errorf("opening repository: %w", err)
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("opening repository: %s is not a directory", repoPath)
+	}
+
+	cfg := m.cfg
+	cfg.IgnorePatterns = append(append([]string(nil), m.cfg.IgnorePatterns...), LoadGitignore(repoPath)...)
+	if configure != nil {
+		if err := configure(&cfg); err != nil {
+			return nil, err
+		}
+	}
+	return New(repoPath, &cfg)
+}
+
+// Embedder returns the embedder shared by every indexer.
+func (m *MultiRepo) Embedder() embedding.Embedder {
+	return m.cfg.Embedder
+}
+
+// Close closes the shared database connection, if NewMultiRepo opened one.
+func (m *MultiRepo) Close() error {
+	if m.database != nil {
+		return m.database.Close()
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"codetect/internal/config"
+)
+
+func writeRepo(t testing.TB, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("creating %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("writing %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestMultiRepo_IndexesReposIntoSharedStore(t *testing.T) {
+	repoA := writeRepo(t, map[string]string{
+		"api.go":       "package api\n\nfunc Serve() {\n\tprintln(\"serve\")\n}\n",
+		".gitignore":   "generated.go\n",
+		"generated.go": "package api\n\nfunc Generated() {}\n",
+	})
+	repoB := writeRepo(t, map[string]string{
+		"worker.go": "package worker\n\nfunc Run() {\n\tprintln(\"run\")\n}\n",
+	})
+
+	m, err := NewMultiRepo(&Config{
+		DBType:            "sqlite",
+		DBPath:            filepath.Join(t.TempDir(), "shared.db"),
+		EmbeddingProvider: "off",
+		Dimensions:        768,
+	})
+	if err != nil {
+		t.Fatalf("NewMultiRepo() error = %v", err)
+	}
+	defer m.Close()
+
+	var indexers []*Indexer
+	for _, repo := range []string{repoA, repoB} {
+		idx, err := m.Open(repo)
+		if err != nil {
+			t.Fatalf("Open(%s) error = %v", repo, err)
+		}
+		result, err := idx.Index(context.Background(), IndexOptions{Force: true})
+		if err != nil {
+			t.Fatalf("Index(%s) error = %v", repo, err)
+		}
+		if result.FilesProcessed == 0 {
+			t.Errorf("%s: FilesProcessed = 0", repo)
+		}
+		indexers = append(indexers, idx)
+	}
+
+	if indexers[0].database != indexers[1].database {
+		t.Error("indexers did not share the database connection")
+	}
+	if indexers[0].embedder != indexers[1].embedder {
+		t.Error("indexers did not share the embedder")
+	}
+
+	// Closing one indexer must leave the shared connection usable
+	indexers[0].Close()
+	defer indexers[1].Close()
+
+	repos := []struct {
+		root    string
+		want    string
+		exclude []string
+	}{
+		// generated.go is in repoA's .gitignore and repoB's file is elsewhere
+		{indexers[0].RepoPath(), "api.go", []string{"generated.go", "worker.go"}},
+		{indexers[1].RepoPath(), "worker.go", []string{"api.go"}},
+	}
+	if repos[0].root == repos[1].root {
+		t.Fatalf("repos share a root: %s", repos[0].root)
+	}
+	for _, repo := range repos {
+		locs, err := indexers[1].Locations().GetByRepo(repo.root)
+		if err != nil {
+			t.Fatalf("GetByRepo(%s) error = %v", repo.root, err)
+		}
+		paths := make(map[string]bool)
+		for _, loc := range locs {
+			if loc.RepoRoot != repo.root {
+				t.Errorf("location %s has repo_root %q, want %q", loc.Path, loc.RepoRoot, repo.root)
+			}
+			paths[loc.Path] = true
+		}
+		if !paths[repo.want] {
+			t.Errorf("%s: %s not indexed, got %v", repo.root, repo.want, paths)
+		}
+		for _, path := range repo.exclude {
+			if paths[path] {
+				t.Errorf("%s: unexpected location for %s", repo.root, path)
+			}
+		}
+	}
+}
+
+func TestMultiRepo_SQLiteWithoutPathUsesRepoDatabases(t *testing.T) {
+	repoA := writeRepo(t, map[string]string{"a.go": "package a\n\nfunc A() {}\n"})
+	repoB := writeRepo(t, map[string]string{"b.go": "package b\n\nfunc B() {}\n"})
+
+	m, err := NewMultiRepo(&Config{DBType: "sqlite", EmbeddingProvider: "off", Dimensions: 768})
+	if err != nil {
+		t.Fatalf("NewMultiRepo() error = %v", err)
+	}
+	defer m.Close()
+
+	for _, repo := range []string{repoA, repoB} {
+		idx, err := m.Open(repo)
+		if err != nil {
+			t.Fatalf("Open(%s) error = %v", repo, err)
+		}
+		if _, err := idx.Index(context.Background(), IndexOptions{Force: true}); err != nil {
+			t.Fatalf("Index(%s) error = %v", repo, err)
+		}
+		if err := idx.Close(); err != nil {
+			t.Errorf("Close(%s) error = %v", repo, err)
+		}
+		if _, err := os.Stat(filepath.Join(repo, ".codetect", "index.db")); err != nil {
+			t.Errorf("%s: per-repo database missing: %v", repo, err)
+		}
+	}
+}
+
+func TestMultiRepo_OpenMissingRepo(t *testing.T) {
+	m, err := NewMultiRepo(&Config{DBType: "sqlite", EmbeddingProvider: "off", Dimensions: 768})
+	if err != nil {
+		t.Fatalf("NewMultiRepo() error = %v", err)
+	}
+	defer m.Close()
+
+	if _, err := m.Open(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Open() of a missing directory should fail")
+	}
+}
+
+func TestMultiRepo_OpenWithChunkProfile(t *testing.T) {
+	files := map[string]string{
+		"store.go": "package store\n\nimport \"fmt\"\n\n" +
+			"func Key(id int) string {\n\tif id < 0 {\n\t\tid = -id\n\t}\n\treturn fmt.Sprintf(\"key:%d\", id)\n}\n",
+		"store_test.go": "package store\n\nimport \"testing\"\n\n" +
+			"func TestKey(t *testing.T) {\n\tif Key(1) != \"key:1\" {\n\t\tt.Fail()\n\t}\n}\n",
+	}
+	plain := writeRepo(t, files)
+	files[config.RepoConfigFile] = `{"chunk_profile": "api"}`
+	profiled := writeRepo(t, files)
+
+	m, err := NewMultiRepo(&Config{DBType: "sqlite", EmbeddingProvider: "off", Dimensions: 768})
+	if err != nil {
+		t.Fatalf("NewMultiRepo() error = %v", err)
+	}
+	defer m.Close()
+
+	index := func(repo string) (*Indexer, *IndexResult) {
+		idx, err := m.OpenWith(repo, func(cfg *Config) error {
+			chunkCfg, err := config.LoadChunkingConfig(repo)
+			cfg.SkipGaps = chunkCfg.SkipGaps
+			cfg.ExcludeTests = chunkCfg.ExcludeTests
+			return err
+		})
+		if err != nil {
+			t.Fatalf("OpenWith(%s) error = %v", repo, err)
+		}
+		t.Cleanup(func() { idx.Close() })
+		result, err := idx.Index(context.Background(), IndexOptions{Force: true})
+		if err != nil {
+			t.Fatalf("Index(%s) error = %v", repo, err)
+		}
+		return idx, result
+	}
+
+	_, plainResult := index(plain)
+	idx, result := index(profiled)
+
+	// The api profile drops the test file and the imports above Key
+	if result.ChunksCreated != 1 || plainResult.ChunksCreated <= result.ChunksCreated {
+		t.Errorf("ChunksCreated = %d with the api profile and %d without, want 1 and more",
+			result.ChunksCreated, plainResult.ChunksCreated)
+	}
+	locs, err := idx.Locations().GetByRepo(idx.RepoPath())
+	if err != nil {
+		t.Fatalf("GetByRepo() error = %v", err)
+	}
+	for _, loc := range locs {
+		if loc.Path != "store.go" || loc.NodeName != "Key" {
+			t.Errorf("unexpected location %s %s %q", loc.Path, loc.NodeType, loc.NodeName)
+		}
+	}
+
+	// An error from the hook fails the repo instead of indexing it
+	broken := errors.New("bad profile")
+	if _, err := m.OpenWith(plain, func(*Config) error { return broken }); !errors.Is(err, broken) {
+		t.Errorf("OpenWith() error = %v, want %v", err, broken)
+	}
+}
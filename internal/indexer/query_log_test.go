@@ -0,0 +1,52 @@
+package indexer
+
+import (
+	"path/filepath"
+	"testing"
+
+	"codetect/internal/embedding"
+)
+
+func TestIndexer_LogQuery(t *testing.T) {
+	repo := writeRepo(t, map[string]string{"a.go": "package a\n"})
+	query := embedding.LoggedQuery{Tool: "hybrid_search_v2", Query: "parse config", Results: 2, TopPath: "a.go", TopLine: 1, TopScore: 0.5}
+
+	for _, tt := range []struct {
+		mode      string
+		wantQuery string // "" if nothing is logged
+	}{
+		{embedding.QueryLogOff, ""},
+		{embedding.QueryLogHashed, embedding.HashQuery("parse config")},
+		{embedding.QueryLogRaw, "parse config"},
+	} {
+		idx, err := New(repo, &Config{
+			DBType:     "sqlite",
+			DBPath:     filepath.Join(t.TempDir(), "index.db"),
+			Dimensions: 4,
+			Embedder:   &countingEmbedder{},
+			QueryLog:   tt.mode,
+		})
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		if err := idx.LogQuery(query); err != nil {
+			t.Fatalf("mode %q: LogQuery() error = %v", tt.mode, err)
+		}
+		summaries, err := idx.Queries(0)
+		idx.Close()
+		if err != nil {
+			t.Fatalf("mode %q: Queries() error = %v", tt.mode, err)
+		}
+
+		if tt.wantQuery == "" {
+			if len(summaries) != 0 {
+				t.Errorf("mode %q: logged %+v, want nothing", tt.mode, summaries)
+			}
+			continue
+		}
+		if len(summaries) != 1 || summaries[0].Query != tt.wantQuery || summaries[0].AvgTopScore != 0.5 ||
+			summaries[0].Hashed != (tt.mode == embedding.QueryLogHashed) {
+			t.Errorf("mode %q: logged %+v, want %q with top score 0.5", tt.mode, summaries, tt.wantQuery)
+		}
+	}
+}
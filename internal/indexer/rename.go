@@ -0,0 +1,73 @@
+package indexer
+
+import (
+	"maps"
+	"path/filepath"
+	"sort"
+
+	"codetect/internal/chunker"
+	"codetect/internal/merkle"
+)
+
+// fileMove is a file moved from oldPath to newPath without changing its
+// content.
+type fileMove struct {
+	oldPath string
+	newPath string
+}
+
+// acceptMoves returns the renames found by merkle.Diff as moves, for
+// files whose chunks do not depend on the path change (see
+// chunksMoveWith). Other renames, and all of them unless
+// Config.TrackRenames is set, go back into changes as a deletion and an
+// addition, so the file is reindexed; changes.Renamed keeps the moves.
+func (idx *Indexer) acceptMoves(newTree *merkle.Tree, changes *merkle.Changes) []fileMove {
+	var moves []fileMove
+	var kept []merkle.RenamePair
+	for _, r := range changes.Renamed {
+		if idx.config.TrackRenames {
+			if node := newTree.Find(r.NewPath); node != nil && idx.chunksMoveWith(r.OldPath, r.NewPath, node.Size) {
+				moves = append(moves, fileMove{oldPath: r.OldPath, newPath: r.NewPath})
+				kept = append(kept, r)
+				continue
+			}
+		}
+		changes.Added = append(changes.Added, r.NewPath)
+		changes.Deleted = append(changes.Deleted, r.OldPath)
+	}
+	if len(kept) < len(changes.Renamed) {
+		sort.Strings(changes.Added)
+		sort.Strings(changes.Deleted)
+	}
+	changes.Renamed = kept
+	return moves
+}
+
+// chunksMoveWith reports whether a file of the given size moved from
+// oldPath to newPath keeps the exact chunks, embedding inputs and metadata
+// it was indexed with, so its locations can be moved as they are. Anything
+// derived from the path must match: the language, the skip decision, the
+// chunk metadata, and summaries, which may mention the path. A custom
+// chunker may chunk by path in any way, and with EmbedPaths the embedder
+// input holds the path itself, so those files are always reindexed.
+func (idx *Indexer) chunksMoveWith(oldPath, newPath string, size int64) bool {
+	if idx.summarizer() != nil || idx.config.Chunker != nil || idx.config.EmbedPaths {
+		return false
+	}
+	if filepath.Ext(oldPath) != filepath.Ext(newPath) {
+		return false
+	}
+	overrides := idx.astChunker.LanguageOverrides
+	if chunker.ResolveLanguageConfig(oldPath, overrides) != chunker.ResolveLanguageConfig(newPath, overrides) {
+		return false
+	}
+	filter := idx.skipFilter()
+	if filter.Check(oldPath, size, nil) != filter.Check(newPath, size, nil) {
+		return false
+	}
+	if idx.config.ChunkMetadata != nil &&
+		!maps.Equal(idx.config.ChunkMetadata(oldPath), idx.config.ChunkMetadata(newPath)) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,125 @@
+package indexer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIndexer_TrackRenames(t *testing.T) {
+	shared := "package a\n\nfunc Shared() int {\n\treturn 0\n}\n"
+	repo := writeRepo(t, map[string]string{
+		"a.go":     "package a\n\nfunc A() int {\n\treturn 1\n}\n",
+		"copy1.go": shared,
+		"copy2.go": shared,
+		"notes.go": "package a\n\nfunc Notes() int {\n\treturn 2\n}\n",
+	})
+	embedder := &countingEmbedder{}
+	idx, err := New(repo, &Config{
+		DBType:       "sqlite",
+		Dimensions:   4,
+		Embedder:     embedder,
+		TrackRenames: true,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+	ctx := context.Background()
+
+	if _, err := idx.Index(ctx, IndexOptions{}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	if _, err := idx.database.Exec("UPDATE chunk_locations SET created_at = 1000"); err != nil {
+		t.Fatalf("backdating locations: %v", err)
+	}
+	embedded := embedder.texts
+
+	move := func(from, to string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(repo, to)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(filepath.Join(repo, from), filepath.Join(repo, to)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Pure moves, including one of two files with the same content
+	move("a.go", filepath.Join("pkg", "a.go"))
+	move("copy1.go", filepath.Join("pkg", "copy1.go"))
+	result, err := idx.Index(ctx, IndexOptions{})
+	if err != nil {
+		t.Fatalf("Index() after moves error = %v", err)
+	}
+	if result.FilesRenamed != 2 || result.FilesProcessed != 0 || result.FilesDeleted != 0 {
+		t.Errorf("result = %+v, want 2 renamed and nothing processed or deleted", result)
+	}
+	if embedder.texts != embedded || result.ChunksCreated != 0 {
+		t.Errorf("moves embedded %d texts and created %d chunks, want none",
+			embedder.texts-embedded, result.ChunksCreated)
+	}
+
+	for _, path := range []string{filepath.Join("pkg", "a.go"), filepath.Join("pkg", "copy1.go"), "copy2.go"} {
+		locs, err := idx.Locations().GetByPath(idx.RepoPath(), path)
+		if err != nil || len(locs) == 0 {
+			t.Errorf("%s has no locations: %v", path, err)
+			continue
+		}
+		if locs[0].CreatedAt.Unix() != 1000 {
+			t.Errorf("%s CreatedAt = %v, want it kept", path, locs[0].CreatedAt)
+		}
+	}
+	for _, path := range []string{"a.go", "copy1.go"} {
+		if locs, _ := idx.Locations().GetByPath(idx.RepoPath(), path); len(locs) != 0 {
+			t.Errorf("%s still has %d locations", path, len(locs))
+		}
+	}
+	if syms, _ := idx.FileSymbols(filepath.Join("pkg", "a.go")); len(syms) != 1 || syms[0].Name != "A" {
+		t.Errorf("pkg/a.go symbols = %+v, want [A]", syms)
+	}
+
+	// A new extension changes how the file is chunked, so it is reindexed
+	move("notes.go", "notes.txt")
+	result, err = idx.Index(ctx, IndexOptions{})
+	if err != nil {
+		t.Fatalf("Index() after extension change error = %v", err)
+	}
+	if result.FilesRenamed != 0 || result.FilesProcessed != 1 || result.FilesDeleted != 1 {
+		t.Errorf("result = %+v, want notes.txt reindexed", result)
+	}
+}
+
+func TestIndexer_RenamesReindexedWithoutTrackRenames(t *testing.T) {
+	repo := writeRepo(t, map[string]string{
+		"a.go": "package a\n\nfunc A() int {\n\treturn 1\n}\n",
+	})
+	idx, err := New(repo, &Config{
+		DBType:     "sqlite",
+		Dimensions: 4,
+		Embedder:   &countingEmbedder{},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+	ctx := context.Background()
+
+	if _, err := idx.Index(ctx, IndexOptions{}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	if err := os.Rename(filepath.Join(repo, "a.go"), filepath.Join(repo, "b.go")); err != nil {
+		t.Fatal(err)
+	}
+	result, err := idx.Index(ctx, IndexOptions{})
+	if err != nil {
+		t.Fatalf("Index() after rename error = %v", err)
+	}
+	if result.FilesRenamed != 0 || result.FilesProcessed != 1 || result.FilesDeleted != 1 {
+		t.Errorf("result = %+v, want b.go reindexed and a.go deleted", result)
+	}
+	if locs, _ := idx.Locations().GetByPath(idx.RepoPath(), "b.go"); len(locs) == 0 {
+		t.Error("b.go has no locations")
+	}
+}
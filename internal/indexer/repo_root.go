@@ -0,0 +1,130 @@
+package indexer
+
+import (
+	"fmt"
+
+	"codetect/internal/db"
+	"codetect/internal/embedding"
+	"codetect/internal/merkle"
+)
+
+// repoRootTables returns the tables besides chunk_locations that key rows
+// by repository root.
+func (idx *Indexer) repoRootTables() []string {
+	tables := []string{"chunk_location_metadata", "index_runs", "index_models", "query_log"}
+	if _, ok := idx.merkleStore.(*merkle.DBStore); ok {
+		tables = append(tables, "merkle_nodes", "merkle_trees")
+	}
+	return tables
+}
+
+// migrateRepoRoot moves the rows earlier versions stored under legacyRoot,
+// the plain absolute path they keyed this repository by, to the
+// normalized root (see config.NormalizeRepoRoot), recomputing chunk IDs,
+// which depend on the root. If the repository is already indexed under the
+// normalized root, the legacy rows are a stale duplicate and are deleted
+// instead. Moved rows are not found again, so this is safe on every open.
+func (idx *Indexer) migrateRepoRoot(legacyRoot string) error {
+	schema := db.NewSchemaBuilder(idx.database, idx.dialect)
+	tables := append([]string{"chunk_locations"}, idx.repoRootTables()...)
+
+	found := false
+	for _, table := range tables {
+		rows, err := idx.database.Query(schema.SubstitutePlaceholders(
+			"SELECT 1 FROM "+table+" WHERE repo_root = ? LIMIT 1"), legacyRoot)
+		if err != nil {
+			return fmt.Errorf("checking %s: %w", table, err)
+		}
+		found = rows.Next()
+		rows.Close()
+		if found {
+			break
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	indexed, err := idx.locations.CountByRepo(idx.repoPath)
+	if err != nil {
+		return err
+	}
+
+	tx, err := idx.database.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if indexed > 0 {
+		for _, table := range tables {
+			if _, err := tx.Exec(schema.SubstitutePlaceholders(
+				"DELETE FROM "+table+" WHERE repo_root = ?"), legacyRoot); err != nil {
+				return fmt.Errorf("deleting legacy rows from %s: %w", table, err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("committing transaction: %w", err)
+		}
+		idx.logger.Info("deleted duplicate index under legacy repository root", "legacy_root", legacyRoot, "repo_root", idx.repoPath)
+		return nil
+	}
+
+	// Rows of the normalized root hold no locations, so the legacy rows
+	// replace them
+	for _, table := range idx.repoRootTables() {
+		if _, err := tx.Exec(schema.SubstitutePlaceholders(
+			"DELETE FROM "+table+" WHERE repo_root = ?"), idx.repoPath); err != nil {
+			return fmt.Errorf("clearing %s: %w", table, err)
+		}
+		if _, err := tx.Exec(schema.SubstitutePlaceholders(
+			"UPDATE "+table+" SET repo_root = ? WHERE repo_root = ?"), idx.repoPath, legacyRoot); err != nil {
+			return fmt.Errorf("moving rows of %s: %w", table, err)
+		}
+	}
+	if err := idx.moveLocations(tx, schema, legacyRoot); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+	idx.logger.Info("moved index to normalized repository root", "legacy_root", legacyRoot, "repo_root", idx.repoPath)
+	return nil
+}
+
+// moveLocations moves the chunk locations of legacyRoot to the
+// normalized root in tx, with their chunk IDs.
+func (idx *Indexer) moveLocations(tx db.Tx, schema *db.SchemaBuilder, legacyRoot string) error {
+	rows, err := tx.Query(schema.SubstitutePlaceholders(
+		"SELECT id, path, start_line, content_hash FROM chunk_locations WHERE repo_root = ?"), legacyRoot)
+	if err != nil {
+		return fmt.Errorf("querying legacy locations: %w", err)
+	}
+	type move struct {
+		id      int64
+		chunkID string
+	}
+	var moves []move
+	for rows.Next() {
+		var id int64
+		var path, contentHash string
+		var startLine int
+		if err := rows.Scan(&id, &path, &startLine, &contentHash); err != nil {
+			rows.Close()
+			return fmt.Errorf("scanning legacy location: %w", err)
+		}
+		moves = append(moves, move{id, embedding.ChunkID(idx.repoPath, path, startLine, contentHash)})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("querying legacy locations: %w", err)
+	}
+
+	updateSQL := schema.SubstitutePlaceholders("UPDATE chunk_locations SET repo_root = ?, chunk_id = ? WHERE id = ?")
+	for _, m := range moves {
+		if _, err := tx.Exec(updateSQL, idx.repoPath, m.chunkID, m.id); err != nil {
+			return fmt.Errorf("moving location: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package indexer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"codetect/internal/config"
+	"codetect/internal/embedding"
+)
+
+func TestIndexer_MigrateRepoRoot(t *testing.T) {
+	repo := writeRepo(t, map[string]string{
+		"a.go": "package a\n\nfunc A() int {\n\treturn 1\n}\n",
+		"b.go": "package a\n\nfunc B() int {\n\treturn 2\n}\n",
+	})
+	root, err := config.NormalizeRepoRoot(repo)
+	if err != nil {
+		t.Fatalf("NormalizeRepoRoot() error = %v", err)
+	}
+	// Earlier versions keyed an index opened through a symlink by the link
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(repo, link); err != nil {
+		t.Skipf("creating symlink: %v", err)
+	}
+	open := func() *Indexer {
+		t.Helper()
+		idx, err := New(link, &Config{
+			DBType:     "sqlite",
+			Dimensions: len(embedTokens),
+			Embedder:   &tokenEmbedder{},
+		})
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		return idx
+	}
+	count := func(idx *Indexer, repoRoot string) int {
+		t.Helper()
+		n, err := idx.Locations().CountByRepo(repoRoot)
+		if err != nil {
+			t.Fatalf("CountByRepo() error = %v", err)
+		}
+		return n
+	}
+
+	idx := open()
+	if _, err := idx.Index(context.Background(), IndexOptions{}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	indexed := count(idx, root)
+	if indexed == 0 {
+		t.Fatal("Index() stored no locations")
+	}
+	for _, table := range []string{"chunk_locations", "index_runs"} {
+		if _, err := idx.database.Exec("UPDATE "+table+" SET repo_root = ?", link); err != nil {
+			t.Fatalf("moving %s to the legacy root: %v", table, err)
+		}
+	}
+	idx.Close()
+
+	// Legacy rows move to the normalized root, with new chunk IDs
+	idx = open()
+	if got := count(idx, root); got != indexed {
+		t.Errorf("locations under normalized root = %d, want %d", got, indexed)
+	}
+	if got := count(idx, link); got != 0 {
+		t.Errorf("locations under legacy root = %d, want 0", got)
+	}
+	locs, err := idx.Locations().GetByRepo(root)
+	if err != nil {
+		t.Fatalf("GetByRepo() error = %v", err)
+	}
+	for _, loc := range locs {
+		if want := embedding.ChunkID(root, loc.Path, loc.StartLine, loc.ContentHash); loc.ChunkID != want {
+			t.Errorf("%s:%d chunk ID = %s, want %s", loc.Path, loc.StartLine, loc.ChunkID, want)
+		}
+	}
+	if runs, err := idx.History(10); err != nil || len(runs) != 1 {
+		t.Errorf("History() = %d runs (err %v), want the moved run", len(runs), err)
+	}
+
+	// A legacy duplicate of an index under the normalized root is dropped
+	if _, err := idx.database.Exec(`INSERT INTO chunk_locations
+		(repo_root, path, start_line, end_line, content_hash, created_at)
+		VALUES (?, 'a.go', 1, 5, 'stale', 0)`, link); err != nil {
+		t.Fatalf("inserting legacy row: %v", err)
+	}
+	idx.Close()
+
+	idx = open()
+	defer idx.Close()
+	if got := count(idx, link); got != 0 {
+		t.Errorf("locations under legacy root = %d, want 0", got)
+	}
+	if got := count(idx, root); got != indexed {
+		t.Errorf("locations under normalized root = %d, want %d", got, indexed)
+	}
+}
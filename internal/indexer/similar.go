@@ -0,0 +1,18 @@
+package indexer
+
+import (
+	"context"
+
+	"codetect/internal/embedding"
+)
+
+// FindSimilarFunctions groups the repository's near-duplicate functions,
+// those whose stored vectors are close but whose content differs, as
+// candidates for refactoring; see embedding.CacheSearcher.FindSimilar.
+// opts.RepoRoot defaults to this repository.
+func (idx *Indexer) FindSimilarFunctions(ctx context.Context, opts embedding.SimilarOptions) ([]embedding.SimilarGroup, error) {
+	if opts.RepoRoot == "" {
+		opts.RepoRoot = idx.repoPath
+	}
+	return idx.Searcher().FindSimilar(ctx, opts)
+}
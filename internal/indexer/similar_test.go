@@ -0,0 +1,56 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+
+	"codetect/internal/embedding"
+)
+
+func TestIndexer_FindSimilarFunctions(t *testing.T) {
+	total := "func Total(xs []int) int {\n\tsum := 0\n\tfor _, x := range xs {\n\t\tsum += x\n\t}\n\treturn sum\n}\n"
+	repo := writeRepo(t, map[string]string{
+		"math.go": "package a\n\n" + total,
+		"add.go": "package a\n\n" +
+			"func Add(values []float64) float64 {\n\tvar acc float64\n\tfor _, v := range values {\n\t\tacc += v\n\t}\n\treturn acc\n}\n",
+		"fetch.go": "package a\n\nimport \"net/http\"\n\n" +
+			"func Fetch(url string) error {\n\tresp, err := http.Get(url)\n\tif err != nil {\n\t\treturn err\n\t}\n\treturn resp.Body.Close()\n}\n",
+		"stats/copy.go": "package stats\n\n" + total,
+	})
+	idx, err := New(repo, &Config{
+		DBType:     "sqlite",
+		Dimensions: len(embedTokens),
+		Embedder:   &tokenEmbedder{},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+	ctx := context.Background()
+
+	if _, err := idx.Index(ctx, IndexOptions{}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+
+	groups, err := idx.FindSimilarFunctions(ctx, embedding.SimilarOptions{})
+	if err != nil {
+		t.Fatalf("FindSimilarFunctions() error = %v", err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("got %d groups, want 1: %+v", len(groups), groups)
+	}
+	var names []string
+	for _, fn := range groups[0].Functions {
+		names = append(names, fn.Path+":"+fn.NodeName)
+	}
+	want := []string{"add.go:Add", "math.go:Total", "stats/copy.go:Total"}
+	if len(names) != len(want) {
+		t.Fatalf("group = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("group = %v, want %v", names, want)
+			break
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SimulatedMove is the projected effect of moving one indexed file.
+type SimulatedMove struct {
+	OldPath string `json:"old_path"`
+	NewPath string `json:"new_path"`
+
+	// Renamed is set when rename detection would move the file's
+	// locations as they are, keeping every embedding. Otherwise the file
+	// is reindexed at its new path.
+	Renamed   bool `json:"renamed"`
+	Locations int  `json:"locations"` // Locations the file has now
+
+	// Chunks the file would have at its new path, and how many of them
+	// already have an embedding cached. Unset for renamed files.
+	Chunks   int        `json:"chunks,omitempty"`
+	CacheHit int        `json:"cache_hits,omitempty"`
+	Skipped  SkipReason `json:"skipped,omitempty"` // Left out of the index at its new path
+}
+
+// MoveSimulation is the projected churn of moving indexed files, as
+// reported by SimulateMoves.
+type MoveSimulation struct {
+	Files []SimulatedMove `json:"files"`
+
+	FilesRenamed   int `json:"files_renamed"`
+	FilesReindexed int `json:"files_reindexed"`
+
+	// Locations whose path would be updated in place, and the distinct
+	// embeddings they keep
+	LocationsMoved   int `json:"locations_moved"`
+	EmbeddingsReused int `json:"embeddings_reused"`
+
+	// Distinct chunks of reindexed files that are already cached, and
+	// those that would have to be embedded
+	EmbeddingsCached  int `json:"embeddings_cached"`
+	EmbeddingsToEmbed int `json:"embeddings_to_embed"`
+
+	// Mapping sources that match no indexed file
+	Unmatched []string `json:"unmatched,omitempty"`
+}
+
+// SimulateMoves reports how the index would change if files were moved
+// as mapping describes, without moving them or modifying the index. Each
+// key is a repo-relative file or directory path; a directory moves every
+// indexed file under it. Files are read at their current paths and
+// chunked as they would be at the new ones, so the projection assumes
+// their content does not change in the move.
+//
+// A file is projected as renamed when Index would detect the move (see
+// Config.TrackRenames): its chunks do not depend on the path and its new
+// path does not replace a file that stays. Any other moved file is
+// reindexed, embedding only the chunks missing from the cache.
+func (idx *Indexer) SimulateMoves(ctx context.Context, mapping map[string]string) (*MoveSimulation, error) {
+	tree, err := idx.merkleStore.Load()
+	if err != nil {
+		return nil, fmt.Errorf("loading merkle tree: %w", err)
+	}
+	if tree == nil {
+		return nil, errors.New("repository has not been indexed")
+	}
+
+	indexed := idx.collectAllFiles(tree.Root)
+	moves, unmatched, err := expandMoves(indexed, mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	moving := make(map[string]bool, len(moves))
+	for _, m := range moves {
+		moving[m.oldPath] = true
+	}
+
+	sim := &MoveSimulation{Unmatched: unmatched}
+	reused := make(map[string]bool)
+	reindexed := make(map[string]bool)
+	for _, m := range moves {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		file := SimulatedMove{OldPath: m.oldPath, NewPath: m.newPath}
+
+		hashes, err := idx.locations.GetHashesForPath(idx.repoPath, m.oldPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading locations of %s: %w", m.oldPath, err)
+		}
+		file.Locations, err = idx.locations.CountByPath(idx.repoPath, m.oldPath)
+		if err != nil {
+			return nil, fmt.Errorf("counting locations of %s: %w", m.oldPath, err)
+		}
+
+		replaces := tree.Find(m.newPath) != nil && !moving[m.newPath]
+		if idx.config.TrackRenames && !replaces &&
+			idx.chunksMoveWith(m.oldPath, m.newPath, tree.Find(m.oldPath).Size) {
+			file.Renamed = true
+			sim.FilesRenamed++
+			sim.LocationsMoved += file.Locations
+			for _, hash := range hashes {
+				reused[hash] = true
+			}
+			sim.Files = append(sim.Files, file)
+			continue
+		}
+
+		sim.FilesReindexed++
+		content, _, err := idx.source.Read(ctx, filepath.ToSlash(m.oldPath))
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", m.oldPath, err)
+		}
+		chunks, err := idx.chunkContent(ctx, m.newPath, content)
+		var skipErr *SkipError
+		if errors.As(err, &skipErr) {
+			file.Skipped = skipErr.Reason
+			sim.Files = append(sim.Files, file)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("chunking %s: %w", m.newPath, err)
+		}
+
+		var keys []string
+		for _, chunk := range chunks {
+			if chunk.Content != "" && !chunk.LocationOnly {
+				keys = append(keys, chunk.CacheKey())
+				reindexed[chunk.CacheKey()] = true
+			}
+		}
+		missing, err := idx.pipeline.MissingEmbeddings(keys)
+		if err != nil {
+			return nil, err
+		}
+		file.Chunks = len(chunks)
+		file.CacheHit = len(keys) - missing
+		sim.Files = append(sim.Files, file)
+	}
+
+	sim.EmbeddingsReused = len(reused)
+	keys := make([]string, 0, len(reindexed))
+	for key := range reindexed {
+		keys = append(keys, key)
+	}
+	missing, err := idx.pipeline.MissingEmbeddings(keys)
+	if err != nil {
+		return nil, err
+	}
+	sim.EmbeddingsToEmbed = missing
+	sim.EmbeddingsCached = len(keys) - missing
+	return sim, nil
+}
+
+// expandMoves resolves mapping against the indexed file paths into file
+// moves, in old path order, and returns the mapping keys that match no
+// file. A file under several mapped directories moves with the deepest
+// one.
+func expandMoves(indexed []string, mapping map[string]string) ([]fileMove, []string, error) {
+	clean := make(map[string]string, len(mapping))
+	for from, to := range mapping {
+		from, to = filepath.Clean(filepath.FromSlash(from)), filepath.Clean(filepath.FromSlash(to))
+		if from == "." || to == "." || filepath.IsAbs(from) || filepath.IsAbs(to) {
+			return nil, nil, fmt.Errorf("invalid move %q -> %q: paths must be relative to the repository", from, to)
+		}
+		clean[from] = to
+	}
+
+	matched := make(map[string]bool)
+	targets := make(map[string]string)
+	var moves []fileMove
+	for _, path := range indexed {
+		from, to, ok := mappedPrefix(path, clean)
+		if !ok {
+			continue
+		}
+		matched[from] = true
+		newPath := to + strings.TrimPrefix(path, from)
+		if newPath == path {
+			continue
+		}
+		if other, dup := targets[newPath]; dup {
+			return nil, nil, fmt.Errorf("%s and %s would both move to %s", other, path, newPath)
+		}
+		targets[newPath] = path
+		moves = append(moves, fileMove{oldPath: path, newPath: newPath})
+	}
+	sort.Slice(moves, func(i, j int) bool { return moves[i].oldPath < moves[j].oldPath })
+
+	var unmatched []string
+	for from := range clean {
+		if !matched[from] {
+			unmatched = append(unmatched, filepath.ToSlash(from))
+		}
+	}
+	sort.Strings(unmatched)
+	return moves, unmatched, nil
+}
+
+// mappedPrefix returns the longest mapping key that is path or one of
+// its parent directories, and the path it maps to.
+func mappedPrefix(path string, mapping map[string]string) (from, to string, ok bool) {
+	for p := path; p != "." && p != string(filepath.Separator); p = filepath.Dir(p) {
+		if to, ok := mapping[p]; ok {
+			return p, to, true
+		}
+	}
+	return "", "", false
+}
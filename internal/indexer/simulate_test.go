@@ -0,0 +1,168 @@
+package indexer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIndexer_SimulateMoves(t *testing.T) {
+	repo := writeRepo(t, map[string]string{
+		"a.go":       "package a\n\nfunc A() int {\n\treturn 1\n}\n",
+		"lib/c.go":   "package lib\n\nfunc C() int {\n\treturn 3\n}\n",
+		"lib/d.go":   "package lib\n\nfunc D() int {\n\treturn 4\n}\n",
+		"keep/e.go":  "package keep\n\nfunc E() int {\n\treturn 5\n}\n",
+		"notes.txt":  "release notes\n",
+		"docs/x.txt": "docs\n",
+	})
+	embedder := &countingEmbedder{}
+	idx, err := New(repo, &Config{
+		DBType:       "sqlite",
+		Dimensions:   4,
+		Embedder:     embedder,
+		TrackRenames: true,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+	ctx := context.Background()
+
+	if _, err := idx.Index(ctx, IndexOptions{}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	embedded := embedder.texts
+
+	// lib moves as a directory and keeps its embeddings; a.go changes
+	// language, so it is reindexed and its chunks embedded again
+	mapping := map[string]string{
+		"lib":     "pkg/lib",
+		"a.go":    "a.py",
+		"missing": "elsewhere",
+	}
+	sim, err := idx.SimulateMoves(ctx, mapping)
+	if err != nil {
+		t.Fatalf("SimulateMoves() error = %v", err)
+	}
+
+	libHashes := make(map[string]bool)
+	libLocations := 0
+	for _, path := range []string{filepath.Join("lib", "c.go"), filepath.Join("lib", "d.go")} {
+		locs, err := idx.Locations().GetByPath(repo, path)
+		if err != nil || len(locs) == 0 {
+			t.Fatalf("GetByPath(%s) = %v, %v", path, locs, err)
+		}
+		libLocations += len(locs)
+		for _, loc := range locs {
+			libHashes[loc.ContentHash] = true
+		}
+	}
+
+	if len(sim.Files) != 3 || sim.FilesRenamed != 2 || sim.FilesReindexed != 1 {
+		t.Fatalf("SimulateMoves() files = %+v, want 2 renamed and 1 reindexed", sim.Files)
+	}
+	want := []SimulatedMove{
+		{OldPath: "a.go", NewPath: "a.py"},
+		{OldPath: filepath.Join("lib", "c.go"), NewPath: filepath.Join("pkg", "lib", "c.go"), Renamed: true},
+		{OldPath: filepath.Join("lib", "d.go"), NewPath: filepath.Join("pkg", "lib", "d.go"), Renamed: true},
+	}
+	for i, w := range want {
+		got := sim.Files[i]
+		if got.OldPath != w.OldPath || got.NewPath != w.NewPath || got.Renamed != w.Renamed {
+			t.Errorf("Files[%d] = %+v, want %s -> %s renamed=%v", i, got, w.OldPath, w.NewPath, w.Renamed)
+		}
+		if got.Locations == 0 {
+			t.Errorf("Files[%d] has no locations", i)
+		}
+	}
+	if sim.LocationsMoved != libLocations || sim.EmbeddingsReused != len(libHashes) {
+		t.Errorf("moved %d locations reusing %d embeddings, want %d and %d",
+			sim.LocationsMoved, sim.EmbeddingsReused, libLocations, len(libHashes))
+	}
+	if sim.EmbeddingsToEmbed == 0 || sim.EmbeddingsCached != 0 {
+		t.Errorf("reindexing a.py embeds %d and reuses %d cached, want all embedded",
+			sim.EmbeddingsToEmbed, sim.EmbeddingsCached)
+	}
+	if sim.Files[0].CacheHit != 0 || sim.Files[0].Chunks == 0 {
+		t.Errorf("a.py = %+v, want chunks and no cache hits", sim.Files[0])
+	}
+	if len(sim.Unmatched) != 1 || sim.Unmatched[0] != "missing" {
+		t.Errorf("Unmatched = %q, want [missing]", sim.Unmatched)
+	}
+
+	// The simulation changed nothing
+	if embedder.texts != embedded {
+		t.Errorf("SimulateMoves() embedded %d texts", embedder.texts-embedded)
+	}
+	for _, path := range []string{"a.go", filepath.Join("lib", "c.go")} {
+		if n, err := idx.Locations().CountByPath(repo, path); err != nil || n == 0 {
+			t.Errorf("%s lost its locations (%v)", path, err)
+		}
+	}
+
+	// Performing the moves matches the projection
+	for from, to := range map[string]string{"lib": filepath.Join("pkg", "lib"), "a.go": "a.py"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(repo, to)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(filepath.Join(repo, from), filepath.Join(repo, to)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	result, err := idx.Index(ctx, IndexOptions{})
+	if err != nil {
+		t.Fatalf("Index() after moves error = %v", err)
+	}
+	if result.FilesRenamed != sim.FilesRenamed || result.FilesProcessed != sim.FilesReindexed {
+		t.Errorf("Index() renamed %d and processed %d files, projected %d and %d",
+			result.FilesRenamed, result.FilesProcessed, sim.FilesRenamed, sim.FilesReindexed)
+	}
+	if result.ChunksEmbedded != sim.EmbeddingsToEmbed {
+		t.Errorf("Index() embedded %d chunks, projected %d", result.ChunksEmbedded, sim.EmbeddingsToEmbed)
+	}
+}
+
+func TestIndexer_SimulateMovesWithoutTrackRenames(t *testing.T) {
+	repo := writeRepo(t, map[string]string{
+		"a.go":     "package a\n\nfunc A() int {\n\treturn 1\n}\n",
+		"lib/c.go": "package lib\n\nfunc C() int {\n\treturn 3\n}\n",
+	})
+	idx, err := New(repo, &Config{
+		DBType:     "sqlite",
+		Dimensions: 4,
+		Embedder:   &countingEmbedder{},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+	ctx := context.Background()
+
+	if _, err := idx.SimulateMoves(ctx, map[string]string{"lib": "pkg"}); err == nil {
+		t.Error("SimulateMoves() before indexing succeeded")
+	}
+	if _, err := idx.Index(ctx, IndexOptions{}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+
+	// Reindexed, but every chunk is found in the cache
+	sim, err := idx.SimulateMoves(ctx, map[string]string{"lib": "pkg"})
+	if err != nil {
+		t.Fatalf("SimulateMoves() error = %v", err)
+	}
+	hashes, err := idx.Locations().GetHashesForPath(repo, filepath.Join("lib", "c.go"))
+	if err != nil {
+		t.Fatalf("GetHashesForPath() error = %v", err)
+	}
+	if sim.FilesRenamed != 0 || sim.FilesReindexed != 1 || sim.LocationsMoved != 0 {
+		t.Errorf("SimulateMoves() = %+v, want one file reindexed", sim)
+	}
+	if sim.EmbeddingsCached != len(hashes) || sim.EmbeddingsToEmbed != 0 {
+		t.Errorf("cached %d and to embed %d, want %d and 0", sim.EmbeddingsCached, sim.EmbeddingsToEmbed, len(hashes))
+	}
+
+	if _, err := idx.SimulateMoves(ctx, map[string]string{"a.go": "b.go", filepath.Join("lib", "c.go"): "b.go"}); err == nil {
+		t.Error("SimulateMoves() with two files moved to one path succeeded")
+	}
+}
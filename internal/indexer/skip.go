@@ -0,0 +1,324 @@
+package indexer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SkipReason explains why a file was left out of the index.
+type SkipReason string
+
+const (
+	SkipUnsupported SkipReason = "unsupported_extension"
+	SkipTooLarge    SkipReason = "too_large"
+	SkipBinary      SkipReason = "binary"
+	SkipGitignored  SkipReason = "gitignored"
+	SkipGenerated   SkipReason = "generated"
+	SkipTest        SkipReason = "test"
+
+	// SkipUnparseable marks files the chunker could not walk safely, such
+	// as pathologically nested input. See chunker.ErrUnparseable.
+	SkipUnparseable SkipReason = "unparseable"
+)
+
+const (
+	// DefaultMaxFileSize is the largest file indexed when Config.MaxFileSize
+	// is unset. Larger source files are almost always generated or data.
+	DefaultMaxFileSize = 1 << 20
+
+	// MaxSkipSamples is how many example paths a report keeps per reason.
+	MaxSkipSamples = 5
+
+	// sniffLen is how much of a file is inspected for binary content and
+	// generated-code markers, matching git's binary detection window.
+	sniffLen = 8000
+)
+
+// generatedSuffixes are file name endings of common generated sources.
+var generatedSuffixes = []string{
+	".pb.go", ".pb.gw.go", "_generated.go", ".gen.go", "_gen.go",
+	".min.js", ".min.css", ".bundle.js",
+	"_pb2.py", "_pb2_grpc.py",
+	".designer.cs", ".g.dart", ".freezed.dart",
+}
+
+// testDirs are directory names holding only tests by convention.
+var testDirs = map[string]bool{
+	"test": true, "tests": true, "__tests__": true, "spec": true, "testdata": true,
+}
+
+// testSuffixes are file name endings of tests, lower-cased.
+var testSuffixes = []string{
+	"_test.go", "_test.py", "_test.rb", "_spec.rb",
+	".test.js", ".test.jsx", ".test.ts", ".test.tsx", ".spec.js", ".spec.jsx", ".spec.ts", ".spec.tsx",
+}
+
+// testClassSuffixes are file name endings of tests in languages naming
+// files after classes, matched case-sensitively so Contest.java is not one.
+var testClassSuffixes = []string{
+	"Test.java", "Tests.java", "Test.kt", "Tests.kt", "Test.cs", "Tests.cs",
+	"Test.swift", "Tests.swift", "Test.scala", "Spec.scala",
+}
+
+// generatedMarkers appear in the header of generated files. The first is
+// the Go convention; the others are used by Facebook tooling and Thrift.
+var generatedMarkers = [][]byte{
+	[]byte("Code generated"),
+	[]byte("@generated"),
+	[]byte("Autogenerated by"),
+}
+
+// SkipFilter decides which files are left out of the index.
+type SkipFilter struct {
+	// SkipNonSource leaves out files larger than MaxFileSize, binary
+	// files and generated files. Without it they are indexed like any
+	// other file.
+	SkipNonSource bool
+
+	// MaxFileSize is the largest file in bytes that is indexed with
+	// SkipNonSource. Zero means DefaultMaxFileSize; negative disables the
+	// limit.
+	MaxFileSize int64
+
+	// Supported reports whether a path has a usable extension.
+	// Nil accepts every extension.
+	Supported func(path string) bool
+
+	// ExcludeTests skips files IsTestFile recognizes as tests.
+	ExcludeTests bool
+}
+
+// Check returns why a file should be skipped, or "" if it should be indexed.
+// head is the start of the file content; only the first few KB are examined.
+func (f SkipFilter) Check(path string, size int64, head []byte) SkipReason {
+	if f.Supported != nil && !f.Supported(path) {
+		return SkipUnsupported
+	}
+	if f.ExcludeTests && IsTestFile(path) {
+		return SkipTest
+	}
+	if !f.SkipNonSource {
+		return ""
+	}
+
+	limit := f.MaxFileSize
+	if limit == 0 {
+		limit = DefaultMaxFileSize
+	}
+	if limit > 0 && size > limit {
+		return SkipTooLarge
+	}
+
+	if len(head) > sniffLen {
+		head = head[:sniffLen]
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return SkipBinary
+	}
+	if IsGenerated(path, head) {
+		return SkipGenerated
+	}
+	return ""
+}
+
+// CheckFile is like Check but reads only the size and first few KB of the
+// file at absPath. relPath is used for name-based rules. Unreadable files
+// are not classified.
+func (f SkipFilter) CheckFile(absPath, relPath string) SkipReason {
+	if f.Supported != nil && !f.Supported(relPath) {
+		return SkipUnsupported
+	}
+	if !f.SkipNonSource {
+		return f.Check(relPath, 0, nil)
+	}
+
+	file, err := os.Open(absPath)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return ""
+	}
+	head := make([]byte, sniffLen)
+	n, _ := io.ReadFull(file, head)
+	return f.Check(relPath, info.Size(), head[:n])
+}
+
+// IsGenerated reports whether a file looks machine-generated, either by its
+// name or by a marker comment near the top of its content.
+func IsGenerated(path string, head []byte) bool {
+	name := strings.ToLower(filepath.Base(path))
+	for _, suffix := range generatedSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+
+	// Markers only count in the header, before any real code
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	for _, marker := range generatedMarkers {
+		if bytes.Contains(head, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTestFile reports whether a repo-relative path is a test by the naming
+// conventions of common languages (foo_test.go, test_foo.py, Foo.test.ts,
+// FooTest.java) or lies in a test directory (test/, tests/, __tests__/,
+// spec/, testdata/).
+func IsTestFile(path string) bool {
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	for _, dir := range parts[:len(parts)-1] {
+		if testDirs[strings.ToLower(dir)] {
+			return true
+		}
+	}
+	name := parts[len(parts)-1]
+	for _, suffix := range testClassSuffixes {
+		if strings.HasSuffix(name, suffix) && len(name) > len(suffix) {
+			return true
+		}
+	}
+	name = strings.ToLower(name)
+	if strings.HasPrefix(name, "test_") && strings.HasSuffix(name, ".py") {
+		return true
+	}
+	for _, suffix := range testSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// SkipError is returned when a file is deliberately left out of the index.
+type SkipError struct {
+	Path   string
+	Reason SkipReason
+}
+
+func (e *SkipError) Error() string {
+	return fmt.Sprintf("skipped %s: %s", e.Path, e.Reason)
+}
+
+// skipFilter returns the filter applied to files before chunking. Every
+// extension is accepted; files without a grammar get line-based chunks.
+func (idx *Indexer) skipFilter() SkipFilter {
+	return SkipFilter{
+		SkipNonSource: idx.config.SkipNonSource,
+		MaxFileSize:   idx.config.MaxFileSize,
+		ExcludeTests:  idx.config.ExcludeTests,
+	}
+}
+
+// checkSkip classifies a repo-relative file without reading all of it.
+func (idx *Indexer) checkSkip(relPath string) SkipReason {
+	return idx.skipFilter().CheckFile(filepath.Join(idx.repoPath, relPath), relPath)
+}
+
+// gitignoreRecorder returns a merkle.Builder OnIgnore hook that records
+// entries excluded by the repository's .gitignore patterns. Built-in
+// exclusions (.git, node_modules, hidden files) are not reported.
+func (idx *Indexer) gitignoreRecorder(report *SkipReport) func(string, bool) {
+	patterns := make(map[string]bool, len(idx.config.IgnorePatterns))
+	for _, p := range idx.config.IgnorePatterns {
+		patterns[strings.TrimSuffix(p, "/")] = true
+	}
+	return func(relPath string, isDir bool) {
+		if !patterns[filepath.Base(relPath)] {
+			return
+		}
+		if isDir {
+			relPath += "/"
+		}
+		report.Add(SkipGitignored, relPath)
+	}
+}
+
+// SkipCategory holds the files skipped for one reason.
+type SkipCategory struct {
+	Count   int      `json:"count"`
+	Samples []string `json:"samples"`
+}
+
+// SkipReport summarizes skipped files by reason, keeping a few sample paths
+// for each.
+type SkipReport struct {
+	Total   int                          `json:"total"`
+	Reasons map[SkipReason]*SkipCategory `json:"reasons"`
+}
+
+// NewSkipReport creates an empty report.
+func NewSkipReport() *SkipReport {
+	return &SkipReport{Reasons: make(map[SkipReason]*SkipCategory)}
+}
+
+// Add records a skipped file. Directories should be passed with a trailing
+// slash; they count as one entry.
+func (r *SkipReport) Add(reason SkipReason, path string) {
+	cat := r.Reasons[reason]
+	if cat == nil {
+		cat = &SkipCategory{}
+		r.Reasons[reason] = cat
+	}
+	cat.Count++
+	if len(cat.Samples) < MaxSkipSamples {
+		cat.Samples = append(cat.Samples, filepath.ToSlash(path))
+	}
+	r.Total++
+}
+
+// Count returns the number of files skipped for reason.
+func (r *SkipReport) Count(reason SkipReason) int {
+	if cat := r.Reasons[reason]; cat != nil {
+		return cat.Count
+	}
+	return 0
+}
+
+// WriteText writes a human-readable summary, most common reason first.
+func (r *SkipReport) WriteText(w io.Writer) error {
+	if r.Total == 0 {
+		_, err := fmt.Fprintln(w, "No files skipped")
+		return err
+	}
+
+	reasons := make([]SkipReason, 0, len(r.Reasons))
+	for reason := range r.Reasons {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		ci, cj := r.Reasons[reasons[i]].Count, r.Reasons[reasons[j]].Count
+		if ci != cj {
+			return ci > cj
+		}
+		return reasons[i] < reasons[j]
+	})
+
+	if _, err := fmt.Fprintf(w, "Skipped %d files:\n", r.Total); err != nil {
+		return err
+	}
+	for _, reason := range reasons {
+		cat := r.Reasons[reason]
+		samples := strings.Join(cat.Samples, ", ")
+		if cat.Count > len(cat.Samples) {
+			samples += ", ..."
+		}
+		if _, err := fmt.Fprintf(w, "  %-22s %6d  %s\n", reason, cat.Count, samples); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,355 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSkipFilterCheck(t *testing.T) {
+	filter := SkipFilter{
+		SkipNonSource: true,
+		MaxFileSize:   100,
+		Supported:     func(path string) bool { return filepath.Ext(path) != ".xyz" },
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		size    int64
+		content string
+		want    SkipReason
+	}{
+		{"plain source", "main.go", 20, "package main\n", ""},
+		{"unsupported extension", "data.xyz", 5, "hello", SkipUnsupported},
+		{"too large", "big.go", 101, "package big\n", SkipTooLarge},
+		{"binary", "logo.go", 8, "\x89PNG\x00\x00\x00", SkipBinary},
+		{"generated by name", "api.pb.go", 20, "package api\n", SkipGenerated},
+		{"generated by header", "enum.go", 60, "// Code generated by stringer; DO NOT EDIT.\n\npackage enum\n", SkipGenerated},
+		{"minified", "vendor.MIN.JS", 10, "var a=1;", SkipGenerated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filter.Check(tt.path, tt.size, []byte(tt.content)); got != tt.want {
+				t.Errorf("Check(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+
+	// Markers past the header are ordinary text
+	body := strings.Repeat("// filler\n", 200) + "// @generated\n"
+	if got := filter.Check("late.go", 50, []byte(body)); got != "" {
+		t.Errorf("Check with late marker = %q, want not skipped", got)
+	}
+
+	// Without SkipNonSource only the extension and test rules apply
+	filter.SkipNonSource = false
+	for _, tt := range tests {
+		want := tt.want
+		if want != SkipUnsupported {
+			want = ""
+		}
+		if got := filter.Check(tt.path, tt.size, []byte(tt.content)); got != want {
+			t.Errorf("Check(%q) without SkipNonSource = %q, want %q", tt.path, got, want)
+		}
+	}
+}
+
+func TestIsTestFile(t *testing.T) {
+	tests := map[string]bool{
+		"auth/handler_test.go":        true,
+		"tests/test_auth.py":          true,
+		"auth/test_auth.py":           true,
+		"src/api.spec.ts":             true,
+		"src/Button.test.tsx":         true,
+		"src/main/java/AuthTest.java": true,
+		"src/__tests__/api.js":        true,
+		"pkg/testdata/input.go":       true,
+		"auth/handler.go":             false,
+		"src/main/java/Contest.java":  false,
+		"latest.go":                   false,
+		"src/testing/helpers.py":      false,
+		"src/attestation/verifier.go": false,
+	}
+	for path, want := range tests {
+		if got := IsTestFile(path); got != want {
+			t.Errorf("IsTestFile(%q) = %v, want %v", path, got, want)
+		}
+	}
+
+	filter := SkipFilter{ExcludeTests: true}
+	if got := filter.Check("auth/handler_test.go", 20, []byte("package auth\n")); got != SkipTest {
+		t.Errorf("Check(test file) = %q, want %q", got, SkipTest)
+	}
+	if got := (SkipFilter{}).Check("auth/handler_test.go", 20, []byte("package auth\n")); got != "" {
+		t.Errorf("Check(test file) without ExcludeTests = %q, want not skipped", got)
+	}
+}
+
+func TestSkipReport(t *testing.T) {
+	report := NewSkipReport()
+	for i := 0; i < MaxSkipSamples+2; i++ {
+		report.Add(SkipBinary, filepath.Join("assets", string(rune('a'+i))+".png"))
+	}
+	report.Add(SkipGitignored, "tmp/")
+
+	if report.Total != MaxSkipSamples+3 {
+		t.Errorf("Total = %d, want %d", report.Total, MaxSkipSamples+3)
+	}
+	if got := len(report.Reasons[SkipBinary].Samples); got != MaxSkipSamples {
+		t.Errorf("binary samples = %d, want %d", got, MaxSkipSamples)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteText(&buf); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	text := buf.String()
+	binaryAt := strings.Index(text, "binary")
+	gitignoredAt := strings.Index(text, "gitignored")
+	if binaryAt < 0 || gitignoredAt < 0 || binaryAt > gitignoredAt {
+		t.Errorf("expected binary listed before gitignored:\n%s", text)
+	}
+	if !strings.Contains(text, "assets/a.png") || !strings.Contains(text, "...") {
+		t.Errorf("expected samples and truncation marker:\n%s", text)
+	}
+}
+
+func TestIndexer_ReportSkipped(t *testing.T) {
+	tempDir := t.TempDir()
+
+	files := map[string]string{
+		"main.go":        "package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n",
+		"notes.txt":      "plain text is chunked line by line\n",
+		"big.go":         "package main\n\n" + strings.Repeat("// padding\n", 200),
+		"logo.png":       "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR",
+		"api/api.pb.go":  "package api\n",
+		"enum/enum.go":   "// Code generated by stringer; DO NOT EDIT.\n\npackage enum\n",
+		"tmp/scratch.go": "package tmp\n",
+		"debug.log":      "log line\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("writing %s: %v", name, err)
+		}
+	}
+
+	cfg := &Config{
+		DBType:            "sqlite",
+		EmbeddingProvider: "off",
+		Dimensions:        768,
+		SkipNonSource:     true,
+		MaxFileSize:       1024,
+		IgnorePatterns:    []string{"tmp", "debug.log"},
+	}
+	idx, err := New(tempDir, cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+
+	result, err := idx.Index(context.Background(), IndexOptions{ReportSkipped: true})
+	if err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+
+	report := result.Skipped
+	if report == nil {
+		t.Fatal("expected a skip report")
+	}
+
+	want := map[SkipReason]int{
+		SkipTooLarge:   1,
+		SkipBinary:     1,
+		SkipGenerated:  2,
+		SkipGitignored: 2,
+	}
+	for reason, count := range want {
+		if got := report.Count(reason); got != count {
+			t.Errorf("%s: count = %d, want %d (samples %v)", reason, got, count, report.Reasons[reason])
+		}
+	}
+	if report.Total != 6 {
+		t.Errorf("Total = %d, want 6", report.Total)
+	}
+	if samples := report.Reasons[SkipGitignored].Samples; !containsString(samples, "tmp/") {
+		t.Errorf("gitignored samples = %v, want tmp/", samples)
+	}
+
+	// Only the indexable files produced chunks
+	stats, err := idx.Stats()
+	if err != nil {
+		t.Fatalf("Stats() error = %v", err)
+	}
+	if stats.FileCount != 2 {
+		t.Errorf("indexed FileCount = %d, want 2 (main.go, notes.txt)", stats.FileCount)
+	}
+	if result.FilesSkipped != 4 {
+		t.Errorf("FilesSkipped = %d, want 4", result.FilesSkipped)
+	}
+}
+
+func TestIndexer_SkipNonSourceOptIn(t *testing.T) {
+	repo := writeRepo(t, map[string]string{
+		"main.go":       "package main\n\nfunc main() {}\n",
+		"big.go":        "package main\n\n" + strings.Repeat("// padding\n", 200),
+		"api/api.pb.go": "package api\n\nfunc Generated() {}\n",
+	})
+
+	newIndexer := func(skip bool) *Indexer {
+		idx, err := New(repo, &Config{
+			DBType:        "sqlite",
+			DBPath:        filepath.Join(t.TempDir(), "index.db"),
+			Dimensions:    4,
+			Embedder:      &countingEmbedder{},
+			SkipNonSource: skip,
+			MaxFileSize:   1024,
+		})
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		t.Cleanup(func() { idx.Close() })
+		return idx
+	}
+
+	// By default large and generated files are indexed, and not reported
+	idx := newIndexer(false)
+	result, err := idx.Index(context.Background(), IndexOptions{ReportSkipped: true})
+	if err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	if result.FilesSkipped != 0 || result.Skipped.Total != 0 {
+		t.Errorf("FilesSkipped = %d, report total = %d; want nothing skipped", result.FilesSkipped, result.Skipped.Total)
+	}
+	if stats, err := idx.Stats(); err != nil || stats.FileCount != 3 {
+		t.Errorf("Stats() = %+v, %v; want 3 files", stats, err)
+	}
+
+	// Opting in drops their locations and counts them
+	idx = newIndexer(true)
+	if result, err = idx.Index(context.Background(), IndexOptions{Force: true}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	if result.FilesSkipped != 2 {
+		t.Errorf("FilesSkipped = %d, want 2", result.FilesSkipped)
+	}
+	if stats, err := idx.Stats(); err != nil || stats.FileCount != 1 {
+		t.Errorf("Stats() = %+v, %v; want 1 file", stats, err)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestIndexer_ForceIncludeDirs(t *testing.T) {
+	tempDir := t.TempDir()
+
+	files := map[string]string{
+		".gitignore":          "generated/\nout-of-tree/\n",
+		"main.go":             "package main\n\nfunc main() {}\n",
+		"generated/client.go": "package generated\n\nfunc Client() {}\n",
+		"out-of-tree/tmp.go":  "package tmp\n\nfunc Tmp() {}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("writing %s: %v", name, err)
+		}
+	}
+
+	index := func(force []string) int {
+		t.Helper()
+		cfg := &Config{
+			DBType:            "sqlite",
+			DBPath:            filepath.Join(t.TempDir(), "index.db"),
+			EmbeddingProvider: "off",
+			Dimensions:        768,
+			IgnorePatterns:    LoadGitignore(tempDir),
+			ForceIncludeDirs:  force,
+		}
+		idx, err := New(tempDir, cfg)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		defer idx.Close()
+
+		if _, err := idx.Index(context.Background(), IndexOptions{Force: true}); err != nil {
+			t.Fatalf("Index() error = %v", err)
+		}
+		stats, err := idx.Stats()
+		if err != nil {
+			t.Fatalf("Stats() error = %v", err)
+		}
+		return stats.FileCount
+	}
+
+	// Directory-only gitignore patterns exclude both directories
+	if got := index(nil); got != 2 {
+		t.Errorf("FileCount without force-include = %d, want 2 (.gitignore, main.go)", got)
+	}
+	// Force-including one brings it back while the other stays excluded
+	if got := index([]string{"generated"}); got != 3 {
+		t.Errorf("FileCount with force-include = %d, want 3 (plus generated/client.go)", got)
+	}
+}
+
+func TestIndexer_IncludeHiddenDirs(t *testing.T) {
+	tempDir := writeRepo(t, map[string]string{
+		"main.go":                    "package main\n\nfunc main() {}\n",
+		".github/workflows/ci.yml":   "on: push\n",
+		".github/workflows/.secrets": "TOKEN=1\n",
+		".github/CODEOWNERS":         "* @team\n",
+		".config/tool.go":            "package tool\n\nfunc Tool() {}\n",
+	})
+
+	cfg := &Config{
+		DBType:            "sqlite",
+		DBPath:            filepath.Join(t.TempDir(), "index.db"),
+		EmbeddingProvider: "off",
+		Dimensions:        768,
+		IncludeHiddenDirs: []string{".github/workflows"},
+	}
+	idx, err := New(tempDir, cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+
+	if _, err := idx.Index(context.Background(), IndexOptions{Force: true}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	locs, err := idx.Locations().GetByRepo(idx.RepoPath())
+	if err != nil {
+		t.Fatalf("GetByRepo() error = %v", err)
+	}
+	paths := make(map[string]bool)
+	for _, loc := range locs {
+		paths[loc.Path] = true
+	}
+
+	if !paths[".github/workflows/ci.yml"] {
+		t.Errorf("allowlisted .github/workflows/ci.yml not indexed, got %v", paths)
+	}
+	for _, path := range []string{".github/workflows/.secrets", ".github/CODEOWNERS", ".config/tool.go"} {
+		if paths[path] {
+			t.Errorf("hidden path %s was indexed", path)
+		}
+	}
+}
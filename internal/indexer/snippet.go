@@ -0,0 +1,57 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ReadLines returns lines start through end (1-based, inclusive) of an
+// indexed file. They come from the stored content of an indexed chunk
+// covering them when there is one (see Config.StoreContent), so they match
+// what was indexed even if the file has since moved or changed, and from
+// the source otherwise. path is repo-relative or an absolute path inside
+// the repository.
+func (idx *Indexer) ReadLines(ctx context.Context, path string, start, end int) ([]string, error) {
+	if start < 1 || end < start {
+		return nil, fmt.Errorf("invalid line range %d-%d", start, end)
+	}
+	relPath := path
+	if filepath.IsAbs(path) {
+		rel, err := filepath.Rel(idx.repoPath, path)
+		if err != nil {
+			return nil, fmt.Errorf("resolving path: %w", err)
+		}
+		relPath = rel
+	}
+	relPath = filepath.Clean(relPath)
+
+	lines, ok, err := idx.contents.Lines(idx.locations, idx.repoPath, relPath, start, end)
+	if err != nil {
+		idx.logger.Warn("reading stored content failed", "path", relPath, "error", err)
+	}
+	if ok {
+		return lines, nil
+	}
+
+	content, _, err := idx.source.Read(ctx, filepath.ToSlash(relPath))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", relPath, err)
+	}
+	lines = strings.Split(string(content), "\n")
+	if start > len(lines) {
+		return nil, fmt.Errorf("%s has %d lines, want line %d", relPath, len(lines), start)
+	}
+	return lines[start-1 : min(end, len(lines))], nil
+}
+
+// Snippet returns lines start through end of an indexed file as text; see
+// ReadLines.
+func (idx *Indexer) Snippet(ctx context.Context, path string, start, end int) (string, error) {
+	lines, err := idx.ReadLines(ctx, path, start, end)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(lines, "\n"), nil
+}
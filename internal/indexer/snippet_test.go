@@ -0,0 +1,81 @@
+package indexer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIndexer_Snippet(t *testing.T) {
+	source := "package a\n\nfunc A() int {\n\treturn 1\n}\n\nfunc B() int {\n\treturn 2\n}\n"
+	open := func(t *testing.T, storeContent bool) (*Indexer, string) {
+		t.Helper()
+		repo := writeRepo(t, map[string]string{"a.go": source})
+		idx, err := New(repo, &Config{
+			DBType:       "sqlite",
+			Dimensions:   4,
+			Embedder:     &countingEmbedder{},
+			StoreContent: storeContent,
+		})
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		t.Cleanup(func() { idx.Close() })
+		if _, err := idx.Index(context.Background(), IndexOptions{}); err != nil {
+			t.Fatalf("Index() error = %v", err)
+		}
+		return idx, repo
+	}
+	ctx := context.Background()
+	want := "func B() int {\n\treturn 2\n}"
+
+	t.Run("serves stored content", func(t *testing.T) {
+		idx, repo := open(t, true)
+
+		if err := os.WriteFile(filepath.Join(repo, "a.go"), []byte("package a\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		snippet, err := idx.Snippet(ctx, "a.go", 7, 9)
+		if err != nil || snippet != want {
+			t.Errorf("Snippet() of a modified file = %q, %v; want %q", snippet, err, want)
+		}
+
+		if err := os.Remove(filepath.Join(repo, "a.go")); err != nil {
+			t.Fatal(err)
+		}
+		snippet, err = idx.Snippet(ctx, filepath.Join(repo, "a.go"), 8, 8)
+		if err != nil || snippet != "\treturn 2" {
+			t.Errorf("Snippet() of a deleted file = %q, %v; want %q", snippet, err, "\treturn 2")
+		}
+
+		// Reindexing drops the deleted file and its stored content
+		if _, err := idx.Index(ctx, IndexOptions{}); err != nil {
+			t.Fatalf("Index() error = %v", err)
+		}
+		var stored int
+		if err := idx.database.QueryRow("SELECT COUNT(*) FROM chunk_contents").Scan(&stored); err != nil || stored != 0 {
+			t.Errorf("%d contents stored after deleting the file (%v), want 0", stored, err)
+		}
+		if _, err := idx.Snippet(ctx, "a.go", 7, 9); err == nil {
+			t.Error("Snippet() of a deleted, reindexed file succeeded")
+		}
+	})
+
+	t.Run("reads the source without stored content", func(t *testing.T) {
+		idx, repo := open(t, false)
+
+		modified := "package a\n\n// B returns two.\nfunc B() int {\n\treturn 2\n}\n\nfunc C() {}\n"
+		if err := os.WriteFile(filepath.Join(repo, "a.go"), []byte(modified), 0644); err != nil {
+			t.Fatal(err)
+		}
+		snippet, err := idx.Snippet(ctx, "a.go", 7, 9)
+		if err != nil || snippet != "\nfunc C() {}\n" {
+			t.Errorf("Snippet() = %q, %v; want the modified file's lines", snippet, err)
+		}
+		var stored int
+		if err := idx.database.QueryRow("SELECT COUNT(*) FROM chunk_contents").Scan(&stored); err != nil || stored != 0 {
+			t.Errorf("%d contents stored (%v), want 0", stored, err)
+		}
+	})
+}
@@ -0,0 +1,141 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"codetect/internal/merkle"
+)
+
+// ContentSource supplies the items an Indexer indexes, such as files on
+// disk, pages from a wiki export or rows from a database. Item paths are
+// slash-separated identifiers relative to the source, like "docs/setup.md";
+// they are recorded on chunk locations and drive language detection, skip
+// rules and ChunkMetadata the same way file paths do.
+type ContentSource interface {
+	// List returns every item currently in the source.
+	List(ctx context.Context) ([]ContentItem, error)
+
+	// Read returns an item's content and the modification time of that
+	// content. It returns an error wrapping os.ErrNotExist if the item no
+	// longer exists, so its chunks are removed from the index.
+	Read(ctx context.Context, path string) ([]byte, time.Time, error)
+}
+
+// ContentItem describes one item of a ContentSource.
+type ContentItem struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// FileSource is the ContentSource for a directory on disk, and the one an
+// Indexer uses when Config.Source is nil. Builder decides which files are
+// listed.
+type FileSource struct {
+	Root    string
+	Builder *merkle.Builder
+}
+
+// NewFileSource creates a source for the files under root that builder
+// keeps.
+func NewFileSource(root string, builder *merkle.Builder) *FileSource {
+	return &FileSource{Root: root, Builder: builder}
+}
+
+// List walks Root and returns the files the builder keeps.
+func (s *FileSource) List(ctx context.Context) ([]ContentItem, error) {
+	tree, err := s.Builder.Build(s.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []ContentItem
+	var walk func(n *merkle.Node)
+	walk = func(n *merkle.Node) {
+		if !n.IsDir {
+			items = append(items, ContentItem{
+				Path:    filepath.ToSlash(n.Path),
+				Size:    n.Size,
+				ModTime: n.ModTime,
+			})
+			return
+		}
+		for _, child := range n.Children {
+			walk(child)
+		}
+	}
+	if tree.Root != nil {
+		walk(tree.Root)
+	}
+	return items, nil
+}
+
+// Read reads a file under Root. The file is stat'ed before and after the
+// read, and re-read if its size or modification time moved in between, so
+// a half-written file is never returned; one that keeps changing fails
+// with ErrChangedDuringIndexing.
+func (s *FileSource) Read(ctx context.Context, path string) ([]byte, time.Time, error) {
+	fullPath := filepath.Join(s.Root, filepath.FromSlash(path))
+
+	for attempt := 0; attempt < maxReadAttempts; attempt++ {
+		before, err := os.Stat(fullPath)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		content, err := os.ReadFile(fullPath)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		after, err := os.Stat(fullPath)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		if before.Size() == after.Size() && before.ModTime().Equal(after.ModTime()) &&
+			int64(len(content)) == after.Size() {
+			return content, after.ModTime(), nil
+		}
+	}
+
+	return nil, time.Time{}, ErrChangedDuringIndexing
+}
+
+// buildSourceTree reads every item of a source other than a FileSource and
+// builds a Merkle tree from their content, so changes are detected the
+// same way as for files. Items that cannot be read are left out, as the
+// Builder does for unreadable files. If report is non-nil, items the skip
+// filter rejects are recorded in it.
+func (idx *Indexer) buildSourceTree(ctx context.Context, report *SkipReport) (*merkle.Tree, error) {
+	items, err := idx.source.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing content: %w", err)
+	}
+
+	nodes := make([]*merkle.Node, 0, len(items))
+	for _, item := range items {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		content, modTime, err := idx.source.Read(ctx, item.Path)
+		if err != nil {
+			idx.logger.Warn("skipping unreadable item", "path", item.Path, "error", err)
+			continue
+		}
+
+		relPath := filepath.FromSlash(item.Path)
+		if report != nil {
+			if reason := idx.skipFilter().Check(relPath, int64(len(content)), content); reason != "" {
+				report.Add(reason, relPath)
+			}
+		}
+
+		node := &merkle.Node{Path: relPath, Size: int64(len(content)), ModTime: modTime}
+		node.ComputeHashWith(idx.merkleBuilder.Hasher, content)
+		nodes = append(nodes, node)
+	}
+
+	return merkle.NewTree(idx.repoPath, idx.merkleBuilder.Hasher, nodes), nil
+}
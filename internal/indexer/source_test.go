@@ -0,0 +1,131 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"codetect/internal/embedding"
+)
+
+// memSource is a ContentSource backed by a map of path to content.
+type memSource struct {
+	items   map[string]string
+	modTime time.Time
+}
+
+func (s *memSource) List(ctx context.Context) ([]ContentItem, error) {
+	var items []ContentItem
+	for path, content := range s.items {
+		items = append(items, ContentItem{Path: path, Size: int64(len(content)), ModTime: s.modTime})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Path < items[j].Path })
+	return items, nil
+}
+
+func (s *memSource) Read(ctx context.Context, path string) ([]byte, time.Time, error) {
+	content, ok := s.items[path]
+	if !ok {
+		return nil, time.Time{}, fmt.Errorf("reading %s: %w", path, os.ErrNotExist)
+	}
+	return []byte(content), s.modTime, nil
+}
+
+// wordEmbedder embeds text as counts of a few keywords.
+type wordEmbedder struct{}
+
+var embedWords = []string{"invoice", "shipping", "refund"}
+
+func (wordEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	result := make([][]float32, len(texts))
+	for i, text := range texts {
+		vec := make([]float32, len(embedWords))
+		for j, word := range embedWords {
+			vec[j] = float32(strings.Count(strings.ToLower(text), word))
+		}
+		result[i] = vec
+	}
+	return result, nil
+}
+
+func (wordEmbedder) Available() bool    { return true }
+func (wordEmbedder) ProviderID() string { return "words" }
+func (wordEmbedder) Dimensions() int    { return len(embedWords) }
+
+func TestIndexer_ContentSource(t *testing.T) {
+	source := &memSource{
+		items: map[string]string{
+			"billing/invoices.md": "# Invoices\n\nEach invoice lists invoice lines and totals.\n",
+			"billing/refunds.md":  "# Refunds\n\nA refund reverses a payment. Refund requests need approval.\n",
+			"ops/shipping.md":     "# Shipping\n\nShipping labels are printed when shipping starts.\n",
+		},
+		modTime: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	stateDir := t.TempDir()
+
+	idx, err := New(stateDir, &Config{
+		DBType:     "sqlite",
+		Dimensions: len(embedWords),
+		Embedder:   wordEmbedder{},
+		Source:     source,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+	ctx := context.Background()
+
+	result, err := idx.Index(ctx, IndexOptions{})
+	if err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	if result.FilesProcessed != 3 || result.ChunksCreated == 0 {
+		t.Errorf("first run = %+v, want 3 items chunked", result)
+	}
+
+	search := func(query string) string {
+		t.Helper()
+		results, err := idx.Searcher().Search(ctx, query, embedding.CacheSearchOptions{RepoRoot: idx.RepoPath(), Limit: 1})
+		if err != nil {
+			t.Fatalf("Search(%q) error = %v", query, err)
+		}
+		if len(results) == 0 {
+			return ""
+		}
+		return filepath.ToSlash(results[0].Path)
+	}
+	if got := search("refund"); got != "billing/refunds.md" {
+		t.Errorf("Search(refund) = %q, want billing/refunds.md", got)
+	}
+	if got := search("shipping"); got != "ops/shipping.md" {
+		t.Errorf("Search(shipping) = %q, want ops/shipping.md", got)
+	}
+
+	// Nothing changed in the source
+	result, err = idx.Index(ctx, IndexOptions{})
+	if err != nil {
+		t.Fatalf("second Index() error = %v", err)
+	}
+	if result.ChangeType != "none" {
+		t.Errorf("unchanged source ChangeType = %q, want none", result.ChangeType)
+	}
+
+	// Edits and deletions are picked up incrementally
+	source.items["ops/shipping.md"] = "# Returns\n\nEvery refund starts with a return label.\n"
+	delete(source.items, "billing/refunds.md")
+	result, err = idx.Index(ctx, IndexOptions{})
+	if err != nil {
+		t.Fatalf("third Index() error = %v", err)
+	}
+	if result.ChangeType != "incremental" || result.FilesProcessed != 1 || result.FilesDeleted != 1 {
+		t.Errorf("third run = %+v, want 1 item processed and 1 deleted", result)
+	}
+	if got := search("refund"); got != "ops/shipping.md" {
+		t.Errorf("Search(refund) after edit = %q, want ops/shipping.md", got)
+	}
+}
@@ -0,0 +1,110 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"codetect/internal/embedding"
+	"codetect/internal/merkle"
+)
+
+// processStream indexes files like processBatch, but overlaps chunking
+// with embedding: files are chunked on up to Config.Concurrency workers,
+// and as soon as the files chunked so far hold a pipeline batch of chunks
+// those are embedded while chunking goes on. Chunking and embedding take
+// their workers from the same Concurrency slots, so a run never does more
+// than that much work at once, and only the chunks of files waiting to be
+// embedded are held in memory rather than those of a whole batch of files.
+//
+// A group of files whose embedding fails is logged and left out of the
+// result, as processBatch's caller does for a failed batch.
+func (idx *Indexer) processStream(ctx context.Context, tree *merkle.Tree, files []string, refresh map[string]bool, verbose bool) *IndexResult {
+	result := &IndexResult{}
+	slots := make(chan struct{}, idx.config.Concurrency)
+
+	// Chunk files on free slots. At most Concurrency files are chunked or
+	// being chunked ahead of the embedder, so a slow embedder holds
+	// chunking back instead of files piling up in memory; the buffer
+	// holds them all, so a worker frees its slot without waiting
+	pending := make(chan struct{}, idx.config.Concurrency)
+	loaded := make(chan loadedFile, idx.config.Concurrency)
+	go func() {
+		var wg sync.WaitGroup
+		for _, relPath := range files {
+			pending <- struct{}{}
+			slots <- struct{}{}
+			wg.Add(1)
+			go func(relPath string) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				loaded <- idx.loadFile(ctx, tree, relPath, refresh[relPath])
+			}(relPath)
+		}
+		wg.Wait()
+		close(loaded)
+	}()
+
+	groupSize := idx.config.BatchSize
+	if groupSize <= 0 {
+		groupSize = DefaultConfig().BatchSize
+	}
+
+	var (
+		mu sync.Mutex // Guards result
+		wg sync.WaitGroup
+	)
+	embed := func(chunks []embedding.Chunk, chunked []string, files int) {
+		if len(chunked) == 0 {
+			mu.Lock()
+			result.FilesProcessed += files
+			mu.Unlock()
+			return
+		}
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			embedResult, err := idx.pipeline.EmbedFiles(ctx, idx.repoPath, chunked, chunks)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				idx.logger.Warn("batch processing error", "error", fmt.Errorf("embedding chunks: %w", err))
+				return
+			}
+			result.add(&IndexResult{
+				FilesProcessed: files,
+				ChunksCreated:  len(chunks),
+				CacheHits:      embedResult.CacheHits,
+				ChunksEmbedded: embedResult.Embedded,
+				EmbedRequests:  embedResult.Requests,
+			})
+		}()
+	}
+
+	// Group whole files, so each file's chunks are embedded together
+	var group []embedding.Chunk
+	var groupChunked []string
+	groupFiles := 0
+	for f := range loaded {
+		<-pending
+		mu.Lock()
+		chunks := idx.recordFile(tree, f, result, verbose)
+		mu.Unlock()
+		group = append(group, chunks...)
+		if f.indexed() {
+			groupChunked = append(groupChunked, f.path)
+		}
+		groupFiles++
+		if len(group) >= groupSize {
+			embed(group, groupChunked, groupFiles)
+			group, groupChunked, groupFiles = nil, nil, 0
+		}
+	}
+	embed(group, groupChunked, groupFiles)
+
+	wg.Wait()
+	return result
+}
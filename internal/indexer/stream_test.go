@@ -0,0 +1,227 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"codetect/internal/chunker"
+)
+
+// slowChunker is an AST chunker that takes delay per file, standing in for
+// parsing large files or a model-assisted chunker.
+type slowChunker struct {
+	delay time.Duration
+}
+
+func (c slowChunker) ChunkFile(ctx context.Context, path string, content []byte) ([]chunker.Chunk, error) {
+	time.Sleep(c.delay)
+	return chunker.NewASTChunker().ChunkFile(ctx, path, content)
+}
+
+// slowEmbedder takes delay per request and counts the texts it embeds.
+type slowEmbedder struct {
+	delay time.Duration
+	texts atomic.Int64
+}
+
+func (e *slowEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	time.Sleep(e.delay)
+	e.texts.Add(int64(len(texts)))
+	result := make([][]float32, len(texts))
+	for i := range texts {
+		result[i] = []float32{1, 0, 0, 0}
+	}
+	return result, nil
+}
+
+func (e *slowEmbedder) Available() bool    { return true }
+func (e *slowEmbedder) ProviderID() string { return "slow" }
+func (e *slowEmbedder) Dimensions() int    { return 4 }
+
+// streamRepo writes a repo of n Go files with two functions each.
+func streamRepo(t testing.TB, n int) string {
+	files := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		files[fmt.Sprintf("pkg%d/file%d.go", i%4, i)] = fmt.Sprintf(
+			"package pkg\n\nfunc Get%d() int {\n\treturn %d\n}\n\nfunc Set%d(v int) int {\n\treturn v + %d\n}\n", i, i, i, i)
+	}
+	return writeRepo(t, files)
+}
+
+// indexWithDelays indexes repo with a slow chunker and embedder at the
+// given concurrency, returning the result and how long it took.
+func indexWithDelays(t testing.TB, repo string, concurrency int, delay time.Duration) (*IndexResult, *slowEmbedder, time.Duration) {
+	embedder := &slowEmbedder{delay: delay}
+	idx, err := New(repo, &Config{
+		DBType:      "sqlite",
+		DBPath:      filepath.Join(t.TempDir(), "index.db"),
+		Dimensions:  4,
+		Embedder:    embedder,
+		Chunker:     slowChunker{delay: delay},
+		BatchSize:   8,
+		Concurrency: concurrency,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+
+	start := time.Now()
+	result, err := idx.Index(context.Background(), IndexOptions{Force: true})
+	if err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	return result, embedder, time.Since(start)
+}
+
+func TestIndexer_ConcurrencyMatchesStaged(t *testing.T) {
+	repo := streamRepo(t, 30)
+
+	staged, stagedEmbedder, _ := indexWithDelays(t, repo, 0, 0)
+	streamed, streamedEmbedder, _ := indexWithDelays(t, repo, 4, 0)
+
+	if streamed.FilesProcessed != staged.FilesProcessed || streamed.ChunksCreated != staged.ChunksCreated {
+		t.Errorf("streamed run processed %d files into %d chunks, staged run %d into %d",
+			streamed.FilesProcessed, streamed.ChunksCreated, staged.FilesProcessed, staged.ChunksCreated)
+	}
+	if streamed.ChunksEmbedded != staged.ChunksEmbedded {
+		t.Errorf("streamed run embedded %d chunks, staged run %d", streamed.ChunksEmbedded, staged.ChunksEmbedded)
+	}
+	if got, want := streamedEmbedder.texts.Load(), stagedEmbedder.texts.Load(); got != want {
+		t.Errorf("streamed run sent %d texts to the embedder, staged run %d", got, want)
+	}
+	if streamed.FilesProcessed != 30 {
+		t.Errorf("FilesProcessed = %d, want 30", streamed.FilesProcessed)
+	}
+}
+
+func TestIndexer_ConcurrencyRecordsLocations(t *testing.T) {
+	repo := streamRepo(t, 12)
+	idx, err := New(repo, &Config{
+		DBType:      "sqlite",
+		Dimensions:  4,
+		Embedder:    &slowEmbedder{},
+		BatchSize:   4,
+		Concurrency: 3,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+
+	if _, err := idx.Index(context.Background(), IndexOptions{}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	for i := 0; i < 12; i++ {
+		for _, symbol := range []string{fmt.Sprintf("Get%d", i), fmt.Sprintf("Set%d", i)} {
+			locs, err := idx.Locations().GetLocationsBySymbol(idx.RepoPath(), symbol)
+			if err != nil {
+				t.Fatalf("GetLocationsBySymbol(%q) error = %v", symbol, err)
+			}
+			if len(locs) != 1 {
+				t.Errorf("%s: %d locations, want 1", symbol, len(locs))
+			}
+		}
+	}
+
+	// A second run finds nothing to do
+	result, err := idx.Index(context.Background(), IndexOptions{})
+	if err != nil {
+		t.Fatalf("second Index() error = %v", err)
+	}
+	if result.ChangeType != "none" {
+		t.Errorf("second run ChangeType = %q, want none", result.ChangeType)
+	}
+}
+
+func TestIndexer_ConcurrencyOverlapsStages(t *testing.T) {
+	if testing.Short() {
+		t.Skip("timing test")
+	}
+	repo := streamRepo(t, 24)
+	delay := 10 * time.Millisecond
+
+	// Staged: 24 files chunked one by one, then 6 embedding requests
+	// one by one; streamed: the same work spread over 4 slots
+	_, _, staged := indexWithDelays(t, repo, 0, delay)
+	_, _, streamed := indexWithDelays(t, repo, 4, delay)
+
+	if streamed >= staged*3/4 {
+		t.Errorf("streamed run took %v, staged run %v; want overlap to save at least a quarter", streamed, staged)
+	}
+}
+
+func BenchmarkIndexer_Staged(b *testing.B) {
+	repo := streamRepo(b, 40)
+	for i := 0; i < b.N; i++ {
+		indexWithDelays(b, repo, 0, 2*time.Millisecond)
+	}
+}
+
+func BenchmarkIndexer_Streamed(b *testing.B) {
+	repo := streamRepo(b, 40)
+	for i := 0; i < b.N; i++ {
+		indexWithDelays(b, repo, 4, 2*time.Millisecond)
+	}
+}
+
+// countingChunker counts the files it has chunked.
+type countingChunker struct {
+	files *atomic.Int64
+}
+
+func (c countingChunker) ChunkFile(ctx context.Context, path string, content []byte) ([]chunker.Chunk, error) {
+	c.files.Add(1)
+	return chunker.NewASTChunker().ChunkFile(ctx, path, content)
+}
+
+// laggingEmbedder is a slow embedder that records how many files had been
+// chunked ahead of the chunks it embedded, at most.
+type laggingEmbedder struct {
+	slowEmbedder
+	chunked *atomic.Int64
+	peak    atomic.Int64
+}
+
+func (e *laggingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	// Each file holds two functions
+	if ahead := e.chunked.Load() - e.texts.Load()/2; ahead > e.peak.Load() {
+		e.peak.Store(ahead)
+	}
+	return e.slowEmbedder.Embed(ctx, texts)
+}
+
+func TestIndexer_ConcurrencyBoundsChunkedFiles(t *testing.T) {
+	repo := streamRepo(t, 40)
+	chunked := &atomic.Int64{}
+	embedder := &laggingEmbedder{slowEmbedder: slowEmbedder{delay: 5 * time.Millisecond}, chunked: chunked}
+	idx, err := New(repo, &Config{
+		DBType:      "sqlite",
+		DBPath:      filepath.Join(t.TempDir(), "index.db"),
+		Dimensions:  4,
+		Embedder:    embedder,
+		Chunker:     countingChunker{files: chunked},
+		BatchSize:   2,
+		Concurrency: 2,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+
+	result, err := idx.Index(context.Background(), IndexOptions{Force: true})
+	if err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	if result.FilesProcessed != 40 {
+		t.Errorf("FilesProcessed = %d, want 40", result.FilesProcessed)
+	}
+	// A slow embedder holds chunking back instead of files piling up
+	if peak := embedder.peak.Load(); peak > 8 {
+		t.Errorf("up to %d files were chunked ahead of embedding, want at most 8", peak)
+	}
+}
@@ -0,0 +1,197 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"codetect/internal/embedding"
+)
+
+// DefaultSummaryLimit is how many entries each RepoSummary list keeps when
+// no limit is given.
+const DefaultSummaryLimit = 10
+
+// RepoSummary is a high-level map of an indexed repository, meant for
+// getting oriented in an unfamiliar codebase.
+type RepoSummary struct {
+	Files        int                        `json:"files"`
+	Chunks       int                        `json:"chunks"`
+	Languages    []LanguageStats            `json:"languages"`
+	Directories  []embedding.DirectoryStats `json:"directories"`
+	LargestFiles []embedding.FileStats      `json:"largest_files"`
+	TopSymbols   []SymbolFrequency          `json:"top_symbols"`
+}
+
+// LanguageStats counts the indexed files and chunks of one language.
+type LanguageStats struct {
+	Language string `json:"language"`
+	Files    int    `json:"files"`
+	Chunks   int    `json:"chunks"`
+}
+
+// SymbolFrequency is a defined symbol and how often its name is used
+// elsewhere in the indexed files.
+type SymbolFrequency struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Path       string `json:"path"`
+	Line       int    `json:"line"`
+	References int    `json:"references"`
+}
+
+// Summary builds a RepoSummary from the chunk locations written by Index.
+// Directories are grouped at the top level. Each list is cut to limit
+// entries; zero or less means DefaultSummaryLimit.
+//
+// Symbol references are counted by scanning the indexed files for
+// identifiers matching a defined name, minus the definitions themselves.
+// This is a textual count: unrelated symbols sharing a name are conflated.
+func (idx *Indexer) Summary(limit int) (*RepoSummary, error) {
+	if limit <= 0 {
+		limit = DefaultSummaryLimit
+	}
+
+	files, err := idx.locations.FileStats(idx.repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("getting file stats: %w", err)
+	}
+	dirs, err := idx.locations.StatsByDirectory(idx.repoPath, 1)
+	if err != nil {
+		return nil, fmt.Errorf("getting directory stats: %w", err)
+	}
+
+	summary := &RepoSummary{Files: len(files)}
+
+	byLang := make(map[string]*LanguageStats)
+	for _, f := range files {
+		summary.Chunks += f.Chunks
+
+		lang := f.Language
+		if lang == "" {
+			lang = "unknown"
+		}
+		ls := byLang[lang]
+		if ls == nil {
+			ls = &LanguageStats{Language: lang}
+			byLang[lang] = ls
+		}
+		ls.Files++
+		ls.Chunks += f.Chunks
+	}
+	for _, ls := range byLang {
+		summary.Languages = append(summary.Languages, *ls)
+	}
+	sort.Slice(summary.Languages, func(i, j int) bool {
+		a, b := summary.Languages[i], summary.Languages[j]
+		if a.Files != b.Files {
+			return a.Files > b.Files
+		}
+		return a.Language < b.Language
+	})
+
+	summary.Directories = dirs[:min(limit, len(dirs))]
+
+	largest := append([]embedding.FileStats(nil), files...)
+	sort.SliceStable(largest, func(i, j int) bool {
+		return largest[i].Lines > largest[j].Lines
+	})
+	summary.LargestFiles = largest[:min(limit, len(largest))]
+
+	symbols, err := idx.symbolFrequencies(files)
+	if err != nil {
+		return nil, err
+	}
+	summary.TopSymbols = symbols[:min(limit, len(symbols))]
+
+	return summary, nil
+}
+
+// symbolFrequencies returns the repository's defined symbols that are
+// referenced at least once, most referenced first.
+func (idx *Indexer) symbolFrequencies(files []embedding.FileStats) ([]SymbolFrequency, error) {
+	locs, err := idx.locations.GetByRepo(idx.repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("getting locations: %w", err)
+	}
+
+	// First definition of each name, plus how many times it is defined.
+	// Sub-chunks of one definition share a name and start line.
+	defs := make(map[string]*SymbolFrequency)
+	defCount := make(map[string]int)
+	seen := make(map[string]bool)
+	for _, loc := range locs {
+		if loc.NodeName == "" || loc.NodeType == embedding.NodeTypeFile {
+			continue
+		}
+		key := fmt.Sprintf("%s\x00%s\x00%d", loc.NodeName, loc.Path, loc.StartLine)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		defCount[loc.NodeName]++
+		if defs[loc.NodeName] == nil {
+			defs[loc.NodeName] = &SymbolFrequency{
+				Name: loc.NodeName,
+				Type: loc.NodeType,
+				Path: loc.Path,
+				Line: loc.StartLine,
+			}
+		}
+	}
+	if len(defs) == 0 {
+		return nil, nil
+	}
+
+	uses := make(map[string]int, len(defs))
+	for _, f := range files {
+		content, _, err := idx.source.Read(context.Background(), filepath.ToSlash(f.Path))
+		if err != nil {
+			continue // Deleted since indexing
+		}
+		countIdentifiers(content, defs, uses)
+	}
+
+	var result []SymbolFrequency
+	for name, sym := range defs {
+		if refs := uses[name] - defCount[name]; refs > 0 {
+			sym.References = refs
+			result = append(result, *sym)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].References != result[j].References {
+			return result[i].References > result[j].References
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// countIdentifiers adds to counts each identifier in content that is a key
+// of names. Identifiers are runs of letters, digits, and underscores not
+// starting with a digit; bytes above ASCII count as letters.
+func countIdentifiers(content []byte, names map[string]*SymbolFrequency, counts map[string]int) {
+	for i := 0; i < len(content); {
+		if !isIdentByte(content[i]) {
+			i++
+			continue
+		}
+		start := i
+		for i < len(content) && isIdentByte(content[i]) {
+			i++
+		}
+		if c := content[start]; c >= '0' && c <= '9' {
+			continue
+		}
+		if name := content[start:i]; names[string(name)] != nil {
+			counts[string(name)]++
+		}
+	}
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
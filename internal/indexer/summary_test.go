@@ -0,0 +1,99 @@
+package indexer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIndexer_Summary(t *testing.T) {
+	tempDir := t.TempDir()
+
+	files := map[string]string{
+		"main.go":          "package main\n\nfunc main() {\n\tRun()\n\tRun()\n}\n",
+		"app/run.go":       "package app\n\nfunc Run() {\n\thelper()\n}\n\nfunc helper() {}\n",
+		"app/util.go":      "package app\n\nfunc Unused() {}\n",
+		"scripts/build.py": "def build():\n    pass\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("writing %s: %v", name, err)
+		}
+	}
+
+	cfg := &Config{
+		DBType:            "sqlite",
+		EmbeddingProvider: "off",
+		Dimensions:        768,
+	}
+	idx, err := New(tempDir, cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+
+	if _, err := idx.Index(context.Background(), IndexOptions{Force: true}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+
+	summary, err := idx.Summary(0)
+	if err != nil {
+		t.Fatalf("Summary() error = %v", err)
+	}
+
+	if summary.Files != 4 {
+		t.Errorf("Files = %d, want 4", summary.Files)
+	}
+
+	langs := make(map[string]int)
+	for _, l := range summary.Languages {
+		langs[l.Language] = l.Files
+	}
+	if langs["go"] != 3 || langs["python"] != 1 {
+		t.Errorf("Languages = %+v, want 3 go and 1 python", summary.Languages)
+	}
+	if summary.Languages[0].Language != "go" {
+		t.Errorf("dominant language = %q, want go", summary.Languages[0].Language)
+	}
+
+	dirs := make(map[string]int)
+	for _, d := range summary.Directories {
+		dirs[d.Dir] = d.Files
+	}
+	want := map[string]int{"app": 2, "scripts": 1, ".": 1}
+	for dir, count := range want {
+		if dirs[dir] != count {
+			t.Errorf("Directories[%s] = %d, want %d (got %+v)", dir, dirs[dir], count, summary.Directories)
+		}
+	}
+	if summary.Directories[0].Dir != "app" {
+		t.Errorf("largest directory = %q, want app", summary.Directories[0].Dir)
+	}
+
+	// Run is called twice; Unused and build never are
+	if len(summary.TopSymbols) == 0 {
+		t.Fatal("expected referenced symbols")
+	}
+	if top := summary.TopSymbols[0]; top.Name != "Run" || top.References != 2 || top.Path != filepath.Join("app", "run.go") {
+		t.Errorf("TopSymbols[0] = %+v, want Run in app/run.go with 2 references", top)
+	}
+	for _, sym := range summary.TopSymbols {
+		if sym.Name == "Unused" || sym.Name == "build" {
+			t.Errorf("unreferenced symbol %s listed in TopSymbols", sym.Name)
+		}
+	}
+
+	// The limit caps every list
+	limited, err := idx.Summary(1)
+	if err != nil {
+		t.Fatalf("Summary(1) error = %v", err)
+	}
+	if len(limited.Directories) != 1 || len(limited.LargestFiles) != 1 || len(limited.TopSymbols) != 1 {
+		t.Errorf("Summary(1) lists not capped: %+v", limited)
+	}
+}
@@ -0,0 +1,36 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+
+	"codetect/internal/embedding"
+)
+
+// Verify cross-checks this repo's locations against the embedding cache;
+// see embedding.Pipeline.Verify. With repair, orphaned embeddings are
+// deleted and dangling locations re-embedded from their files, as
+// EmbedMissing does, which needs the embedding provider. Locations whose
+// file changed since it was indexed stay dangling until the next index.
+func (idx *Indexer) Verify(ctx context.Context, repair bool) (*embedding.VerifyResult, error) {
+	result, err := idx.pipeline.Verify(ctx, idx.repoPath)
+	if err != nil || !repair {
+		return result, err
+	}
+
+	if len(result.Orphaned) > 0 {
+		result.OrphansDeleted, err = idx.pipeline.DeleteOrphans(result.Orphaned)
+		if err != nil {
+			return result, err
+		}
+	}
+	if result.DanglingHashes > 0 {
+		missing, err := idx.EmbedMissing(ctx)
+		if err != nil {
+			return result, fmt.Errorf("re-embedding dangling locations: %w", err)
+		}
+		result.Reembedded = missing.Embedded
+		result.Unresolved = missing.Unresolved
+	}
+	return result, nil
+}
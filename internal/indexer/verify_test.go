@@ -0,0 +1,117 @@
+package indexer
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"codetect/internal/embedding"
+)
+
+func TestIndexer_Verify(t *testing.T) {
+	repo := writeRepo(t, map[string]string{
+		"a.go": "package a\n\nfunc A() int {\n\treturn 1\n}\n",
+		"b.go": "package a\n\nfunc B() int {\n\treturn 2\n}\n",
+	})
+	idx, err := New(repo, &Config{
+		DBType:     "sqlite",
+		Dimensions: len(embedTokens),
+		Embedder:   &tokenEmbedder{},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer idx.Close()
+	ctx := context.Background()
+
+	if _, err := idx.Index(ctx, IndexOptions{}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	result, err := idx.Verify(ctx, false)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if !result.Consistent() || result.Locations == 0 || result.Embeddings == 0 {
+		t.Fatalf("Verify() after indexing = %+v, want consistent", result)
+	}
+
+	// Dangling: the embeddings of b.go are lost
+	locs, err := idx.Locations().GetByPath(repo, "b.go")
+	if err != nil || len(locs) == 0 {
+		t.Fatalf("GetByPath() = %v, %v", locs, err)
+	}
+	var dangling []string
+	for _, loc := range locs {
+		dangling = append(dangling, loc.ContentHash)
+	}
+	slices.Sort(dangling)
+	dangling = slices.Compact(dangling)
+	if err := idx.cache.DeleteBatch(dangling); err != nil {
+		t.Fatalf("DeleteBatch() error = %v", err)
+	}
+
+	// Orphaned: an embedding whose locations were never written
+	vector := make([]float32, len(embedTokens))
+	vector[0] = 1
+	orphan := embedding.HashContent("never located")
+	if err := idx.cache.Put(orphan, vector); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	// Not orphaned: a model space's vector of an indexed chunk, though the
+	// indexer has no such space
+	aLocs, err := idx.Locations().GetByPath(repo, "a.go")
+	if err != nil || len(aLocs) == 0 {
+		t.Fatalf("GetByPath() = %v, %v", aLocs, err)
+	}
+	spaceKey := embedding.ModelCacheKey("other", aLocs[0].ContentHash)
+	if err := idx.cache.PutBatchModel(map[string][]float32{spaceKey: vector}, "other"); err != nil {
+		t.Fatalf("PutBatchModel() error = %v", err)
+	}
+
+	result, err = idx.Verify(ctx, false)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if result.Consistent() {
+		t.Fatal("Verify() reported consistent with dangling and orphaned entries")
+	}
+	if len(result.DanglingLocations) != len(locs) || result.DanglingHashes != len(dangling) {
+		t.Errorf("dangling = %d locations (%d hashes), want %d (%d)",
+			len(result.DanglingLocations), result.DanglingHashes, len(locs), len(dangling))
+	}
+	for _, loc := range result.DanglingLocations {
+		if loc.Path != "b.go" {
+			t.Errorf("dangling location in %s, want only b.go", loc.Path)
+		}
+	}
+	if len(result.Orphaned) != 1 || result.Orphaned[0].ContentHash != orphan {
+		t.Errorf("orphaned = %+v, want only %s", result.Orphaned, orphan)
+	}
+	if result.Reembedded != 0 || result.OrphansDeleted != 0 {
+		t.Errorf("Verify() without repair changed the index: %+v", result)
+	}
+
+	// Repair re-embeds the dangling hashes and deletes the orphan
+	result, err = idx.Verify(ctx, true)
+	if err != nil {
+		t.Fatalf("Verify(repair) error = %v", err)
+	}
+	if result.Reembedded != len(dangling) || result.Unresolved != 0 || result.OrphansDeleted != 1 {
+		t.Errorf("Verify(repair) = %+v, want %d re-embedded and 1 orphan deleted", result, len(dangling))
+	}
+
+	result, err = idx.Verify(ctx, false)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if !result.Consistent() {
+		t.Errorf("Verify() after repair = %+v, want consistent", result)
+	}
+	if ok, err := idx.cache.HasEntry(orphan); err != nil || ok {
+		t.Errorf("orphan still cached (%v)", err)
+	}
+	if ok, err := idx.cache.HasEntry(spaceKey); err != nil || !ok {
+		t.Errorf("model space vector deleted by repair (%v)", err)
+	}
+}
@@ -3,14 +3,17 @@
 // Configuration is controlled via environment variables:
 //   - CODETECT_LOG_LEVEL: debug, info, warn, error (default: info)
 //   - CODETECT_LOG_FORMAT: text, json (default: text)
+//   - CODETECT_NO_EMOJI: true to keep human-readable output ASCII (default: false)
 //
 // All logging goes to stderr to keep stdout clean for MCP protocol.
 package logging
 
 import (
+	"fmt"
 	"io"
 	"log/slog"
 	"os"
+	"strconv"
 	"strings"
 )
 
@@ -28,6 +31,10 @@ type Config struct {
 	Format string    // "text" or "json"
 	Output io.Writer // defaults to os.Stderr
 	Source string    // component name for context
+
+	// NoEmoji drops emoji from human-readable output such as Block
+	// headers, for terminals and CI logs that render them as mojibake
+	NoEmoji bool
 }
 
 // DefaultConfig returns sensible defaults for the given source component.
@@ -44,6 +51,7 @@ func DefaultConfig(source string) Config {
 // Returns default configuration with any overrides from:
 //   - CODETECT_LOG_LEVEL: debug, info, warn, error
 //   - CODETECT_LOG_FORMAT: text, json
+//   - CODETECT_NO_EMOJI: true, false
 func LoadConfigFromEnv(source string) Config {
 	cfg := DefaultConfig(source)
 
@@ -64,6 +72,10 @@ func LoadConfigFromEnv(source string) Config {
 		cfg.Format = strings.ToLower(format)
 	}
 
+	if noEmoji, err := strconv.ParseBool(os.Getenv("CODETECT_NO_EMOJI")); err == nil {
+		cfg.NoEmoji = noEmoji
+	}
+
 	return cfg
 }
 
@@ -102,3 +114,57 @@ type nopWriter struct{}
 func (nopWriter) Write(p []byte) (int, error) {
 	return len(p), nil
 }
+
+// Field is one value of a Block.
+type Field struct {
+	Key   string // Attribute key in JSON output
+	Label string // Label in text output
+	Value any
+}
+
+// Block writes a titled group of values meant for people, such as a
+// preview before a long-running command, to cfg.Output. The text format
+// prints the values as an indented list under the title, prefixed with
+// icon unless cfg.NoEmoji is set. The json format writes one info record
+// with the title as its message and the values as attributes, so the block
+// does not break machine-readable logs.
+func Block(cfg Config, icon, title string, fields ...Field) {
+	if cfg.Format == "json" {
+		args := make([]any, 0, len(fields))
+		for _, f := range fields {
+			args = append(args, slog.Any(f.Key, f.Value))
+		}
+		New(cfg).Info(title, args...)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("\n")
+	if icon != "" && !cfg.NoEmoji {
+		b.WriteString(icon + " ")
+	}
+	b.WriteString(title + ":\n")
+	for _, f := range fields {
+		fmt.Fprintf(&b, "   %s: %v\n", f.Label, f.Value)
+	}
+	b.WriteString("\n")
+	io.WriteString(cfg.Output, b.String())
+}
+
+// Bytes is a byte count, printed in binary units (e.g. "1.5 KiB") and
+// encoded as a plain number in JSON.
+type Bytes int64
+
+// String formats b in the largest binary unit that keeps it at least 1.
+func (b Bytes) String() string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", int64(b))
+	}
+	div, exp := int64(unit), 0
+	for n := int64(b) / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -232,3 +232,71 @@ func TestDefault(t *testing.T) {
 		t.Error("Default should return a logger")
 	}
 }
+
+func TestLoadConfigFromEnvNoEmoji(t *testing.T) {
+	t.Setenv("CODETECT_NO_EMOJI", "")
+	if LoadConfigFromEnv("test").NoEmoji {
+		t.Error("NoEmoji should default to false")
+	}
+	t.Setenv("CODETECT_NO_EMOJI", "true")
+	if !LoadConfigFromEnv("test").NoEmoji {
+		t.Error("CODETECT_NO_EMOJI=true should set NoEmoji")
+	}
+}
+
+func TestBlock(t *testing.T) {
+	fields := []Field{
+		{Key: "files", Label: "Files to embed", Value: 42},
+		{Key: "total_bytes", Label: "Total size", Value: Bytes(1536)},
+		{Key: "provider", Label: "Provider", Value: "ollama"},
+	}
+	want := "Embedding Preview:\n   Files to embed: 42\n   Total size: 1.5 KiB\n   Provider: ollama\n"
+
+	var buf bytes.Buffer
+	Block(Config{Format: "text", Output: &buf}, "\U0001F4CA", "Embedding Preview", fields...)
+	if got := buf.String(); got != "\n\U0001F4CA "+want+"\n" {
+		t.Errorf("text block = %q", got)
+	}
+
+	buf.Reset()
+	Block(Config{Format: "text", Output: &buf, NoEmoji: true}, "\U0001F4CA", "Embedding Preview", fields...)
+	got := buf.String()
+	if got != "\n"+want+"\n" {
+		t.Errorf("text block without emoji = %q", got)
+	}
+	for i := 0; i < len(got); i++ {
+		if got[i] > 0x7f {
+			t.Fatalf("text block without emoji has non-ASCII byte %#x: %q", got[i], got)
+		}
+	}
+
+	buf.Reset()
+	Block(Config{Format: "json", Output: &buf, Source: "test"}, "\U0001F4CA", "Embedding Preview", fields...)
+	for _, s := range []string{`"msg":"Embedding Preview"`, `"files":42`, `"total_bytes":1536`, `"provider":"ollama"`} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("JSON block missing %s: %s", s, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "\U0001F4CA") {
+		t.Errorf("JSON block has the icon: %s", buf.String())
+	}
+}
+
+func TestBytesString(t *testing.T) {
+	tests := []struct {
+		b    Bytes
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 * 1024 * 1024, "5.0 MiB"},
+		{3 << 30, "3.0 GiB"},
+	}
+	for _, tt := range tests {
+		if got := tt.b.String(); got != tt.want {
+			t.Errorf("Bytes(%d).String() = %q, want %q", int64(tt.b), got, tt.want)
+		}
+	}
+}
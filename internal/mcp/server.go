@@ -2,19 +2,23 @@ package mcp
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
+	"time"
 
 	"codetect/internal/logging"
 )
 
 const ProtocolVersion = "2024-11-05"
 
-// ToolHandler is the function signature for handling tool calls
-type ToolHandler func(args map[string]interface{}) (*ToolsCallResult, error)
+// ToolHandler is the function signature for handling tool calls. ctx
+// expires after the server's tool timeout, if it has one.
+type ToolHandler func(ctx context.Context, args map[string]interface{}) (*ToolsCallResult, error)
 
 // Server handles MCP JSON-RPC communication over stdio
 type Server struct {
@@ -23,17 +27,46 @@ type Server struct {
 	tools    []Tool
 	handlers map[string]ToolHandler
 	logger   *slog.Logger
+	timeout  time.Duration // Per tool call, 0 for none
+}
+
+// ServerOption configures a Server.
+type ServerOption func(*Server)
+
+// WithLogger sets the logger for protocol errors, instead of one
+// configured from the environment by logging.Default. Wrap a custom
+// slog.Handler with slog.New.
+func WithLogger(logger *slog.Logger) ServerOption {
+	return func(s *Server) {
+		if logger != nil {
+			s.logger = logger
+		}
+	}
+}
+
+// WithToolTimeout cancels the context of each tool call after d, and
+// reports a call still failing then as timed out. 0 disables the limit.
+func WithToolTimeout(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.timeout = d
+	}
 }
 
 // NewServer creates a new MCP server
-func NewServer(name, version string) *Server {
-	return &Server{
+func NewServer(name, version string, opts ...ServerOption) *Server {
+	s := &Server{
 		name:     name,
 		version:  version,
 		tools:    []Tool{},
 		handlers: make(map[string]ToolHandler),
-		logger:   logging.Default("mcp"),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.logger == nil {
+		s.logger = logging.Default("mcp")
+	}
+	return s
 }
 
 // RegisterTool adds a tool to the server
@@ -183,7 +216,17 @@ func (s *Server) handleToolsCall(req *Request) *Response {
 		}
 	}
 
-	result, err := handler(params.Arguments)
+	ctx := context.Background()
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	result, err := handler(ctx, params.Arguments)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("tool %s timed out after %s: %w", params.Name, s.timeout, err)
+	}
 	if err != nil {
 		return &Response{
 			JSONRPC: "2.0",
@@ -0,0 +1,64 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerWithLogger(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	s := NewServer("test", "0.0.0", WithLogger(logger))
+
+	if resp := s.handleMessage([]byte(`{"jsonrpc": "2.0", "id": 1, "method": "ping"}`)); resp == nil || resp.Error != nil {
+		t.Fatalf("ping response = %+v", resp)
+	}
+	if resp := s.handleMessage([]byte("not json")); resp == nil || resp.Error == nil || resp.Error.Code != ParseError {
+		t.Fatalf("malformed request response = %+v, want a parse error", resp)
+	}
+
+	for _, want := range []string{"received request", "method=ping", "parse error"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs missing %q:\n%s", want, logs.String())
+		}
+	}
+
+	// A nil logger keeps the default
+	if s := NewServer("test", "0.0.0", WithLogger(nil)); s.logger == nil {
+		t.Error("NewServer with a nil logger left no logger set")
+	}
+}
+
+func TestServerToolTimeout(t *testing.T) {
+	s := NewServer("test", "0.0.0", WithToolTimeout(20*time.Millisecond))
+	s.RegisterTool(Tool{Name: "slow"}, func(ctx context.Context, args map[string]interface{}) (*ToolsCallResult, error) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(5 * time.Second):
+			return &ToolsCallResult{Content: []Content{{Type: "text", Text: "done"}}}, nil
+		}
+	})
+	s.RegisterTool(Tool{Name: "fast"}, func(ctx context.Context, args map[string]interface{}) (*ToolsCallResult, error) {
+		return &ToolsCallResult{Content: []Content{{Type: "text", Text: "done"}}}, nil
+	})
+
+	start := time.Now()
+	resp := s.handleMessage([]byte(`{"jsonrpc": "2.0", "id": 1, "method": "tools/call", "params": {"name": "slow"}}`))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("slow tool call took %v, want it cut off by the timeout", elapsed)
+	}
+	result, ok := resp.Result.(*ToolsCallResult)
+	if !ok || !result.IsError || !strings.Contains(result.Content[0].Text, "tool slow timed out after 20ms") {
+		t.Errorf("slow tool response = %+v, want a timeout error", resp.Result)
+	}
+
+	resp = s.handleMessage([]byte(`{"jsonrpc": "2.0", "id": 2, "method": "tools/call", "params": {"name": "fast"}}`))
+	if result, ok := resp.Result.(*ToolsCallResult); !ok || result.IsError {
+		t.Errorf("fast tool response = %+v, want success", resp.Result)
+	}
+}
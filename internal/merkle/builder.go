@@ -3,11 +3,17 @@ package merkle
 import (
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
+// NeverIndexed names are skipped even inside a ForceInclude directory:
+// version-control metadata and codetect's own data directory.
+var NeverIndexed = []string{".git", ".codetect"}
+
 // DefaultIgnorePatterns contains common directories and files to skip.
 var DefaultIgnorePatterns = []string{
 	// Version control
@@ -60,6 +66,65 @@ type Builder struct {
 	// IncludeDotfiles is a more specific list of hidden files to include
 	// even when IncludeHidden is false (e.g., ".gitignore", ".env.example").
 	IncludeDotfiles []string
+
+	// ForceInclude lists repo-relative directories that are walked even
+	// when ignored. Everything beneath a forced directory bypasses
+	// IgnorePatterns and hidden-file rules; ignored ancestors of one are
+	// entered only far enough to reach it.
+	ForceInclude []string
+
+	// IncludeHiddenDirs lists repo-relative hidden directories, such as
+	// ".github/workflows", that are walked like ordinary ones. Unlike
+	// ForceInclude, their contents follow IgnorePatterns and hidden-file
+	// rules as usual. Hidden ancestors of one are entered only far enough
+	// to reach it.
+	IncludeHiddenDirs []string
+
+	// OnIgnore, if set, is called for each file or directory Build skips
+	// because of IgnorePatterns or hidden-file rules. Ignored directories
+	// are reported once, without descending into them.
+	OnIgnore func(relPath string, isDir bool)
+
+	// Concurrency is the number of files read and hashed at once. The
+	// walk itself stays serial, so OnIgnore is called in order and the
+	// tree is identical to a serial build. 0 or 1 hashes serially.
+	Concurrency int
+
+	// PriorTree, if set, is a tree previously built from the same
+	// directory. Files whose size and modification time still match their
+	// node in it keep its hash instead of being read again, subject to the
+	// same RacyWindow as Unchanged. A write that preserves both goes
+	// unnoticed, so callers that need certainty, such as a forced reindex,
+	// should leave it nil. A tree built with a different Hasher is ignored.
+	PriorTree *Tree
+
+	// Hasher computes file and directory hashes. nil means SHA256, the
+	// algorithm of trees stored before it was configurable.
+	Hasher Hasher
+}
+
+// buildState is the state of one Build call.
+type buildState struct {
+	// collect, when set, makes the walk gather files below the root in
+	// pending instead of hashing them; their directories are then left
+	// for finishNode to hash.
+	collect bool
+	pending []*Node
+
+	hasher Hasher
+
+	prior  map[string]*Node // Files of the PriorTree, by path
+	cutoff time.Time        // Prior files modified after this are re-read
+}
+
+// reusable returns the prior node of the file at relPath if its hash can
+// be reused for a file with info, or nil.
+func (s *buildState) reusable(relPath string, info os.FileInfo) *Node {
+	prev := s.prior[relPath]
+	if prev == nil || prev.Hash == "" || prev.Size != info.Size() || !stable(info, prev.ModTime, s.cutoff) {
+		return nil
+	}
+	return prev
 }
 
 // NewBuilder creates a Builder with default settings.
@@ -76,6 +141,7 @@ func NewBuilder() *Builder {
 			".eslintrc.json",
 			".eslintrc.js",
 		},
+		Concurrency: runtime.GOMAXPROCS(0),
 	}
 }
 
@@ -89,24 +155,50 @@ func (b *Builder) Build(repoPath string) (*Tree, error) {
 		return nil, err
 	}
 
-	root, fileCount, err := b.buildNode(absPath, "")
+	// With concurrency, the walk only collects files, which a pool of
+	// workers then hashes before directory hashes are rolled up
+	hasher := b.hasher()
+	state := &buildState{collect: b.Concurrency > 1, hasher: hasher}
+	if b.PriorTree != nil && b.PriorTree.RepoPath == absPath && algoName(b.PriorTree.HashAlgo) == hasher.Name() {
+		state.prior = make(map[string]*Node)
+		collectFiles(b.PriorTree.Root, state.prior)
+		state.cutoff = b.PriorTree.BuildTime.Add(-RacyWindow)
+	}
+
+	root, fileCount, err := b.buildNode(absPath, "", false, state)
 	if err != nil {
 		return nil, err
 	}
+	if state.collect {
+		failed := b.hashFiles(absPath, hasher, state.pending)
+		fileCount, _ = finishNode(root, hasher, failed)
+	}
 
 	return &Tree{
 		Root:      root,
 		RepoPath:  absPath,
 		BuildTime: time.Now(),
 		FileCount: fileCount,
+		HashAlgo:  hasher.Name(),
 	}, nil
 }
 
+// hasher returns b.Hasher, or SHA256 if it is unset.
+func (b *Builder) hasher() Hasher {
+	if b.Hasher == nil {
+		return SHA256
+	}
+	return b.Hasher
+}
+
 // buildNode recursively builds a node for the given path.
 // basePath is the absolute path to the repository root.
 // relPath is the relative path from the root to this node.
+// restricted is set inside an ignored directory entered only to reach a
+// ForceInclude path; only entries on such a path are kept.
+// state carries the files collected for hashing and the prior tree.
 // Returns the node, file count, and any error.
-func (b *Builder) buildNode(basePath, relPath string) (*Node, int, error) {
+func (b *Builder) buildNode(basePath, relPath string, restricted bool, state *buildState) (*Node, int, error) {
 	fullPath := filepath.Join(basePath, relPath)
 
 	info, err := os.Lstat(fullPath)
@@ -137,12 +229,16 @@ func (b *Builder) buildNode(basePath, relPath string) (*Node, int, error) {
 		for _, entry := range entries {
 			name := entry.Name()
 
-			if b.shouldIgnore(name) {
+			childPath := filepath.Join(relPath, name)
+			skip, childRestricted := b.skipEntry(childPath, restricted)
+			if skip {
+				if b.OnIgnore != nil {
+					b.OnIgnore(childPath, entry.IsDir())
+				}
 				continue
 			}
 
-			childPath := filepath.Join(relPath, name)
-			child, count, err := b.buildNode(basePath, childPath)
+			child, count, err := b.buildNode(basePath, childPath, childRestricted, state)
 			if err != nil {
 				// Skip unreadable files/directories
 				continue
@@ -168,27 +264,173 @@ func (b *Builder) buildNode(basePath, relPath string) (*Node, int, error) {
 		})
 
 		// Compute directory hash from children
-		node.ComputeHash(nil)
+		if !state.collect {
+			node.ComputeHashWith(state.hasher, nil)
+		}
+	} else if prev := state.reusable(relPath, info); prev != nil {
+		node.Hash = prev.Hash
+		fileCount = 1
+	} else if state.collect && relPath != "" {
+		state.pending = append(state.pending, node)
+		fileCount = 1
 	} else {
 		// Read file content and compute hash
 		content, err := os.ReadFile(fullPath)
 		if err != nil {
 			return nil, 0, err
 		}
-		node.ComputeHash(content)
+		node.ComputeHashWith(state.hasher, content)
 		fileCount = 1
 	}
 
 	return node, fileCount, nil
 }
 
+// hashFiles reads and hashes files, whose nodes are below basePath, with
+// hasher on b.Concurrency workers. It returns the nodes of files that could not be
+// read, which a serial build would have skipped.
+func (b *Builder) hashFiles(basePath string, hasher Hasher, files []*Node) map[*Node]bool {
+	failed := make([]bool, len(files))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(b.Concurrency, len(files)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				content, err := os.ReadFile(filepath.Join(basePath, files[i].Path))
+				if err != nil {
+					failed[i] = true
+					continue
+				}
+				files[i].ComputeHashWith(hasher, content)
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	unreadable := make(map[*Node]bool)
+	for i, f := range failed {
+		if f {
+			unreadable[files[i]] = true
+		}
+	}
+	return unreadable
+}
+
+// collectFiles adds the file nodes at and below node to files, by path.
+func collectFiles(node *Node, files map[string]*Node) {
+	if node == nil {
+		return
+	}
+	if !node.IsDir {
+		files[node.Path] = node
+		return
+	}
+	for _, child := range node.Children {
+		collectFiles(child, files)
+	}
+}
+
+// finishNode completes a tree built with pending files once they are
+// hashed: it drops the failed files and directories left empty by them,
+// as a serial build would, and rolls up directory hashes with hasher. It
+// returns the node's file count and whether the node is kept.
+func finishNode(node *Node, hasher Hasher, failed map[*Node]bool) (int, bool) {
+	if !node.IsDir {
+		if failed[node] {
+			return 0, false
+		}
+		return 1, true
+	}
+
+	fileCount := 0
+	kept := node.Children[:0]
+	for _, child := range node.Children {
+		count, keep := finishNode(child, hasher, failed)
+		if !keep || (child.IsDir && len(child.Children) == 0) {
+			continue
+		}
+		kept = append(kept, child)
+		fileCount += count
+	}
+	node.Children = kept
+	node.ComputeHashWith(hasher, nil)
+	return fileCount, true
+}
+
+// skipEntry decides whether the entry at relPath is left out of the tree.
+// restricted is the parent's state; the returned restricted applies to the
+// entry's children.
+//
+// Precedence, highest first: NeverIndexed names are always skipped; entries
+// at or below a ForceInclude directory are kept; an IncludeHiddenDirs
+// directory is exempt from the hidden-file rules; everything else follows
+// IgnorePatterns and the hidden-file rules. An ignored directory that
+// contains a forced or allowlisted one is entered, but only the path to it is
+// kept.
+func (b *Builder) skipEntry(relPath string, restricted bool) (skip, childRestricted bool) {
+	name := filepath.Base(relPath)
+	for _, never := range NeverIndexed {
+		if name == never {
+			return true, false
+		}
+	}
+
+	within, onPath := MatchForceInclude(b.ForceInclude, relPath)
+	hiddenWithin, hiddenOnPath := MatchForceInclude(b.IncludeHiddenDirs, relPath)
+	switch {
+	case within:
+		return false, false
+	case onPath:
+		return false, restricted || b.shouldIgnore(name)
+	case hiddenWithin:
+		// Only the listed directory itself is exempt
+		if parentWithin, _ := MatchForceInclude(b.IncludeHiddenDirs, filepath.Dir(relPath)); parentWithin {
+			return b.shouldIgnore(name), false
+		}
+		return b.matchesIgnorePattern(name), false
+	case hiddenOnPath:
+		if b.matchesIgnorePattern(name) {
+			return true, false
+		}
+		return false, restricted || b.shouldIgnore(name)
+	case restricted:
+		return true, false
+	default:
+		return b.shouldIgnore(name), false
+	}
+}
+
+// MatchForceInclude reports whether relPath is one of dirs or beneath one
+// (within), or is an ancestor of one (onPath). Paths are repo-relative;
+// either separator is accepted and trailing slashes are ignored.
+func MatchForceInclude(dirs []string, relPath string) (within, onPath bool) {
+	rel := strings.Trim(filepath.ToSlash(relPath), "/")
+	for _, dir := range dirs {
+		dir = strings.Trim(filepath.ToSlash(filepath.Clean(dir)), "/")
+		if dir == "" || dir == "." {
+			continue
+		}
+		if rel == dir || strings.HasPrefix(rel, dir+"/") {
+			return true, false
+		}
+		if rel == "" || strings.HasPrefix(dir, rel+"/") {
+			onPath = true
+		}
+	}
+	return false, onPath
+}
+
 // shouldIgnore returns true if the given name should be skipped.
 func (b *Builder) shouldIgnore(name string) bool {
-	// Check default ignore patterns
-	for _, pattern := range b.IgnorePatterns {
-		if name == pattern {
-			return true
-		}
+	if b.matchesIgnorePattern(name) {
+		return true
 	}
 
 	// Handle hidden files
@@ -210,12 +452,55 @@ func (b *Builder) shouldIgnore(name string) bool {
 	return false
 }
 
+// matchesIgnorePattern reports whether name is one of IgnorePatterns.
+func (b *Builder) matchesIgnorePattern(name string) bool {
+	for _, pattern := range b.IgnorePatterns {
+		if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
 // WithIgnorePatterns adds additional patterns to ignore.
 func (b *Builder) WithIgnorePatterns(patterns ...string) *Builder {
 	b.IgnorePatterns = append(b.IgnorePatterns, patterns...)
 	return b
 }
 
+// WithForceInclude adds directories to walk even when ignored.
+func (b *Builder) WithForceInclude(dirs ...string) *Builder {
+	b.ForceInclude = append(b.ForceInclude, dirs...)
+	return b
+}
+
+// WithIncludeHiddenDirs adds hidden directories to walk like ordinary ones.
+func (b *Builder) WithIncludeHiddenDirs(dirs ...string) *Builder {
+	b.IncludeHiddenDirs = append(b.IncludeHiddenDirs, dirs...)
+	return b
+}
+
+// WithConcurrency sets the number of files hashed at once; 1 hashes
+// serially.
+func (b *Builder) WithConcurrency(n int) *Builder {
+	b.Concurrency = n
+	return b
+}
+
+// WithPriorTree sets the tree whose hashes are reused for files that look
+// unchanged; nil hashes every file.
+func (b *Builder) WithPriorTree(tree *Tree) *Builder {
+	b.PriorTree = tree
+	return b
+}
+
+// WithHasher sets the hash algorithm; trees built with different ones
+// cannot be diffed against each other.
+func (b *Builder) WithHasher(h Hasher) *Builder {
+	b.Hasher = h
+	return b
+}
+
 // WithIncludeHidden enables including all hidden files.
 func (b *Builder) WithIncludeHidden(include bool) *Builder {
 	b.IncludeHidden = include
@@ -0,0 +1,274 @@
+package merkle
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"codetect/internal/db"
+)
+
+// DBStore persists the tree of one repository in the index database
+// instead of a JSON file: a merkle_trees row holds the tree's metadata and
+// merkle_nodes one row per file and directory, keyed by repository root
+// and path, so several repositories can share a database. Saving writes
+// only the rows that changed since the last save.
+type DBStore struct {
+	database db.DB
+	dialect  db.Dialect
+	schema   *db.SchemaBuilder
+	repoRoot string
+}
+
+// NewDBStore creates a store for the tree of repoRoot in database,
+// creating its tables if needed.
+func NewDBStore(database db.DB, dialect db.Dialect, repoRoot string) (*DBStore, error) {
+	s := &DBStore{
+		database: database,
+		dialect:  dialect,
+		schema:   db.NewSchemaBuilder(database, dialect),
+		repoRoot: repoRoot,
+	}
+	trees := []db.ColumnDef{
+		{Name: "repo_root", Type: db.ColTypeText, PrimaryKey: true},
+		{Name: "repo_path", Type: db.ColTypeText, Nullable: false},
+		{Name: "build_time", Type: db.ColTypeInteger, Nullable: false},
+		{Name: "file_count", Type: db.ColTypeInteger, Nullable: false},
+		{Name: "hash_algo", Type: db.ColTypeText, Nullable: false},
+	}
+	if _, err := database.Exec(dialect.CreateTableSQL("merkle_trees", trees)); err != nil {
+		return nil, fmt.Errorf("creating merkle_trees table: %w", err)
+	}
+	nodes := []db.ColumnDef{
+		{Name: "repo_root", Type: db.ColTypeText, Nullable: false},
+		{Name: "path", Type: db.ColTypeText, Nullable: false},
+		{Name: "hash", Type: db.ColTypeText, Nullable: false},
+		{Name: "is_dir", Type: db.ColTypeInteger, Nullable: false},
+		{Name: "size", Type: db.ColTypeInteger, Nullable: false},
+		{Name: "mod_time", Type: db.ColTypeInteger, Nullable: false},
+	}
+	if _, err := database.Exec(dialect.CreateTableSQL("merkle_nodes", nodes)); err != nil {
+		return nil, fmt.Errorf("creating merkle_nodes table: %w", err)
+	}
+	idxPath := dialect.CreateIndexSQL("merkle_nodes", "idx_merkle_nodes_path", []string{"repo_root", "path"}, true)
+	if _, err := database.Exec(idxPath); err != nil {
+		return nil, fmt.Errorf("creating merkle_nodes index: %w", err)
+	}
+	return s, nil
+}
+
+// nodeRow is a node as stored in merkle_nodes.
+type nodeRow struct {
+	hash    string
+	isDir   bool
+	size    int64
+	modTime int64
+}
+
+func rowOf(n *Node) nodeRow {
+	return nodeRow{hash: n.Hash, isDir: n.IsDir, size: n.Size, modTime: unixNano(n.ModTime)}
+}
+
+// unixNano is t in nanoseconds, keeping the zero time of invalidated
+// files as 0.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// Save persists the tree, replacing the one stored for the repository, in
+// a single transaction.
+func (s *DBStore) Save(tree *Tree) error {
+	if tree == nil || tree.Root == nil {
+		return fmt.Errorf("cannot save nil tree")
+	}
+
+	tx, err := s.database.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	stored, err := s.rows(tx)
+	if err != nil {
+		return err
+	}
+
+	upsertSQL := s.schema.SubstitutePlaceholders(s.dialect.UpsertSQL("merkle_nodes",
+		[]string{"repo_root", "path", "hash", "is_dir", "size", "mod_time"},
+		[]string{"repo_root", "path"}, []string{"hash", "is_dir", "size", "mod_time"}))
+	upsert, err := tx.Prepare(upsertSQL)
+	if err != nil {
+		return fmt.Errorf("preparing node upsert: %w", err)
+	}
+	defer upsert.Close()
+
+	var walkErr error
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		if walkErr != nil {
+			return
+		}
+		row := rowOf(n)
+		if prev, ok := stored[n.Path]; !ok || prev != row {
+			isDir := 0
+			if row.isDir {
+				isDir = 1
+			}
+			if _, err := upsert.Exec(s.repoRoot, n.Path, row.hash, isDir, row.size, row.modTime); err != nil {
+				walkErr = fmt.Errorf("storing node %s: %w", n.Path, err)
+				return
+			}
+		}
+		delete(stored, n.Path)
+		for _, child := range n.Children {
+			walk(child)
+		}
+	}
+	walk(tree.Root)
+	if walkErr != nil {
+		return walkErr
+	}
+
+	deleteSQL := s.schema.SubstitutePlaceholders("DELETE FROM merkle_nodes WHERE repo_root = ? AND path = ?")
+	for path := range stored {
+		if _, err := tx.Exec(deleteSQL, s.repoRoot, path); err != nil {
+			return fmt.Errorf("deleting node %s: %w", path, err)
+		}
+	}
+
+	treeSQL := s.schema.SubstitutePlaceholders(s.dialect.UpsertSQL("merkle_trees",
+		[]string{"repo_root", "repo_path", "build_time", "file_count", "hash_algo"},
+		[]string{"repo_root"}, []string{"repo_path", "build_time", "file_count", "hash_algo"}))
+	if _, err := tx.Exec(treeSQL, s.repoRoot, tree.RepoPath, unixNano(tree.BuildTime), tree.FileCount, tree.HashAlgo); err != nil {
+		return fmt.Errorf("storing tree: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// rows returns the stored nodes of the repository by path.
+func (s *DBStore) rows(tx db.Tx) (map[string]nodeRow, error) {
+	query := s.schema.SubstitutePlaceholders(
+		"SELECT path, hash, is_dir, size, mod_time FROM merkle_nodes WHERE repo_root = ?")
+	rows, err := tx.Query(query, s.repoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("querying nodes: %w", err)
+	}
+	defer rows.Close()
+
+	stored := make(map[string]nodeRow)
+	for rows.Next() {
+		var path string
+		var row nodeRow
+		var isDir int
+		if err := rows.Scan(&path, &row.hash, &isDir, &row.size, &row.modTime); err != nil {
+			return nil, fmt.Errorf("scanning node: %w", err)
+		}
+		row.isDir = isDir != 0
+		stored[path] = row
+	}
+	return stored, rows.Err()
+}
+
+// Load reads the repository's tree from the database.
+// Returns nil, nil if no tree is stored (first run).
+func (s *DBStore) Load() (*Tree, error) {
+	tree := &Tree{}
+	var buildTime int64
+	query := s.schema.SubstitutePlaceholders(
+		"SELECT repo_path, build_time, file_count, hash_algo FROM merkle_trees WHERE repo_root = ?")
+	err := s.database.QueryRow(query, s.repoRoot).Scan(&tree.RepoPath, &buildTime, &tree.FileCount, &tree.HashAlgo)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying tree: %w", err)
+	}
+	tree.BuildTime = fromUnixNano(buildTime)
+
+	rows, err := s.database.Query(s.schema.SubstitutePlaceholders(
+		"SELECT path, hash, is_dir, size, mod_time FROM merkle_nodes WHERE repo_root = ?"), s.repoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("querying nodes: %w", err)
+	}
+	defer rows.Close()
+
+	nodes := make(map[string]*Node)
+	for rows.Next() {
+		n := &Node{}
+		var isDir int
+		var modTime int64
+		if err := rows.Scan(&n.Path, &n.Hash, &isDir, &n.Size, &modTime); err != nil {
+			return nil, fmt.Errorf("scanning node: %w", err)
+		}
+		n.IsDir = isDir != 0
+		n.ModTime = fromUnixNano(modTime)
+		nodes[n.Path] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("querying nodes: %w", err)
+	}
+
+	tree.Root = nodes[""]
+	if tree.Root == nil {
+		return nil, fmt.Errorf("stored tree has no root node")
+	}
+	for path, n := range nodes {
+		if path == "" {
+			continue
+		}
+		parentPath := filepath.Dir(path)
+		if parentPath == "." {
+			parentPath = ""
+		}
+		parent := nodes[parentPath]
+		if parent == nil {
+			return nil, fmt.Errorf("stored node %s has no parent", path)
+		}
+		parent.Children = append(parent.Children, n)
+	}
+	for _, n := range nodes {
+		sort.Slice(n.Children, func(i, j int) bool {
+			return n.Children[i].Path < n.Children[j].Path
+		})
+	}
+
+	return tree, nil
+}
+
+// Exists returns true if a tree is stored for the repository.
+func (s *DBStore) Exists() bool {
+	var one int
+	query := s.schema.SubstitutePlaceholders("SELECT 1 FROM merkle_trees WHERE repo_root = ?")
+	return s.database.QueryRow(query, s.repoRoot).Scan(&one) == nil
+}
+
+// Delete removes the repository's stored tree.
+func (s *DBStore) Delete() error {
+	tx, err := s.database.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	for _, table := range []string{"merkle_nodes", "merkle_trees"} {
+		query := s.schema.SubstitutePlaceholders("DELETE FROM " + table + " WHERE repo_root = ?")
+		if _, err := tx.Exec(query, s.repoRoot); err != nil {
+			return fmt.Errorf("deleting tree: %w", err)
+		}
+	}
+	return tx.Commit()
+}
@@ -1,24 +1,40 @@
 package merkle
 
-import "sort"
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrHashAlgoMismatch is returned by Diff for trees built with different
+// hash algorithms, whose hashes cannot be compared.
+var ErrHashAlgoMismatch = errors.New("trees use different hash algorithms")
 
 // Changes represents the differences between two Merkle trees.
-// It categorizes changes into added, modified, and deleted files,
+// It categorizes changes into added, modified, deleted and renamed files,
 // enabling efficient incremental updates to indexes.
 type Changes struct {
-	Added    []string // Files that exist in new tree but not old
-	Modified []string // Files that exist in both but have different hashes
-	Deleted  []string // Files that exist in old tree but not new
+	Added    []string     // Files that exist in new tree but not old
+	Modified []string     // Files that exist in both but have different hashes
+	Deleted  []string     // Files that exist in old tree but not new
+	Renamed  []RenamePair // Files moved without changing content
+}
+
+// RenamePair is a file that moved from OldPath to NewPath with its content
+// unchanged.
+type RenamePair struct {
+	OldPath string
+	NewPath string
 }
 
 // IsEmpty returns true if there are no changes.
 func (c *Changes) IsEmpty() bool {
-	return len(c.Added) == 0 && len(c.Modified) == 0 && len(c.Deleted) == 0
+	return len(c.Added) == 0 && len(c.Modified) == 0 && len(c.Deleted) == 0 && len(c.Renamed) == 0
 }
 
 // Total returns the total number of changes.
 func (c *Changes) Total() int {
-	return len(c.Added) + len(c.Modified) + len(c.Deleted)
+	return len(c.Added) + len(c.Modified) + len(c.Deleted) + len(c.Renamed)
 }
 
 // AllChanged returns all files that need processing (added + modified).
@@ -33,9 +49,11 @@ func (c *Changes) AllChanged() []string {
 // Diff compares two Merkle trees and returns the changes.
 // If old is nil, all files in new are considered added.
 // If new is nil, all files in old are considered deleted.
-// The comparison uses content hashes, so files with the same
-// content but different names will be detected as add+delete.
-func Diff(old, new *Tree) *Changes {
+// A deleted file and an added file with the same content hash are
+// reported as a rename instead (see pairRenames).
+// Two trees built with different hash algorithms are refused with
+// ErrHashAlgoMismatch.
+func Diff(old, new *Tree) (*Changes, error) {
 	changes := &Changes{
 		Added:    make([]string, 0),
 		Modified: make([]string, 0),
@@ -49,19 +67,23 @@ func Diff(old, new *Tree) *Changes {
 			collectAllFilePaths(new.Root, &changes.Added)
 		}
 		sort.Strings(changes.Added)
-		return changes
+		return changes, nil
 	}
 
 	if new == nil || new.Root == nil {
 		// Everything is deleted
 		collectAllFilePaths(old.Root, &changes.Deleted)
 		sort.Strings(changes.Deleted)
-		return changes
+		return changes, nil
+	}
+
+	if !old.SameHashAlgo(new) {
+		return nil, fmt.Errorf("%w: %s and %s", ErrHashAlgoMismatch, algoName(old.HashAlgo), algoName(new.HashAlgo))
 	}
 
 	// Quick check: if root hashes match, no changes
 	if old.Root.Hash == new.Root.Hash {
-		return changes
+		return changes, nil
 	}
 
 	// Build maps for O(1) lookup
@@ -95,11 +117,57 @@ func Diff(old, new *Tree) *Changes {
 	sort.Strings(changes.Modified)
 	sort.Strings(changes.Deleted)
 
-	return changes
+	pairRenames(changes, oldMap, newMap)
+
+	return changes, nil
+}
+
+// pairRenames moves deleted and added files with the same content hash
+// from changes.Added and changes.Deleted into changes.Renamed. When several
+// files share content, each deleted file is paired with at most one added
+// file, both in path order, and the rest stay added or deleted. Files with
+// an InvalidHash are never paired.
+func pairRenames(changes *Changes, oldMap, newMap map[string]*Node) {
+	if len(changes.Added) == 0 || len(changes.Deleted) == 0 {
+		return
+	}
+
+	deletedByHash := make(map[string][]string)
+	for _, path := range changes.Deleted {
+		if hash := oldMap[path].Hash; hash != InvalidHash {
+			deletedByHash[hash] = append(deletedByHash[hash], path)
+		}
+	}
+
+	renamed := make(map[string]bool)
+	added := changes.Added[:0]
+	for _, newPath := range changes.Added {
+		hash := newMap[newPath].Hash
+		if candidates := deletedByHash[hash]; hash != InvalidHash && len(candidates) > 0 {
+			changes.Renamed = append(changes.Renamed, RenamePair{OldPath: candidates[0], NewPath: newPath})
+			renamed[candidates[0]] = true
+			deletedByHash[hash] = candidates[1:]
+			continue
+		}
+		added = append(added, newPath)
+	}
+	if len(changes.Renamed) == 0 {
+		return
+	}
+	changes.Added = added
+
+	deleted := changes.Deleted[:0]
+	for _, path := range changes.Deleted {
+		if !renamed[path] {
+			deleted = append(deleted, path)
+		}
+	}
+	changes.Deleted = deleted
 }
 
 // DiffWithEarlyExit performs a diff but stops early once it confirms changes exist.
 // This is useful when you only need to know if there are any changes at all.
+// Trees built with different hash algorithms always differ.
 func DiffWithEarlyExit(old, new *Tree) bool {
 	if old == nil || old.Root == nil {
 		return new != nil && new.Root != nil
@@ -0,0 +1,53 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"hash"
+
+	"lukechampine.com/blake3"
+)
+
+// Hash algorithm names, as recorded in Tree.HashAlgo.
+const (
+	HashSHA256 = "sha256"
+	HashBLAKE3 = "blake3"
+)
+
+// Hasher is the hash function a tree's file and directory hashes are
+// computed with. Hashes from different hashers are never comparable, so a
+// tree records the Name of the one that built it.
+type Hasher interface {
+	Name() string
+	New() hash.Hash
+}
+
+type sha256Hasher struct{}
+
+func (sha256Hasher) Name() string   { return HashSHA256 }
+func (sha256Hasher) New() hash.Hash { return sha256.New() }
+
+type blake3Hasher struct{}
+
+func (blake3Hasher) Name() string   { return HashBLAKE3 }
+func (blake3Hasher) New() hash.Hash { return blake3.New(32, nil) }
+
+var (
+	// SHA256 is the default hasher, used by trees stored before the hash
+	// algorithm was recorded.
+	SHA256 Hasher = sha256Hasher{}
+
+	// BLAKE3 hashes large repositories considerably faster than SHA256.
+	BLAKE3 Hasher = blake3Hasher{}
+)
+
+// HasherFor returns the hasher with the given name, or nil if there is
+// none. An empty name is SHA256.
+func HasherFor(name string) Hasher {
+	switch name {
+	case "", HashSHA256:
+		return SHA256
+	case HashBLAKE3:
+		return BLAKE3
+	}
+	return nil
+}
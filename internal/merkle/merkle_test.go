@@ -1,10 +1,14 @@
 package merkle
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
+
+	"codetect/internal/db"
 )
 
 // createTestDir creates a temporary directory with test files.
@@ -80,6 +84,14 @@ func TestNodeComputeHashDir(t *testing.T) {
 	if node.Hash == "" {
 		t.Error("directory hash should not be empty")
 	}
+
+	// Renaming a child changes the hash even though its content did not
+	before := node.Hash
+	child2.Path = "c.txt"
+	node.ComputeHash(nil)
+	if node.Hash == before {
+		t.Error("directory hash unchanged after renaming a child")
+	}
 }
 
 func TestNodeComputeHashDeterministic(t *testing.T) {
@@ -245,6 +257,70 @@ func TestBuilderDeterministicHash(t *testing.T) {
 	}
 }
 
+func TestBuilderConcurrencyMatchesSerial(t *testing.T) {
+	dir := createTestDir(t)
+	for i := 0; i < 40; i++ {
+		sub := filepath.Join(dir, fmt.Sprintf("pkg%d", i%7), fmt.Sprintf("mod%d", i%3))
+		if err := os.MkdirAll(sub, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(sub, fmt.Sprintf("f%d.go", i)), []byte(fmt.Sprint(i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "empty", "deeper"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".hidden"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	build := func(concurrency int) (*Tree, []string) {
+		var ignored []string
+		builder := NewBuilder().WithConcurrency(concurrency)
+		builder.OnIgnore = func(relPath string, isDir bool) { ignored = append(ignored, relPath) }
+		tree, err := builder.Build(dir)
+		if err != nil {
+			t.Fatalf("Build with concurrency %d failed: %v", concurrency, err)
+		}
+		return tree, ignored
+	}
+
+	serial, serialIgnored := build(1)
+	for _, n := range []int{2, 8, 64} {
+		tree, ignored := build(n)
+		if tree.RootHash() != serial.RootHash() || tree.FileCount != serial.FileCount {
+			t.Errorf("concurrency %d: root %s with %d files, want %s with %d",
+				n, tree.RootHash(), tree.FileCount, serial.RootHash(), serial.FileCount)
+		}
+		if got, want := nodeHashes(tree.Root), nodeHashes(serial.Root); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("concurrency %d: nodes %v, want %v", n, got, want)
+		}
+		if fmt.Sprint(ignored) != fmt.Sprint(serialIgnored) {
+			t.Errorf("concurrency %d: ignored %v, want %v", n, ignored, serialIgnored)
+		}
+	}
+}
+
+// nodeHashes lists "path=hash" for node and its descendants, in tree order.
+func nodeHashes(node *Node) []string {
+	list := []string{node.Path + "=" + node.Hash}
+	for _, child := range node.Children {
+		list = append(list, nodeHashes(child)...)
+	}
+	return list
+}
+
+// mustDiff diffs old and new, failing the test on error.
+func mustDiff(tb testing.TB, old, new *Tree) *Changes {
+	tb.Helper()
+	changes, err := Diff(old, new)
+	if err != nil {
+		tb.Fatalf("Diff: %v", err)
+	}
+	return changes
+}
+
 func TestBuilderIgnoresHiddenFiles(t *testing.T) {
 	dir := t.TempDir()
 
@@ -335,7 +411,7 @@ func TestDiffNilOldTree(t *testing.T) {
 	builder := NewBuilder()
 	tree, _ := builder.Build(dir)
 
-	changes := Diff(nil, tree)
+	changes := mustDiff(t, nil, tree)
 
 	if len(changes.Added) != 4 {
 		t.Errorf("expected 4 added files, got %d", len(changes.Added))
@@ -354,7 +430,7 @@ func TestDiffNilNewTree(t *testing.T) {
 	builder := NewBuilder()
 	tree, _ := builder.Build(dir)
 
-	changes := Diff(tree, nil)
+	changes := mustDiff(t, tree, nil)
 
 	if len(changes.Added) != 0 {
 		t.Errorf("expected 0 added files, got %d", len(changes.Added))
@@ -374,7 +450,7 @@ func TestDiffNoChanges(t *testing.T) {
 	tree1, _ := builder.Build(dir)
 	tree2, _ := builder.Build(dir)
 
-	changes := Diff(tree1, tree2)
+	changes := mustDiff(t, tree1, tree2)
 
 	if !changes.IsEmpty() {
 		t.Errorf("expected no changes, got: added=%d, modified=%d, deleted=%d",
@@ -393,7 +469,7 @@ func TestDiffDetectsAdded(t *testing.T) {
 
 	tree2, _ := builder.Build(dir)
 
-	changes := Diff(tree1, tree2)
+	changes := mustDiff(t, tree1, tree2)
 
 	if len(changes.Added) != 1 {
 		t.Errorf("expected 1 added file, got %d", len(changes.Added))
@@ -414,7 +490,7 @@ func TestDiffDetectsModified(t *testing.T) {
 
 	tree2, _ := builder.Build(dir)
 
-	changes := Diff(tree1, tree2)
+	changes := mustDiff(t, tree1, tree2)
 
 	if len(changes.Modified) != 1 {
 		t.Errorf("expected 1 modified file, got %d", len(changes.Modified))
@@ -435,7 +511,7 @@ func TestDiffDetectsDeleted(t *testing.T) {
 
 	tree2, _ := builder.Build(dir)
 
-	changes := Diff(tree1, tree2)
+	changes := mustDiff(t, tree1, tree2)
 
 	if len(changes.Deleted) != 1 {
 		t.Errorf("expected 1 deleted file, got %d", len(changes.Deleted))
@@ -458,7 +534,7 @@ func TestDiffMixedChanges(t *testing.T) {
 
 	tree2, _ := builder.Build(dir)
 
-	changes := Diff(tree1, tree2)
+	changes := mustDiff(t, tree1, tree2)
 
 	if len(changes.Added) != 1 {
 		t.Errorf("expected 1 added, got %d", len(changes.Added))
@@ -474,6 +550,168 @@ func TestDiffMixedChanges(t *testing.T) {
 	}
 }
 
+func TestDiffDetectsRenames(t *testing.T) {
+	files := func(contents map[string]string) *Tree {
+		var nodes []*Node
+		for path, content := range contents {
+			n := &Node{Path: path}
+			n.ComputeHash([]byte(content))
+			nodes = append(nodes, n)
+		}
+		return NewTree("/repo", nil, nodes)
+	}
+
+	old := files(map[string]string{
+		"dup1.txt":   "shared",
+		"dup2.txt":   "shared",
+		"dup3.txt":   "shared",
+		"moved.txt":  "unique",
+		"edited.txt": "before",
+		"gone.txt":   "gone",
+		"stale.txt":  "stale",
+	})
+	new := files(map[string]string{
+		"a/dup.txt":     "shared",
+		"b/dup.txt":     "shared",
+		"dir/moved.txt": "unique",
+		"edited.txt":    "after",
+		"fresh.txt":     "fresh",
+		"stale2.txt":    "stale",
+	})
+	// An invalidated file's hash says nothing about its content
+	old.Invalidate("stale.txt")
+
+	changes := mustDiff(t, old, new)
+
+	wantRenamed := []RenamePair{
+		{OldPath: "dup1.txt", NewPath: filepath.Join("a", "dup.txt")},
+		{OldPath: "dup2.txt", NewPath: filepath.Join("b", "dup.txt")},
+		{OldPath: "moved.txt", NewPath: filepath.Join("dir", "moved.txt")},
+	}
+	if fmt.Sprint(changes.Renamed) != fmt.Sprint(wantRenamed) {
+		t.Errorf("Renamed = %v, want %v", changes.Renamed, wantRenamed)
+	}
+	if want := []string{"fresh.txt", "stale2.txt"}; fmt.Sprint(changes.Added) != fmt.Sprint(want) {
+		t.Errorf("Added = %v, want %v", changes.Added, want)
+	}
+	if want := []string{"dup3.txt", "gone.txt", "stale.txt"}; fmt.Sprint(changes.Deleted) != fmt.Sprint(want) {
+		t.Errorf("Deleted = %v, want %v", changes.Deleted, want)
+	}
+	if want := []string{"edited.txt"}; fmt.Sprint(changes.Modified) != fmt.Sprint(want) {
+		t.Errorf("Modified = %v, want %v", changes.Modified, want)
+	}
+	if changes.Total() != 9 {
+		t.Errorf("Total = %d, want 9", changes.Total())
+	}
+
+	// A pure rename is still a change
+	if changes := mustDiff(t, files(map[string]string{"a.txt": "x"}), files(map[string]string{"b.txt": "x"})); changes.IsEmpty() || len(changes.Renamed) != 1 {
+		t.Errorf("pure rename: changes = %+v, want one rename", changes)
+	}
+}
+
+func TestHashers(t *testing.T) {
+	tests := []struct {
+		hasher Hasher
+		want   string // Hash of empty content
+	}{
+		{SHA256, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{BLAKE3, "af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262"},
+	}
+	for _, tt := range tests {
+		n := &Node{Path: "empty.txt"}
+		n.ComputeHashWith(tt.hasher, nil)
+		if n.Hash != tt.want {
+			t.Errorf("%s: hash = %s, want %s", tt.hasher.Name(), n.Hash, tt.want)
+		}
+		if got := HasherFor(tt.hasher.Name()); got == nil || got.Name() != tt.hasher.Name() {
+			t.Errorf("HasherFor(%q) = %v", tt.hasher.Name(), got)
+		}
+	}
+	if got := HasherFor(""); got == nil || got.Name() != HashSHA256 {
+		t.Error("HasherFor(\"\") should be SHA256")
+	}
+	if HasherFor("md5") != nil {
+		t.Error("HasherFor(\"md5\") should be nil")
+	}
+}
+
+func TestBuilderWithHasher(t *testing.T) {
+	dir := createTestDir(t)
+
+	sha, err := NewBuilder().Build(dir)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if sha.HashAlgo != HashSHA256 {
+		t.Errorf("default HashAlgo = %q, want %q", sha.HashAlgo, HashSHA256)
+	}
+
+	blake, err := NewBuilder().WithHasher(BLAKE3).Build(dir)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if blake.HashAlgo != HashBLAKE3 {
+		t.Errorf("HashAlgo = %q, want %q", blake.HashAlgo, HashBLAKE3)
+	}
+	if blake.RootHash() == sha.RootHash() {
+		t.Error("BLAKE3 and SHA256 trees should have different root hashes")
+	}
+	serial, err := NewBuilder().WithHasher(BLAKE3).WithConcurrency(1).Build(dir)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if serial.RootHash() != blake.RootHash() {
+		t.Error("serial and concurrent BLAKE3 builds differ")
+	}
+
+	// Updating a file rehashes with the tree's own algorithm
+	updated := blake.Clone()
+	updated.SetFile("file1.txt", []byte("changed"), time.Now())
+	if err := os.WriteFile(filepath.Join(dir, "file1.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, _ := NewBuilder().WithHasher(BLAKE3).Build(dir)
+	if updated.RootHash() != rebuilt.RootHash() {
+		t.Error("SetFile on a BLAKE3 tree should match a BLAKE3 rebuild")
+	}
+}
+
+func TestDiffRefusesMixedHashAlgos(t *testing.T) {
+	dir := createTestDir(t)
+	ageFiles(t, dir)
+
+	sha, _ := NewBuilder().Build(dir)
+	blake, _ := NewBuilder().WithHasher(BLAKE3).Build(dir)
+
+	if _, err := Diff(sha, blake); !errors.Is(err, ErrHashAlgoMismatch) {
+		t.Errorf("Diff(sha256, blake3) error = %v, want ErrHashAlgoMismatch", err)
+	}
+
+	// Trees stored before the algorithm was recorded are SHA256
+	legacy := sha.Clone()
+	legacy.HashAlgo = ""
+	if changes := mustDiff(t, legacy, sha); !changes.IsEmpty() {
+		t.Errorf("legacy tree diff = %+v, want no changes", changes)
+	}
+	if _, err := Diff(legacy, blake); !errors.Is(err, ErrHashAlgoMismatch) {
+		t.Errorf("Diff(legacy, blake3) error = %v, want ErrHashAlgoMismatch", err)
+	}
+
+	// A builder with another algorithm never takes the fast path or
+	// reuses the other tree's hashes
+	if !NewBuilder().Unchanged(sha) {
+		t.Error("Unchanged should be true for the same algorithm")
+	}
+	if NewBuilder().WithHasher(BLAKE3).Unchanged(sha) {
+		t.Error("Unchanged should be false for a different algorithm")
+	}
+	reused, _ := NewBuilder().WithHasher(BLAKE3).WithPriorTree(sha).Build(dir)
+	if reused.RootHash() != blake.RootHash() {
+		t.Error("a SHA256 prior tree should not be reused by a BLAKE3 build")
+	}
+}
+
 func TestDiffWithEarlyExit(t *testing.T) {
 	dir := createTestDir(t)
 
@@ -662,7 +900,7 @@ func TestFullWorkflow(t *testing.T) {
 
 	// First build - everything is new
 	tree1, _ := builder.Build(dir)
-	changes1 := Diff(nil, tree1)
+	changes1 := mustDiff(t, nil, tree1)
 
 	if len(changes1.Added) != 4 {
 		t.Errorf("first build: expected 4 added, got %d", len(changes1.Added))
@@ -683,7 +921,7 @@ func TestFullWorkflow(t *testing.T) {
 
 	// Second build - detect changes
 	tree2, _ := builder.Build(dir)
-	changes2 := Diff(tree1, tree2)
+	changes2 := mustDiff(t, tree1, tree2)
 
 	if len(changes2.Added) != 1 || changes2.Added[0] != "new.txt" {
 		t.Errorf("expected new.txt added, got %v", changes2.Added)
@@ -700,7 +938,7 @@ func TestFullWorkflow(t *testing.T) {
 
 	// Third build - no changes
 	tree3, _ := builder.Build(dir)
-	changes3 := Diff(tree2, tree3)
+	changes3 := mustDiff(t, tree2, tree3)
 
 	if !changes3.IsEmpty() {
 		t.Error("expected no changes in third build")
@@ -901,7 +1139,7 @@ func TestBuilderBuildNonExistentDir(t *testing.T) {
 }
 
 func TestDiffBothTreesNil(t *testing.T) {
-	changes := Diff(nil, nil)
+	changes := mustDiff(t, nil, nil)
 	if !changes.IsEmpty() {
 		t.Error("diff of two nil trees should be empty")
 	}
@@ -910,7 +1148,7 @@ func TestDiffBothTreesNil(t *testing.T) {
 func TestDiffEmptyRoots(t *testing.T) {
 	tree1 := &Tree{Root: nil}
 	tree2 := &Tree{Root: nil}
-	changes := Diff(tree1, tree2)
+	changes := mustDiff(t, tree1, tree2)
 	if !changes.IsEmpty() {
 		t.Error("diff of two empty trees should be empty")
 	}
@@ -1013,6 +1251,284 @@ func TestStoreLoadBackupNonExistent(t *testing.T) {
 	}
 }
 
+func TestStoreBackupDepth(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir)
+	store.SetBackupDepth(3)
+
+	for i := 1; i <= 5; i++ {
+		tree := &Tree{Root: &Node{Hash: fmt.Sprintf("hash%d", i)}, FileCount: i}
+		if err := store.SaveWithBackup(tree); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	current, _ := store.Load()
+	if current.RootHash() != "hash5" {
+		t.Errorf("current should be hash5, got %s", current.RootHash())
+	}
+	// Newest first
+	for n, want := range []string{"hash4", "hash3", "hash2"} {
+		backup, err := store.LoadBackupAt(n + 1)
+		if err != nil || backup == nil {
+			t.Fatalf("LoadBackupAt(%d) = %v, %v", n+1, backup, err)
+		}
+		if backup.RootHash() != want {
+			t.Errorf("backup %d should be %s, got %s", n+1, want, backup.RootHash())
+		}
+	}
+	if backup, _ := store.LoadBackupAt(4); backup != nil {
+		t.Errorf("backup 4 should not be kept, got %s", backup.RootHash())
+	}
+
+	// Lowering the depth drops the older backups
+	store.SetBackupDepth(1)
+	if err := store.SaveWithBackup(&Tree{Root: &Node{Hash: "hash6"}}); err != nil {
+		t.Fatal(err)
+	}
+	if backup, _ := store.LoadBackup(); backup == nil || backup.RootHash() != "hash5" {
+		t.Errorf("backup should be hash5, got %v", backup)
+	}
+	if backup, _ := store.LoadBackupAt(2); backup != nil {
+		t.Errorf("backup 2 should be dropped, got %s", backup.RootHash())
+	}
+}
+
+func TestStoreSaveWithBackupCrash(t *testing.T) {
+	defer func() { rename = os.Rename }()
+
+	// Fail each rename of a rotation in turn, as a crash at that point would
+	for failAt := 1; ; failAt++ {
+		dir := t.TempDir()
+		store := NewStore(dir)
+		store.SetBackupDepth(3)
+		for i := 1; i <= 3; i++ {
+			if err := store.SaveWithBackup(&Tree{Root: &Node{Hash: fmt.Sprintf("hash%d", i)}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		calls := 0
+		rename = func(oldPath, newPath string) error {
+			calls++
+			if calls == failAt {
+				return errors.New("crash")
+			}
+			return os.Rename(oldPath, newPath)
+		}
+		err := store.SaveWithBackup(&Tree{Root: &Node{Hash: "hash4"}})
+		rename = os.Rename
+		if err == nil {
+			if failAt == 1 {
+				t.Fatal("rotation made no renames")
+			}
+			break
+		}
+
+		current, loadErr := store.Load()
+		if loadErr != nil || current == nil {
+			t.Fatalf("crash at rename %d: Load() = %v, %v", failAt, current, loadErr)
+		}
+		if h := current.RootHash(); h != "hash3" && h != "hash4" {
+			t.Errorf("crash at rename %d: current is %s, want hash3 or hash4", failAt, h)
+		}
+		backup, loadErr := store.LoadBackup()
+		if loadErr != nil || backup == nil {
+			t.Errorf("crash at rename %d: LoadBackup() = %v, %v", failAt, backup, loadErr)
+		}
+	}
+}
+
+func TestStoreBackupMetadata(t *testing.T) {
+	store := NewStore(t.TempDir())
+	store.SetBackupDepth(2)
+
+	if backups, err := store.BackupMetadata(); err != nil || len(backups) != 0 {
+		t.Fatalf("BackupMetadata() with no backups = %v, %v", backups, err)
+	}
+
+	built := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 1; i <= 3; i++ {
+		tree := &Tree{
+			Root:      &Node{Hash: fmt.Sprintf("hash%d", i)},
+			FileCount: i,
+			BuildTime: built.Add(time.Duration(i) * time.Hour),
+		}
+		if err := store.SaveWithBackup(tree); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, err := store.BackupMetadata()
+	if err != nil {
+		t.Fatalf("BackupMetadata() error = %v", err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("BackupMetadata() = %+v, want 2 backups", backups)
+	}
+	for i, md := range backups {
+		want := 2 - i // Newest first
+		if md.Backup != i+1 || md.RootHash != fmt.Sprintf("hash%d", want) || md.FileCount != want ||
+			!md.BuildTime.Equal(built.Add(time.Duration(want)*time.Hour)) || md.HashAlgo != HashSHA256 {
+			t.Errorf("backup %d = %+v, want tree %d", i+1, md, want)
+		}
+	}
+}
+
+func TestStoreRestoreFromBackup(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir)
+
+	if _, err := store.RestoreFromBackup(); !errors.Is(err, ErrNoBackup) {
+		t.Errorf("RestoreFromBackup() with no backup error = %v, want ErrNoBackup", err)
+	}
+
+	good := &Tree{Root: &Node{Hash: "good"}, FileCount: 3}
+	if err := store.SaveWithBackup(good); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveWithBackup(&Tree{Root: &Node{Hash: "bad"}, FileCount: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the current tree
+	if err := os.WriteFile(store.Path(), []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(); err == nil {
+		t.Fatal("Load() of a corrupt tree should fail")
+	}
+
+	md, err := store.RestoreFromBackup()
+	if err != nil {
+		t.Fatalf("RestoreFromBackup() error = %v", err)
+	}
+	if md.RootHash != "good" || md.FileCount != 3 || md.Backup != 0 {
+		t.Errorf("RestoreFromBackup() = %+v, want the good tree", md)
+	}
+	current, err := store.Load()
+	if err != nil || current.RootHash() != "good" {
+		t.Fatalf("Load() after restore = %v, %v, want the good tree", current, err)
+	}
+
+	// The backup is kept, and later saves rotate it as usual
+	if backup, _ := store.LoadBackup(); backup == nil || backup.RootHash() != "good" {
+		t.Errorf("LoadBackup() after restore = %v, want the good tree", backup)
+	}
+	if err := store.SaveWithBackup(&Tree{Root: &Node{Hash: "next"}}); err != nil {
+		t.Fatal(err)
+	}
+	if backup, _ := store.LoadBackup(); backup == nil || backup.RootHash() != "good" {
+		t.Errorf("LoadBackup() after the next save = %v, want the good tree", backup)
+	}
+	if current, _ := store.Load(); current.RootHash() != "next" {
+		t.Errorf("current after the next save = %s, want next", current.RootHash())
+	}
+}
+
+func TestStoreRestoreFromCorruptBackup(t *testing.T) {
+	store := NewStore(t.TempDir())
+	for _, hash := range []string{"old", "current"} {
+		if err := store.SaveWithBackup(&Tree{Root: &Node{Hash: hash}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(store.backupPath(1), []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.RestoreFromBackup(); err == nil {
+		t.Error("RestoreFromBackup() of a corrupt backup should fail")
+	}
+	if current, err := store.Load(); err != nil || current.RootHash() != "current" {
+		t.Errorf("Load() after a failed restore = %v, %v, want the current tree kept", current, err)
+	}
+	if _, err := store.RestoreFromBackupAt(2); !errors.Is(err, ErrNoBackup) {
+		t.Errorf("RestoreFromBackupAt(2) error = %v, want ErrNoBackup", err)
+	}
+}
+
+func TestDBStore(t *testing.T) {
+	cfg := db.DefaultConfig(":memory:")
+	database, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	dir := createTestDir(t)
+	store, err := NewDBStore(database, cfg.Dialect(), dir)
+	if err != nil {
+		t.Fatalf("NewDBStore: %v", err)
+	}
+	other, err := NewDBStore(database, cfg.Dialect(), "/other")
+	if err != nil {
+		t.Fatalf("NewDBStore: %v", err)
+	}
+
+	if tree, err := store.Load(); tree != nil || err != nil {
+		t.Fatalf("Load() before Save = %v, %v; want nil, nil", tree, err)
+	}
+	if store.Exists() {
+		t.Error("Exists() should be false before Save")
+	}
+	if err := store.Save(nil); err == nil {
+		t.Error("Save(nil) should fail")
+	}
+
+	tree, _ := NewBuilder().WithHasher(BLAKE3).Build(dir)
+	tree.Invalidate("file1.txt")
+	if err := store.Save(tree); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := other.Save(&Tree{Root: &Node{IsDir: true, Hash: "other"}, RepoPath: "/other"}); err != nil {
+		t.Fatalf("Save other: %v", err)
+	}
+
+	loaded, err := store.Load()
+	if err != nil || loaded == nil {
+		t.Fatalf("Load() = %v, %v", loaded, err)
+	}
+	if fmt.Sprint(nodeHashes(loaded.Root)) != fmt.Sprint(nodeHashes(tree.Root)) {
+		t.Errorf("loaded nodes = %v, want %v", nodeHashes(loaded.Root), nodeHashes(tree.Root))
+	}
+	if loaded.RepoPath != tree.RepoPath || loaded.FileCount != tree.FileCount ||
+		loaded.HashAlgo != HashBLAKE3 || !loaded.BuildTime.Equal(tree.BuildTime) {
+		t.Errorf("loaded tree = %+v, want %+v", loaded, tree)
+	}
+	if n := loaded.Find("file1.txt"); n == nil || n.Size != -1 || !n.ModTime.IsZero() {
+		t.Errorf("invalidated node = %+v", n)
+	}
+	if n, want := loaded.Find("file2.txt"), tree.Find("file2.txt"); !n.ModTime.Equal(want.ModTime) || n.Size != want.Size {
+		t.Errorf("file2.txt = %+v, want %+v", n, want)
+	}
+
+	// Saving again replaces the tree, dropping files that are gone
+	if err := os.Remove(filepath.Join(dir, "subdir", "file3.txt")); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, _ := NewBuilder().WithHasher(BLAKE3).Build(dir)
+	if err := store.Save(rebuilt); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded, _ = store.Load()
+	if changes := mustDiff(t, loaded, rebuilt); !changes.IsEmpty() || loaded.Find(filepath.Join("subdir", "file3.txt")) != nil {
+		t.Errorf("reloaded tree differs from the saved one: %+v", changes)
+	}
+
+	// Each repository has its own tree
+	if got, _ := other.Load(); got == nil || got.RootHash() != "other" {
+		t.Errorf("other repository's tree = %v", got)
+	}
+
+	if err := store.Delete(); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if store.Exists() || !other.Exists() {
+		t.Error("Delete should remove only the store's own tree")
+	}
+}
+
 func TestDiffWithEarlyExitNilTrees(t *testing.T) {
 	tree := &Tree{Root: &Node{Hash: "abc"}}
 
@@ -1050,6 +1566,223 @@ func TestBuilderEmptyDirectory(t *testing.T) {
 	}
 }
 
+// ===== Fast Path Tests =====
+
+// ageFiles backdates every file and directory under dir so that a
+// subsequent build is outside the racy window.
+func ageFiles(tb testing.TB, dir string) {
+	tb.Helper()
+	old := time.Now().Add(-time.Hour)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Chtimes(path, old, old)
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func TestBuilderUnchanged(t *testing.T) {
+	dir := createTestDir(t)
+	if err := os.MkdirAll(filepath.Join(dir, "empty", "deeper"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ageFiles(t, dir)
+
+	builder := NewBuilder()
+	tree, err := builder.Build(dir)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	if !builder.Unchanged(tree) {
+		t.Fatal("Unchanged = false for untouched directory")
+	}
+
+	// A persisted tree round-trips its timestamps
+	store := NewStore(t.TempDir())
+	if err := store.Save(tree); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !builder.Unchanged(loaded) {
+		t.Error("Unchanged = false for reloaded tree")
+	}
+
+	if builder.Unchanged(nil) {
+		t.Error("Unchanged = true for nil tree")
+	}
+}
+
+func TestBuilderUnchangedDetectsChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(dir string) error
+	}{
+		{"modify in place", func(dir string) error {
+			// Same size, so only the mtime gives it away
+			return os.WriteFile(filepath.Join(dir, "subdir", "nested", "file4.txt"), []byte("CONTENT4"), 0644)
+		}},
+		{"add file", func(dir string) error {
+			return os.WriteFile(filepath.Join(dir, "subdir", "new.txt"), []byte("new"), 0644)
+		}},
+		{"delete file", func(dir string) error {
+			return os.Remove(filepath.Join(dir, "file2.txt"))
+		}},
+		{"add file to empty dir", func(dir string) error {
+			return os.WriteFile(filepath.Join(dir, "empty", "deeper", "new.txt"), []byte("new"), 0644)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := createTestDir(t)
+			if err := os.MkdirAll(filepath.Join(dir, "empty", "deeper"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			ageFiles(t, dir)
+
+			builder := NewBuilder()
+			tree, err := builder.Build(dir)
+			if err != nil {
+				t.Fatalf("Build failed: %v", err)
+			}
+
+			if err := tt.mutate(dir); err != nil {
+				t.Fatal(err)
+			}
+			if builder.Unchanged(tree) {
+				t.Error("Unchanged = true after modification")
+			}
+		})
+	}
+}
+
+func TestBuilderUnchangedRacyBuild(t *testing.T) {
+	// Files written just before the build may share an mtime with a later
+	// write on coarse-grained filesystems, so they are never trusted.
+	dir := createTestDir(t)
+
+	builder := NewBuilder()
+	tree, err := builder.Build(dir)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if builder.Unchanged(tree) {
+		t.Error("Unchanged = true for files modified within the racy window")
+	}
+}
+
+func TestBuilderPriorTree(t *testing.T) {
+	dir := createTestDir(t)
+	ageFiles(t, dir)
+
+	prior, err := NewBuilder().Build(dir)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	// Same size, new mtime: re-read despite the prior tree
+	if err := os.WriteFile(filepath.Join(dir, "subdir", "nested", "file4.txt"), []byte("CONTENT4"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range []int{1, 4} {
+		tree, err := NewBuilder().WithConcurrency(n).WithPriorTree(prior).Build(dir)
+		if err != nil {
+			t.Fatalf("Build with prior tree failed: %v", err)
+		}
+		full, err := NewBuilder().WithConcurrency(n).Build(dir)
+		if err != nil {
+			t.Fatalf("Build failed: %v", err)
+		}
+		if tree.RootHash() != full.RootHash() || tree.FileCount != full.FileCount {
+			t.Errorf("concurrency %d: root %s with %d files, want %s with %d",
+				n, tree.RootHash(), tree.FileCount, full.RootHash(), full.FileCount)
+		}
+		changes := mustDiff(t, prior, tree)
+		if len(changes.Modified) != 1 || changes.Modified[0] != filepath.Join("subdir", "nested", "file4.txt") {
+			t.Errorf("concurrency %d: modified = %v, want only file4.txt", n, changes.Modified)
+		}
+	}
+}
+
+func TestBuilderPriorTreePreservedModTime(t *testing.T) {
+	// Known limitation: a same-size write that restores the old mtime is
+	// trusted to be unchanged. Only a build without the prior tree, as a
+	// forced reindex does, sees it.
+	dir := createTestDir(t)
+	ageFiles(t, dir)
+	path := filepath.Join(dir, "file1.txt")
+
+	prior, err := NewBuilder().Build(dir)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("CONTENT1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := NewBuilder().WithPriorTree(prior).Build(dir)
+	if err != nil {
+		t.Fatalf("Build with prior tree failed: %v", err)
+	}
+	if changes := mustDiff(t, prior, tree); !changes.IsEmpty() {
+		t.Errorf("prior tree: changes = %+v, want none (mtime preserved)", changes)
+	}
+
+	full, err := NewBuilder().Build(dir)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if changes := mustDiff(t, prior, full); len(changes.Modified) != 1 || changes.Modified[0] != "file1.txt" {
+		t.Errorf("full build: modified = %v, want [file1.txt]", changes.Modified)
+	}
+
+}
+
+func TestBuilderPriorTreeRacyBuild(t *testing.T) {
+	// Files modified within RacyWindow of the prior build are re-read even
+	// with their mtime preserved
+	dir := createTestDir(t)
+	path := filepath.Join(dir, "file1.txt")
+
+	prior, err := NewBuilder().Build(dir)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("CONTENT1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := NewBuilder().WithPriorTree(prior).Build(dir)
+	if err != nil {
+		t.Fatalf("Build with prior tree failed: %v", err)
+	}
+	if changes := mustDiff(t, prior, tree); len(changes.Modified) != 1 || changes.Modified[0] != "file1.txt" {
+		t.Errorf("modified = %v, want [file1.txt]", changes.Modified)
+	}
+}
+
 // ===== Benchmarks =====
 
 func BenchmarkBuildSmallRepo(b *testing.B) {
@@ -1071,6 +1804,25 @@ func BenchmarkBuildSmallRepo(b *testing.B) {
 	}
 }
 
+func BenchmarkBuildSmallRepoSerial(b *testing.B) {
+	dir := b.TempDir()
+
+	// Create 100 files
+	for i := 0; i < 100; i++ {
+		subdir := filepath.Join(dir, "dir"+string(rune('a'+i%26)))
+		os.MkdirAll(subdir, 0755)
+		os.WriteFile(filepath.Join(subdir, "file"+string(rune('0'+i%10))+".txt"),
+			[]byte("content"), 0644)
+	}
+
+	builder := NewBuilder().WithConcurrency(1)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		builder.Build(dir)
+	}
+}
+
 func BenchmarkDiffSmallRepo(b *testing.B) {
 	dir := b.TempDir()
 
@@ -1095,6 +1847,31 @@ func BenchmarkDiffSmallRepo(b *testing.B) {
 	}
 }
 
+// BenchmarkUnchangedSmallRepo measures the stat-only fast path against
+// BenchmarkBuildSmallRepo over the same layout.
+func BenchmarkUnchangedSmallRepo(b *testing.B) {
+	dir := b.TempDir()
+
+	// Create 100 files
+	for i := 0; i < 100; i++ {
+		subdir := filepath.Join(dir, "dir"+string(rune('a'+i%26)))
+		os.MkdirAll(subdir, 0755)
+		os.WriteFile(filepath.Join(subdir, "file"+string(rune('0'+i%10))+".txt"),
+			[]byte("content"), 0644)
+	}
+	ageFiles(b, dir)
+
+	builder := NewBuilder()
+	tree, _ := builder.Build(dir)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !builder.Unchanged(tree) {
+			b.Fatal("expected unchanged tree")
+		}
+	}
+}
+
 func BenchmarkStoreSaveLoad(b *testing.B) {
 	dir := b.TempDir()
 
@@ -1116,3 +1893,261 @@ func BenchmarkStoreSaveLoad(b *testing.B) {
 		store.Load()
 	}
 }
+
+func TestBuilderForceInclude(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"app.go":                  "package app",
+		"generated/api.go":        "package generated",
+		"build/gen/types.go":      "package gen",
+		"build/other/skip.go":     "package other",
+		"build/skip.go":           "package build",
+		"build/gen/.git/HEAD":     "ref: refs/heads/main",
+		"node_modules/dep/i.js":   "module.exports = 1",
+		"generated/sub/nested.go": "package sub",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ageFiles(t, dir)
+
+	builder := NewBuilder().
+		WithIgnorePatterns("generated").
+		WithForceInclude("generated/", "build/gen")
+	tree, err := builder.Build(dir)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	var paths []string
+	collectAllFilePaths(tree.Root, &paths)
+	want := map[string]bool{
+		"app.go":                  true,
+		"generated/api.go":        true,
+		"generated/sub/nested.go": true,
+		"build/gen/types.go":      true,
+	}
+	if len(paths) != len(want) {
+		t.Errorf("indexed %v, want %d files", paths, len(want))
+	}
+	for _, p := range paths {
+		if !want[filepath.ToSlash(p)] {
+			t.Errorf("unexpected file %s in tree", p)
+		}
+	}
+
+	// The quick scan applies the same rules
+	if !builder.Unchanged(tree) {
+		t.Error("Unchanged = false for untouched directory")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "node_modules", "dep", "j.js"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ageFiles(t, filepath.Join(dir, "node_modules"))
+	if !builder.Unchanged(tree) {
+		t.Error("Unchanged = false after change in ignored directory")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "generated", "api.go"), []byte("package changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if builder.Unchanged(tree) {
+		t.Error("Unchanged = true after change in force-included directory")
+	}
+}
+
+func TestBuilderIncludeHiddenDirs(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"app.go":                           "package app",
+		".config/tool/setup.go":            "package tool",
+		".config/tool/node_modules/dep.js": "module.exports = 1",
+		".config/.secrets":                 "TOKEN=1",
+		".github/workflows/ci.yml":         "on: push",
+		".github/ISSUE_TEMPLATE/bug.md":    "# Bug",
+		".github/CODEOWNERS":               "* @team",
+		".cache/tool/state.json":           "{}",
+		".env":                             "SECRET=1",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ageFiles(t, dir)
+
+	builder := NewBuilder().WithIncludeHiddenDirs(".config", ".github/workflows/")
+	tree, err := builder.Build(dir)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	var paths []string
+	collectAllFilePaths(tree.Root, &paths)
+	// Ignore patterns and hidden-file rules still apply inside an
+	// allowlisted directory, and only the path to .github/workflows is taken
+	// through .github
+	want := map[string]bool{
+		"app.go":                   true,
+		".config/tool/setup.go":    true,
+		".github/workflows/ci.yml": true,
+	}
+	if len(paths) != len(want) {
+		t.Errorf("indexed %v, want %d files", paths, len(want))
+	}
+	for _, p := range paths {
+		if !want[filepath.ToSlash(p)] {
+			t.Errorf("unexpected file %s in tree", p)
+		}
+	}
+
+	// The quick scan applies the same rules
+	if !builder.Unchanged(tree) {
+		t.Error("Unchanged = false for untouched directory")
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".github", "workflows", "ci.yml"), []byte("on: pull_request"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if builder.Unchanged(tree) {
+		t.Error("Unchanged = true after change in allowlisted hidden directory")
+	}
+}
+
+func TestMatchForceInclude(t *testing.T) {
+	dirs := []string{"build/gen", "generated/"}
+	tests := []struct {
+		path           string
+		within, onPath bool
+	}{
+		{"build", false, true},
+		{"build/gen", true, false},
+		{"build/gen/x.go", true, false},
+		{"build/general", false, false},
+		{"generated", true, false},
+		{"src", false, false},
+	}
+	for _, tt := range tests {
+		within, onPath := MatchForceInclude(dirs, tt.path)
+		if within != tt.within || onPath != tt.onPath {
+			t.Errorf("MatchForceInclude(%q) = %v, %v; want %v, %v", tt.path, within, onPath, tt.within, tt.onPath)
+		}
+	}
+}
+
+func TestTreeFind(t *testing.T) {
+	dir := createTestDir(t)
+	tree, _ := NewBuilder().Build(dir)
+
+	node := tree.Find(filepath.Join("subdir", "nested", "file4.txt"))
+	if node == nil || node.Path != filepath.Join("subdir", "nested", "file4.txt") {
+		t.Fatalf("Find nested file = %+v", node)
+	}
+	if tree.Find("subdir") != nil {
+		t.Error("Find should not return directories")
+	}
+	if tree.Find("missing.txt") != nil {
+		t.Error("Find returned a node for a missing file")
+	}
+}
+
+func TestTreeUpdateFile(t *testing.T) {
+	dir := createTestDir(t)
+	builder := NewBuilder()
+	tree, _ := builder.Build(dir)
+
+	// File changes after the tree was built
+	path := filepath.Join(dir, "subdir", "file3.txt")
+	content := []byte("changed after build")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !tree.UpdateFile(filepath.Join("subdir", "file3.txt"), content, info) {
+		t.Fatal("UpdateFile did not find the file")
+	}
+
+	// The updated tree matches a fresh build, including directory hashes
+	fresh, _ := builder.Build(dir)
+	if tree.RootHash() != fresh.RootHash() {
+		t.Error("root hash not recomputed after UpdateFile")
+	}
+	if changes := mustDiff(t, tree, fresh); !changes.IsEmpty() {
+		t.Errorf("expected no changes after UpdateFile, got %+v", changes)
+	}
+}
+
+func TestTreeInvalidate(t *testing.T) {
+	dir := createTestDir(t)
+	builder := NewBuilder()
+	tree, _ := builder.Build(dir)
+	before := tree.RootHash()
+
+	if !tree.Invalidate("file2.txt") {
+		t.Fatal("Invalidate did not find the file")
+	}
+	if tree.Invalidate("missing.txt") {
+		t.Error("Invalidate reported a missing file as found")
+	}
+	if tree.RootHash() == before {
+		t.Error("root hash unchanged after Invalidate")
+	}
+
+	// Unchanged content is still reported as modified next time
+	fresh, _ := builder.Build(dir)
+	changes := mustDiff(t, tree, fresh)
+	if len(changes.Modified) != 1 || changes.Modified[0] != "file2.txt" {
+		t.Errorf("expected file2.txt modified, got %+v", changes)
+	}
+	if builder.Unchanged(tree) {
+		t.Error("Unchanged should be false for an invalidated tree")
+	}
+}
+
+func TestNewTreeMatchesBuild(t *testing.T) {
+	dir := createTestDir(t)
+	built, err := NewBuilder().Build(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same files, supplied as nodes in no particular order
+	var files []*Node
+	for _, path := range []string{
+		filepath.Join("subdir", "nested", "file4.txt"),
+		"file2.txt",
+		filepath.Join("subdir", "file3.txt"),
+		"file1.txt",
+	} {
+		content, err := os.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := &Node{Path: path, Size: int64(len(content))}
+		n.ComputeHash(content)
+		files = append(files, n)
+	}
+
+	tree := NewTree(dir, nil, files)
+	if tree.FileCount != built.FileCount {
+		t.Errorf("FileCount = %d, want %d", tree.FileCount, built.FileCount)
+	}
+	if tree.RootHash() != built.RootHash() {
+		t.Error("root hash differs from Build")
+	}
+	if changes := mustDiff(t, built, tree); !changes.IsEmpty() {
+		t.Errorf("expected no changes against Build, got %+v", changes)
+	}
+}
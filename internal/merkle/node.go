@@ -1,8 +1,8 @@
 package merkle
 
 import (
-	"crypto/sha256"
 	"encoding/hex"
+	"path/filepath"
 	"time"
 )
 
@@ -13,28 +13,37 @@ import (
 // of the entire subtree's contents.
 type Node struct {
 	Path     string    `json:"path"`               // Relative path from repo root
-	Hash     string    `json:"hash"`               // Hex-encoded SHA-256
+	Hash     string    `json:"hash"`               // Hex-encoded, see Tree.HashAlgo
 	IsDir    bool      `json:"is_dir"`             // True if this is a directory
 	Size     int64     `json:"size"`               // File size in bytes (0 for dirs)
 	ModTime  time.Time `json:"mod_time"`           // Last modification time
 	Children []*Node   `json:"children,omitempty"` // Sorted by path (dirs only)
 }
 
-// ComputeHash calculates the hash for this node.
-// For files: SHA-256 of the file content.
-// For directories: SHA-256 of concatenated child hashes (sorted by path).
-// This ensures that any change to a file propagates up to the root hash.
+// ComputeHash calculates the hash for this node with SHA256; see
+// ComputeHashWith.
 func (n *Node) ComputeHash(content []byte) {
+	n.ComputeHashWith(SHA256, content)
+}
+
+// ComputeHashWith calculates the hash for this node with h.
+// For files: the hash of the file content.
+// For directories: the hash of each child's name and hash (sorted by path).
+// This ensures that any change to a file, including renaming it within its
+// directory, propagates up to the root hash.
+func (n *Node) ComputeHashWith(h Hasher, content []byte) {
+	w := h.New()
 	if n.IsDir {
-		h := sha256.New()
 		for _, child := range n.Children {
-			h.Write([]byte(child.Hash))
+			w.Write([]byte(filepath.Base(child.Path)))
+			w.Write([]byte{0})
+			w.Write([]byte(child.Hash))
+			w.Write([]byte{0})
 		}
-		n.Hash = hex.EncodeToString(h.Sum(nil))
 	} else {
-		hash := sha256.Sum256(content)
-		n.Hash = hex.EncodeToString(hash[:])
+		w.Write(content)
 	}
+	n.Hash = hex.EncodeToString(w.Sum(nil))
 }
 
 // Clone creates a deep copy of the node and all its children.
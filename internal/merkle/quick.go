@@ -0,0 +1,118 @@
+package merkle
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RacyWindow is how close to a tree's BuildTime a modification time may be
+// before Unchanged treats it as uncertain. Filesystems with coarse mtime
+// granularity can record a write made just after a build with the same
+// timestamp as one made just before it.
+const RacyWindow = 2 * time.Second
+
+// Unchanged reports whether the filesystem under tree.RepoPath still matches
+// tree, using only directory listings and stat calls. It never reads file
+// contents, so it is much cheaper than Build on large repositories.
+//
+// A true result means no tracked file or directory has a modification time
+// or size different from the stored tree, no directory gained or lost
+// entries, and nothing was touched within RacyWindow of the build. Any
+// doubt (stat errors, racy timestamps, new entries) returns false, and the
+// caller should fall back to a full Build and Diff. A tree built with a
+// different Hasher than b's is never unchanged.
+func (b *Builder) Unchanged(tree *Tree) bool {
+	if tree == nil || tree.Root == nil || tree.RepoPath == "" || algoName(tree.HashAlgo) != b.hasher().Name() {
+		return false
+	}
+	cutoff := tree.BuildTime.Add(-RacyWindow)
+	return b.unchangedNode(tree.RepoPath, tree.Root, cutoff, false)
+}
+
+// unchangedNode checks a stored node against the filesystem. restricted has
+// the same meaning as in buildNode.
+func (b *Builder) unchangedNode(basePath string, node *Node, cutoff time.Time, restricted bool) bool {
+	info, err := os.Lstat(filepath.Join(basePath, node.Path))
+	if err != nil || info.IsDir() != node.IsDir || !stable(info, node.ModTime, cutoff) {
+		return false
+	}
+
+	if !node.IsDir {
+		return info.Size() == node.Size
+	}
+
+	// Directory mtimes change when entries are added, removed, or renamed,
+	// so a matching mtime already rules out most structural changes. The
+	// listing below also catches entries the stored tree omitted, such as
+	// directories that were empty at build time.
+	entries, err := os.ReadDir(filepath.Join(basePath, node.Path))
+	if err != nil {
+		return false
+	}
+
+	children := make(map[string]*Node, len(node.Children))
+	for _, child := range node.Children {
+		children[filepath.Base(child.Path)] = child
+	}
+
+	seen := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		relPath := filepath.Join(node.Path, name)
+		skip, childRestricted := b.skipEntry(relPath, restricted)
+		if skip || entry.Type()&os.ModeSymlink != 0 {
+			continue
+		}
+
+		child, ok := children[name]
+		if !ok {
+			// Untracked entries are only safe if they are still empty
+			// directory trees that Build would skip again.
+			if !entry.IsDir() || !b.emptyDir(basePath, relPath, cutoff, childRestricted) {
+				return false
+			}
+			continue
+		}
+
+		if !b.unchangedNode(basePath, child, cutoff, childRestricted) {
+			return false
+		}
+		seen++
+	}
+
+	return seen == len(node.Children)
+}
+
+// emptyDir reports whether the directory at relPath contains no files Build
+// would include and has not been modified since cutoff.
+func (b *Builder) emptyDir(basePath, relPath string, cutoff time.Time, restricted bool) bool {
+	dir := filepath.Join(basePath, relPath)
+	info, err := os.Lstat(dir)
+	if err != nil || !info.ModTime().Before(cutoff) {
+		return false
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		childPath := filepath.Join(relPath, entry.Name())
+		skip, childRestricted := b.skipEntry(childPath, restricted)
+		if skip || entry.Type()&os.ModeSymlink != 0 {
+			continue
+		}
+		if !entry.IsDir() || !b.emptyDir(basePath, childPath, cutoff, childRestricted) {
+			return false
+		}
+	}
+	return true
+}
+
+// stable reports whether a file's current modification time matches the
+// stored one and is old enough to trust.
+func stable(info os.FileInfo, stored, cutoff time.Time) bool {
+	mtime := info.ModTime()
+	return mtime.Equal(stored) && mtime.Before(cutoff)
+}
@@ -2,59 +2,98 @@ package merkle
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 )
 
 // TreeFileName is the default name for the persisted Merkle tree.
 const TreeFileName = "merkle-tree.json"
 
+// TreeStore persists the tree of one repository between index runs.
+// Store keeps it in a JSON file, DBStore in the index database.
+type TreeStore interface {
+	// Save replaces the stored tree.
+	Save(tree *Tree) error
+	// Load returns the stored tree, or nil, nil if there is none.
+	Load() (*Tree, error)
+	// Exists reports whether a tree is stored.
+	Exists() bool
+	// Delete removes the stored tree; deleting none is not an error.
+	Delete() error
+}
+
 // Store handles persistence of Merkle trees to disk.
 // Trees are stored as JSON files in the data directory,
 // typically .codetect/ within the repository.
 type Store struct {
-	dataDir string
+	dataDir     string
+	backupDepth int
 }
 
+// DefaultBackupDepth is the number of previous trees SaveWithBackup keeps
+// unless SetBackupDepth changes it.
+const DefaultBackupDepth = 1
+
+// ErrNoBackup is returned when restoring a backup tree that does not exist.
+var ErrNoBackup = errors.New("no backup tree")
+
+// rename is os.Rename, replaced in tests to simulate a crash.
+var rename = os.Rename
+
 // NewStore creates a store that persists data to the given directory.
 // The directory will be created if it doesn't exist.
 func NewStore(dataDir string) *Store {
-	return &Store{dataDir: dataDir}
+	return &Store{dataDir: dataDir, backupDepth: DefaultBackupDepth}
+}
+
+// SetBackupDepth sets how many previous trees SaveWithBackup keeps.
+// Values below 1 are treated as 1.
+func (s *Store) SetBackupDepth(n int) {
+	s.backupDepth = max(n, 1)
 }
 
 // Save persists the tree to disk as JSON.
 // The file is written atomically using a temp file + rename.
 func (s *Store) Save(tree *Tree) error {
+	tempPath, err := s.writeTemp(tree)
+	if err != nil {
+		return err
+	}
+
+	if err := rename(tempPath, s.Path()); err != nil {
+		os.Remove(tempPath) // Clean up on failure
+		return fmt.Errorf("rename temp file: %w", err)
+	}
+
+	return nil
+}
+
+// writeTemp writes the tree to a temp file next to the tree file and
+// returns its path.
+func (s *Store) writeTemp(tree *Tree) (string, error) {
 	if tree == nil {
-		return fmt.Errorf("cannot save nil tree")
+		return "", fmt.Errorf("cannot save nil tree")
 	}
 
 	if err := os.MkdirAll(s.dataDir, 0755); err != nil {
-		return fmt.Errorf("create data dir: %w", err)
+		return "", fmt.Errorf("create data dir: %w", err)
 	}
 
 	// Marshal with indentation for human readability
 	data, err := json.MarshalIndent(tree, "", "  ")
 	if err != nil {
-		return fmt.Errorf("marshal tree: %w", err)
+		return "", fmt.Errorf("marshal tree: %w", err)
 	}
 
-	// Write atomically using temp file + rename
-	targetPath := filepath.Join(s.dataDir, TreeFileName)
-	tempPath := targetPath + ".tmp"
-
+	tempPath := s.Path() + ".tmp"
 	if err := os.WriteFile(tempPath, data, 0644); err != nil {
-		return fmt.Errorf("write temp file: %w", err)
-	}
-
-	if err := os.Rename(tempPath, targetPath); err != nil {
-		os.Remove(tempPath) // Clean up on failure
-		return fmt.Errorf("rename temp file: %w", err)
+		return "", fmt.Errorf("write temp file: %w", err)
 	}
-
-	return nil
+	return tempPath, nil
 }
 
 // Load reads a tree from disk.
@@ -103,18 +142,25 @@ func (s *Store) Path() string {
 
 // Metadata contains information about a stored tree without loading it fully.
 type Metadata struct {
-	Path      string    // Path to the tree file
-	Size      int64     // File size in bytes
-	ModTime   time.Time // Last modification time
-	FileCount int       // Number of files in the tree
-	RootHash  string    // Root hash of the tree
+	Path      string    `json:"path"`             // Path to the tree file
+	Size      int64     `json:"size"`             // File size in bytes
+	ModTime   time.Time `json:"mod_time"`         // Last modification time
+	BuildTime time.Time `json:"build_time"`       // When the tree was built
+	FileCount int       `json:"file_count"`       // Number of files in the tree
+	RootHash  string    `json:"root_hash"`        // Root hash of the tree
+	HashAlgo  string    `json:"hash_algo"`        // Hash algorithm of the tree, see Tree.HashAlgo
+	Backup    int       `json:"backup,omitempty"` // Backup number, 1 the newest; 0 for the current tree
 }
 
 // GetMetadata returns metadata about the stored tree without fully loading it.
 // This is useful for quick checks without the overhead of parsing the entire tree.
 func (s *Store) GetMetadata() (*Metadata, error) {
-	path := filepath.Join(s.dataDir, TreeFileName)
+	return readMetadata(s.Path(), s.Load)
+}
 
+// readMetadata returns metadata about the tree file at path, loaded with
+// load, or nil, nil if there is no such file.
+func readMetadata(path string, load func() (*Tree, error)) (*Metadata, error) {
 	info, err := os.Stat(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -124,49 +170,127 @@ func (s *Store) GetMetadata() (*Metadata, error) {
 	}
 
 	// We need to load and parse to get file count and root hash
-	tree, err := s.Load()
+	tree, err := load()
 	if err != nil {
 		return nil, err
 	}
+	if tree == nil {
+		return nil, nil // Removed since the stat
+	}
 
 	return &Metadata{
 		Path:      path,
 		Size:      info.Size(),
 		ModTime:   info.ModTime(),
+		BuildTime: tree.BuildTime,
 		FileCount: tree.FileCount,
 		RootHash:  tree.RootHash(),
+		HashAlgo:  algoName(tree.HashAlgo),
 	}, nil
 }
 
-// SaveWithBackup saves the tree and keeps a backup of the previous version.
+// SaveWithBackup saves the tree and keeps the previous versions as
+// backups, up to the store's backup depth (see SetBackupDepth). The new
+// tree is written before any backup moves, and each rotation step is a
+// single rename or link that leaves the current tree in place, so a crash
+// part way through loses at most the oldest backup.
 func (s *Store) SaveWithBackup(tree *Tree) error {
-	currentPath := filepath.Join(s.dataDir, TreeFileName)
-	backupPath := filepath.Join(s.dataDir, TreeFileName+".backup")
+	tempPath, err := s.writeTemp(tree)
+	if err != nil {
+		return err
+	}
 
-	// If current file exists, rename it to backup
-	if _, err := os.Stat(currentPath); err == nil {
-		if err := os.Rename(currentPath, backupPath); err != nil {
-			return fmt.Errorf("backup existing tree: %w", err)
+	if err := s.rotateBackups(); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("backup existing tree: %w", err)
+	}
+
+	if err := rename(tempPath, s.Path()); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("rename temp file: %w", err)
+	}
+
+	return nil
+}
+
+// rotateBackups moves each backup one place older, dropping any beyond the
+// backup depth, and links the current tree in as the newest backup.
+func (s *Store) rotateBackups() error {
+	currentPath := s.Path()
+	if _, err := os.Stat(currentPath); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// Left over from a larger depth
+	for n := s.backupDepth + 1; ; n++ {
+		if err := os.Remove(s.backupPath(n)); err != nil {
+			if os.IsNotExist(err) {
+				break
+			}
+			return err
 		}
 	}
 
-	// Save new tree
-	if err := s.Save(tree); err != nil {
-		// Try to restore backup on failure
-		if _, backupErr := os.Stat(backupPath); backupErr == nil {
-			os.Rename(backupPath, currentPath)
+	for n := s.backupDepth - 1; n >= 1; n-- {
+		if err := rename(s.backupPath(n), s.backupPath(n+1)); err != nil && !os.IsNotExist(err) {
+			return err
 		}
-		return err
 	}
 
+	newest := s.backupPath(1)
+	tempPath := newest + ".tmp"
+	os.Remove(tempPath)
+	if err := linkOrCopy(currentPath, tempPath); err != nil {
+		return err
+	}
+	if err := rename(tempPath, newest); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
 	return nil
 }
 
-// LoadBackup loads the backup tree if it exists.
-func (s *Store) LoadBackup() (*Tree, error) {
+// linkOrCopy hard-links src to dst, copying it where links are not
+// supported.
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
+
+// backupPath returns the path of the nth newest backup, counting from 1.
+func (s *Store) backupPath(n int) string {
 	path := filepath.Join(s.dataDir, TreeFileName+".backup")
+	if n > 1 {
+		path += "." + strconv.Itoa(n)
+	}
+	return path
+}
 
-	data, err := os.ReadFile(path)
+// LoadBackup loads the newest backup tree if one exists. A rotation
+// interrupted by a crash can leave a gap, so it skips missing backups up
+// to the backup depth.
+func (s *Store) LoadBackup() (*Tree, error) {
+	for n := 1; n <= s.backupDepth; n++ {
+		tree, err := s.LoadBackupAt(n)
+		if tree != nil || err != nil {
+			return tree, err
+		}
+	}
+	return nil, nil
+}
+
+// LoadBackupAt loads the nth newest backup tree, counting from 1.
+// Returns nil, nil if there is no such backup.
+func (s *Store) LoadBackupAt(n int) (*Tree, error) {
+	data, err := os.ReadFile(s.backupPath(n))
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, nil
@@ -181,3 +305,63 @@ func (s *Store) LoadBackup() (*Tree, error) {
 
 	return &tree, nil
 }
+
+// BackupMetadata returns metadata about each backup tree, newest first,
+// with Backup set to the number LoadBackupAt and RestoreFromBackupAt take.
+// Backups missing after an interrupted rotation are left out.
+func (s *Store) BackupMetadata() ([]Metadata, error) {
+	var backups []Metadata
+	for n := 1; n <= s.backupDepth; n++ {
+		md, err := readMetadata(s.backupPath(n), func() (*Tree, error) { return s.LoadBackupAt(n) })
+		if err != nil {
+			return nil, fmt.Errorf("backup %d: %w", n, err)
+		}
+		if md != nil {
+			md.Backup = n
+			backups = append(backups, *md)
+		}
+	}
+	return backups, nil
+}
+
+// RestoreFromBackup replaces the current tree with the newest backup, to
+// recover from a corrupt tree or one recorded by a bad index run, and
+// returns the restored tree's metadata. See RestoreFromBackupAt.
+func (s *Store) RestoreFromBackup() (*Metadata, error) {
+	for n := 1; n <= s.backupDepth; n++ {
+		if _, err := os.Stat(s.backupPath(n)); err == nil {
+			return s.RestoreFromBackupAt(n)
+		}
+	}
+	return nil, ErrNoBackup
+}
+
+// RestoreFromBackupAt replaces the current tree with the nth newest
+// backup, counting from 1, and returns the restored tree's metadata. The
+// backup must load, so a corrupt one never replaces the current tree. The
+// backup is kept and the current tree discarded, not backed up, so
+// restoring again is harmless. Returns ErrNoBackup if there is no such
+// backup.
+func (s *Store) RestoreFromBackupAt(n int) (*Metadata, error) {
+	tree, err := s.LoadBackupAt(n)
+	if err != nil {
+		return nil, err
+	}
+	if tree == nil {
+		return nil, ErrNoBackup
+	}
+
+	// The backup is replaced by a rename on the next rotation, never
+	// rewritten in place, so the current tree can share its file
+	tempPath := s.Path() + ".tmp"
+	os.Remove(tempPath)
+	if err := linkOrCopy(s.backupPath(n), tempPath); err != nil {
+		return nil, fmt.Errorf("copy backup: %w", err)
+	}
+	if err := rename(tempPath, s.Path()); err != nil {
+		os.Remove(tempPath)
+		return nil, fmt.Errorf("rename temp file: %w", err)
+	}
+
+	return s.GetMetadata()
+}
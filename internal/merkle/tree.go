@@ -1,6 +1,12 @@
 package merkle
 
-import "time"
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
 
 // Tree represents the complete Merkle tree for a repository.
 // It provides a cryptographic snapshot of the entire codebase
@@ -10,6 +16,72 @@ type Tree struct {
 	RepoPath  string    `json:"repo_path"`  // Absolute path to the repository
 	BuildTime time.Time `json:"build_time"` // When the tree was built
 	FileCount int       `json:"file_count"` // Total number of files indexed
+	HashAlgo  string    `json:"hash_algo"`  // Hasher name; empty in trees stored before it was recorded, which are SHA256
+}
+
+// NewTree builds a tree from file nodes whose hash, size and modification
+// time are already set, for content that was not walked by a Builder.
+// Paths are relative to repoPath; the directories above them are created
+// and hashed the same way Build does. Later nodes with a duplicate path
+// are dropped. The files must have been hashed with hasher; nil means
+// SHA256.
+func NewTree(repoPath string, hasher Hasher, files []*Node) *Tree {
+	if hasher == nil {
+		hasher = SHA256
+	}
+
+	root := &Node{IsDir: true}
+	dirs := map[string]*Node{"": root}
+
+	var dir func(path string) *Node
+	dir = func(path string) *Node {
+		if path == "." {
+			path = ""
+		}
+		if n := dirs[path]; n != nil {
+			return n
+		}
+		n := &Node{Path: path, IsDir: true}
+		parent := dir(filepath.Dir(path))
+		parent.Children = append(parent.Children, n)
+		dirs[path] = n
+		return n
+	}
+
+	seen := make(map[string]bool, len(files))
+	fileCount := 0
+	for _, f := range files {
+		f.Path = filepath.Clean(f.Path)
+		if seen[f.Path] {
+			continue
+		}
+		seen[f.Path] = true
+		parent := dir(filepath.Dir(f.Path))
+		parent.Children = append(parent.Children, f)
+		fileCount++
+	}
+
+	var finish func(n *Node)
+	finish = func(n *Node) {
+		sort.Slice(n.Children, func(i, j int) bool {
+			return n.Children[i].Path < n.Children[j].Path
+		})
+		for _, child := range n.Children {
+			if child.IsDir {
+				finish(child)
+			}
+		}
+		n.ComputeHashWith(hasher, nil)
+	}
+	finish(root)
+
+	return &Tree{
+		Root:      root,
+		RepoPath:  repoPath,
+		BuildTime: time.Now(),
+		FileCount: fileCount,
+		HashAlgo:  hasher.Name(),
+	}
 }
 
 // RootHash returns the root hash of the tree.
@@ -52,5 +124,128 @@ func (t *Tree) Clone() *Tree {
 		RepoPath:  t.RepoPath,
 		BuildTime: t.BuildTime,
 		FileCount: t.FileCount,
+		HashAlgo:  t.HashAlgo,
+	}
+}
+
+// Hasher returns the hasher the tree was built with. A tree stored by a
+// build that knew other algorithms gets SHA256, which keeps its own
+// directory hashes consistent; Diff still refuses to compare it.
+func (t *Tree) Hasher() Hasher {
+	if h := HasherFor(t.HashAlgo); h != nil {
+		return h
+	}
+	return SHA256
+}
+
+// SameHashAlgo reports whether t and other were built with the same hash
+// algorithm, so that their hashes can be compared.
+func (t *Tree) SameHashAlgo(other *Tree) bool {
+	return algoName(t.HashAlgo) == algoName(other.HashAlgo)
+}
+
+// algoName maps the empty HashAlgo of older trees to HashSHA256.
+func algoName(algo string) string {
+	if algo == "" {
+		return HashSHA256
+	}
+	return algo
+}
+
+// Find returns the file node at a repo-relative path, or nil if the tree
+// has no such file.
+func (t *Tree) Find(path string) *Node {
+	chain := t.chain(path)
+	if chain == nil {
+		return nil
+	}
+	return chain[len(chain)-1]
+}
+
+// UpdateFile records content and info as the current state of the file at
+// path, for when a file was read after the tree was built and changed in
+// between. Directory hashes above it are recomputed. It reports whether the
+// file is in the tree.
+func (t *Tree) UpdateFile(path string, content []byte, info os.FileInfo) bool {
+	return t.setFile(path, content, info.Size(), info.ModTime())
+}
+
+// SetFile is like UpdateFile for content that did not come from a file on
+// disk: the size recorded is the content's length.
+func (t *Tree) SetFile(path string, content []byte, modTime time.Time) bool {
+	return t.setFile(path, content, int64(len(content)), modTime)
+}
+
+func (t *Tree) setFile(path string, content []byte, size int64, modTime time.Time) bool {
+	chain := t.chain(path)
+	if chain == nil {
+		return false
+	}
+	n := chain[len(chain)-1]
+	n.ComputeHashWith(t.Hasher(), content)
+	n.Size = size
+	n.ModTime = modTime
+	t.rehash(chain)
+	return true
+}
+
+// InvalidHash marks a file node whose recorded state is unknown. It never
+// equals a content hash, and unlike an empty hash it still changes the
+// hashes of the directories above it.
+const InvalidHash = "invalid"
+
+// Invalidate clears the hash and stat data of the file at path, so that the
+// next Diff against a fresh tree reports it as modified and Unchanged
+// returns false. It is used for files that could not be indexed as they
+// were when the tree was built. It reports whether the file is in the tree.
+func (t *Tree) Invalidate(path string) bool {
+	chain := t.chain(path)
+	if chain == nil {
+		return false
+	}
+	n := chain[len(chain)-1]
+	n.Hash = InvalidHash
+	n.Size = -1
+	n.ModTime = time.Time{}
+	t.rehash(chain)
+	return true
+}
+
+// chain returns the nodes from the root down to the file at path, or nil if
+// the tree has no such file.
+func (t *Tree) chain(path string) []*Node {
+	if t == nil || t.Root == nil {
+		return nil
+	}
+	path = filepath.Clean(path)
+
+	chain := []*Node{t.Root}
+	for n := t.Root; ; {
+		var next *Node
+		for _, child := range n.Children {
+			if child.Path == path || (child.IsDir && strings.HasPrefix(path, child.Path+string(filepath.Separator))) {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		chain = append(chain, next)
+		if next.Path == path {
+			if next.IsDir {
+				return nil
+			}
+			return chain
+		}
+		n = next
+	}
+}
+
+// rehash recomputes the directory hashes in chain, deepest first.
+func (t *Tree) rehash(chain []*Node) {
+	h := t.Hasher()
+	for i := len(chain) - 2; i >= 0; i-- {
+		chain[i].ComputeHashWith(h, nil)
 	}
 }
@@ -0,0 +1,63 @@
+// Package profiling writes pprof CPU and heap profiles of a command run,
+// for investigating indexing performance on a particular repository. Read
+// them with "go tool pprof <binary> <dir>/cpu.pprof".
+package profiling
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+)
+
+const (
+	// CPUProfile is the name of the CPU profile written to the directory.
+	CPUProfile = "cpu.pprof"
+
+	// HeapProfile is the name of the heap profile written to the directory.
+	HeapProfile = "heap.pprof"
+)
+
+// Start creates dir if needed and starts CPU profiling into dir/cpu.pprof.
+// The returned stop function ends CPU profiling and writes a heap profile
+// of live objects, after a garbage collection, to dir/heap.pprof. Call it
+// once, when the work to profile is done.
+func Start(dir string) (stop func() error, err error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating profile directory: %w", err)
+	}
+
+	cpuFile, err := os.Create(filepath.Join(dir, CPUProfile))
+	if err != nil {
+		return nil, fmt.Errorf("creating CPU profile: %w", err)
+	}
+	if err := pprof.StartCPUProfile(cpuFile); err != nil {
+		cpuFile.Close()
+		return nil, fmt.Errorf("starting CPU profile: %w", err)
+	}
+
+	return func() error {
+		pprof.StopCPUProfile()
+		cpuErr := cpuFile.Close()
+		if cpuErr != nil {
+			cpuErr = fmt.Errorf("writing CPU profile: %w", cpuErr)
+		}
+		return errors.Join(cpuErr, writeHeapProfile(filepath.Join(dir, HeapProfile)))
+	}, nil
+}
+
+// writeHeapProfile writes a heap profile to path.
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating heap profile: %w", err)
+	}
+	runtime.GC() // Up-to-date statistics on live objects
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return fmt.Errorf("writing heap profile: %w", err)
+	}
+	return f.Close()
+}
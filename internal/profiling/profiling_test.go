@@ -0,0 +1,48 @@
+package profiling
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStart(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "profiles")
+
+	stop, err := Start(dir)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	// Some work to sample
+	var b strings.Builder
+	for i := 0; i < 100000; i++ {
+		b.WriteString("x")
+	}
+
+	if err := stop(); err != nil {
+		t.Fatalf("stop() error = %v", err)
+	}
+
+	for _, name := range []string{CPUProfile, HeapProfile} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("%s not written: %v", name, err)
+			continue
+		}
+		if info.Size() == 0 {
+			t.Errorf("%s is empty", name)
+		}
+	}
+}
+
+func TestStartInvalidDir(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Start(file); err == nil {
+		t.Error("Start() with a file as directory succeeded")
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"slices"
 	"sync"
 	"time"
+
+	"codetect/internal/config"
 )
 
 const (
@@ -133,9 +135,9 @@ func (r *Registry) Add(projectPath string) error {
 	defer r.mu.Unlock()
 
 	// Normalize path
-	absPath, err := filepath.Abs(projectPath)
+	absPath, err := config.NormalizeRepoRoot(projectPath)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path: %w", err)
+		return fmt.Errorf("failed to normalize path: %w", err)
 	}
 
 	// Check if already registered
@@ -167,9 +169,9 @@ func (r *Registry) Remove(projectPath string) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	absPath, err := filepath.Abs(projectPath)
+	absPath, err := config.NormalizeRepoRoot(projectPath)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path: %w", err)
+		return fmt.Errorf("failed to normalize path: %w", err)
 	}
 
 	// Find and remove project
@@ -199,9 +201,9 @@ func (r *Registry) Get(projectPath string) (*Project, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	absPath, err := filepath.Abs(projectPath)
+	absPath, err := config.NormalizeRepoRoot(projectPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+		return nil, fmt.Errorf("failed to normalize path: %w", err)
 	}
 
 	for _, p := range r.data.Projects {
@@ -220,9 +222,9 @@ func (r *Registry) UpdateStats(projectPath string, stats IndexStats) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	absPath, err := filepath.Abs(projectPath)
+	absPath, err := config.NormalizeRepoRoot(projectPath)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path: %w", err)
+		return fmt.Errorf("failed to normalize path: %w", err)
 	}
 
 	for i, p := range r.data.Projects {
@@ -240,9 +242,9 @@ func (r *Registry) SetLastIndexed(projectPath string) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	absPath, err := filepath.Abs(projectPath)
+	absPath, err := config.NormalizeRepoRoot(projectPath)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path: %w", err)
+		return fmt.Errorf("failed to normalize path: %w", err)
 	}
 
 	now := time.Now()
@@ -261,9 +263,9 @@ func (r *Registry) SetWatchEnabled(projectPath string, enabled bool) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	absPath, err := filepath.Abs(projectPath)
+	absPath, err := config.NormalizeRepoRoot(projectPath)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path: %w", err)
+		return fmt.Errorf("failed to normalize path: %w", err)
 	}
 
 	for i, p := range r.data.Projects {
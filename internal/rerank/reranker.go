@@ -10,7 +10,10 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"path"
+	"path/filepath"
 	"sort"
+	"strings"
 	"time"
 
 	"codetect/internal/config"
@@ -69,6 +72,10 @@ type RerankResult struct {
 	// RerankCount is the number of candidates that were reranked
 	RerankCount int
 
+	// Skipped is set when the top candidate led the others by the
+	// configured adaptive margin, so the cross-encoder was not called
+	Skipped bool
+
 	// Duration is the time taken for reranking
 	Duration time.Duration
 }
@@ -79,6 +86,10 @@ type RerankResult struct {
 // The contents map provides the document content for each result ID.
 // If a result's content is not found, it is excluded from reranking
 // but retained in its original position.
+//
+// Candidates whose path a PathWeights rule excludes are dropped before
+// anything else; the scores of the other matching candidates are scaled
+// by their weight before sorting and threshold filtering.
 func (r *Reranker) Rerank(ctx context.Context, query string, candidates []fusion.RRFResult, contents map[string]string) (*RerankResult, error) {
 	start := time.Now()
 	result := &RerankResult{
@@ -91,6 +102,18 @@ func (r *Reranker) Rerank(ctx context.Context, query string, candidates []fusion
 		return result, nil
 	}
 
+	if len(r.config.PathWeights) > 0 {
+		candidates = r.dropExcluded(candidates)
+		result.Results = candidates
+	}
+
+	// Keep the retrieval order when it already has a clear winner
+	if r.config.AdaptiveMargin > 0 && clearWinner(candidates, r.config.AdaptiveMargin) {
+		result.Skipped = true
+		result.Duration = time.Since(start)
+		return result, nil
+	}
+
 	// Take top K for reranking (to limit latency)
 	toRerank := candidates
 	remaining := []fusion.RRFResult{}
@@ -122,25 +145,21 @@ func (r *Reranker) Rerank(ctx context.Context, query string, candidates []fusion
 	}
 
 	// Get reranker scores
-	scores, err := r.provider.Rerank(ctx, query, docs)
+	scores, err := r.score(ctx, query, docs)
 	if err != nil {
-		// Fall back to RRF scores on error
+		// Fall back to RRF scores on error or score count mismatch
 		result.Duration = time.Since(start)
 		return result, nil // Return original order, no error
 	}
 
-	// Validate scores length
-	if len(scores) != len(docsToRerank) {
-		// Score count mismatch, return original order
-		result.Duration = time.Since(start)
-		return result, nil
-	}
-
 	// Update scores and resort
 	reranked := make([]fusion.RRFResult, len(docsToRerank))
 	for i, c := range docsToRerank {
 		reranked[i] = c
 		reranked[i].RRFScore = scores[i] // Replace with reranker score
+		if w, ok := r.pathWeight(c.Path); ok {
+			reranked[i].RRFScore = applyPathWeight(scores[i], w)
+		}
 	}
 
 	sort.Slice(reranked, func(i, j int) bool {
@@ -168,6 +187,150 @@ func (r *Reranker) Rerank(ctx context.Context, query string, candidates []fusion
 	return result, nil
 }
 
+// dropExcluded returns the candidates whose path no PathWeights rule
+// weights at 0.
+func (r *Reranker) dropExcluded(candidates []fusion.RRFResult) []fusion.RRFResult {
+	kept := make([]fusion.RRFResult, 0, len(candidates))
+	for _, c := range candidates {
+		if w, ok := r.pathWeight(c.Path); ok && w == 0 {
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept
+}
+
+// pathWeight returns the lowest weight among the PathWeights rules
+// matching the repo-relative path p, and whether any rule matched.
+func (r *Reranker) pathWeight(p string) (float64, bool) {
+	weight, matched := 0.0, false
+	for pattern, w := range r.config.PathWeights {
+		if !matchesPathRule(pattern, p) {
+			continue
+		}
+		if !matched || w < weight {
+			weight, matched = w, true
+		}
+	}
+	return weight, matched
+}
+
+// matchesPathRule reports whether the repo-relative path p matches
+// pattern: "dir/**" matches everything under dir, a pattern without a
+// slash matches the file name, and any other pattern matches the whole
+// path.
+func matchesPathRule(pattern, p string) bool {
+	slashPath := filepath.ToSlash(p)
+	if dir, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return strings.HasPrefix(slashPath, dir+"/")
+	}
+	target := slashPath
+	if !strings.Contains(pattern, "/") {
+		target = path.Base(slashPath)
+	}
+	ok, _ := path.Match(pattern, target)
+	return ok
+}
+
+// applyPathWeight scales score by weight so that a weight below 1 always
+// lowers it, including cross-encoder scores below zero.
+func applyPathWeight(score, weight float64) float64 {
+	if score < 0 {
+		return score / weight
+	}
+	return score * weight
+}
+
+// clearWinner reports whether the best-scoring candidate's score exceeds
+// the second best's by at least margin times its own. A single candidate
+// is a clear winner.
+func clearWinner(candidates []fusion.RRFResult, margin float64) bool {
+	if len(candidates) < 2 {
+		return true
+	}
+	top, second := candidates[0].RRFScore, candidates[1].RRFScore
+	if second > top {
+		top, second = second, top
+	}
+	for _, c := range candidates[2:] {
+		switch {
+		case c.RRFScore > top:
+			top, second = c.RRFScore, top
+		case c.RRFScore > second:
+			second = c.RRFScore
+		}
+	}
+	return top > 0 && top-second >= margin*top
+}
+
+// Candidate is an externally retrieved document to rerank.
+type Candidate struct {
+	ID      string
+	Content string
+}
+
+// ScoredCandidate is a candidate with its reranker score.
+type ScoredCandidate struct {
+	ID      string  `json:"id"`
+	Content string  `json:"content"`
+	Score   float64 `json:"score"`
+}
+
+// RerankContents scores candidates from any retriever against query and
+// returns them sorted by descending score, ties keeping input order.
+// Candidates scoring below the configured threshold are dropped, as are
+// candidates with empty content.
+//
+// Unlike Rerank, it scores every candidate regardless of Enabled and TopK,
+// and returns provider errors instead of falling back, leaving the caller
+// to decide how to degrade.
+func (r *Reranker) RerankContents(ctx context.Context, query string, candidates []Candidate) ([]ScoredCandidate, error) {
+	scored := make([]ScoredCandidate, 0, len(candidates))
+	docs := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		if c.Content == "" {
+			continue
+		}
+		scored = append(scored, ScoredCandidate{ID: c.ID, Content: c.Content})
+		docs = append(docs, c.Content)
+	}
+
+	if len(docs) == 0 {
+		return nil, nil
+	}
+
+	scores, err := r.score(ctx, query, docs)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := scored[:0]
+	for i := range scored {
+		scored[i].Score = scores[i]
+		if scored[i].Score >= r.config.Threshold {
+			filtered = append(filtered, scored[i])
+		}
+	}
+
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return filtered[i].Score > filtered[j].Score
+	})
+
+	return filtered, nil
+}
+
+// score runs the provider and checks it returned one score per document.
+func (r *Reranker) score(ctx context.Context, query string, docs []string) ([]float64, error) {
+	scores, err := r.provider.Rerank(ctx, query, docs)
+	if err != nil {
+		return nil, fmt.Errorf("reranking: %w", err)
+	}
+	if len(scores) != len(docs) {
+		return nil, fmt.Errorf("reranker returned %d scores for %d documents", len(scores), len(docs))
+	}
+	return scores, nil
+}
+
 // Enabled returns true if reranking is enabled.
 func (r *Reranker) Enabled() bool {
 	return r.config.Enabled
@@ -238,6 +238,121 @@ func TestRerankerMissingContent(t *testing.T) {
 	}
 }
 
+func TestRerankerPathWeights(t *testing.T) {
+	cfg := config.DefaultRerankerConfig()
+	cfg.Enabled = true
+	cfg.TopK = 10
+	cfg.Threshold = 0.5
+	cfg.PathWeights = map[string]float64{
+		"examples/**":   0.5,
+		"*.pb.go":       0,
+		"internal/*.go": 0.9,
+	}
+
+	// Scores are only sent for documents that reach the provider; the
+	// excluded api.pb.go never does.
+	provider := &FixedScoreReranker{Scores: []float64{0.9, 0.8, 0.7, 0.6}}
+	reranker := NewRerankerWithProvider(provider, cfg)
+
+	candidates := []fusion.RRFResult{
+		{Result: fusion.Result{ID: "example", Path: "examples/server/main.go"}, RRFScore: 0.9},
+		{Result: fusion.Result{ID: "generated", Path: "api/api.pb.go"}, RRFScore: 0.8},
+		{Result: fusion.Result{ID: "impl", Path: "server/server.go"}, RRFScore: 0.7},
+		{Result: fusion.Result{ID: "internal", Path: "internal/handler.go"}, RRFScore: 0.6},
+		{Result: fusion.Result{ID: "other", Path: "server/routes.go"}, RRFScore: 0.5},
+	}
+	contents := map[string]string{
+		"example":   "example",
+		"generated": "generated",
+		"impl":      "impl",
+		"internal":  "internal",
+		"other":     "other",
+	}
+
+	result, err := reranker.Rerank(context.Background(), "query", candidates, contents)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// example: 0.9*0.5 = 0.45, below the threshold; impl: 0.8;
+	// internal: 0.7*0.9 = 0.63; other: 0.6.
+	wantIDs := []string{"impl", "internal", "other"}
+	if len(result.Results) != len(wantIDs) {
+		t.Fatalf("expected %d results, got %d: %+v", len(wantIDs), len(result.Results), result.Results)
+	}
+	for i, id := range wantIDs {
+		if result.Results[i].ID != id {
+			t.Errorf("result %d: expected %q, got %q", i, id, result.Results[i].ID)
+		}
+	}
+	if result.RerankCount != 4 {
+		t.Errorf("expected 4 reranked (excluded path not scored), got %d", result.RerankCount)
+	}
+	if abs(result.Results[1].RRFScore-0.63) > 1e-9 {
+		t.Errorf("expected internal/handler.go scored 0.63, got %f", result.Results[1].RRFScore)
+	}
+}
+
+func TestRerankerPathWeightsDemote(t *testing.T) {
+	cfg := config.DefaultRerankerConfig()
+	cfg.Enabled = true
+	cfg.TopK = 10
+	cfg.Threshold = -10
+	cfg.PathWeights = map[string]float64{"examples/**": 0.5, "*_example.go": 0.25}
+
+	// The example outscores the implementation until demoted, including
+	// below zero.
+	provider := &FixedScoreReranker{Scores: []float64{0.9, 0.6, -1, -1.5, 0.1}}
+	reranker := NewRerankerWithProvider(provider, cfg)
+
+	candidates := []fusion.RRFResult{
+		{Result: fusion.Result{ID: "example", Path: "examples/basic/main.go"}, RRFScore: 0.5},
+		{Result: fusion.Result{ID: "impl", Path: "pkg/client.go"}, RRFScore: 0.4},
+		{Result: fusion.Result{ID: "negative-example", Path: "examples/x.go"}, RRFScore: 0.3},
+		{Result: fusion.Result{ID: "negative-impl", Path: "pkg/x.go"}, RRFScore: 0.2},
+		{Result: fusion.Result{ID: "both", Path: "examples/client_example.go"}, RRFScore: 0.1},
+	}
+	contents := map[string]string{}
+	for _, c := range candidates {
+		contents[c.ID] = c.ID
+	}
+
+	result, err := reranker.Rerank(context.Background(), "query", candidates, contents)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// example: 0.45; both: 0.1*0.25 (lowest matching weight) = 0.025;
+	// negative-example: -1/0.5 = -2.
+	wantIDs := []string{"impl", "example", "both", "negative-impl", "negative-example"}
+	for i, id := range wantIDs {
+		if result.Results[i].ID != id {
+			t.Errorf("result %d: expected %q, got %q", i, id, result.Results[i].ID)
+		}
+	}
+}
+
+func TestMatchesPathRule(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"examples/**", "examples/a/b.go", true},
+		{"examples/**", "src/examples/b.go", false},
+		{"*.pb.go", "api/v1/api.pb.go", true},
+		{"*.pb.go", "api/v1/api.go", false},
+		{"internal/*.go", "internal/a.go", true},
+		{"internal/*.go", "internal/sub/a.go", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchesPathRule(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchesPathRule(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
 func TestRerankerEmptyCandidates(t *testing.T) {
 	cfg := config.DefaultRerankerConfig()
 	cfg.Enabled = true
@@ -254,6 +369,158 @@ func TestRerankerEmptyCandidates(t *testing.T) {
 	}
 }
 
+// countingReranker scores documents by FixedScoreReranker and counts its
+// calls.
+type countingReranker struct {
+	FixedScoreReranker
+	calls int
+}
+
+func (c *countingReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	c.calls++
+	return c.FixedScoreReranker.Rerank(ctx, query, documents)
+}
+
+func TestRerankerAdaptive(t *testing.T) {
+	cfg := config.DefaultRerankerConfig()
+	cfg.Enabled = true
+	cfg.AdaptiveMargin = 0.2
+	contents := map[string]string{"a": "content for a", "b": "content for b", "c": "content for c"}
+
+	tests := []struct {
+		name       string
+		candidates []fusion.RRFResult
+		wantCalls  int
+		wantFirst  string
+	}{
+		{
+			name: "clear top result",
+			candidates: []fusion.RRFResult{
+				{Result: fusion.Result{ID: "a"}, RRFScore: 0.05},
+				{Result: fusion.Result{ID: "b"}, RRFScore: 0.03},
+				{Result: fusion.Result{ID: "c"}, RRFScore: 0.02},
+			},
+			wantCalls: 0,
+			wantFirst: "a",
+		},
+		{
+			name: "tight cluster",
+			candidates: []fusion.RRFResult{
+				{Result: fusion.Result{ID: "a"}, RRFScore: 0.050},
+				{Result: fusion.Result{ID: "b"}, RRFScore: 0.048},
+				{Result: fusion.Result{ID: "c"}, RRFScore: 0.020},
+			},
+			wantCalls: 1,
+			wantFirst: "b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &countingReranker{FixedScoreReranker: FixedScoreReranker{Scores: []float64{0.2, 0.9, 0.1}}}
+			result, err := NewRerankerWithProvider(provider, cfg).Rerank(context.Background(), "query", tt.candidates, contents)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if provider.calls != tt.wantCalls {
+				t.Errorf("provider called %d times, want %d", provider.calls, tt.wantCalls)
+			}
+			if result.Skipped != (tt.wantCalls == 0) {
+				t.Errorf("Skipped = %v with %d provider calls", result.Skipped, provider.calls)
+			}
+			if result.Results[0].ID != tt.wantFirst {
+				t.Errorf("expected %q first, got %q", tt.wantFirst, result.Results[0].ID)
+			}
+		})
+	}
+
+	// Without a margin every query is reranked
+	cfg.AdaptiveMargin = 0
+	provider := &countingReranker{FixedScoreReranker: FixedScoreReranker{Scores: []float64{0.2, 0.9, 0.1}}}
+	if _, err := NewRerankerWithProvider(provider, cfg).Rerank(context.Background(), "query", tests[0].candidates, contents); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if provider.calls != 1 {
+		t.Errorf("provider called %d times without a margin, want 1", provider.calls)
+	}
+}
+
+func TestRerankContents(t *testing.T) {
+	cfg := config.DefaultRerankerConfig()
+	cfg.Enabled = false // Standalone use ignores Enabled
+	cfg.TopK = 1        // ...and TopK
+	cfg.Threshold = 0.0
+
+	provider := &FixedScoreReranker{Scores: []float64{0.2, 0.9, 0.5, 0.5}}
+	reranker := NewRerankerWithProvider(provider, cfg)
+
+	candidates := []Candidate{
+		{ID: "a", Content: "content for a"},
+		{ID: "b", Content: "content for b"},
+		{ID: "c", Content: "content for c"},
+		{ID: "empty", Content: ""},
+		{ID: "d", Content: "content for d"},
+	}
+
+	results, err := reranker.RerankContents(context.Background(), "query", candidates)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Empty content is dropped; the equal scores of c and d keep input order
+	want := []string{"b", "c", "d", "a"}
+	if len(results) != len(want) {
+		t.Fatalf("expected %d results, got %d", len(want), len(results))
+	}
+	for i, id := range want {
+		if results[i].ID != id {
+			t.Errorf("position %d: expected %q, got %q", i, id, results[i].ID)
+		}
+	}
+	if results[0].Score != 0.9 || results[0].Content != "content for b" {
+		t.Errorf("expected b scored 0.9 with its content, got %+v", results[0])
+	}
+}
+
+func TestRerankContentsThreshold(t *testing.T) {
+	cfg := config.DefaultRerankerConfig()
+	cfg.Threshold = 0.5
+
+	provider := &FixedScoreReranker{Scores: []float64{0.3, 0.8, 0.5}}
+	reranker := NewRerankerWithProvider(provider, cfg)
+
+	candidates := []Candidate{
+		{ID: "low", Content: "x"},
+		{ID: "high", Content: "y"},
+		{ID: "edge", Content: "z"},
+	}
+
+	results, err := reranker.RerankContents(context.Background(), "query", candidates)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Scores at the threshold are kept
+	if len(results) != 2 || results[0].ID != "high" || results[1].ID != "edge" {
+		t.Errorf("expected [high edge], got %+v", results)
+	}
+}
+
+func TestRerankContentsError(t *testing.T) {
+	cfg := config.DefaultRerankerConfig()
+	providerErr := errors.New("service unavailable")
+	reranker := NewRerankerWithProvider(&FailingReranker{Err: providerErr}, cfg)
+
+	_, err := reranker.RerankContents(context.Background(), "query", []Candidate{{ID: "a", Content: "x"}})
+	if !errors.Is(err, providerErr) {
+		t.Errorf("expected provider error, got %v", err)
+	}
+
+	results, err := reranker.RerankContents(context.Background(), "query", nil)
+	if err != nil || len(results) != 0 {
+		t.Errorf("expected no results and no error for empty input, got %v, %v", results, err)
+	}
+}
+
 func TestNoOpReranker(t *testing.T) {
 	reranker := &NoOpReranker{}
 
@@ -0,0 +1,129 @@
+package search
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"regexp"
+
+	"codetect/internal/embedding"
+	"codetect/internal/search/keyword"
+)
+
+// keywordSearch is keyword.Search, replaced in tests.
+var keywordSearch = keyword.Search
+
+// Labels of the retriever that produced a result, in
+// embedding.SemanticResult.Source.
+const (
+	SourceSemantic = "semantic"
+	SourceKeyword  = "keyword"
+)
+
+// FallbackOptions configures SemanticWithFallback.
+type FallbackOptions struct {
+	// RepoRoot is the repository searched for keywords
+	RepoRoot string
+
+	// Search configures the semantic search; its Limit and ExcludePath
+	// also apply to keyword results
+	Search embedding.SearchOptions
+
+	// SnippetFn reads the snippets of semantic results
+	SnippetFn func(path string, start, end int) string
+
+	// MinScore is the similarity a semantic result needs to be relevant;
+	// weaker results are dropped
+	MinScore float32
+
+	// KeywordFallback enables the keyword search when no semantic result
+	// is relevant
+	KeywordFallback bool
+}
+
+// SemanticWithFallback runs a semantic search and, when none of its results
+// is relevant, a keyword search for the query as a literal string in their
+// place. Queries such as exact error messages embed poorly but are easy to
+// find verbatim. Each result's Source names the retriever that found it,
+// and the result's Fallback is SourceKeyword when the keyword search ran
+// and found anything.
+//
+// A failed keyword search is logged and leaves the empty semantic result;
+// so is an unavailable semantic searcher, which callers report themselves.
+// Once ctx is done the semantic result, perhaps truncated, is returned as
+// is.
+func SemanticWithFallback(ctx context.Context, semantic *embedding.SemanticSearcher, query string, opts FallbackOptions) (*embedding.SemanticSearchResult, error) {
+	result, err := semantic.SearchWithOptions(ctx, query, opts.Search, opts.SnippetFn)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Available {
+		return result, nil
+	}
+
+	relevant := result.Results[:0]
+	for _, r := range result.Results {
+		if r.Score >= opts.MinScore {
+			r.Source = SourceSemantic
+			relevant = append(relevant, r)
+		}
+	}
+	result.Results = relevant
+	if len(relevant) > 0 || !opts.KeywordFallback || ctx.Err() != nil {
+		return result, nil
+	}
+
+	fallback, err := searchLiteral(query, opts)
+	if err != nil {
+		log.Printf("[search] keyword fallback error: %v", err)
+		return result, nil
+	}
+	if len(fallback) > 0 {
+		result.Results = fallback
+		result.Fallback = SourceKeyword
+	}
+	return result, nil
+}
+
+// searchLiteral returns keyword matches of query as a literal string, as
+// semantic results.
+func searchLiteral(query string, opts FallbackOptions) ([]embedding.SemanticResult, error) {
+	limit := opts.Search.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+	exclude := opts.Search.ExcludePath
+	if exclude != "" {
+		if filepath.IsAbs(exclude) {
+			if rel, err := filepath.Rel(opts.RepoRoot, exclude); err == nil {
+				exclude = rel
+			}
+		}
+		exclude = filepath.Clean(exclude)
+	}
+
+	// Fetch extra matches to fill the limit after excluding a file
+	matches, err := keywordSearch(regexp.QuoteMeta(query), opts.RepoRoot, limit*2)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []embedding.SemanticResult
+	for _, m := range matches.Results {
+		if exclude != "" && filepath.Clean(m.Path) == exclude {
+			continue
+		}
+		results = append(results, embedding.SemanticResult{
+			Path:      m.Path,
+			StartLine: m.LineStart,
+			EndLine:   m.LineEnd,
+			Snippet:   m.Snippet,
+			Score:     float32(m.Score),
+			Source:    SourceKeyword,
+		})
+		if len(results) == limit {
+			break
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,202 @@
+package search
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"codetect/internal/db"
+	"codetect/internal/embedding"
+	"codetect/internal/search/keyword"
+)
+
+// fixedEmbedder embeds every text as the same vector.
+type fixedEmbedder struct {
+	vector []float32
+}
+
+func (e *fixedEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i := range texts {
+		out[i] = e.vector
+	}
+	return out, nil
+}
+
+func (e *fixedEmbedder) Available() bool    { return true }
+func (e *fixedEmbedder) ProviderID() string { return "test:fixed" }
+func (e *fixedEmbedder) Dimensions() int    { return len(e.vector) }
+
+// grepSearch stands in for keyword.Search without ripgrep: it matches
+// query as a regular expression against each line of the files in root.
+func grepSearch(calls *int) func(query, root string, topK int) (*keyword.SearchResult, error) {
+	return func(query, root string, topK int) (*keyword.SearchResult, error) {
+		*calls++
+		re, err := regexp.Compile(query)
+		if err != nil {
+			return nil, err
+		}
+		result := &keyword.SearchResult{}
+		err = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			rel, _ := filepath.Rel(root, path)
+			scanner := bufio.NewScanner(f)
+			for line := 1; scanner.Scan(); line++ {
+				if re.MatchString(scanner.Text()) {
+					result.Results = append(result.Results, keyword.Result{
+						Path: rel, LineStart: line, LineEnd: line, Snippet: scanner.Text(),
+					})
+				}
+			}
+			return scanner.Err()
+		})
+		return result, err
+	}
+}
+
+// newFallbackRepo writes a repository in which two files contain an
+// error message and indexes one chunk whose vector is far from the
+// queries' (similarity about 0.1).
+func newFallbackRepo(t *testing.T) (string, *embedding.SemanticSearcher) {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		"config.go": "package main\n\nfunc load() error {\n\treturn errors.New(\"open config (permission denied)\")\n}\n",
+		"main.go":   "package main\n\n// open config (permission denied) is returned by load\nfunc main() {}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	database, err := db.Open(db.DefaultConfig(":memory:"))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	store, err := embedding.NewEmbeddingStore(database, root)
+	if err != nil {
+		t.Fatalf("creating store: %v", err)
+	}
+	chunk := embedding.Chunk{Path: "config.go", StartLine: 3, EndLine: 5, Content: files["config.go"]}
+	if err := store.Save(chunk, []float32{1, 0, 0}, "test:fixed"); err != nil {
+		t.Fatalf("saving chunk: %v", err)
+	}
+	return root, embedding.NewSemanticSearcher(store, &fixedEmbedder{vector: []float32{0.1, 1, 0}})
+}
+
+func TestSemanticWithFallback(t *testing.T) {
+	calls := 0
+	orig := keywordSearch
+	keywordSearch = grepSearch(&calls)
+	t.Cleanup(func() { keywordSearch = orig })
+
+	root, searcher := newFallbackRepo(t)
+	query := "open config (permission denied)"
+	opts := FallbackOptions{
+		RepoRoot:        root,
+		Search:          embedding.SearchOptions{Limit: 10},
+		MinScore:        0.5,
+		KeywordFallback: true,
+	}
+
+	t.Run("falls back when nothing is relevant", func(t *testing.T) {
+		result, err := SemanticWithFallback(context.Background(), searcher, query, opts)
+		if err != nil {
+			t.Fatalf("SemanticWithFallback failed: %v", err)
+		}
+		if result.Fallback != SourceKeyword {
+			t.Errorf("Fallback = %q, want %q", result.Fallback, SourceKeyword)
+		}
+		if len(result.Results) != 2 {
+			t.Fatalf("got %d results, want the 2 lexical matches: %+v", len(result.Results), result.Results)
+		}
+		for _, r := range result.Results {
+			if r.Source != SourceKeyword {
+				t.Errorf("%s:%d: Source = %q, want %q", r.Path, r.StartLine, r.Source, SourceKeyword)
+			}
+		}
+		if r := result.Results[0]; r.Path != "config.go" || r.StartLine != 4 {
+			t.Errorf("first result at %s:%d, want config.go:4", r.Path, r.StartLine)
+		}
+	})
+
+	t.Run("exclude path applies to keyword results", func(t *testing.T) {
+		opts := opts
+		opts.Search.ExcludePath = filepath.Join(root, "config.go")
+		result, err := SemanticWithFallback(context.Background(), searcher, query, opts)
+		if err != nil {
+			t.Fatalf("SemanticWithFallback failed: %v", err)
+		}
+		if len(result.Results) != 1 || result.Results[0].Path != "main.go" {
+			t.Errorf("results = %+v, want only main.go", result.Results)
+		}
+	})
+
+	t.Run("relevant semantic results are kept", func(t *testing.T) {
+		calls = 0
+		opts := opts
+		opts.MinScore = 0
+		result, err := SemanticWithFallback(context.Background(), searcher, query, opts)
+		if err != nil {
+			t.Fatalf("SemanticWithFallback failed: %v", err)
+		}
+		if result.Fallback != "" || calls != 0 {
+			t.Errorf("Fallback = %q after %d keyword searches, want none", result.Fallback, calls)
+		}
+		if len(result.Results) != 1 || result.Results[0].Source != SourceSemantic {
+			t.Errorf("results = %+v, want the semantic match", result.Results)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		calls = 0
+		opts := opts
+		opts.KeywordFallback = false
+		result, err := SemanticWithFallback(context.Background(), searcher, query, opts)
+		if err != nil {
+			t.Fatalf("SemanticWithFallback failed: %v", err)
+		}
+		if len(result.Results) != 0 || calls != 0 {
+			t.Errorf("got %d results after %d keyword searches, want none", len(result.Results), calls)
+		}
+	})
+
+	t.Run("not once the time is up", func(t *testing.T) {
+		calls = 0
+		ctx, cancel := context.WithCancel(context.Background())
+		opts := opts
+		opts.SnippetFn = func(path string, start, end int) string {
+			cancel() // The time runs out while the only snippet is read
+			return ""
+		}
+		result, err := SemanticWithFallback(ctx, searcher, query, opts)
+		if err != nil {
+			t.Fatalf("SemanticWithFallback failed: %v", err)
+		}
+		if len(result.Results) != 0 || calls != 0 {
+			t.Errorf("got %d results after %d keyword searches, want none", len(result.Results), calls)
+		}
+	})
+
+	t.Run("no lexical match either", func(t *testing.T) {
+		result, err := SemanticWithFallback(context.Background(), searcher, "not in any file", opts)
+		if err != nil {
+			t.Fatalf("SemanticWithFallback failed: %v", err)
+		}
+		if len(result.Results) != 0 || result.Fallback != "" {
+			t.Errorf("results = %+v with fallback %q, want none", result.Results, result.Fallback)
+		}
+	})
+}
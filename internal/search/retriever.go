@@ -7,19 +7,19 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"sync"
+	"path/filepath"
 	"time"
 
 	"codetect/internal/config"
 	"codetect/internal/embedding"
 	"codetect/internal/fusion"
-	"codetect/internal/search/keyword"
 	"codetect/internal/search/symbols"
 )
 
 // Retriever performs multi-signal search and combines results using RRF.
 type Retriever struct {
 	semantic    *embedding.SemanticSearcher
+	cache       *embedding.CacheSearcher // Semantic signal of a v2 index, if set
 	symbolIndex *symbols.Index
 	config      config.RetrieverConfig
 }
@@ -35,6 +35,17 @@ func NewRetriever(semantic *embedding.SemanticSearcher, symbolIndex *symbols.Ind
 	}
 }
 
+// NewCacheRetriever creates a retriever whose semantic signal searches a
+// v2 index through cache. cache may be nil if semantic search is not
+// available.
+func NewCacheRetriever(cache *embedding.CacheSearcher, symbolIndex *symbols.Index, cfg config.RetrieverConfig) *Retriever {
+	return &Retriever{
+		cache:       cache,
+		symbolIndex: symbolIndex,
+		config:      cfg,
+	}
+}
+
 // RetrieveOptions configures a single retrieval operation.
 type RetrieveOptions struct {
 	// RepoRoot is the repository root directory for search
@@ -45,6 +56,29 @@ type RetrieveOptions struct {
 
 	// SnippetFn is an optional function to retrieve code snippets
 	SnippetFn func(path string, start, end int) string
+
+	// NodeTypeFn is an optional function returning the AST node type of
+	// the chunk at path and lines, so semantic matches can be weighted by
+	// RetrieverConfig.NodeTypeWeights
+	NodeTypeFn func(path string, start, end int) string
+
+	// ModTimeFn is an optional function returning when the file at path
+	// was last modified, as of indexing, so semantic matches can be boosted
+	// by RetrieverConfig.FreshnessWeight
+	ModTimeFn func(path string) time.Time
+
+	// Filter, if set, keeps only the matches at path and line it accepts.
+	// It is applied before fusion, so Limit counts accepted results only
+	Filter func(path string, line int) bool
+
+	// ExcludePath drops the matches in this file, typically the one the
+	// caller is editing, relative to RepoRoot or absolute. Like Filter, it
+	// is applied before fusion
+	ExcludePath string
+
+	// Granularity selects the locations a v2 semantic signal matches (see
+	// embedding.CacheSearchOptions); it is ignored by a v1 searcher
+	Granularity string
 }
 
 // RetrieveResult contains the fused results and metadata about the retrieval.
@@ -70,6 +104,12 @@ type RetrieveResult struct {
 	// Errors contains any non-fatal errors encountered during retrieval
 	Errors []error
 
+	// Partial indicates that some signals had not finished when the
+	// timeout expired or the context was cancelled. Results are fused
+	// from the others and from what a cut signal had already resolved,
+	// and Errors holds the context error for each.
+	Partial bool
+
 	// Duration is the total time taken for retrieval
 	Duration time.Duration
 }
@@ -77,6 +117,9 @@ type RetrieveResult struct {
 // Retrieve performs multi-signal retrieval with RRF fusion.
 // It runs keyword, semantic, and symbol searches (optionally in parallel),
 // then combines the results using weighted Reciprocal Rank Fusion.
+// It returns by the configured timeout or ctx's deadline, whichever is
+// sooner, even if a signal does not honor cancellation (see
+// RetrieveResult.Partial).
 func (r *Retriever) Retrieve(ctx context.Context, query string, opts RetrieveOptions) (*RetrieveResult, error) {
 	start := time.Now()
 
@@ -87,59 +130,85 @@ func (r *Retriever) Retrieve(ctx context.Context, query string, opts RetrieveOpt
 		defer cancel()
 	}
 
-	var (
-		keywordResults  []fusion.Result
-		semanticResults []fusion.Result
-		symbolResults   []fusion.Result
-		keywordErr      error
-		semanticErr     error
-		symbolErr       error
-	)
-
 	result := &RetrieveResult{
-		SemanticAvailable: r.semantic != nil && r.semantic.Available(),
+		SemanticAvailable: r.SemanticAvailable(),
 		SymbolAvailable:   r.symbolIndex != nil,
 	}
 
-	if r.config.Parallel {
-		var wg sync.WaitGroup
-		wg.Add(3)
-
-		go func() {
-			defer wg.Done()
-			keywordResults, keywordErr = r.searchKeyword(ctx, query, opts.RepoRoot)
-		}()
-
-		go func() {
-			defer wg.Done()
-			semanticResults, semanticErr = r.searchSemantic(ctx, query, opts)
-		}()
+	signals := [...]struct {
+		name   string
+		search func(context.Context) ([]fusion.Result, error)
+	}{
+		{"keyword", func(ctx context.Context) ([]fusion.Result, error) { return r.searchKeyword(ctx, query, opts.RepoRoot) }},
+		{"semantic", func(ctx context.Context) ([]fusion.Result, error) { return r.searchSemantic(ctx, query, opts) }},
+		{"symbol", func(ctx context.Context) ([]fusion.Result, error) { return r.searchSymbol(ctx, query) }},
+	}
 
+	// Signals report on a buffered channel, so those still running when
+	// ctx is done finish in the background instead of holding up the call
+	type outcome struct {
+		signal  int
+		results []fusion.Result
+		err     error
+	}
+	outcomes := make(chan outcome, len(signals))
+	run := func(i int) {
+		results, err := signals[i].search(ctx)
+		outcomes <- outcome{i, results, err}
+	}
+	if r.config.Parallel {
+		for i := range signals {
+			go run(i)
+		}
+	} else {
+		// Sequential execution (useful for debugging)
 		go func() {
-			defer wg.Done()
-			symbolResults, symbolErr = r.searchSymbol(ctx, query)
+			for i := range signals {
+				run(i)
+			}
 		}()
+	}
 
-		wg.Wait()
-	} else {
-		// Sequential execution (useful for debugging)
-		keywordResults, keywordErr = r.searchKeyword(ctx, query, opts.RepoRoot)
-		semanticResults, semanticErr = r.searchSemantic(ctx, query, opts)
-		symbolResults, symbolErr = r.searchSymbol(ctx, query)
+	var (
+		results [len(signals)][]fusion.Result
+		errs    [len(signals)]error
+		done    [len(signals)]bool
+	)
+wait:
+	for pending := len(signals); pending > 0; pending-- {
+		select {
+		case o := <-outcomes:
+			results[o.signal], errs[o.signal], done[o.signal] = o.results, o.err, true
+			if o.err != nil && ctx.Err() != nil {
+				result.Partial = true // Cut short, with what it found so far
+			}
+		case <-ctx.Done():
+			for i := range signals {
+				if !done[i] {
+					errs[i] = ctx.Err()
+				}
+			}
+			result.Partial = true
+			break wait
+		}
 	}
 
 	// Log errors but continue with available results (graceful degradation)
-	if keywordErr != nil {
-		log.Printf("[retriever] keyword search error: %v", keywordErr)
-		result.Errors = append(result.Errors, fmt.Errorf("keyword: %w", keywordErr))
+	for i, err := range errs {
+		if err != nil {
+			log.Printf("[retriever] %s search error: %v", signals[i].name, err)
+			result.Errors = append(result.Errors, fmt.Errorf("%s: %w", signals[i].name, err))
+		}
 	}
-	if semanticErr != nil {
-		log.Printf("[retriever] semantic search error: %v", semanticErr)
-		result.Errors = append(result.Errors, fmt.Errorf("semantic: %w", semanticErr))
+	keywordResults, semanticResults, symbolResults := results[0], results[1], results[2]
+	keep := opts.Filter
+	if opts.ExcludePath != "" {
+		keep = excludingPath(keep, opts.RepoRoot, opts.ExcludePath)
 	}
-	if symbolErr != nil {
-		log.Printf("[retriever] symbol search error: %v", symbolErr)
-		result.Errors = append(result.Errors, fmt.Errorf("symbol: %w", symbolErr))
+	if keep != nil {
+		keywordResults = filterResults(keywordResults, keep)
+		semanticResults = filterResults(semanticResults, keep)
+		symbolResults = filterResults(symbolResults, keep)
 	}
 
 	// Track counts
@@ -147,6 +216,12 @@ func (r *Retriever) Retrieve(ctx context.Context, query string, opts RetrieveOpt
 	result.SemanticCount = len(semanticResults)
 	result.SymbolCount = len(symbolResults)
 
+	// Down-weight semantic matches of less useful chunk types
+	semanticResults = fusion.WeightByNodeType(semanticResults, r.config.NodeTypeWeights)
+
+	// Break near ties between semantic matches toward recently modified files
+	semanticResults = fusion.BoostByFreshness(semanticResults, r.config.FreshnessWeight)
+
 	// Fuse results with weighted RRF
 	fused := fusion.WeightedRRF(
 		r.config.Weights,
@@ -166,6 +241,34 @@ func (r *Retriever) Retrieve(ctx context.Context, query string, opts RetrieveOpt
 	return result, nil
 }
 
+// filterResults returns the results keep accepts, in order.
+func filterResults(results []fusion.Result, keep func(path string, line int) bool) []fusion.Result {
+	filtered := results[:0:0]
+	for _, r := range results {
+		if keep(r.Path, r.Line) {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered
+}
+
+// excludingPath returns a filter rejecting matches in path, relative to
+// repoRoot or absolute, and otherwise deferring to keep, if set.
+func excludingPath(keep func(path string, line int) bool, repoRoot, path string) func(path string, line int) bool {
+	if filepath.IsAbs(path) {
+		if rel, err := filepath.Rel(repoRoot, path); err == nil {
+			path = rel
+		}
+	}
+	path = filepath.Clean(path)
+	return func(p string, line int) bool {
+		if filepath.Clean(p) == path {
+			return false
+		}
+		return keep == nil || keep(p, line)
+	}
+}
+
 // searchKeyword performs keyword search using ripgrep.
 func (r *Retriever) searchKeyword(ctx context.Context, query, repoRoot string) ([]fusion.Result, error) {
 	// Check context cancellation
@@ -175,7 +278,7 @@ func (r *Retriever) searchKeyword(ctx context.Context, query, repoRoot string) (
 	default:
 	}
 
-	results, err := keyword.Search(query, repoRoot, r.config.KeywordLimit)
+	results, err := keywordSearch(query, repoRoot, r.config.KeywordLimit)
 	if err != nil {
 		return nil, err
 	}
@@ -197,6 +300,9 @@ func (r *Retriever) searchKeyword(ctx context.Context, query, repoRoot string) (
 
 // searchSemantic performs semantic search using embeddings.
 func (r *Retriever) searchSemantic(ctx context.Context, query string, opts RetrieveOptions) ([]fusion.Result, error) {
+	if r.cache != nil {
+		return r.searchCache(ctx, query, opts)
+	}
 	if r.semantic == nil || !r.semantic.Available() {
 		return nil, nil // Gracefully return empty if not available
 	}
@@ -225,18 +331,83 @@ func (r *Retriever) searchSemantic(ctx context.Context, query string, opts Retri
 		return nil, nil
 	}
 
+	// A truncated search still contributes the results it resolved
+	if searchResult.Truncated {
+		err = ctx.Err()
+	}
+
 	fusionResults := make([]fusion.Result, 0, len(searchResult.Results))
 	for _, res := range searchResult.Results {
+		var nodeType string
+		if opts.NodeTypeFn != nil {
+			nodeType = opts.NodeTypeFn(res.Path, res.StartLine, res.EndLine)
+		}
+		var modTime time.Time
+		if opts.ModTimeFn != nil {
+			modTime = opts.ModTimeFn(res.Path)
+		}
 		fusionResults = append(fusionResults, fusion.Result{
 			// Use path:startLine:endLine as ID for semantic results
 			// This helps with deduplication across different chunk boundaries
-			ID:      fmt.Sprintf("%s:%d:%d", res.Path, res.StartLine, res.EndLine),
-			Path:    res.Path,
-			Line:    res.StartLine,
-			EndLine: res.EndLine,
-			Score:   float64(res.Score),
-			Source:  "semantic",
-			Snippet: res.Snippet,
+			ID:       fmt.Sprintf("%s:%d:%d", res.Path, res.StartLine, res.EndLine),
+			Path:     res.Path,
+			Line:     res.StartLine,
+			EndLine:  res.EndLine,
+			Score:    float64(res.Score),
+			Source:   "semantic",
+			Snippet:  res.Snippet,
+			NodeType: nodeType,
+			ModTime:  modTime,
+			Metadata: map[string]interface{}{
+				"end_line": res.EndLine,
+			},
+		})
+	}
+	return fusionResults, err
+}
+
+// searchCache performs semantic search over a v2 index.
+func (r *Retriever) searchCache(ctx context.Context, query string, opts RetrieveOptions) ([]fusion.Result, error) {
+	if !r.cache.Available() {
+		return nil, nil // Gracefully return empty if not available
+	}
+
+	results, err := r.cache.Search(ctx, query, embedding.CacheSearchOptions{
+		RepoRoot:    opts.RepoRoot,
+		Limit:       r.config.SemanticLimit,
+		Granularity: opts.Granularity,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fusionResults := make([]fusion.Result, 0, len(results))
+	for _, res := range results {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		nodeType := res.NodeType
+		if opts.NodeTypeFn != nil {
+			nodeType = opts.NodeTypeFn(res.Path, res.StartLine, res.EndLine)
+		}
+		var snippet string
+		if opts.SnippetFn != nil {
+			snippet = opts.SnippetFn(res.Path, res.StartLine, res.EndLine)
+		}
+		var modTime time.Time
+		if opts.ModTimeFn != nil {
+			modTime = opts.ModTimeFn(res.Path)
+		}
+		fusionResults = append(fusionResults, fusion.Result{
+			ID:       fmt.Sprintf("%s:%d:%d", res.Path, res.StartLine, res.EndLine),
+			Path:     res.Path,
+			Line:     res.StartLine,
+			EndLine:  res.EndLine,
+			Score:    float64(res.Score),
+			Source:   "semantic",
+			Snippet:  snippet,
+			NodeType: nodeType,
+			ModTime:  modTime,
 			Metadata: map[string]interface{}{
 				"end_line": res.EndLine,
 			},
@@ -300,6 +471,9 @@ func (r *Retriever) SetConfig(cfg config.RetrieverConfig) {
 
 // SemanticAvailable returns true if semantic search is available.
 func (r *Retriever) SemanticAvailable() bool {
+	if r.cache != nil {
+		return r.cache.Available()
+	}
 	return r.semantic != nil && r.semantic.Available()
 }
 
@@ -0,0 +1,253 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"codetect/internal/config"
+	"codetect/internal/db"
+	"codetect/internal/embedding"
+)
+
+// stuckEmbedder blocks every call until release is closed, ignoring its
+// context, like a provider that hangs without honoring cancellation.
+type stuckEmbedder struct {
+	release chan struct{}
+}
+
+func (e *stuckEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	<-e.release
+	return nil, errors.New("released")
+}
+
+func (e *stuckEmbedder) Available() bool    { return true }
+func (e *stuckEmbedder) ProviderID() string { return "test:stuck" }
+func (e *stuckEmbedder) Dimensions() int    { return 3 }
+
+// newStuckSearcher returns a semantic searcher over one indexed chunk
+// whose query embedding never completes while the test runs.
+func newStuckSearcher(t *testing.T) *embedding.SemanticSearcher {
+	t.Helper()
+	database, err := db.Open(db.DefaultConfig(":memory:"))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	store, err := embedding.NewEmbeddingStore(database, "/project")
+	if err != nil {
+		t.Fatalf("creating store: %v", err)
+	}
+	chunk := embedding.Chunk{Path: "a.go", StartLine: 1, EndLine: 3, Content: "func a() {}"}
+	if err := store.Save(chunk, []float32{1, 0, 0}, "test"); err != nil {
+		t.Fatalf("saving chunk: %v", err)
+	}
+
+	embedder := &stuckEmbedder{release: make(chan struct{})}
+	t.Cleanup(func() {
+		close(embedder.release)
+		database.Close()
+	})
+	return embedding.NewSemanticSearcher(store, embedder)
+}
+
+func TestRetrieveTimeout(t *testing.T) {
+	for _, parallel := range []bool{true, false} {
+		cfg := config.DefaultRetrieverConfig()
+		cfg.Parallel = parallel
+		cfg.TimeoutMs = 100
+
+		retriever := NewRetriever(newStuckSearcher(t), nil, cfg)
+		start := time.Now()
+		result, err := retriever.Retrieve(context.Background(), "query", RetrieveOptions{RepoRoot: t.TempDir()})
+		elapsed := time.Since(start)
+		if err != nil {
+			t.Fatalf("parallel=%v: Retrieve failed: %v", parallel, err)
+		}
+		if elapsed > time.Second {
+			t.Errorf("parallel=%v: Retrieve took %v with a 100ms timeout", parallel, elapsed)
+		}
+		if !result.Partial {
+			t.Errorf("parallel=%v: result not marked partial", parallel)
+		}
+		timedOut := false
+		for _, err := range result.Errors {
+			timedOut = timedOut || errors.Is(err, context.DeadlineExceeded)
+		}
+		if !timedOut {
+			t.Errorf("parallel=%v: errors %v do not include the deadline", parallel, result.Errors)
+		}
+	}
+}
+
+func TestRetrieveCancel(t *testing.T) {
+	cfg := config.DefaultRetrieverConfig()
+	cfg.TimeoutMs = 0
+
+	retriever := NewRetriever(newStuckSearcher(t), nil, cfg)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	result, err := retriever.Retrieve(ctx, "query", RetrieveOptions{RepoRoot: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Retrieve took %v after its context expired", elapsed)
+	}
+	if !result.Partial || result.SemanticCount != 0 {
+		t.Errorf("Partial = %v, SemanticCount = %d; want true, 0", result.Partial, result.SemanticCount)
+	}
+}
+
+func TestRetrieveFilter(t *testing.T) {
+	database, err := db.Open(db.DefaultConfig(":memory:"))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	store, err := embedding.NewEmbeddingStore(database, "/project")
+	if err != nil {
+		t.Fatalf("creating store: %v", err)
+	}
+	embedder := &fixedEmbedder{vector: []float32{1, 0, 0}}
+
+	// The best match is in a file the filter rejects
+	for path, vec := range map[string][]float32{"best.go": {1, 0, 0}, "other.go": {1, 0.5, 0}} {
+		chunk := embedding.Chunk{Path: path, StartLine: 1, EndLine: 3, Content: "func " + path}
+		if err := store.Save(chunk, vec, embedder.ProviderID()); err != nil {
+			t.Fatalf("saving chunk: %v", err)
+		}
+	}
+
+	retriever := NewRetriever(embedding.NewSemanticSearcher(store, embedder), nil,
+		config.DefaultRetrieverConfig().WithParallel(false))
+	result, err := retriever.Retrieve(context.Background(), "query", RetrieveOptions{
+		RepoRoot: t.TempDir(),
+		Limit:    1,
+		Filter:   func(path string, line int) bool { return path != "best.go" },
+	})
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	if len(result.Results) != 1 || result.Results[0].Path != "other.go" {
+		t.Errorf("results = %+v, want only other.go within the limit", result.Results)
+	}
+
+	// An excluded file, given by absolute path, is dropped the same way
+	repoRoot := t.TempDir()
+	result, err = retriever.Retrieve(context.Background(), "query", RetrieveOptions{
+		RepoRoot:    repoRoot,
+		Limit:       1,
+		ExcludePath: filepath.Join(repoRoot, "best.go"),
+	})
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	if len(result.Results) != 1 || result.Results[0].Path != "other.go" {
+		t.Errorf("results excluding best.go = %+v, want only other.go", result.Results)
+	}
+}
+
+func TestSearchSemanticTruncated(t *testing.T) {
+	database, err := db.Open(db.DefaultConfig(":memory:"))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	store, err := embedding.NewEmbeddingStore(database, "/project")
+	if err != nil {
+		t.Fatalf("creating store: %v", err)
+	}
+	embedder := &fixedEmbedder{vector: []float32{1, 0, 0}}
+	for path, vec := range map[string][]float32{"best.go": {1, 0, 0}, "other.go": {1, 0.5, 0}} {
+		chunk := embedding.Chunk{Path: path, StartLine: 1, EndLine: 3, Content: "func " + path}
+		if err := store.Save(chunk, vec, embedder.ProviderID()); err != nil {
+			t.Fatalf("saving chunk: %v", err)
+		}
+	}
+	retriever := NewRetriever(embedding.NewSemanticSearcher(store, embedder), nil, config.DefaultRetrieverConfig())
+
+	// The time runs out after the best match's snippet is read
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results, err := retriever.searchSemantic(ctx, "query", RetrieveOptions{
+		SnippetFn: func(path string, start, end int) string {
+			cancel()
+			return path
+		},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if len(results) != 1 || results[0].Path != "best.go" {
+		t.Errorf("results = %+v, want the best match resolved before cancelling", results)
+	}
+}
+
+func TestRetrieveCacheGranularity(t *testing.T) {
+	cfg := db.DefaultConfig(":memory:")
+	database, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	cache, err := embedding.NewEmbeddingCache(database, cfg.Dialect(), 3, "test-model")
+	if err != nil {
+		t.Fatalf("creating cache: %v", err)
+	}
+	locations, err := embedding.NewLocationStore(database, cfg.Dialect())
+	if err != nil {
+		t.Fatalf("creating location store: %v", err)
+	}
+	embedder := &fixedEmbedder{vector: []float32{1, 0, 0}}
+
+	repoRoot := t.TempDir()
+	pipeline := embedding.NewPipeline(cache, locations, embedder, embedding.WithFileEmbeddings(true))
+	chunks := []embedding.Chunk{
+		{Path: "a.go", StartLine: 1, EndLine: 5, Content: "func a() {}"},
+		{Path: "b.go", StartLine: 3, EndLine: 8, Content: "func b() {}"},
+	}
+	if _, err := pipeline.EmbedChunks(context.Background(), repoRoot, chunks); err != nil {
+		t.Fatalf("EmbedChunks failed: %v", err)
+	}
+
+	retriever := NewCacheRetriever(embedding.NewCacheSearcher(cache, locations, embedder), nil,
+		config.DefaultRetrieverConfig().WithParallel(false))
+	if !retriever.SemanticAvailable() {
+		t.Fatal("expected semantic search to be available")
+	}
+
+	for _, tt := range []struct {
+		granularity string
+		chunks      int
+		files       int
+	}{
+		{"", 2, 0},
+		{embedding.GranularityFile, 0, 2},
+		{embedding.GranularityAll, 2, 2},
+	} {
+		result, err := retriever.Retrieve(context.Background(), "query", RetrieveOptions{
+			RepoRoot:    repoRoot,
+			Limit:       10,
+			Granularity: tt.granularity,
+		})
+		if err != nil {
+			t.Fatalf("Retrieve(%q) failed: %v", tt.granularity, err)
+		}
+		chunkCount, fileCount := 0, 0
+		for _, r := range result.Results {
+			if r.Line == 0 {
+				fileCount++
+			} else {
+				chunkCount++
+			}
+		}
+		if chunkCount != tt.chunks || fileCount != tt.files {
+			t.Errorf("granularity %q: got %d chunk and %d file results, want %d and %d",
+				tt.granularity, chunkCount, fileCount, tt.chunks, tt.files)
+		}
+	}
+}
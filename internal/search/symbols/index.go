@@ -38,6 +38,9 @@ func NewIndex(dbPath string) (*Index, error) {
 
 	// Default to current working directory for repo root
 	cwd, _ := os.Getwd()
+	if root, err := config.NormalizeRepoRoot(cwd); err == nil {
+		cwd = root
+	}
 
 	return &Index{
 		sqlDB:    sqlDB,
@@ -204,8 +207,44 @@ func (idx *Index) ListDefsInFile(path string) ([]Symbol, error) {
 	return symbols, rows.Err()
 }
 
+// IndexResult summarizes an Update or FullReindex run.
+type IndexResult struct {
+	Files        int           `json:"files"`         // Files (re)indexed by the run
+	Symbols      int           `json:"symbols"`       // Symbols found in those files
+	TotalFiles   int           `json:"total_files"`   // Files in the repo's index afterwards
+	TotalSymbols int           `json:"total_symbols"` // Symbols in the repo's index afterwards
+	Duration     time.Duration `json:"duration"`
+	ChangeType   string        `json:"change_type"` // "full", "incremental", or "none"
+}
+
 // Update re-indexes files that have changed since last index
-func (idx *Index) Update(root string) error {
+func (idx *Index) Update(root string) (*IndexResult, error) {
+	start := time.Now()
+	result := &IndexResult{ChangeType: "incremental"}
+	if err := idx.update(root, result); err != nil {
+		return nil, err
+	}
+	if err := idx.finishResult(result, start); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// finishResult fills in result's index totals and its duration since start.
+func (idx *Index) finishResult(result *IndexResult, start time.Time) error {
+	symbolCount, fileCount, err := idx.Stats()
+	if err != nil {
+		return fmt.Errorf("counting indexed symbols: %w", err)
+	}
+	result.TotalSymbols = symbolCount
+	result.TotalFiles = fileCount
+	result.Duration = time.Since(start)
+	return nil
+}
+
+// update re-indexes the files changed since the last index, counting them
+// and their symbols in result.
+func (idx *Index) update(root string, result *IndexResult) error {
 	idx.root = root
 
 	// Get list of files that need reindexing
@@ -215,6 +254,9 @@ func (idx *Index) Update(root string) error {
 	}
 
 	if len(filesToIndex) == 0 {
+		if result.ChangeType == "incremental" {
+			result.ChangeType = "none"
+		}
 		return nil // Nothing to do
 	}
 
@@ -336,6 +378,8 @@ func (idx *Index) Update(root string) error {
 		return fmt.Errorf("committing transaction: %w", err)
 	}
 
+	result.Files = len(filesToIndex)
+	result.Symbols = len(allSymbols)
 	return nil
 }
 
@@ -382,21 +426,30 @@ func (idx *Index) batchInsertSymbols(tx db.Tx, symbols []Symbol, batchSize int)
 }
 
 // FullReindex clears all data for this repo and reindexes from scratch
-func (idx *Index) FullReindex(root string) error {
+func (idx *Index) FullReindex(root string) (*IndexResult, error) {
+	start := time.Now()
+
 	// Set root for scoped operations
 	idx.root = root
 
 	// Clear all existing data for this repo using the adapter
 	deleteSymbolsQuery := fmt.Sprintf("DELETE FROM symbols WHERE repo_root = %s", idx.dialect.Placeholder(1))
 	if _, err := idx.adapter.Exec(deleteSymbolsQuery, idx.root); err != nil {
-		return fmt.Errorf("clearing symbols: %w", err)
+		return nil, fmt.Errorf("clearing symbols: %w", err)
 	}
 	deleteFilesQuery := fmt.Sprintf("DELETE FROM files WHERE repo_root = %s", idx.dialect.Placeholder(1))
 	if _, err := idx.adapter.Exec(deleteFilesQuery, idx.root); err != nil {
-		return fmt.Errorf("clearing files: %w", err)
+		return nil, fmt.Errorf("clearing files: %w", err)
 	}
 
-	return idx.Update(root)
+	result := &IndexResult{ChangeType: "full"}
+	if err := idx.update(root, result); err != nil {
+		return nil, err
+	}
+	if err := idx.finishResult(result, start); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
 type fileInfo struct {
@@ -38,7 +38,7 @@ func BenchmarkIndexingCtags(b *testing.B) {
 			b.Fatalf("Creating index: %v", err)
 		}
 
-		if err := idx.Update(repoRoot); err != nil {
+		if _, err := idx.Update(repoRoot); err != nil {
 			b.Fatalf("Indexing: %v", err)
 		}
 
@@ -81,7 +81,7 @@ func BenchmarkIndexingHybrid(b *testing.B) {
 			b.Fatalf("Creating index: %v", err)
 		}
 
-		if err := idx.Update(repoRoot); err != nil {
+		if _, err := idx.Update(repoRoot); err != nil {
 			b.Fatalf("Indexing: %v", err)
 		}
 
@@ -75,7 +75,7 @@ class Calculator:
 	defer idx.Close()
 
 	// Index the test directory
-	if err := idx.Update(tmpDir); err != nil {
+	if _, err := idx.Update(tmpDir); err != nil {
 		t.Fatalf("Indexing: %v", err)
 	}
 
@@ -1,9 +1,12 @@
 package symbols
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"codetect/internal/db"
 )
 
 func TestOpenDB(t *testing.T) {
@@ -187,3 +190,83 @@ func TestSchemaDirectory(t *testing.T) {
 		t.Errorf("nested directory should exist")
 	}
 }
+
+func TestIndexResult(t *testing.T) {
+	// ctags alone, so the counts do not depend on an ast-grep install;
+	// without ctags files are still indexed, with no symbols
+	t.Setenv("CODETECT_INDEX_BACKEND", "ctags")
+
+	repo := t.TempDir()
+	files := map[string]string{
+		"main.go":     "package main\n\nfunc main() {}\n\nfunc helper() int {\n\treturn 1\n}\n",
+		"lib/util.py": "def add(a, b):\n    return a + b\n",
+		"README.md":   "# not code\n",
+	}
+	for path, content := range files {
+		full := filepath.Join(repo, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	idx, err := NewIndexWithConfig(db.DefaultConfig(filepath.Join(t.TempDir(), "symbols.db")), repo)
+	if err != nil {
+		t.Fatalf("NewIndexWithConfig() error = %v", err)
+	}
+	defer idx.Close()
+
+	result, err := idx.FullReindex(repo)
+	if err != nil {
+		t.Fatalf("FullReindex() error = %v", err)
+	}
+	symbolCount, fileCount, err := idx.Stats()
+	if err != nil {
+		t.Fatalf("Stats() error = %v", err)
+	}
+	if result.ChangeType != "full" || result.Files != 2 || result.TotalFiles != fileCount || fileCount != 2 {
+		t.Errorf("FullReindex() = %+v, want 2 files of a full index", result)
+	}
+	if result.Symbols != symbolCount || result.TotalSymbols != symbolCount {
+		t.Errorf("FullReindex() counted %d symbols (total %d), index has %d",
+			result.Symbols, result.TotalSymbols, symbolCount)
+	}
+	if CtagsAvailable() && symbolCount == 0 {
+		t.Error("ctags found no symbols")
+	}
+
+	// The JSON output carries the same counts
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if decoded["files"] != float64(2) || decoded["total_symbols"] != float64(symbolCount) ||
+		decoded["change_type"] != "full" {
+		t.Errorf("JSON result = %s", data)
+	}
+
+	result, err = idx.Update(repo)
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if result.ChangeType != "none" || result.Files != 0 || result.TotalFiles != 2 {
+		t.Errorf("Update() without changes = %+v", result)
+	}
+
+	if err := os.WriteFile(filepath.Join(repo, "lib", "util.py"), []byte("def add(a, b):\n    return b + a  # swapped\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err = idx.Update(repo)
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if result.ChangeType != "incremental" || result.Files != 1 || result.TotalFiles != 2 {
+		t.Errorf("Update() after an edit = %+v, want 1 file reindexed", result)
+	}
+}
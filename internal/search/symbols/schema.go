@@ -55,15 +55,17 @@ func OpenDB(dbPath string) (*sql.DB, error) {
 		return nil, fmt.Errorf("creating db directory: %w", err)
 	}
 
-	db, err := sql.Open("sqlite", dbPath)
+	// WAL mode and a busy timeout on every connection, so the MCP server
+	// and the indexer can use the database at the same time
+	dsn := db.SQLiteDSN(dbPath, true, 0)
+
+	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("opening database: %w", err)
 	}
-
-	// Enable WAL mode for better concurrent performance
-	if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
+	if err := db.Ping(); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("setting WAL mode: %w", err)
+		return nil, fmt.Errorf("opening database: %w", err)
 	}
 
 	// Initialize schema if needed
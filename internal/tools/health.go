@@ -0,0 +1,82 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"codetect/internal/embedding"
+	"codetect/internal/mcp"
+)
+
+var (
+	warmupMu sync.Mutex
+	warmup   *embedding.Warmup
+)
+
+// StartWarmup begins loading the semantic index in the background, so the
+// first search_semantic call does not wait for it. Progress is reported by
+// the health tool. Calling it again while a warm-up exists does nothing.
+func StartWarmup(ctx context.Context) *embedding.Warmup {
+	warmupMu.Lock()
+	defer warmupMu.Unlock()
+	if warmup == nil {
+		warmup = embedding.StartWarmup(ctx, newSemanticSearcher)
+	}
+	return warmup
+}
+
+// currentWarmup returns the warm-up started by StartWarmup, if any.
+func currentWarmup() *embedding.Warmup {
+	warmupMu.Lock()
+	defer warmupMu.Unlock()
+	return warmup
+}
+
+// HealthResult is the response of the health tool.
+type HealthResult struct {
+	Status string `json:"status"`
+	// Ready is false only while a warm-up is still loading the index
+	Ready  bool                    `json:"ready"`
+	Warmup *embedding.WarmupStatus `json:"warmup,omitempty"`
+}
+
+func registerHealth(server *mcp.Server) {
+	tool := mcp.Tool{
+		Name:        "health",
+		Description: "Report server readiness, including whether the semantic index has finished loading when warm-up is enabled (CODETECT_SEARCH_WARMUP).",
+		InputSchema: mcp.InputSchema{
+			Type:       "object",
+			Properties: map[string]mcp.Property{},
+		},
+	}
+
+	handler := func(ctx context.Context, args map[string]any) (*mcp.ToolsCallResult, error) {
+		result := HealthResult{Status: "ok", Ready: true}
+		if w := currentWarmup(); w != nil {
+			status := w.Status()
+			result.Warmup = &status
+			switch status.State {
+			case embedding.WarmupLoading:
+				result.Status, result.Ready = "warming_up", false
+			case embedding.WarmupFailed:
+				// Searches still work by loading the index per query
+				result.Status = "degraded"
+			}
+		}
+
+		data, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+
+		return &mcp.ToolsCallResult{
+			Content: []mcp.Content{{
+				Type: "text",
+				Text: string(data),
+			}},
+		}, nil
+	}
+
+	server.RegisterTool(tool, handler)
+}
@@ -11,6 +11,7 @@ import (
 	"codetect/internal/db"
 	"codetect/internal/embedding"
 	"codetect/internal/mcp"
+	"codetect/internal/search"
 	"codetect/internal/search/files"
 	"codetect/internal/search/hybrid"
 )
@@ -24,7 +25,7 @@ func RegisterSemanticTools(server *mcp.Server) {
 func registerSearchSemantic(server *mcp.Server) {
 	tool := mcp.Tool{
 		Name:        "search_semantic",
-		Description: "Search for code semantically similar to the query. Uses embeddings to find conceptually related code, not just keyword matches. Requires Ollama with nomic-embed-text model.",
+		Description: "Search for code semantically similar to the query. Uses embeddings to find conceptually related code, not just keyword matches. When no result is relevant, such as for an exact error message, falls back to a keyword search for the query; each result's source says which search found it. Requires Ollama with nomic-embed-text model.",
 		InputSchema: mcp.InputSchema{
 			Type: "object",
 			Properties: map[string]mcp.Property{
@@ -36,12 +37,28 @@ func registerSearchSemantic(server *mcp.Server) {
 					Type:        "number",
 					Description: "Maximum number of results (default: 10)",
 				},
+				"exclude_path": {
+					Type:        "string",
+					Description: "Leave out results from this file, e.g. the one being edited (results from other files still fill the limit)",
+				},
+				"highlight": {
+					Type:        "boolean",
+					Description: "Mark the lines in each result that best match the query (one extra embedding call per result)",
+				},
+				"highlight_lines": {
+					Type:        "number",
+					Description: "Approximate size in lines of each highlight (default: 3)",
+				},
+				"dedup_by_content": {
+					Type:        "boolean",
+					Description: dedupByContentDescription,
+				},
 			},
 			Required: []string{"query"},
 		},
 	}
 
-	handler := func(args map[string]any) (*mcp.ToolsCallResult, error) {
+	handler := func(ctx context.Context, args map[string]any) (*mcp.ToolsCallResult, error) {
 		query, ok := args["query"].(string)
 		if !ok || query == "" {
 			return nil, fmt.Errorf("query is required")
@@ -52,6 +69,23 @@ func registerSearchSemantic(server *mcp.Server) {
 			limit = int(l)
 		}
 
+		excludePath, _ := args["exclude_path"].(string)
+		dedup, _ := args["dedup_by_content"].(bool)
+
+		highlightLines := 0
+		if h, _ := args["highlight"].(bool); h {
+			highlightLines = embedding.DefaultHighlightLines
+			if n, ok := args["highlight_lines"].(float64); ok && n > 0 {
+				highlightLines = int(n)
+			}
+		}
+
+		// Bound the whole call; a search cut short returns the results
+		// resolved so far, marked truncated
+		searchCfg := config.LoadSearchConfigFromEnv()
+		ctx, cancel := toolContext(ctx, searchCfg.ToolTimeoutMs)
+		defer cancel()
+
 		// Open semantic searcher
 		searcher, err := openSemanticSearcher()
 		if err != nil {
@@ -73,8 +107,25 @@ func registerSearchSemantic(server *mcp.Server) {
 			}, nil
 		}
 
-		// Perform search with snippets
-		result, err := searcher.SearchWithSnippets(context.Background(), query, limit, getSnippetFn())
+		// Perform search with snippets, searching for the query verbatim
+		// when nothing semantic is relevant
+		cwd, err := currentRepoRoot()
+		if err != nil {
+			cwd = "."
+		}
+		result, err := search.SemanticWithFallback(ctx, searcher, query, search.FallbackOptions{
+			RepoRoot: cwd,
+			Search: embedding.SearchOptions{
+				Limit:          limit,
+				ExcludePath:    excludePath,
+				HighlightLines: highlightLines,
+				ReadLines:      files.GetFileLines,
+				DedupByContent: dedup,
+			},
+			SnippetFn:       getSnippetFn(),
+			MinScore:        float32(searchCfg.SemanticMinScore),
+			KeywordFallback: searchCfg.KeywordFallback,
+		})
 		if err != nil {
 			return nil, fmt.Errorf("semantic search: %w", err)
 		}
@@ -119,7 +170,7 @@ func registerHybridSearch(server *mcp.Server) {
 		},
 	}
 
-	handler := func(args map[string]any) (*mcp.ToolsCallResult, error) {
+	handler := func(ctx context.Context, args map[string]any) (*mcp.ToolsCallResult, error) {
 		query, ok := args["query"].(string)
 		if !ok || query == "" {
 			return nil, fmt.Errorf("query is required")
@@ -144,13 +195,13 @@ func registerHybridSearch(server *mcp.Server) {
 		hybridSearcher := hybrid.NewSearcher(semanticSearcher)
 
 		// Get working directory
-		cwd, err := os.Getwd()
+		cwd, err := currentRepoRoot()
 		if err != nil {
 			cwd = "."
 		}
 
 		// Perform search
-		result, err := hybridSearcher.Search(context.Background(), query, cwd, config)
+		result, err := hybridSearcher.Search(ctx, query, cwd, config)
 		if err != nil {
 			return nil, fmt.Errorf("hybrid search: %w", err)
 		}
@@ -171,10 +222,21 @@ func registerHybridSearch(server *mcp.Server) {
 	server.RegisterTool(tool, handler)
 }
 
-// openSemanticSearcher creates a semantic searcher using the configured database.
+// openSemanticSearcher returns the searcher preloaded by StartWarmup once it
+// is ready, and otherwise opens a new one.
+func openSemanticSearcher() (*embedding.SemanticSearcher, error) {
+	if w := currentWarmup(); w != nil {
+		if searcher := w.Searcher(); searcher != nil {
+			return searcher, nil
+		}
+	}
+	return newSemanticSearcher()
+}
+
+// newSemanticSearcher creates a semantic searcher using the configured database.
 // It supports both SQLite and PostgreSQL based on environment configuration.
 // Falls back to SQLite if PostgreSQL is unavailable.
-func openSemanticSearcher() (*embedding.SemanticSearcher, error) {
+func newSemanticSearcher() (*embedding.SemanticSearcher, error) {
 	// Load database configuration from environment
 	dbConfig := config.LoadDatabaseConfigFromEnv()
 
@@ -187,7 +249,7 @@ func openSemanticSearcher() (*embedding.SemanticSearcher, error) {
 
 			// Fallback to SQLite
 			dbConfig.Type = db.DatabaseSQLite
-			cwd, _ := os.Getwd()
+			cwd, _ := currentRepoRoot()
 			dbConfig.Path = filepath.Join(cwd, ".codetect", "symbols.db")
 
 			store, err = openEmbeddingStore(dbConfig)
@@ -205,16 +267,19 @@ func openSemanticSearcher() (*embedding.SemanticSearcher, error) {
 		return nil, fmt.Errorf("creating embedder: %w", err)
 	}
 
-	// Create semantic searcher
-	return embedding.NewSemanticSearcher(store, embedder), nil
+	// Create semantic searcher, ranking by the configured metric
+	searcher := embedding.NewSemanticSearcher(store, embedder)
+	searcher.SetMetric(embedding.MetricFromConfig(config.LoadDistanceMetricFromEnv()))
+	searcher.SetResultCache(searchResultCache())
+	return searcher, nil
 }
 
 // openEmbeddingStore opens an embedding store with the given configuration.
 func openEmbeddingStore(dbConfig config.DatabaseConfig) (*embedding.EmbeddingStore, error) {
 	// Get current working directory as repo root for multi-repo isolation
-	cwd, err := os.Getwd()
+	cwd, err := currentRepoRoot()
 	if err != nil {
-		return nil, fmt.Errorf("getting working directory: %w", err)
+		return nil, err
 	}
 
 	switch dbConfig.Type {
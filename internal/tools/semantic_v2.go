@@ -3,9 +3,13 @@ package tools
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"codetect/internal/config"
 	dbpkg "codetect/internal/db"
@@ -15,15 +19,42 @@ import (
 	"codetect/internal/mcp"
 	"codetect/internal/rerank"
 	"codetect/internal/search"
-	"codetect/internal/search/files"
 )
 
 // RegisterV2SemanticTools registers the v2 semantic search MCP tools.
 // These tools use the new retriever with RRF fusion and optional reranking.
 func RegisterV2SemanticTools(server *mcp.Server) {
 	registerHybridSearchV2(server)
+	registerSearchByExample(server)
+	registerFindSimilarFunctions(server)
+	registerFileSymbols(server)
+	registerRepoSummary(server)
 }
 
+// dedupByContentDescription documents the dedup_by_content argument of the
+// search tools.
+const dedupByContentDescription = "Return identical code found at several locations once, listing the other locations under also_at (default: false)"
+
+// granularityDescription documents the granularity argument of the v2
+// semantic search tools.
+const granularityDescription = "What to match: \"chunk\" for functions and other chunks, \"file\" for whole files (needs CODETECT_FILE_EMBEDDINGS at index time), or \"all\" (default: chunk)"
+
+// granularityArg returns the granularity argument of a v2 semantic search
+// tool, or "" for the default.
+func granularityArg(args map[string]any) (string, error) {
+	granularity, _ := args["granularity"].(string)
+	switch granularity {
+	case "", embedding.GranularityChunk, embedding.GranularityFile, embedding.GranularityAll:
+		return granularity, nil
+	default:
+		return "", fmt.Errorf("granularity must be chunk, file or all, not %q", granularity)
+	}
+}
+
+// metadataOverfetch multiplies the candidates hybrid_search_v2 takes from
+// each search when filtering by metadata, which drops some of them.
+const metadataOverfetch = 4
+
 func registerHybridSearchV2(server *mcp.Server) {
 	tool := mcp.Tool{
 		Name:        "hybrid_search_v2",
@@ -41,14 +72,30 @@ func registerHybridSearchV2(server *mcp.Server) {
 				},
 				"rerank": {
 					Type:        "boolean",
-					Description: "Enable cross-encoder reranking for higher precision (default: false)",
+					Description: "Enable cross-encoder reranking for higher precision; skipped for a clear top result when CODETECT_RERANK_ADAPTIVE_MARGIN is set (default: false)",
+				},
+				"metadata": {
+					Type:        "object",
+					Description: "Only return results in chunks tagged with all of these metadata key-value pairs, e.g. {\"team\": \"payments\"}",
+				},
+				"exclude_path": {
+					Type:        "string",
+					Description: "Leave out results from this file, e.g. the one being edited (results from other files still fill the limit)",
+				},
+				"dedup_by_content": {
+					Type:        "boolean",
+					Description: dedupByContentDescription + "; locations are listed in each result's metadata",
+				},
+				"granularity": {
+					Type:        "string",
+					Description: granularityDescription + "; applies to semantic matches",
 				},
 			},
 			Required: []string{"query"},
 		},
 	}
 
-	handler := func(args map[string]any) (*mcp.ToolsCallResult, error) {
+	handler := func(ctx context.Context, args map[string]any) (*mcp.ToolsCallResult, error) {
 		query, ok := args["query"].(string)
 		if !ok || query == "" {
 			return nil, fmt.Errorf("query is required")
@@ -63,9 +110,28 @@ func registerHybridSearchV2(server *mcp.Server) {
 		if r, ok := args["rerank"].(bool); ok {
 			enableRerank = r
 		}
+		dedup, _ := args["dedup_by_content"].(bool)
+		excludePath, _ := args["exclude_path"].(string)
+		granularity, err := granularityArg(args)
+		if err != nil {
+			return nil, err
+		}
+
+		var metadataFilter map[string]string
+		if m, ok := args["metadata"].(map[string]any); ok && len(m) > 0 {
+			metadataFilter = make(map[string]string, len(m))
+			for key, value := range m {
+				metadataFilter[key] = fmt.Sprint(value)
+			}
+		}
+
+		// Bound the whole call, so a slow backend cannot block the agent
+		searchCfg := config.LoadSearchConfigFromEnv()
+		ctx, cancel := toolContext(ctx, searchCfg.ToolTimeoutMs)
+		defer cancel()
 
 		// Get current working directory as repo root
-		repoRoot, err := os.Getwd()
+		repoRoot, err := currentRepoRoot()
 		if err != nil {
 			repoRoot = "."
 		}
@@ -83,37 +149,93 @@ func registerHybridSearchV2(server *mcp.Server) {
 		defer idx.Close()
 
 		// Create semantic searcher from v2 indexer components
-		semanticSearcher, err := createSemanticSearcherFromV2(idx, repoRoot)
+		semanticSearcher, err := createSemanticSearcherFromV2(idx)
+		var mismatch *embedding.ModelMismatchError
+		if errors.As(err, &mismatch) {
+			return nil, fmt.Errorf("semantic search: %w", err)
+		}
 		if err != nil {
 			// Continue without semantic search
 			semanticSearcher = nil
 		}
 
 		// Create retriever with v2 config
-		retrieverCfg := config.DefaultRetrieverConfig()
+		retrieverCfg := searchCfg.Retrieval
 		retrieverCfg.KeywordLimit = limit
 		retrieverCfg.SemanticLimit = limit
 		retrieverCfg.SymbolLimit = limit / 2
 		retrieverCfg.Parallel = true
 
-		retriever := search.NewRetriever(semanticSearcher, nil, retrieverCfg)
+		// Keep only results inside chunks with matching metadata, filtered
+		// before fusion from more candidates so the limit is still filled
+		var filter func(path string, line int) bool
+		if metadataFilter != nil {
+			filter, err = idx.MetadataMatcher(metadataFilter)
+			if err != nil {
+				return nil, fmt.Errorf("metadata filter: %w", err)
+			}
+			retrieverCfg.KeywordLimit *= metadataOverfetch
+			retrieverCfg.SemanticLimit *= metadataOverfetch
+			retrieverCfg.SymbolLimit *= metadataOverfetch
+		}
+		// The excluded file's results are dropped the same way
+		if excludePath != "" {
+			retrieverCfg.KeywordLimit += limit
+			retrieverCfg.SemanticLimit += limit
+		}
+
+		retriever := search.NewCacheRetriever(semanticSearcher, nil, retrieverCfg)
+
+		// Resolve chunk node types when they are weighted
+		var nodeTypeFn func(path string, start, end int) string
+		if len(retrieverCfg.NodeTypeWeights) > 0 {
+			nodeTypeFn, err = idx.NodeTypeResolver()
+			if err != nil {
+				return nil, fmt.Errorf("node types: %w", err)
+			}
+		}
+
+		// Resolve file modification times when recency is boosted
+		var modTimeFn func(path string) time.Time
+		if retrieverCfg.FreshnessWeight > 0 {
+			modTimeFn, err = idx.ModTimeResolver()
+			if err != nil {
+				return nil, fmt.Errorf("modification times: %w", err)
+			}
+		}
 
 		// Perform retrieval
-		ctx := context.Background()
 		retrieveResult, err := retriever.Retrieve(ctx, query, search.RetrieveOptions{
-			RepoRoot:  repoRoot,
-			Limit:     limit * 2, // Get extra candidates for reranking
-			SnippetFn: getSnippetFn(),
+			RepoRoot:    repoRoot,
+			Limit:       limit * 2, // Get extra candidates for reranking
+			SnippetFn:   getSnippetFnV2(ctx, idx),
+			NodeTypeFn:  nodeTypeFn,
+			ModTimeFn:   modTimeFn,
+			Filter:      filter,
+			ExcludePath: excludePath,
+			Granularity: granularity,
 		})
 		if err != nil {
 			return nil, fmt.Errorf("retrieval failed: %w", err)
 		}
 
 		finalResults := retrieveResult.Results
+		truncated := retrieveResult.Partial
+
+		// Collapse identical code, so copies do not crowd out other results
+		if dedup {
+			resolve, err := idx.ChunkResolver()
+			if err != nil {
+				return nil, fmt.Errorf("resolving chunks: %w", err)
+			}
+			finalResults = dedupFusedByContent(finalResults, resolve)
+		}
 
-		// Optionally apply reranking
-		if enableRerank && len(finalResults) > 0 {
-			rerankCfg := config.DefaultRerankerConfig()
+		// Optionally apply reranking, unless the time is already up
+		reranked := enableRerank && ctx.Err() == nil
+		truncated = truncated || enableRerank && !reranked
+		if reranked && len(finalResults) > 0 {
+			rerankCfg := searchCfg.Reranking
 			rerankCfg.Enabled = true
 			rerankCfg.TopK = limit
 
@@ -130,6 +252,9 @@ func registerHybridSearchV2(server *mcp.Server) {
 			rerankResult, err := reranker.Rerank(ctx, query, finalResults, contents)
 			if err == nil {
 				finalResults = rerankResult.Results
+				reranked = !rerankResult.Skipped
+			} else if ctx.Err() != nil {
+				reranked, truncated = false, true
 			}
 		}
 
@@ -138,6 +263,15 @@ func registerHybridSearchV2(server *mcp.Server) {
 			finalResults = finalResults[:limit]
 		}
 
+		// Record the query and how well it was answered, if enabled; a
+		// failure to log does not fail the search
+		logged := embedding.LoggedQuery{Tool: "hybrid_search_v2", Query: query, Results: len(finalResults)}
+		if len(finalResults) > 0 {
+			top := finalResults[0]
+			logged.TopPath, logged.TopLine, logged.TopScore = top.Path, top.Line, top.RRFScore
+		}
+		_ = idx.LogQuery(logged)
+
 		// Build response
 		response := HybridSearchV2Result{
 			Query:             query,
@@ -147,8 +281,13 @@ func registerHybridSearchV2(server *mcp.Server) {
 			SymbolCount:       retrieveResult.SymbolCount,
 			SemanticAvailable: retrieveResult.SemanticAvailable,
 			SymbolAvailable:   retrieveResult.SymbolAvailable,
-			Reranked:          enableRerank,
+			Reranked:          reranked,
 			Duration:          retrieveResult.Duration.String(),
+			Truncated:         truncated,
+		}
+		if truncated {
+			response.Note = "search timed out; results are best-effort and may miss matches " +
+				"from the signals or reranking that did not finish"
 		}
 
 		data, err := json.Marshal(response)
@@ -167,6 +306,35 @@ func registerHybridSearchV2(server *mcp.Server) {
 	server.RegisterTool(tool, handler)
 }
 
+// dedupFusedByContent collapses fused results pointing at identical code,
+// the same lines of chunks with the same content hash, into the
+// best-ranked one, listing the other locations under its "also_at"
+// metadata. Results outside any chunk are kept.
+func dedupFusedByContent(results []fusion.RRFResult, resolve func(path string, start, end int) (embedding.ChunkLocation, bool)) []fusion.RRFResult {
+	return embedding.CollapseDuplicates(results,
+		func(r fusion.RRFResult) string {
+			end := max(r.EndLine, r.Line)
+			loc, ok := resolve(r.Path, r.Line, end)
+			if !ok {
+				return ""
+			}
+			return fmt.Sprintf("%s:%d:%d", loc.ContentHash, r.Line-loc.StartLine, end-loc.StartLine)
+		},
+		func(kept *fusion.RRFResult, dup fusion.RRFResult) {
+			metadata := maps.Clone(kept.Metadata)
+			if metadata == nil {
+				metadata = make(map[string]interface{})
+			}
+			alsoAt, _ := metadata["also_at"].([]embedding.ResultLocation)
+			metadata["also_at"] = append(alsoAt, embedding.ResultLocation{
+				Path:      dup.Path,
+				StartLine: dup.Line,
+				EndLine:   max(dup.EndLine, dup.Line),
+			})
+			kept.Metadata = metadata
+		})
+}
+
 // HybridSearchV2Result is the response format for v2 hybrid search.
 type HybridSearchV2Result struct {
 	Query             string             `json:"query"`
@@ -178,13 +346,364 @@ type HybridSearchV2Result struct {
 	SymbolAvailable   bool               `json:"symbol_available"`
 	Reranked          bool               `json:"reranked"`
 	Duration          string             `json:"duration"`
+
+	// Truncated is set when the call's timeout cut retrieval or reranking
+	// short; Note then says so for the caller.
+	Truncated bool   `json:"truncated,omitempty"`
+	Note      string `json:"note,omitempty"`
 }
 
+func registerSearchByExample(server *mcp.Server) {
+	tool := mcp.Tool{
+		Name:        "search_by_example",
+		Description: "Find code similar to a pasted code snippet (\"find code like this\"), from the v2 index. The snippet is chunked and embedded the same way indexed code is, so it matches code with the same shape and purpose; use hybrid_search_v2 for natural-language queries.",
+		InputSchema: mcp.InputSchema{
+			Type: "object",
+			Properties: map[string]mcp.Property{
+				"code": {
+					Type:        "string",
+					Description: "Code snippet to find similar code for, e.g. a whole function",
+				},
+				"path": {
+					Type:        "string",
+					Description: "File name whose extension gives the snippet's language, e.g. example.go (default: chunk as plain text)",
+				},
+				"limit": {
+					Type:        "number",
+					Description: "Max results to return (default: 10)",
+				},
+				"model": {
+					Type:        "string",
+					Description: "Embedding model whose vectors to search, one of CODETECT_EMBEDDING_EXTRA_MODELS (default: the primary model)",
+				},
+				"dedup_by_content": {
+					Type:        "boolean",
+					Description: dedupByContentDescription,
+				},
+				"granularity": {
+					Type:        "string",
+					Description: granularityDescription,
+				},
+				"min_score": {
+					Type:        "number",
+					Description: "Minimum similarity of a result, up to 1, and at least CODETECT_SIMILAR_MIN_SCORE; code with nothing this close gets no results (default: CODETECT_SIMILAR_MIN_SCORE, else 0)",
+				},
+			},
+			Required: []string{"code"},
+		},
+	}
+
+	handler := func(ctx context.Context, args map[string]any) (*mcp.ToolsCallResult, error) {
+		code, ok := args["code"].(string)
+		if !ok || code == "" {
+			return nil, fmt.Errorf("code is required")
+		}
+		path, _ := args["path"].(string)
+		model, _ := args["model"].(string)
+		dedup, _ := args["dedup_by_content"].(bool)
+
+		granularity, err := granularityArg(args)
+		if err != nil {
+			return nil, err
+		}
+
+		limit := 10
+		if l, ok := args["limit"].(float64); ok {
+			limit = int(l)
+		}
+		minScore := config.LoadSearchConfigFromEnv().SimilarMinScore
+		if s, ok := args["min_score"].(float64); ok {
+			minScore = max(minScore, s)
+		}
+
+		repoRoot, err := currentRepoRoot()
+		if err != nil {
+			repoRoot = "."
+		}
+
+		idx, err := openV2Indexer(repoRoot)
+		if err != nil {
+			return &mcp.ToolsCallResult{
+				Content: []mcp.Content{{
+					Type: "text",
+					Text: fmt.Sprintf(`{"available": false, "error": %q}`, err.Error()),
+				}},
+			}, nil
+		}
+		defer idx.Close()
+
+		results, err := idx.SearchByExample(ctx, code, path, embedding.CacheSearchOptions{
+			Limit:          limit,
+			Granularity:    granularity,
+			Model:          model,
+			DedupByContent: dedup,
+			MinScore:       float32(minScore),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("searching by example: %w", err)
+		}
+		if results == nil {
+			results = []embedding.CacheSearchResult{}
+		}
+
+		data, err := json.Marshal(SearchByExampleResult{Results: results})
+		if err != nil {
+			return nil, err
+		}
+
+		return &mcp.ToolsCallResult{
+			Content: []mcp.Content{{
+				Type: "text",
+				Text: string(data),
+			}},
+		}, nil
+	}
+
+	server.RegisterTool(tool, handler)
+}
+
+// SearchByExampleResult is the response format for search_by_example.
+type SearchByExampleResult struct {
+	Results []embedding.CacheSearchResult `json:"results"`
+}
+
+func registerFindSimilarFunctions(server *mcp.Server) {
+	tool := mcp.Tool{
+		Name:        "find_similar_functions",
+		Description: "Find groups of near-duplicate functions in the v2 index, refactoring candidates whose embeddings are nearly the same though their code differs (e.g. copies with renamed variables). Exact copies are only listed alongside a near-duplicate.",
+		InputSchema: mcp.InputSchema{
+			Type: "object",
+			Properties: map[string]mcp.Property{
+				"threshold": {
+					Type:        "number",
+					Description: fmt.Sprintf("Minimum similarity between two functions of a group, up to 1, and at least CODETECT_SIMILAR_MIN_SCORE (default: %.2f)", embedding.DefaultSimilarThreshold),
+				},
+				"limit": {
+					Type:        "number",
+					Description: "Max groups to return, largest first (default: 20)",
+				},
+				"metadata": {
+					Type:        "object",
+					Description: "Only compare functions in chunks tagged with all of these metadata key-value pairs, e.g. {\"team\": \"payments\"}",
+				},
+			},
+		},
+	}
+
+	handler := func(ctx context.Context, args map[string]any) (*mcp.ToolsCallResult, error) {
+		opts := embedding.SimilarOptions{
+			MinScore: float32(config.LoadSearchConfigFromEnv().SimilarMinScore),
+		}
+		if t, ok := args["threshold"].(float64); ok {
+			opts.Threshold = float32(t)
+		}
+		if l, ok := args["limit"].(float64); ok {
+			opts.Limit = int(l)
+		}
+		if m, ok := args["metadata"].(map[string]any); ok && len(m) > 0 {
+			opts.Metadata = make(map[string]string, len(m))
+			for key, value := range m {
+				opts.Metadata[key] = fmt.Sprint(value)
+			}
+		}
+
+		repoRoot, err := currentRepoRoot()
+		if err != nil {
+			repoRoot = "."
+		}
+
+		idx, err := openV2Indexer(repoRoot)
+		if err != nil {
+			return &mcp.ToolsCallResult{
+				Content: []mcp.Content{{
+					Type: "text",
+					Text: fmt.Sprintf(`{"available": false, "error": %q}`, err.Error()),
+				}},
+			}, nil
+		}
+		defer idx.Close()
+
+		groups, err := idx.FindSimilarFunctions(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("finding similar functions: %w", err)
+		}
+
+		data, err := json.Marshal(FindSimilarFunctionsResult{Groups: groups})
+		if err != nil {
+			return nil, err
+		}
+
+		return &mcp.ToolsCallResult{
+			Content: []mcp.Content{{
+				Type: "text",
+				Text: string(data),
+			}},
+		}, nil
+	}
+
+	server.RegisterTool(tool, handler)
+}
+
+// FindSimilarFunctionsResult is the response format for
+// find_similar_functions.
+type FindSimilarFunctionsResult struct {
+	Groups []embedding.SimilarGroup `json:"groups"`
+}
+
+func registerFileSymbols(server *mcp.Server) {
+	tool := mcp.Tool{
+		Name:        "file_symbols",
+		Description: "List the symbols defined in a file (name, type, line range) in source order, from the v2 index. Works for repos indexed only with 'codetect-index index --v2'.",
+		InputSchema: mcp.InputSchema{
+			Type: "object",
+			Properties: map[string]mcp.Property{
+				"path": {
+					Type:        "string",
+					Description: "File path, relative to the repository root or absolute",
+				},
+			},
+			Required: []string{"path"},
+		},
+	}
+
+	handler := func(ctx context.Context, args map[string]any) (*mcp.ToolsCallResult, error) {
+		path, ok := args["path"].(string)
+		if !ok || path == "" {
+			return nil, fmt.Errorf("path is required")
+		}
+
+		repoRoot, err := currentRepoRoot()
+		if err != nil {
+			repoRoot = "."
+		}
+
+		idx, err := openV2Indexer(repoRoot)
+		if err != nil {
+			return &mcp.ToolsCallResult{
+				Content: []mcp.Content{{
+					Type: "text",
+					Text: fmt.Sprintf(`{"available": false, "error": %q}`, err.Error()),
+				}},
+			}, nil
+		}
+		defer idx.Close()
+
+		syms, err := idx.FileSymbols(path)
+		if err != nil {
+			return nil, fmt.Errorf("listing symbols: %w", err)
+		}
+
+		data, err := json.Marshal(FileSymbolsResult{
+			Path:    path,
+			Symbols: syms,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return &mcp.ToolsCallResult{
+			Content: []mcp.Content{{
+				Type: "text",
+				Text: string(data),
+			}},
+		}, nil
+	}
+
+	server.RegisterTool(tool, handler)
+}
+
+// FileSymbolsResult is the response format for file_symbols.
+type FileSymbolsResult struct {
+	Path    string               `json:"path"`
+	Symbols []indexer.FileSymbol `json:"symbols"`
+}
+
+func registerRepoSummary(server *mcp.Server) {
+	tool := mcp.Tool{
+		Name:        "repo_summary",
+		Description: "High-level map of the repository from the v2 index: dominant languages, top-level directories, largest files, and the most referenced symbols. Useful for getting oriented in an unfamiliar codebase.",
+		InputSchema: mcp.InputSchema{
+			Type: "object",
+			Properties: map[string]mcp.Property{
+				"limit": {
+					Type:        "number",
+					Description: "Max entries per list (default: 10)",
+				},
+			},
+		},
+	}
+
+	handler := func(ctx context.Context, args map[string]any) (*mcp.ToolsCallResult, error) {
+		limit := indexer.DefaultSummaryLimit
+		if l, ok := args["limit"].(float64); ok {
+			limit = int(l)
+		}
+
+		repoRoot, err := currentRepoRoot()
+		if err != nil {
+			repoRoot = "."
+		}
+
+		idx, err := openV2Indexer(repoRoot)
+		if err != nil {
+			return &mcp.ToolsCallResult{
+				Content: []mcp.Content{{
+					Type: "text",
+					Text: fmt.Sprintf(`{"available": false, "error": %q}`, err.Error()),
+				}},
+			}, nil
+		}
+		defer idx.Close()
+
+		summary, err := idx.Summary(limit)
+		if err != nil {
+			return nil, fmt.Errorf("summarizing repository: %w", err)
+		}
+
+		data, err := json.Marshal(summary)
+		if err != nil {
+			return nil, err
+		}
+
+		return &mcp.ToolsCallResult{
+			Content: []mcp.Content{{
+				Type: "text",
+				Text: string(data),
+			}},
+		}, nil
+	}
+
+	server.RegisterTool(tool, handler)
+}
+
+// toolContext returns the context of a search tool call, cancelled with
+// ctx or after timeoutMs milliseconds, whichever is first, or only with
+// ctx if timeoutMs is 0.
+func toolContext(ctx context.Context, timeoutMs int) (context.Context, context.CancelFunc) {
+	if timeoutMs <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(timeoutMs)*time.Millisecond)
+}
+
+// searchResultCache returns the result cache shared by the indexers the
+// tools open per call and by search_semantic's searcher, or nil unless
+// CODETECT_SEARCH_CACHE_ENABLED is set.
+// Entries are keyed by repository, so one cache serves every repo.
+var searchResultCache = sync.OnceValue(func() *embedding.ResultCache {
+	cacheCfg := config.LoadSearchConfigFromEnv().Cache
+	if !cacheCfg.Enabled {
+		return nil
+	}
+	return embedding.NewResultCache(cacheCfg.Size, time.Duration(cacheCfg.TTLSeconds)*time.Second)
+})
+
 // openV2Indexer opens a v2 indexer for the given repository.
 func openV2Indexer(repoRoot string) (*indexer.Indexer, error) {
 	// Load database configuration from environment
 	dbConfig := config.LoadDatabaseConfigFromEnv()
 	embConfig := embedding.LoadConfigFromEnv()
+	hnswCfg := config.LoadHNSWConfigFromEnv()
 
 	// Build indexer config
 	cfg := &indexer.Config{
@@ -195,10 +714,31 @@ func openV2Indexer(repoRoot string) (*indexer.Indexer, error) {
 		OllamaURL:         embConfig.OllamaURL,
 		LiteLLMURL:        embConfig.LiteLLMURL,
 		LiteLLMKey:        embConfig.LiteLLMKey,
+		EmbeddingCompress: embConfig.Compress,
+		EmbeddingFallback: embConfig.Fallback,
+		ExtraModels:       embConfig.ExtraModels,
 		BatchSize:         32,
 		MaxWorkers:        4,
+		DistanceMetric:    hnswCfg.DistanceMetric,
+		HNSW:              hnswCfg,
+		VectorIndex:       config.LoadVectorIndexTypeFromEnv(),
+		PQ:                config.LoadPQConfigFromEnv(),
+		ShardByRepo:       config.LoadVectorShardByRepoFromEnv(),
+		DBReadRetries:     dbConfig.ReadRetries,
+		DBRetryBackoff:    dbConfig.RetryBackoff,
 	}
 
+	// Chunk, tag and embed like the indexer did, for search_by_example and
+	// metadata filters
+	if err := cfg.LoadChunking(repoRoot); err != nil {
+		return nil, err
+	}
+	if err := cfg.LoadMetadata(repoRoot); err != nil {
+		return nil, err
+	}
+	cfg.QueryLog = config.LoadSearchConfigFromEnv().QueryLog
+	cfg.ResultCache = searchResultCache()
+
 	// Set database path/DSN
 	if dbConfig.Type == dbpkg.DatabasePostgres {
 		cfg.DSN = dbConfig.DSN
@@ -216,9 +756,9 @@ func openV2Indexer(repoRoot string) (*indexer.Indexer, error) {
 	return indexer.New(repoRoot, cfg)
 }
 
-// createSemanticSearcherFromV2 creates a semantic searcher from v2 indexer components.
-// This bridges the v2 content-addressed cache to the v1 semantic searcher interface.
-func createSemanticSearcherFromV2(idx *indexer.Indexer, repoRoot string) (*embedding.SemanticSearcher, error) {
+// createSemanticSearcherFromV2 creates a semantic searcher over the v2
+// index's content-addressed cache and chunk locations.
+func createSemanticSearcherFromV2(idx *indexer.Indexer) (*embedding.CacheSearcher, error) {
 	// Get the embedding pipeline from the indexer
 	pipeline := idx.Pipeline()
 	if pipeline == nil {
@@ -242,42 +782,33 @@ func createSemanticSearcherFromV2(idx *indexer.Indexer, repoRoot string) (*embed
 		return nil, fmt.Errorf("embedding cache not available")
 	}
 
+	// Refuse queries embedded with another model than the index was built with
+	indexed, err := idx.IndexModel()
+	if err != nil {
+		return nil, fmt.Errorf("reading index model: %w", err)
+	}
+	if err := indexed.Check(cache.Model(), embedder.Dimensions()); err != nil {
+		return nil, err
+	}
+
 	// Get locations store
-	locations := idx.Locations()
-	if locations == nil {
+	if idx.Locations() == nil {
 		return nil, fmt.Errorf("location store not available")
 	}
 
-	// Create a v2-aware semantic searcher
-	return newV2SemanticSearcher(cache, locations, embedder, repoRoot), nil
-}
-
-// newV2SemanticSearcher creates a semantic searcher that uses v2 components.
-// This wraps the v2 cache and locations to provide the SemanticSearcher interface.
-func newV2SemanticSearcher(cache *embedding.EmbeddingCache, locations *embedding.LocationStore, embedder embedding.Embedder, repoRoot string) *embedding.SemanticSearcher {
-	// For now, we use the v1 semantic searcher with a shim.
-	// A proper implementation would use the v2 cache directly for search.
-	// TODO: Implement native v2 semantic search using cache + locations + vector index
-
-	// Fall back to trying to open v1 store for now
-	searcher, err := openSemanticSearcher()
-	if err != nil {
-		return nil
-	}
-	return searcher
+	return idx.Searcher(), nil
 }
 
-// getSnippetFnV2 returns a function that reads code snippets from files.
-// This is the same as the v1 version but defined here for v2 tools.
-func getSnippetFnV2() func(path string, start, end int) string {
+// getSnippetFnV2 returns a function that reads code snippets through the
+// v2 index, which serves chunk content stored at index time before falling
+// back to the files.
+func getSnippetFnV2(ctx context.Context, idx *indexer.Indexer) func(path string, start, end int) string {
 	return func(path string, start, end int) string {
-		result, err := files.GetFile(path, start, end)
+		snippet, err := idx.Snippet(ctx, path, start, end)
 		if err != nil {
 			return fmt.Sprintf("[Error reading %s: %v]", path, err)
 		}
 
-		snippet := result.Content
-
 		// Truncate if too long
 		if len(snippet) > 500 {
 			snippet = snippet[:500] + "..."
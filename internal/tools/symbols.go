@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -42,7 +43,7 @@ func registerFindSymbol(server *mcp.Server) {
 		},
 	}
 
-	handler := func(args map[string]any) (*mcp.ToolsCallResult, error) {
+	handler := func(ctx context.Context, args map[string]any) (*mcp.ToolsCallResult, error) {
 		name, ok := args["name"].(string)
 		if !ok || name == "" {
 			return nil, fmt.Errorf("name is required")
@@ -112,7 +113,7 @@ func registerListDefsInFile(server *mcp.Server) {
 		},
 	}
 
-	handler := func(args map[string]any) (*mcp.ToolsCallResult, error) {
+	handler := func(ctx context.Context, args map[string]any) (*mcp.ToolsCallResult, error) {
 		path, ok := args["path"].(string)
 		if !ok || path == "" {
 			return nil, fmt.Errorf("path is required")
@@ -165,9 +166,9 @@ func openIndex() (*symbols.Index, error) {
 	dbConfig := config.LoadDatabaseConfigFromEnv()
 
 	// Get current working directory as repo root for multi-repo isolation
-	cwd, err := os.Getwd()
+	cwd, err := currentRepoRoot()
 	if err != nil {
-		return nil, fmt.Errorf("getting working directory: %w", err)
+		return nil, err
 	}
 
 	// For SQLite, use path relative to current working directory
@@ -1,10 +1,12 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 
+	"codetect/internal/config"
 	"codetect/internal/mcp"
 	"codetect/internal/search/files"
 	"codetect/internal/search/keyword"
@@ -14,6 +16,7 @@ import (
 func RegisterAll(server *mcp.Server) {
 	registerSearchKeyword(server)
 	registerGetFile(server)
+	registerHealth(server)
 	RegisterSymbolTools(server)
 	RegisterSemanticTools(server)
 	RegisterV2SemanticTools(server) // v2 tools with RRF fusion
@@ -39,7 +42,7 @@ func registerSearchKeyword(server *mcp.Server) {
 		},
 	}
 
-	handler := func(args map[string]any) (*mcp.ToolsCallResult, error) {
+	handler := func(ctx context.Context, args map[string]any) (*mcp.ToolsCallResult, error) {
 		query, ok := args["query"].(string)
 		if !ok || query == "" {
 			return nil, fmt.Errorf("query is required")
@@ -102,7 +105,7 @@ func registerGetFile(server *mcp.Server) {
 		},
 	}
 
-	handler := func(args map[string]any) (*mcp.ToolsCallResult, error) {
+	handler := func(ctx context.Context, args map[string]any) (*mcp.ToolsCallResult, error) {
 		path, ok := args["path"].(string)
 		if !ok || path == "" {
 			return nil, fmt.Errorf("path is required")
@@ -139,3 +142,14 @@ func registerGetFile(server *mcp.Server) {
 
 	server.RegisterTool(tool, handler)
 }
+
+// currentRepoRoot returns the normalized repository root for the current
+// working directory, so that every tool keys its index lookups the same way
+// the indexer stored them.
+func currentRepoRoot() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("getting working directory: %w", err)
+	}
+	return config.NormalizeRepoRoot(cwd)
+}